@@ -0,0 +1,237 @@
+// ntpsyncctl 通过本地控制套接字查询和控制正在运行的ntpsync程序，用法类似chronyc。
+//
+//	ntpsyncctl [-socket 路径] [-json] 命令 [参数]
+//
+// 命令：
+//
+//	status            显示同步状态和服务器列表
+//	sync              立即执行一次同步
+//	add 地址          添加NTP服务器
+//	remove 地址       移除NTP服务器
+//	interval 间隔     修改定时同步的间隔，例如10m
+//	allan 地址        显示按服务器的同步历史计算的Allan偏差
+//	reload            重新加载配置文件
+//	events            持续显示同步事件，按Ctrl+C退出
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/control"
+)
+
+func main() {
+	socket := flag.String("socket", control.DefaultSocketPath, "控制套接字的路径")
+	asJSON := flag.Bool("json", false, "以JSON格式输出结果")
+	timeout := flag.Duration("timeout", 30*time.Second, "等待应答的超时时间，不适用于events")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := control.NewClient(*socket)
+	if err := run(ctx, client, *timeout, *asJSON, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "ntpsyncctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// usage 输出使用说明
+func usage() {
+	fmt.Fprintf(os.Stderr, `用法: ntpsyncctl [选项] 命令 [参数]
+
+命令:
+  status            显示同步状态和服务器列表
+  sync              立即执行一次同步
+  add 地址          添加NTP服务器
+  remove 地址       移除NTP服务器
+  interval 间隔     修改定时同步的间隔，例如10m
+  allan 地址        显示按服务器的同步历史计算的Allan偏差
+  reload            重新加载配置文件
+  events            持续显示同步事件
+
+选项:
+`)
+	flag.PrintDefaults()
+}
+
+// run 执行一个命令
+func run(ctx context.Context, client *control.Client, timeout time.Duration, asJSON bool, args []string) error {
+	command, args := args[0], args[1:]
+	want := map[string]int{"add": 1, "remove": 1, "interval": 1, "allan": 1}[command]
+	if len(args) != want {
+		return fmt.Errorf("命令%s需要%d个参数", command, want)
+	}
+
+	if command == "events" {
+		err := client.StreamEvents(ctx, func(e ntpsync.Event) error {
+			if asJSON {
+				return printJSON(e)
+			}
+			printEvent(e)
+			return nil
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch command {
+	case "status":
+		status, err := client.GetStatus(ctx)
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(status)
+		}
+		printStatus(status)
+	case "sync":
+		result, err := client.ForceSync(ctx)
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(result)
+		}
+		fmt.Printf("同步完成，偏移量 %v\n", result.Offset)
+	case "add", "remove":
+		var servers []string
+		var err error
+		if command == "add" {
+			servers, err = client.AddServer(ctx, args[0])
+		} else {
+			var removed bool
+			removed, servers, err = client.RemoveServer(ctx, args[0])
+			if err == nil && !removed {
+				err = fmt.Errorf("服务器 %s 不存在", args[0])
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(servers)
+		}
+		fmt.Printf("服务器: %s\n", strings.Join(servers, ", "))
+	case "interval":
+		interval, err := time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("无效的间隔 %q: %v", args[0], err)
+		}
+		if interval, err = client.SetInterval(ctx, interval); err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(interval.String())
+		}
+		fmt.Printf("同步间隔: %v\n", interval)
+	case "allan":
+		points, err := client.GetAllanDeviation(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			return printJSON(points)
+		}
+		if len(points) == 0 {
+			fmt.Printf("服务器 %s 的同步历史不足以计算Allan偏差\n", args[0])
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "τ\tAllan偏差\t差分数")
+		for _, p := range points {
+			fmt.Fprintf(w, "%v\t%.2e\t%d\n", p.Tau.Round(time.Second), p.Deviation, p.N)
+		}
+		w.Flush()
+	case "reload":
+		if err := client.Reload(ctx); err != nil {
+			return err
+		}
+		if !asJSON {
+			fmt.Println("配置已重新加载")
+		}
+	default:
+		return fmt.Errorf("未知的命令 %q", command)
+	}
+	return nil
+}
+
+// printJSON 以缩进的JSON输出v
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printStatus 以易读的格式输出同步状态
+func printStatus(status *control.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "当前时间\t%s\n", status.Now.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "偏移量\t%v\n", status.Offset)
+	if status.Periodic.LastSync.IsZero() {
+		fmt.Fprintf(w, "最后同步\t从未同步\n")
+	} else {
+		fmt.Fprintf(w, "最后同步\t%s（%v前）\n", status.Periodic.LastSync.Format(time.RFC3339),
+			status.Now.Sub(status.Periodic.LastSync).Round(time.Second))
+	}
+	if status.Periodic.Running {
+		fmt.Fprintf(w, "定时同步\t每%v\n", status.Periodic.Interval)
+	} else {
+		fmt.Fprintf(w, "定时同步\t未运行\n")
+	}
+	fmt.Fprintf(w, "成功/失败\t%d/%d\n", status.Periodic.SuccessCount, status.Periodic.ErrorCount)
+	if status.Periodic.LastError != nil {
+		fmt.Fprintf(w, "最后错误\t%v\n", status.Periodic.LastError)
+	}
+	w.Flush()
+
+	if len(status.ServerStatuses) == 0 {
+		fmt.Printf("\n服务器: %s\n", strings.Join(status.Servers, ", "))
+		return
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "服务器\t可达\t层级\t偏移量\t往返时间\t评分")
+	for _, s := range status.ServerStatuses {
+		fmt.Fprintf(w, "%s\t%v\t%d\t%v\t%v\t%.2f\n", s.Address, s.Reachable, s.Stratum, s.Offset, s.RTT, s.Score)
+	}
+	w.Flush()
+}
+
+// printEvent 以一行输出一个事件
+func printEvent(e ntpsync.Event) {
+	line := e.Time.Format(time.RFC3339) + " " + string(e.Type)
+	if e.Server != "" {
+		line += " server=" + e.Server
+	}
+	if e.Offset != 0 {
+		line += fmt.Sprintf(" offset=%v", e.Offset)
+	}
+	if e.Interval != 0 {
+		line += fmt.Sprintf(" interval=%v", e.Interval)
+	}
+	if e.Error != nil {
+		line += fmt.Sprintf(" error=%q", e.Error.Error())
+	}
+	fmt.Println(line)
+}
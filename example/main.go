@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/hy-iot/ntpsync/pkg/ntpsync"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
 )
 
 func main() {
@@ -96,12 +96,12 @@ func main() {
 	fmt.Printf("更新后的NTP时间: %v\n", ntpTime)
 	fmt.Printf("更新后的时间偏移量: %v\n", offset)
 
-	// 检查是否有root/管理员权限
-	isRoot := ntpsync.IsRootUser()
-	fmt.Printf("是否有root/管理员权限: %v\n", isRoot)
+	// 检查是否有设置系统时间的权限
+	permErr := ntpsync.CanSetSystemTime()
+	fmt.Printf("能否设置系统时间: %v\n", permErr == nil)
 
-	// 如果有root权限，尝试更新系统时间
-	if isRoot {
+	// 如果有权限，尝试更新系统时间
+	if permErr == nil {
 		fmt.Println("尝试更新系统时间...")
 		err = ntp.UpdateSystemTime()
 		if err != nil {
@@ -110,7 +110,7 @@ func main() {
 			fmt.Println("系统时间已成功更新")
 		}
 	} else {
-		fmt.Println("没有root/管理员权限，无法更新系统时间")
+		fmt.Printf("无法更新系统时间: %v\n", permErr)
 	}
 
 	// 添加新服务器
@@ -127,6 +127,7 @@ func main() {
 
 	// 更改同步间隔
 	fmt.Println("更改同步间隔...")
+	// 使用pool.ntp.org服务器时，间隔会被提高到ntpsync.PoolMinSyncInterval
 	ntp.SetPeriodicSyncInterval(30 * time.Second)
 	interval := ntp.GetPeriodicSyncInterval()
 	fmt.Printf("新的同步间隔: %v\n", interval)
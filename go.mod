@@ -1,4 +1,4 @@
-module github.com/hy-iot/ntpsync
+module github.com/hy-iot/ntpsync/v2
 
 go 1.23.0
 
@@ -0,0 +1,121 @@
+package ntpsync
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// allanMaxGap 是计算Allan偏差时允许的最大样本间隔与典型间隔之比，间隔更大时在此处分段，
+// 不在设备离线或长时间同步失败的时段插值
+const allanMaxGap = 3
+
+// AllanPoint 是一个观测间隔的Allan偏差
+type AllanPoint struct {
+	// Tau 是观测间隔
+	Tau time.Duration `json:"tau"`
+
+	// Deviation 是相对频率的Allan偏差，无量纲，例如1e-8相当于0.01ppm
+	Deviation float64 `json:"deviation"`
+
+	// N 是参与计算的二次差分的数量，越少估计越不可靠
+	N int `json:"n"`
+}
+
+// AllanDeviation 把按时间排序的同步结果的偏移量作为本地时钟的相位，计算观测间隔为τ0、2τ0、4τ0……
+// 的重叠Allan偏差，直到数据不足为止，失败和被拒绝的结果被跳过。τ0是结果间隔的中位数；
+// 偏移量先按τ0线性插值为等间隔的序列，间隔超过3τ0的地方分段。结果不足时返回nil。
+//
+// 网络测量的噪声使短观测间隔的Allan偏差大致按1/τ下降，之后晶振本身的不稳定占主导，
+// 曲线转平或开始上升；转折处的τ是测量噪声与晶振漂移相当的间隔，适合作为该类设备的同步间隔
+func AllanDeviation(results []SyncResult) []AllanPoint {
+	samples := make([]driftSample, 0, len(results))
+	for _, r := range results {
+		if r.Error == nil && !r.Rejected {
+			samples = append(samples, driftSample{local: r.Time, offset: r.Offset})
+		}
+	}
+	return allanDeviation(samples)
+}
+
+// allanDeviation 计算按时间排序的样本的重叠Allan偏差
+func allanDeviation(samples []driftSample) []AllanPoint {
+	tau0 := typicalInterval(samples)
+	if tau0 <= 0 {
+		return nil
+	}
+	segments := resamplePhase(samples, tau0)
+
+	var points []AllanPoint
+	for m := 1; ; m *= 2 {
+		var sum float64
+		var count int
+		for _, x := range segments {
+			for i := 0; i+2*m < len(x); i++ {
+				d := x[i+2*m] - 2*x[i+m] + x[i]
+				sum += d * d
+				count++
+			}
+		}
+		if count == 0 {
+			return points
+		}
+		tau := time.Duration(m) * tau0
+		points = append(points, AllanPoint{
+			Tau:       tau,
+			Deviation: math.Sqrt(sum/(2*float64(count))) / tau.Seconds(),
+			N:         count,
+		})
+	}
+}
+
+// typicalInterval 返回相邻样本间隔的中位数，没有正的间隔时返回0
+func typicalInterval(samples []driftSample) time.Duration {
+	var intervals []time.Duration
+	for i := 1; i < len(samples); i++ {
+		if d := samples[i].local.Sub(samples[i-1].local); d > 0 {
+			intervals = append(intervals, d)
+		}
+	}
+	if len(intervals) == 0 {
+		return 0
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	return intervals[len(intervals)/2]
+}
+
+// resamplePhase 把样本的偏移量线性插值为间隔为tau0的相位序列，单位为秒，
+// 在间隔超过allanMaxGap倍tau0的地方分为多段
+func resamplePhase(samples []driftSample, tau0 time.Duration) [][]float64 {
+	var segments [][]float64
+	start := 0
+	for i := 1; i <= len(samples); i++ {
+		if i < len(samples) && samples[i].local.Sub(samples[i-1].local) <= allanMaxGap*tau0 {
+			continue
+		}
+		segments = append(segments, interpolatePhase(samples[start:i], tau0))
+		start = i
+	}
+	return segments
+}
+
+// interpolatePhase 从第一个样本开始每隔tau0线性插值一个相位
+func interpolatePhase(samples []driftSample, tau0 time.Duration) []float64 {
+	first, last := samples[0].local, samples[len(samples)-1].local
+	var x []float64
+	j := 0
+	for t := first; !t.After(last); t = t.Add(tau0) {
+		for j+1 < len(samples) && !samples[j+1].local.After(t) {
+			j++
+		}
+		a := samples[j]
+		if j+1 == len(samples) || !a.local.Before(t) {
+			x = append(x, a.offset.Seconds())
+			continue
+		}
+		b := samples[j+1]
+		frac := t.Sub(a.local).Seconds() / b.local.Sub(a.local).Seconds()
+		x = append(x, a.offset.Seconds()+frac*(b.offset-a.offset).Seconds())
+	}
+	return x
+}
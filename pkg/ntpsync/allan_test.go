@@ -0,0 +1,83 @@
+package ntpsync
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestAllanDeviation 测试白相位噪声的Allan偏差按1/τ下降，失败和被拒绝的结果不参与计算
+func TestAllanDeviation(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var results []SyncResult
+	for i := 0; i < 1024; i++ {
+		offset := time.Duration(rng.NormFloat64() * float64(time.Millisecond))
+		results = append(results, SyncResult{Time: start.Add(time.Duration(i) * 64 * time.Second), Offset: offset})
+		if i%100 == 0 {
+			results = append(results, SyncResult{Time: start.Add(time.Duration(i)*64*time.Second + time.Second), Offset: time.Second, Rejected: true})
+		}
+	}
+
+	points := AllanDeviation(results)
+	if len(points) < 8 || points[0].Tau != 64*time.Second || points[0].N != 1022 {
+		t.Fatalf("预期从64秒开始倍增的观测间隔，实际得到%+v", points)
+	}
+	// 白相位噪声σ(τ)≈√3·σx/τ
+	if d := points[0].Deviation; d < 2.3e-5 || d > 3.1e-5 {
+		t.Errorf("预期τ=64s的Allan偏差约为2.7e-5，实际得到%.2e", d)
+	}
+	if ratio := points[0].Deviation / points[3].Deviation; ratio < 6 || ratio > 10 {
+		t.Errorf("预期τ增大8倍时Allan偏差减小约8倍，实际减小%.1f倍", ratio)
+	}
+
+	data, err := json.Marshal(points[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded AllanPoint
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != points[0] {
+		t.Errorf("预期JSON往返后相同，实际得到%s和%+v", data, decoded)
+	}
+
+	if AllanDeviation(results[:1]) != nil {
+		t.Error("预期一个结果时返回nil")
+	}
+}
+
+// TestGetAllanDeviation 测试按服务器计算同步历史的Allan偏差
+func TestGetAllanDeviation(t *testing.T) {
+	clock := newFakeClock()
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		MinPollInterval: -1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	for i := 0; i < 8; i++ {
+		srv.SetOffset(time.Duration(i%2) * time.Millisecond)
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+		clock.Advance(time.Minute)
+	}
+	// 结果的时间是校准后的时间，间隔随偏移量变化不到1毫秒
+	points := ntp.GetAllanDeviation(srv.Addr())
+	if len(points) != 2 || points[0].Tau.Round(time.Second) != time.Minute || points[0].Deviation <= 0 {
+		t.Errorf("预期τ为1分钟和2分钟的Allan偏差，实际得到%+v", points)
+	}
+	if points := ntp.GetAllanDeviation("192.0.2.1"); points != nil {
+		t.Errorf("预期没有历史的服务器返回nil，实际得到%+v", points)
+	}
+}
@@ -0,0 +1,230 @@
+// Package analysis 离线分析设备在现场记录的测量，估计本地晶振的频率偏差和稳定度，
+// 用于比较不同批次或型号的硬件，以及为各类设备选择合适的同步间隔。
+//
+// 数据来自Options.StatsDir写入的peerstats和loopstats（ntpd格式或JSONL格式，
+// 也可以是ntpd自己写入的文件），或者导出的同步历史：
+//
+//	samples, err := analysis.ReadDir("/var/log/ntpsync", ntpsync.PeerStatsName)
+//	for server, s := range analysis.ByServer(samples) {
+//		report, err := analysis.Analyze(s)
+//		if err != nil {
+//			continue
+//		}
+//		fmt.Printf("%s 频率偏差 %.3f±%.3fppm p99 %v\n", server, report.Frequency, report.Skew, report.Percentile(99))
+//		for _, p := range report.Allan {
+//			fmt.Printf("  τ=%v σ=%.2e\n", p.Tau, p.Deviation)
+//		}
+//	}
+//
+// 偏移量的符号与ntpsync相同：正值表示本地时钟落后，频率偏差为正表示本地时钟走得慢。
+// 同一文件中有多个服务器的样本时，应当先用ByServer分开，不同服务器的非对称延迟不同，混在一起会增加噪声
+package analysis
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// ErrTooFewSamples 表示样本不足以进行分析
+var ErrTooFewSamples = errors.New("至少需要两个时间不同的样本")
+
+// DefaultPercentiles 是Analyze计算的偏移量绝对值的百分位数
+var DefaultPercentiles = []float64{50, 90, 95, 99}
+
+// Sample 是一次测量
+type Sample struct {
+	// Time 是测量时的时间
+	Time time.Time
+
+	// Server 是服务器地址，loopstats的样本为空
+	Server string
+
+	// Offset 是测得的偏移量，loopstats的样本为应用到Now的偏移量
+	Offset time.Duration
+
+	// Delay 是往返时间，loopstats的样本为0
+	Delay time.Duration
+}
+
+// ByServer 按服务器分开样本，每个服务器的样本保持原来的顺序
+func ByServer(samples []Sample) map[string][]Sample {
+	servers := make(map[string][]Sample)
+	for _, s := range samples {
+		servers[s.Server] = append(servers[s.Server], s)
+	}
+	return servers
+}
+
+// Between 返回时间在[start, end)之内的样本，零值表示不限制
+func Between(samples []Sample, start, end time.Time) []Sample {
+	var selected []Sample
+	for _, s := range samples {
+		if (start.IsZero() || !s.Time.Before(start)) && (end.IsZero() || s.Time.Before(end)) {
+			selected = append(selected, s)
+		}
+	}
+	return selected
+}
+
+// Percentile 是偏移量绝对值的一个百分位数
+type Percentile struct {
+	// P 是百分位，例如99
+	P float64 `json:"p"`
+
+	// Offset 是不超过P%的样本的偏移量绝对值
+	Offset time.Duration `json:"offset"`
+}
+
+// AllanPoint 是一个观测间隔的Allan偏差
+type AllanPoint = ntpsync.AllanPoint
+
+// Report 是一组样本的分析结果
+type Report struct {
+	// Samples 是样本数量
+	Samples int `json:"samples"`
+
+	// Start 和 End 是第一个和最后一个样本的时间
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Frequency 是用最小二乘法拟合的频率偏差，单位为ppm
+	Frequency float64 `json:"frequency_ppm"`
+
+	// Skew 是Frequency的标准误差，单位为ppm，样本少于三个时为0
+	Skew float64 `json:"skew_ppm"`
+
+	// StdDev 是偏移量去掉频率偏差造成的线性变化之后的标准差，反映测量的噪声
+	StdDev time.Duration `json:"stddev"`
+
+	// Percentiles 是偏移量绝对值的DefaultPercentiles百分位数
+	Percentiles []Percentile `json:"percentiles"`
+
+	// Allan 是按倍增的观测间隔计算的Allan偏差，参见AllanDeviation
+	Allan []AllanPoint `json:"allan,omitempty"`
+}
+
+// Percentile 返回Percentiles中百分位为p的值，没有计算时返回0
+func (r Report) Percentile(p float64) time.Duration {
+	for _, pct := range r.Percentiles {
+		if pct.P == p {
+			return pct.Offset
+		}
+	}
+	return 0
+}
+
+// Analyze 计算按时间排序的一组样本的频率偏差、偏移量的百分位数和Allan偏差，
+// 样本应当来自同一个服务器或同一个实例的loopstats
+func Analyze(samples []Sample) (Report, error) {
+	freq, skew, err := Drift(samples)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{
+		Samples:   len(samples),
+		Start:     samples[0].Time,
+		End:       samples[len(samples)-1].Time,
+		Frequency: freq,
+		Skew:      skew,
+		StdDev:    residualStdDev(samples, freq),
+		Allan:     AllanDeviation(samples),
+	}
+	offsets := absOffsets(samples)
+	for _, p := range DefaultPercentiles {
+		report.Percentiles = append(report.Percentiles, Percentile{P: p, Offset: percentileOf(offsets, p)})
+	}
+	return report, nil
+}
+
+// Drift 用最小二乘法拟合偏移量随时间变化的速率，返回频率偏差及其标准误差，单位为ppm；
+// 样本少于三个时无法估计标准误差，返回0
+func Drift(samples []Sample) (freq, skew float64, err error) {
+	count := len(samples)
+	if count < 2 {
+		return 0, 0, ErrTooFewSamples
+	}
+
+	first := samples[0].Time
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.Time.Sub(first).Seconds()
+		sumY += s.Offset.Seconds()
+	}
+	meanX, meanY := sumX/float64(count), sumY/float64(count)
+
+	var sxy, sxx float64
+	for _, s := range samples {
+		dx := s.Time.Sub(first).Seconds() - meanX
+		sxy += dx * (s.Offset.Seconds() - meanY)
+		sxx += dx * dx
+	}
+	if sxx == 0 {
+		return 0, 0, ErrTooFewSamples
+	}
+	slope := sxy / sxx
+
+	if count > 2 {
+		var ssr float64
+		for _, s := range samples {
+			residual := s.Offset.Seconds() - meanY - slope*(s.Time.Sub(first).Seconds()-meanX)
+			ssr += residual * residual
+		}
+		skew = math.Sqrt(ssr / float64(count-2) / sxx)
+	}
+	return slope * 1e6, skew * 1e6, nil
+}
+
+// AllanDeviation 把按时间排序的样本的偏移量作为本地时钟的相位，计算观测间隔为τ0、2τ0、4τ0……
+// 的重叠Allan偏差，算法与ntpsync.AllanDeviation相同。样本不足时返回nil
+func AllanDeviation(samples []Sample) []AllanPoint {
+	results := make([]ntpsync.SyncResult, len(samples))
+	for i, s := range samples {
+		results[i] = ntpsync.SyncResult{Time: s.Time, Offset: s.Offset}
+	}
+	return ntpsync.AllanDeviation(results)
+}
+
+// residualStdDev 返回偏移量去掉频率偏差freq（ppm）造成的线性变化之后的标准差
+func residualStdDev(samples []Sample, freq float64) time.Duration {
+	first := samples[0].Time
+	residuals := make([]float64, len(samples))
+	var sum float64
+	for i, s := range samples {
+		residuals[i] = s.Offset.Seconds() - freq*1e-6*s.Time.Sub(first).Seconds()
+		sum += residuals[i]
+	}
+	mean := sum / float64(len(residuals))
+	var variance float64
+	for _, r := range residuals {
+		variance += (r - mean) * (r - mean)
+	}
+	return time.Duration(math.Sqrt(variance/float64(len(residuals))) * float64(time.Second))
+}
+
+// absOffsets 返回从小到大排列的偏移量绝对值
+func absOffsets(samples []Sample) []time.Duration {
+	offsets := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		offsets[i] = s.Offset
+		if offsets[i] < 0 {
+			offsets[i] = -offsets[i]
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// percentileOf 用最近秩法返回已排序的sorted中第p百分位的值
+func percentileOf(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	rank = min(max(rank, 1), len(sorted))
+	return sorted[rank-1]
+}
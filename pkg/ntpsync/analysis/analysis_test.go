@@ -0,0 +1,92 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// driftingSamples 生成每隔interval一个、频率偏差为ppm、测量噪声标准差为noise的样本
+func driftingSamples(count int, interval time.Duration, ppm float64, noise time.Duration) []Sample {
+	rng := rand.New(rand.NewSource(1))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := make([]Sample, count)
+	for i := range samples {
+		elapsed := time.Duration(i) * interval
+		offset := time.Duration(ppm*1e-6*float64(elapsed)) + time.Duration(rng.NormFloat64()*float64(noise))
+		samples[i] = Sample{Time: start.Add(elapsed), Server: "a", Offset: offset}
+	}
+	return samples
+}
+
+// TestAnalyze 测试从有噪声的样本中估计频率偏差和百分位数
+func TestAnalyze(t *testing.T) {
+	samples := driftingSamples(500, 64*time.Second, 20, time.Millisecond)
+	report, err := Analyze(samples)
+	if err != nil {
+		t.Fatalf("分析失败: %v", err)
+	}
+	if report.Samples != 500 || !report.Start.Equal(samples[0].Time) || !report.End.Equal(samples[499].Time) {
+		t.Errorf("预期样本数量和时间范围与输入相同，实际得到%+v", report)
+	}
+	if math.Abs(report.Frequency-20) > 0.1 || report.Skew <= 0 || report.Skew > 0.1 {
+		t.Errorf("预期频率偏差约为20ppm，实际得到%.3f±%.3f", report.Frequency, report.Skew)
+	}
+	if report.StdDev < 900*time.Microsecond || report.StdDev > 1100*time.Microsecond {
+		t.Errorf("预期残差的标准差约为1ms，实际得到%v", report.StdDev)
+	}
+	if p50, p99 := report.Percentile(50), report.Percentile(99); p50 <= 0 || p50 >= p99 {
+		t.Errorf("预期第50百分位数小于第99百分位数，实际得到%v和%v", p50, p99)
+	}
+
+	if _, err := Analyze(samples[:1]); err != ErrTooFewSamples {
+		t.Errorf("预期一个样本返回ErrTooFewSamples，实际得到%v", err)
+	}
+}
+
+// TestAllanDeviation 测试白相位噪声的Allan偏差按1/τ下降，以及在离线的时段分段
+func TestAllanDeviation(t *testing.T) {
+	samples := driftingSamples(1024, time.Second, 0, time.Millisecond)
+	points := AllanDeviation(samples)
+	if len(points) < 8 || points[0].Tau != time.Second || points[1].Tau != 2*time.Second {
+		t.Fatalf("预期从1秒开始倍增的观测间隔，实际得到%+v", points)
+	}
+	// 白相位噪声σ(τ)≈√3·σx/τ
+	if d := points[0].Deviation; d < 1.5e-3 || d > 2e-3 {
+		t.Errorf("预期τ=1s的Allan偏差约为1.7e-3，实际得到%.2e", d)
+	}
+	if ratio := points[0].Deviation / points[3].Deviation; ratio < 6 || ratio > 10 {
+		t.Errorf("预期τ增大8倍时Allan偏差减小约8倍，实际减小%.1f倍", ratio)
+	}
+
+	// 中间离线一小时，两段各自计算，不在离线期间插值
+	gap := append(driftingSamples(10, time.Second, 0, 0), driftingSamples(10, time.Second, 0, 0)...)
+	for i := 10; i < 20; i++ {
+		gap[i].Time = gap[i].Time.Add(time.Hour)
+	}
+	if points := AllanDeviation(gap); len(points) == 0 || points[0].N != 16 {
+		t.Errorf("预期两段各有8个二次差分，实际得到%+v", points)
+	}
+
+	if AllanDeviation(samples[:1]) != nil {
+		t.Error("预期一个样本时返回nil")
+	}
+}
+
+// TestByServer 测试按服务器和时间范围选择样本
+func TestByServer(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := []Sample{
+		{Time: start, Server: "a"},
+		{Time: start.Add(time.Minute), Server: "b"},
+		{Time: start.Add(2 * time.Minute), Server: "a"},
+	}
+	servers := ByServer(samples)
+	if len(servers["a"]) != 2 || len(servers["b"]) != 1 {
+		t.Errorf("预期a有2个样本、b有1个样本，实际得到%+v", servers)
+	}
+	if s := Between(samples, start.Add(time.Minute), time.Time{}); len(s) != 2 || s[0].Server != "b" {
+		t.Errorf("预期选择后两个样本，实际得到%+v", s)
+	}
+}
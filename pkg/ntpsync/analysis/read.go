@@ -0,0 +1,182 @@
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// mjdUnixEpoch 是1970年1月1日的修正儒略日
+const mjdUnixEpoch = 40587
+
+// ReadStats 读取ntpd格式或JSONL格式的peerstats或loopstats，每行的格式分别判断：
+// 以"{"开头的行按JSON解析，否则按字段数量区分peerstats（8个）和loopstats（7个）。
+// 空行和以"#"开头的注释被忽略，JSONL中失败或被拒绝的同步结果被跳过。返回的样本按时间排序
+func ReadStats(r io.Reader) ([]Sample, error) {
+	var samples []Sample
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		var s Sample
+		var ok bool
+		var err error
+		if text[0] == '{' {
+			s, ok, err = parseJSONLine(text)
+		} else {
+			s, err = parseNTPDLine(text)
+			ok = err == nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: %v", line, err)
+		}
+		if ok {
+			samples = append(samples, s)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sortSamples(samples)
+	return samples, nil
+}
+
+// ReadHistory 读取JSON编码的同步历史：GetHistory返回的[]SyncResult，
+// 或FileStore保存的包含history的状态文件。失败或被拒绝的同步结果被跳过，返回的样本按时间排序
+func ReadHistory(r io.Reader) ([]Sample, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ntpsync.SyncResult
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &results)
+	} else {
+		var state ntpsync.State
+		err = json.Unmarshal(data, &state)
+		results = state.History
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析同步历史失败: %v", err)
+	}
+
+	samples := make([]Sample, 0, len(results))
+	for _, r := range results {
+		if s, ok := fromResult(r); ok {
+			samples = append(samples, s)
+		}
+	}
+	sortSamples(samples)
+	return samples, nil
+}
+
+// ReadFiles 依次用ReadStats读取多个文件，合并后按时间排序
+func ReadFiles(paths ...string) ([]Sample, error) {
+	var samples []Sample
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		s, err := ReadStats(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %v", path, err)
+		}
+		samples = append(samples, s...)
+	}
+	sortSamples(samples)
+	return samples, nil
+}
+
+// ReadDir 读取dir中名称为name（ntpsync.PeerStatsName或ntpsync.LoopStatsName）的所有按日期轮换的文件，
+// 即Options.StatsDir中写入的日志
+func ReadDir(dir, name string) ([]Sample, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, name+".*"))
+	if err != nil {
+		return nil, err
+	}
+	return ReadFiles(paths...)
+}
+
+// parseNTPDLine 解析ntpd格式的一行，开头是修正儒略日和当天的秒数，
+// peerstats接着是服务器地址、状态字、偏移量和往返时间，loopstats接着是偏移量
+func parseNTPDLine(line string) (Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 7 && len(fields) != 8 {
+		return Sample{}, fmt.Errorf("无法识别的行，字段数量为%d", len(fields))
+	}
+	day, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("无效的修正儒略日%q", fields[0])
+	}
+	seconds, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("无效的秒数%q", fields[1])
+	}
+	s := Sample{
+		Time: time.Unix((day-mjdUnixEpoch)*86400, 0).UTC().Add(time.Duration(math.Round(seconds * float64(time.Second)))),
+	}
+
+	offsetField := fields[2]
+	if len(fields) == 8 {
+		s.Server = fields[2]
+		offsetField = fields[4]
+		if s.Delay, err = parseSeconds(fields[5]); err != nil {
+			return Sample{}, err
+		}
+	}
+	if s.Offset, err = parseSeconds(offsetField); err != nil {
+		return Sample{}, err
+	}
+	return s, nil
+}
+
+// parseJSONLine 解析JSONL格式的一行，peerstats的SyncResult和loopstats的LoopStats都有时间和偏移量，
+// 失败或被拒绝的同步结果返回的ok为false
+func parseJSONLine(line string) (Sample, bool, error) {
+	var r ntpsync.SyncResult
+	if err := json.Unmarshal([]byte(line), &r); err != nil {
+		return Sample{}, false, err
+	}
+	s, ok := fromResult(r)
+	return s, ok, nil
+}
+
+// fromResult 把同步结果转换为样本
+func fromResult(r ntpsync.SyncResult) (Sample, bool) {
+	if r.Error != nil || r.Rejected || r.Time.IsZero() {
+		return Sample{}, false
+	}
+	return Sample{Time: r.Time, Server: r.Server, Offset: r.Offset, Delay: r.RTT}, true
+}
+
+// parseSeconds 把以秒为单位的小数转换为时长
+func parseSeconds(s string) (time.Duration, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的数值%q", s)
+	}
+	return time.Duration(math.Round(v * float64(time.Second))), nil
+}
+
+// sortSamples 按时间排序，时间相同的样本保持原来的顺序
+func sortSamples(samples []Sample) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+}
@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// TestReadStats 测试读取ntpd格式和JSONL格式的统计文件
+func TestReadStats(t *testing.T) {
+	input := `# ntpd peerstats
+60310 45000.500 192.168.1.10 9400 0.000123456 0.001234567 0.000001037 0.000045678
+60310 3600.000 0.000100000 -12.345 0.000045678 0.012345 12
+
+{"time":"2024-01-01T00:00:00Z","server":"a:123","offset":"2ms","rtt":"10ms"}
+{"time":"2024-01-01T00:01:00Z","server":"a:123","offset":"0s","rtt":"0s","error":"超时"}
+`
+	samples, err := ReadStats(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("预期3个样本，实际得到%+v", samples)
+	}
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := []Sample{
+		{Time: day, Server: "a:123", Offset: 2 * time.Millisecond, Delay: 10 * time.Millisecond},
+		{Time: day.Add(time.Hour), Offset: 100 * time.Microsecond},
+		{Time: day.Add(45000500 * time.Millisecond), Server: "192.168.1.10", Offset: 123456 * time.Nanosecond, Delay: 1234567 * time.Nanosecond},
+	}
+	for i, s := range samples {
+		if !s.Time.Equal(want[i].Time) || s.Server != want[i].Server || s.Offset != want[i].Offset || s.Delay != want[i].Delay {
+			t.Errorf("第%d个样本预期%+v，实际得到%+v", i, want[i], s)
+		}
+	}
+
+	if _, err := ReadStats(strings.NewReader("60310 1 2\n")); err == nil {
+		t.Error("预期无法识别的行返回错误")
+	}
+}
+
+// TestReadHistory 测试读取GetHistory的JSON和状态文件中的同步历史
+func TestReadHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := []ntpsync.SyncResult{
+		{Time: start.Add(time.Minute), Server: "a", Offset: time.Millisecond},
+		{Time: start, Server: "a", Offset: 2 * time.Millisecond, Rejected: true},
+		{Time: start, Server: "b", Offset: 3 * time.Millisecond},
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := ReadHistory(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if len(samples) != 2 || samples[0].Server != "b" || samples[1].Offset != time.Millisecond {
+		t.Errorf("预期跳过被拒绝的结果并按时间排序，实际得到%+v", samples)
+	}
+
+	data, err = json.Marshal(ntpsync.State{Saved: start, History: history})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples, err := ReadHistory(strings.NewReader(string(data))); err != nil || len(samples) != 2 {
+		t.Errorf("预期从状态文件读取2个样本，实际得到%+v, %v", samples, err)
+	}
+}
+
+// TestReadDir 测试按日期读取目录中的所有文件
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"peerstats.20240102":       "60311 0.000 a 9400 0.002 0.01 0 0\n",
+		"peerstats.20240101.jsonl": `{"time":"2024-01-01T00:00:00Z","server":"a","offset":"1ms"}` + "\n",
+		"loopstats.20240101":       "60310 0.000 0.003 0 0 0 6\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	samples, err := ReadDir(dir, ntpsync.PeerStatsName)
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if len(samples) != 2 || samples[0].Offset != time.Millisecond || samples[1].Offset != 2*time.Millisecond {
+		t.Errorf("预期按时间排列的两个peerstats样本，实际得到%+v", samples)
+	}
+}
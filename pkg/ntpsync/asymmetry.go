@@ -0,0 +1,12 @@
+package ntpsync
+
+import "time"
+
+// asymmetryCorrection 返回按服务器配置的路径非对称对偏移量的修正，configured是配置中的服务器地址。
+// 请求方向比应答方向慢Asymmetry时，测得的偏移量偏大Asymmetry/2
+func (n *NTPSync) asymmetryCorrection(configured string) time.Duration {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	return -n.serverOptions[configured].Asymmetry / 2
+}
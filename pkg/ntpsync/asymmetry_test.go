@@ -0,0 +1,52 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestAsymmetry 测试按配置的固定路径非对称修正偏移量
+func TestAsymmetry(t *testing.T) {
+	clock := newFakeClock()
+	network := ntptest.NewNetwork()
+	network.SetClock(clock.Now, clock.Advance)
+	srv := network.NewServer("10.0.0.1:123")
+	srv.SetDelay(20 * time.Millisecond)
+	// 应答方向多出100ms，请求方向比应答方向快100ms
+	srv.SetTransmitLatency(100 * time.Millisecond)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		Dialer:          network,
+		MinPollInterval: -1,
+		ServerOptions: map[string]ServerOptions{
+			srv.Addr(): {Asymmetry: -100 * time.Millisecond},
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	result, err := ntp.syncWithServerBinary(srv.Addr(), time.Second)
+	if err != nil {
+		t.Fatalf("测量失败: %v", err)
+	}
+	if result.Asymmetry != 50*time.Millisecond {
+		t.Errorf("预期修正量为50ms，实际得到%v", result.Asymmetry)
+	}
+	if absDuration(result.Offset) > time.Microsecond {
+		t.Errorf("预期修正后的偏移量约为0，实际得到%v", result.Offset)
+	}
+
+	cfg, err := ParseConfig([]byte("servers:\n  - address: a\n    asymmetry: -100ms\n"), "yaml")
+	if err != nil {
+		t.Fatalf("解析配置失败: %v", err)
+	}
+	if got := cfg.Servers[0].Asymmetry; got != -100*time.Millisecond {
+		t.Errorf("预期配置的非对称为-100ms，实际得到%v", got)
+	}
+}
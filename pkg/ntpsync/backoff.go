@@ -0,0 +1,58 @@
+package ntpsync
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// 失败重试的默认退避参数
+const (
+	// DefaultBackoffInitial 是第一次失败后的默认重试等待时间
+	DefaultBackoffInitial = 2 * time.Second
+
+	// DefaultBackoffMax 是失败重试等待时间的默认上限
+	DefaultBackoffMax = 1 * time.Hour
+)
+
+// backoffDelay 返回连续第failures次失败后的重试等待时间
+// 等待时间从initial开始每次加倍，不超过max，并在后一半范围内随机抖动，
+// 避免大量客户端在服务器恢复时同时重试
+func backoffDelay(initial, max time.Duration, failures int) time.Duration {
+	delay := initial
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + rand.N(half+1)
+}
+
+// jitterInterval 将同步间隔随机调整±jitter的比例，
+// 避免大量配置相同的设备在同一时刻向同一组服务器发送请求
+func jitterInterval(interval time.Duration, jitter float64) time.Duration {
+	spread := time.Duration(float64(interval) * jitter)
+	if spread <= 0 {
+		return interval
+	}
+	return interval - spread + rand.N(2*spread+1)
+}
+
+// initialDelayLocked 返回启动定时同步后到初始同步的等待时间：设置了SyncIntervalJitter时
+// 在0到同步间隔的相应比例之间随机选择，避免批量重启的设备在同一时刻进行初始同步；
+// 使用同步计划时立即同步。调用者必须持有n.mutex
+func (n *NTPSync) initialDelayLocked() time.Duration {
+	if n.schedule != nil {
+		return 0
+	}
+	spread := time.Duration(float64(n.syncInterval) * n.intervalJitter)
+	if spread <= 0 {
+		return 0
+	}
+	return rand.N(spread + 1)
+}
@@ -0,0 +1,200 @@
+package ntpsync
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestBackoffDelay 测试退避时间的增长、上限和抖动范围
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		max      time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{10, time.Minute},
+		{100, time.Minute},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got := backoffDelay(2*time.Second, time.Minute, tt.failures)
+			if got < tt.max/2 || got > tt.max {
+				t.Fatalf("第%d次失败: 预期等待时间在%v到%v之间，实际得到%v", tt.failures, tt.max/2, tt.max, got)
+			}
+		}
+	}
+}
+
+// TestJitterInterval 测试同步间隔的随机调整范围和最小间隔限制
+func TestJitterInterval(t *testing.T) {
+	varied := false
+	for i := 0; i < 100; i++ {
+		got := jitterInterval(time.Hour, 0.1)
+		if got < 54*time.Minute || got > 66*time.Minute {
+			t.Fatalf("预期等待时间在54到66分钟之间，实际得到%v", got)
+		}
+		varied = varied || got != time.Hour
+	}
+	if !varied {
+		t.Error("预期等待时间被随机调整")
+	}
+	if got := jitterInterval(time.Hour, 0); got != time.Hour {
+		t.Errorf("预期不调整时等待同步间隔，实际得到%v", got)
+	}
+
+	ntp, err := New(Options{
+		Servers:            []string{"127.0.0.1:1"},
+		SyncInterval:       10 * time.Second,
+		MinPollInterval:    10 * time.Second,
+		SyncIntervalJitter: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	for i := 0; i < 100; i++ {
+		if got := ntp.nextDelay(nil); got < 10*time.Second || got > 15*time.Second {
+			t.Fatalf("预期等待时间不小于最小请求间隔，实际得到%v", got)
+		}
+	}
+
+	if _, err := New(Options{Servers: []string{"127.0.0.1:1"}, SyncIntervalJitter: 1}); err == nil {
+		t.Error("预期随机调整比例为1时返回错误，实际得到nil")
+	}
+	if _, err := New(Options{Servers: []string{"127.0.0.1:1"}, SyncIntervalJitter: math.NaN()}); err == nil {
+		t.Error("预期随机调整比例为NaN时返回错误，实际得到nil")
+	}
+}
+
+// TestInitialSyncJitter 测试设置随机调整比例时初始同步被随机推迟
+func TestInitialSyncJitter(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:            []string{srv.Addr()},
+		Timeout:            time.Second,
+		SyncInterval:       time.Hour,
+		SyncIntervalJitter: 0.1,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	start := clock.Now()
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+	next := ntp.GetPeriodicSyncStatus().NextSync
+	if next.Before(start) || next.After(start.Add(6*time.Minute)) {
+		t.Fatalf("预期初始同步推迟0到6分钟，实际计划在%v之后", next.Sub(start))
+	}
+
+	if next.After(start) {
+		clock.waitForTimers(t, 1)
+		if got := srv.RequestCount(); got != 0 {
+			t.Errorf("预期推迟期间没有发送请求，实际服务器收到%d个请求", got)
+		}
+		clock.Advance(next.Sub(start))
+	}
+	waitForSyncs(t, ntp, 1)
+}
+
+// TestPeriodicSyncBackoff 测试连续失败时定时同步按指数退避重试
+func TestPeriodicSyncBackoff(t *testing.T) {
+	clock := newFakeClock()
+
+	ntp, err := New(Options{
+		Servers:        []string{"127.0.0.1:1"},
+		Timeout:        100 * time.Millisecond,
+		SyncInterval:   time.Second,
+		BackoffInitial: 10 * time.Second,
+		BackoffMax:     time.Minute,
+		Clock:          clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+
+	// 初始同步失败后，不会按1秒的同步间隔重试
+	clock.waitForTimers(t, 1)
+	clock.Advance(4 * time.Second)
+	if got := ntp.GetPeriodicSyncStatus().ErrorCount; got != 1 {
+		t.Fatalf("预期退避期间没有重试，实际失败%d次", got)
+	}
+
+	// 第一次退避最长10秒
+	clock.Advance(6 * time.Second)
+	clock.waitForTimers(t, 1)
+	status := ntp.GetPeriodicSyncStatus()
+	if status.ErrorCount != 2 || status.ConsecutiveFailures != 2 {
+		t.Fatalf("预期第一次退避后重试，实际失败%d次、连续失败%d次", status.ErrorCount, status.ConsecutiveFailures)
+	}
+
+	// 第二次退避在10到20秒之间
+	clock.Advance(9 * time.Second)
+	if got := ntp.GetPeriodicSyncStatus().ErrorCount; got != 2 {
+		t.Fatalf("预期退避时间加倍，实际失败%d次", got)
+	}
+	clock.Advance(11 * time.Second)
+	clock.waitForTimers(t, 1)
+	if got := ntp.GetPeriodicSyncStatus().ErrorCount; got != 3 {
+		t.Fatalf("预期第二次退避后重试，实际失败%d次", got)
+	}
+}
+
+// TestPeriodicSyncNextSync 测试定时同步状态中计划的下一次同步时间
+func TestPeriodicSyncNextSync(t *testing.T) {
+	clock := newFakeClock()
+
+	ntp, err := New(Options{
+		Servers:      []string{"127.0.0.1:1"},
+		Timeout:      100 * time.Millisecond,
+		SyncInterval: time.Minute,
+		Clock:        clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if !ntp.GetPeriodicSyncStatus().NextSync.IsZero() {
+		t.Error("定时同步未启动时预期NextSync为零值")
+	}
+
+	start := clock.Now()
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+	if got := ntp.GetPeriodicSyncStatus().NextSync; !got.Equal(start) {
+		t.Errorf("预期初始同步计划在启动时执行，实际得到%v", got)
+	}
+
+	// 初始同步失败后按退避时间计划下一次同步
+	clock.waitForTimers(t, 1)
+	next := ntp.GetPeriodicSyncStatus().NextSync
+	if !clock.timerAt(next) {
+		t.Errorf("预期NextSync与定时器的到期时间%v一致", next)
+	}
+
+	ntp.StopPeriodicSync()
+	if !ntp.GetPeriodicSyncStatus().NextSync.IsZero() {
+		t.Error("定时同步停止后预期NextSync为零值")
+	}
+}
@@ -1,8 +1,11 @@
 package ntpsync
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
 )
 
 // TestCreateNTPPacket 测试NTP数据包的创建
@@ -68,7 +71,7 @@ func TestNTPTimeToTime(t *testing.T) {
 	fraction := uint32(0x80000000) // 0.5秒
 	
 	// 转换为time.Time
-	tm := ntpTimeToTime(seconds, fraction)
+	tm := ntpTimeToTime(seconds, fraction, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
 	
 	// 预期时间
 	expectedTime := time.Date(2020, 1, 1, 0, 0, 0, 500000000, time.UTC)
@@ -80,15 +83,17 @@ func TestNTPTimeToTime(t *testing.T) {
 }
 
 // TestSyncWithServerBinary 测试与服务器的二进制同步
-// 这是一个需要网络访问的集成测试
+// 使用本地测试服务器，不依赖外部网络
 func TestSyncWithServerBinary(t *testing.T) {
-	// 在短模式下跳过此测试
-	if testing.Short() {
-		t.Skip("在短模式下跳过服务器同步测试")
-	}
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	
+	srv.SetStratum(2)
+	srv.SetOffset(3 * time.Second)
+	srv.SetDelay(20 * time.Millisecond)
 	
 	ntp, err := New(Options{
-		Servers: []string{"pool.ntp.org"},
+		Servers: []string{srv.Addr()},
 		Timeout: 5 * time.Second,
 	})
 	
@@ -97,13 +102,9 @@ func TestSyncWithServerBinary(t *testing.T) {
 	}
 	
 	// 与服务器同步
-	result, err := ntp.syncWithServerBinary("pool.ntp.org", 5*time.Second)
-	
-	// 如果网络不可靠，此测试可能会失败
-	// 我们只检查函数是否按预期工作
+	result, err := ntp.syncWithServerBinary(srv.Addr(), 5*time.Second)
 	if err != nil {
-		t.Logf("同步失败: %v", err)
-		t.Skip("由于网络错误跳过")
+		t.Fatalf("同步失败: %v", err)
 	}
 	
 	// 检查结果
@@ -112,8 +113,8 @@ func TestSyncWithServerBinary(t *testing.T) {
 	}
 	
 	// 检查服务器是否已设置
-	if result.Server != "pool.ntp.org:123" {
-		t.Errorf("预期服务器为pool.ntp.org:123，实际得到 %s", result.Server)
+	if result.Server != srv.Addr() {
+		t.Errorf("预期服务器为%s，实际得到 %s", srv.Addr(), result.Server)
 	}
 	
 	// 检查时间是否已设置
@@ -121,21 +122,132 @@ func TestSyncWithServerBinary(t *testing.T) {
 		t.Error("预期时间已设置，实际得到零时间")
 	}
 	
-	// 检查偏移量是否合理
-	// 偏移量应在几秒钟之内
-	if result.Offset < -10*time.Second || result.Offset > 10*time.Second {
-		t.Errorf("预期偏移量合理，实际得到 %v", result.Offset)
+	// 检查偏移量是否与服务器配置一致
+	if diff := result.Offset - 3*time.Second; diff < -50*time.Millisecond || diff > 50*time.Millisecond {
+		t.Errorf("预期偏移量约为3秒，实际得到 %v", result.Offset)
+	}
+	
+	// 检查RTT是否包含模拟的延迟
+	if result.RTT < 20*time.Millisecond || result.RTT >= 5*time.Second {
+		t.Errorf("预期RTT不小于20毫秒，实际得到 %v", result.RTT)
+	}
+	
+	// 检查层级是否与服务器配置一致
+	if result.Stratum != 2 {
+		t.Errorf("预期层级为2，实际得到 %d", result.Stratum)
+	}
+	
+	// 检查服务器收到的请求
+	requests := srv.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("预期服务器收到1个请求，实际得到%d个", len(requests))
+	}
+	if NTPMode(requests[0].Mode) != Client {
+		t.Errorf("预期请求模式为客户端模式，实际得到%d", requests[0].Mode)
+	}
+}
+
+// TestSyncResultTimestamps 测试结果中的原始时间戳可以重新计算偏移量和往返时间
+func TestSyncResultTimestamps(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetOffset(3 * time.Second)
+	srv.SetDelay(10 * time.Millisecond)
+	
+	ntp, err := New(Options{Servers: []string{srv.Addr()}, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	
+	result, err := ntp.syncWithServerBinary(srv.Addr(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	
+	ts := result.Timestamps
+	if ts == nil {
+		t.Fatal("预期结果包含原始时间戳")
+	}
+	if got := ts.Offset(); got != result.Offset {
+		t.Errorf("由时间戳计算的偏移量%v与结果%v不一致", got, result.Offset)
+	}
+	if got := ts.Delay(); got != result.RTT {
+		t.Errorf("由时间戳计算的往返时间%v与结果%v不一致", got, result.RTT)
+	}
+	if !ts.Originate.Before(ts.Destination) || ts.Transmit.Before(ts.Receive) {
+		t.Errorf("时间戳顺序错误: %+v", ts)
 	}
 	
-	// 检查RTT是否合理
-	// RTT应为正值且小于超时时间
-	if result.RTT <= 0 || result.RTT >= 5*time.Second {
-		t.Errorf("预期RTT合理，实际得到 %v", result.RTT)
+	// 测试服务器的参考时间戳比接收时间早1秒
+	if diff := ts.Receive.Sub(ts.Reference) - time.Second; diff < -time.Microsecond || diff > time.Microsecond {
+		t.Errorf("预期参考时间戳比接收时间早1秒，实际相差%v", ts.Receive.Sub(ts.Reference))
 	}
 	
-	// 检查层级是否合理
-	// 层级应在1到15之间
-	if result.Stratum < 1 || result.Stratum > 15 {
-		t.Errorf("预期层级合理，实际得到 %d", result.Stratum)
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	var decoded SyncResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("反序列化失败: %v", err)
+	}
+	if decoded.Timestamps == nil || !decoded.Timestamps.Transmit.Equal(ts.Transmit) || !decoded.Timestamps.Reference.Equal(ts.Reference) {
+		t.Errorf("时间戳序列化前后不一致: %s", data)
+	}
+}
+
+// TestSyncWithServerBinaryKoD 测试收到Kiss-o'-Death应答时同步失败
+func TestSyncWithServerBinaryKoD(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	
+	srv.SetKissCode("DENY")
+	
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	
+	if _, err := ntp.syncWithServerBinary(srv.Addr(), 5*time.Second); err == nil {
+		t.Error("预期收到KoD应答时返回错误，实际得到nil")
+	}
+}
+
+// TestNTPEra 测试跨越2036年纪元边界的时间戳转换
+func TestNTPEra(t *testing.T) {
+	boundary := time.Date(2036, 2, 7, 6, 28, 16, 0, time.UTC)
+	if era := NTPEra(boundary.Add(-time.Second)); era != 0 {
+		t.Errorf("预期纪元边界之前为纪元0，实际得到%d", era)
+	}
+	if era := NTPEra(boundary); era != 1 {
+		t.Errorf("预期纪元边界为纪元1，实际得到%d", era)
+	}
+	if era := NTPEra(time.Date(1899, 12, 31, 0, 0, 0, 0, time.UTC)); era != -1 {
+		t.Errorf("预期1900年之前为纪元-1，实际得到%d", era)
+	}
+	
+	tests := []struct {
+		name string
+		t    time.Time
+		ref  time.Time
+	}{
+		{"纪元0", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC)},
+		{"纪元1", time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"本地时间在边界之前", boundary.Add(time.Second), boundary.Add(-time.Second)},
+		{"本地时间在边界之后", boundary.Add(-time.Second), boundary.Add(time.Second)},
+		{"本地时钟未设置", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		ts, era := NTPTimestamp(tt.t)
+		if era != NTPEra(tt.t) {
+			t.Errorf("%s: 预期纪元%d，实际得到%d", tt.name, NTPEra(tt.t), era)
+		}
+		if got := NTPTimestampTime(ts, tt.ref); !got.Equal(tt.t) {
+			t.Errorf("%s: 预期%v，实际得到%v", tt.name, tt.t, got)
+		}
 	}
 }
@@ -0,0 +1,33 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// socketOptionsSupported 表示当前平台是否支持绑定网卡和设置DSCP
+const socketOptionsSupported = true
+
+// bindToDevice 使用SO_BINDTODEVICE将套接字绑定到网卡
+func bindToDevice(fd uintptr, iface string) error {
+	if err := syscall.BindToDevice(int(fd), iface); err != nil {
+		return fmt.Errorf("绑定网卡 %s 失败: %v", iface, err)
+	}
+	return nil
+}
+
+// setDSCP 设置套接字发出数据包的DSCP，即TOS或流量类别字段的高6位
+// IPv6套接字可能同时发送IPv4映射地址的数据包，因此两个字段都设置
+func setDSCP(fd uintptr, network string, dscp int) error {
+	if network == "udp6" {
+		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, dscp<<2); err != nil {
+			return fmt.Errorf("设置DSCP失败: %v", err)
+		}
+	}
+	if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, dscp<<2); err != nil && network != "udp6" {
+		return fmt.Errorf("设置DSCP失败: %v", err)
+	}
+	return nil
+}
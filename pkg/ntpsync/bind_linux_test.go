@@ -0,0 +1,39 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// TestDSCP 测试连接的套接字设置了DSCP
+func TestDSCP(t *testing.T) {
+	cfg, err := newSocketConfig("", "lo", DSCPExpeditedForwarding)
+	if err != nil {
+		t.Fatalf("创建套接字设置失败: %v", err)
+	}
+
+	conn, err := cfg.dialer().DialContext(context.Background(), "udp", "127.0.0.1:123")
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.(*net.UDPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("获取套接字失败: %v", err)
+	}
+	var tos int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		tos, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS)
+	}); err != nil || sockErr != nil {
+		t.Fatalf("读取IP_TOS失败: %v %v", err, sockErr)
+	}
+	if tos != DSCPExpeditedForwarding<<2 {
+		t.Errorf("预期TOS为%#x，实际得到%#x", DSCPExpeditedForwarding<<2, tos)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package ntpsync
+
+// socketOptionsSupported 表示当前平台是否支持绑定网卡和设置DSCP
+const socketOptionsSupported = false
+
+// bindToDevice 在不支持绑定网卡的平台上总是返回errSocketOptionsUnsupported
+func bindToDevice(fd uintptr, iface string) error {
+	return errSocketOptionsUnsupported
+}
+
+// setDSCP 在不支持设置DSCP的平台上总是返回errSocketOptionsUnsupported
+func setDSCP(fd uintptr, network string, dscp int) error {
+	return errSocketOptionsUnsupported
+}
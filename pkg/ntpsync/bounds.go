@@ -0,0 +1,73 @@
+package ntpsync
+
+import (
+	"math"
+	"time"
+)
+
+// UnboundedError 是从未同步时NowWithBounds返回的误差上限
+const UnboundedError = time.Duration(math.MaxInt64)
+
+// NowWithBounds 返回Now和它的误差上限maxError，真实时间在[t-maxError, t+maxError]之内
+//
+// 误差上限由以下几部分相加得到：
+//   - 最后一次同步的根距离（其它时间源为其保证的误差）
+//   - 此后本地时钟的离散度增长，按15ppm累积
+//   - 频率偏差的误差：尚未估计出频率偏差时按500ppm累积；估计出之后为
+//     进入保持模式前没有按频率偏差调整的部分，加上估计值的标准误差累积的部分
+//   - 尚未完成的逐渐调整量
+//
+// 用于检查证书有效期、令牌过期时间等需要考虑最坏情况的场合。
+// 从未同步时返回本地时间和UnboundedError
+func (n *NTPSync) NowWithBounds() (time.Time, time.Duration) {
+	if n.syncOnFirstUse && n.snapshot.Load() == nil {
+		n.syncOnFirstCall()
+	}
+	local := n.clock.Now()
+
+	n.mutex.RLock()
+	if n.lastSync.IsZero() {
+		n.mutex.RUnlock()
+		return local, UnboundedError
+	}
+	maxError := n.maxErrorLocked(local)
+	if s := n.snapshot.Load(); s != nil {
+		n.mutex.RUnlock()
+		return s.now(local), maxError
+	}
+	offset := n.timeOffset
+	_, correction := n.holdoverLocked(local)
+	n.mutex.RUnlock()
+
+	return n.monotonic.now(local, offset).Add(correction), maxError
+}
+
+// maxErrorLocked 返回本地时间为local时Now的误差上限，从未同步时返回0
+// 调用者必须持有n.mutex的读锁或写锁
+func (n *NTPSync) maxErrorLocked(local time.Time) time.Duration {
+	if n.lastSync.IsZero() {
+		return 0
+	}
+
+	age := local.Sub(n.lastSync) + n.suspendedSinceSync
+	if age < 0 {
+		age = 0
+	}
+
+	bound := float64(n.syncErrorBound) + float64(n.monotonic.pending(local))
+	freq, stderr, ok := n.drift.fit()
+	if !ok {
+		bound += float64(age) * maxDrift
+	} else {
+		uncorrected := age
+		if after := n.holdoverAfterLocked(); uncorrected > after {
+			uncorrected = after
+		}
+		bound += float64(age)*(frequencyTolerance+stderr) + float64(uncorrected)*math.Abs(freq)
+	}
+
+	if bound >= float64(UnboundedError) {
+		return UnboundedError
+	}
+	return time.Duration(bound)
+}
@@ -0,0 +1,73 @@
+package ntpsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestNowWithBounds 测试误差上限由同步误差、频率偏差和尚未完成的逐渐调整组成
+func TestNowWithBounds(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		StepThreshold:    100 * time.Millisecond,
+		OutlierThreshold: -1,
+		Clock:            clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if now, maxError := ntp.NowWithBounds(); maxError != UnboundedError || !now.Equal(clock.Now()) {
+		t.Errorf("预期从未同步时返回本地时间和UnboundedError，实际得到%v和%v", now, maxError)
+	}
+
+	src := &fakeSource{offset: time.Second, uncertainty: 2 * time.Millisecond}
+	if err := ntp.SyncWithSource(context.Background(), src); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	now, maxError := ntp.NowWithBounds()
+	if maxError != 2*time.Millisecond || !now.Equal(clock.Now().Add(time.Second)) {
+		t.Errorf("预期同步后误差上限为同步的误差，实际得到%v和%v", now, maxError)
+	}
+
+	// 尚未估计出频率偏差时按500ppm累积
+	clock.Advance(10 * time.Second)
+	if _, maxError := ntp.NowWithBounds(); maxError != 2*time.Millisecond+5*time.Millisecond {
+		t.Errorf("预期误差上限为7ms，实际得到%v", maxError)
+	}
+
+	// 逐渐调整的偏移量在完成之前计入误差上限
+	src.offset = time.Second + 50*time.Millisecond
+	if err := ntp.SyncWithSource(context.Background(), src); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if _, maxError := ntp.NowWithBounds(); maxError != 52*time.Millisecond {
+		t.Errorf("预期误差上限包括尚未完成的50ms调整，实际得到%v", maxError)
+	}
+	if status := ntp.GetHoldoverStatus(); status.MaxError != 52*time.Millisecond {
+		t.Errorf("预期GetHoldoverStatus的误差上限与NowWithBounds相同，实际得到%v", status.MaxError)
+	}
+}
+
+// TestDriftEstimatorUncertainty 测试频率偏差估计值的标准误差反映测量噪声
+func TestDriftEstimatorUncertainty(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var exact, noisy driftEstimator
+	noise := []time.Duration{0, 500 * time.Microsecond, -500 * time.Microsecond}
+	for i := 0; i < DriftWindow; i++ {
+		local := start.Add(time.Duration(i) * time.Minute)
+		exact.add(local, time.Duration(i)*600*time.Microsecond)
+		noisy.add(local, time.Duration(i)*600*time.Microsecond+noise[i%3])
+	}
+
+	if _, stderr, ok := exact.fit(); !ok || stderr > 1e-9 {
+		t.Errorf("预期没有噪声时标准误差接近0，实际得到%v (%v)", stderr, ok)
+	}
+	if _, stderr, ok := noisy.fit(); !ok || stderr < 0.5e-6 {
+		t.Errorf("预期有噪声时标准误差大于0.5ppm，实际得到%v (%v)", stderr, ok)
+	}
+}
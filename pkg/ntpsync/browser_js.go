@@ -0,0 +1,13 @@
+//go:build js && wasm
+
+package ntpsync
+
+import "syscall/js"
+
+// udpAvailable 表示能否发送UDP数据包，浏览器中只能使用HTTP(S)
+const udpAvailable = false
+
+// defaultHTTPSourceURL 返回页面所在网站的地址，例如"https://dashboard.example.com/"
+func defaultHTTPSourceURL() string {
+	return js.Global().Get("location").Get("origin").String() + "/"
+}
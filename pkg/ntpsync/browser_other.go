@@ -0,0 +1,11 @@
+//go:build !js
+
+package ntpsync
+
+// udpAvailable 表示能否发送UDP数据包
+const udpAvailable = true
+
+// defaultHTTPSourceURL 只在浏览器中使用
+func defaultHTTPSourceURL() string {
+	return ""
+}
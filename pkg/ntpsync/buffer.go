@@ -0,0 +1,25 @@
+package ntpsync
+
+import "sync"
+
+// packetBuffer 是可以容纳任何接收的NTP数据包的缓冲区
+type packetBuffer [maxPacketSize]byte
+
+// packetPool 复用请求和应答的缓冲区，避免每次查询分配内存
+var packetPool = sync.Pool{
+	New: func() any { return new(packetBuffer) },
+}
+
+// getPacket 从缓冲池取出长度为size的缓冲区，内容未清零
+func getPacket(size int) []byte {
+	return packetPool.Get().(*packetBuffer)[:size]
+}
+
+// putPacket 将getPacket取出的缓冲区放回缓冲池，之后不能再使用b
+// 追加扩展字段时重新分配的缓冲区不是缓冲池的，直接忽略
+func putPacket(b []byte) {
+	if cap(b) != maxPacketSize {
+		return
+	}
+	packetPool.Put((*packetBuffer)(b[:maxPacketSize]))
+}
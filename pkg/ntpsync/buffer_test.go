@@ -0,0 +1,103 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// testPacket 返回编解码测试使用的服务器应答
+func testPacket() NTPPacket {
+	return NTPPacket{
+		Settings:    0x24,
+		Stratum:     2,
+		Poll:        6,
+		Precision:   -20,
+		ReferenceID: 0x7f000001,
+		RxTimeSec:   3913056000,
+		TxTimeSec:   3913056000,
+		TxTimeFrac:  0x80000000,
+	}
+}
+
+// TestPacketCodecAllocs 测试数据包编解码和匹配应答的起始时间戳不分配内存
+func TestPacketCodecAllocs(t *testing.T) {
+	packet := testPacket()
+	buf := make([]byte, 0, packetSize)
+	data, err := packet.AppendBinary(buf)
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"AppendBinary", func() { _, _ = packet.AppendBinary(buf) }},
+		{"UnmarshalBinary", func() { _ = packet.UnmarshalBinary(data) }},
+		{"appendOrigins", func() {
+			var origins [3]uint64
+			_ = appendOrigins(origins[:0], data)
+		}},
+	}
+	for _, tt := range tests {
+		if allocs := testing.AllocsPerRun(100, tt.fn); allocs != 0 {
+			t.Errorf("%s: 预期不分配内存，实际每次分配%v次", tt.name, allocs)
+		}
+	}
+}
+
+// BenchmarkQuery 测量通过共用套接字查询一次服务器的耗时和分配，包括测试服务器的分配
+func BenchmarkQuery(b *testing.B) {
+	server := ntptest.NewServer()
+	defer server.Close()
+	addr := server.Addr()
+
+	ntp, err := New(Options{
+		Servers:         []string{addr},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+	})
+	if err != nil {
+		b.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ntp.syncWithServerBinary(addr, time.Second); err != nil {
+			b.Fatalf("查询失败: %v", err)
+		}
+	}
+}
+
+// BenchmarkNTPPacketAppendBinary 测量将数据包编码到复用的缓冲区
+func BenchmarkNTPPacketAppendBinary(b *testing.B) {
+	packet := testPacket()
+	buf := make([]byte, 0, packetSize)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := packet.AppendBinary(buf); err != nil {
+			b.Fatalf("编码失败: %v", err)
+		}
+	}
+}
+
+// BenchmarkNTPPacketUnmarshalBinary 测量解析不含扩展字段的数据包
+func BenchmarkNTPPacketUnmarshalBinary(b *testing.B) {
+	packet := testPacket()
+	data, err := packet.MarshalBinary()
+	if err != nil {
+		b.Fatalf("编码失败: %v", err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := packet.UnmarshalBinary(data); err != nil {
+			b.Fatalf("解析失败: %v", err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package ntpsync
+
+import (
+	"time"
+)
+
+// Clock 抽象本地时间来源和定时器
+// 通过Options.Clock注入，测试中可以使用假时钟代替真实的等待
+type Clock interface {
+	// Now 返回当前的本地时间
+	Now() time.Time
+
+	// NewTimer 创建一个在d之后触发的定时器
+	NewTimer(d time.Duration) Timer
+
+	// Sleep 阻塞d的时长
+	Sleep(d time.Duration)
+}
+
+// Timer 是Clock创建的定时器，语义与time.Timer相同
+type Timer interface {
+	// C 返回定时器触发时接收时间的通道
+	C() <-chan time.Time
+
+	// Stop 停止定时器，如果定时器已经触发或已停止则返回false
+	Stop() bool
+
+	// Reset 将定时器重置为在d之后触发
+	Reset(d time.Duration) bool
+}
+
+// SystemClock 是使用系统时间的Clock实现
+type SystemClock struct{}
+
+// Now 返回time.Now()
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer 创建一个time.Timer
+func (SystemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+// Sleep 调用time.Sleep
+func (SystemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// read 读取time.Now和启动时钟
+func (SystemClock) read() clockReading {
+	now := time.Now()
+	boot, ok := bootTime()
+	return clockReading{local: now, wall: now.Round(0), boot: boot, hasBoot: ok}
+}
+
+// clockReading 是同一时刻读取的本地时间、系统时间和启动时钟，用于区分休眠和系统时钟被调整
+type clockReading struct {
+	// local 是Clock.Now返回的本地时间，两次读数的local之差是单调时钟经过的时长
+	local time.Time
+
+	// wall 是系统时间，不包含单调时钟读数
+	wall time.Time
+
+	// boot 是系统启动以来经过的时长，包括休眠的时长，hasBoot为false时不可用
+	boot    time.Duration
+	hasBoot bool
+}
+
+// clockReader 是可以同时读取系统时间和启动时钟的Clock
+type clockReader interface {
+	read() clockReading
+}
+
+// readClock 读取c的本地时间、系统时间和启动时钟，c没有实现clockReader时启动时钟不可用
+func readClock(c Clock) clockReading {
+	if r, ok := c.(clockReader); ok {
+		return r.read()
+	}
+	now := c.Now()
+	return clockReading{local: now, wall: now.Round(0)}
+}
+
+// clockChanges 返回从prev到next期间的休眠时长和系统时钟被直接调整的量。
+// 单调时钟在休眠期间停止，启动时钟继续计时，两者之差是休眠的时长，系统时间与启动时钟之差是调整量，
+// 因此向前或向后、大或小的调整都不会被当作休眠。启动时钟不可用时无法区分两者，
+// 只能把系统时间比单调时钟多走SuspendThreshold以上的情况当作休眠，其余当作调整。
+// 本地时间不包含单调时钟读数时两者都为0
+func clockChanges(prev, next clockReading) (suspended, stepped time.Duration) {
+	if prev.local.IsZero() {
+		return 0, 0
+	}
+	elapsed := next.local.Sub(prev.local)
+	gap := next.wall.Sub(prev.wall) - elapsed
+	if !prev.hasBoot || !next.hasBoot {
+		if gap > SuspendThreshold {
+			return gap, 0
+		}
+		return 0, gap
+	}
+	suspended = next.boot - prev.boot - elapsed
+	return suspended, gap - suspended
+}
+
+// systemTimer 包装time.Timer以实现Timer接口
+type systemTimer struct {
+	*time.Timer
+}
+
+// C 返回定时器的通道
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// stopTimer 停止定时器，如果定时器已经触发则排空其通道
+func stopTimer(timer Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C():
+		default:
+		}
+	}
+}
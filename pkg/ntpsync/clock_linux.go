@@ -0,0 +1,21 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// clockBoottime 是Linux的CLOCK_BOOTTIME，与CLOCK_MONOTONIC相同但计入休眠的时长
+const clockBoottime = 7
+
+// bootTime 返回CLOCK_BOOTTIME的读数
+func bootTime() (time.Duration, bool) {
+	var ts syscall.Timespec
+	if _, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockBoottime, uintptr(unsafe.Pointer(&ts)), 0); errno != 0 {
+		return 0, false
+	}
+	return time.Duration(ts.Nano()), true
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package ntpsync
+
+import "time"
+
+// bootTime 在没有计入休眠的单调时钟的平台上不可用
+func bootTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,187 @@
+package ntpsync
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 是用于测试的假时钟，只有调用Advance时时间才会前进
+// Now返回单调时钟的时间线；Step和Suspend只改变read报告的系统时间和启动时钟，
+// 模拟系统时钟被调整和休眠
+type fakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	wall   time.Duration // 系统时间与now之差
+	boot   time.Duration // 启动时钟的读数
+	noBoot bool          // 模拟没有启动时钟的平台
+	timers []*fakeTimer
+}
+
+// newFakeClock 创建一个从固定时间开始的假时钟
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Now 返回假时钟的当前时间
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// NewTimer 创建一个在假时钟前进d之后触发的定时器
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1), deadline: c.now.Add(d), active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Sleep 阻塞直到假时钟前进d
+func (c *fakeClock) Sleep(d time.Duration) {
+	<-c.NewTimer(d).C()
+}
+
+// Advance 让假时钟前进d，并触发所有到期的定时器
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+	c.boot += d
+
+	remaining := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.active {
+			continue
+		}
+		if !t.deadline.After(c.now) {
+			t.active = false
+			t.ch <- c.now
+			continue
+		}
+		remaining = append(remaining, t)
+	}
+	c.timers = remaining
+}
+
+// read 返回单调时钟、系统时间和启动时钟的读数
+func (c *fakeClock) read() clockReading {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return clockReading{local: c.now, wall: c.now.Add(c.wall), boot: c.boot, hasBoot: !c.noBoot}
+}
+
+// Wall 返回当前的系统时间
+func (c *fakeClock) Wall() time.Time {
+	return c.read().wall
+}
+
+// Step 把系统时间调整d，单调时钟和启动时钟不变
+func (c *fakeClock) Step(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.wall += d
+}
+
+// Suspend 模拟休眠d：系统时间和启动时钟前进d，单调时钟停止，定时器不触发
+func (c *fakeClock) Suspend(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.wall += d
+	c.boot += d
+}
+
+// activeTimers 返回尚未触发的定时器数量
+func (c *fakeClock) activeTimers() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	count := 0
+	for _, t := range c.timers {
+		if t.active {
+			count++
+		}
+	}
+	return count
+}
+
+// waitForTimers 等待直到至少有n个未触发的定时器
+func (c *fakeClock) waitForTimers(t testing.TB, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.activeTimers() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%d个定时器超时", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fakeTimer 是fakeClock创建的定时器
+type fakeTimer struct {
+	clock    *fakeClock
+	ch       chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+// C 返回定时器的通道
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+// Stop 停止定时器
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+// Reset 重置定时器
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	wasActive := t.active
+	t.deadline = t.clock.now.Add(d)
+	if !wasActive {
+		t.active = true
+		t.clock.timers = append(t.clock.timers, t)
+	}
+	return wasActive
+}
+
+// TestClockInjection 测试注入的时钟被用于计算时间
+func TestClockInjection(t *testing.T) {
+	clock := newFakeClock()
+
+	ntp, err := New(Options{
+		Servers: []string{"pool.ntp.org"},
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	ntp.timeOffset = time.Second
+	if got, want := ntp.Now(), clock.Now().Add(time.Second); !got.Equal(want) {
+		t.Errorf("预期时间为%v，实际得到%v", want, got)
+	}
+
+	clock.Advance(time.Minute)
+	if got, want := ntp.Now(), clock.Now().Add(time.Second); !got.Equal(want) {
+		t.Errorf("预期时间为%v，实际得到%v", want, got)
+	}
+}
@@ -0,0 +1,90 @@
+package ntpsync
+
+import (
+	"time"
+)
+
+// ClockStepThreshold 是判定系统时钟被外部直接调整的时长
+// 系统时间比单调时钟多走或少走的时长超过该值时，认为其它程序（如另一个NTP客户端、
+// date命令或虚拟机管理程序）直接调整了系统时钟；逐渐调整同时作用于两者，不会被误判
+const ClockStepThreshold = 100 * time.Millisecond
+
+// shift 把窗口内的所有样本加上d
+func (w *offsetWindow) shift(d time.Duration) {
+	for i := range w.samples {
+		w.samples[i] += d
+	}
+}
+
+// shift 把所有样本的偏移量加上d
+func (d *driftEstimator) shift(offset time.Duration) {
+	for i := range d.samples {
+		d.samples[i].offset += offset
+	}
+}
+
+// step 处理系统时间被直接调整d：锚定的系统时间加上d，有效偏移量和目标偏移量减去d，
+// 返回的时间保持不变，正在进行的逐渐调整继续进行
+func (m *monotonicNow) step(d time.Duration) {
+	m.update(func(old *monotonicAnchor) *monotonicAnchor {
+		if old == nil {
+			return nil
+		}
+		return newAnchor(old.local, old.base.Add(d), old.start-d, old.target-d, old.last.Load())
+	})
+}
+
+// absorbStepLocked 按系统时钟被外部调整的量step修正偏移量和已有的样本，调用者必须持有n.mutex
+// 偏移量是NTP时间与系统时间之差，系统时间向前调整step后，同一时刻的偏移量减少step；
+// 修正后Now保持不变，之后测得的偏移量也不会被判定为异常值
+func (n *NTPSync) absorbStepLocked(now clockReading, step time.Duration) {
+	n.clockCheck = now
+	if n.lastSync.IsZero() {
+		return
+	}
+
+	n.timeOffset -= step
+	n.systemOffsets.shift(-step)
+	for _, w := range n.serverOffsets {
+		w.shift(-step)
+	}
+	for _, s := range n.sourceSamples {
+		s.shift(-step)
+	}
+	n.drift.shift(-step)
+	n.resetEstimatorLocked()
+	n.monotonic.step(step)
+	n.publishLocked()
+}
+
+// clockStepped 处理系统时钟被外部调整step：修正偏移量，发布EventClockStepped事件并立即重新同步
+func (n *NTPSync) clockStepped(now clockReading, step time.Duration) {
+	n.mutex.Lock()
+	n.absorbStepLocked(now, step)
+	n.mutex.Unlock()
+
+	n.emit(Event{Type: EventClockStepped, Offset: step})
+	n.resync()
+}
+
+// detectStepLocked 在应用新的偏移量offset之前检查系统时钟是否被外部调整，调用者必须持有n.mutex
+// 发现调整时按调整量修正已有的偏移量和样本，返回调整量
+func (n *NTPSync) detectStepLocked(now clockReading, offset time.Duration) (time.Duration, bool) {
+	if n.lastSync.IsZero() {
+		return 0, false
+	}
+
+	_, step := clockChanges(n.clockCheck, now)
+	if !isExternalStep(step, n.timeOffset, offset) {
+		return 0, false
+	}
+	n.absorbStepLocked(now, step)
+	return step, true
+}
+
+// isExternalStep 判断偏移量从previous变为offset是否来自系统时钟被外部调整step
+// 调整量超过ClockStepThreshold，且偏移量恰好变化了相反的量时，认为偏移量的变化
+// 来自外部调整而不是时间源
+func isExternalStep(step, previous, offset time.Duration) bool {
+	return absDuration(step) > ClockStepThreshold && absDuration(offset-previous+step) <= ClockStepThreshold/2
+}
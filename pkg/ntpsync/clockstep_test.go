@@ -0,0 +1,150 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestIsExternalStep 测试只有偏移量恰好变化了相反的量时才认为系统时钟被外部调整
+func TestIsExternalStep(t *testing.T) {
+	tests := []struct {
+		name                   string
+		step, previous, offset time.Duration
+		want                   bool
+	}{
+		{"向前调整", 300 * time.Millisecond, 300 * time.Millisecond, 2 * time.Millisecond, true},
+		{"向后调整", -2 * time.Second, 0, 2 * time.Second, true},
+		{"调整量太小", 50 * time.Millisecond, 50 * time.Millisecond, 0, false},
+		{"偏移量没有变化", 3 * time.Hour, 0, time.Millisecond, false},
+		{"偏移量变化不一致", time.Second, 0, -400 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		if got := isExternalStep(tt.step, tt.previous, tt.offset); got != tt.want {
+			t.Errorf("%s: 预期%v，实际得到%v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestClockStepped 测试系统时钟被外部调整后修正偏移量、保持Now不变并立即重新同步
+func TestClockStepped(t *testing.T) {
+	clock := newFakeClock()
+
+	server := ntptest.NewServer()
+	defer server.Close()
+	server.SetNow(clock.Now)
+	server.SetOffset(300 * time.Millisecond)
+
+	ntp, err := New(Options{
+		Servers:         []string{server.Addr()},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	events, cancel := ntp.Subscribe(0)
+	defer cancel()
+
+	// 其它程序把系统时钟向前调整了300毫秒；假时钟不会真的改变，因此丢弃重新测量的请求
+	before := ntp.Now()
+	server.SetDrop(true)
+	ntp.clockStepped(clock.read(), 300*time.Millisecond)
+
+	if got := ntp.TimeOffsetDuration(); got.Abs() > 10*time.Millisecond {
+		t.Errorf("预期偏移量减去调整量，实际得到%v", got)
+	}
+	if got := ntp.Now().Sub(before); got < 0 || got > time.Millisecond {
+		t.Errorf("预期Now保持不变，实际变化了%v", got)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != EventClockStepped || event.Offset != 300*time.Millisecond {
+			t.Errorf("预期发布时钟调整事件，实际得到%+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待时钟调整事件超时")
+	}
+
+	// 立即重新测量
+	waitForRequests(t, server, 2)
+}
+
+// TestWatchClock 测试定期检查时分别识别休眠和向前、向后、大小不同的系统时钟调整
+func TestWatchClock(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		PreferredSources: []Source{&fakeSource{offset: 2 * time.Second}},
+		MinPollInterval:  -1,
+		OutlierThreshold: -1,
+		DetectSuspend:    true,
+		DetectClockStep:  true,
+		Clock:            clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	events, cancel := ntp.Subscribe(16)
+	defer cancel()
+
+	// next 让检查的定时器触发，返回识别出的休眠或调整事件。同步时也会创建定时器，无法确定
+	// 检查的定时器已经创建，因此反复前进直到收到事件。假时间源测不到系统时钟的调整，
+	// 等随后的重新同步完成再进行下一次调整，以免同步把调整之后的时钟读数当作基准
+	next := func() Event {
+		t.Helper()
+		var found Event
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case <-time.After(time.Millisecond):
+				clock.Advance(SuspendCheckInterval)
+			case ev := <-events:
+				switch ev.Type {
+				case EventResumed, EventClockStepped:
+					found = ev
+				case EventSyncSucceeded:
+					if found.Type != "" {
+						return found
+					}
+				}
+			case <-timeout:
+				t.Fatal("等待检查结果超时")
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		change  func()
+		want    EventType
+		offset  time.Duration
+		suspend time.Duration
+	}{
+		{"向后调整", func() { clock.Step(-2 * time.Second) }, EventClockStepped, -2 * time.Second, 0},
+		{"向前小幅调整", func() { clock.Step(time.Second) }, EventClockStepped, time.Second, 0},
+		{"向前大幅调整", func() { clock.Step(time.Hour) }, EventClockStepped, time.Hour, 0},
+		{"休眠", func() { clock.Suspend(3 * time.Hour) }, EventResumed, 0, 3 * time.Hour},
+	}
+	for _, tt := range tests {
+		tt.change()
+		if ev := next(); ev.Type != tt.want || ev.Offset != tt.offset || ev.Suspended != tt.suspend {
+			t.Errorf("%s: 预期%s事件，实际得到%+v", tt.name, tt.want, ev)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed 表示实例已经关闭
+var ErrClosed = errors.New("NTP同步客户端已关闭")
+
+// Close 关闭实例并释放所有资源，等待所有后台goroutine退出
+// 关闭后同步相关的方法都会返回ErrClosed
+func (n *NTPSync) Close() error {
+	return n.Shutdown(context.Background())
+}
+
+// Shutdown 关闭实例：停止定时同步，取消进行中的请求，
+// 并等待后台goroutine退出，直到ctx到期，然后把状态保存到Options.Store
+// ctx到期时返回ctx.Err()，此时后台goroutine会在请求被取消后自行退出
+func (n *NTPSync) Shutdown(ctx context.Context) error {
+	n.mutex.Lock()
+	if n.closed {
+		n.mutex.Unlock()
+		return ErrClosed
+	}
+	n.closed = true
+
+	// 停止定时同步
+	select {
+	case <-n.stopChan:
+	default:
+		close(n.stopChan)
+	}
+	n.autoSync = false
+	n.mutex.Unlock()
+
+	if n.scheduler != nil {
+		n.scheduler.remove(n)
+	}
+
+	// 中断进行中的请求
+	if n.cancel != nil {
+		n.cancel()
+	}
+	n.closeSocket()
+	if n.restoreHardwareTimestamps != nil {
+		n.restoreHardwareTimestamps()
+	}
+	if n.statsLog != nil {
+		n.statsLog.close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		n.syncWaitGroup.Wait()
+		n.asyncWaitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return n.SaveState()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isClosed 返回实例是否已关闭
+func (n *NTPSync) isClosed() bool {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	return n.closed
+}
+
+// context 返回在实例关闭时被取消的上下文
+func (n *NTPSync) context() context.Context {
+	if n.ctx == nil {
+		return context.Background()
+	}
+	return n.ctx
+}
+
+// goAsync 在后台goroutine中执行fn，并在Shutdown时等待其退出
+// 实例已关闭时不会执行fn
+func (n *NTPSync) goAsync(fn func()) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.goAsyncLocked(fn)
+}
+
+// goAsyncLocked 与goAsync相同，调用者必须持有n.mutex
+func (n *NTPSync) goAsyncLocked(fn func()) {
+	if n.closed {
+		return
+	}
+	n.asyncWaitGroup.Add(1)
+
+	go func() {
+		defer n.asyncWaitGroup.Done()
+		fn()
+	}()
+}
@@ -0,0 +1,108 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestClose 测试关闭后的行为
+func TestClose(t *testing.T) {
+	ntp, err := New(Options{
+		Servers:  []string{"127.0.0.1:1"},
+		Timeout:  100 * time.Millisecond,
+		AutoSync: true,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	if err := ntp.Close(); err != nil {
+		t.Fatalf("关闭实例失败: %v", err)
+	}
+
+	if ntp.IsPeriodicSyncRunning() {
+		t.Error("预期关闭后定时同步已停止，实际得到true")
+	}
+
+	if err := ntp.Sync(); !errors.Is(err, ErrClosed) {
+		t.Errorf("预期Sync返回ErrClosed，实际得到%v", err)
+	}
+
+	if err := ntp.ForceSyncNow(); !errors.Is(err, ErrClosed) {
+		t.Errorf("预期ForceSyncNow返回ErrClosed，实际得到%v", err)
+	}
+
+	if err := ntp.StartPeriodicSync(); !errors.Is(err, ErrClosed) {
+		t.Errorf("预期StartPeriodicSync返回ErrClosed，实际得到%v", err)
+	}
+
+	if _, err := ntp.GetMultiServerStatus(); !errors.Is(err, ErrClosed) {
+		t.Errorf("预期GetMultiServerStatus返回ErrClosed，实际得到%v", err)
+	}
+
+	if err := ntp.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("预期重复关闭返回ErrClosed，实际得到%v", err)
+	}
+}
+
+// TestShutdownCancelsInFlight 测试关闭时中断进行中的请求
+func TestShutdownCancelsInFlight(t *testing.T) {
+	// 只接收不响应的服务器
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听UDP端口失败: %v", err)
+	}
+	defer conn.Close()
+
+	ntp, err := New(Options{
+		Servers: []string{conn.LocalAddr().String()},
+		Timeout: 30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	received := make(chan struct{})
+	go func() {
+		buf := make([]byte, 128)
+		if _, _, err := conn.ReadFrom(buf); err == nil {
+			close(received)
+		}
+	}()
+
+	result := make(chan error, 1)
+	ntp.SyncAsync()
+	go func() {
+		result <- ntp.Sync()
+	}()
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待请求超时")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := ntp.Shutdown(ctx); err != nil {
+		t.Fatalf("关闭实例失败: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("预期进行中的请求被立即中断，实际等待了%v", elapsed)
+	}
+
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("预期被中断的同步返回错误，实际得到nil")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("被中断的同步没有返回")
+	}
+}
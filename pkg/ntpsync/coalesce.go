@@ -0,0 +1,55 @@
+package ntpsync
+
+import "errors"
+
+// errSyncAborted 是同步中途panic时等待的调用者得到的错误
+var errSyncAborted = errors.New("同步被中断")
+
+// syncFlight 是一次正在进行的同步，同时发起的调用等待它完成并共享结果
+type syncFlight struct {
+	done chan struct{}
+	err  error
+
+	// record 表示是否有调用者需要把结果计入同步统计，参见recordSyncResult
+	record bool
+}
+
+// coalesce 执行一次同步，已经有同步正在进行时等待它完成并返回它的结果，
+// 使并发的调用只进行一次网络交换，也不会竞争写入偏移量。
+// record为true时把结果计入同步统计，一次同步无论有多少调用者都只计入一次
+func (n *NTPSync) coalesce(record bool) error {
+	n.mutex.Lock()
+	if f := n.flight; f != nil {
+		f.record = f.record || record
+		n.mutex.Unlock()
+		<-f.done
+		return syncError(f.err)
+	}
+	f := &syncFlight{done: make(chan struct{}), err: errSyncAborted, record: record}
+	n.flight = f
+	n.mutex.Unlock()
+
+	// 同步中途panic时也要释放等待的调用者
+	defer func() {
+		n.mutex.Lock()
+		n.flight = nil
+		record = f.record
+		n.mutex.Unlock()
+
+		if record {
+			n.recordSyncResult(f.err)
+		}
+		close(f.done)
+	}()
+
+	f.err = n.syncOnce()
+	return syncError(f.err)
+}
+
+// syncError 把syncOnce的结果转换为返回给调用者的错误，回退到本地时钟不是错误
+func syncError(err error) error {
+	if errors.Is(err, errLocalClockSync) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package ntpsync
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingSource 是在release关闭之前阻塞的时间源，记录被测量的次数
+type blockingSource struct {
+	entered chan struct{}
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (s *blockingSource) Name() string { return "blocking" }
+
+func (s *blockingSource) Measure(ctx context.Context) (*SyncResult, error) {
+	if s.calls.Add(1) == 1 {
+		close(s.entered)
+	}
+	<-s.release
+	return &SyncResult{Offset: time.Second}, nil
+}
+
+// TestSyncCoalescing 测试并发的Sync和ForceSyncNow只进行一次测量并共享结果
+func TestSyncCoalescing(t *testing.T) {
+	src := &blockingSource{entered: make(chan struct{}), release: make(chan struct{})}
+	ntp, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		PreferredSources: []Source{src},
+		Clock:            newFakeClock(),
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	errs := make(chan error, 10)
+	go func() { errs <- ntp.Sync() }()
+	<-src.entered
+
+	var wg sync.WaitGroup
+	for i := 0; i < 9; i++ {
+		wg.Add(1)
+		go func(force bool) {
+			defer wg.Done()
+			if force {
+				errs <- ntp.ForceSyncNow()
+			} else {
+				errs <- ntp.Sync()
+			}
+		}(i%2 == 0)
+	}
+
+	// 等待所有调用加入正在进行的同步
+	time.Sleep(50 * time.Millisecond)
+	close(src.release)
+	wg.Wait()
+
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("同步失败: %v", err)
+		}
+	}
+	if got := src.calls.Load(); got != 1 {
+		t.Errorf("预期只测量1次，实际测量了%d次", got)
+	}
+	if got := ntp.TimeOffsetDuration(); got != time.Second {
+		t.Errorf("预期偏移量为1秒，实际得到%v", got)
+	}
+
+	// 有ForceSyncNow加入时，这次同步只计入一次成功
+	if got := ntp.GetPeriodicSyncStatus().SuccessCount; got != 1 {
+		t.Errorf("预期计入1次成功，实际得到%d次", got)
+	}
+
+	// 同步完成后再次调用会重新测量
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if got := src.calls.Load(); got != 2 {
+		t.Errorf("预期再次同步时重新测量，实际测量了%d次", got)
+	}
+}
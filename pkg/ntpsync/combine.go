@@ -0,0 +1,277 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 选择和聚类算法的参数（RFC 5905）
+const (
+	// minIntersectionSurvivors 是交集算法至少需要的真值服务器数量(NSANE)
+	minIntersectionSurvivors = 1
+
+	// minClusterSurvivors 是聚类算法至少保留的服务器数量(NMIN)
+	minClusterSurvivors = 3
+)
+
+// ErrNoMajority 表示交集算法没有找到多数服务器一致的时间区间，无法区分真值服务器和伪值服务器
+var ErrNoMajority = errors.New("没有多数服务器一致的时间区间")
+
+// combinePeer 是参与选择、聚类和合并的一个服务器的测量
+type combinePeer struct {
+	index    int // 在候选服务器中的位置
+	offset   time.Duration
+	distance time.Duration // 根距离，即正确性区间的半宽
+	jitter   time.Duration // 服务器自身的抖动，不小于服务器的精度
+	stratum  uint8
+}
+
+// intersect 按RFC 5905第11.2.1节的交集算法找出多数服务器的正确性区间共同包含的区间，
+// 允许少于一半的伪值服务器，返回区间的下限和上限，没有多数一致时返回false
+func intersect(peers []combinePeer) (low, high time.Duration, ok bool) {
+	type edge struct {
+		value time.Duration
+		typ   int // -1为下端点，0为中点，+1为上端点
+	}
+	edges := make([]edge, 0, 3*len(peers))
+	for _, p := range peers {
+		edges = append(edges,
+			edge{p.offset - p.distance, -1},
+			edge{p.offset, 0},
+			edge{p.offset + p.distance, 1})
+	}
+	slices.SortStableFunc(edges, func(a, b edge) int {
+		if a.value != b.value {
+			return compareDuration(a.value, b.value)
+		}
+		return a.typ - b.typ
+	})
+
+	n := len(peers)
+	for allow := 0; 2*allow < n; allow++ {
+		found := 0
+		chime := 0
+		for _, e := range edges {
+			chime -= e.typ
+			if chime >= n-allow {
+				low = e.value
+				break
+			}
+			if e.typ == 0 {
+				found++
+			}
+		}
+		chime = 0
+		for i := len(edges) - 1; i >= 0; i-- {
+			chime += edges[i].typ
+			if chime >= n-allow {
+				high = edges[i].value
+				break
+			}
+			if edges[i].typ == 0 {
+				found++
+			}
+		}
+		// 区间外的中点多于允许的伪值服务器时，增加允许的数量重新查找
+		if found > allow {
+			continue
+		}
+		if high > low {
+			return low, high, true
+		}
+	}
+	return 0, 0, false
+}
+
+// compareDuration 比较两个时长，用于排序
+func compareDuration(a, b time.Duration) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// selectionJitter 返回peers[i]相对其它幸存者的选择抖动，即偏移量之差的均方根
+func selectionJitter(peers []combinePeer, i int) time.Duration {
+	var sum float64
+	for j, p := range peers {
+		if j != i {
+			d := float64(p.offset - peers[i].offset)
+			sum += d * d
+		}
+	}
+	return time.Duration(math.Sqrt(sum / float64(len(peers)-1)))
+}
+
+// cluster 按RFC 5905第11.2.2节的聚类算法，依次去掉选择抖动最大的幸存者，
+// 直到最大的选择抖动不超过最小的服务器抖动，或只剩minClusterSurvivors个幸存者。
+// 返回留下的幸存者和被去掉的服务器及去掉时的选择抖动
+func cluster(peers []combinePeer) (survivors []combinePeer, discarded map[int]time.Duration) {
+	survivors = slices.Clone(peers)
+	discarded = make(map[int]time.Duration)
+	for len(survivors) > minClusterSurvivors {
+		worst, maxJitter := 0, time.Duration(-1)
+		minJitter := time.Duration(math.MaxInt64)
+		for i, p := range survivors {
+			if j := selectionJitter(survivors, i); j > maxJitter {
+				worst, maxJitter = i, j
+			}
+			minJitter = min(minJitter, p.jitter)
+		}
+		if maxJitter <= minJitter {
+			break
+		}
+		discarded[survivors[worst].index] = maxJitter
+		survivors = slices.Delete(survivors, worst, worst+1)
+	}
+	return survivors, discarded
+}
+
+// combine 按RFC 5905第11.2.3节以根距离的倒数为权重合并幸存者的偏移量
+func combine(survivors []combinePeer) time.Duration {
+	var x, y float64
+	for _, p := range survivors {
+		// 根距离至少为MINDISP的一半，不会为零
+		w := 1 / float64(max(p.distance, minDispersion/2))
+		x += w
+		y += w * float64(p.offset)
+	}
+	return time.Duration(math.Round(y / x))
+}
+
+// shouldCombineServers 返回同步时是否合并所有服务器的偏移量，参见Options.CombineServers
+func (n *NTPSync) shouldCombineServers() bool {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	return n.combineServers
+}
+
+// SyncWithMultiServerCombined 像ntpd一样测量所有服务器并合并它们的偏移量：
+// 交集算法排除正确性区间与多数服务器不一致的伪值服务器，聚类算法去掉偏移量离群的幸存者，
+// 再以根距离的倒数为权重合并留下的偏移量（RFC 5905第11.2节）。
+// 结果的Server是排名最高（层级最低、根距离最小）的幸存者，即系统对等体，Offset为合并后的偏移量。
+// 每次选择的过程记录到选择历史，参见GetSelectionHistory
+func (n *NTPSync) SyncWithMultiServerCombined() error {
+	servers, timeout, err := n.syncTargets()
+	if err != nil {
+		return err
+	}
+
+	// 并行测量所有没有被排除的服务器
+	candidates := n.newSelection(servers, n.clock.Now())
+	results := make([]*SyncResult, len(candidates))
+	errs := make([]error, len(candidates))
+	var wg sync.WaitGroup
+	for i, c := range candidates {
+		if c.Outcome != SelectionNotTried {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+
+			results[i], errs[i] = n.probeServer(server, timeout)
+			n.recordServerResult(n.serverManager, server, results[i], errs[i])
+		}(i, c.Server)
+	}
+	wg.Wait()
+
+	if n.isClosed() {
+		return ErrClosed
+	}
+
+	var peers []combinePeer
+	var lastErr error
+	for i, c := range candidates {
+		if c.Outcome != SelectionNotTried {
+			continue
+		}
+		if errs[i] != nil {
+			candidates[i].Outcome, candidates[i].Reason = SelectionFailed, errs[i].Error()
+			lastErr = errs[i]
+			continue
+		}
+		r := results[i]
+		peers = append(peers, combinePeer{
+			index:    i,
+			offset:   r.Offset,
+			distance: r.RootDistance,
+			jitter:   max(n.serverJitter(c.Server), r.Precision),
+			stratum:  r.Stratum,
+		})
+	}
+
+	if len(peers) == 0 {
+		n.recordSelection(candidates, nil)
+		if lastErr == nil {
+			err = errors.New("所有NTP服务器都因连续失败或拒绝访问被暂时排除")
+		} else {
+			err = fmt.Errorf("无法与任何NTP服务器同步: %w", lastErr)
+		}
+		n.syncFailed(err)
+		return err
+	}
+
+	// 交集算法：正确性区间与交集区间不重叠的是伪值服务器
+	low, high, ok := intersect(peers)
+	truechimers := make([]combinePeer, 0, len(peers))
+	for _, p := range peers {
+		c := &candidates[p.index]
+		switch {
+		case !ok:
+			c.Outcome, c.Reason = SelectionFalseticker, ErrNoMajority.Error()
+		case p.offset+p.distance < low || p.offset-p.distance > high:
+			c.Outcome = SelectionFalseticker
+			c.Reason = fmt.Sprintf("正确性区间%v±%v与多数服务器的区间[%v, %v]不重叠", p.offset, p.distance, low, high)
+		default:
+			truechimers = append(truechimers, p)
+		}
+	}
+	if len(truechimers) < minIntersectionSurvivors {
+		n.recordSelection(candidates, nil)
+		err = fmt.Errorf("%w: %d个服务器", ErrNoMajority, len(peers))
+		n.syncFailed(err)
+		return err
+	}
+
+	// 按层级和根距离排序，排在最前面的幸存者是系统对等体
+	limit := n.maxDistanceLimit()
+	if limit <= 0 {
+		limit = DefaultMaxDistance
+	}
+	slices.SortStableFunc(truechimers, func(a, b combinePeer) int {
+		return compareDuration(time.Duration(a.stratum)*limit+a.distance, time.Duration(b.stratum)*limit+b.distance)
+	})
+
+	survivors, discarded := cluster(truechimers)
+	for i, jitter := range discarded {
+		candidates[i].Outcome = SelectionClustered
+		candidates[i].Reason = fmt.Sprintf("选择抖动%v大于幸存者的抖动", jitter)
+	}
+	for _, p := range survivors[1:] {
+		candidates[p.index].Outcome, candidates[p.index].Reason = SelectionCombined, ""
+	}
+	peer := survivors[0]
+	candidates[peer.index].Outcome, candidates[peer.index].Reason = SelectionSelected, ""
+
+	offset := combine(survivors)
+	combined := *results[peer.index]
+	combined.Time = combined.Time.Add(offset - combined.Offset)
+	combined.Offset = offset
+	n.storeSelection(Selection{
+		Time:       n.clock.Now(),
+		Server:     combined.Server,
+		Reason:     fmt.Sprintf("合并了%d个幸存者的偏移量，系统对等体为层级和根距离最小的幸存者", len(survivors)),
+		Candidates: candidates,
+	}, &combined)
+
+	return n.applyResult(&combined)
+}
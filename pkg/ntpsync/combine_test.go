@@ -0,0 +1,103 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestIntersect 测试交集算法找出多数服务器一致的区间
+func TestIntersect(t *testing.T) {
+	ms := time.Millisecond
+	peers := []combinePeer{
+		{offset: 0, distance: 10 * ms},
+		{offset: 1 * ms, distance: 10 * ms},
+		{offset: 2 * ms, distance: 10 * ms},
+		{offset: time.Second, distance: 10 * ms},
+	}
+	low, high, ok := intersect(peers)
+	if !ok || low != -8*ms || high != 10*ms {
+		t.Errorf("预期区间为[-8ms, 10ms]，实际得到[%v, %v], %v", low, high, ok)
+	}
+
+	// 两个服务器不一致时没有多数
+	if _, _, ok := intersect(peers[2:]); ok {
+		t.Error("预期两个不重叠的服务器没有多数一致的区间")
+	}
+	if _, _, ok := intersect(peers[:1]); !ok {
+		t.Error("预期一个服务器自身构成区间")
+	}
+}
+
+// TestClusterAndCombine 测试聚类算法去掉离群的幸存者并按根距离加权合并
+func TestClusterAndCombine(t *testing.T) {
+	ms := time.Millisecond
+	peers := []combinePeer{
+		{index: 0, offset: 0, distance: 10 * ms, jitter: ms},
+		{index: 1, offset: ms / 10, distance: 10 * ms, jitter: ms},
+		{index: 2, offset: -ms / 10, distance: 10 * ms, jitter: ms},
+		{index: 3, offset: ms / 5, distance: 10 * ms, jitter: ms},
+		{index: 4, offset: 50 * ms, distance: 10 * ms, jitter: ms},
+	}
+	survivors, discarded := cluster(peers)
+	if len(survivors) != 4 || len(discarded) != 1 || discarded[4] == 0 {
+		t.Fatalf("预期只去掉偏移量离群的服务器，实际留下%d个，去掉%v", len(survivors), discarded)
+	}
+
+	// 至少保留minClusterSurvivors个幸存者
+	if survivors, _ := cluster(append(peers[:2:2], peers[4])); len(survivors) != 3 {
+		t.Errorf("预期保留3个幸存者，实际得到%d个", len(survivors))
+	}
+
+	// 根距离小的服务器权重大
+	got := combine([]combinePeer{{offset: 0, distance: 10 * ms}, {offset: 30 * ms, distance: 20 * ms}})
+	if got != 10*ms {
+		t.Errorf("预期合并后的偏移量为10ms，实际得到%v", got)
+	}
+}
+
+// TestSyncWithMultiServerCombined 测试合并多个服务器的偏移量并排除伪值服务器
+func TestSyncWithMultiServerCombined(t *testing.T) {
+	clock := newFakeClock()
+	offsets := []time.Duration{10 * time.Millisecond, 12 * time.Millisecond, 11 * time.Millisecond, 5 * time.Second}
+	addrs := make([]string, len(offsets))
+	for i, offset := range offsets {
+		srv := ntptest.NewServer()
+		defer srv.Close()
+		srv.SetNow(clock.Now)
+		srv.SetOffset(offset)
+		addrs[i] = srv.Addr()
+	}
+
+	ntp, err := New(Options{
+		Servers:         addrs,
+		Timeout:         100 * time.Millisecond,
+		MinPollInterval: -1,
+		CombineServers:  true,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if offset := ntp.TimeOffsetDuration(); offset < 10*time.Millisecond || offset > 12*time.Millisecond {
+		t.Errorf("预期合并后的偏移量在10ms到12ms之间，实际得到%v", offset)
+	}
+
+	s := ntp.GetSelectionHistory(1)[0]
+	counts := make(map[SelectionOutcome]int)
+	for _, c := range s.Candidates {
+		counts[c.Outcome]++
+	}
+	if counts[SelectionSelected] != 1 || counts[SelectionCombined] != 2 || counts[SelectionFalseticker] != 1 {
+		t.Errorf("预期1个系统对等体、2个参与合并的服务器和1个伪值服务器，实际得到%+v", s.Candidates)
+	}
+	if c := s.Candidates[3]; c.Outcome != SelectionFalseticker || c.Reason == "" {
+		t.Errorf("预期偏移5秒的服务器是伪值服务器，实际得到%+v", c)
+	}
+}
@@ -0,0 +1,779 @@
+package ntpsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultConfigPollInterval 是WatchConfig检查配置文件变化的默认间隔
+const DefaultConfigPollInterval = 5 * time.Second
+
+// Config 表示从配置文件加载的同步配置
+//
+// 支持JSON、YAML和TOML格式，例如YAML：
+//
+//	servers:
+//	  - pool.ntp.org
+//	  - address: time.google.com
+//	    timeout: 2s
+//	  - address: 192.168.1.10
+//	    version: 3
+//	    key: 1
+//	  - address: 10.20.0.1
+//	    asymmetry: 250ms
+//	keys_file: /etc/ntp.keys
+//	timeout: 5s
+//	dial_timeout: 10s
+//	read_timeout: 2s
+//	retry_count: 2
+//	retry_backoff: 200ms
+//	sync_interval: 1h
+//	sync_interval_jitter: 0.1
+//	schedule: "0,30 * * * *"
+//	holdover_after: 4h
+//	local_stratum: 10
+//	auto_sync: true
+//	resync_on_network_change: true
+//	detect_suspend: true
+//	detect_clock_step: true
+//	enable_multi_server: true
+//	failover_policy: sticky
+//	combine_servers: true
+//	huff_puff: 2h
+//	max_offset: 1000s
+//	step_threshold: 128ms
+//	allow_large_first_offset: true
+//	max_distance: 1.5s
+//	divergence_threshold: 100ms
+//	local_addr: 192.168.1.5
+//	interface: eth1
+//	hardware_timestamps: true
+//	dscp: 46
+//	max_concurrent_probes: 4
+//	probe_interval: 15m
+//	state_file: /var/lib/ntpsync/state.json
+//	stats_dir: /var/log/ntpsync
+//	stats_format: ntpd
+//	stats_keep: 7
+//	dns_cache_ttl: 10m
+//	dns_negative_ttl: 1m
+//	srv_domain: example.com
+//	dhcp_servers: true
+//	rtc_device: /dev/rtc0
+//	rtc_write_interval: 11m
+//	refuse_on_time_daemon_conflict: true
+//
+// 时长既可以写成"5s"这样的字符串，也可以写成以秒为单位的数字
+type Config struct {
+	// Servers 是NTP服务器及其单独配置
+	Servers []ServerConfig
+
+	// Timeout 是NTP请求的超时时间
+	Timeout time.Duration
+
+	// DialTimeout 是解析地址和建立连接的超时时间，参见Options.DialTimeout
+	DialTimeout time.Duration
+
+	// ReadTimeout 是等待应答的超时时间，参见Options.ReadTimeout
+	ReadTimeout time.Duration
+
+	// KeysFile 是ntpd格式的密钥文件，解析配置时读取到Keys，参见LoadKeysFile
+	KeysFile string
+
+	// Keys 是从KeysFile读取的对称密钥，参见Options.Keys
+	Keys Keys
+
+	// RetryCount 是等待应答超时后重新发送请求的次数，参见Options.RetryCount
+	RetryCount int
+
+	// RetryBackoff 是第一次重新发送请求前的等待时间，参见Options.RetryBackoff
+	RetryBackoff time.Duration
+
+	// SyncInterval 是自动同步的时间间隔
+	SyncInterval time.Duration
+
+	// SyncIntervalJitter 是同步间隔随机调整的比例，参见Options.SyncIntervalJitter
+	SyncIntervalJitter float64
+
+	// Schedule 是定时同步的计划，配置文件中写成ParseSchedule支持的字符串，参见Options.Schedule
+	Schedule Schedule
+
+	// HoldoverAfter 是所有同步都失败多久之后进入保持模式，参见Options.HoldoverAfter
+	HoldoverAfter time.Duration
+
+	// LocalStratum 是回退到本地时钟时使用的层级，参见Options.LocalStratum
+	LocalStratum int
+
+	// AutoSync 表示是否启用自动同步
+	AutoSync bool
+
+	// ResyncOnNetworkChange 表示是否在网络变化后立即重新同步，参见Options.ResyncOnNetworkChange
+	ResyncOnNetworkChange bool
+
+	// DetectSuspend 表示是否检测系统休眠，参见Options.DetectSuspend
+	DetectSuspend bool
+
+	// DetectClockStep 表示是否检测系统时钟被外部调整，参见Options.DetectClockStep
+	DetectClockStep bool
+
+	// EnableMultiServer 表示是否启用多服务器支持
+	EnableMultiServer bool
+
+	// MaxOffset 是允许应用的最大偏移量，参见Options.MaxOffset
+	MaxOffset time.Duration
+
+	// StepThreshold 是直接调整偏移量的阈值，参见Options.StepThreshold
+	StepThreshold time.Duration
+
+	// AllowLargeFirstOffset 表示首次同步不受MaxOffset限制
+	AllowLargeFirstOffset bool
+
+	// MaxDistance 是允许的最大根距离，参见Options.MaxDistance
+	MaxDistance time.Duration
+
+	// DivergenceThreshold 是服务器之间偏移量之差的上限，参见Options.DivergenceThreshold
+	DivergenceThreshold time.Duration
+
+	// FailoverPolicy 是依次尝试服务器的故障切换策略，参见Options.FailoverPolicy
+	FailoverPolicy FailoverPolicy
+
+	// CombineServers 表示是否测量所有服务器并合并它们的偏移量，参见Options.CombineServers
+	CombineServers bool
+
+	// HuffPuff 是huff-n'-puff记录最小往返时间的窗口长度，参见Options.HuffPuff
+	HuffPuff time.Duration
+
+	// LocalAddr 是发送NTP请求使用的源IP地址，参见Options.LocalAddr
+	LocalAddr string
+
+	// Interface 是发送NTP请求使用的网卡名称，参见Options.Interface
+	Interface string
+
+	// HardwareTimestamps 表示使用网卡硬件时间戳，参见Options.HardwareTimestamps
+	HardwareTimestamps bool
+
+	// DSCP 是NTP请求的差分服务代码点，参见Options.DSCP
+	DSCP int
+
+	// MaxConcurrentProbes 是同时进行的请求数量上限，参见Options.MaxConcurrentProbes
+	MaxConcurrentProbes int
+
+	// ProbeInterval 是在后台探测所有服务器的间隔，参见Options.ProbeInterval
+	ProbeInterval time.Duration
+
+	// StateFile 是保存服务器状态的文件，非空时使用NewFileStore，参见Options.Store
+	StateFile string
+
+	// StatsDir 是写入测量日志的目录，参见Options.StatsDir
+	StatsDir string
+
+	// StatsFormat 是测量日志的格式，参见Options.StatsFormat
+	StatsFormat StatsFormat
+
+	// StatsKeep 是测量日志保留的天数，参见Options.StatsKeep
+	StatsKeep int
+
+	// DNSCacheTTL 和 DNSNegativeTTL 是缓存服务器主机名解析结果和解析失败的时长，
+	// 任一非零时使用NewCachingResolver，参见CachingResolverOptions
+	DNSCacheTTL    time.Duration
+	DNSNegativeTTL time.Duration
+
+	// SRVDomain 是通过SRV记录发现服务器的域名，设置后Servers可以为空，参见Options.SRVDomain
+	SRVDomain string
+
+	// DHCPServers 表示是否使用DHCP提供的NTP服务器，设置后Servers可以为空，参见Options.DHCPServers
+	DHCPServers bool
+
+	// RTCDevice 是同步成功后写入的RTC设备，非空时使用RTCDevice，参见Options.HardwareClock
+	RTCDevice string
+
+	// RTCWriteInterval 是两次写入RTC设备之间的最短间隔，参见Options.HardwareClockInterval
+	RTCWriteInterval time.Duration
+
+	// RefuseOnTimeDaemonConflict 表示发现其它时间同步守护进程时是否拒绝设置系统时间，
+	// 参见Options.RefuseOnTimeDaemonConflict
+	RefuseOnTimeDaemonConflict bool
+}
+
+// ServerConfig 表示配置文件中的一个NTP服务器
+type ServerConfig struct {
+	// Address 是NTP服务器地址
+	Address string
+
+	// ServerOptions 是该服务器的单独配置
+	ServerOptions
+}
+
+// LoadConfig 从文件加载配置，根据扩展名（.json、.yaml、.yml、.toml）选择格式
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	cfg, err := ParseConfig(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// ParseConfig 按给定格式（json、yaml、yml、toml）解析配置
+func ParseConfig(data []byte, format string) (*Config, error) {
+	var tree interface{}
+	var err error
+
+	switch strings.ToLower(format) {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&tree)
+	case "yaml", "yml":
+		tree, err = parseYAML(data)
+	case "toml":
+		tree, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("不支持的配置格式: %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := tree.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("配置的顶层必须是映射")
+	}
+
+	return decodeConfig(root)
+}
+
+// decodeConfig 将解析树转换为Config
+func decodeConfig(root map[string]interface{}) (*Config, error) {
+	cfg := &Config{}
+
+	for key, value := range root {
+		var err error
+		switch key {
+		case "servers":
+			cfg.Servers, err = decodeServers(value)
+		case "timeout":
+			cfg.Timeout, err = decodeDuration(value)
+		case "dial_timeout":
+			cfg.DialTimeout, err = decodeDuration(value)
+		case "read_timeout":
+			cfg.ReadTimeout, err = decodeDuration(value)
+		case "keys_file":
+			if cfg.KeysFile, err = decodeString(value); err == nil {
+				cfg.Keys, err = LoadKeysFile(cfg.KeysFile)
+			}
+		case "retry_count":
+			cfg.RetryCount, err = decodeInt(value, 0, math.MaxInt32)
+		case "retry_backoff":
+			cfg.RetryBackoff, err = decodeDuration(value)
+		case "sync_interval":
+			cfg.SyncInterval, err = decodeDuration(value)
+		case "sync_interval_jitter":
+			if cfg.SyncIntervalJitter, err = decodeFloat(value); err == nil {
+				err = validateIntervalJitter(cfg.SyncIntervalJitter)
+			}
+		case "schedule":
+			var spec string
+			if spec, err = decodeString(value); err == nil {
+				cfg.Schedule, err = ParseSchedule(spec)
+			}
+		case "holdover_after":
+			cfg.HoldoverAfter, err = decodeDuration(value)
+		case "local_stratum":
+			cfg.LocalStratum, err = decodeInt(value, 0, 15)
+		case "auto_sync":
+			cfg.AutoSync, err = decodeBool(value)
+		case "resync_on_network_change":
+			cfg.ResyncOnNetworkChange, err = decodeBool(value)
+		case "detect_suspend":
+			cfg.DetectSuspend, err = decodeBool(value)
+		case "detect_clock_step":
+			cfg.DetectClockStep, err = decodeBool(value)
+		case "enable_multi_server":
+			cfg.EnableMultiServer, err = decodeBool(value)
+		case "max_offset":
+			cfg.MaxOffset, err = decodeDuration(value)
+		case "step_threshold":
+			cfg.StepThreshold, err = decodeDuration(value)
+		case "allow_large_first_offset":
+			cfg.AllowLargeFirstOffset, err = decodeBool(value)
+		case "max_distance":
+			cfg.MaxDistance, err = decodeDuration(value)
+		case "divergence_threshold":
+			cfg.DivergenceThreshold, err = decodeDuration(value)
+		case "failover_policy":
+			var policy string
+			if policy, err = decodeString(value); err == nil {
+				cfg.FailoverPolicy = FailoverPolicy(policy)
+				err = validateFailoverPolicy(cfg.FailoverPolicy)
+			}
+		case "combine_servers":
+			cfg.CombineServers, err = decodeBool(value)
+		case "huff_puff":
+			cfg.HuffPuff, err = decodeDuration(value)
+		case "local_addr":
+			cfg.LocalAddr, err = decodeString(value)
+		case "interface":
+			cfg.Interface, err = decodeString(value)
+		case "hardware_timestamps":
+			cfg.HardwareTimestamps, err = decodeBool(value)
+		case "dscp":
+			cfg.DSCP, err = decodeInt(value, 0, 63)
+		case "max_concurrent_probes":
+			cfg.MaxConcurrentProbes, err = decodeInt(value, -1, math.MaxInt32)
+		case "probe_interval":
+			cfg.ProbeInterval, err = decodeDuration(value)
+		case "state_file":
+			cfg.StateFile, err = decodeString(value)
+		case "stats_dir":
+			cfg.StatsDir, err = decodeString(value)
+		case "stats_format":
+			var format string
+			if format, err = decodeString(value); err == nil {
+				cfg.StatsFormat = StatsFormat(format)
+				err = validateStatsFormat(cfg.StatsFormat)
+			}
+		case "stats_keep":
+			cfg.StatsKeep, err = decodeInt(value, 0, math.MaxInt32)
+		case "dns_cache_ttl":
+			cfg.DNSCacheTTL, err = decodeDuration(value)
+		case "dns_negative_ttl":
+			cfg.DNSNegativeTTL, err = decodeDuration(value)
+		case "srv_domain":
+			cfg.SRVDomain, err = decodeString(value)
+		case "dhcp_servers":
+			cfg.DHCPServers, err = decodeBool(value)
+		case "rtc_device":
+			cfg.RTCDevice, err = decodeString(value)
+		case "rtc_write_interval":
+			cfg.RTCWriteInterval, err = decodeDuration(value)
+		case "refuse_on_time_daemon_conflict":
+			cfg.RefuseOnTimeDaemonConflict, err = decodeBool(value)
+		default:
+			err = errors.New("未知的配置项")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("配置项 %s: %v", key, err)
+		}
+	}
+
+	if len(cfg.Servers) == 0 && cfg.SRVDomain == "" && !cfg.DHCPServers {
+		return nil, errors.New("必须提供至少一个NTP服务器，或者设置srv_domain或dhcp_servers")
+	}
+
+	return cfg, nil
+}
+
+// decodeServers 解析服务器列表，元素可以是地址字符串或包含address的映射
+func decodeServers(value interface{}) ([]ServerConfig, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("必须是列表")
+	}
+
+	servers := make([]ServerConfig, 0, len(items))
+	for i, item := range items {
+		switch v := item.(type) {
+		case string:
+			servers = append(servers, ServerConfig{Address: v})
+
+		case map[string]interface{}:
+			server := ServerConfig{}
+			for key, value := range v {
+				var err error
+				switch key {
+				case "address":
+					server.Address, err = decodeString(value)
+				case "timeout":
+					server.Timeout, err = decodeDuration(value)
+				case "version":
+					server.Version, err = decodeVersion(value)
+				case "key":
+					var id int
+					id, err = decodeInt(value, 1, math.MaxUint16)
+					server.KeyID = uint32(id)
+				case "asymmetry":
+					server.Asymmetry, err = decodeDuration(value)
+				default:
+					err = errors.New("未知的配置项")
+				}
+				if err != nil {
+					return nil, fmt.Errorf("第%d个服务器的 %s: %v", i+1, key, err)
+				}
+			}
+			servers = append(servers, server)
+
+		default:
+			return nil, fmt.Errorf("第%d个服务器的格式无效", i+1)
+		}
+
+		if strings.TrimSpace(servers[len(servers)-1].Address) == "" {
+			return nil, fmt.Errorf("第%d个服务器缺少地址", i+1)
+		}
+	}
+
+	return servers, nil
+}
+
+// decodeDuration 解析时长，字符串按time.ParseDuration解析，数字按秒解析
+func decodeDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时长 %q", v)
+		}
+		return d, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("无效的时长 %q", v)
+		}
+		return time.Duration(f * float64(time.Second)), nil
+	default:
+		return 0, errors.New("必须是时长字符串或秒数")
+	}
+}
+
+// decodeVersion 解析NTP版本号
+func decodeVersion(value interface{}) (NTPVersion, error) {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case json.Number:
+		var err error
+		if f, err = v.Float64(); err != nil {
+			return 0, fmt.Errorf("无效的版本号 %q", v)
+		}
+	default:
+		return 0, errors.New("必须是版本号")
+	}
+
+	if f < 0 || f > 7 || f != float64(int(f)) {
+		return 0, fmt.Errorf("无效的版本号 %v", f)
+	}
+	version := NTPVersion(f)
+	if err := validateVersion(version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// decodeInt 解析min到max之间的整数
+func decodeInt(value interface{}, min, max int) (int, error) {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case json.Number:
+		var err error
+		if f, err = v.Float64(); err != nil {
+			return 0, fmt.Errorf("无效的整数 %q", v)
+		}
+	default:
+		return 0, errors.New("必须是整数")
+	}
+
+	if f != float64(int(f)) || f < float64(min) || f > float64(max) {
+		return 0, fmt.Errorf("必须是%d到%d之间的整数", min, max)
+	}
+	return int(f), nil
+}
+
+// decodeFloat 解析数字
+func decodeFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("无效的数字 %q", v)
+		}
+		return f, nil
+	default:
+		return 0, errors.New("必须是数字")
+	}
+}
+
+// decodeBool 解析布尔值
+func decodeBool(value interface{}) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, errors.New("必须是布尔值")
+	}
+	return b, nil
+}
+
+// decodeString 解析字符串
+func decodeString(value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", errors.New("必须是字符串")
+	}
+	return s, nil
+}
+
+// Options 将配置转换为创建NTPSync所需的选项
+func (c *Config) Options() Options {
+	opts := Options{
+		Servers:            make([]string, 0, len(c.Servers)),
+		Timeout:            c.Timeout,
+		DialTimeout:        c.DialTimeout,
+		ReadTimeout:        c.ReadTimeout,
+		RetryCount:         c.RetryCount,
+		RetryBackoff:       c.RetryBackoff,
+		SyncInterval:       c.SyncInterval,
+		SyncIntervalJitter: c.SyncIntervalJitter,
+		Schedule:           c.Schedule,
+		HoldoverAfter:      c.HoldoverAfter,
+		LocalStratum:       c.LocalStratum,
+		AutoSync:           c.AutoSync,
+		EnableMultiServer:  c.EnableMultiServer,
+		ServerOptions:      make(map[string]ServerOptions),
+
+		MaxOffset:             c.MaxOffset,
+		StepThreshold:         c.StepThreshold,
+		AllowLargeFirstOffset: c.AllowLargeFirstOffset,
+		MaxDistance:           c.MaxDistance,
+		DivergenceThreshold:   c.DivergenceThreshold,
+		FailoverPolicy:        c.FailoverPolicy,
+		CombineServers:        c.CombineServers,
+		HuffPuff:              c.HuffPuff,
+		LocalAddr:             c.LocalAddr,
+		Interface:             c.Interface,
+		HardwareTimestamps:    c.HardwareTimestamps,
+		DSCP:                  c.DSCP,
+		MaxConcurrentProbes:   c.MaxConcurrentProbes,
+		ProbeInterval:         c.ProbeInterval,
+		Keys:                  c.Keys,
+		ResyncOnNetworkChange: c.ResyncOnNetworkChange,
+		DetectSuspend:         c.DetectSuspend,
+		DetectClockStep:       c.DetectClockStep,
+		SRVDomain:             c.SRVDomain,
+		DHCPServers:           c.DHCPServers,
+		HardwareClockInterval: c.RTCWriteInterval,
+		StatsDir:              c.StatsDir,
+		StatsFormat:           c.StatsFormat,
+		StatsKeep:             c.StatsKeep,
+
+		RefuseOnTimeDaemonConflict: c.RefuseOnTimeDaemonConflict,
+	}
+
+	for _, server := range c.Servers {
+		opts.Servers = append(opts.Servers, server.Address)
+		if server.ServerOptions != (ServerOptions{}) {
+			opts.ServerOptions[server.Address] = server.ServerOptions
+		}
+	}
+	if c.StateFile != "" {
+		opts.Store = NewFileStore(c.StateFile)
+	}
+	if c.RTCDevice != "" {
+		opts.HardwareClock = RTCDevice(c.RTCDevice)
+	}
+	if c.DNSCacheTTL != 0 || c.DNSNegativeTTL != 0 {
+		opts.Resolver = NewCachingResolver(CachingResolverOptions{
+			TTL:         c.DNSCacheTTL,
+			NegativeTTL: c.DNSNegativeTTL,
+		})
+	}
+
+	return opts
+}
+
+// NewFromConfig 从配置文件创建NTPSync实例，之后可以调用Reload重新加载该文件
+func NewFromConfig(path string) (*NTPSync, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ntp, err := New(cfg.Options())
+	if err != nil {
+		return nil, err
+	}
+
+	ntp.mutex.Lock()
+	ntp.configPath = path
+	ntp.mutex.Unlock()
+
+	return ntp, nil
+}
+
+// ApplyConfig 将配置应用到正在运行的实例，无需重启
+// 服务器列表、对称密钥、各项超时时间、重试策略、同步间隔及其随机调整、同步计划、保持模式、本地时钟、偏移量阈值、最大根距离、交叉检查阈值、故障切换策略、是否合并服务器、huff-n'-puff窗口和自动同步会立即生效；
+// EnableMultiServer、LocalAddr、Interface、HardwareTimestamps、DSCP、MaxConcurrentProbes、ProbeInterval、StateFile、StatsDir、StatsFormat、StatsKeep、DNSCacheTTL、DNSNegativeTTL、SRVDomain、DHCPServers、RTCDevice、RTCWriteInterval、RefuseOnTimeDaemonConflict、ResyncOnNetworkChange、DetectSuspend和DetectClockStep只在创建实例时生效
+func (n *NTPSync) ApplyConfig(cfg *Config) error {
+	if cfg == nil || (len(cfg.Servers) == 0 && n.srvDomain == "" && !n.dhcpServers) {
+		return errors.New("必须提供至少一个NTP服务器")
+	}
+
+	opts := cfg.Options()
+
+	interval := opts.SyncInterval
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+	n.mutex.RLock()
+	minPoll := n.minPollInterval
+	ntpv5 := n.ntpv5
+	n.mutex.RUnlock()
+	// 通过SRV记录发现的服务器不在配置中，保留在列表前面
+	servers := n.withDiscovered(opts.Servers)
+	interval = max(interval, minSyncInterval(servers, minPoll))
+	if err := validateServerOptions(opts.ServerOptions, ntpv5, opts.Keys); err != nil {
+		return err
+	}
+	if err := validateIntervalJitter(opts.SyncIntervalJitter); err != nil {
+		return err
+	}
+	if err := validateSchedule(opts.Schedule, n.clock.Now()); err != nil {
+		return err
+	}
+	if err := validateFailoverPolicy(opts.FailoverPolicy); err != nil {
+		return err
+	}
+
+	n.mutex.Lock()
+	n.setServersLocked(servers)
+	n.serverOptions = copyServerOptions(opts.ServerOptions)
+	n.keys = copyKeys(opts.Keys)
+	n.thresholds = thresholds{
+		maxOffset:             opts.MaxOffset,
+		stepThreshold:         opts.StepThreshold,
+		allowLargeFirstOffset: opts.AllowLargeFirstOffset,
+	}
+	n.maxDistance = opts.MaxDistance
+	if n.maxDistance == 0 {
+		n.maxDistance = DefaultMaxDistance
+	}
+	n.divergenceThreshold = opts.DivergenceThreshold
+	n.failoverPolicy = opts.FailoverPolicy
+	n.combineServers = opts.CombineServers
+	if n.huffPuff != opts.HuffPuff {
+		// 时段的划分随窗口长度变化，已有的记录不再可用
+		n.huffPuff = opts.HuffPuff
+		n.huffPuffFilters = nil
+	}
+	n.dialTimeout = opts.DialTimeout
+	n.readTimeout = opts.ReadTimeout
+	n.retryCount = opts.RetryCount
+	n.retryBackoff = opts.RetryBackoff
+	n.intervalJitter = opts.SyncIntervalJitter
+	n.schedule = opts.Schedule
+	n.holdoverAfter = opts.HoldoverAfter
+	n.localStratum = opts.LocalStratum
+	n.publishLocked()
+	n.mutex.Unlock()
+
+	n.SetTimeout(opts.Timeout)
+
+	if interval != n.GetPeriodicSyncInterval() {
+		n.SetPeriodicSyncInterval(interval)
+	}
+
+	// 根据配置启动或停止自动同步
+	if opts.AutoSync && !n.IsPeriodicSyncRunning() {
+		if err := n.StartPeriodicSync(); err != nil {
+			return err
+		}
+	} else if !opts.AutoSync && n.IsPeriodicSyncRunning() {
+		n.StopPeriodicSync()
+	}
+
+	return nil
+}
+
+// Reload 重新加载创建实例时使用的配置文件并应用到当前实例
+func (n *NTPSync) Reload() error {
+	n.mutex.RLock()
+	path := n.configPath
+	n.mutex.RUnlock()
+
+	if path == "" {
+		return errors.New("实例不是通过配置文件创建的")
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	return n.ApplyConfig(cfg)
+}
+
+// WatchConfig 定期检查配置文件，发现变化时调用Reload，直到ctx被取消
+// 重新加载失败时保留当前配置，错误会传给onError（可以为nil）
+func (n *NTPSync) WatchConfig(ctx context.Context, interval time.Duration, onError func(error)) error {
+	n.mutex.RLock()
+	path := n.configPath
+	n.mutex.RUnlock()
+
+	if path == "" {
+		return errors.New("实例不是通过配置文件创建的")
+	}
+
+	if interval <= 0 {
+		interval = DefaultConfigPollInterval
+	}
+
+	last, err := configFingerprint(path)
+	if err != nil {
+		return err
+	}
+
+	// 使用实例的时钟，注入假时钟的测试可以确定性地推进检查
+	timer := n.clock.NewTimer(interval)
+	defer stopTimer(timer)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C():
+			timer.Reset(interval)
+			current, err := configFingerprint(path)
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			if current == last {
+				continue
+			}
+			last = current
+
+			if err := n.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// configFingerprint 返回用于判断配置文件是否变化的修改时间和大小
+func configFingerprint(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("读取配置文件信息失败: %w", err)
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+}
@@ -0,0 +1,350 @@
+package ntpsync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 配置文件解析器只支持配置所需的YAML和TOML子集，
+// 解析结果统一为由map[string]interface{}、[]interface{}和标量组成的树，
+// 与encoding/json解码到interface{}的结果形式一致
+
+// yamlLine 是去除注释后的一行YAML
+type yamlLine struct {
+	indent int
+	text   string
+	num    int
+}
+
+// parseYAML 解析YAML子集：块映射、块序列、流序列和标量
+func parseYAML(data []byte) (interface{}, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(stripComment(raw), " \t\r")
+		if strings.TrimSpace(raw) == "" || raw == "---" {
+			continue
+		}
+		leading := raw[:len(raw)-len(strings.TrimLeft(raw, " \t"))]
+		if strings.Contains(leading, "\t") {
+			return nil, fmt.Errorf("第%d行: YAML不允许使用制表符缩进", i+1)
+		}
+		text := strings.TrimLeft(raw, " ")
+		lines = append(lines, yamlLine{indent: len(raw) - len(text), text: text, num: i + 1})
+	}
+
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	p := &yamlParser{lines: lines}
+	value, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("第%d行: 缩进不正确", p.lines[p.pos].num)
+	}
+
+	return value, nil
+}
+
+// yamlParser 按缩进递归解析YAML行
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseBlock 解析给定缩进的块
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if isSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+// parseSequence 解析块序列
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	var items []interface{}
+
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent || !isSequenceItem(line.text) {
+			return nil, fmt.Errorf("第%d行: 缩进不正确", line.num)
+		}
+
+		content := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		contentIndent := indent + len(line.text) - len(content)
+
+		switch {
+		case content == "":
+			// 序列项的值位于后续缩进更深的行
+			p.pos++
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				items = append(items, nil)
+				continue
+			}
+			value, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+
+		case isMappingEntry(content):
+			// 序列项是一个映射，把"- "替换为空格后按映射解析
+			p.lines[p.pos] = yamlLine{indent: contentIndent, text: content, num: line.num}
+			value, err := p.parseMapping(contentIndent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+
+		default:
+			value, err := parseScalar(content)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: %v", line.num, err)
+			}
+			items = append(items, value)
+			p.pos++
+		}
+	}
+
+	return items, nil
+}
+
+// parseMapping 解析块映射
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent || !isMappingEntry(line.text) {
+			return nil, fmt.Errorf("第%d行: 无法解析 %q", line.num, line.text)
+		}
+
+		key, rest := splitMappingEntry(line.text)
+		if _, exists := m[key]; exists {
+			return nil, fmt.Errorf("第%d行: 重复的键 %q", line.num, key)
+		}
+		p.pos++
+
+		if rest != "" {
+			value, err := parseScalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: %v", line.num, err)
+			}
+			m[key] = value
+			continue
+		}
+
+		// 值位于后续行：缩进更深的块，或与键同一缩进的序列
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || (next.indent == indent && isSequenceItem(next.text)) {
+				value, err := p.parseBlock(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = value
+				continue
+			}
+		}
+		m[key] = nil
+	}
+
+	return m, nil
+}
+
+// isSequenceItem 判断一行是否为序列项
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// isMappingEntry 判断文本是否为"键: 值"形式
+func isMappingEntry(text string) bool {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		return false
+	}
+	idx := strings.Index(text, ":")
+	return idx > 0 && (idx == len(text)-1 || text[idx+1] == ' ')
+}
+
+// splitMappingEntry 将"键: 值"拆分为键和值
+func splitMappingEntry(text string) (string, string) {
+	idx := strings.Index(text, ":")
+	return strings.TrimSpace(text[:idx]), strings.TrimSpace(text[idx+1:])
+}
+
+// parseTOML 解析TOML子集：键值对、[表]、[[表数组]]和单行数组
+func parseTOML(data []byte) (interface{}, error) {
+	root := make(map[string]interface{})
+	current := root
+	tableArrays := make(map[string]bool)
+
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(stripComment(raw))
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "[["):
+			if !strings.HasSuffix(line, "]]") {
+				return nil, fmt.Errorf("第%d行: 无效的表数组 %q", i+1, line)
+			}
+			name := strings.TrimSpace(line[2 : len(line)-2])
+			var tables []interface{}
+			if existing, ok := root[name]; ok {
+				if !tableArrays[name] {
+					return nil, fmt.Errorf("第%d行: %q 不是表数组", i+1, name)
+				}
+				tables = existing.([]interface{})
+			}
+			tableArrays[name] = true
+			current = make(map[string]interface{})
+			root[name] = append(tables, current)
+
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("第%d行: 无效的表 %q", i+1, line)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if _, exists := root[name]; exists {
+				return nil, fmt.Errorf("第%d行: 重复的表 %q", i+1, name)
+			}
+			current = make(map[string]interface{})
+			root[name] = current
+
+		default:
+			idx := strings.Index(line, "=")
+			if idx <= 0 {
+				return nil, fmt.Errorf("第%d行: 无法解析 %q", i+1, line)
+			}
+			key := strings.Trim(strings.TrimSpace(line[:idx]), "\"")
+			if _, exists := current[key]; exists {
+				return nil, fmt.Errorf("第%d行: 重复的键 %q", i+1, key)
+			}
+			value, err := parseScalar(strings.TrimSpace(line[idx+1:]))
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: %v", i+1, err)
+			}
+			current[key] = value
+		}
+	}
+
+	return root, nil
+}
+
+// stripComment 去除不在引号内的#注释
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseScalar 解析标量值或单行数组
+func parseScalar(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("未闭合的数组 %q", s)
+		}
+		return parseInlineArray(s[1 : len(s)-1])
+
+	case strings.HasPrefix(s, "\""):
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("无效的字符串 %s", s)
+		}
+		return unquoted, nil
+
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("无效的字符串 %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	}
+
+	switch strings.ToLower(s) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off":
+		return false, nil
+	case "null", "~", "":
+		return nil, nil
+	}
+
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n, nil
+	}
+
+	return s, nil
+}
+
+// parseInlineArray 解析以逗号分隔的数组元素
+func parseInlineArray(s string) ([]interface{}, error) {
+	items := []interface{}{}
+
+	var quote byte
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			c := s[i]
+			if quote != 0 {
+				if c == '\\' && quote == '"' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == '"' || c == '\'' {
+				quote = c
+				continue
+			}
+			if c != ',' {
+				continue
+			}
+		}
+
+		part := strings.TrimSpace(s[start:i])
+		start = i + 1
+		if part == "" {
+			continue
+		}
+		value, err := parseScalar(part)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("未闭合的字符串 %q", s)
+	}
+
+	return items, nil
+}
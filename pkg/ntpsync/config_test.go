@@ -0,0 +1,252 @@
+package ntpsync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 三种格式的等价配置
+var testConfigs = map[string]string{
+	"json": `{
+  "servers": ["pool.ntp.org", {"address": "time.google.com", "timeout": "2s"}],
+  "timeout": 3,
+  "sync_interval": "30m",
+  "enable_multi_server": true
+}`,
+	"yaml": `# 测试配置
+servers:
+  - pool.ntp.org
+  - address: time.google.com
+    timeout: 2s
+timeout: 3
+sync_interval: 30m   # 半小时
+enable_multi_server: true
+`,
+	"toml": `timeout = 3
+sync_interval = "30m"
+enable_multi_server = true
+servers = ["pool.ntp.org"]
+`,
+}
+
+// TestParseConfig 测试解析不同格式的配置
+func TestParseConfig(t *testing.T) {
+	want := &Config{
+		Servers: []ServerConfig{
+			{Address: "pool.ntp.org"},
+			{Address: "time.google.com", ServerOptions: ServerOptions{Timeout: 2 * time.Second}},
+		},
+		Timeout:           3 * time.Second,
+		SyncInterval:      30 * time.Minute,
+		EnableMultiServer: true,
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		cfg, err := ParseConfig([]byte(testConfigs[format]), format)
+		if err != nil {
+			t.Fatalf("解析%s配置失败: %v", format, err)
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%s: 预期 %+v，实际得到 %+v", format, want, cfg)
+		}
+	}
+
+	// TOML使用表数组描述带单独配置的服务器
+	tomlData := testConfigs["toml"] + `
+[[servers]]
+address = "time.google.com"
+timeout = "2s"
+`
+	if _, err := ParseConfig([]byte(tomlData), "toml"); err == nil {
+		t.Error("预期同时使用数组和表数组时返回错误，实际得到nil")
+	}
+
+	tomlData = `timeout = 3
+sync_interval = "30m"
+enable_multi_server = true
+
+[[servers]]
+address = "pool.ntp.org"
+
+[[servers]]
+address = "time.google.com" # 带注释
+timeout = "2s"
+`
+	cfg, err := ParseConfig([]byte(tomlData), "toml")
+	if err != nil {
+		t.Fatalf("解析toml配置失败: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("toml: 预期 %+v，实际得到 %+v", want, cfg)
+	}
+}
+
+// TestParseConfigErrors 测试无效配置
+func TestParseConfigErrors(t *testing.T) {
+	cases := []struct {
+		format string
+		data   string
+	}{
+		{"json", `{"servers": []}`},
+		{"json", `{"servers": ["a"], "unknown": 1}`},
+		{"yaml", "servers:\n  - a\ntimeout: abc\n"},
+		{"yaml", "servers:\n  - address: a\n    retries: 3\n"},
+		{"yaml", "servers:\n  - address: a\n    version: 2\n"},
+		{"json", `{"servers": [{"address": "a", "version": 3.5}]}`},
+		{"toml", "servers = [\"a\"]\nauto_sync = \"yes\"\n"},
+		{"yaml", "servers:\n  - a\nmax_offset: far\n"},
+		{"json", `{"servers": ["a"], "local_addr": 1}`},
+		{"yaml", "servers:\n  - a\ndscp: 64\n"},
+		{"yaml", "servers:\n  - a\nsync_interval_jitter: 1.5\n"},
+		{"yaml", "servers:\n  - a\nschedule: \"61 * * * *\"\n"},
+		{"yaml", "servers:\n  - a\nfailover_policy: random\n"},
+		{"ini", "servers=a"},
+	}
+
+	for _, c := range cases {
+		if _, err := ParseConfig([]byte(c.data), c.format); err == nil {
+			t.Errorf("预期 %s 配置 %q 返回错误，实际得到nil", c.format, c.data)
+		}
+	}
+}
+
+// TestReloadConfig 测试重新加载配置文件
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ntpsync.yaml")
+	if err := os.WriteFile(path, []byte(testConfigs["yaml"]), 0o644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	ntp, err := NewFromConfig(path)
+	if err != nil {
+		t.Fatalf("从配置文件创建实例失败: %v", err)
+	}
+
+	if _, got := ntp.exchangeTimeouts("time.google.com", DefaultTimeout); got != 2*time.Second {
+		t.Errorf("预期服务器单独的超时时间为2秒，实际得到%v", got)
+	}
+
+	updated := `servers:
+  - time.cloudflare.com
+  - pool.ntp.org
+sync_interval: 2h
+`
+	if err := os.WriteFile(path, []byte(updated), 0o644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	if err := ntp.Reload(); err != nil {
+		t.Fatalf("重新加载配置失败: %v", err)
+	}
+
+	if got := ntp.GetServers(); !reflect.DeepEqual(got, []string{"time.cloudflare.com", "pool.ntp.org"}) {
+		t.Errorf("预期服务器列表已更新，实际得到%v", got)
+	}
+
+	if got := ntp.serverManager.GetServers(); len(got) != 2 {
+		t.Errorf("预期服务器管理器中有2个服务器，实际得到%v", got)
+	}
+
+	if ntp.GetPeriodicSyncInterval() != 2*time.Hour {
+		t.Errorf("预期同步间隔为2小时，实际得到%v", ntp.GetPeriodicSyncInterval())
+	}
+
+	if ntp.GetTimeout() != DefaultTimeout {
+		t.Errorf("预期超时时间恢复为默认值，实际得到%v", ntp.GetTimeout())
+	}
+
+	// 没有配置文件的实例不能重新加载
+	plain, _ := New(Options{Servers: []string{"pool.ntp.org"}})
+	if err := plain.Reload(); err == nil {
+		t.Error("预期没有配置文件时返回错误，实际得到nil")
+	}
+}
+
+// TestWatchConfigClock 测试监视配置文件使用实例的时钟
+func TestWatchConfigClock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ntpsync.json")
+	if err := os.WriteFile(path, []byte(`{"servers": ["pool.ntp.org"]}`), 0o644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	ntp, err := NewFromConfig(path)
+	if err != nil {
+		t.Fatalf("从配置文件创建实例失败: %v", err)
+	}
+	defer ntp.Close()
+	clock := newFakeClock()
+	ntp.clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ntp.WatchConfig(ctx, time.Minute, nil) }()
+	clock.waitForTimers(t, 1)
+
+	// 修改时间与上一次不同，避免文件系统时间戳精度不足时看不出变化
+	if err := os.WriteFile(path, []byte(`{"servers": ["pool.ntp.org", "time.google.com"]}`), 0o644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("修改配置文件时间失败: %v", err)
+	}
+
+	// 假时钟没有前进时不检查配置文件
+	time.Sleep(20 * time.Millisecond)
+	if n := len(ntp.GetServers()); n != 1 {
+		t.Fatalf("预期时钟前进之前不重新加载，实际有%d个服务器", n)
+	}
+
+	clock.Advance(time.Minute)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ntp.GetServers()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("等待配置重新加载超时")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 每次检查之后重新设置定时器
+	clock.waitForTimers(t, 1)
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("预期context.Canceled，实际得到: %v", err)
+	}
+}
+
+// TestWatchConfig 测试监视配置文件变化
+func TestWatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ntpsync.json")
+	if err := os.WriteFile(path, []byte(`{"servers": ["pool.ntp.org"]}`), 0o644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	ntp, err := NewFromConfig(path)
+	if err != nil {
+		t.Fatalf("从配置文件创建实例失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		_ = ntp.WatchConfig(ctx, 10*time.Millisecond, nil)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path, []byte(`{"servers": ["pool.ntp.org", "time.google.com"]}`), 0o644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	for len(ntp.GetServers()) != 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("等待配置重新加载超时")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
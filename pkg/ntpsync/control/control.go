@@ -0,0 +1,179 @@
+// Package control 提供NTP同步客户端的远程控制与状态服务。
+//
+// Service的方法与proto/ntpsync/v1/control.proto中定义的Control服务一一对应，
+// 不依赖具体的传输方式，gRPC等传输层只需将请求转换后调用对应的方法。
+//
+// 本包自带一个基于unix套接字的传输：Serve在本地套接字上接受每行一个JSON对象的请求，
+// 例如{"method":"SetInterval","interval":"10m"}，应答为{"result":...}或{"error":"..."}；
+// Client和cmd/ntpsyncctl命令通过它查询和控制正在运行的程序，无需开放网络端口。
+// 访问权限由套接字文件的权限控制。
+package control
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// ErrInvalidArgument 表示请求参数无效
+var ErrInvalidArgument = errors.New("无效的请求参数")
+
+// Status 是GetStatus返回的同步状态
+type Status struct {
+	// Now 是经NTP调整后的当前时间
+	Now time.Time `json:"now"`
+
+	// Offset 是当前的时间偏移量
+	Offset time.Duration `json:"offset"`
+
+	// Periodic 是定时同步的状态
+	Periodic ntpsync.PeriodicSyncStatus `json:"periodic"`
+
+	// Servers 是已配置的服务器列表
+	Servers []string `json:"servers"`
+
+	// ServerStatuses 是多服务器模式下缓存的服务器状态
+	ServerStatuses []ntpsync.ServerStatus `json:"server_statuses,omitempty"`
+}
+
+// ForceSyncResponse 是ForceSync的返回结果
+type ForceSyncResponse struct {
+	// Offset 是同步后的时间偏移量
+	Offset time.Duration `json:"offset"`
+
+	// LastSync 是最后一次成功同步的时间
+	LastSync time.Time `json:"last_sync"`
+}
+
+// Service 实现Control服务
+type Service struct {
+	ntp *ntpsync.NTPSync
+}
+
+// NewService 创建一个控制给定同步客户端的服务
+func NewService(n *ntpsync.NTPSync) *Service {
+	return &Service{ntp: n}
+}
+
+// GetStatus 返回当前的同步状态
+func (s *Service) GetStatus(ctx context.Context) (*Status, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Now:      s.ntp.Now(),
+		Offset:   s.ntp.TimeOffsetDuration(),
+		Periodic: s.ntp.GetPeriodicSyncStatus(),
+		Servers:  s.ntp.GetServers(),
+	}
+
+	if statuses, err := s.ntp.GetCachedServerStatuses(); err == nil {
+		status.ServerStatuses = statuses
+	}
+
+	return status, nil
+}
+
+// ForceSync 立即执行一次同步
+func (s *Service) ForceSync(ctx context.Context) (*ForceSyncResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.ntp.ForceSyncNow(); err != nil {
+		return nil, err
+	}
+
+	return &ForceSyncResponse{
+		Offset:   s.ntp.TimeOffsetDuration(),
+		LastSync: s.ntp.LastSyncTime(),
+	}, nil
+}
+
+// AddServer 添加NTP服务器，返回更新后的服务器列表
+func (s *Service) AddServer(ctx context.Context, address string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	s.ntp.AddServer(address)
+	return s.ntp.GetServers(), nil
+}
+
+// RemoveServer 移除NTP服务器，返回是否移除以及更新后的服务器列表
+func (s *Service) RemoveServer(ctx context.Context, address string) (bool, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return false, nil, err
+	}
+
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return false, nil, ErrInvalidArgument
+	}
+
+	removed := s.ntp.RemoveServer(address)
+	return removed, s.ntp.GetServers(), nil
+}
+
+// SetInterval 修改定时同步的间隔，返回生效后的间隔
+func (s *Service) SetInterval(ctx context.Context, interval time.Duration) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if interval <= 0 {
+		return 0, ErrInvalidArgument
+	}
+
+	s.ntp.SetPeriodicSyncInterval(interval)
+	return s.ntp.GetPeriodicSyncInterval(), nil
+}
+
+// GetAllanDeviation 返回按同步历史中来自address的偏移量计算的Allan偏差
+func (s *Service) GetAllanDeviation(ctx context.Context, address string) ([]ntpsync.AllanPoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return nil, ErrInvalidArgument
+	}
+
+	return s.ntp.GetAllanDeviation(address), nil
+}
+
+// Reload 重新加载创建实例时使用的配置文件并应用到当前实例
+func (s *Service) Reload(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.ntp.Reload()
+}
+
+// StreamEvents 将同步事件逐个传给send，直到ctx被取消或send返回错误
+func (s *Service) StreamEvents(ctx context.Context, send func(ntpsync.Event) error) error {
+	events, cancel := s.ntp.Subscribe(0)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-events:
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
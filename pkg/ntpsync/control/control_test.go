@@ -0,0 +1,120 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntpsynctest"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// newTestService 创建用于测试的服务，使用本地测试服务器，测试结束时关闭实例和服务器
+func newTestService(t *testing.T) (*Service, *ntpsync.NTPSync) {
+	t.Helper()
+
+	srv := ntptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	ntp := ntpsynctest.NewClient(t, srv)
+	return NewService(ntp), ntp
+}
+
+// TestServerManagement 测试通过服务添加和移除服务器
+func TestServerManagement(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	servers, err := svc.AddServer(ctx, "time.google.com")
+	if err != nil {
+		t.Fatalf("添加服务器失败: %v", err)
+	}
+	if len(servers) != 2 {
+		t.Errorf("预期2个服务器，实际得到%d个", len(servers))
+	}
+
+	if _, err := svc.AddServer(ctx, "  "); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("预期空地址返回ErrInvalidArgument，实际得到%v", err)
+	}
+
+	removed, servers, err := svc.RemoveServer(ctx, "time.google.com")
+	if err != nil {
+		t.Fatalf("移除服务器失败: %v", err)
+	}
+	if !removed || len(servers) != 1 {
+		t.Errorf("预期移除成功且剩余1个服务器，实际得到%v和%d个", removed, len(servers))
+	}
+}
+
+// TestSetIntervalAndStatus 测试修改间隔和查询状态
+func TestSetIntervalAndStatus(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	interval, err := svc.SetInterval(ctx, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("修改间隔失败: %v", err)
+	}
+	if interval != 10*time.Minute {
+		t.Errorf("预期间隔为10分钟，实际得到%v", interval)
+	}
+
+	if _, err := svc.SetInterval(ctx, 0); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("预期零间隔返回ErrInvalidArgument，实际得到%v", err)
+	}
+
+	status, err := svc.GetStatus(ctx)
+	if err != nil {
+		t.Fatalf("查询状态失败: %v", err)
+	}
+	if status.Periodic.Interval != 10*time.Minute {
+		t.Errorf("预期状态中的间隔为10分钟，实际得到%v", status.Periodic.Interval)
+	}
+	if len(status.Servers) != 1 {
+		t.Errorf("预期1个服务器，实际得到%d个", len(status.Servers))
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := svc.GetStatus(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("预期已取消的上下文返回context.Canceled，实际得到%v", err)
+	}
+}
+
+// TestStreamEvents 测试事件流
+func TestStreamEvents(t *testing.T) {
+	svc, ntp := newTestService(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	received := make(chan ntpsync.Event, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.StreamEvents(ctx, func(e ntpsync.Event) error {
+			received <- e
+			return errors.New("停止")
+		})
+	}()
+
+	// 等待订阅生效后触发事件
+	deadline := time.After(time.Second)
+	for {
+		ntp.SetPeriodicSyncInterval(2 * time.Minute)
+		select {
+		case e := <-received:
+			if e.Type != ntpsync.EventIntervalChanged || e.Interval != 2*time.Minute {
+				t.Errorf("收到意外的事件: %+v", e)
+			}
+			if err := <-done; err == nil || err.Error() != "停止" {
+				t.Errorf("预期send的错误被返回，实际得到%v", err)
+			}
+			return
+		case <-deadline:
+			t.Fatal("等待事件超时")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
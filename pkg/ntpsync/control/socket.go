@@ -0,0 +1,406 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// DefaultSocketPath 是控制套接字的默认路径
+const DefaultSocketPath = "/run/ntpsync/ntpsync.sock"
+
+// 控制协议的方法名称，与Service的方法同名
+const (
+	MethodGetStatus         = "GetStatus"
+	MethodForceSync         = "ForceSync"
+	MethodAddServer         = "AddServer"
+	MethodRemoveServer      = "RemoveServer"
+	MethodSetInterval       = "SetInterval"
+	MethodGetAllanDeviation = "GetAllanDeviation"
+	MethodReload            = "Reload"
+	MethodStreamEvents      = "StreamEvents"
+)
+
+// codeInvalidArgument 是ErrInvalidArgument在应答中的错误代码
+const codeInvalidArgument = "invalid_argument"
+
+// maxRequestSize 是一行请求的长度上限
+const maxRequestSize = 64 << 10
+
+// request 是控制套接字上的一行请求
+type request struct {
+	// Method 是调用的方法，参见Method*常量
+	Method string `json:"method"`
+
+	// Address 是AddServer、RemoveServer和GetAllanDeviation的服务器地址
+	Address string `json:"address,omitempty"`
+
+	// Interval 是SetInterval的新间隔，格式与time.ParseDuration相同，例如"10m"
+	Interval string `json:"interval,omitempty"`
+}
+
+// response 是控制套接字上的一行应答，Error非空时表示调用失败
+type response struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Code   string          `json:"code,omitempty"`
+}
+
+// serverList 是AddServer和RemoveServer的结果
+type serverList struct {
+	Removed *bool    `json:"removed,omitempty"`
+	Servers []string `json:"servers"`
+}
+
+// intervalResult 是SetInterval的结果
+type intervalResult struct {
+	Interval string `json:"interval"`
+}
+
+// Listen 在path上创建控制套接字，只有所有者和同组用户可以连接
+// 已经存在但无人监听的旧套接字会被删除，仍有进程监听时返回错误
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("创建控制套接字目录失败: %w", err)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s 已存在且不是套接字", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("控制套接字 %s 正在被其它进程使用", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("删除旧的控制套接字失败: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("监听控制套接字失败: %w", err)
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("设置控制套接字权限失败: %w", err)
+	}
+	return l, nil
+}
+
+// ListenAndServe 在path上创建控制套接字并处理请求，直到ctx被取消
+func (s *Service) ListenAndServe(ctx context.Context, path string) error {
+	l, err := Listen(path)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve 接受l上的连接并处理请求，直到ctx被取消，返回时关闭l
+// 每个连接上可以依次发送多个请求，每行一个JSON对象，应答同样每行一个；
+// StreamEvents之后连接上只会收到事件，直到客户端断开
+func (s *Service) Serve(ctx context.Context, l net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("接受控制连接失败: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// serveConn 处理一个控制连接上的请求
+func (s *Service) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	// ctx被取消时关闭连接，使阻塞的读取返回
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxRequestSize)
+	encoder := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			_ = encoder.Encode(errorResponse(fmt.Errorf("%w: %v", ErrInvalidArgument, err)))
+			continue
+		}
+
+		if req.Method == MethodStreamEvents {
+			// 客户端断开时读取返回，取消事件流
+			streamCtx, cancel := context.WithCancel(ctx)
+			go func() {
+				for scanner.Scan() {
+				}
+				cancel()
+			}()
+			_ = s.StreamEvents(streamCtx, func(e ntpsync.Event) error {
+				return encoder.Encode(resultResponse(e))
+			})
+			cancel()
+			return
+		}
+
+		if err := encoder.Encode(s.dispatch(ctx, req)); err != nil {
+			return
+		}
+	}
+}
+
+// dispatch 调用请求的方法并返回应答
+func (s *Service) dispatch(ctx context.Context, req request) response {
+	switch req.Method {
+	case MethodGetStatus:
+		status, err := s.GetStatus(ctx)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return resultResponse(status)
+	case MethodForceSync:
+		result, err := s.ForceSync(ctx)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return resultResponse(result)
+	case MethodAddServer:
+		servers, err := s.AddServer(ctx, req.Address)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return resultResponse(serverList{Servers: servers})
+	case MethodRemoveServer:
+		removed, servers, err := s.RemoveServer(ctx, req.Address)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return resultResponse(serverList{Removed: &removed, Servers: servers})
+	case MethodSetInterval:
+		interval, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			return errorResponse(fmt.Errorf("%w: %v", ErrInvalidArgument, err))
+		}
+		interval, err = s.SetInterval(ctx, interval)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return resultResponse(intervalResult{Interval: interval.String()})
+	case MethodGetAllanDeviation:
+		points, err := s.GetAllanDeviation(ctx, req.Address)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return resultResponse(points)
+	case MethodReload:
+		if err := s.Reload(ctx); err != nil {
+			return errorResponse(err)
+		}
+		return resultResponse(struct{}{})
+	default:
+		return errorResponse(fmt.Errorf("%w: 未知的方法 %q", ErrInvalidArgument, req.Method))
+	}
+}
+
+// resultResponse 返回包含结果的应答
+func resultResponse(v any) response {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errorResponse(fmt.Errorf("编码结果失败: %v", err))
+	}
+	return response{Result: data}
+}
+
+// errorResponse 返回表示错误的应答
+func errorResponse(err error) response {
+	resp := response{Error: err.Error()}
+	if errors.Is(err, ErrInvalidArgument) {
+		resp.Code = codeInvalidArgument
+	}
+	return resp
+}
+
+// Client 通过控制套接字调用正在运行的Service，每次调用使用一个新的连接
+type Client struct {
+	path string
+}
+
+// NewClient 创建连接path上控制套接字的客户端，path为空时使用DefaultSocketPath
+func NewClient(path string) *Client {
+	if path == "" {
+		path = DefaultSocketPath
+	}
+	return &Client{path: path}
+}
+
+// dial 连接控制套接字并发送请求
+func (c *Client) dial(ctx context.Context, req request) (net.Conn, *bufio.Reader, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("连接控制套接字失败: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+	return conn, bufio.NewReader(conn), nil
+}
+
+// readResponse 读取一行应答，将结果解码到result
+func readResponse(reader *bufio.Reader, result any) error {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("读取应答失败: %w", err)
+	}
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return fmt.Errorf("无效的应答: %w", err)
+	}
+	if resp.Error != "" {
+		if resp.Code == codeInvalidArgument {
+			return fmt.Errorf("%w: %s", ErrInvalidArgument, resp.Error)
+		}
+		return errors.New(resp.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// call 发送一个请求并等待应答
+func (c *Client) call(ctx context.Context, req request, result any) error {
+	conn, reader, err := c.dial(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := readResponse(reader, result); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// GetStatus 返回当前的同步状态
+func (c *Client) GetStatus(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.call(ctx, request{Method: MethodGetStatus}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ForceSync 立即执行一次同步
+func (c *Client) ForceSync(ctx context.Context) (*ForceSyncResponse, error) {
+	var result ForceSyncResponse
+	if err := c.call(ctx, request{Method: MethodForceSync}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AddServer 添加NTP服务器，返回更新后的服务器列表
+func (c *Client) AddServer(ctx context.Context, address string) ([]string, error) {
+	var result serverList
+	if err := c.call(ctx, request{Method: MethodAddServer, Address: address}, &result); err != nil {
+		return nil, err
+	}
+	return result.Servers, nil
+}
+
+// RemoveServer 移除NTP服务器，返回是否移除以及更新后的服务器列表
+func (c *Client) RemoveServer(ctx context.Context, address string) (bool, []string, error) {
+	var result serverList
+	if err := c.call(ctx, request{Method: MethodRemoveServer, Address: address}, &result); err != nil {
+		return false, nil, err
+	}
+	return result.Removed != nil && *result.Removed, result.Servers, nil
+}
+
+// SetInterval 修改定时同步的间隔，返回生效后的间隔
+func (c *Client) SetInterval(ctx context.Context, interval time.Duration) (time.Duration, error) {
+	var result intervalResult
+	if err := c.call(ctx, request{Method: MethodSetInterval, Interval: interval.String()}, &result); err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(result.Interval)
+}
+
+// GetAllanDeviation 返回按同步历史中来自address的偏移量计算的Allan偏差
+func (c *Client) GetAllanDeviation(ctx context.Context, address string) ([]ntpsync.AllanPoint, error) {
+	var points []ntpsync.AllanPoint
+	if err := c.call(ctx, request{Method: MethodGetAllanDeviation, Address: address}, &points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// Reload 让服务重新加载配置文件
+func (c *Client) Reload(ctx context.Context) error {
+	return c.call(ctx, request{Method: MethodReload}, nil)
+}
+
+// StreamEvents 将同步事件逐个传给handle，直到ctx被取消、连接断开或handle返回错误
+func (c *Client) StreamEvents(ctx context.Context, handle func(ntpsync.Event) error) error {
+	conn, reader, err := c.dial(ctx, request{Method: MethodStreamEvents})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var event ntpsync.Event
+		if err := readResponse(reader, &event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
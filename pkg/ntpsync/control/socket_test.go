@@ -0,0 +1,164 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// serveSocket 在临时目录的控制套接字上运行svc，返回连接它的客户端
+func serveSocket(t *testing.T, svc *Service) *Client {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ntpsync.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatalf("创建控制套接字失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- svc.Serve(ctx, l) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("预期Serve返回context.Canceled，实际得到%v", err)
+		}
+	})
+	return NewClient(path)
+}
+
+// TestSocketControl 测试通过控制套接字查询和修改配置
+func TestSocketControl(t *testing.T) {
+	svc, _ := newTestService(t)
+	client := serveSocket(t, svc)
+	ctx := context.Background()
+
+	servers, err := client.AddServer(ctx, "time.google.com")
+	if err != nil || len(servers) != 2 {
+		t.Fatalf("预期添加后有2个服务器，实际得到%v, %v", servers, err)
+	}
+	removed, servers, err := client.RemoveServer(ctx, "time.google.com")
+	if err != nil || !removed || len(servers) != 1 {
+		t.Errorf("预期移除成功且剩余1个服务器，实际得到%v, %v, %v", removed, servers, err)
+	}
+	if removed, _, err := client.RemoveServer(ctx, "missing.example.com"); err != nil || removed {
+		t.Errorf("预期移除不存在的服务器返回false，实际得到%v, %v", removed, err)
+	}
+	if _, err := client.AddServer(ctx, " "); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("预期空地址返回ErrInvalidArgument，实际得到%v", err)
+	}
+
+	interval, err := client.SetInterval(ctx, 10*time.Minute)
+	if err != nil || interval != 10*time.Minute {
+		t.Errorf("预期间隔为10分钟，实际得到%v, %v", interval, err)
+	}
+	if _, err := client.SetInterval(ctx, -time.Minute); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("预期负的间隔返回ErrInvalidArgument，实际得到%v", err)
+	}
+
+	status, err := client.GetStatus(ctx)
+	if err != nil {
+		t.Fatalf("查询状态失败: %v", err)
+	}
+	if status.Periodic.Interval != 10*time.Minute || len(status.Servers) != 1 {
+		t.Errorf("状态错误: %+v", status)
+	}
+
+	if points, err := client.GetAllanDeviation(ctx, "time.google.com"); err != nil || len(points) != 0 {
+		t.Errorf("预期没有同步历史时Allan偏差为空，实际得到%v, %v", points, err)
+	}
+	if _, err := client.GetAllanDeviation(ctx, ""); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("预期空地址返回ErrInvalidArgument，实际得到%v", err)
+	}
+
+	if err := client.Reload(ctx); err == nil {
+		t.Error("预期不是通过配置文件创建的实例无法重新加载")
+	}
+	if err := client.call(ctx, request{Method: "Shutdown"}, nil); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("预期未知的方法返回ErrInvalidArgument，实际得到%v", err)
+	}
+}
+
+// TestSocketForceSyncAndEvents 测试强制同步和事件流
+func TestSocketForceSyncAndEvents(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetOffset(time.Second)
+
+	ntp, err := ntpsync.New(ntpsync.Options{Servers: []string{srv.Addr()}, MinPollInterval: -1})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	client := serveSocket(t, NewService(ntp))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	events := make(chan ntpsync.Event, 16)
+	streamDone := make(chan error, 1)
+	go func() {
+		streamDone <- client.StreamEvents(ctx, func(e ntpsync.Event) error {
+			events <- e
+			if e.Type == ntpsync.EventSyncSucceeded {
+				return errors.New("停止")
+			}
+			return nil
+		})
+	}()
+
+	// 事件流建立之前的同步不会被看到，重复同步直到收到事件
+	for {
+		result, err := client.ForceSync(ctx)
+		if err != nil {
+			t.Fatalf("强制同步失败: %v", err)
+		}
+		if result.Offset < 900*time.Millisecond || result.Offset > 1100*time.Millisecond {
+			t.Errorf("预期偏移量约为1秒，实际得到%v", result.Offset)
+		}
+
+		select {
+		case e := <-events:
+			if e.Type != ntpsync.EventSyncSucceeded || e.Server != srv.Addr() {
+				t.Errorf("收到意外的事件: %+v", e)
+			}
+			if err := <-streamDone; err == nil || err.Error() != "停止" {
+				t.Errorf("预期handle的错误被返回，实际得到%v", err)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("等待事件超时")
+		}
+	}
+}
+
+// TestListenStaleSocket 测试删除无人监听的旧套接字，拒绝正在使用的套接字
+func TestListenStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ntpsync.sock")
+
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatalf("创建控制套接字失败: %v", err)
+	}
+	if _, err := Listen(path); err == nil {
+		t.Error("预期正在使用的套接字返回错误")
+	}
+
+	// 模拟进程崩溃后留下的套接字文件
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = Listen(path)
+	if err != nil {
+		t.Fatalf("预期删除旧的套接字，实际得到%v", err)
+	}
+	l.Close()
+}
@@ -0,0 +1,58 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTimeDaemonConflict 表示其它时间同步守护进程正在调整系统时钟
+var ErrTimeDaemonConflict = errors.New("其它时间同步守护进程正在运行")
+
+// TimeDaemon 是检测到的正在运行的时间同步守护进程
+type TimeDaemon struct {
+	// Name 是守护进程的名称，例如"chronyd"、"ntpd"、"systemd-timesyncd"或"w32time"；
+	// 只发现内核时钟处于同步状态而不知道是哪个程序时为"unknown"
+	Name string `json:"name"`
+
+	// Evidence 说明检测的依据，例如进程ID、控制套接字的路径或服务状态
+	Evidence string `json:"evidence"`
+}
+
+// String 返回名称和检测依据
+func (d TimeDaemon) String() string {
+	return fmt.Sprintf("%s（%s）", d.Name, d.Evidence)
+}
+
+// DetectTimeDaemons 检测正在调整系统时钟的其它时间同步守护进程，两个程序同时调整系统时钟会使时间来回振荡
+// Linux检查进程列表、chronyd和ntpd的控制套接字与PID文件，以及adjtimex报告的内核时钟同步状态；
+// Windows查询Windows Time服务的状态；其它平台返回nil
+func DetectTimeDaemons() []TimeDaemon {
+	return detectTimeDaemons()
+}
+
+// detectTimeDaemons 是实际的检测函数，测试中可以替换
+var detectTimeDaemons = systemTimeDaemons
+
+// checkTimeDaemons 在设置系统时间之前检测其它时间同步守护进程
+// 设置了OnTimeDaemonConflict时通知，设置了RefuseOnTimeDaemonConflict时返回包装ErrTimeDaemonConflict的错误
+func (n *NTPSync) checkTimeDaemons() error {
+	if n.onTimeDaemonConflict == nil && !n.refuseOnTimeDaemonConflict {
+		return nil
+	}
+	daemons := detectTimeDaemons()
+	if len(daemons) == 0 {
+		return nil
+	}
+	if n.onTimeDaemonConflict != nil {
+		n.onTimeDaemonConflict(daemons)
+	}
+	if !n.refuseOnTimeDaemonConflict {
+		return nil
+	}
+	found := make([]string, len(daemons))
+	for i, d := range daemons {
+		found[i] = d.String()
+	}
+	return fmt.Errorf("%w: %s", ErrTimeDaemonConflict, strings.Join(found, "、"))
+}
@@ -0,0 +1,116 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// staUnsync 是adjtimex状态中表示内核时钟未同步的标志
+const staUnsync = 0x0040
+
+// timeDaemonProcesses 将/proc/<pid>/comm中的进程名（最多15个字符）映射为守护进程名称
+var timeDaemonProcesses = map[string]string{
+	"ntpd":            "ntpd",
+	"chronyd":         "chronyd",
+	"openntpd":        "openntpd",
+	"systemd-timesyn": "systemd-timesyncd",
+	"phc2sys":         "phc2sys",
+}
+
+// timeDaemonFile 是守护进程运行时存在的控制套接字或PID文件
+type timeDaemonFile struct {
+	name string
+	path string
+}
+
+// timeDaemonFiles 是常见的控制套接字和PID文件的位置
+var timeDaemonFiles = []timeDaemonFile{
+	{"chronyd", "/run/chrony/chronyd.sock"},
+	{"chronyd", "/var/run/chrony/chronyd.sock"},
+	{"ntpd", "/run/ntpd.pid"},
+	{"ntpd", "/var/run/ntpd.pid"},
+	{"openntpd", "/var/run/ntpd.sock"},
+}
+
+// systemTimeDaemons 依次检查进程列表和控制文件，都没有发现时再检查内核时钟的同步状态，
+// 因此在容器中也能发现宿主机上的守护进程
+func systemTimeDaemons() []TimeDaemon {
+	daemons := scanTimeDaemonProcesses("/proc", os.Getpid())
+	daemons = appendTimeDaemonFiles(daemons, "/proc", timeDaemonFiles)
+	if len(daemons) > 0 {
+		return daemons
+	}
+
+	var tx syscall.Timex
+	if _, err := syscall.Adjtimex(&tx); err == nil && tx.Status&staUnsync == 0 {
+		daemons = append(daemons, TimeDaemon{Name: "unknown", Evidence: "adjtimex报告内核时钟由其它程序同步"})
+	}
+	return daemons
+}
+
+// scanTimeDaemonProcesses 在procDir中查找时间同步守护进程，忽略自身进程self
+func scanTimeDaemonProcesses(procDir string, self int) []TimeDaemon {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil
+	}
+
+	var daemons []TimeDaemon
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		name, ok := timeDaemonProcesses[strings.TrimSpace(string(comm))]
+		if ok && !seen[name] {
+			seen[name] = true
+			daemons = append(daemons, TimeDaemon{Name: name, Evidence: fmt.Sprintf("进程%d", pid)})
+		}
+	}
+	return daemons
+}
+
+// appendTimeDaemonFiles 追加控制套接字存在或PID文件指向的进程仍在运行的守护进程，已经发现的不重复
+func appendTimeDaemonFiles(daemons []TimeDaemon, procDir string, files []timeDaemonFile) []TimeDaemon {
+	seen := make(map[string]bool, len(daemons))
+	for _, d := range daemons {
+		seen[d.Name] = true
+	}
+	for _, file := range files {
+		if seen[file.name] {
+			continue
+		}
+		info, err := os.Stat(file.path)
+		if err != nil {
+			continue
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			// PID文件：进程已经退出时是遗留的文件
+			data, err := os.ReadFile(file.path)
+			if err != nil {
+				continue
+			}
+			pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+			if err != nil {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(procDir, strconv.Itoa(pid))); err != nil {
+				continue
+			}
+		}
+		seen[file.name] = true
+		daemons = append(daemons, TimeDaemon{Name: file.name, Evidence: file.path})
+	}
+	return daemons
+}
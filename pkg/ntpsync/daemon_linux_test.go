@@ -0,0 +1,80 @@
+package ntpsync
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestScanTimeDaemonProcesses 测试按进程名发现守护进程，忽略自身和重复的进程
+func TestScanTimeDaemonProcesses(t *testing.T) {
+	proc := t.TempDir()
+	for pid, comm := range map[string]string{
+		"1":    "systemd",
+		"77":   "chronyd",
+		"88":   "systemd-timesyn",
+		"99":   "ntpd",
+		"100":  "chronyd",
+		"self": "ntpd",
+	} {
+		if err := os.MkdirAll(filepath.Join(proc, pid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(proc, pid, "comm"), []byte(comm+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := scanTimeDaemonProcesses(proc, 99)
+	want := []TimeDaemon{
+		{Name: "chronyd", Evidence: "进程100"},
+		{Name: "systemd-timesyncd", Evidence: "进程88"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+}
+
+// TestAppendTimeDaemonFiles 测试控制套接字和仍在运行的进程的PID文件，忽略遗留的PID文件
+func TestAppendTimeDaemonFiles(t *testing.T) {
+	dir := t.TempDir()
+	proc := filepath.Join(dir, "proc")
+	if err := os.MkdirAll(filepath.Join(proc, "42"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(dir, "chronyd.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("无法创建unix套接字: %v", err)
+	}
+	defer listener.Close()
+
+	running := filepath.Join(dir, "ntpd.pid")
+	stale := filepath.Join(dir, "openntpd.pid")
+	if err := os.WriteFile(running, []byte("42\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("4242\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []timeDaemonFile{
+		{"chronyd", sock},
+		{"ntpd", running},
+		{"openntpd", stale},
+		{"phc2sys", filepath.Join(dir, "missing.pid")},
+		{"systemd-timesyncd", sock},
+	}
+	got := appendTimeDaemonFiles([]TimeDaemon{{Name: "systemd-timesyncd", Evidence: "进程88"}}, proc, files)
+	want := []TimeDaemon{
+		{Name: "systemd-timesyncd", Evidence: "进程88"},
+		{Name: "chronyd", Evidence: sock},
+		{Name: "ntpd", Evidence: running},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+}
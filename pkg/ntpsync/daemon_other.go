@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package ntpsync
+
+// systemTimeDaemons 在不支持检测的平台上返回nil
+func systemTimeDaemons() []TimeDaemon {
+	return nil
+}
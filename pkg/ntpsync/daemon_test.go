@@ -0,0 +1,46 @@
+package ntpsync
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestCheckTimeDaemons 测试发现其它时间同步守护进程时通知或拒绝设置系统时间
+func TestCheckTimeDaemons(t *testing.T) {
+	found := []TimeDaemon{{Name: "chronyd", Evidence: "进程812"}}
+	detect := detectTimeDaemons
+	detectTimeDaemons = func() []TimeDaemon { return found }
+	defer func() { detectTimeDaemons = detect }()
+
+	var notified []TimeDaemon
+	ntp, err := New(Options{
+		Servers:              []string{"127.0.0.1:1"},
+		OnTimeDaemonConflict: func(daemons []TimeDaemon) { notified = daemons },
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	// 只通知时不阻止设置
+	if err := ntp.checkTimeDaemons(); err != nil {
+		t.Errorf("预期只通知而不返回错误，实际得到%v", err)
+	}
+	if !slices.Equal(notified, found) {
+		t.Errorf("预期通知%v，实际得到%v", found, notified)
+	}
+
+	ntp.refuseOnTimeDaemonConflict = true
+	err = ntp.checkTimeDaemons()
+	if !errors.Is(err, ErrTimeDaemonConflict) || !strings.Contains(err.Error(), "chronyd") {
+		t.Errorf("预期返回包含chronyd的ErrTimeDaemonConflict，实际得到%v", err)
+	}
+
+	// 没有其它守护进程时不通知
+	found, notified = nil, nil
+	if err := ntp.checkTimeDaemons(); err != nil || notified != nil {
+		t.Errorf("预期没有冲突，实际得到%v，通知了%v", err, notified)
+	}
+}
@@ -0,0 +1,62 @@
+//go:build windows
+
+package ntpsync
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// 服务控制管理器的访问权限和服务状态
+const (
+	scManagerConnect   = 0x0001
+	serviceQueryStatus = 0x0004
+	serviceRunning     = 4
+)
+
+var (
+	advapi32               = syscall.NewLazyDLL("advapi32.dll")
+	procOpenSCManagerW     = advapi32.NewProc("OpenSCManagerW")
+	procOpenServiceW       = advapi32.NewProc("OpenServiceW")
+	procQueryServiceStatus = advapi32.NewProc("QueryServiceStatus")
+	procCloseServiceHandle = advapi32.NewProc("CloseServiceHandle")
+)
+
+// serviceStatus 对应SERVICE_STATUS结构
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// systemTimeDaemons 查询Windows Time服务（W32Time）是否正在运行
+func systemTimeDaemons() []TimeDaemon {
+	scm, _, _ := procOpenSCManagerW.Call(0, 0, scManagerConnect)
+	if scm == 0 {
+		return nil
+	}
+	defer procCloseServiceHandle.Call(scm)
+
+	name, err := syscall.UTF16PtrFromString("W32Time")
+	if err != nil {
+		return nil
+	}
+	svc, _, _ := procOpenServiceW.Call(scm, uintptr(unsafe.Pointer(name)), serviceQueryStatus)
+	if svc == 0 {
+		return nil
+	}
+	defer procCloseServiceHandle.Call(svc)
+
+	var status serviceStatus
+	if ok, _, _ := procQueryServiceStatus.Call(svc, uintptr(unsafe.Pointer(&status))); ok == 0 {
+		return nil
+	}
+	if status.CurrentState != serviceRunning {
+		return nil
+	}
+	return []TimeDaemon{{Name: "w32time", Evidence: "Windows Time服务正在运行"}}
+}
@@ -0,0 +1,287 @@
+package dbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSystemBusAddress 是没有设置DBUS_SYSTEM_BUS_ADDRESS时系统总线的地址
+const defaultSystemBusAddress = "unix:path=/run/dbus/system_bus_socket"
+
+// 消息总线自身的名称、路径和接口
+const (
+	busName      = "org.freedesktop.DBus"
+	busPath      = objectPath("/org/freedesktop/DBus")
+	busInterface = "org.freedesktop.DBus"
+)
+
+// RequestName的标志和返回值
+const (
+	nameFlagDoNotQueue = 0x4
+
+	nameReplyPrimaryOwner = 1
+	nameReplyAlreadyOwner = 4
+)
+
+// errConnectionLost 表示与消息总线的连接已断开
+var errConnectionLost = errors.New("与D-Bus消息总线的连接已断开")
+
+// SystemBusAddress 返回系统总线的地址，优先使用环境变量DBUS_SYSTEM_BUS_ADDRESS
+func SystemBusAddress() string {
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	return defaultSystemBusAddress
+}
+
+// parseAddress 解析D-Bus地址，返回可以连接的unix套接字地址列表
+// 支持unix:path=和unix:abstract=，多个地址以分号分隔
+func parseAddress(address string) ([]string, error) {
+	var sockets []string
+	for _, entry := range strings.Split(address, ";") {
+		if entry == "" {
+			continue
+		}
+		transport, params, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("无效的D-Bus地址 %q", entry)
+		}
+		if transport != "unix" {
+			continue
+		}
+		for _, param := range strings.Split(params, ",") {
+			key, value, _ := strings.Cut(param, "=")
+			value, err := url.PathUnescape(value)
+			if err != nil {
+				return nil, fmt.Errorf("无效的D-Bus地址 %q: %v", entry, err)
+			}
+			switch key {
+			case "path":
+				sockets = append(sockets, value)
+			case "abstract":
+				sockets = append(sockets, "@"+value)
+			}
+		}
+	}
+	if len(sockets) == 0 {
+		return nil, fmt.Errorf("D-Bus地址 %q 中没有支持的unix套接字", address)
+	}
+	return sockets, nil
+}
+
+// conn 是一个与消息总线的连接
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMutex sync.Mutex
+	serial     uint32
+
+	mutex sync.Mutex
+	err   error
+
+	uniqueName string
+	incoming   chan *message
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// dial 连接消息总线，完成认证并请求拥有名称name
+func dial(ctx context.Context, address, name string) (*conn, error) {
+	sockets, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	var nc net.Conn
+	for _, socket := range sockets {
+		if nc, err = dialer.DialContext(ctx, "unix", socket); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接D-Bus消息总线失败: %v", err)
+	}
+
+	c := &conn{
+		conn:     nc,
+		reader:   bufio.NewReader(nc),
+		incoming: make(chan *message, 16),
+		done:     make(chan struct{}),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = nc.SetDeadline(deadline)
+	}
+	if err := c.authenticate(); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	reply, err := c.callSync(busName, busPath, busInterface, "Hello", "")
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	if len(reply.body) == 1 {
+		c.uniqueName, _ = reply.body[0].(string)
+	}
+	if err := c.requestName(name); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	_ = nc.SetDeadline(time.Time{})
+
+	c.wg.Add(1)
+	go c.read()
+	return c, nil
+}
+
+// authenticate 使用EXTERNAL机制以当前用户ID认证
+func (c *conn) authenticate() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := c.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return fmt.Errorf("发送D-Bus认证请求失败: %v", err)
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("读取D-Bus认证应答失败: %v", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("D-Bus消息总线拒绝认证: %s", line)
+	}
+	if _, err := c.conn.Write([]byte("BEGIN\r\n")); err != nil {
+		return fmt.Errorf("发送D-Bus认证请求失败: %v", err)
+	}
+	return nil
+}
+
+// callSync 在启动读取循环之前调用消息总线的方法并等待应答，忽略期间收到的信号
+func (c *conn) callSync(dest string, path objectPath, iface, member, sig string, body ...any) (*message, error) {
+	serial, err := c.send(&message{
+		kind:        typeMethodCall,
+		path:        path,
+		iface:       iface,
+		member:      member,
+		destination: dest,
+		signature:   sig,
+		body:        body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		m, err := readMessage(c.reader)
+		if err != nil {
+			return nil, fmt.Errorf("读取%s的应答失败: %v", member, err)
+		}
+		if m.replySerial != serial {
+			continue
+		}
+		if m.kind == typeError {
+			return nil, fmt.Errorf("调用%s失败: %s", member, errorText(m))
+		}
+		return m, nil
+	}
+}
+
+// requestName 请求拥有名称name，名称已被其它连接拥有时返回错误
+func (c *conn) requestName(name string) error {
+	reply, err := c.callSync(busName, busPath, busInterface, "RequestName", "su", name, uint32(nameFlagDoNotQueue))
+	if err != nil {
+		return err
+	}
+	if len(reply.body) == 1 {
+		if code, _ := reply.body[0].(uint32); code == nameReplyPrimaryOwner || code == nameReplyAlreadyOwner {
+			return nil
+		}
+	}
+	return fmt.Errorf("名称%s已被其它程序占用", name)
+}
+
+// read 读取消息总线发来的消息并交给incoming
+func (c *conn) read() {
+	defer c.wg.Done()
+
+	for {
+		m, err := readMessage(c.reader)
+		if err != nil {
+			c.fail(fmt.Errorf("%w: %v", errConnectionLost, err))
+			return
+		}
+		select {
+		case c.incoming <- m:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send 分配序号并发送一条消息，返回消息的序号
+func (c *conn) send(m *message) (uint32, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.serial++
+	if c.serial == 0 {
+		c.serial = 1
+	}
+	m.serial = c.serial
+	b, err := encodeMessage(m)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		err = fmt.Errorf("%w: %v", errConnectionLost, err)
+		c.fail(err)
+		return 0, err
+	}
+	return m.serial, nil
+}
+
+// fail 记录第一个连接错误并关闭连接
+func (c *conn) fail(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	c.conn.Close()
+}
+
+// closeErr 返回导致连接断开的错误
+func (c *conn) closeErr() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.err
+}
+
+// close 关闭连接并等待读取循环退出
+func (c *conn) close() {
+	c.fail(errConnectionLost)
+	c.wg.Wait()
+}
+
+// errorText 返回错误应答的名称和说明
+func errorText(m *message) string {
+	if len(m.body) > 0 {
+		if text, ok := m.body[0].(string); ok {
+			return m.errorName + ": " + text
+		}
+	}
+	return m.errorName
+}
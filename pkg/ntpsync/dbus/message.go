@@ -0,0 +1,617 @@
+package dbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// 消息类型
+const (
+	typeMethodCall   = 1
+	typeMethodReturn = 2
+	typeError        = 3
+	typeSignal       = 4
+)
+
+// flagNoReplyExpected 表示调用者不需要应答
+const flagNoReplyExpected = 0x1
+
+// 消息头部字段的编号
+const (
+	fieldPath        = 1
+	fieldInterface   = 2
+	fieldMember      = 3
+	fieldErrorName   = 4
+	fieldReplySerial = 5
+	fieldDestination = 6
+	fieldSender      = 7
+	fieldSignature   = 8
+)
+
+// maxMessageSize 是接受的消息大小上限，本包只处理很小的消息
+const maxMessageSize = 1 << 20
+
+// objectPath 是类型为o的对象路径
+type objectPath string
+
+// signature 是类型为g的类型签名
+type signature string
+
+// variant 是类型为v的值，sig是value的类型签名
+type variant struct {
+	sig   string
+	value any
+}
+
+// message 是一条D-Bus消息
+// body中的值与类型签名的对应关系为：y为byte，b为bool，n为int16，q为uint16，
+// i为int32，u为uint32，x为int64，t为uint64，d为float64，s为string，
+// o为objectPath，g为signature，v为variant，ay为[]byte，其它数组、结构和字典项为[]any
+type message struct {
+	kind        byte
+	flags       byte
+	serial      uint32
+	path        objectPath
+	iface       string
+	member      string
+	errorName   string
+	replySerial uint32
+	destination string
+	sender      string
+	signature   string
+	body        []any
+}
+
+// nextType 从类型签名中分离出第一个完整的类型
+func nextType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", errors.New("类型签名不完整")
+	}
+	switch sig[0] {
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 's', 'o', 'g', 'v':
+		return sig[:1], sig[1:], nil
+	case 'a':
+		elem, rest, err := nextType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '(', '{':
+		end := byte(')')
+		if sig[0] == '{' {
+			end = '}'
+		}
+		rest := sig[1:]
+		for {
+			if rest == "" {
+				return "", "", fmt.Errorf("类型签名%q缺少%c", sig, end)
+			}
+			if rest[0] == end {
+				n := len(sig) - len(rest) + 1
+				return sig[:n], sig[n:], nil
+			}
+			var err error
+			if _, rest, err = nextType(rest); err != nil {
+				return "", "", err
+			}
+		}
+	default:
+		return "", "", fmt.Errorf("不支持的类型%q", sig[0])
+	}
+}
+
+// splitTypes 将类型签名分离为完整类型的列表
+func splitTypes(sig string) ([]string, error) {
+	var types []string
+	for sig != "" {
+		t, rest, err := nextType(sig)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+		sig = rest
+	}
+	return types, nil
+}
+
+// alignment 返回类型的对齐字节数
+func alignment(sig string) int {
+	switch sig[0] {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	default:
+		return 1
+	}
+}
+
+// encoder 以小端字节序编码值
+type encoder struct {
+	buf []byte
+}
+
+// align 填充零字节直到长度是n的倍数
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// uint32 编码一个对齐的uint32
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+// str 编码字符串，sig为s或o时长度为uint32，为g时长度为一个字节
+func (e *encoder) str(sig byte, s string) error {
+	if sig == 'g' {
+		if len(s) > 255 {
+			return fmt.Errorf("类型签名%q过长", s)
+		}
+		e.buf = append(e.buf, byte(len(s)))
+	} else {
+		e.uint32(uint32(len(s)))
+	}
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+	return nil
+}
+
+// value 按类型签名sig编码一个值
+func (e *encoder) value(sig string, v any) error {
+	e.align(alignment(sig))
+	mismatch := fmt.Errorf("类型%s的值%T无效", sig, v)
+
+	switch sig[0] {
+	case 'y':
+		b, ok := v.(byte)
+		if !ok {
+			return mismatch
+		}
+		e.buf = append(e.buf, b)
+	case 'b':
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch
+		}
+		var n uint32
+		if b {
+			n = 1
+		}
+		e.uint32(n)
+	case 'n':
+		n, ok := v.(int16)
+		if !ok {
+			return mismatch
+		}
+		e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(n))
+	case 'q':
+		n, ok := v.(uint16)
+		if !ok {
+			return mismatch
+		}
+		e.buf = binary.LittleEndian.AppendUint16(e.buf, n)
+	case 'i':
+		n, ok := v.(int32)
+		if !ok {
+			return mismatch
+		}
+		e.uint32(uint32(n))
+	case 'u':
+		n, ok := v.(uint32)
+		if !ok {
+			return mismatch
+		}
+		e.uint32(n)
+	case 'x':
+		n, ok := v.(int64)
+		if !ok {
+			return mismatch
+		}
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(n))
+	case 't':
+		n, ok := v.(uint64)
+		if !ok {
+			return mismatch
+		}
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, n)
+	case 'd':
+		f, ok := v.(float64)
+		if !ok {
+			return mismatch
+		}
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+	case 's':
+		s, ok := v.(string)
+		if !ok {
+			return mismatch
+		}
+		return e.str('s', s)
+	case 'o':
+		s, ok := v.(objectPath)
+		if !ok {
+			return mismatch
+		}
+		return e.str('o', string(s))
+	case 'g':
+		s, ok := v.(signature)
+		if !ok {
+			return mismatch
+		}
+		return e.str('g', string(s))
+	case 'v':
+		vv, ok := v.(variant)
+		if !ok {
+			return mismatch
+		}
+		if t, rest, err := nextType(vv.sig); err != nil || rest != "" || t != vv.sig {
+			return fmt.Errorf("变体的类型签名%q无效", vv.sig)
+		}
+		if err := e.str('g', vv.sig); err != nil {
+			return err
+		}
+		return e.value(vv.sig, vv.value)
+	case 'a':
+		elem := sig[1:]
+		start := len(e.buf)
+		e.uint32(0)
+		e.align(alignment(elem))
+		first := len(e.buf)
+		if elem == "y" {
+			b, ok := v.([]byte)
+			if !ok {
+				return mismatch
+			}
+			e.buf = append(e.buf, b...)
+		} else {
+			items, ok := v.([]any)
+			if !ok {
+				return mismatch
+			}
+			for _, item := range items {
+				if err := e.value(elem, item); err != nil {
+					return err
+				}
+			}
+		}
+		binary.LittleEndian.PutUint32(e.buf[start:], uint32(len(e.buf)-first))
+	case '(', '{':
+		fields, ok := v.([]any)
+		if !ok {
+			return mismatch
+		}
+		types, err := splitTypes(sig[1 : len(sig)-1])
+		if err != nil {
+			return err
+		}
+		if len(fields) != len(types) {
+			return fmt.Errorf("类型%s需要%d个字段，实际有%d个", sig, len(types), len(fields))
+		}
+		for i, t := range types {
+			if err := e.value(t, fields[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decoder 解码消息中的值，offset是已读取的字节数，用于计算对齐
+type decoder struct {
+	data   []byte
+	offset int
+	order  binary.ByteOrder
+	depth  int
+}
+
+// errTruncated 表示消息内容不完整
+var errTruncated = errors.New("D-Bus消息不完整")
+
+// align 跳过填充字节
+func (d *decoder) align(n int) error {
+	pad := (n - d.offset%n) % n
+	if pad > len(d.data)-d.offset {
+		return errTruncated
+	}
+	d.offset += pad
+	return nil
+}
+
+// take 读取n个字节
+func (d *decoder) take(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.offset {
+		return nil, errTruncated
+	}
+	b := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return b, nil
+}
+
+// str 读取字符串，sig为g时长度为一个字节
+func (d *decoder) str(sig byte) (string, error) {
+	var n int
+	if sig == 'g' {
+		b, err := d.take(1)
+		if err != nil {
+			return "", err
+		}
+		n = int(b[0])
+	} else {
+		b, err := d.take(4)
+		if err != nil {
+			return "", err
+		}
+		n = int(d.order.Uint32(b))
+	}
+	b, err := d.take(n + 1)
+	if err != nil {
+		return "", err
+	}
+	if b[n] != 0 {
+		return "", errors.New("字符串没有以零字节结尾")
+	}
+	return string(b[:n]), nil
+}
+
+// value 按类型签名sig解码一个值
+func (d *decoder) value(sig string) (any, error) {
+	// 规范限制嵌套深度，同时防止恶意消息耗尽栈空间
+	if d.depth > 64 {
+		return nil, errors.New("D-Bus消息嵌套过深")
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	if err := d.align(alignment(sig)); err != nil {
+		return nil, err
+	}
+	switch sig[0] {
+	case 'y':
+		b, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b', 'i', 'u':
+		b, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		n := d.order.Uint32(b)
+		switch sig[0] {
+		case 'b':
+			return n != 0, nil
+		case 'i':
+			return int32(n), nil
+		}
+		return n, nil
+	case 'n', 'q':
+		b, err := d.take(2)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'x', 't', 'd':
+		b, err := d.take(8)
+		if err != nil {
+			return nil, err
+		}
+		n := d.order.Uint64(b)
+		switch sig[0] {
+		case 'x':
+			return int64(n), nil
+		case 'd':
+			return math.Float64frombits(n), nil
+		}
+		return n, nil
+	case 's':
+		return d.str('s')
+	case 'o':
+		s, err := d.str('o')
+		return objectPath(s), err
+	case 'g':
+		s, err := d.str('g')
+		return signature(s), err
+	case 'v':
+		s, err := d.str('g')
+		if err != nil {
+			return nil, err
+		}
+		if t, rest, err := nextType(s); err != nil || rest != "" || t != s {
+			return nil, fmt.Errorf("变体的类型签名%q无效", s)
+		}
+		v, err := d.value(s)
+		if err != nil {
+			return nil, err
+		}
+		return variant{sig: s, value: v}, nil
+	case 'a':
+		b, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		n := int(d.order.Uint32(b))
+		elem := sig[1:]
+		if err := d.align(alignment(elem)); err != nil {
+			return nil, err
+		}
+		if n > len(d.data)-d.offset {
+			return nil, errTruncated
+		}
+		if elem == "y" {
+			b, _ := d.take(n)
+			return append([]byte(nil), b...), nil
+		}
+		end := d.offset + n
+		items := []any{}
+		for d.offset < end {
+			item, err := d.value(elem)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		if d.offset != end {
+			return nil, errors.New("D-Bus数组长度错误")
+		}
+		return items, nil
+	case '(', '{':
+		types, err := splitTypes(sig[1 : len(sig)-1])
+		if err != nil {
+			return nil, err
+		}
+		fields := make([]any, 0, len(types))
+		for _, t := range types {
+			v, err := d.value(t)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("不支持的类型%q", sig[0])
+}
+
+// encodeMessage 以小端字节序编码一条消息
+func encodeMessage(m *message) ([]byte, error) {
+	var body encoder
+	types, err := splitTypes(m.signature)
+	if err != nil {
+		return nil, err
+	}
+	if len(types) != len(m.body) {
+		return nil, fmt.Errorf("类型签名%q需要%d个值，实际有%d个", m.signature, len(types), len(m.body))
+	}
+	for i, t := range types {
+		if err := body.value(t, m.body[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	var fields []any
+	addString := func(code byte, sig string, v any) {
+		fields = append(fields, []any{code, variant{sig: sig, value: v}})
+	}
+	if m.path != "" {
+		addString(fieldPath, "o", m.path)
+	}
+	if m.iface != "" {
+		addString(fieldInterface, "s", m.iface)
+	}
+	if m.member != "" {
+		addString(fieldMember, "s", m.member)
+	}
+	if m.errorName != "" {
+		addString(fieldErrorName, "s", m.errorName)
+	}
+	if m.replySerial != 0 {
+		addString(fieldReplySerial, "u", m.replySerial)
+	}
+	if m.destination != "" {
+		addString(fieldDestination, "s", m.destination)
+	}
+	if m.sender != "" {
+		addString(fieldSender, "s", m.sender)
+	}
+	if m.signature != "" {
+		addString(fieldSignature, "g", signature(m.signature))
+	}
+
+	e := encoder{buf: []byte{'l', m.kind, m.flags, 1}}
+	e.uint32(uint32(len(body.buf)))
+	e.uint32(m.serial)
+	if err := e.value("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	e.align(8)
+	return append(e.buf, body.buf...), nil
+}
+
+// readMessage 读取并解码一条消息，支持两种字节序
+func readMessage(r *bufio.Reader) (*message, error) {
+	head := make([]byte, 16)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch head[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("无效的字节序标记%q", head[0])
+	}
+	if head[3] != 1 {
+		return nil, fmt.Errorf("不支持的协议版本%d", head[3])
+	}
+	bodyLen := int64(order.Uint32(head[4:]))
+	fieldsLen := int64(order.Uint32(head[12:]))
+	headerLen := (16 + fieldsLen + 7) &^ 7
+	if headerLen+bodyLen > maxMessageSize {
+		return nil, fmt.Errorf("D-Bus消息过大（%d字节）", headerLen+bodyLen)
+	}
+
+	data := make([]byte, headerLen+bodyLen)
+	copy(data, head)
+	if _, err := io.ReadFull(r, data[16:]); err != nil {
+		return nil, err
+	}
+
+	m := &message{kind: head[1], flags: head[2], serial: order.Uint32(head[8:])}
+	d := &decoder{data: data[:16+fieldsLen], offset: 12, order: order}
+	v, err := d.value("a(yv)")
+	if err != nil {
+		return nil, fmt.Errorf("解析消息头部失败: %w", err)
+	}
+	for _, f := range v.([]any) {
+		field := f.([]any)
+		value := field[1].(variant).value
+		switch field[0].(byte) {
+		case fieldPath:
+			m.path, _ = value.(objectPath)
+		case fieldInterface:
+			m.iface, _ = value.(string)
+		case fieldMember:
+			m.member, _ = value.(string)
+		case fieldErrorName:
+			m.errorName, _ = value.(string)
+		case fieldReplySerial:
+			m.replySerial, _ = value.(uint32)
+		case fieldDestination:
+			m.destination, _ = value.(string)
+		case fieldSender:
+			m.sender, _ = value.(string)
+		case fieldSignature:
+			s, _ := value.(signature)
+			m.signature = string(s)
+		}
+	}
+
+	types, err := splitTypes(m.signature)
+	if err != nil {
+		return nil, err
+	}
+	d = &decoder{data: data[headerLen:], order: order}
+	for _, t := range types {
+		v, err := d.value(t)
+		if err != nil {
+			return nil, fmt.Errorf("解析消息内容失败: %w", err)
+		}
+		m.body = append(m.body, v)
+	}
+	return m, nil
+}
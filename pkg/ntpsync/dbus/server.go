@@ -0,0 +1,540 @@
+// Package dbus 通过D-Bus系统总线发布同步状态，供桌面和嵌入式界面，
+// 以及类似timedatectl的工具显示设备是否已经与NTP服务器同步。
+//
+// Server在总线上拥有一个名称并导出一个只读对象，属性的命名和类型沿用
+// systemd-timesyncd的org.freedesktop.timesync1.Manager（ServerName、ServerAddress、
+// PollIntervalUSec）和systemd-timedated的org.freedesktop.timedate1（NTPSynchronized、
+// TimeUSec），另外增加了偏移量、根距离、层级和最后同步时间。
+// 每次同步完成和每个Interval检查一次属性，变化时发送PropertiesChanged信号。
+//
+//	srv, err := dbus.New(ntp, dbus.Options{})
+//	go srv.Run(ctx)
+//
+// 本包只实现了导出对象所需的D-Bus协议子集，只支持unix套接字，主要用于Linux。
+// 在系统总线上拥有名称需要安装允许该名称的策略文件，参见USAGE.md。
+package dbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// 默认的总线名称、对象路径和接口名称
+const (
+	DefaultBusName    = "io.github.hy_iot.NTPSync1"
+	DefaultObjectPath = "/io/github/hy_iot/NTPSync1"
+	DefaultInterface  = "io.github.hy_iot.NTPSync1.Manager"
+)
+
+// 默认配置
+const (
+	DefaultInterval      = time.Minute
+	DefaultTimeout       = 10 * time.Second
+	DefaultRetryInterval = 10 * time.Second
+)
+
+// 标准接口的名称
+const (
+	propertiesInterface = "org.freedesktop.DBus.Properties"
+	introspectInterface = "org.freedesktop.DBus.Introspectable"
+	peerInterface       = "org.freedesktop.DBus.Peer"
+)
+
+// 标准错误的名称
+const (
+	errUnknownMethod    = "org.freedesktop.DBus.Error.UnknownMethod"
+	errUnknownObject    = "org.freedesktop.DBus.Error.UnknownObject"
+	errUnknownInterface = "org.freedesktop.DBus.Error.UnknownInterface"
+	errUnknownProperty  = "org.freedesktop.DBus.Error.UnknownProperty"
+	errPropertyReadOnly = "org.freedesktop.DBus.Error.PropertyReadOnly"
+	errInvalidArgs      = "org.freedesktop.DBus.Error.InvalidArgs"
+	errFailed           = "org.freedesktop.DBus.Error.Failed"
+)
+
+// ServerAddress中的地址族，与Linux的AF_INET和AF_INET6相同
+const (
+	addressFamilyINET  = 2
+	addressFamilyINET6 = 10
+)
+
+// Options 包含Server的配置选项
+type Options struct {
+	// Address 是消息总线的地址，例如"unix:path=/run/dbus/system_bus_socket"，
+	// 为空时使用SystemBusAddress()
+	Address string
+
+	// BusName 是在总线上拥有的名称，为空时使用DefaultBusName。
+	// 没有运行systemd-timesyncd的系统可以使用"org.freedesktop.timesync1"
+	BusName string
+
+	// ObjectPath 是导出对象的路径，为空时使用DefaultObjectPath
+	ObjectPath string
+
+	// Interface 是导出属性的接口名称，为空时使用DefaultInterface
+	Interface string
+
+	// MaxAge 是认为同步仍然有效的最长时间，决定NTPSynchronized，零值表示使用两倍的同步间隔
+	MaxAge time.Duration
+
+	// Interval 是检查属性变化的间隔，用于在同步过期时及时更新NTPSynchronized
+	Interval time.Duration
+
+	// Timeout 是连接和请求名称的超时时间
+	Timeout time.Duration
+
+	// RetryInterval 是连接断开后重新连接的等待时间
+	RetryInterval time.Duration
+
+	// OnError 接收连接过程中的错误，可以为nil
+	OnError func(error)
+}
+
+// property 是导出对象的一个属性
+type property struct {
+	name string
+	sig  string
+
+	// emitsChanged 表示属性变化时是否发送PropertiesChanged信号
+	emitsChanged bool
+}
+
+// properties 是导出对象的全部属性
+var properties = []property{
+	{"NTPSynchronized", "b", true},
+	{"ServerName", "s", true},
+	{"ServerAddress", "(iay)", true},
+	{"PollIntervalUSec", "t", true},
+	{"OffsetUSec", "x", true},
+	{"RootDistanceUSec", "t", true},
+	{"Stratum", "y", true},
+	{"LastSyncUSec", "t", true},
+	{"TimeUSec", "t", false},
+}
+
+// Server 通过D-Bus导出同步状态
+type Server struct {
+	ntp  *ntpsync.NTPSync
+	opts Options
+}
+
+// New 创建一个导出同步状态的Server，调用Run开始服务
+func New(n *ntpsync.NTPSync, opts Options) (*Server, error) {
+	if n == nil {
+		return nil, errors.New("必须提供NTPSync实例")
+	}
+
+	if opts.Address == "" {
+		opts.Address = SystemBusAddress()
+	}
+	if _, err := parseAddress(opts.Address); err != nil {
+		return nil, err
+	}
+	if opts.BusName == "" {
+		opts.BusName = DefaultBusName
+	}
+	if opts.ObjectPath == "" {
+		opts.ObjectPath = DefaultObjectPath
+	}
+	if opts.Interface == "" {
+		opts.Interface = DefaultInterface
+	}
+	if !validName(opts.BusName, true) {
+		return nil, fmt.Errorf("无效的D-Bus名称 %q", opts.BusName)
+	}
+	if !validName(opts.Interface, false) {
+		return nil, fmt.Errorf("无效的D-Bus接口名称 %q", opts.Interface)
+	}
+	if !validPath(opts.ObjectPath) {
+		return nil, fmt.Errorf("无效的D-Bus对象路径 %q", opts.ObjectPath)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+
+	return &Server{ntp: n, opts: opts}, nil
+}
+
+// validName 检查总线名称或接口名称，总线名称允许使用连字符
+func validName(name string, bus bool) bool {
+	if len(name) > 255 || !strings.Contains(name, ".") {
+		return false
+	}
+	for _, elem := range strings.Split(name, ".") {
+		if elem == "" || (elem[0] >= '0' && elem[0] <= '9') {
+			return false
+		}
+		for _, r := range elem {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || bus && r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validPath 检查对象路径
+func validPath(path string) bool {
+	if path == "/" {
+		return true
+	}
+	if !strings.HasPrefix(path, "/") {
+		return false
+	}
+	for _, elem := range strings.Split(path[1:], "/") {
+		if elem == "" {
+			return false
+		}
+		for _, r := range elem {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Run 连接消息总线并导出同步状态，直到ctx被取消
+// 连接断开后等待RetryInterval重新连接，错误交给OnError
+// ctx被取消时断开连接并返回ctx.Err()
+func (s *Server) Run(ctx context.Context) error {
+	events, unsubscribe := s.ntp.Subscribe(0)
+	defer unsubscribe()
+
+	for {
+		err := s.session(ctx, events)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.report(err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.opts.RetryInterval):
+		}
+	}
+}
+
+// session 建立一次连接并处理请求，直到连接断开或ctx被取消
+func (s *Server) session(ctx context.Context, events <-chan ntpsync.Event) error {
+	dialCtx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	c, err := dial(dialCtx, s.opts.Address, s.opts.BusName)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	last := s.values()
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			return c.closeErr()
+		case m := <-c.incoming:
+			if m.kind == typeMethodCall {
+				if err := s.handle(c, m); err != nil {
+					return err
+				}
+			}
+			continue
+		case ev := <-events:
+			switch ev.Type {
+			case ntpsync.EventSyncSucceeded, ntpsync.EventSyncFailed, ntpsync.EventIntervalChanged:
+			default:
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		current := s.values()
+		if err := s.emitChanged(c, last, current); err != nil {
+			return err
+		}
+		last = current
+	}
+}
+
+// values 返回所有属性的当前值
+func (s *Server) values() map[string]variant {
+	var last *ntpsync.SyncResult
+	history := s.ntp.GetHistory(0)
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Error == nil && !history[i].Rejected {
+			last = &history[i]
+			break
+		}
+	}
+
+	var serverName string
+	var rootDistance time.Duration
+	var stratum byte
+	family, address := int32(0), []byte{}
+	if last != nil {
+		serverName = last.Server
+		if host, _, err := net.SplitHostPort(serverName); err == nil {
+			serverName = host
+		}
+		if addr, err := netip.ParseAddr(serverName); err == nil {
+			addr = addr.Unmap()
+			family = addressFamilyINET6
+			if addr.Is4() {
+				family = addressFamilyINET
+			}
+			address = addr.AsSlice()
+		}
+		rootDistance = last.RootDistance
+		stratum = last.Stratum
+	}
+
+	return map[string]variant{
+		"NTPSynchronized":  {"b", s.ntp.IsSynchronized(s.opts.MaxAge)},
+		"ServerName":       {"s", serverName},
+		"ServerAddress":    {"(iay)", []any{family, address}},
+		"PollIntervalUSec": {"t", microseconds(s.ntp.GetPeriodicSyncInterval())},
+		"OffsetUSec":       {"x", s.ntp.TimeOffsetDuration().Microseconds()},
+		"RootDistanceUSec": {"t", microseconds(rootDistance)},
+		"Stratum":          {"y", stratum},
+		"LastSyncUSec":     {"t", unixMicroseconds(s.ntp.LastSyncTime())},
+		"TimeUSec":         {"t", unixMicroseconds(s.ntp.Now())},
+	}
+}
+
+// microseconds 将非负的时长转换为微秒数
+func microseconds(d time.Duration) uint64 {
+	if d <= 0 {
+		return 0
+	}
+	return uint64(d.Microseconds())
+}
+
+// unixMicroseconds 将时间转换为自Unix纪元以来的微秒数，零值时间为0
+func unixMicroseconds(t time.Time) uint64 {
+	if t.IsZero() || t.UnixMicro() < 0 {
+		return 0
+	}
+	return uint64(t.UnixMicro())
+}
+
+// emitChanged 比较两次的属性值，发送变化的属性
+func (s *Server) emitChanged(c *conn, last, current map[string]variant) error {
+	changed := []any{}
+	for _, p := range properties {
+		if p.emitsChanged && !reflect.DeepEqual(last[p.name], current[p.name]) {
+			changed = append(changed, []any{p.name, current[p.name]})
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	_, err := c.send(&message{
+		kind:      typeSignal,
+		path:      objectPath(s.opts.ObjectPath),
+		iface:     propertiesInterface,
+		member:    "PropertiesChanged",
+		signature: "sa{sv}as",
+		body:      []any{s.opts.Interface, changed, []any{}},
+	})
+	return err
+}
+
+// handle 处理一个方法调用，只在发送应答失败时返回错误
+func (s *Server) handle(c *conn, m *message) error {
+	sig, body, errName, errText := s.call(m)
+	if m.flags&flagNoReplyExpected != 0 {
+		return nil
+	}
+
+	reply := &message{
+		kind:        typeMethodReturn,
+		replySerial: m.serial,
+		destination: m.sender,
+		signature:   sig,
+		body:        body,
+	}
+	if errName != "" {
+		reply.kind = typeError
+		reply.errorName = errName
+		reply.signature = "s"
+		reply.body = []any{errText}
+	}
+	_, err := c.send(reply)
+	return err
+}
+
+// call 执行方法调用，返回应答的类型签名和内容，或者错误名称和说明
+func (s *Server) call(m *message) (string, []any, string, string) {
+	path := string(m.path)
+	if path != s.opts.ObjectPath {
+		if child, ok := childNode(path, s.opts.ObjectPath); ok {
+			// 导出对象的上级路径只支持内省，方便工具逐级浏览
+			switch {
+			case m.member == "Introspect" && (m.iface == "" || m.iface == introspectInterface):
+				return "s", []any{nodeXML(child)}, "", ""
+			case m.member == "Ping" && (m.iface == "" || m.iface == peerInterface):
+				return "", nil, "", ""
+			}
+			return "", nil, errUnknownMethod, fmt.Sprintf("未知的方法%s.%s", m.iface, m.member)
+		}
+		return "", nil, errUnknownObject, fmt.Sprintf("未知的对象%s", path)
+	}
+
+	is := func(iface string) bool { return m.iface == "" || m.iface == iface }
+	switch {
+	case is(propertiesInterface) && m.member == "Get":
+		if m.signature != "ss" {
+			return "", nil, errInvalidArgs, "Get的参数类型应为ss"
+		}
+		iface, name := m.body[0].(string), m.body[1].(string)
+		if iface != "" && iface != s.opts.Interface {
+			return "", nil, errUnknownInterface, fmt.Sprintf("未知的接口%s", iface)
+		}
+		v, ok := s.values()[name]
+		if !ok {
+			return "", nil, errUnknownProperty, fmt.Sprintf("未知的属性%s", name)
+		}
+		return "v", []any{v}, "", ""
+	case is(propertiesInterface) && m.member == "GetAll":
+		if m.signature != "s" {
+			return "", nil, errInvalidArgs, "GetAll的参数类型应为s"
+		}
+		all := []any{}
+		if iface := m.body[0].(string); iface == "" || iface == s.opts.Interface {
+			values := s.values()
+			for _, p := range properties {
+				all = append(all, []any{p.name, values[p.name]})
+			}
+		}
+		return "a{sv}", []any{all}, "", ""
+	case is(propertiesInterface) && m.member == "Set":
+		return "", nil, errPropertyReadOnly, "所有属性都是只读的"
+	case is(introspectInterface) && m.member == "Introspect":
+		return "s", []any{s.introspect()}, "", ""
+	case is(peerInterface) && m.member == "Ping":
+		return "", nil, "", ""
+	case is(peerInterface) && m.member == "GetMachineId":
+		id, err := machineID()
+		if err != nil {
+			return "", nil, errFailed, err.Error()
+		}
+		return "s", []any{id}, "", ""
+	}
+
+	switch m.iface {
+	case "", propertiesInterface, introspectInterface, peerInterface, s.opts.Interface:
+		return "", nil, errUnknownMethod, fmt.Sprintf("未知的方法%s.%s", m.iface, m.member)
+	}
+	return "", nil, errUnknownInterface, fmt.Sprintf("未知的接口%s", m.iface)
+}
+
+// childNode 判断path是否是target的上级路径，返回下一级节点的名称
+func childNode(path, target string) (string, bool) {
+	prefix := path
+	if prefix != "/" {
+		prefix += "/"
+	}
+	if !strings.HasPrefix(target, prefix) {
+		return "", false
+	}
+	child, _, _ := strings.Cut(target[len(prefix):], "/")
+	return child, true
+}
+
+// machineID 返回本机的machine-id
+func machineID() (string, error) {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(path); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	return "", errors.New("无法读取machine-id")
+}
+
+// introspectHeader 是内省数据的文档类型声明
+const introspectHeader = `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+`
+
+// nodeXML 返回只包含一个子节点的内省数据
+func nodeXML(child string) string {
+	return introspectHeader + "<node>\n <node name=\"" + child + "\"/>\n</node>\n"
+}
+
+// introspect 返回导出对象的内省数据
+func (s *Server) introspect() string {
+	var b strings.Builder
+	b.WriteString(introspectHeader)
+	b.WriteString(`<node>
+ <interface name="org.freedesktop.DBus.Peer">
+  <method name="Ping"/>
+  <method name="GetMachineId">
+   <arg name="machine_uuid" type="s" direction="out"/>
+  </method>
+ </interface>
+ <interface name="org.freedesktop.DBus.Introspectable">
+  <method name="Introspect">
+   <arg name="xml_data" type="s" direction="out"/>
+  </method>
+ </interface>
+ <interface name="org.freedesktop.DBus.Properties">
+  <method name="Get">
+   <arg name="interface_name" type="s" direction="in"/>
+   <arg name="property_name" type="s" direction="in"/>
+   <arg name="value" type="v" direction="out"/>
+  </method>
+  <method name="GetAll">
+   <arg name="interface_name" type="s" direction="in"/>
+   <arg name="props" type="a{sv}" direction="out"/>
+  </method>
+  <method name="Set">
+   <arg name="interface_name" type="s" direction="in"/>
+   <arg name="property_name" type="s" direction="in"/>
+   <arg name="value" type="v" direction="in"/>
+  </method>
+  <signal name="PropertiesChanged">
+   <arg type="s" name="interface_name"/>
+   <arg type="a{sv}" name="changed_properties"/>
+   <arg type="as" name="invalidated_properties"/>
+  </signal>
+ </interface>
+`)
+	fmt.Fprintf(&b, " <interface name=%q>\n", s.opts.Interface)
+	for _, p := range properties {
+		if p.emitsChanged {
+			fmt.Fprintf(&b, "  <property name=%q type=%q access=\"read\"/>\n", p.name, p.sig)
+		} else {
+			fmt.Fprintf(&b, "  <property name=%q type=%q access=\"read\">\n", p.name, p.sig)
+			b.WriteString("   <annotation name=\"org.freedesktop.DBus.Property.EmitsChangedSignal\" value=\"false\"/>\n")
+			b.WriteString("  </property>\n")
+		}
+	}
+	b.WriteString(" </interface>\n</node>\n")
+	return b.String()
+}
+
+// report 将错误交给OnError
+func (s *Server) report(err error) {
+	if err != nil && s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
@@ -0,0 +1,324 @@
+package dbus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntpsynctest"
+)
+
+// testBus 是只连接一个客户端的测试消息总线
+type testBus struct {
+	address  string
+	names    chan string
+	messages chan *message
+	conns    chan net.Conn
+}
+
+// newTestBus 创建测试消息总线，完成认证后应答Hello和RequestName
+func newTestBus(t *testing.T) *testBus {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "bus")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("监听unix套接字失败: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	b := &testBus{
+		address:  "unix:path=" + socket,
+		names:    make(chan string, 4),
+		messages: make(chan *message, 64),
+		conns:    make(chan net.Conn, 4),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+// serve 处理一个客户端连接
+func (b *testBus) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+		return
+	}
+	_, _ = conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+	if line, err := reader.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		return
+	}
+
+	var serial uint32
+	reply := func(m *message, sig string, body ...any) {
+		serial++
+		b, _ := encodeMessage(&message{
+			kind:        typeMethodReturn,
+			serial:      serial,
+			replySerial: m.serial,
+			sender:      busName,
+			signature:   sig,
+			body:        body,
+		})
+		_, _ = conn.Write(b)
+	}
+
+	for {
+		m, err := readMessage(reader)
+		if err != nil {
+			return
+		}
+		switch {
+		case m.destination == busName && m.member == "Hello":
+			reply(m, "s", ":1.42")
+		case m.destination == busName && m.member == "RequestName":
+			b.names <- m.body[0].(string)
+			reply(m, "u", uint32(nameReplyPrimaryOwner))
+			b.conns <- conn
+		default:
+			b.messages <- m
+		}
+	}
+}
+
+// client 返回请求名称后的客户端连接
+func (b *testBus) client(t *testing.T) net.Conn {
+	t.Helper()
+
+	select {
+	case conn := <-b.conns:
+		return conn
+	case <-time.After(2 * time.Second):
+		t.Fatal("等待客户端连接超时")
+		return nil
+	}
+}
+
+// next 返回客户端发来的下一条消息
+func (b *testBus) next(t *testing.T) *message {
+	t.Helper()
+
+	select {
+	case m := <-b.messages:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("等待D-Bus消息超时")
+		return nil
+	}
+}
+
+// call 向客户端发送一个方法调用并返回应答
+func (b *testBus) call(t *testing.T, conn net.Conn, serial uint32, path, iface, member, sig string, body ...any) *message {
+	t.Helper()
+
+	data, err := encodeMessage(&message{
+		kind:        typeMethodCall,
+		serial:      serial,
+		path:        objectPath(path),
+		iface:       iface,
+		member:      member,
+		sender:      ":1.7",
+		destination: DefaultBusName,
+		signature:   sig,
+		body:        body,
+	})
+	if err != nil {
+		t.Fatalf("编码方法调用失败: %v", err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		t.Fatalf("发送方法调用失败: %v", err)
+	}
+
+	m := b.next(t)
+	if m.replySerial != serial || m.destination != ":1.7" {
+		t.Fatalf("预期对%d的应答，实际得到%+v", serial, m)
+	}
+	return m
+}
+
+// staticSource 是总是返回固定偏移量的时间源
+type staticSource time.Duration
+
+func (s staticSource) Name() string { return "static" }
+
+func (s staticSource) Measure(ctx context.Context) (*ntpsync.SyncResult, error) {
+	return &ntpsync.SyncResult{Time: time.Now(), Offset: time.Duration(s)}, nil
+}
+
+// TestMessageRoundTrip 测试消息的编码和解码
+func TestMessageRoundTrip(t *testing.T) {
+	m := &message{
+		kind:        typeSignal,
+		serial:      7,
+		path:        "/a/b",
+		iface:       "a.b.C",
+		member:      "Changed",
+		destination: ":1.1",
+		signature:   "ybnqiuxtdsogva{sv}(iay)as",
+		body: []any{
+			byte(1), true, int16(-2), uint16(3), int32(-4), uint32(5), int64(-6), uint64(7), 1.5,
+			"text", objectPath("/x"), signature("as"), variant{"t", uint64(9)},
+			[]any{[]any{"k", variant{"b", false}}},
+			[]any{int32(2), []byte{127, 0, 0, 1}},
+			[]any{},
+		},
+	}
+	data, err := encodeMessage(m)
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	got, err := readMessage(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("解码结果不一致:\n预期 %+v\n实际 %+v", m, got)
+	}
+
+	for n := range data {
+		if _, err := readMessage(bufio.NewReader(bytes.NewReader(data[:n]))); err == nil {
+			t.Fatalf("预期截断为%d字节的消息无效", n)
+		}
+	}
+}
+
+// TestParseAddress 测试解析D-Bus地址
+func TestParseAddress(t *testing.T) {
+	sockets, err := parseAddress("tcp:host=localhost,port=1;unix:path=/run/dbus/system%5fbus;unix:abstract=dbus-1")
+	if err != nil {
+		t.Fatalf("解析地址失败: %v", err)
+	}
+	if want := []string{"/run/dbus/system_bus", "@dbus-1"}; !reflect.DeepEqual(sockets, want) {
+		t.Errorf("预期%v，实际得到%v", want, sockets)
+	}
+
+	for _, address := range []string{"", "tcp:host=localhost", "unix"} {
+		if _, err := parseAddress(address); err == nil {
+			t.Errorf("预期%q无效", address)
+		}
+	}
+}
+
+// TestServer 测试属性的读取、内省和同步后的PropertiesChanged信号
+func TestServer(t *testing.T) {
+	bus := newTestBus(t)
+	ntp, _ := ntpsynctest.NewSyncedClient(t)
+
+	srv, err := New(ntp, Options{
+		Address: bus.address,
+		OnError: func(err error) { t.Errorf("D-Bus服务失败: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("创建Server失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	if name := <-bus.names; name != DefaultBusName {
+		t.Errorf("预期请求名称%s，实际得到%s", DefaultBusName, name)
+	}
+	conn := bus.client(t)
+
+	m := bus.call(t, conn, 1, DefaultObjectPath, propertiesInterface, "GetAll", "s", DefaultInterface)
+	if m.kind != typeMethodReturn || m.signature != "a{sv}" {
+		t.Fatalf("GetAll的应答错误: %+v", m)
+	}
+	props := make(map[string]any)
+	for _, entry := range m.body[0].([]any) {
+		kv := entry.([]any)
+		props[kv[0].(string)] = kv[1].(variant).value
+	}
+	if len(props) != len(properties) {
+		t.Errorf("预期%d个属性，实际得到%d个", len(properties), len(props))
+	}
+	if props["NTPSynchronized"] != true || props["ServerName"] != "127.0.0.1" {
+		t.Errorf("同步状态错误: %v", props)
+	}
+	if addr := props["ServerAddress"].([]any); addr[0] != int32(addressFamilyINET) || !bytes.Equal(addr[1].([]byte), []byte{127, 0, 0, 1}) {
+		t.Errorf("服务器地址错误: %v", addr)
+	}
+	if offset := props["OffsetUSec"].(int64); offset < 900000 || offset > 1100000 {
+		t.Errorf("预期偏移量约为1秒，实际得到%dus", offset)
+	}
+
+	m = bus.call(t, conn, 2, DefaultObjectPath, propertiesInterface, "Get", "ss", DefaultInterface, "Missing")
+	if m.kind != typeError || m.errorName != errUnknownProperty {
+		t.Errorf("预期UnknownProperty错误，实际得到%+v", m)
+	}
+	m = bus.call(t, conn, 3, DefaultObjectPath, introspectInterface, "Introspect", "")
+	if m.kind != typeMethodReturn || !strings.Contains(m.body[0].(string), `<property name="NTPSynchronized" type="b" access="read"/>`) {
+		t.Errorf("内省数据错误: %+v", m)
+	}
+	m = bus.call(t, conn, 4, "/io/github", "", "Introspect", "")
+	if m.kind != typeMethodReturn || !strings.Contains(m.body[0].(string), `<node name="hy_iot"/>`) {
+		t.Errorf("上级路径的内省数据错误: %+v", m)
+	}
+	m = bus.call(t, conn, 5, "/other", peerInterface, "Ping", "")
+	if m.kind != typeError || m.errorName != errUnknownObject {
+		t.Errorf("预期UnknownObject错误，实际得到%+v", m)
+	}
+
+	// 同步完成后发送变化的属性
+	if err := ntp.SyncWithSource(context.Background(), staticSource(3*time.Second)); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	m = bus.next(t)
+	if m.kind != typeSignal || m.member != "PropertiesChanged" || m.body[0] != DefaultInterface {
+		t.Fatalf("预期PropertiesChanged信号，实际得到%+v", m)
+	}
+	changed := make(map[string]any)
+	for _, entry := range m.body[1].([]any) {
+		kv := entry.([]any)
+		changed[kv[0].(string)] = kv[1].(variant).value
+	}
+	if changed["OffsetUSec"] != int64(3000000) || changed["ServerName"] != "static" {
+		t.Errorf("变化的属性错误: %v", changed)
+	}
+	if _, ok := changed["TimeUSec"]; ok {
+		t.Error("TimeUSec不应该发送变化信号")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("预期返回context.Canceled，实际得到%v", err)
+	}
+}
+
+// TestNewInvalid 测试无效的配置
+func TestNewInvalid(t *testing.T) {
+	ntp, err := ntpsync.New(ntpsync.Options{Servers: []string{"127.0.0.1:1"}})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	for _, opts := range []Options{
+		{Address: "tcp:host=localhost,port=1"},
+		{Address: "unix:path=/bus", BusName: "nodots"},
+		{Address: "unix:path=/bus", Interface: "io.github.hy-iot.NTPSync1"},
+		{Address: "unix:path=/bus", ObjectPath: "/trailing/"},
+	} {
+		if _, err := New(ntp, opts); err == nil {
+			t.Errorf("预期%+v无效", opts)
+		}
+	}
+}
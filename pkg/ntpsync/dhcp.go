@@ -0,0 +1,223 @@
+package ntpsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DHCP报文中使用的选项（RFC 2132）
+const (
+	dhcpOptionPad        = 0
+	dhcpOptionNTPServers = 42
+	dhcpOptionLeaseTime  = 51
+	dhcpOptionEnd        = 255
+)
+
+// dhcpOptionsOffset 是DHCP报文中选项的起始位置，之前是固定的BOOTP字段和魔数
+const dhcpOptionsOffset = 240
+
+// dhcpMagicCookie 是DHCP报文中选项之前的魔数
+var dhcpMagicCookie = []byte{99, 130, 83, 99}
+
+// ErrDHCPUnsupported 表示当前平台不支持读取DHCP租约
+var ErrDHCPUnsupported = errors.New("当前平台不支持读取DHCP租约中的NTP服务器")
+
+// LookupDHCPServers 从DHCP客户端的租约文件读取DHCP服务器通过option 42提供的NTP服务器，
+// 返回"IP地址:123"格式的地址，最近更新的租约在前。支持systemd-networkd、NetworkManager、
+// dhclient和dhcpcd的租约文件，已经过期的租约被忽略；没有租约提供NTP服务器时返回空列表。
+// 目前只支持Linux，其它平台返回ErrDHCPUnsupported
+func LookupDHCPServers() ([]string, error) {
+	return lookupDHCPServers(dhcpLeasePatterns, time.Now())
+}
+
+// dhcpLeaseFile 是找到的一个租约文件
+type dhcpLeaseFile struct {
+	path     string
+	modified time.Time
+}
+
+// lookupDHCPServers 读取与patterns匹配的租约文件中未过期的NTP服务器
+// 有文件无法读取且没有找到任何服务器时返回读取的错误
+func lookupDHCPServers(patterns []string, now time.Time) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, ErrDHCPUnsupported
+	}
+
+	var files []dhcpLeaseFile
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			files = append(files, dhcpLeaseFile{path: path, modified: info.ModTime()})
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modified.After(files[j].modified)
+	})
+
+	var servers []string
+	var readErr error
+	seen := make(map[string]bool)
+	for _, file := range files {
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			readErr = fmt.Errorf("读取DHCP租约 %s 失败: %w", file.path, err)
+			continue
+		}
+		for _, addr := range parseDHCPLease(data, file.modified, now) {
+			server := net.JoinHostPort(addr.Unmap().String(), "123")
+			if !seen[server] {
+				seen[server] = true
+				servers = append(servers, server)
+			}
+		}
+	}
+	if len(servers) == 0 && readErr != nil {
+		return nil, readErr
+	}
+	return servers, nil
+}
+
+// parseDHCPLease 按内容识别租约文件的格式，返回其中未过期的租约提供的NTP服务器
+// modified是文件的修改时间，用于计算只记录了租期的租约何时过期
+func parseDHCPLease(data []byte, modified, now time.Time) []netip.Addr {
+	switch {
+	case len(data) >= dhcpOptionsOffset && bytes.Equal(data[dhcpOptionsOffset-4:dhcpOptionsOffset], dhcpMagicCookie):
+		return parseDHCPMessage(data, modified, now)
+	case bytes.Contains(data, []byte("{")):
+		return parseDHClientLease(data, now)
+	default:
+		return parseNetworkdLease(data, modified, now)
+	}
+}
+
+// parseDHCPMessage 解析dhcpcd保存的原始DHCP应答
+func parseDHCPMessage(data []byte, modified, now time.Time) []netip.Addr {
+	var servers []netip.Addr
+	options := data[dhcpOptionsOffset:]
+	for len(options) > 0 {
+		code := options[0]
+		if code == dhcpOptionPad {
+			options = options[1:]
+			continue
+		}
+		if code == dhcpOptionEnd || len(options) < 2 || len(options) < 2+int(options[1]) {
+			break
+		}
+		value := options[2 : 2+int(options[1])]
+		options = options[2+len(value):]
+
+		switch code {
+		case dhcpOptionNTPServers:
+			for ; len(value) >= 4; value = value[4:] {
+				servers = append(servers, netip.AddrFrom4([4]byte(value[:4])))
+			}
+		case dhcpOptionLeaseTime:
+			if len(value) != 4 {
+				continue
+			}
+			lease := binary.BigEndian.Uint32(value)
+			if lease != math.MaxUint32 && !modified.Add(time.Duration(lease)*time.Second).After(now) {
+				return nil
+			}
+		}
+	}
+	return servers
+}
+
+// parseDHClientLease 解析dhclient的租约文件，文件中依次追加的租约以最后一个为准
+func parseDHClientLease(data []byte, now time.Time) []netip.Addr {
+	var servers, current []netip.Addr
+	inLease, expired := false, false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "lease {":
+			inLease, expired, current = true, false, nil
+		case line == "}":
+			if inLease && !expired {
+				servers = current
+			}
+			inLease = false
+		case !inLease:
+		case strings.HasPrefix(line, "option ntp-servers "):
+			current = parseAddrList(strings.TrimSuffix(strings.TrimPrefix(line, "option ntp-servers "), ";"))
+		case strings.HasPrefix(line, "expire "):
+			expires, ok := parseDHClientTime(strings.TrimSuffix(strings.TrimPrefix(line, "expire "), ";"))
+			expired = ok && !expires.After(now)
+		}
+	}
+	return servers
+}
+
+// parseDHClientTime 解析dhclient记录的时间，例如"4 2024/01/04 12:00:00"（UTC）、
+// "epoch 1704369600; # ..."或"never"。永不过期或无法解析时返回false
+func parseDHClientTime(value string) (time.Time, bool) {
+	value, _, _ = strings.Cut(value, ";")
+	fields := strings.Fields(value)
+	switch {
+	case len(fields) == 2 && fields[0] == "epoch":
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(seconds, 0), true
+	case len(fields) == 3:
+		t, err := time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2])
+		return t, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+// parseNetworkdLease 解析systemd-networkd和NetworkManager内置客户端的"键=值"格式租约
+func parseNetworkdLease(data []byte, modified, now time.Time) []netip.Addr {
+	var servers []netip.Addr
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "NTP":
+			servers = parseAddrList(value)
+		case "LIFETIME":
+			seconds, err := strconv.ParseUint(value, 10, 32)
+			if err == nil && seconds != math.MaxUint32 && !modified.Add(time.Duration(seconds)*time.Second).After(now) {
+				return nil
+			}
+		}
+	}
+	return servers
+}
+
+// parseAddrList 解析以逗号或空白分隔的IP地址，忽略无法解析的项
+func parseAddrList(value string) []netip.Addr {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	addrs := make([]netip.Addr, 0, len(fields))
+	for _, field := range fields {
+		if addr, err := netip.ParseAddr(field); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package ntpsync
+
+// dhcpLeasePatterns 是常见的DHCP客户端保存租约的位置
+var dhcpLeasePatterns = []string{
+	// systemd-networkd，文件名为网卡序号
+	"/run/systemd/netif/leases/*",
+	// NetworkManager的内置客户端和dhclient
+	"/var/lib/NetworkManager/*.lease",
+	// dhclient（Debian/Ubuntu和RHEL）
+	"/var/lib/dhcp/*.leases",
+	"/var/lib/dhclient/*.leases",
+	// dhcpcd保存的原始DHCP应答
+	"/var/lib/dhcpcd/*.lease",
+	"/var/lib/dhcpcd5/*.lease",
+	"/var/db/dhcpcd/*.lease",
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package ntpsync
+
+// dhcpLeasePatterns 为空，LookupDHCPServers返回ErrDHCPUnsupported
+var dhcpLeasePatterns []string
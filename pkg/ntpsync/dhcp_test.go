@@ -0,0 +1,159 @@
+package ntpsync
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// dhclientLease 包含一个已过期的租约和一个当前的租约
+const dhclientLease = `lease {
+  interface "eth0";
+  fixed-address 10.0.0.5;
+  option ntp-servers 10.0.0.1;
+  expire 1 2024/01/01 00:00:00;
+}
+lease {
+  interface "eth0";
+  fixed-address 10.0.0.5;
+  option ntp-servers 10.0.0.2,10.0.0.3;
+  renew 2 2024/01/02 06:00:00;
+  expire epoch 1704240000; # Wed Jan 03 00:00:00 2024
+}
+`
+
+// networkdLease 是systemd-networkd的租约
+const networkdLease = `# This is private data. Do not parse.
+ADDRESS=192.168.1.20
+LIFETIME=86400
+NTP=192.168.1.1 10.0.0.2
+`
+
+// dhcpMessage 返回dhcpcd保存的包含NTP服务器和租期选项的DHCP应答
+func dhcpMessage(lease uint32, servers ...byte) []byte {
+	msg := make([]byte, dhcpOptionsOffset)
+	copy(msg[dhcpOptionsOffset-4:], dhcpMagicCookie)
+	msg = append(msg, dhcpOptionPad, dhcpOptionNTPServers, byte(len(servers)))
+	msg = append(msg, servers...)
+	msg = append(msg, dhcpOptionLeaseTime, 4)
+	msg = binary.BigEndian.AppendUint32(msg, lease)
+	return append(msg, dhcpOptionEnd)
+}
+
+// writeLease 写入租约文件并设置修改时间
+func writeLease(t *testing.T, path string, data []byte, modified time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("写入租约失败: %v", err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("设置修改时间失败: %v", err)
+	}
+}
+
+// TestParseDHCPLease 测试识别各个DHCP客户端的租约格式并忽略过期的租约
+func TestParseDHCPLease(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	modified := now.Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{"dhclient", []byte(dhclientLease), []string{"10.0.0.2", "10.0.0.3"}},
+		{"networkd", []byte(networkdLease), []string{"192.168.1.1", "10.0.0.2"}},
+		{"dhcpcd", dhcpMessage(7200, 172, 16, 0, 1, 172, 16, 0, 2), []string{"172.16.0.1", "172.16.0.2"}},
+		{"dhcpcd过期", dhcpMessage(1800, 172, 16, 0, 1), nil},
+		{"dhcpcd无限租期", dhcpMessage(^uint32(0), 172, 16, 0, 1), []string{"172.16.0.1"}},
+		{"没有NTP服务器", []byte("ADDRESS=192.168.1.20\n"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, addr := range parseDHCPLease(tt.data, modified, now) {
+				got = append(got, addr.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("预期%v，实际得到%v", tt.want, got)
+			}
+		})
+	}
+
+	// dhclient的最后一个租约过期后不再使用
+	if got := parseDHCPLease([]byte(dhclientLease), modified, now.Add(24*time.Hour)); len(got) != 0 {
+		t.Errorf("预期过期的租约被忽略，实际得到%v", got)
+	}
+}
+
+// TestLookupDHCPServers 测试按修改时间合并多个租约文件中的服务器并去重
+func TestLookupDHCPServers(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeLease(t, filepath.Join(dir, "2"), []byte(networkdLease), now.Add(-time.Minute))
+	writeLease(t, filepath.Join(dir, "3"), []byte("NTP=10.0.0.9\nLIFETIME=60\n"), now.Add(-time.Hour))
+	writeLease(t, filepath.Join(dir, "4"), []byte("NTP=10.0.0.2 fe80::1\n"), now)
+
+	servers, err := lookupDHCPServers([]string{filepath.Join(dir, "*")}, now)
+	if err != nil {
+		t.Fatalf("读取租约失败: %v", err)
+	}
+	want := []string{"10.0.0.2:123", "[fe80::1]:123", "192.168.1.1:123"}
+	if !slices.Equal(servers, want) {
+		t.Errorf("预期%v，实际得到%v", want, servers)
+	}
+
+	if _, err := lookupDHCPServers(nil, now); err != ErrDHCPUnsupported {
+		t.Errorf("预期返回ErrDHCPUnsupported，实际得到%v", err)
+	}
+}
+
+// TestDHCPServers 测试DHCP提供的服务器排在配置的服务器之前，并在重新发现后更新
+func TestDHCPServers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "2")
+	writeLease(t, path, []byte("NTP=10.0.0.1 10.0.0.2\n"), time.Now())
+
+	patterns := dhcpLeasePatterns
+	dhcpLeasePatterns = []string{filepath.Join(dir, "*")}
+	defer func() { dhcpLeasePatterns = patterns }()
+
+	ntp, err := New(Options{
+		Servers:           []string{"127.0.0.1:1"},
+		DHCPServers:       true,
+		EnableMultiServer: true,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	want := []string{"10.0.0.1:123", "10.0.0.2:123", "127.0.0.1:1"}
+	if got := ntp.GetServers(); !slices.Equal(got, want) {
+		t.Fatalf("预期服务器列表为%v，实际得到%v", want, got)
+	}
+
+	// 接入另一个网络后使用新的DHCP服务器提供的服务器
+	writeLease(t, path, []byte("NTP=192.168.1.1\n"), time.Now())
+	if err := ntp.Rediscover(context.Background()); err != nil {
+		t.Fatalf("重新发现服务器失败: %v", err)
+	}
+	want = []string{"192.168.1.1:123", "127.0.0.1:1"}
+	if got := ntp.GetServers(); !slices.Equal(got, want) {
+		t.Errorf("预期服务器列表为%v，实际得到%v", want, got)
+	}
+	if got := ntp.serverManager.GetServers(); len(got) != 2 {
+		t.Errorf("预期服务器管理器中有2个服务器，实际得到%v", got)
+	}
+
+	// 没有配置服务器时，租约中没有NTP服务器会使New返回错误
+	writeLease(t, path, []byte("ADDRESS=192.168.1.20\n"), time.Now())
+	if _, err := New(Options{DHCPServers: true}); err == nil {
+		t.Error("预期没有可用的服务器时返回错误")
+	}
+}
@@ -0,0 +1,84 @@
+package ntpsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// DefaultMaxDistance 是默认的最大根距离，与ntpd的tos maxdist相同
+const DefaultMaxDistance = 1500 * time.Millisecond
+
+// 计算根距离使用的常量（RFC 5905）
+const (
+	// minDispersion 是往返延迟的下限(MINDISP)
+	minDispersion = 10 * time.Millisecond
+
+	// frequencyTolerance 是本地时钟频率误差的上限(PHI)，为15ppm
+	frequencyTolerance = 15e-6
+)
+
+// ErrRootDistanceExceeded 表示服务器的根距离超过了MaxDistance
+var ErrRootDistanceExceeded = errors.New("服务器的根距离超过上限")
+
+// rootDistance 按RFC 5905计算根距离，即服务器时间相对主参考源的最大误差：
+//
+//	max(MINDISP, 根延迟+往返延迟)/2 + 根离散度 + 离散度 + 抖动
+//
+// 其中离散度由服务器精度和往返期间本地时钟可能的频率误差组成
+func rootDistance(rootDelay, rootDispersion, rtt, precision, jitter time.Duration) time.Duration {
+	delay := rootDelay + rtt
+	if delay < minDispersion {
+		delay = minDispersion
+	}
+	dispersion := precision + time.Duration(float64(rtt)*frequencyTolerance)
+	return delay/2 + rootDispersion + dispersion + jitter
+}
+
+// parseRootDelay 从应答中解析根延迟和根离散度
+// 版本3和版本4使用16.16定点数，NTPv5使用4.28定点数并位于时间尺度等字段之后
+func parseRootDelay(resp []byte, version NTPVersion) (delay, dispersion time.Duration) {
+	if version == Version5 {
+		return fixedPoint(binary.BigEndian.Uint32(resp[8:12]), 28),
+			fixedPoint(binary.BigEndian.Uint32(resp[12:16]), 28)
+	}
+	return fixedPoint(binary.BigEndian.Uint32(resp[4:8]), 16),
+		fixedPoint(binary.BigEndian.Uint32(resp[8:12]), 16)
+}
+
+// fixedPoint 将小数部分为frac位的无符号定点秒数转换为时长
+func fixedPoint(v uint32, frac uint) time.Duration {
+	return time.Duration(uint64(v) * uint64(time.Second) >> frac)
+}
+
+// parsePrecision 将应答中以2为底的对数表示的精度转换为时长
+func parsePrecision(b byte) time.Duration {
+	return log2Duration(int8(b))
+}
+
+// parsePoll 将应答中以2为底的对数表示的轮询间隔转换为时长，0表示服务器没有设置
+func parsePoll(b byte) time.Duration {
+	if b == 0 {
+		return 0
+	}
+	return log2Duration(int8(b))
+}
+
+// log2Duration 将2的exp次方秒转换为时长，超出time.Duration的范围或小于1纳秒时返回0
+func log2Duration(exp int8) time.Duration {
+	switch {
+	case exp > 32 || exp < -30:
+		return 0
+	case exp >= 0:
+		return time.Second << uint(exp)
+	}
+	return time.Second >> uint(-exp)
+}
+
+// maxDistanceLimit 返回允许的最大根距离，不大于0表示不限制
+func (n *NTPSync) maxDistanceLimit() time.Duration {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	return n.maxDistance
+}
@@ -0,0 +1,113 @@
+package ntpsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestRootDistance 测试根距离的计算
+func TestRootDistance(t *testing.T) {
+	// 延迟低于MINDISP时按MINDISP计算
+	if got, want := rootDistance(0, 0, 0, 0, 0), minDispersion/2; got != want {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+
+	got := rootDistance(20*time.Millisecond, 5*time.Millisecond, 10*time.Millisecond, time.Microsecond, 2*time.Millisecond)
+	want := 15*time.Millisecond + 5*time.Millisecond + time.Microsecond + 150*time.Nanosecond + 2*time.Millisecond
+	if got != want {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+
+	if got := parsePrecision(0xEC); got != time.Second>>20 {
+		t.Errorf("预期精度为2^-20秒，实际得到%v", got)
+	}
+	if got := fixedPoint(0x00018000, 16); got != 1500*time.Millisecond {
+		t.Errorf("预期1.5秒，实际得到%v", got)
+	}
+}
+
+// TestMaxDistance 测试拒绝根距离过大的服务器并改用下一个服务器
+func TestMaxDistance(t *testing.T) {
+	far := ntptest.NewServer()
+	defer far.Close()
+	far.SetRootDispersion(2 * time.Second)
+	far.SetOffset(time.Hour)
+
+	near := ntptest.NewServer()
+	defer near.Close()
+	near.SetRootDelay(20 * time.Millisecond)
+	near.SetOffset(time.Second)
+
+	ntp, err := New(Options{Servers: []string{far.Addr(), near.Addr()}, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if _, err := ntp.syncWithServerBinary(far.Addr(), time.Second); !errors.Is(err, ErrRootDistanceExceeded) {
+		t.Errorf("预期返回ErrRootDistanceExceeded，实际得到%v", err)
+	}
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	history := ntp.GetHistory(1)
+	if len(history) != 1 || history[0].Server != near.Addr() {
+		t.Fatalf("预期使用根距离较小的服务器同步，实际得到%+v", history)
+	}
+	if d := history[0].RootDistance; d < 10*time.Millisecond || d > 100*time.Millisecond {
+		t.Errorf("预期根距离约为14ms，实际得到%v", d)
+	}
+}
+
+// TestResponseQuality 测试结果和服务器状态中应答的质量字段
+func TestResponseQuality(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetRootDelay(20 * time.Millisecond)
+	srv.SetRootDispersion(5 * time.Millisecond)
+	srv.SetPoll(6)
+
+	ntp, err := New(Options{Servers: []string{srv.Addr()}, Timeout: time.Second, MinPollInterval: -1})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	result, err := ntp.syncWithServerBinary(srv.Addr(), time.Second)
+	if err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	// 16.16定点数的分辨率约为15微秒
+	if diff := result.RootDelay - 20*time.Millisecond; diff < -20*time.Microsecond || diff > 20*time.Microsecond {
+		t.Errorf("预期根延迟约为20ms，实际得到%v", result.RootDelay)
+	}
+	if diff := result.RootDispersion - 5*time.Millisecond; diff < -20*time.Microsecond || diff > 20*time.Microsecond {
+		t.Errorf("预期根离散度约为5ms，实际得到%v", result.RootDispersion)
+	}
+	if result.Precision != time.Second>>20 {
+		t.Errorf("预期精度为2^-20秒，实际得到%v", result.Precision)
+	}
+	if result.Poll != 64*time.Second {
+		t.Errorf("预期轮询间隔为64秒，实际得到%v", result.Poll)
+	}
+
+	statuses, err := ntp.GetStatusBinary()
+	if err != nil || len(statuses) != 1 {
+		t.Fatalf("获取服务器状态失败: %v, %v", statuses, err)
+	}
+	s := statuses[0]
+	if s.RootDelay != result.RootDelay || s.RootDispersion != result.RootDispersion || s.Precision != result.Precision || s.Poll != result.Poll {
+		t.Errorf("服务器状态与结果不一致: %+v", s)
+	}
+
+	if got := parsePoll(0); got != 0 {
+		t.Errorf("预期没有设置的轮询间隔为0，实际得到%v", got)
+	}
+	if got := parsePrecision(0x7F); got != 0 {
+		t.Errorf("预期超出范围的精度为0，实际得到%v", got)
+	}
+}
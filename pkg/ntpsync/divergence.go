@@ -0,0 +1,178 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultDivergenceThreshold 是服务器之间偏移量之差的默认上限
+const DefaultDivergenceThreshold = 100 * time.Millisecond
+
+// ErrServersDiverged 表示服务器之间的偏移量之差超过了阈值
+var ErrServersDiverged = errors.New("服务器之间的偏移量不一致")
+
+// ServerDivergence 表示两个服务器之间不一致的测量
+type ServerDivergence struct {
+	// Server 和 Peer 是不一致的两个服务器，按配置的顺序排列
+	Server string
+	Peer   string
+
+	// Offset 和 PeerOffset 是两个服务器测得的偏移量
+	Offset     time.Duration
+	PeerOffset time.Duration
+
+	// Difference 是两者之差的绝对值
+	Difference time.Duration
+}
+
+// DivergenceReport 是一次交叉检查的结果
+type DivergenceReport struct {
+	// Time 是检查的时间
+	Time time.Time
+
+	// Threshold 是检查使用的阈值
+	Threshold time.Duration
+
+	// Offsets 是每个可达服务器测得的偏移量
+	Offsets map[string]time.Duration
+
+	// Unreachable 是没有测得偏移量的服务器
+	Unreachable []string
+
+	// Divergences 是偏移量之差超过阈值的服务器对
+	Divergences []ServerDivergence
+
+	// Suspects 是偏移量偏离所有可达服务器中位数超过阈值的服务器，
+	// 只在至少三个服务器可达、能够形成多数时判断
+	Suspects []string
+}
+
+// CheckServerDivergence 测量所有服务器并两两比较偏移量，用于发现被入侵或配置错误的内部时间服务器
+// 每对偏移量之差超过threshold的服务器发布一个EventServersDiverged事件，并返回包装ErrServersDiverged的错误；
+// threshold不大于0时使用Options.DivergenceThreshold，仍未设置时使用DefaultDivergenceThreshold。
+// 检查不修改当前的偏移量；因请求限速不能立即测量的服务器使用最近一次的测量
+func (n *NTPSync) CheckServerDivergence(threshold time.Duration) (*DivergenceReport, error) {
+	n.mutex.RLock()
+	if n.closed {
+		n.mutex.RUnlock()
+		return nil, ErrClosed
+	}
+	servers := append([]string(nil), n.servers...)
+	timeout := n.timeout
+	if threshold <= 0 {
+		threshold = n.divergenceThreshold
+	}
+	n.mutex.RUnlock()
+	if threshold <= 0 {
+		threshold = DefaultDivergenceThreshold
+	}
+
+	// 并行测量所有服务器
+	offsets := make([]*time.Duration, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+
+			result, err := n.probeServer(server, timeout)
+			n.recordServerResult(n.serverManager, server, result, err)
+			switch {
+			case err == nil:
+				offsets[i] = &result.Offset
+			case errors.Is(err, ErrRateLimited):
+				offsets[i] = n.lastServerOffset(server)
+			}
+		}(i, server)
+	}
+	wg.Wait()
+
+	if n.isClosed() {
+		return nil, ErrClosed
+	}
+
+	report := &DivergenceReport{
+		Time:      n.clock.Now(),
+		Threshold: threshold,
+		Offsets:   make(map[string]time.Duration, len(servers)),
+	}
+	var reachable []string
+	for i, server := range servers {
+		if offsets[i] == nil {
+			report.Unreachable = append(report.Unreachable, server)
+			continue
+		}
+		report.Offsets[server] = *offsets[i]
+		reachable = append(reachable, server)
+	}
+
+	for i, server := range reachable {
+		for _, peer := range reachable[i+1:] {
+			diff := absDuration(report.Offsets[server] - report.Offsets[peer])
+			if diff > threshold {
+				report.Divergences = append(report.Divergences, ServerDivergence{
+					Server:     server,
+					Peer:       peer,
+					Offset:     report.Offsets[server],
+					PeerOffset: report.Offsets[peer],
+					Difference: diff,
+				})
+			}
+		}
+	}
+
+	if len(reachable) >= 3 {
+		values := make([]time.Duration, 0, len(reachable))
+		for _, server := range reachable {
+			values = append(values, report.Offsets[server])
+		}
+		median := medianDuration(values)
+		for _, server := range reachable {
+			if absDuration(report.Offsets[server]-median) > threshold {
+				report.Suspects = append(report.Suspects, server)
+			}
+		}
+	}
+
+	if len(report.Divergences) == 0 {
+		return report, nil
+	}
+
+	for _, d := range report.Divergences {
+		n.emit(Event{Type: EventServersDiverged, Server: d.Server, Peer: d.Peer, Offset: d.Difference})
+	}
+	worst := report.Divergences[0]
+	for _, d := range report.Divergences[1:] {
+		if d.Difference > worst.Difference {
+			worst = d
+		}
+	}
+	return report, fmt.Errorf("%w: %d对服务器之差超过 %v，最大为 %s 与 %s 相差 %v",
+		ErrServersDiverged, len(report.Divergences), threshold, worst.Server, worst.Peer, worst.Difference)
+}
+
+// lastServerOffset 返回服务器最近一次测量的偏移量，没有测量时返回nil
+func (n *NTPSync) lastServerOffset(server string) *time.Duration {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	w, ok := n.serverOffsets[serverAddress(server)]
+	if !ok || w.count == 0 {
+		return nil
+	}
+	values := w.values()
+	return &values[len(values)-1]
+}
+
+// checkDivergence 在定时同步之后进行交叉检查，没有设置DivergenceThreshold时不做任何事
+func (n *NTPSync) checkDivergence() {
+	n.mutex.RLock()
+	threshold := n.divergenceThreshold
+	n.mutex.RUnlock()
+
+	if threshold > 0 {
+		_, _ = n.CheckServerDivergence(threshold)
+	}
+}
@@ -0,0 +1,124 @@
+package ntpsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// newDivergenceServers 创建偏移量分别为offsets的测试服务器
+func newDivergenceServers(t *testing.T, offsets ...time.Duration) []string {
+	t.Helper()
+
+	addrs := make([]string, len(offsets))
+	for i, offset := range offsets {
+		srv := ntptest.NewServer()
+		t.Cleanup(srv.Close)
+		srv.SetOffset(offset)
+		addrs[i] = srv.Addr()
+	}
+	return addrs
+}
+
+// TestCheckServerDivergence 测试两两比较偏移量并找出偏离多数的服务器
+func TestCheckServerDivergence(t *testing.T) {
+	servers := newDivergenceServers(t, time.Second, time.Second+10*time.Millisecond, 3*time.Second)
+	servers = append(servers, "127.0.0.1:1")
+
+	ntp, err := New(Options{Servers: servers, Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	// 第一个服务器刚刚同步过，交叉检查受限速影响时使用这次的测量
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	offset := ntp.TimeOffsetDuration()
+
+	events, cancel := ntp.Subscribe(0)
+	defer cancel()
+
+	report, err := ntp.CheckServerDivergence(100 * time.Millisecond)
+	if !errors.Is(err, ErrServersDiverged) {
+		t.Fatalf("预期ErrServersDiverged，实际得到%v", err)
+	}
+	if got := report.Offsets[servers[0]]; got != offset {
+		t.Errorf("预期受限速的服务器使用最近的测量%v，实际得到%v", offset, got)
+	}
+	if len(report.Offsets) != 3 || len(report.Unreachable) != 1 || report.Unreachable[0] != servers[3] {
+		t.Errorf("可达服务器错误: %v，不可达: %v", report.Offsets, report.Unreachable)
+	}
+	if len(report.Divergences) != 2 {
+		t.Fatalf("预期2对服务器不一致，实际得到%+v", report.Divergences)
+	}
+	for _, d := range report.Divergences {
+		if d.Peer != servers[2] || d.Difference < 1900*time.Millisecond {
+			t.Errorf("不一致的服务器对错误: %+v", d)
+		}
+	}
+	if len(report.Suspects) != 1 || report.Suspects[0] != servers[2] {
+		t.Errorf("预期偏离多数的服务器为%s，实际得到%v", servers[2], report.Suspects)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-events:
+			if ev.Type != EventServersDiverged || ev.Peer != servers[2] || ev.Offset != report.Divergences[i].Difference {
+				t.Errorf("事件错误: %+v", ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("等待不一致事件超时")
+		}
+	}
+
+	// 检查不修改当前的偏移量
+	if got := ntp.TimeOffsetDuration(); got != offset {
+		t.Errorf("交叉检查修改了偏移量: %v -> %v", offset, got)
+	}
+
+	if _, err := ntp.CheckServerDivergence(5 * time.Second); err != nil {
+		t.Errorf("预期阈值足够大时没有错误，实际得到%v", err)
+	}
+}
+
+// TestDivergenceAfterPeriodicSync 测试设置DivergenceThreshold后定时同步之后自动检查
+func TestDivergenceAfterPeriodicSync(t *testing.T) {
+	servers := newDivergenceServers(t, 0, 500*time.Millisecond)
+
+	ntp, err := New(Options{
+		Servers:             servers,
+		Timeout:             time.Second,
+		SyncInterval:        time.Hour,
+		DivergenceThreshold: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	events, cancel := ntp.Subscribe(0)
+	defer cancel()
+
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type != EventServersDiverged {
+				continue
+			}
+			if ev.Server != servers[0] || ev.Peer != servers[1] {
+				t.Errorf("事件错误: %+v", ev)
+			}
+			return
+		case <-deadline:
+			t.Fatal("等待不一致事件超时")
+		}
+	}
+}
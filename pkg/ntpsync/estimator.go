@@ -0,0 +1,180 @@
+package ntpsync
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Estimator 根据一系列测量估计应用到Now的偏移量，参见Options.Estimator
+//
+// 实例按时间顺序依次调用Estimator的方法，不会并发调用；一个Estimator只能用于一个NTPSync实例
+type Estimator interface {
+	// Update 加入本地时间为local时的一次成功的测量，返回应用到Now的偏移量
+	Update(local time.Time, result *SyncResult) time.Duration
+
+	// Reset 丢弃之前的测量，偏移量发生跳变、系统时钟被外部调整或系统休眠后调用
+	Reset()
+}
+
+// estimateLocked 返回应用到Now的偏移量，没有设置Estimator时直接使用测量的偏移量，
+// 首次同步和变化不小于stepThreshold时先重置Estimator，调用者必须持有n.mutex
+func (n *NTPSync) estimateLocked(local time.Time, previous time.Duration, result *SyncResult, first bool) time.Duration {
+	if n.estimator == nil {
+		return result.Offset
+	}
+
+	step := n.thresholds.stepThreshold
+	if step <= 0 {
+		step = DefaultStepThreshold
+	}
+	if first || absDuration(result.Offset-previous) >= step {
+		n.estimator.Reset()
+	}
+	return n.estimator.Update(local, result)
+}
+
+// resetEstimatorLocked 重置Estimator，调用者必须持有n.mutex
+func (n *NTPSync) resetEstimatorLocked() {
+	if n.estimator != nil {
+		n.estimator.Reset()
+	}
+}
+
+// Kalman滤波器的默认参数
+const (
+	// DefaultKalmanMeasurementNoise 是测量噪声标准差的下限
+	DefaultKalmanMeasurementNoise = time.Millisecond
+
+	// DefaultKalmanPhaseNoise 是相位白噪声的谱密度（秒²/秒），相当于每秒约1微秒的随机游走
+	DefaultKalmanPhaseNoise = 1e-12
+
+	// DefaultKalmanFrequencyNoise 是频率随机游走的谱密度（1/秒），
+	// 相当于普通晶振的频率每小时变化约0.01ppm
+	DefaultKalmanFrequencyNoise = 3e-20
+)
+
+// kalmanInitialFrequencyVariance 是第一次测量后频率偏差的方差，相当于100ppm的标准差
+const kalmanInitialFrequencyVariance = 1e-8
+
+// KalmanOptions 是Kalman滤波器的参数，零值表示使用对应的默认值
+type KalmanOptions struct {
+	// MeasurementNoise 是测量噪声标准差的下限。每次测量的噪声按往返时间的一半估计，
+	// 即非对称延迟可能造成的最大误差，但不小于此值
+	MeasurementNoise time.Duration
+
+	// PhaseNoise 是相位白噪声的谱密度（秒²/秒），越大越相信新的测量
+	PhaseNoise float64
+
+	// FrequencyNoise 是频率随机游走的谱密度（1/秒），越大频率估计跟随温度等变化越快
+	FrequencyNoise float64
+}
+
+// KalmanEstimator 以偏移量和频率偏差为状态的双状态Kalman滤波器，根据每次测量的往返时间
+// 估计测量噪声：往返时间长的测量权重小，在延迟抖动很大的蜂窝网络上比直接使用最新的测量
+// 更平滑也更准确。创建后作为Options.Estimator使用
+type KalmanEstimator struct {
+	opts KalmanOptions
+
+	mutex       sync.Mutex
+	initialized bool
+	last        time.Time
+
+	// offset 和 freq 是估计的偏移量（秒）和频率偏差（秒/秒）
+	offset float64
+	freq   float64
+
+	// p 是状态的协方差矩阵
+	p [2][2]float64
+}
+
+// NewKalmanEstimator 创建Kalman滤波器
+func NewKalmanEstimator(opts KalmanOptions) *KalmanEstimator {
+	if opts.MeasurementNoise <= 0 {
+		opts.MeasurementNoise = DefaultKalmanMeasurementNoise
+	}
+	if opts.PhaseNoise <= 0 {
+		opts.PhaseNoise = DefaultKalmanPhaseNoise
+	}
+	if opts.FrequencyNoise <= 0 {
+		opts.FrequencyNoise = DefaultKalmanFrequencyNoise
+	}
+	return &KalmanEstimator{opts: opts}
+}
+
+// Update 先按频率偏差把状态预测到local，再用测量的偏移量修正，返回估计的偏移量
+func (k *KalmanEstimator) Update(local time.Time, result *SyncResult) time.Duration {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	z := result.Offset.Seconds()
+	noise := max(result.RTT/2, k.opts.MeasurementNoise).Seconds()
+	r := noise * noise
+
+	if !k.initialized {
+		k.initialized = true
+		k.last = local
+		k.offset, k.freq = z, 0
+		k.p = [2][2]float64{{r, 0}, {0, kalmanInitialFrequencyVariance}}
+		return result.Offset
+	}
+
+	// 预测：x = F x，P = F P Fᵀ + Q，其中F = [[1, dt], [0, 1]]
+	dt := local.Sub(k.last).Seconds()
+	if dt < 0 {
+		dt = 0
+	}
+	k.last = local
+	k.offset += k.freq * dt
+	p := k.p
+	k.p[0][0] = p[0][0] + dt*(p[0][1]+p[1][0]) + dt*dt*p[1][1] +
+		k.opts.PhaseNoise*dt + k.opts.FrequencyNoise*dt*dt*dt/3
+	k.p[0][1] = p[0][1] + dt*p[1][1] + k.opts.FrequencyNoise*dt*dt/2
+	k.p[1][0] = k.p[0][1]
+	k.p[1][1] = p[1][1] + k.opts.FrequencyNoise*dt
+
+	// 修正：只观测偏移量，H = [1, 0]
+	s := k.p[0][0] + r
+	k0, k1 := k.p[0][0]/s, k.p[1][0]/s
+	innovation := z - k.offset
+	k.offset += k0 * innovation
+	k.freq += k1 * innovation
+	p = k.p
+	k.p[0][0] = (1 - k0) * p[0][0]
+	k.p[0][1] = (1 - k0) * p[0][1]
+	k.p[1][0] = p[1][0] - k1*p[0][0]
+	k.p[1][1] = p[1][1] - k1*p[0][1]
+
+	return time.Duration(math.Round(k.offset * float64(time.Second)))
+}
+
+// Reset 丢弃之前的状态，下一次测量重新初始化滤波器
+func (k *KalmanEstimator) Reset() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.initialized = false
+}
+
+// Frequency 返回估计的频率偏差，单位为ppm，正值表示偏移量随时间增大，即本地时钟走得慢；
+// 还没有测量时返回0
+func (k *KalmanEstimator) Frequency() float64 {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if !k.initialized {
+		return 0
+	}
+	return k.freq * 1e6
+}
+
+// Uncertainty 返回估计的偏移量的标准差，还没有测量时返回0
+func (k *KalmanEstimator) Uncertainty() time.Duration {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if !k.initialized {
+		return 0
+	}
+	return time.Duration(math.Sqrt(k.p[0][0]) * float64(time.Second))
+}
@@ -0,0 +1,99 @@
+package ntpsync
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestKalmanEstimator 测试Kalman滤波器从有噪声的测量中估计偏移量和频率偏差
+func TestKalmanEstimator(t *testing.T) {
+	k := NewKalmanEstimator(KalmanOptions{})
+	if k.Frequency() != 0 || k.Uncertainty() != 0 {
+		t.Error("预期没有测量时频率偏差和误差为0")
+	}
+
+	// 真实偏移量为10ms加上20ppm的漂移，测量噪声的标准差为5ms
+	rng := rand.New(rand.NewSource(1))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	truth := func(local time.Time) time.Duration {
+		return 10*time.Millisecond + time.Duration(20e-6*float64(local.Sub(start)))
+	}
+	var rawErr, estErr float64
+	for i := 0; i < 200; i++ {
+		local := start.Add(time.Duration(i) * 64 * time.Second)
+		noise := time.Duration(rng.NormFloat64() * float64(5*time.Millisecond))
+		got := k.Update(local, &SyncResult{Offset: truth(local) + noise, RTT: 10 * time.Millisecond})
+		if i >= 100 {
+			rawErr += math.Abs(float64(noise))
+			estErr += math.Abs(float64(got - truth(local)))
+		}
+	}
+	if estErr >= rawErr/2 {
+		t.Errorf("预期估计的误差明显小于测量的误差，实际为%v和%v", time.Duration(estErr/100), time.Duration(rawErr/100))
+	}
+	if f := k.Frequency(); f < 18 || f > 22 {
+		t.Errorf("预期频率偏差约为20ppm，实际得到%.2f", f)
+	}
+	if u := k.Uncertainty(); u <= 0 || u > 5*time.Millisecond {
+		t.Errorf("预期误差小于测量噪声，实际得到%v", u)
+	}
+
+	// 重置后直接采用下一次测量
+	k.Reset()
+	if got := k.Update(start, &SyncResult{Offset: time.Second}); got != time.Second {
+		t.Errorf("预期重置后采用测量的偏移量，实际得到%v", got)
+	}
+}
+
+// TestEstimatorOption 测试设置Estimator后Now使用估计的偏移量，历史中仍然是测量的偏移量
+func TestEstimatorOption(t *testing.T) {
+	clock := newFakeClock()
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(100 * time.Millisecond)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		MinPollInterval: -1,
+		Estimator:       NewKalmanEstimator(KalmanOptions{MeasurementNoise: 10 * time.Millisecond}),
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if offset, raw := ntp.TimeOffsetDuration(), ntp.GetHistory(1)[0].Offset; offset != raw {
+		t.Errorf("预期首次同步直接采用测量的偏移量%v，实际得到%v", raw, offset)
+	}
+
+	srv.SetOffset(110 * time.Millisecond)
+	clock.Advance(time.Minute)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if offset := ntp.TimeOffsetDuration(); offset <= 101*time.Millisecond || offset >= 109*time.Millisecond {
+		t.Errorf("预期估计的偏移量在两次测量之间，实际得到%v", offset)
+	}
+	if r := ntp.GetHistory(1)[0]; absDuration(r.Offset-110*time.Millisecond) > time.Microsecond {
+		t.Errorf("预期历史中是测量的偏移量，实际得到%v", r.Offset)
+	}
+
+	// 偏移量跳变后重置滤波器
+	srv.SetOffset(time.Second)
+	clock.Advance(time.Minute)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if offset, raw := ntp.TimeOffsetDuration(), ntp.GetHistory(1)[0].Offset; offset != raw {
+		t.Errorf("预期跳变后直接采用测量的偏移量%v，实际得到%v", raw, offset)
+	}
+}
@@ -0,0 +1,111 @@
+package ntpsync
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType 表示同步事件的类型
+type EventType string
+
+// 同步客户端发布的事件类型
+const (
+	EventSyncSucceeded       EventType = "sync_succeeded"        // 同步成功
+	EventSyncFailed          EventType = "sync_failed"           // 同步失败
+	EventSyncRejected        EventType = "sync_rejected"         // 偏移量被判定为异常值
+	EventOffsetTooLarge      EventType = "offset_too_large"      // 偏移量超过MaxOffset
+	EventServerAdded         EventType = "server_added"          // 添加了服务器
+	EventServerRemoved       EventType = "server_removed"        // 移除了服务器
+	EventIntervalChanged     EventType = "interval_changed"      // 同步间隔已修改
+	EventResumed             EventType = "resumed"               // 检测到系统从休眠中恢复
+	EventServersDiverged     EventType = "servers_diverged"      // 两个服务器的偏移量之差超过阈值
+	EventClockStepped        EventType = "clock_stepped"         // 系统时钟被其它程序直接调整
+	EventHardwareClockFailed EventType = "hardware_clock_failed" // 写入硬件时钟失败
+	EventStatsWriteFailed    EventType = "stats_write_failed"    // 写入测量日志失败
+	EventSystemTimeSet       EventType = "system_time_set"       // UpdateSystemTime调整了系统时间
+	EventSystemTimeFailed    EventType = "system_time_failed"    // 调整系统时间失败或没有通过检查
+)
+
+// DefaultEventBuffer 是事件订阅通道的默认缓冲大小
+const DefaultEventBuffer = 16
+
+// Event 表示同步客户端发生的一个事件
+type Event struct {
+	// Type 是事件类型
+	Type EventType `json:"type"`
+
+	// Time 是事件发生的时间
+	Time time.Time `json:"time"`
+
+	// Server 是与事件相关的服务器地址
+	Server string `json:"server,omitempty"`
+
+	// Offset 是同步成功时计算的偏移量，服务器之间不一致时为两者偏移量之差，
+	// 系统时钟被外部调整时为调整量（正值表示向前调整）
+	Offset time.Duration `json:"offset"`
+
+	// Peer 是服务器之间不一致时与Server比较的另一个服务器
+	Peer string `json:"peer,omitempty"`
+
+	// Interval 是同步间隔修改后的新值
+	Interval time.Duration `json:"interval"`
+
+	// Suspended 是从休眠中恢复时检测到的休眠时长
+	Suspended time.Duration `json:"suspended"`
+
+	// Error 是同步失败时的错误
+	Error error `json:"-"`
+}
+
+// eventBus 将事件分发给所有订阅者
+type eventBus struct {
+	mutex       sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// Subscribe 订阅同步事件，返回事件通道和取消订阅的函数
+// 订阅者处理过慢时，新事件会被丢弃而不会阻塞同步过程
+func (n *NTPSync) Subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+
+	ch := make(chan Event, buffer)
+
+	n.events.mutex.Lock()
+	if n.events.subscribers == nil {
+		n.events.subscribers = make(map[chan Event]struct{})
+	}
+	n.events.subscribers[ch] = struct{}{}
+	n.events.mutex.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			n.events.mutex.Lock()
+			delete(n.events.subscribers, ch)
+			n.events.mutex.Unlock()
+			close(ch)
+		})
+	}
+
+	return ch, cancel
+}
+
+// emit 向所有订阅者发布事件
+func (n *NTPSync) emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = n.clock.Now()
+	}
+
+	n.events.mutex.Lock()
+	defer n.events.mutex.Unlock()
+
+	for ch := range n.events.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// 订阅者缓冲已满，丢弃事件
+		}
+	}
+}
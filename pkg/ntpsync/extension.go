@@ -0,0 +1,218 @@
+package ntpsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// 扩展字段的类型（RFC 7822、RFC 8915）
+const (
+	ExtensionUniqueIdentifier     uint16 = 0x0104 // NTS唯一标识
+	ExtensionNTSCookie            uint16 = 0x0204 // NTS Cookie
+	ExtensionNTSCookiePlaceholder uint16 = 0x0304 // NTS Cookie占位
+	ExtensionNTSAuthenticator     uint16 = 0x0404 // NTS认证和加密的扩展字段
+)
+
+// 扩展字段的长度限制
+const (
+	// extensionHeaderSize 是扩展字段头（类型和长度）的长度
+	extensionHeaderSize = 4
+
+	// minExtensionSize 是扩展字段的最小长度（RFC 7822）
+	minExtensionSize = 16
+
+	// minLastExtensionSize 是没有MAC时最后一个扩展字段的最小长度，
+	// 避免与20或24字节的MAC混淆
+	minLastExtensionSize = 28
+)
+
+// ErrInvalidPacket 表示NTP数据包的格式无效，编码和解析数据包返回的错误都包装此错误
+var ErrInvalidPacket = errors.New("无效的NTP数据包")
+
+// packetSize 是不含扩展字段的NTP数据包长度
+const packetSize = 48
+
+// maxPacketSize 是接收NTP数据包时允许的最大长度
+const maxPacketSize = 1024
+
+// ExtensionField 是NTP数据包头之后的一个扩展字段（RFC 7822）
+// NTS、认证以及实验性的功能都通过扩展字段携带，
+// 无法识别的扩展字段原样保留，供调用者检查
+type ExtensionField struct {
+	// Type 是扩展字段的类型
+	Type uint16 `json:"type"`
+
+	// Value 是扩展字段的内容，不含填充
+	// 解析得到的Value包含发送方的填充，长度总是4的倍数
+	Value []byte `json:"value"`
+}
+
+// AppendExtensionField 将扩展字段编码后追加到b
+// 内容以零填充到4字节的倍数，整个字段不少于16字节
+func AppendExtensionField(b []byte, f ExtensionField) ([]byte, error) {
+	return appendExtensionField(b, f, minExtensionSize)
+}
+
+// appendExtensionField 追加扩展字段，不足minLength时以零填充
+func appendExtensionField(b []byte, f ExtensionField, minLength int) ([]byte, error) {
+	length := extensionHeaderSize + (len(f.Value)+3)/4*4
+	if length < minLength {
+		length = minLength
+	}
+	if length > 0xffff {
+		return nil, fmt.Errorf("%w: 扩展字段过长: %d字节", ErrInvalidPacket, length)
+	}
+
+	b = binary.BigEndian.AppendUint16(b, f.Type)
+	b = binary.BigEndian.AppendUint16(b, uint16(length))
+	b = append(b, f.Value...)
+	for i := extensionHeaderSize + len(f.Value); i < length; i++ {
+		b = append(b, 0)
+	}
+	return b, nil
+}
+
+// ParseExtensionFields 解析数据包头之后的扩展字段和末尾的消息认证码(MAC)
+//
+// 按RFC 7822，剩余长度为20或24字节（4字节密钥ID加MD5或SHA-1摘要）时
+// 视为旧式MAC而不是扩展字段，以原始字节返回
+func ParseExtensionFields(data []byte) ([]ExtensionField, []byte, error) {
+	var fields []ExtensionField
+	for len(data) > 0 {
+		if len(data) == 20 || len(data) == 24 {
+			return fields, data, nil
+		}
+		if len(data) < minExtensionSize {
+			return nil, nil, fmt.Errorf("%w: 扩展字段剩余%d字节", ErrInvalidPacket, len(data))
+		}
+
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if length < minExtensionSize || length%4 != 0 || length > len(data) {
+			return nil, nil, fmt.Errorf("%w: 扩展字段长度%d", ErrInvalidPacket, length)
+		}
+		fields = append(fields, ExtensionField{
+			Type:  binary.BigEndian.Uint16(data[0:2]),
+			Value: append([]byte(nil), data[extensionHeaderSize:length]...),
+		})
+		data = data[length:]
+	}
+	return fields, nil, nil
+}
+
+// appendExtensions 将多个扩展字段追加到数据包，hasMAC表示之后是否还有MAC
+func appendExtensions(b []byte, fields []ExtensionField, hasMAC bool) ([]byte, error) {
+	var err error
+	for i, f := range fields {
+		minLength := minExtensionSize
+		if i == len(fields)-1 && !hasMAC {
+			minLength = minLastExtensionSize
+		}
+		if b, err = appendExtensionField(b, f, minLength); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// copyExtensions 深拷贝扩展字段，避免调用者之后修改
+func copyExtensions(fields []ExtensionField) []ExtensionField {
+	if len(fields) == 0 {
+		return nil
+	}
+	copied := make([]ExtensionField, len(fields))
+	for i, f := range fields {
+		copied[i] = ExtensionField{Type: f.Type, Value: append([]byte(nil), f.Value...)}
+	}
+	return copied
+}
+
+// MarshalBinary 将数据包编码为网络字节序，包括扩展字段和MAC
+// 没有MAC时最后一个扩展字段至少填充到28字节（RFC 7822）。
+// 版本、模式或MAC长度无效时返回包装ErrInvalidPacket的错误，保证编码结果可以被UnmarshalBinary解析
+func (p *NTPPacket) MarshalBinary() ([]byte, error) {
+	return p.AppendBinary(make([]byte, 0, packetSize+len(p.MAC)))
+}
+
+// AppendBinary 与MarshalBinary相同，但将编码结果追加到b
+// b的容量足够时不分配内存，适合在发送循环中复用缓冲区
+func (p *NTPPacket) AppendBinary(b []byte) ([]byte, error) {
+	if err := validateSettings(p.Settings); err != nil {
+		return nil, err
+	}
+	if len(p.MAC) != 0 && len(p.MAC) != 20 && len(p.MAC) != 24 {
+		return nil, fmt.Errorf("%w: MAC长度%d不是20或24字节", ErrInvalidPacket, len(p.MAC))
+	}
+
+	b = append(b, p.Settings, p.Stratum, byte(p.Poll), byte(p.Precision))
+	for _, w := range [...]uint32{
+		p.RootDelay, p.RootDispersion, p.ReferenceID,
+		p.RefTimeSec, p.RefTimeFrac, p.OrigTimeSec, p.OrigTimeFrac,
+		p.RxTimeSec, p.RxTimeFrac, p.TxTimeSec, p.TxTimeFrac,
+	} {
+		b = binary.BigEndian.AppendUint32(b, w)
+	}
+
+	b, err := appendExtensions(b, p.Extensions, len(p.MAC) > 0)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, p.MAC...), nil
+}
+
+// UnmarshalBinary 解析网络字节序的数据包，包括扩展字段和MAC
+// 任何输入都不会引起panic：长度、版本、模式或扩展字段无效时返回包装ErrInvalidPacket的错误，
+// 此时p保持不变
+func (p *NTPPacket) UnmarshalBinary(data []byte) error {
+	if len(data) < packetSize {
+		return fmt.Errorf("%w: 长度%d小于%d字节", ErrInvalidPacket, len(data), packetSize)
+	}
+	if len(data)%4 != 0 {
+		return fmt.Errorf("%w: 长度%d不是4字节的倍数", ErrInvalidPacket, len(data))
+	}
+	if err := validateSettings(data[0]); err != nil {
+		return err
+	}
+
+	fields, mac, err := ParseExtensionFields(data[packetSize:])
+	if err != nil {
+		return err
+	}
+
+	p.decodeHeader(data)
+	p.Extensions = fields
+	p.MAC = mac
+	return nil
+}
+
+// decodeHeader 解析data开头48字节的数据包头，不做任何检查
+func (p *NTPPacket) decodeHeader(data []byte) {
+	p.Settings = data[0]
+	p.Stratum = data[1]
+	p.Poll = int8(data[2])
+	p.Precision = int8(data[3])
+	words := []*uint32{
+		&p.RootDelay, &p.RootDispersion, &p.ReferenceID,
+		&p.RefTimeSec, &p.RefTimeFrac, &p.OrigTimeSec, &p.OrigTimeFrac,
+		&p.RxTimeSec, &p.RxTimeFrac, &p.TxTimeSec, &p.TxTimeFrac,
+	}
+	for i, w := range words {
+		*w = binary.BigEndian.Uint32(data[4+4*i:])
+	}
+}
+
+// validateSettings 检查数据包的版本和模式
+// 版本必须为1到5；模式0保留不用，模式6和7的控制消息使用不同的格式
+func validateSettings(settings uint8) error {
+	version := NTPVersion(settings >> 3 & 0x7)
+	if version < 1 || version > Version5 {
+		return fmt.Errorf("%w: 版本%d", ErrInvalidPacket, version)
+	}
+	switch mode := NTPMode(settings & 0x7); mode {
+	case Reserved:
+		return fmt.Errorf("%w: 模式0为保留值", ErrInvalidPacket)
+	case ControlMessage, ReservedPrivate:
+		return fmt.Errorf("%w: 模式%d是控制消息，不是时间数据包", ErrInvalidPacket, mode)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package ntpsync
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestExtensionFieldEncoding 测试扩展字段的填充和解析
+func TestExtensionFieldEncoding(t *testing.T) {
+	b, err := AppendExtensionField(nil, ExtensionField{Type: 0x1234, Value: []byte("abc")})
+	if err != nil {
+		t.Fatalf("编码扩展字段失败: %v", err)
+	}
+	if len(b) != minExtensionSize {
+		t.Errorf("预期填充到%d字节，实际得到%d", minExtensionSize, len(b))
+	}
+
+	b, err = AppendExtensionField(b, ExtensionField{Type: ExtensionNTSCookie, Value: bytes.Repeat([]byte{0xAA}, 21)})
+	if err != nil {
+		t.Fatalf("编码扩展字段失败: %v", err)
+	}
+	if len(b) != minExtensionSize+28 {
+		t.Errorf("预期第二个字段填充到4字节的倍数，总长度为%d，实际得到%d", minExtensionSize+28, len(b))
+	}
+
+	fields, mac, err := ParseExtensionFields(b)
+	if err != nil {
+		t.Fatalf("解析扩展字段失败: %v", err)
+	}
+	if mac != nil || len(fields) != 2 {
+		t.Fatalf("预期2个扩展字段且没有MAC，实际得到%+v和%x", fields, mac)
+	}
+	if fields[0].Type != 0x1234 || !bytes.HasPrefix(fields[0].Value, []byte("abc")) {
+		t.Errorf("第一个扩展字段不正确: %+v", fields[0])
+	}
+	if fields[1].Type != ExtensionNTSCookie || len(fields[1].Value) != 24 {
+		t.Errorf("第二个扩展字段不正确: %+v", fields[1])
+	}
+
+	// 剩余20或24字节视为MAC
+	withMAC := append(append([]byte(nil), b...), make([]byte, 20)...)
+	if fields, mac, err = ParseExtensionFields(withMAC); err != nil || len(fields) != 2 || len(mac) != 20 {
+		t.Errorf("预期2个扩展字段和20字节的MAC，实际得到%d个、%d字节、%v", len(fields), len(mac), err)
+	}
+
+	invalid := [][]byte{
+		make([]byte, 8), // 不足最小长度
+		{0, 1, 0, 12, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, // 长度小于16
+		{0, 1, 0, 18, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, // 长度不是4的倍数
+		{0, 1, 0, 32, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, // 长度超出数据
+	}
+	for _, data := range invalid {
+		if _, _, err := ParseExtensionFields(data); err == nil {
+			t.Errorf("预期%x解析失败，实际成功", data)
+		}
+	}
+}
+
+// TestNTPPacketBinary 测试数据包的编码和解析
+func TestNTPPacketBinary(t *testing.T) {
+	packet := createNTPPacket()
+	packet.Extensions = []ExtensionField{{Type: 0x2005, Value: []byte("experimental")}}
+
+	b, err := packet.MarshalBinary()
+	if err != nil {
+		t.Fatalf("编码数据包失败: %v", err)
+	}
+	// 没有MAC时最后一个扩展字段至少28字节
+	if len(b) != packetSize+minLastExtensionSize {
+		t.Errorf("预期长度为%d，实际得到%d", packetSize+minLastExtensionSize, len(b))
+	}
+
+	var decoded NTPPacket
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatalf("解析数据包失败: %v", err)
+	}
+	if decoded.Settings != packet.Settings || decoded.TxTimeSec != packet.TxTimeSec || decoded.TxTimeFrac != packet.TxTimeFrac {
+		t.Errorf("数据包头不一致: 预期%+v，实际得到%+v", packet, decoded)
+	}
+	if len(decoded.Extensions) != 1 || decoded.Extensions[0].Type != 0x2005 {
+		t.Errorf("扩展字段不一致: %+v", decoded.Extensions)
+	}
+
+	packet.MAC = append([]byte{0, 0, 0, 1}, make([]byte, 16)...)
+	if b, err = packet.MarshalBinary(); err != nil {
+		t.Fatalf("编码数据包失败: %v", err)
+	}
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatalf("解析数据包失败: %v", err)
+	}
+	if !bytes.Equal(decoded.MAC, packet.MAC) || len(decoded.Extensions) != 1 {
+		t.Errorf("预期保留MAC和扩展字段，实际得到%x和%+v", decoded.MAC, decoded.Extensions)
+	}
+
+	if err := decoded.UnmarshalBinary(make([]byte, 40)); err == nil {
+		t.Error("预期过短的数据包解析失败，实际成功")
+	}
+}
+
+// TestSyncExtensions 测试请求附加扩展字段，以及应答中的扩展字段交给调用者
+func TestSyncExtensions(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+
+	unknown, err := AppendExtensionField(nil, ExtensionField{Type: 0xF00F, Value: bytes.Repeat([]byte{1}, 24)})
+	if err != nil {
+		t.Fatalf("编码扩展字段失败: %v", err)
+	}
+	srv.SetExtensions(unknown)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+		Extensions:      []ExtensionField{{Type: 0x2005, Value: []byte("hello")}},
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("预期1个请求，实际得到%d个", len(requests))
+	}
+	fields, _, err := ParseExtensionFields(requests[0].Data[packetSize:])
+	if err != nil || len(fields) != 1 || fields[0].Type != 0x2005 || !bytes.HasPrefix(fields[0].Value, []byte("hello")) {
+		t.Errorf("预期请求带有扩展字段，实际得到%+v、%v", fields, err)
+	}
+
+	history := ntp.GetHistory(1)
+	if len(history) != 1 || len(history[0].Extensions) != 1 || history[0].Extensions[0].Type != 0xF00F {
+		t.Errorf("预期结果中有无法识别的扩展字段，实际得到%+v", history)
+	}
+
+	// 无效的扩展字段使应答被拒绝
+	srv.SetExtensions(make([]byte, 8))
+	if err := ntp.Sync(); err == nil {
+		t.Error("预期无效的扩展字段导致同步失败，实际成功")
+	}
+}
+
+// TestNTPPacketValidation 测试无效的版本、模式和MAC长度
+func TestNTPPacketValidation(t *testing.T) {
+	for _, settings := range []uint8{
+		0<<3 | 3, // 版本0
+		6<<3 | 3, // 版本6
+		4<<3 | 0, // 保留模式
+		2<<3 | 6, // 控制消息
+		2<<3 | 7, // 私有模式
+	} {
+		data := make([]byte, packetSize)
+		data[0] = settings
+		decoded := NTPPacket{Stratum: 9}
+		if err := decoded.UnmarshalBinary(data); !errors.Is(err, ErrInvalidPacket) {
+			t.Errorf("设置%#x: 预期ErrInvalidPacket，实际得到%v", settings, err)
+		}
+		if decoded.Stratum != 9 {
+			t.Errorf("设置%#x: 解析失败时数据包被修改", settings)
+		}
+		if _, err := (&NTPPacket{Settings: settings}).MarshalBinary(); !errors.Is(err, ErrInvalidPacket) {
+			t.Errorf("设置%#x: 预期编码返回ErrInvalidPacket，实际得到%v", settings, err)
+		}
+	}
+
+	packet := createNTPPacket()
+	packet.MAC = make([]byte, 16)
+	if _, err := packet.MarshalBinary(); !errors.Is(err, ErrInvalidPacket) {
+		t.Errorf("预期16字节的MAC返回ErrInvalidPacket，实际得到%v", err)
+	}
+
+	var decoded NTPPacket
+	for _, data := range [][]byte{make([]byte, 40), make([]byte, 50)} {
+		data[0] = 4<<3 | 4
+		if err := decoded.UnmarshalBinary(data); !errors.Is(err, ErrInvalidPacket) {
+			t.Errorf("长度%d: 预期ErrInvalidPacket，实际得到%v", len(data), err)
+		}
+	}
+}
+
+// FuzzNTPPacket 测试任意输入都不会引起panic，解析成功的数据包重新编码后解析得到相同的内容
+func FuzzNTPPacket(f *testing.F) {
+	packet := createNTPPacket()
+	b, _ := packet.MarshalBinary()
+	f.Add(b)
+	packet.Extensions = []ExtensionField{{Type: ExtensionUniqueIdentifier, Value: bytes.Repeat([]byte{7}, 32)}}
+	b, _ = packet.MarshalBinary()
+	f.Add(b)
+	packet.MAC = append([]byte{0, 0, 0, 1}, make([]byte, 20)...)
+	b, _ = packet.MarshalBinary()
+	f.Add(b)
+	f.Add(make([]byte, packetSize+16))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p NTPPacket
+		if err := p.UnmarshalBinary(data); err != nil {
+			if !errors.Is(err, ErrInvalidPacket) {
+				t.Fatalf("错误没有包装ErrInvalidPacket: %v", err)
+			}
+			return
+		}
+
+		encoded, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("重新编码解析成功的数据包失败: %v", err)
+		}
+		var again NTPPacket
+		if err := again.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("解析重新编码的数据包失败: %v", err)
+		}
+
+		if !bytes.Equal(encoded[:packetSize], data[:packetSize]) {
+			t.Fatalf("数据包头不一致: %x, %x", encoded[:packetSize], data[:packetSize])
+		}
+		if !bytes.Equal(again.MAC, p.MAC) || len(again.Extensions) != len(p.Extensions) {
+			t.Fatalf("扩展字段或MAC不一致: %+v, %+v", again, p)
+		}
+		for i, f := range p.Extensions {
+			// 最后一个扩展字段可能被填充到更长，多出的部分都是零
+			g := again.Extensions[i]
+			if g.Type != f.Type || !bytes.HasPrefix(g.Value, f.Value) || len(bytes.Trim(g.Value[len(f.Value):], "\x00")) != 0 {
+				t.Fatalf("第%d个扩展字段不一致: %+v, %+v", i, g, f)
+			}
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package ntpsync
+
+import (
+	"fmt"
+	"slices"
+)
+
+// FailoverPolicy 决定每次同步依次尝试服务器的顺序
+type FailoverPolicy string
+
+// 支持的故障切换策略
+const (
+	// FailoverBest 总是从排名最高的服务器开始尝试，是默认的策略。
+	// 启用多服务器支持时按服务器管理器的排序，否则按配置的顺序
+	FailoverBest FailoverPolicy = "best"
+
+	// FailoverSticky 继续使用最近一次采用的服务器，直到它失败或被排除才切换到排名最高的其它服务器，
+	// 避免在非对称延迟不同的服务器之间来回切换造成偏移量的跳变
+	FailoverSticky FailoverPolicy = "sticky"
+
+	// FailoverRoundRobin 每次同步从排名中的下一个服务器开始尝试，使请求均匀地分布到所有服务器
+	FailoverRoundRobin FailoverPolicy = "round_robin"
+)
+
+// validateFailoverPolicy 检查故障切换策略，空字符串表示FailoverBest
+func validateFailoverPolicy(policy FailoverPolicy) error {
+	switch policy {
+	case "", FailoverBest, FailoverSticky, FailoverRoundRobin:
+		return nil
+	}
+	return fmt.Errorf("未知的故障切换策略%q，可选%q、%q或%q", policy, FailoverBest, FailoverSticky, FailoverRoundRobin)
+}
+
+// applyFailoverLocked 按故障切换策略原地调整按排名排列的servers，调用者必须持有n.mutex（读锁即可）
+func (n *NTPSync) applyFailoverLocked(servers []string) {
+	switch n.failoverPolicy {
+	case FailoverSticky:
+		if i := slices.Index(servers, n.currentServer); i > 0 {
+			current := servers[i]
+			copy(servers[1:i+1], servers[:i])
+			servers[0] = current
+		}
+	case FailoverRoundRobin:
+		if len(servers) > 1 {
+			k := int((n.rotation.Add(1) - 1) % uint64(len(servers)))
+			slices.Reverse(servers[:k])
+			slices.Reverse(servers[k:])
+			slices.Reverse(servers)
+		}
+	}
+}
+
+// GetFailoverPolicy 返回当前的故障切换策略
+func (n *NTPSync) GetFailoverPolicy() FailoverPolicy {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	if n.failoverPolicy == "" {
+		return FailoverBest
+	}
+	return n.failoverPolicy
+}
+
+// SetFailoverPolicy 修改故障切换策略，从下一次同步开始生效
+func (n *NTPSync) SetFailoverPolicy(policy FailoverPolicy) error {
+	if err := validateFailoverPolicy(policy); err != nil {
+		return err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.failoverPolicy = policy
+	return nil
+}
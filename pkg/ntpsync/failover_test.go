@@ -0,0 +1,90 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestFailoverPolicy 测试三种故障切换策略选择的服务器
+func TestFailoverPolicy(t *testing.T) {
+	clock := newFakeClock()
+	servers := make([]*ntptest.Server, 3)
+	addrs := make([]string, 3)
+	for i := range servers {
+		servers[i] = ntptest.NewServer()
+		defer servers[i].Close()
+		servers[i].SetNow(clock.Now)
+		addrs[i] = servers[i].Addr()
+	}
+
+	newSync := func(policy FailoverPolicy) *NTPSync {
+		ntp, err := New(Options{
+			Servers:         addrs,
+			Timeout:         100 * time.Millisecond,
+			MinPollInterval: -1,
+			FailoverPolicy:  policy,
+			Clock:           clock,
+		})
+		if err != nil {
+			t.Fatalf("创建NTPSync实例失败: %v", err)
+		}
+		t.Cleanup(func() { ntp.Close() })
+		return ntp
+	}
+	// syncedWith 同步一次，返回采用的服务器
+	syncedWith := func(ntp *NTPSync) string {
+		t.Helper()
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+		return ntp.GetHistory(1)[0].Server
+	}
+
+	// 默认策略在第一个服务器恢复后立即切换回去
+	ntp := newSync("")
+	servers[0].SetDrop(true)
+	if got := syncedWith(ntp); got != addrs[1] {
+		t.Errorf("预期第一个服务器失败后采用第二个，实际采用%s", got)
+	}
+	servers[0].SetDrop(false)
+	if got := syncedWith(ntp); got != addrs[0] {
+		t.Errorf("预期FailoverBest在第一个服务器恢复后切换回去，实际采用%s", got)
+	}
+	if got := ntp.GetFailoverPolicy(); got != FailoverBest {
+		t.Errorf("预期默认策略为FailoverBest，实际得到%q", got)
+	}
+
+	// 粘滞策略继续使用当前的服务器直到它失败
+	ntp = newSync(FailoverSticky)
+	servers[0].SetDrop(true)
+	syncedWith(ntp)
+	servers[0].SetDrop(false)
+	if got := syncedWith(ntp); got != addrs[1] {
+		t.Errorf("预期FailoverSticky继续使用第二个服务器，实际采用%s", got)
+	}
+	if s := ntp.GetSelectionHistory(1)[0]; s.Reason != "继续使用当前的服务器" {
+		t.Errorf("预期选择历史说明继续使用当前的服务器，实际得到%q", s.Reason)
+	}
+	servers[1].SetDrop(true)
+	if got := syncedWith(ntp); got != addrs[0] {
+		t.Errorf("预期当前的服务器失败后切换到排名最高的服务器，实际采用%s", got)
+	}
+	servers[1].SetDrop(false)
+
+	// 轮换策略每次从下一个服务器开始
+	ntp = newSync(FailoverRoundRobin)
+	for i := 0; i < 4; i++ {
+		if got, want := syncedWith(ntp), addrs[i%3]; got != want {
+			t.Errorf("第%d次同步预期采用%s，实际采用%s", i+1, want, got)
+		}
+	}
+
+	if err := ntp.SetFailoverPolicy("random"); err == nil {
+		t.Error("预期未知的策略返回错误")
+	}
+	if _, err := New(Options{Servers: addrs, FailoverPolicy: "random"}); err == nil {
+		t.Error("预期创建实例时拒绝未知的策略")
+	}
+}
@@ -0,0 +1,26 @@
+package ntpsync
+
+// syncOnFirstCall 在第一次调用时在后台开始同步，并最多等待FirstUseWait让同步完成；
+// 之后的调用直接返回。实例关闭时立即返回
+func (n *NTPSync) syncOnFirstCall() {
+	if !n.firstUse.CompareAndSwap(false, true) {
+		return
+	}
+
+	done := make(chan struct{})
+	n.goAsync(func() {
+		defer close(done)
+		_ = n.Sync()
+	})
+	if n.firstUseWait <= 0 {
+		return
+	}
+
+	timer := n.clock.NewTimer(n.firstUseWait)
+	defer stopTimer(timer)
+	select {
+	case <-done:
+	case <-timer.C():
+	case <-n.context().Done():
+	}
+}
@@ -0,0 +1,85 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestSyncOnFirstUse 测试第一次调用Now时触发同步并等待其完成
+func TestSyncOnFirstUse(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(time.Second)
+
+	ntp, err := New(Options{
+		Servers:        []string{srv.Addr()},
+		Timeout:        time.Second,
+		Clock:          clock,
+		SyncOnFirstUse: true,
+		FirstUseWait:   time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if got := srv.RequestCount(); got != 0 {
+		t.Fatalf("预期创建实例时不同步，实际服务器收到%d个请求", got)
+	}
+	if diff := ntp.Now().Sub(clock.Now()); diff < 900*time.Millisecond || diff > 1100*time.Millisecond {
+		t.Errorf("预期第一次调用Now返回校准后的时间，实际偏移%v", diff)
+	}
+
+	ntp.Now()
+	if got := srv.RequestCount(); got != 1 {
+		t.Errorf("预期只同步一次，实际服务器收到%d个请求", got)
+	}
+}
+
+// TestSyncOnFirstUseTimeout 测试服务器不可达时第一次调用Now最多等待FirstUseWait
+func TestSyncOnFirstUseTimeout(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(time.Second)
+	srv.SetDrop(true)
+
+	ntp, err := New(Options{
+		Servers:        []string{srv.Addr()},
+		Timeout:        time.Second,
+		Clock:          clock,
+		SyncOnFirstUse: true,
+		FirstUseWait:   100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	done := make(chan time.Time, 1)
+	go func() { done <- ntp.Now() }()
+
+	clock.waitForTimers(t, 1)
+	select {
+	case <-done:
+		t.Fatal("预期Now等待同步完成")
+	default:
+	}
+	clock.Advance(100 * time.Millisecond)
+
+	select {
+	case now := <-done:
+		if diff := now.Sub(clock.Now()); diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("预期超时后返回未校准的时间，实际偏移%v", diff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待Now返回超时")
+	}
+}
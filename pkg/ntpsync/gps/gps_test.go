@@ -0,0 +1,155 @@
+package gps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// nmeaSentence 为语句主体加上起始符和校验和
+func nmeaSentence(body string) string {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return fmt.Sprintf("$%s*%02X", body, sum)
+}
+
+// TestParseRMC 测试解析RMC语句
+func TestParseRMC(t *testing.T) {
+	line := nmeaSentence("GNRMC,123519.50,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W,A")
+	got, err := parseRMC(line)
+	if err != nil {
+		t.Fatalf("解析RMC语句失败: %v", err)
+	}
+	want := time.Date(1994, 3, 23, 12, 35, 19, 500000000, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+
+	invalid := []string{
+		nmeaSentence("GPRMC,123519,V,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W"),
+		nmeaSentence("GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,"),
+		"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*00",
+		"GPRMC,123519,A",
+	}
+	for _, line := range invalid {
+		if _, err := parseRMC(line); err == nil {
+			t.Errorf("预期 %q 返回错误，实际得到nil", line)
+		}
+	}
+}
+
+// TestNMEA 测试从NMEA语句流计算偏移量
+func TestNMEA(t *testing.T) {
+	r, w := io.Pipe()
+	local := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	src, err := NewNMEA(NMEAOptions{
+		Reader: r,
+		Delay:  100 * time.Millisecond,
+		Now:    func() time.Time { return local },
+	})
+	if err != nil {
+		t.Fatalf("创建NMEA时间源失败: %v", err)
+	}
+	defer src.Close()
+
+	// GPS时间比本地时间快3秒
+	go fmt.Fprintln(w, nmeaSentence("GPRMC,080003.00,A,3958.000,N,11620.000,E,0.0,0.0,010524,,,A"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := src.Measure(ctx)
+	if err != nil {
+		t.Fatalf("测量失败: %v", err)
+	}
+	if want := 3*time.Second + 100*time.Millisecond; result.Offset != want {
+		t.Errorf("预期偏移量为%v，实际得到%v", want, result.Offset)
+	}
+	if result.Stratum != 0 || result.Uncertainty != SerialUncertainty {
+		t.Errorf("预期0层级和默认误差上限，实际得到%+v", result)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := src.Measure(ctx); !errors.Is(err, ErrNoFix) {
+		t.Errorf("预期没有新语句时返回ErrNoFix，实际得到%v", err)
+	}
+}
+
+// fakeGPSD 启动一个在收到WATCH命令后发送给定报告的gpsd
+func fakeGPSD(t *testing.T, reports ...string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听TCP端口失败: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 256)
+				if _, err := conn.Read(buf); err != nil {
+					return
+				}
+				fmt.Fprintln(conn, `{"class":"VERSION","release":"3.25"}`)
+				for _, report := range reports {
+					fmt.Fprintln(conn, report)
+				}
+				// 保持连接直到客户端关闭
+				_, _ = conn.Read(buf)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// TestGPSD 测试从gpsd的PPS和TOFF报告计算偏移量
+func TestGPSD(t *testing.T) {
+	addr := fakeGPSD(t,
+		`{"class":"TOFF","device":"/dev/ttyS0","real_sec":1700000000,"real_nsec":0,"clock_sec":1699999999,"clock_nsec":800000000}`,
+		`{"class":"PPS","device":"/dev/ttyS0","real_sec":1700000000,"real_nsec":0,"clock_sec":1699999998,"clock_nsec":999990000}`,
+	)
+
+	src := NewGPSD(GPSDOptions{Addr: addr})
+	result, err := src.Measure(context.Background())
+	if err != nil {
+		t.Fatalf("测量失败: %v", err)
+	}
+	if want := time.Second + 10*time.Microsecond; result.Offset != want {
+		t.Errorf("预期使用PPS计算的偏移量%v，实际得到%v", want, result.Offset)
+	}
+	if result.Uncertainty != PPSUncertainty {
+		t.Errorf("预期误差上限为%v，实际得到%v", PPSUncertainty, result.Uncertainty)
+	}
+
+	// 没有秒脉冲时按配置使用串口时间
+	addr = fakeGPSD(t,
+		`{"class":"TOFF","device":"/dev/ttyS0","real_sec":1700000000,"real_nsec":0,"clock_sec":1699999999,"clock_nsec":800000000}`,
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := NewGPSD(GPSDOptions{Addr: addr}).Measure(ctx); !errors.Is(err, ErrNoFix) {
+		t.Errorf("预期没有秒脉冲时返回ErrNoFix，实际得到%v", err)
+	}
+
+	result, err = NewGPSD(GPSDOptions{Addr: addr, AllowSerial: true}).Measure(context.Background())
+	if err != nil {
+		t.Fatalf("使用串口时间测量失败: %v", err)
+	}
+	if result.Offset != 200*time.Millisecond || result.Uncertainty != SerialUncertainty {
+		t.Errorf("预期串口时间的偏移量为200ms，实际得到%+v", result)
+	}
+}
@@ -0,0 +1,188 @@
+// Package gps 提供以本地GPS接收机为参考时钟的时间源。
+//
+// GPSD通过gpsd的JSON接口读取PPS（秒脉冲）或串口时间偏移，
+// NMEA直接读取接收机输出的NMEA语句。两者都实现了ntpsync.Source，
+// 可以加入ntpsync.Options.PreferredSources，在广域网断开时为离网的
+// 物联网网关提供0层级的参考时间：
+//
+//	src := gps.NewGPSD(gps.GPSDOptions{})
+//	ntp, err := ntpsync.New(ntpsync.Options{
+//		Servers:          []string{"pool.ntp.org"},
+//		PreferredSources: []ntpsync.Source{src},
+//	})
+package gps
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// gpsd相关常量
+const (
+	// DefaultGPSDAddr 是gpsd的默认监听地址
+	DefaultGPSDAddr = "127.0.0.1:2947"
+
+	// DefaultTimeout 是上下文没有截止时间时一次测量的超时时间，
+	// 足够等待下一个秒脉冲
+	DefaultTimeout = 3 * time.Second
+
+	// PPSUncertainty 是使用秒脉冲时偏移量的误差上限
+	PPSUncertainty = 10 * time.Microsecond
+
+	// SerialUncertainty 是只使用串口时间时偏移量的误差上限，
+	// 串口语句的发送延迟因接收机而异
+	SerialUncertainty = 200 * time.Millisecond
+)
+
+// ppsGrace 是收到串口时间偏移后继续等待秒脉冲的时间
+const ppsGrace = 1100 * time.Millisecond
+
+// watchCommand 请求gpsd以JSON格式报告PPS和时间偏移
+const watchCommand = `?WATCH={"enable":true,"json":true,"pps":true};` + "\n"
+
+// ErrNoFix 表示在超时时间内没有得到可用的GPS时间
+var ErrNoFix = errors.New("没有得到可用的GPS时间")
+
+// GPSDOptions 包含GPSD的配置选项
+type GPSDOptions struct {
+	// Addr 是gpsd的地址，空字符串表示使用DefaultGPSDAddr
+	Addr string
+
+	// Device 是要使用的接收机设备路径，空字符串表示接受任意设备
+	Device string
+
+	// AllowSerial 表示没有秒脉冲时是否使用精度较低的串口时间偏移(TOFF)
+	AllowSerial bool
+}
+
+// GPSD 是通过gpsd读取GPS时间的时间源
+type GPSD struct {
+	addr        string
+	device      string
+	allowSerial bool
+}
+
+// NewGPSD 创建通过gpsd读取GPS时间的时间源
+func NewGPSD(opts GPSDOptions) *GPSD {
+	addr := opts.Addr
+	if addr == "" {
+		addr = DefaultGPSDAddr
+	}
+	return &GPSD{
+		addr:        addr,
+		device:      opts.Device,
+		allowSerial: opts.AllowSerial,
+	}
+}
+
+// Name 返回时间源的名称
+func (g *GPSD) Name() string {
+	if g.device != "" {
+		return "gpsd:" + g.device
+	}
+	return "gpsd"
+}
+
+// gpsdReport 是gpsd报告中用到的字段
+// PPS和TOFF报告中，real是GPS时间，clock是gpsd收到脉冲或语句时的系统时间
+type gpsdReport struct {
+	Class     string `json:"class"`
+	Device    string `json:"device"`
+	RealSec   int64  `json:"real_sec"`
+	RealNsec  int64  `json:"real_nsec"`
+	ClockSec  int64  `json:"clock_sec"`
+	ClockNsec int64  `json:"clock_nsec"`
+}
+
+// Measure 实现ntpsync.Source，等待gpsd的下一个PPS报告并返回偏移量
+// 偏移量由gpsd在收到脉冲时记录的系统时间计算，不受本连接延迟的影响
+func (g *GPSD) Measure(ctx context.Context) (*ntpsync.SyncResult, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", g.addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接gpsd %s 失败: %v", g.addr, err)
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("设置超时时间失败: %v", err)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	if _, err := conn.Write([]byte(watchCommand)); err != nil {
+		return nil, fmt.Errorf("发送gpsd命令失败: %v", err)
+	}
+
+	var serial *gpsdReport
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var report gpsdReport
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil {
+			continue
+		}
+		if g.device != "" && report.Device != g.device {
+			continue
+		}
+
+		switch report.Class {
+		case "PPS":
+			return report.result(g.Name(), PPSUncertainty), nil
+		case "TOFF":
+			if g.allowSerial && serial == nil {
+				r := report
+				serial = &r
+
+				// 接收机有秒脉冲时PPS报告会在一秒内到达，否则使用串口时间
+				if grace := time.Now().Add(ppsGrace); grace.Before(deadline) {
+					_ = conn.SetDeadline(grace)
+				}
+			}
+		}
+	}
+
+	// 超时前没有收到秒脉冲，退而使用串口时间
+	if serial != nil {
+		return serial.result(g.Name(), SerialUncertainty), nil
+	}
+	if ctx.Err() != nil {
+		return nil, ErrNoFix
+	}
+	if err := scanner.Err(); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, ErrNoFix
+		}
+		return nil, fmt.Errorf("读取gpsd报告失败: %v", err)
+	}
+	return nil, errors.New("gpsd关闭了连接")
+}
+
+// result 将PPS或TOFF报告转换为同步结果
+func (r *gpsdReport) result(name string, uncertainty time.Duration) *ntpsync.SyncResult {
+	gpsTime := time.Unix(r.RealSec, r.RealNsec)
+	clock := time.Unix(r.ClockSec, r.ClockNsec)
+	return &ntpsync.SyncResult{
+		Server:      name,
+		Time:        gpsTime,
+		Offset:      gpsTime.Sub(clock),
+		Stratum:     0,
+		Uncertainty: uncertainty,
+	}
+}
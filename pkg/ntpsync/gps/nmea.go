@@ -0,0 +1,215 @@
+package gps
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// NMEAOptions 包含NMEA的配置选项
+type NMEAOptions struct {
+	// Device 是接收机的串口设备路径，例如"/dev/ttyUSB0"
+	// 串口的波特率等参数需要预先配置（例如使用stty）
+	Device string
+
+	// Reader 是NMEA语句的来源，设置后忽略Device
+	Reader io.Reader
+
+	// Delay 是接收机在秒开始后发出语句的固定延迟，用于补偿偏移量
+	Delay time.Duration
+
+	// Uncertainty 是偏移量的误差上限，零值表示使用SerialUncertainty
+	Uncertainty time.Duration
+
+	// Now 是本地时间来源，nil表示使用time.Now
+	Now func() time.Time
+}
+
+// NMEA 是直接读取接收机NMEA语句的时间源
+// 使用RMC语句中的UTC时间和日期，以收到语句的本地时间计算偏移量
+type NMEA struct {
+	name        string
+	delay       time.Duration
+	uncertainty time.Duration
+	now         func() time.Time
+	reader      io.Reader
+	closer      io.Closer
+
+	fixes chan nmeaFix
+	wg    sync.WaitGroup
+}
+
+// nmeaFix 是一条有效的RMC语句
+type nmeaFix struct {
+	time     time.Time
+	received time.Time
+}
+
+// NewNMEA 创建读取NMEA语句的时间源并开始读取
+func NewNMEA(opts NMEAOptions) (*NMEA, error) {
+	m := &NMEA{
+		name:        "nmea",
+		delay:       opts.Delay,
+		uncertainty: opts.Uncertainty,
+		now:         opts.Now,
+		reader:      opts.Reader,
+		fixes:       make(chan nmeaFix, 1),
+	}
+	if m.uncertainty <= 0 {
+		m.uncertainty = SerialUncertainty
+	}
+	if m.now == nil {
+		m.now = time.Now
+	}
+
+	if m.reader == nil {
+		if opts.Device == "" {
+			return nil, errors.New("必须提供NMEA设备路径或Reader")
+		}
+		f, err := os.Open(opts.Device)
+		if err != nil {
+			return nil, fmt.Errorf("打开NMEA设备失败: %v", err)
+		}
+		m.reader = f
+		m.name = "nmea:" + opts.Device
+	}
+	if c, ok := m.reader.(io.Closer); ok {
+		m.closer = c
+	}
+
+	m.wg.Add(1)
+	go m.read()
+	return m, nil
+}
+
+// Close 关闭设备并等待读取goroutine退出
+// 使用Reader创建时，只有Reader实现了io.Closer才能中断读取
+func (m *NMEA) Close() error {
+	var err error
+	if m.closer != nil {
+		err = m.closer.Close()
+	}
+	m.wg.Wait()
+	return err
+}
+
+// Name 返回时间源的名称
+func (m *NMEA) Name() string {
+	return m.name
+}
+
+// read 持续读取语句，只保留最新的有效时间
+func (m *NMEA) read() {
+	defer m.wg.Done()
+
+	scanner := bufio.NewScanner(m.reader)
+	for scanner.Scan() {
+		received := m.now()
+		t, err := parseRMC(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		fix := nmeaFix{time: t, received: received}
+		select {
+		case m.fixes <- fix:
+		default:
+			// 替换没有被使用的旧时间
+			select {
+			case <-m.fixes:
+			default:
+			}
+			select {
+			case m.fixes <- fix:
+			default:
+			}
+		}
+	}
+	close(m.fixes)
+}
+
+// Measure 实现ntpsync.Source，返回最新一条有效的RMC语句计算的偏移量，没有时等待下一条
+func (m *NMEA) Measure(ctx context.Context) (*ntpsync.SyncResult, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	// 缓存的时间在收到语句时记录了本地时间，可以直接使用
+	select {
+	case fix, ok := <-m.fixes:
+		if !ok {
+			return nil, errors.New("NMEA数据源已关闭")
+		}
+		gpsTime := fix.time.Add(m.delay)
+		return &ntpsync.SyncResult{
+			Server:      m.name,
+			Time:        gpsTime,
+			Offset:      gpsTime.Sub(fix.received),
+			Stratum:     0,
+			Uncertainty: m.uncertainty,
+		}, nil
+	case <-ctx.Done():
+		return nil, ErrNoFix
+	}
+}
+
+// parseRMC 解析RMC语句中的UTC时间，只接受校验和正确且定位有效的语句
+// 格式：$GPRMC,hhmmss.ss,A,纬度,N,经度,E,速度,航向,ddmmyy,磁偏角,E,模式*校验和
+func parseRMC(line string) (time.Time, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "$") {
+		return time.Time{}, errors.New("不是NMEA语句")
+	}
+
+	body, checksum, ok := strings.Cut(line[1:], "*")
+	if !ok {
+		return time.Time{}, errors.New("NMEA语句缺少校验和")
+	}
+	want, err := strconv.ParseUint(checksum, 16, 8)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无效的NMEA校验和 %q", checksum)
+	}
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	if sum != byte(want) {
+		return time.Time{}, errors.New("NMEA校验和不匹配")
+	}
+
+	fields := strings.Split(body, ",")
+	if len(fields) < 10 || len(fields[0]) != 5 || !strings.HasSuffix(fields[0], "RMC") {
+		return time.Time{}, errors.New("不是RMC语句")
+	}
+	if fields[2] != "A" {
+		return time.Time{}, errors.New("接收机没有有效定位")
+	}
+
+	clock, date := fields[1], fields[9]
+	if len(clock) < 6 || len(date) != 6 {
+		return time.Time{}, errors.New("RMC语句的时间或日期无效")
+	}
+	t, err := time.Parse("020106150405", date+clock[:6])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("RMC语句的时间无效: %v", err)
+	}
+	if len(clock) > 6 {
+		frac, err := strconv.ParseFloat("0"+clock[6:], 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("RMC语句的时间无效: %v", err)
+		}
+		t = t.Add(time.Duration(frac * float64(time.Second)))
+	}
+	return t.UTC(), nil
+}
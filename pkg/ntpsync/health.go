@@ -0,0 +1,94 @@
+package ntpsync
+
+import (
+	"math/bits"
+	"time"
+)
+
+// 服务器健康评分中各项指标的权重，总和为100
+const (
+	scoreWeightReach     = 50.0
+	scoreWeightAgreement = 30.0
+	scoreWeightStability = 20.0
+)
+
+// 健康评分的参考尺度
+const (
+	// agreementScale 是偏移量与其它服务器中位数相差此值时，一致性得分减半
+	agreementScale = 10 * time.Millisecond
+
+	// stabilityScale 是往返时间抖动达到此值时，稳定性得分减半
+	stabilityScale = 5 * time.Millisecond
+)
+
+// serverHealth 是计算服务器健康评分所需的滚动状态
+type serverHealth struct {
+	// reach 是可达性寄存器，每次探测左移一位，成功时最低位为1
+	reach uint8
+
+	// rtts 是最近的往返时间样本
+	rtts offsetWindow
+}
+
+// record 记录一次探测的结果
+func (h *serverHealth) record(success bool, rtt time.Duration) {
+	h.reach <<= 1
+	if success {
+		h.reach |= 1
+		h.rtts.add(rtt)
+	}
+}
+
+// healthFor 返回服务器的健康状态，不存在时创建，调用者必须持有sm.mutex
+func (sm *ServerManager) healthFor(server string) *serverHealth {
+	if sm.health == nil {
+		sm.health = make(map[string]*serverHealth)
+	}
+	h, ok := sm.health[server]
+	if !ok {
+		h = &serverHealth{}
+		sm.health[server] = h
+	}
+	return h
+}
+
+// updateScores 重新计算所有服务器的健康评分，调用者必须持有sm.mutex
+// 评分范围为0到100，由三部分组成：
+//  1. 可达性：最近8次探测中成功的比例
+//  2. 偏移一致性：偏移量与所有可达服务器偏移量中位数的接近程度
+//  3. 往返时间稳定性：最近往返时间样本的抖动大小
+func (sm *ServerManager) updateScores() {
+	offsets := make([]time.Duration, 0, len(sm.servers))
+	for _, status := range sm.servers {
+		if status.Reachable {
+			offsets = append(offsets, status.Offset)
+		}
+	}
+
+	var median time.Duration
+	if len(offsets) > 0 {
+		median = medianDuration(offsets)
+	}
+
+	for server, status := range sm.servers {
+		h := sm.healthFor(server)
+
+		reach := float64(bits.OnesCount8(h.reach)) / 8
+		if h.rtts.count == 0 {
+			status.Score = scoreWeightReach * reach
+			continue
+		}
+
+		agreement := halfAt(absDuration(status.Offset-median), agreementScale)
+		stability := halfAt(h.rtts.jitter(), stabilityScale)
+
+		status.Score = scoreWeightReach*reach +
+			scoreWeightAgreement*agreement +
+			scoreWeightStability*stability
+	}
+}
+
+// halfAt 将非负的偏差映射到(0, 1]，偏差为0时得1，等于scale时得0.5
+func halfAt(deviation, scale time.Duration) float64 {
+	return 1 / (1 + float64(deviation)/float64(scale))
+}
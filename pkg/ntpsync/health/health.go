@@ -0,0 +1,130 @@
+// Package health 提供Kubernetes风格的就绪和存活检查，便于将同步守护进程作为sidecar部署。
+//
+// Ready表示最后一次同步仍在允许的时间范围内，Live表示定时同步循环仍在运行且没有卡住。
+// Handler将两者组合为一个http.Handler：
+//
+//	mux.Handle("/livez", health.Handler(ntp, health.Options{}))
+//	mux.Handle("/readyz", health.Handler(ntp, health.Options{MaxAge: 10 * time.Minute}))
+//
+// 对应的探针配置：
+//
+//	livenessProbe:
+//	  httpGet: {path: /livez, port: 8080}
+//	readinessProbe:
+//	  httpGet: {path: /readyz, port: 8080}
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// DefaultGrace 是同步循环超过计划时间仍未完成同步时，仍然认为其存活的时长
+// 一次同步在逐个尝试服务器和重试时可能需要较长时间
+const DefaultGrace = 2 * time.Minute
+
+// Options 包含健康检查的配置选项
+type Options struct {
+	// MaxAge 是就绪检查认为同步仍然有效的最长时间，零值表示使用两倍的同步间隔
+	MaxAge time.Duration
+
+	// Grace 是存活检查允许同步循环超过计划时间的时长，零值表示使用DefaultGrace
+	Grace time.Duration
+}
+
+// Ready 返回最后一次同步是否在maxAge之内，maxAge不大于0时使用两倍的同步间隔
+func Ready(n *ntpsync.NTPSync, maxAge time.Duration) bool {
+	return n.IsSynchronized(maxAge)
+}
+
+// Live 返回定时同步循环是否存活：定时同步正在运行，且没有超过计划的同步时间grace以上
+// grace不大于0时使用DefaultGrace
+func Live(n *ntpsync.NTPSync, grace time.Duration) bool {
+	return live(n.GetPeriodicSyncStatus(), grace, time.Now())
+}
+
+// live 根据定时同步的状态判断同步循环在now时是否存活
+func live(status ntpsync.PeriodicSyncStatus, grace time.Duration, now time.Time) bool {
+	if grace <= 0 {
+		grace = DefaultGrace
+	}
+	if !status.Running || status.NextSync.IsZero() {
+		return false
+	}
+	return now.Sub(status.NextSync) <= grace
+}
+
+// response 是健康检查返回的JSON结构
+type response struct {
+	Status   string `json:"status"`
+	Ready    *bool  `json:"ready,omitempty"`
+	Live     *bool  `json:"live,omitempty"`
+	LastSync string `json:"last_sync,omitempty"`
+	NextSync string `json:"next_sync,omitempty"`
+}
+
+// handler 实现组合的健康检查
+type handler struct {
+	ntp  *ntpsync.NTPSync
+	opts Options
+}
+
+// Handler 创建健康检查的http.Handler
+// 以/livez结尾的路径只检查存活，以/readyz结尾的路径只检查就绪，其它路径两者都检查；
+// 检查通过时返回200，否则返回503
+func Handler(n *ntpsync.NTPSync, opts Options) http.Handler {
+	return &handler{ntp: n, opts: opts}
+}
+
+// ServeHTTP 实现http.Handler
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	checkLive := !strings.HasSuffix(r.URL.Path, "/readyz")
+	checkReady := !strings.HasSuffix(r.URL.Path, "/livez")
+
+	status := h.ntp.GetPeriodicSyncStatus()
+	resp := response{Status: "ok"}
+	if !status.LastSync.IsZero() {
+		resp.LastSync = status.LastSync.Format(time.RFC3339Nano)
+	}
+	if !status.NextSync.IsZero() {
+		resp.NextSync = status.NextSync.Format(time.RFC3339Nano)
+	}
+
+	healthy := true
+	if checkReady {
+		ready := Ready(h.ntp, h.opts.MaxAge)
+		resp.Ready = &ready
+		if !ready {
+			healthy = false
+			resp.Status = "not ready"
+		}
+	}
+	if checkLive {
+		alive := live(status, h.opts.Grace, time.Now())
+		resp.Live = &alive
+		if !alive {
+			healthy = false
+			resp.Status = "not live"
+		}
+	}
+
+	code := http.StatusOK
+	if !healthy {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,126 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// newNTP 创建一个使用测试服务器的NTPSync实例
+func newNTP(t *testing.T, srv *ntptest.Server, timeout time.Duration) *ntpsync.NTPSync {
+	t.Helper()
+
+	ntp, err := ntpsync.New(ntpsync.Options{
+		Servers:      []string{srv.Addr()},
+		Timeout:      timeout,
+		SyncInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	t.Cleanup(func() { ntp.Close() })
+	return ntp
+}
+
+// get 请求健康检查并返回状态码和响应
+func get(t *testing.T, h http.Handler, path string) (int, response) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v: %s", err, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+// TestLive 测试根据计划同步时间判断存活
+func TestLive(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		status ntpsync.PeriodicSyncStatus
+		grace  time.Duration
+		want   bool
+	}{
+		{"未运行", ntpsync.PeriodicSyncStatus{}, 0, false},
+		{"等待下一次同步", ntpsync.PeriodicSyncStatus{Running: true, NextSync: now.Add(time.Hour)}, 0, true},
+		{"同步进行中", ntpsync.PeriodicSyncStatus{Running: true, NextSync: now.Add(-time.Minute)}, 0, true},
+		{"超过宽限时间", ntpsync.PeriodicSyncStatus{Running: true, NextSync: now.Add(-time.Minute)}, 30 * time.Second, false},
+	}
+	for _, tt := range tests {
+		if got := live(tt.status, tt.grace, now); got != tt.want {
+			t.Errorf("%s: 预期%v，实际得到%v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestHandler 测试就绪、存活和组合检查的路由
+func TestHandler(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	ntp := newNTP(t, srv, time.Second)
+	h := Handler(ntp, Options{})
+
+	if code, resp := get(t, h, "/readyz"); code != http.StatusServiceUnavailable || resp.Status != "not ready" || resp.Live != nil {
+		t.Errorf("同步前预期未就绪，实际得到%d %+v", code, resp)
+	}
+	if code, _ := get(t, h, "/livez"); code != http.StatusServiceUnavailable {
+		t.Errorf("定时同步未启动时预期不存活，实际得到%d", code)
+	}
+
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !Ready(ntp, 0) {
+		if time.Now().After(deadline) {
+			t.Fatal("等待首次同步超时")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	code, resp := get(t, h, "/healthz")
+	if code != http.StatusOK || resp.Status != "ok" || resp.Ready == nil || !*resp.Ready || resp.Live == nil || !*resp.Live {
+		t.Errorf("预期组合检查通过，实际得到%d %+v", code, resp)
+	}
+	if resp.LastSync == "" || resp.NextSync == "" {
+		t.Errorf("响应缺少同步时间: %+v", resp)
+	}
+
+	ntp.StopPeriodicSync()
+	if code, resp := get(t, h, "/livez"); code != http.StatusServiceUnavailable || resp.Status != "not live" || resp.Ready != nil {
+		t.Errorf("停止定时同步后预期不存活，实际得到%d %+v", code, resp)
+	}
+	if code, _ := get(t, h, "/readyz"); code != http.StatusOK {
+		t.Errorf("停止定时同步后同步仍然有效，预期就绪，实际得到%d", code)
+	}
+}
+
+// TestLiveStalled 测试同步长时间没有完成时判定为不存活
+func TestLiveStalled(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetDrop(true)
+	ntp := newNTP(t, srv, 2*time.Second)
+
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+
+	if !Live(ntp, time.Minute) {
+		t.Error("同步刚开始时预期存活")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if Live(ntp, 50*time.Millisecond) {
+		t.Error("同步超过宽限时间仍未完成，预期不存活")
+	}
+}
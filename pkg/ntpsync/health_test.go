@@ -0,0 +1,61 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+)
+
+// TestServerHealthScore 测试健康评分的计算以及按评分排序
+func TestServerHealthScore(t *testing.T) {
+	sm, err := NewServerManager([]string{"flaky", "far", "jittery", "good"}, time.Second)
+	if err != nil {
+		t.Fatalf("创建服务器管理器失败: %v", err)
+	}
+	sm.SetHolddown(0, 0)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 8; i++ {
+		_ = sm.RecordSuccess("good", ServerStatus{Offset: time.Millisecond, RTT: 10 * time.Millisecond})
+		_ = sm.RecordSuccess("far", ServerStatus{Offset: 100 * time.Millisecond, RTT: 10 * time.Millisecond})
+
+		rtt := 10 * time.Millisecond
+		if i%2 == 1 {
+			rtt = 40 * time.Millisecond
+		}
+		_ = sm.RecordSuccess("jittery", ServerStatus{Offset: 2 * time.Millisecond, RTT: rtt})
+
+		// 每隔一次失败，最后一次成功
+		if i%2 == 0 {
+			_ = sm.RecordFailure("flaky", now)
+		} else {
+			_ = sm.RecordSuccess("flaky", ServerStatus{Offset: time.Millisecond, RTT: 10 * time.Millisecond})
+		}
+	}
+
+	scores := make(map[string]float64)
+	for _, status := range sm.GetAllServerStatuses() {
+		if status.Score < 0 || status.Score > 100 {
+			t.Errorf("预期%s的评分在0到100之间，实际得到%v", status.Address, status.Score)
+		}
+		scores[status.Address] = status.Score
+	}
+
+	if scores["good"] < 95 {
+		t.Errorf("预期稳定且一致的服务器接近满分，实际得到%v", scores["good"])
+	}
+	for _, server := range []string{"far", "jittery", "flaky"} {
+		if scores[server] >= scores["good"] {
+			t.Errorf("预期%s的评分(%v)低于good(%v)", server, scores[server], scores["good"])
+		}
+	}
+
+	best, err := sm.GetBestServer()
+	if err != nil || best != "good" {
+		t.Errorf("预期最佳服务器为good，实际得到%s (%v)", best, err)
+	}
+
+	// 偏移一致性的影响大于往返时间抖动
+	if scores["far"] >= scores["jittery"] {
+		t.Errorf("预期偏移量偏离较远的服务器评分(%v)低于抖动较大的服务器(%v)", scores["far"], scores["jittery"])
+	}
+}
@@ -0,0 +1,188 @@
+package ntpsync
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultHistorySize 是默认保存的最近同步结果数量
+const DefaultHistorySize = 128
+
+// historyBuffer 是保存最近同步结果的环形缓冲区
+type historyBuffer struct {
+	results []SyncResult
+	next    int
+	count   int
+}
+
+// newHistoryBuffer 创建容量为size的环形缓冲区，size不大于0时使用DefaultHistorySize
+func newHistoryBuffer(size int) historyBuffer {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return historyBuffer{results: make([]SyncResult, size)}
+}
+
+// add 添加一个结果，缓冲区已满时覆盖最旧的结果
+func (h *historyBuffer) add(result SyncResult) {
+	if len(h.results) == 0 {
+		*h = newHistoryBuffer(0)
+	}
+
+	h.results[h.next] = result
+	h.next = (h.next + 1) % len(h.results)
+	if h.count < len(h.results) {
+		h.count++
+	}
+}
+
+// capacity 返回缓冲区的容量
+func (h *historyBuffer) capacity() int {
+	if len(h.results) == 0 {
+		return DefaultHistorySize
+	}
+	return len(h.results)
+}
+
+// last 按时间顺序返回最近的n个结果，n不大于0时返回全部结果
+func (h *historyBuffer) last(n int) []SyncResult {
+	if n <= 0 || n > h.count {
+		n = h.count
+	}
+
+	results := make([]SyncResult, n)
+	start := h.next - n
+	if start < 0 {
+		start += len(h.results)
+	}
+	for i := 0; i < n; i++ {
+		results[i] = h.results[(start+i)%len(h.results)]
+	}
+	return results
+}
+
+// HistoryStats 是根据同步历史计算的统计数据
+type HistoryStats struct {
+	// Count 是历史中成功同步的次数
+	Count int `json:"count"`
+
+	// Failures 是历史中失败同步的次数
+	Failures int `json:"failures"`
+
+	// Rejected 是历史中偏移量被判定为异常值或超过MaxOffset的次数
+	Rejected int `json:"rejected"`
+
+	// MinOffset 是最小的偏移量
+	MinOffset time.Duration `json:"min_offset"`
+
+	// MaxOffset 是最大的偏移量
+	MaxOffset time.Duration `json:"max_offset"`
+
+	// MeanOffset 是偏移量的平均值
+	MeanOffset time.Duration `json:"mean_offset"`
+
+	// StdDevOffset 是偏移量的标准差
+	StdDevOffset time.Duration `json:"stddev_offset"`
+
+	// RTTP50 是往返时间的中位数
+	RTTP50 time.Duration `json:"rtt_p50"`
+
+	// RTTP90 是往返时间的第90百分位数
+	RTTP90 time.Duration `json:"rtt_p90"`
+
+	// RTTP99 是往返时间的第99百分位数
+	RTTP99 time.Duration `json:"rtt_p99"`
+}
+
+// GetHistory 按时间顺序返回最近的n个同步结果，n不大于0时返回全部历史
+// 失败的同步也会记录在历史中，其Error字段不为nil
+func (n *NTPSync) GetHistory(count int) []SyncResult {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	return n.history.last(count)
+}
+
+// GetHistoryStats 返回根据同步历史计算的统计数据
+func (n *NTPSync) GetHistoryStats() HistoryStats {
+	return computeHistoryStats(n.GetHistory(0))
+}
+
+// GetAllanDeviation 按同步历史中来自server的成功应用的偏移量计算Allan偏差，反映本地晶振的稳定度，
+// 参见AllanDeviation。不同服务器的偏移量之间有各自的路径误差，因此按服务器分别计算；每次调用时重新计算。
+// 历史的长度限制了能计算的最大观测间隔，需要更长的数据时使用Options.StatsDir
+func (n *NTPSync) GetAllanDeviation(server string) []AllanPoint {
+	address := serverAddress(server)
+	var results []SyncResult
+	for _, result := range n.GetHistory(0) {
+		if result.Server == server || result.Server == address {
+			results = append(results, result)
+		}
+	}
+	return AllanDeviation(results)
+}
+
+// computeHistoryStats 计算同步结果的统计数据，只有成功应用的结果参与偏移量和往返时间的统计
+func computeHistoryStats(results []SyncResult) HistoryStats {
+	var stats HistoryStats
+
+	offsets := make([]float64, 0, len(results))
+	rtts := make([]time.Duration, 0, len(results))
+	for _, result := range results {
+		if result.Error != nil {
+			stats.Failures++
+			continue
+		}
+		if result.Rejected {
+			stats.Rejected++
+			continue
+		}
+		offsets = append(offsets, float64(result.Offset))
+		rtts = append(rtts, result.RTT)
+	}
+
+	stats.Count = len(offsets)
+	if stats.Count == 0 {
+		return stats
+	}
+
+	minOffset, maxOffset, sum := offsets[0], offsets[0], 0.0
+	for _, offset := range offsets {
+		minOffset = math.Min(minOffset, offset)
+		maxOffset = math.Max(maxOffset, offset)
+		sum += offset
+	}
+	mean := sum / float64(len(offsets))
+
+	var variance float64
+	for _, offset := range offsets {
+		variance += (offset - mean) * (offset - mean)
+	}
+	variance /= float64(len(offsets))
+
+	stats.MinOffset = time.Duration(minOffset)
+	stats.MaxOffset = time.Duration(maxOffset)
+	stats.MeanOffset = time.Duration(mean)
+	stats.StdDevOffset = time.Duration(math.Sqrt(variance))
+
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	stats.RTTP50 = percentile(rtts, 50)
+	stats.RTTP90 = percentile(rtts, 90)
+	stats.RTTP99 = percentile(rtts, 99)
+
+	return stats
+}
+
+// percentile 使用最近秩法返回已排序样本的第p百分位数
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
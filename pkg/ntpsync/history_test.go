@@ -0,0 +1,121 @@
+package ntpsync
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestHistoryBuffer 测试环形缓冲区的覆盖和顺序
+func TestHistoryBuffer(t *testing.T) {
+	h := newHistoryBuffer(3)
+
+	for i := 1; i <= 5; i++ {
+		h.add(SyncResult{Offset: time.Duration(i)})
+	}
+
+	all := h.last(0)
+	if len(all) != 3 {
+		t.Fatalf("预期保存3个结果，实际得到%d个", len(all))
+	}
+	for i, want := range []time.Duration{3, 4, 5} {
+		if all[i].Offset != want {
+			t.Errorf("预期第%d个结果的偏移量为%v，实际得到%v", i, want, all[i].Offset)
+		}
+	}
+
+	recent := h.last(2)
+	if len(recent) != 2 || recent[0].Offset != 4 || recent[1].Offset != 5 {
+		t.Errorf("预期最近2个结果为4和5，实际得到%+v", recent)
+	}
+}
+
+// TestHistoryStats 测试统计数据的计算
+func TestHistoryStats(t *testing.T) {
+	results := []SyncResult{
+		{Offset: 2 * time.Millisecond, RTT: 10 * time.Millisecond},
+		{Offset: 4 * time.Millisecond, RTT: 20 * time.Millisecond},
+		{Error: errors.New("超时")},
+		{Offset: 6 * time.Millisecond, RTT: 30 * time.Millisecond},
+		{Offset: 8 * time.Millisecond, RTT: 40 * time.Millisecond},
+	}
+
+	stats := computeHistoryStats(results)
+
+	if stats.Count != 4 || stats.Failures != 1 {
+		t.Errorf("预期4次成功、1次失败，实际得到%d次成功、%d次失败", stats.Count, stats.Failures)
+	}
+	if stats.MinOffset != 2*time.Millisecond || stats.MaxOffset != 8*time.Millisecond {
+		t.Errorf("预期偏移量范围为2ms到8ms，实际得到%v到%v", stats.MinOffset, stats.MaxOffset)
+	}
+	if stats.MeanOffset != 5*time.Millisecond {
+		t.Errorf("预期平均偏移量为5ms，实际得到%v", stats.MeanOffset)
+	}
+	// 总体标准差为sqrt(5)ms
+	if got := stats.StdDevOffset; got < 2236*time.Microsecond || got > 2237*time.Microsecond {
+		t.Errorf("预期偏移量标准差约为2.236ms，实际得到%v", got)
+	}
+	if stats.RTTP50 != 20*time.Millisecond || stats.RTTP90 != 40*time.Millisecond || stats.RTTP99 != 40*time.Millisecond {
+		t.Errorf("往返时间百分位数错误: p50=%v p90=%v p99=%v", stats.RTTP50, stats.RTTP90, stats.RTTP99)
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("序列化统计数据失败: %v", err)
+	}
+	var decoded HistoryStats
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("反序列化统计数据失败: %v", err)
+	}
+	if decoded != stats {
+		t.Errorf("预期往返序列化后不变，实际得到%+v", decoded)
+	}
+}
+
+// TestGetHistory 测试同步结果被记录到历史中
+func TestGetHistory(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:     []string{srv.Addr()},
+		Timeout:     200 * time.Millisecond,
+		HistorySize: 2,
+		Clock:       clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	srv.SetDrop(true)
+	clock.Advance(DefaultMinPollInterval)
+	if err := ntp.Sync(); err == nil {
+		t.Fatal("预期服务器不应答时同步失败，实际得到nil")
+	}
+
+	history := ntp.GetHistory(0)
+	if len(history) != 2 {
+		t.Fatalf("预期历史中有2个结果，实际得到%d个", len(history))
+	}
+	if history[0].Error != nil || history[0].Server != srv.Addr() {
+		t.Errorf("预期第一个结果为成功的同步，实际得到%+v", history[0])
+	}
+	if history[1].Error == nil {
+		t.Error("预期第二个结果为失败的同步，实际得到nil错误")
+	}
+
+	stats := ntp.GetHistoryStats()
+	if stats.Count != 1 || stats.Failures != 1 {
+		t.Errorf("预期1次成功、1次失败，实际得到%d次成功、%d次失败", stats.Count, stats.Failures)
+	}
+}
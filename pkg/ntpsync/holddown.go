@@ -0,0 +1,205 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 服务器故障抑制的默认参数
+const (
+	// DefaultHolddownThreshold 是暂时排除服务器前允许的连续失败次数
+	DefaultHolddownThreshold = 3
+
+	// DefaultHolddownInterval 是服务器第一次被排除的时长，之后每次重新探测失败加倍
+	DefaultHolddownInterval = 5 * time.Minute
+
+	// DefaultHolddownMax 是服务器被排除时长的上限
+	DefaultHolddownMax = 1 * time.Hour
+)
+
+// SetHolddown 设置故障抑制的参数
+// 服务器连续失败threshold次后被排除interval时长，到期后重新探测，
+// 探测仍然失败时排除时长加倍，直到DefaultHolddownMax；threshold不大于0时关闭故障抑制
+func (sm *ServerManager) SetHolddown(threshold int, interval time.Duration) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if interval <= 0 {
+		interval = DefaultHolddownInterval
+	}
+	sm.holddownThreshold = threshold
+	sm.holddownInterval = interval
+}
+
+// RecordSuccess 记录服务器的一次成功响应，恢复被排除的服务器
+func (sm *ServerManager) RecordSuccess(server string, status ServerStatus) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	serverStatus, exists := sm.servers[server]
+	if !exists {
+		return fmt.Errorf("服务器 %s 不存在", server)
+	}
+
+	sm.healthFor(server).record(true, status.RTT)
+
+	status.Address = serverStatus.Address
+	status.Reachable = true
+	status.Reach = serverStatus.Reach<<1 | 1
+	status.ConsecutiveFailures = 0
+	status.HeldDownUntil = time.Time{}
+	*serverStatus = status
+
+	sm.reorderServers()
+	return nil
+}
+
+// RecordFailure 记录服务器的一次失败，连续失败达到阈值后暂时排除该服务器
+func (sm *ServerManager) RecordFailure(server string, now time.Time) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	status, exists := sm.servers[server]
+	if !exists {
+		return fmt.Errorf("服务器 %s 不存在", server)
+	}
+
+	sm.healthFor(server).record(false, 0)
+
+	status.Reachable = false
+	status.Reach <<= 1
+	status.ConsecutiveFailures++
+
+	if sm.holddownThreshold > 0 && status.ConsecutiveFailures >= sm.holddownThreshold {
+		status.HeldDownUntil = now.Add(sm.holddownDuration(status.ConsecutiveFailures))
+	}
+
+	sm.reorderServers()
+	return nil
+}
+
+// holddownDuration 返回连续失败failures次后的排除时长
+func (sm *ServerManager) holddownDuration(failures int) time.Duration {
+	limit := DefaultHolddownMax
+	if sm.holddownInterval > limit {
+		limit = sm.holddownInterval
+	}
+
+	hold := sm.holddownInterval
+	for i := sm.holddownThreshold; i < failures && hold < limit; i++ {
+		hold *= 2
+	}
+	if hold > limit {
+		hold = limit
+	}
+	return hold
+}
+
+// ClearHolddown 恢复所有被暂时排除的服务器并清零连续失败次数
+// 用于本地网络恢复后，此前的失败不能说明服务器有故障
+func (sm *ServerManager) ClearHolddown() {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	for _, status := range sm.servers {
+		status.ConsecutiveFailures = 0
+		status.HeldDownUntil = time.Time{}
+	}
+	sm.reorderServers()
+}
+
+// IsHeldDown 返回服务器在now时是否处于被排除状态
+func (sm *ServerManager) IsHeldDown(server string, now time.Time) bool {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	status, exists := sm.servers[server]
+	return exists && now.Before(status.HeldDownUntil)
+}
+
+// availableServers 过滤掉servers中处于被排除状态或拒绝期的服务器
+// 排除期已过的服务器会被保留，由本次同步重新探测
+func (n *NTPSync) availableServers(servers []string) []string {
+	now := n.clock.Now()
+	available := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if n.isDenied(server, now) {
+			continue
+		}
+		if n.serverManager == nil || !n.serverManager.IsHeldDown(server, now) {
+			available = append(available, server)
+		}
+	}
+	return available
+}
+
+// recordServerResult 将一次测量的结果记录到服务器管理器sm
+func (n *NTPSync) recordServerResult(sm *ServerManager, server string, result *SyncResult, err error) {
+	if sm == nil {
+		n.recordReach(server, err)
+		return
+	}
+	if errors.Is(err, ErrClosed) || errors.Is(err, ErrRateLimited) {
+		return
+	}
+
+	if err != nil {
+		_ = sm.RecordFailure(server, n.clock.Now())
+		return
+	}
+	_ = sm.RecordSuccess(server, n.measuredStatus(server, result))
+}
+
+// recordReach 把一次请求的结果记录到服务器的可达性寄存器，用于没有服务器管理器的情况
+func (n *NTPSync) recordReach(server string, err error) {
+	if errors.Is(err, ErrClosed) || errors.Is(err, ErrRateLimited) {
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.reach == nil {
+		n.reach = make(map[string]uint8)
+	}
+	address := serverAddress(server)
+	reach := n.reach[address] << 1
+	if err == nil {
+		reach |= 1
+	}
+	n.reach[address] = reach
+}
+
+// reachOf 返回服务器的可达性寄存器，启用多服务器支持时从服务器管理器读取
+func (n *NTPSync) reachOf(server string) uint8 {
+	if n.serverManager != nil {
+		status, _ := n.serverManager.GetServerStatus(server)
+		return status.Reach
+	}
+
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	return n.reach[serverAddress(server)]
+}
+
+// measuredStatus 根据一次成功的测量构造服务器状态
+func (n *NTPSync) measuredStatus(server string, result *SyncResult) ServerStatus {
+	return ServerStatus{
+		Address:      server,
+		Reachable:    true,
+		LastResponse: n.clock.Now(),
+		RTT:          result.RTT,
+		Stratum:      result.Stratum,
+		ReferenceID:  result.ReferenceID,
+		Offset:       result.Offset,
+		Jitter:       n.serverJitter(result.Server),
+		RootDistance: result.RootDistance,
+
+		RootDelay:      result.RootDelay,
+		RootDispersion: result.RootDispersion,
+		Precision:      result.Precision,
+		Poll:           result.Poll,
+	}
+}
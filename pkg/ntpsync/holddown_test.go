@@ -0,0 +1,236 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestServerManagerHolddown 测试连续失败后排除服务器以及排除时长的加倍
+func TestServerManagerHolddown(t *testing.T) {
+	sm, err := NewServerManager([]string{"a", "b"}, time.Second)
+	if err != nil {
+		t.Fatalf("创建服务器管理器失败: %v", err)
+	}
+	sm.SetHolddown(2, time.Minute)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_ = sm.RecordFailure("a", now)
+	if sm.IsHeldDown("a", now) {
+		t.Error("预期第一次失败后不排除服务器")
+	}
+
+	_ = sm.RecordFailure("a", now)
+	if !sm.IsHeldDown("a", now) {
+		t.Fatal("预期连续失败2次后排除服务器")
+	}
+	if sm.IsHeldDown("a", now.Add(time.Minute)) {
+		t.Error("预期排除期过后可以重新探测服务器")
+	}
+
+	// 重新探测仍然失败时排除时长加倍
+	now = now.Add(time.Minute)
+	_ = sm.RecordFailure("a", now)
+	if !sm.IsHeldDown("a", now.Add(time.Minute+time.Second)) {
+		t.Error("预期重新探测失败后排除时长加倍")
+	}
+
+	status, _ := sm.GetServerStatus("a")
+	if status.ConsecutiveFailures != 3 || status.HeldDownUntil.IsZero() {
+		t.Errorf("预期状态记录了连续失败和排除截止时间，实际得到%+v", status)
+	}
+
+	// 成功响应后恢复服务器
+	_ = sm.RecordSuccess("a", ServerStatus{Stratum: 2})
+	if sm.IsHeldDown("a", now) {
+		t.Error("预期成功响应后恢复服务器")
+	}
+	status, _ = sm.GetServerStatus("a")
+	if !status.Reachable || status.ConsecutiveFailures != 0 || status.Stratum != 2 {
+		t.Errorf("预期恢复后的状态已重置，实际得到%+v", status)
+	}
+}
+
+// TestSyncSkipsHeldDownServers 测试同步跳过被排除的服务器，并在排除期过后重新探测
+func TestSyncSkipsHeldDownServers(t *testing.T) {
+	clock := newFakeClock()
+
+	down := ntptest.NewServer()
+	defer down.Close()
+	down.SetDrop(true)
+	down.SetNow(clock.Now)
+
+	up := ntptest.NewServer()
+	defer up.Close()
+	up.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:           []string{down.Addr(), up.Addr()},
+		Timeout:           100 * time.Millisecond,
+		EnableMultiServer: true,
+		HolddownThreshold: 2,
+		HolddownInterval:  time.Minute,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	// 第2次同步时可达的服务器也失败，不可达的服务器连续失败2次
+	for i, drop := range []bool{false, true, false} {
+		up.SetDrop(drop)
+		clock.Advance(DefaultMinPollInterval)
+		if err := ntp.Sync(); err != nil && !drop {
+			t.Fatalf("第%d次同步失败: %v", i+1, err)
+		}
+	}
+
+	// 连续失败2次后，第3次同步不再尝试不可达的服务器
+	if got := down.RequestCount(); got != 2 {
+		t.Errorf("预期不可达的服务器只收到2个请求，实际得到%d个", got)
+	}
+
+	statuses, _ := ntp.GetCachedServerStatuses()
+	if len(statuses) != 2 || statuses[0].Address != up.Addr() || statuses[1].HeldDownUntil.IsZero() {
+		t.Errorf("预期可达的服务器排在前面且不可达的服务器被排除，实际得到%+v", statuses)
+	}
+
+	// 排除期过后，排在前面的服务器失败时重新探测，服务器恢复后不再被排除
+	down.SetDrop(false)
+	up.SetDrop(true)
+	clock.Advance(time.Minute)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if got := down.RequestCount(); got != 3 {
+		t.Errorf("预期排除期过后重新探测服务器，实际收到%d个请求", got)
+	}
+	if ntp.serverManager.IsHeldDown(down.Addr(), clock.Now()) {
+		t.Error("预期服务器响应后被恢复")
+	}
+}
+
+// TestSyncSkipsServerHeldDownAfterOneFailure 测试阈值为1时服务器失败1次即被排除，排在后面时也不再尝试
+func TestSyncSkipsServerHeldDownAfterOneFailure(t *testing.T) {
+	clock := newFakeClock()
+
+	down := ntptest.NewServer()
+	defer down.Close()
+	down.SetDrop(true)
+	down.SetNow(clock.Now)
+
+	up := ntptest.NewServer()
+	defer up.Close()
+	up.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:           []string{down.Addr(), up.Addr()},
+		Timeout:           100 * time.Millisecond,
+		EnableMultiServer: true,
+		HolddownThreshold: 1,
+		HolddownInterval:  time.Minute,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(DefaultMinPollInterval)
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+	}
+
+	// 失败1次后被排除，之后的同步不再尝试不可达的服务器
+	if got := down.RequestCount(); got != 1 {
+		t.Errorf("预期不可达的服务器只收到1个请求，实际得到%d个", got)
+	}
+
+	statuses, _ := ntp.GetCachedServerStatuses()
+	if len(statuses) != 2 || statuses[0].Address != up.Addr() || statuses[1].HeldDownUntil.IsZero() {
+		t.Errorf("预期可达的服务器排在前面且不可达的服务器被排除，实际得到%+v", statuses)
+	}
+
+	// 排除期过后，排在前面的服务器失败时重新探测，服务器恢复后不再被排除
+	down.SetDrop(false)
+	up.SetDrop(true)
+	clock.Advance(time.Minute)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if got := down.RequestCount(); got != 2 {
+		t.Errorf("预期排除期过后重新探测服务器，实际收到%d个请求", got)
+	}
+	if ntp.serverManager.IsHeldDown(down.Addr(), clock.Now()) {
+		t.Error("预期服务器响应后被恢复")
+	}
+}
+
+// TestReachRegister 测试每次请求更新可达性寄存器
+func TestReachRegister(t *testing.T) {
+	sm, err := NewServerManager([]string{"a"}, time.Second)
+	if err != nil {
+		t.Fatalf("创建服务器管理器失败: %v", err)
+	}
+	sm.SetHolddown(0, 0)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_ = sm.RecordSuccess("a", ServerStatus{})
+	_ = sm.RecordFailure("a", now)
+	_ = sm.RecordSuccess("a", ServerStatus{})
+	if status, _ := sm.GetServerStatus("a"); status.Reach != 0b101 {
+		t.Errorf("预期可达性寄存器为5，实际得到%o", status.Reach)
+	}
+
+	// 只保留最近8次请求
+	for i := 0; i < 8; i++ {
+		_ = sm.RecordSuccess("a", ServerStatus{})
+	}
+	if status, _ := sm.GetServerStatus("a"); status.Reach != 0377 {
+		t.Errorf("预期可达性寄存器为377，实际得到%o", status.Reach)
+	}
+	_ = sm.RecordFailure("a", now)
+	if status, _ := sm.GetServerStatus("a"); status.Reach != 0376 {
+		t.Errorf("预期可达性寄存器为376，实际得到%o", status.Reach)
+	}
+}
+
+// TestReachWithoutServerManager 测试没有启用多服务器支持时也记录可达性寄存器
+func TestReachWithoutServerManager(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		Timeout:         100 * time.Millisecond,
+		MinPollInterval: -1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	srv.SetDrop(true)
+	if err := ntp.Sync(); err == nil {
+		t.Fatal("预期服务器不应答时同步失败")
+	}
+	if peers := ntp.GetPeers(); peers[0].Reach != 0b10 {
+		t.Errorf("预期GetPeers报告可达性寄存器2，实际得到%o", peers[0].Reach)
+	}
+
+	srv.SetDrop(false)
+	statuses, err := ntp.GetStatus()
+	if err != nil || statuses[0].Reach != 0b101 {
+		t.Errorf("预期GetStatus报告可达性寄存器5，实际得到%+v和%v", statuses, err)
+	}
+}
@@ -0,0 +1,208 @@
+package ntpsync
+
+import (
+	"math"
+	"time"
+)
+
+// 保持模式的参数
+const (
+	// DriftWindow 是估计本地时钟频率偏差使用的最近样本数量
+	DriftWindow = 8
+
+	// MinDriftSpan 是估计频率偏差所需样本覆盖的最短时长，
+	// 时长太短时测量噪声会淹没频率偏差
+	MinDriftSpan = 5 * time.Minute
+
+	// maxDrift 是频率偏差估计值的上限，与slewRate相同为500ppm，
+	// 也是没有估计值时误差上限的增长速率
+	maxDrift = slewRate
+)
+
+// HoldoverStatus 表示保持模式的状态
+type HoldoverStatus struct {
+	// Holdover 表示是否处于保持模式，即超过HoldoverAfter没有成功同步，
+	// 此时Now按估计的频率偏差继续调整
+	Holdover bool `json:"holdover"`
+
+	// Since 是进入保持模式的时间，不在保持模式时为零值
+	Since time.Time `json:"since"`
+
+	// DriftEstimated 表示是否已经估计出本地时钟的频率偏差
+	DriftEstimated bool `json:"drift_estimated"`
+
+	// Frequency 是估计的频率偏差，单位为ppm，正值表示偏移量随时间增大，即本地时钟走得慢
+	Frequency float64 `json:"frequency_ppm"`
+
+	// MaxError 是Now当前的估计误差上限，参见NowWithBounds；从未同步时为零
+	MaxError time.Duration `json:"max_error"`
+}
+
+// driftSample 是一次同步时的本地时间和偏移量
+type driftSample struct {
+	local  time.Time
+	offset time.Duration
+}
+
+// driftEstimator 按时间顺序保存最近DriftWindow个偏移量样本，用于估计频率偏差
+type driftEstimator struct {
+	samples [DriftWindow]driftSample
+	count   int
+	next    int
+}
+
+// add 添加一个样本，窗口已满时覆盖最旧的样本
+func (d *driftEstimator) add(local time.Time, offset time.Duration) {
+	d.samples[d.next] = driftSample{local: local, offset: offset}
+	d.next = (d.next + 1) % DriftWindow
+	if d.count < DriftWindow {
+		d.count++
+	}
+}
+
+// reset 丢弃所有样本，偏移量被直接调整或时钟发生不连续时调用
+func (d *driftEstimator) reset() {
+	*d = driftEstimator{}
+}
+
+// frequency 用最小二乘法拟合偏移量随本地时间变化的速率
+// 样本少于两个或覆盖的时长不足MinDriftSpan时ok为false；结果限制在±500ppm以内
+func (d *driftEstimator) frequency() (freq float64, ok bool) {
+	freq, _, ok = d.fit()
+	return freq, ok
+}
+
+// fit 用最小二乘法拟合偏移量随本地时间变化的速率，同时返回速率的标准误差，参见fitDrift
+func (d *driftEstimator) fit() (freq, stderr float64, ok bool) {
+	var samples [DriftWindow]driftSample
+	start := (d.next - d.count + DriftWindow) % DriftWindow
+	for i := 0; i < d.count; i++ {
+		samples[i] = d.samples[(start+i)%DriftWindow]
+	}
+	return fitDrift(samples[:d.count])
+}
+
+// fitDrift 用最小二乘法拟合按时间顺序排列的样本中偏移量随本地时间变化的速率，同时返回速率的标准误差
+// 样本少于两个或覆盖的时长不足MinDriftSpan时ok为false；样本少于三个时无法估计标准误差，返回0；
+// 速率和标准误差都限制在500ppm以内
+func fitDrift(samples []driftSample) (freq, stderr float64, ok bool) {
+	count := len(samples)
+	if count < 2 {
+		return 0, 0, false
+	}
+
+	first := samples[0].local
+	if samples[count-1].local.Sub(first) < MinDriftSpan {
+		return 0, 0, false
+	}
+
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.local.Sub(first).Seconds()
+		sumY += s.offset.Seconds()
+	}
+	meanX, meanY := sumX/float64(count), sumY/float64(count)
+
+	var sxy, sxx float64
+	for _, s := range samples {
+		dx := s.local.Sub(first).Seconds() - meanX
+		sxy += dx * (s.offset.Seconds() - meanY)
+		sxx += dx * dx
+	}
+	if sxx == 0 {
+		return 0, 0, false
+	}
+	slope := sxy / sxx
+
+	if count > 2 {
+		var ssr float64
+		for _, s := range samples {
+			residual := s.offset.Seconds() - meanY - slope*(s.local.Sub(first).Seconds()-meanX)
+			ssr += residual * residual
+		}
+		stderr = math.Min(maxDrift, math.Sqrt(ssr/float64(count-2)/sxx))
+	}
+
+	return math.Max(-maxDrift, math.Min(maxDrift, slope)), stderr, true
+}
+
+// syncErrorBound 返回一次同步结果的误差上限
+// NTP服务器使用根距离，其它时间源使用其保证的误差，都没有时使用往返时间的一半
+func syncErrorBound(result *SyncResult) time.Duration {
+	switch {
+	case result.RootDistance > 0:
+		return result.RootDistance
+	case result.Uncertainty > 0:
+		return result.Uncertainty
+	default:
+		return result.RTT / 2
+	}
+}
+
+// recordDriftLocked 记录一次应用的同步结果，调用者必须持有n.mutex
+// 偏移量的变化达到直接调整的阈值（未设置时为DefaultStepThreshold）时，
+// 认为时间发生了跳变而不是频率偏差的累积，丢弃之前的样本重新估计
+func (n *NTPSync) recordDriftLocked(local time.Time, previous time.Duration, result *SyncResult) {
+	n.syncErrorBound = syncErrorBound(result)
+
+	jump := n.thresholds.stepThreshold
+	if jump <= 0 {
+		jump = DefaultStepThreshold
+	}
+	if absDuration(result.Offset-previous) >= jump {
+		n.drift.reset()
+	}
+	n.drift.add(local, result.Offset)
+}
+
+// holdoverAfterLocked 返回进入保持模式前允许的最长同步间隔，调用者必须持有n.mutex
+func (n *NTPSync) holdoverAfterLocked() time.Duration {
+	if n.holdoverAfter > 0 {
+		return n.holdoverAfter
+	}
+	return 2 * n.syncInterval
+}
+
+// holdoverLocked 返回本地时间为local时的保持模式状态和Now需要额外调整的偏移量
+// 调用者必须持有n.mutex的读锁或写锁
+func (n *NTPSync) holdoverLocked(local time.Time) (HoldoverStatus, time.Duration) {
+	var status HoldoverStatus
+	if n.lastSync.IsZero() {
+		return status, 0
+	}
+
+	freq, ok := n.drift.frequency()
+	status.DriftEstimated = ok
+	status.Frequency = freq * 1e6
+
+	age := local.Sub(n.lastSync) + n.suspendedSinceSync
+	if age < 0 {
+		age = 0
+	}
+	after := n.holdoverAfterLocked()
+	if age <= after {
+		return status, 0
+	}
+
+	// 从进入保持模式时开始按频率偏差调整，Now不会在进入时跳变
+	status.Holdover = true
+	status.Since = local.Add(after - age)
+	return status, holdoverCorrection(age, after, freq)
+}
+
+// GetHoldoverStatus 返回保持模式的状态和当前的估计误差上限
+func (n *NTPSync) GetHoldoverStatus() HoldoverStatus {
+	local := n.clock.Now()
+
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	status, _ := n.holdoverLocked(local)
+	status.MaxError = n.maxErrorLocked(local)
+	return status
+}
+
+// IsHoldover 返回是否处于保持模式，即所有服务器长时间不可达，Now正在按估计的频率偏差推算
+func (n *NTPSync) IsHoldover() bool {
+	return n.GetHoldoverStatus().Holdover
+}
@@ -0,0 +1,110 @@
+package ntpsync
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// TestDriftEstimator 测试根据偏移量样本估计频率偏差
+func TestDriftEstimator(t *testing.T) {
+	var d driftEstimator
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	d.add(start, 0)
+	d.add(start.Add(time.Minute), 600*time.Microsecond)
+	if _, ok := d.frequency(); ok {
+		t.Error("预期样本覆盖的时长不足时不估计频率偏差")
+	}
+
+	// 10ppm的频率偏差加上测量噪声
+	noise := []time.Duration{0, 50 * time.Microsecond, -50 * time.Microsecond}
+	for i := 2; i <= 20; i++ {
+		d.add(start.Add(time.Duration(i)*time.Minute), time.Duration(i)*600*time.Microsecond+noise[i%3])
+	}
+	freq, ok := d.frequency()
+	if !ok || math.Abs(freq-10e-6) > 1e-6 {
+		t.Errorf("预期频率偏差约为10ppm，实际得到%v (%v)", freq*1e6, ok)
+	}
+
+	// 超过500ppm的估计值被限制
+	d.reset()
+	d.add(start, 0)
+	d.add(start.Add(10*time.Minute), time.Second)
+	if freq, _ := d.frequency(); freq != maxDrift {
+		t.Errorf("预期频率偏差被限制为%v，实际得到%v", maxDrift, freq)
+	}
+}
+
+// TestHoldover 测试长时间同步失败后进入保持模式并按频率偏差推算时间
+func TestHoldover(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		HoldoverAfter:    time.Hour,
+		OutlierThreshold: -1,
+		Clock:            clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if status := ntp.GetHoldoverStatus(); status.Holdover || status.MaxError != 0 {
+		t.Errorf("预期从未同步时不处于保持模式，实际得到%+v", status)
+	}
+
+	// 本地时钟每秒慢10微秒
+	src := &fakeSource{uncertainty: time.Millisecond}
+	for i := 0; i <= 10; i++ {
+		src.offset = time.Duration(i) * 600 * time.Microsecond
+		if err := ntp.SyncWithSource(context.Background(), src); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+		if i < 10 {
+			clock.Advance(time.Minute)
+		}
+	}
+	lastSync := clock.Now()
+
+	status := ntp.GetHoldoverStatus()
+	if status.Holdover || !status.DriftEstimated || math.Abs(status.Frequency-10) > 0.1 {
+		t.Fatalf("预期估计出10ppm的频率偏差，实际得到%+v", status)
+	}
+	if status.MaxError != time.Millisecond {
+		t.Errorf("预期误差上限为同步的误差，实际得到%v", status.MaxError)
+	}
+
+	// 等待逐渐调整完成，尚未进入保持模式时不额外调整
+	clock.Advance(time.Hour)
+	if ntp.IsHoldover() {
+		t.Fatal("预期没有超过HoldoverAfter时不进入保持模式")
+	}
+	if got, want := ntp.Now(), clock.Now().Add(6*time.Millisecond); got.Sub(want).Abs() > time.Microsecond {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+
+	clock.Advance(time.Hour)
+	status = ntp.GetHoldoverStatus()
+	if !status.Holdover || !status.Since.Equal(lastSync.Add(time.Hour)) {
+		t.Fatalf("预期在最后一次同步1小时后进入保持模式，实际得到%+v", status)
+	}
+	// 误差上限包括离散度的增长和进入保持模式前没有按频率偏差调整的1小时
+	want := time.Millisecond + time.Duration(float64(2*time.Hour)*frequencyTolerance) + 36*time.Millisecond
+	if diff := status.MaxError - want; diff.Abs() > time.Microsecond {
+		t.Errorf("预期误差上限为%v，实际得到%v", want, status.MaxError)
+	}
+	if got, want := ntp.Now(), clock.Now().Add(6*time.Millisecond+36*time.Millisecond); got.Sub(want).Abs() > 100*time.Microsecond {
+		t.Errorf("预期按频率偏差推算为%v，实际得到%v", want, got)
+	}
+
+	// 同步成功后退出保持模式
+	src.offset = 78 * time.Millisecond
+	if err := ntp.SyncWithSource(context.Background(), src); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if ntp.IsHoldover() {
+		t.Error("预期同步成功后退出保持模式")
+	}
+}
@@ -0,0 +1,125 @@
+package ntpsync
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPStatusHandler 以JSON格式提供同步状态，并提供/healthz健康检查路由
+// 可直接挂载到现有的Web服务器或用作Kubernetes探针
+type HTTPStatusHandler struct {
+	ntp *NTPSync
+
+	// MaxAge 是健康检查认为同步仍然有效的最长时间
+	// 零值表示使用两倍的同步间隔
+	MaxAge time.Duration
+}
+
+// StatusHandler 创建一个提供NTP同步状态的http.Handler
+// 以/healthz结尾的路径返回健康检查结果，同步过期时返回503，
+// 其它路径返回包含偏移量、最后同步时间和服务器状态的JSON
+func StatusHandler(n *NTPSync) *HTTPStatusHandler {
+	return &HTTPStatusHandler{ntp: n}
+}
+
+// statusPayload 是状态路由返回的JSON结构
+type statusPayload struct {
+	Now      jsonTime           `json:"now"`
+	Offset   jsonDuration       `json:"offset"`
+	LastSync jsonTime           `json:"last_sync"`
+	Healthy  bool               `json:"healthy"`
+	Periodic PeriodicSyncStatus `json:"periodic"`
+	Holdover HoldoverStatus     `json:"holdover"`
+	History  HistoryStats       `json:"history"`
+	Servers  []ServerStatus     `json:"servers,omitempty"`
+}
+
+// healthPayload 是健康检查路由返回的JSON结构
+type healthPayload struct {
+	Status   string       `json:"status"`
+	LastSync jsonTime     `json:"last_sync"`
+	Age      jsonDuration `json:"age"`
+	MaxAge   jsonDuration `json:"max_age"`
+}
+
+// ServeHTTP 实现http.Handler
+func (h *HTTPStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/healthz") {
+		h.serveHealth(w)
+		return
+	}
+
+	h.serveStatus(w)
+}
+
+// serveStatus 返回完整的同步状态
+func (h *HTTPStatusHandler) serveStatus(w http.ResponseWriter) {
+	healthy, _, _ := h.check()
+
+	payload := statusPayload{
+		Now:      jsonTime(h.ntp.Now()),
+		Offset:   jsonDuration(h.ntp.TimeOffsetDuration()),
+		LastSync: jsonTime(h.ntp.LastSyncTime()),
+		Healthy:  healthy,
+		Periodic: h.ntp.GetPeriodicSyncStatus(),
+		Holdover: h.ntp.GetHoldoverStatus(),
+		History:  h.ntp.GetHistoryStats(),
+	}
+
+	// 仅返回已缓存的服务器状态，避免每次请求都探测服务器
+	if statuses, err := h.ntp.GetCachedServerStatuses(); err == nil {
+		payload.Servers = statuses
+	}
+
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// serveHealth 返回健康检查结果
+func (h *HTTPStatusHandler) serveHealth(w http.ResponseWriter) {
+	healthy, age, maxAge := h.check()
+
+	payload := healthPayload{
+		Status:   "ok",
+		LastSync: jsonTime(h.ntp.LastSyncTime()),
+		Age:      jsonDuration(age),
+		MaxAge:   jsonDuration(maxAge),
+	}
+
+	code := http.StatusOK
+	if !healthy {
+		payload.Status = "stale"
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, payload)
+}
+
+// check 判断最后一次同步是否在允许的时间范围内
+func (h *HTTPStatusHandler) check() (bool, time.Duration, time.Duration) {
+	maxAge := h.MaxAge
+	if maxAge <= 0 {
+		maxAge = 2 * h.ntp.GetPeriodicSyncInterval()
+	}
+
+	age := h.ntp.LastSyncAge()
+	if age == NeverSynced {
+		return false, 0, maxAge
+	}
+	return age <= maxAge, age, maxAge
+}
+
+// writeJSON 以给定的状态码写入JSON响应
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
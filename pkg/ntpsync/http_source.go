@@ -0,0 +1,117 @@
+package ntpsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// maxHTTPSourceBody 是HTTPSource读取的应答内容的上限，StatusHandler的状态远小于此
+const maxHTTPSourceBody = 1 << 20
+
+// HTTPSourceOptions 包含创建HTTPSource的选项
+type HTTPSourceOptions struct {
+	// URL 是请求的地址，例如"https://example.com/"。指向StatusHandler时使用其中的now字段，
+	// 精度只受往返时间限制；其它地址使用应答的Date头部，只能精确到秒
+	URL string
+
+	// Client 是发送请求使用的HTTP客户端，nil表示使用http.DefaultClient
+	Client *http.Client
+
+	// Clock 是测量往返时间使用的本地时间来源，nil表示使用系统时钟
+	Clock Clock
+}
+
+// HTTPSource 是通过HTTP(S)请求测量偏移量的时间源，用于不能发送UDP数据包的环境，
+// 例如浏览器中的js/wasm程序，或者只允许访问HTTPS的网络
+type HTTPSource struct {
+	url    string
+	client *http.Client
+	clock  Clock
+}
+
+// NewHTTPSource 创建HTTP(S)时间源
+func NewHTTPSource(opts HTTPSourceOptions) *HTTPSource {
+	s := &HTTPSource{url: opts.URL, client: opts.Client, clock: opts.Clock}
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+	if s.clock == nil {
+		s.clock = SystemClock{}
+	}
+	return s
+}
+
+// Name 返回请求的地址
+func (s *HTTPSource) Name() string {
+	return s.url
+}
+
+// Measure 发送一次GET请求，以服务器时间与请求和应答中点的本地时间之差作为偏移量
+// Uncertainty为往返时间的一半，使用Date头部时再加上半秒。来自缓存的应答被拒绝
+func (s *HTTPSource) Measure(ctx context.Context) (*SyncResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Cache-Control", "no-cache")
+
+	sent := s.clock.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	received := s.clock.Now()
+	defer resp.Body.Close()
+
+	if age := resp.Header.Get("Age"); age != "" && age != "0" {
+		return nil, fmt.Errorf("应答来自缓存（Age: %s）", age)
+	}
+
+	rtt := received.Sub(sent)
+	uncertainty := rtt / 2
+	serverTime := statusTime(resp)
+	if serverTime.IsZero() {
+		date := resp.Header.Get("Date")
+		if date == "" {
+			return nil, errors.New("应答中没有Date头部")
+		}
+		t, err := http.ParseTime(date)
+		if err != nil {
+			return nil, fmt.Errorf("无法解析Date头部: %w", err)
+		}
+		// Date只精确到秒，取这一秒的中点
+		serverTime = t.Add(time.Second / 2)
+		uncertainty += time.Second / 2
+	}
+
+	return &SyncResult{
+		Server:      s.url,
+		Time:        serverTime,
+		Offset:      serverTime.Sub(sent.Add(rtt / 2)),
+		RTT:         rtt,
+		Uncertainty: uncertainty,
+	}, nil
+}
+
+// statusTime 返回StatusHandler应答中的now字段，不是StatusHandler的应答时返回零值
+func statusTime(resp *http.Response) time.Time {
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "application/json" {
+		return time.Time{}
+	}
+	var payload struct {
+		Now jsonTime `json:"now"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxHTTPSourceBody)).Decode(&payload); err != nil {
+		return time.Time{}
+	}
+	return time.Time(payload.Now)
+}
@@ -0,0 +1,86 @@
+package ntpsync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestHTTPSourceStatus 测试使用StatusHandler应答中的now字段，误差只受往返时间限制
+func TestHTTPSourceStatus(t *testing.T) {
+	upstream, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		PreferredSources: []Source{&fakeSource{offset: time.Hour}},
+		MinPollInterval:  -1,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer upstream.Close()
+	if err := upstream.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	server := httptest.NewServer(StatusHandler(upstream))
+	defer server.Close()
+
+	src := NewHTTPSource(HTTPSourceOptions{URL: server.URL})
+	result, err := src.Measure(context.Background())
+	if err != nil {
+		t.Fatalf("测量失败: %v", err)
+	}
+	if result.Uncertainty >= time.Second/2 {
+		t.Errorf("预期误差上限只受往返时间限制，实际得到%v", result.Uncertainty)
+	}
+	if diff := absDuration(result.Offset - time.Hour); diff > result.Uncertainty+10*time.Millisecond {
+		t.Errorf("预期偏移量约为1小时，实际得到%v（误差上限%v）", result.Offset, result.Uncertainty)
+	}
+	if result.Server != server.URL {
+		t.Errorf("预期时间源名称为%s，实际得到%s", server.URL, result.Server)
+	}
+}
+
+// TestHTTPSourceDate 测试使用Date头部时误差上限包含半秒
+func TestHTTPSourceDate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	result, err := NewHTTPSource(HTTPSourceOptions{URL: server.URL}).Measure(context.Background())
+	if err != nil {
+		t.Fatalf("测量失败: %v", err)
+	}
+	if result.Uncertainty < time.Second/2 {
+		t.Errorf("预期误差上限至少为半秒，实际得到%v", result.Uncertainty)
+	}
+	if diff := absDuration(result.Offset - time.Hour); diff > result.Uncertainty {
+		t.Errorf("预期偏移量约为1小时，实际得到%v（误差上限%v）", result.Offset, result.Uncertainty)
+	}
+}
+
+// TestHTTPSourceErrors 测试拒绝来自缓存和没有时间的应答
+func TestHTTPSourceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		header func(http.Header)
+	}{
+		{"来自缓存", func(h http.Header) { h.Set("Age", "30") }},
+		{"没有Date头部", func(h http.Header) { h["Date"] = nil }},
+		{"无效的Date头部", func(h http.Header) { h.Set("Date", "yesterday") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.header(w.Header())
+			}))
+			defer server.Close()
+
+			if _, err := NewHTTPSource(HTTPSourceOptions{URL: server.URL}).Measure(context.Background()); err == nil {
+				t.Error("预期返回错误")
+			}
+		})
+	}
+}
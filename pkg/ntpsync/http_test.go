@@ -0,0 +1,94 @@
+package ntpsync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestStatusHandler 测试状态接口返回的JSON
+func TestStatusHandler(t *testing.T) {
+	ntp, err := New(Options{
+		Servers:           []string{"pool.ntp.org", "time.google.com"},
+		EnableMultiServer: true,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	ntp.timeOffset = 2 * time.Second
+	ntp.lastSync = time.Now()
+
+	rec := httptest.NewRecorder()
+	StatusHandler(ntp).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("预期状态码200，实际得到%d", rec.Code)
+	}
+
+	var payload struct {
+		Offset  string         `json:"offset"`
+		Healthy bool           `json:"healthy"`
+		Servers []ServerStatus `json:"servers"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("解析状态JSON失败: %v", err)
+	}
+
+	if payload.Offset != "2s" {
+		t.Errorf("预期偏移量为2s，实际得到%s", payload.Offset)
+	}
+
+	if !payload.Healthy {
+		t.Error("预期状态为健康，实际得到false")
+	}
+
+	if len(payload.Servers) != 2 {
+		t.Errorf("预期2个服务器状态，实际得到%d个", len(payload.Servers))
+	}
+}
+
+// TestStatusHandlerHealthz 测试健康检查路由
+func TestStatusHandlerHealthz(t *testing.T) {
+	ntp, err := New(Options{
+		Servers: []string{"pool.ntp.org"},
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	handler := StatusHandler(ntp)
+	handler.MaxAge = time.Minute
+
+	// 从未同步时应返回503
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ntp/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("预期从未同步时返回503，实际得到%d", rec.Code)
+	}
+
+	// 最近同步过时应返回200
+	ntp.lastSync = time.Now()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ntp/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("预期同步有效时返回200，实际得到%d", rec.Code)
+	}
+
+	// 同步过期时应返回503
+	ntp.lastSync = time.Now().Add(-2 * time.Minute)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ntp/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("预期同步过期时返回503，实际得到%d", rec.Code)
+	}
+
+	// 不支持的请求方法
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("预期返回405，实际得到%d", rec.Code)
+	}
+}
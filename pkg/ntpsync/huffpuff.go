@@ -0,0 +1,81 @@
+package ntpsync
+
+import "time"
+
+// DefaultHuffPuff 是推荐的huff-n'-puff窗口长度，与ntpd文档中tinker huffpuff的示例相同
+const DefaultHuffPuff = 2 * time.Hour
+
+// huffPuffSlots 是huff-n'-puff窗口划分的时段数量，每个时段记录其中最小的往返时间，
+// 最旧的时段过期后窗口整体向前移动
+const huffPuffSlots = 8
+
+// huffPuffSlot 是一个时段中最小的往返时间
+type huffPuffSlot struct {
+	valid bool
+	epoch int64 // 时段的编号，即本地时间除以时段长度
+	delay time.Duration
+}
+
+// huffPuffFilter 记录一个服务器在窗口内的最小往返时间
+type huffPuffFilter struct {
+	slots [huffPuffSlots]huffPuffSlot
+}
+
+// add 记录本地时间为local时测得的往返时间rtt，返回包括rtt在内窗口内的最小往返时间
+func (h *huffPuffFilter) add(local time.Time, rtt, window time.Duration) time.Duration {
+	length := max(window/huffPuffSlots, time.Nanosecond)
+	epoch := local.UnixNano() / int64(length)
+	i := int(epoch % huffPuffSlots)
+	if i < 0 {
+		i += huffPuffSlots
+	}
+	if s := &h.slots[i]; s.valid && s.epoch == epoch {
+		s.delay = min(s.delay, rtt)
+	} else {
+		*s = huffPuffSlot{valid: true, epoch: epoch, delay: rtt}
+	}
+
+	minDelay := rtt
+	for _, s := range h.slots {
+		if s.valid && s.epoch > epoch-huffPuffSlots && s.epoch <= epoch {
+			minDelay = min(minDelay, s.delay)
+		}
+	}
+	return minDelay
+}
+
+// huffPuffCorrection 返回往返时间超过最小往返时间时对偏移量的修正。
+// 网络拥塞通常只发生在一个方向上，多出的延迟使偏移量偏向一侧，最多偏差多出延迟的一半；
+// 与ntpd相同，假设已应用的偏移量基本准确，按残差（偏移量与已应用偏移量的差）的符号判断拥塞的方向，
+// 修正不会改变残差的符号
+func huffPuffCorrection(residual, rtt, minDelay time.Duration) time.Duration {
+	excess := (rtt - minDelay) / 2
+	if excess <= 0 || residual == 0 {
+		return 0
+	}
+	correction := min(excess, absDuration(residual))
+	if residual > 0 {
+		return -correction
+	}
+	return correction
+}
+
+// huffPuffCorrect 记录服务器的往返时间，返回按其在HuffPuff窗口内的最小往返时间对偏移量的修正，
+// 没有启用huff-n'-puff时返回0
+func (n *NTPSync) huffPuffCorrect(server string, local time.Time, offset, rtt time.Duration) time.Duration {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.huffPuff <= 0 {
+		return 0
+	}
+	if n.huffPuffFilters == nil {
+		n.huffPuffFilters = make(map[string]*huffPuffFilter)
+	}
+	h, ok := n.huffPuffFilters[server]
+	if !ok {
+		h = &huffPuffFilter{}
+		n.huffPuffFilters[server] = h
+	}
+	return huffPuffCorrection(offset-n.timeOffset, rtt, h.add(local, rtt, n.huffPuff))
+}
@@ -0,0 +1,128 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestHuffPuffFilter 测试窗口内最小往返时间的记录和过期
+func TestHuffPuffFilter(t *testing.T) {
+	var h huffPuffFilter
+	window := 8 * time.Minute
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := h.add(start, 30*time.Millisecond, window); got != 30*time.Millisecond {
+		t.Errorf("预期第一次测量就是最小往返时间，实际得到%v", got)
+	}
+	if got := h.add(start.Add(3*time.Minute), 100*time.Millisecond, window); got != 30*time.Millisecond {
+		t.Errorf("预期窗口内的最小往返时间为30ms，实际得到%v", got)
+	}
+	// 30ms所在的时段过期后，最小值来自之后的测量
+	if got := h.add(start.Add(9*time.Minute), 200*time.Millisecond, window); got != 100*time.Millisecond {
+		t.Errorf("预期旧的最小值过期，实际得到%v", got)
+	}
+
+	cases := []struct {
+		offset, rtt, minDelay, want time.Duration
+	}{
+		{offset: 40 * time.Millisecond, rtt: 100 * time.Millisecond, minDelay: 20 * time.Millisecond, want: -40 * time.Millisecond},
+		{offset: -50 * time.Millisecond, rtt: 100 * time.Millisecond, minDelay: 20 * time.Millisecond, want: 40 * time.Millisecond},
+		{offset: 5 * time.Millisecond, rtt: 20 * time.Millisecond, minDelay: 20 * time.Millisecond, want: 0},
+		{offset: 0, rtt: 100 * time.Millisecond, minDelay: 20 * time.Millisecond, want: 0},
+	}
+	for _, c := range cases {
+		if got := huffPuffCorrection(c.offset, c.rtt, c.minDelay); got != c.want {
+			t.Errorf("huffPuffCorrection(%v, %v, %v) = %v，预期%v", c.offset, c.rtt, c.minDelay, got, c.want)
+		}
+	}
+}
+
+// TestHuffPuff 测试拥塞时按最小往返时间修正单向延迟造成的偏移量误差
+func TestHuffPuff(t *testing.T) {
+	clock := newFakeClock()
+	network := ntptest.NewNetwork()
+	network.SetClock(clock.Now, clock.Advance)
+	srv := network.NewServer("10.0.0.1:123")
+	srv.SetDelay(20 * time.Millisecond)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		Dialer:          network,
+		MinPollInterval: -1,
+		HuffPuff:        DefaultHuffPuff,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	result, err := ntp.syncWithServerBinary(srv.Addr(), time.Second)
+	if err != nil {
+		t.Fatalf("测量失败: %v", err)
+	}
+	if result.HuffPuff != 0 || result.RTT != 20*time.Millisecond {
+		t.Errorf("预期第一次测量不修正，实际得到%+v", result)
+	}
+
+	// 应答方向拥塞100ms，测得的偏移量偏向负值50ms
+	srv.SetTransmitLatency(100 * time.Millisecond)
+	clock.Advance(time.Minute)
+	result, err = ntp.syncWithServerBinary(srv.Addr(), time.Second)
+	if err != nil {
+		t.Fatalf("测量失败: %v", err)
+	}
+	if result.RTT != 120*time.Millisecond || result.HuffPuff != 50*time.Millisecond {
+		t.Errorf("预期修正多出延迟的一半50ms，实际得到%+v", result)
+	}
+	if absDuration(result.Offset) > time.Microsecond {
+		t.Errorf("预期修正后的偏移量约为0，实际得到%v", result.Offset)
+	}
+}
+
+// TestHuffPuffSteadyOffset 测试本地时钟有稳定的偏移量时按残差判断拥塞的方向，
+// 移除服务器时丢弃其记录
+func TestHuffPuffSteadyOffset(t *testing.T) {
+	clock := newFakeClock()
+	network := ntptest.NewNetwork()
+	network.SetClock(clock.Now, clock.Advance)
+	srv := network.NewServer("10.0.0.1:123")
+	srv.SetDelay(20 * time.Millisecond)
+	srv.SetOffset(2 * time.Second)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		Dialer:          network,
+		MinPollInterval: -1,
+		HuffPuff:        DefaultHuffPuff,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 应答方向拥塞100ms，测得的偏移量比2秒小50ms，残差为负，应当向正方向修正
+	srv.SetTransmitLatency(100 * time.Millisecond)
+	clock.Advance(time.Minute)
+	result, err := ntp.syncWithServerBinary(srv.Addr(), time.Second)
+	if err != nil {
+		t.Fatalf("测量失败: %v", err)
+	}
+	if result.HuffPuff != 50*time.Millisecond || absDuration(result.Offset-2*time.Second) > time.Microsecond {
+		t.Errorf("预期修正50ms后偏移量约为2秒，实际得到%+v", result)
+	}
+
+	ntp.RemoveServer(srv.Addr())
+	ntp.mutex.RLock()
+	defer ntp.mutex.RUnlock()
+	if _, ok := ntp.huffPuffFilters[srv.Addr()]; ok {
+		t.Error("预期移除服务器时丢弃其最小往返时间的记录")
+	}
+}
@@ -0,0 +1,79 @@
+package ntpsync
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrHardwareTimestampsUnsupported 表示当前平台不支持网卡硬件时间戳
+var ErrHardwareTimestampsUnsupported = errors.New("当前平台不支持硬件时间戳")
+
+// maxTxTimestamps 是等待请求取走的发送时间戳数量上限，超过时丢弃全部，
+// 避免请求在收到应答前结束时留下的时间戳不断累积
+const maxTxTimestamps = 64
+
+// txTimestamps 是内核为一个请求记录的发送时间戳，零值表示没有
+type txTimestamps struct {
+	// software 是内核交给网卡驱动时的系统时间
+	software time.Time
+
+	// hardware 是网卡发出数据包时网卡时钟的时间
+	hardware time.Time
+}
+
+// checkHardwareTimestamps 检查硬件时间戳的设置，并让网卡为所有收发的数据包记录时间戳，
+// 返回的restore恢复网卡原来的设置
+func checkHardwareTimestamps(opts Options) (restore func(), err error) {
+	if opts.Interface == "" {
+		return nil, errors.New("使用硬件时间戳必须设置Interface")
+	}
+	if opts.Clock != nil {
+		return nil, errors.New("不能同时设置Clock和HardwareTimestamps")
+	}
+	return enableHardwareTimestamps(opts.Interface)
+}
+
+// txTimestamp 读取内核记录的发送时间戳，返回编号为id的请求的时间戳
+func (s *udpSocket) txTimestamp(id uint32) (txTimestamps, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.txStamps == nil {
+		s.txStamps = make(map[uint32]txTimestamps)
+	}
+	readTxTimestamps(s.conn, func(id uint32, software, hardware time.Time) {
+		tx := s.txStamps[id]
+		if !software.IsZero() {
+			tx.software = software
+		}
+		if !hardware.IsZero() {
+			tx.hardware = hardware
+		}
+		s.txStamps[id] = tx
+	})
+
+	tx, ok := s.txStamps[id]
+	delete(s.txStamps, id)
+	if len(s.txStamps) > maxTxTimestamps {
+		clear(s.txStamps)
+	}
+	return tx, ok
+}
+
+// hardwareReceiveTime 按网卡硬件时间戳计算应答的接收时间：网卡时钟与系统时钟不同步，
+// 只使用两个硬件时间戳之差，以内核记录的软件发送时间为起点。
+// 返回值保留received的单调时钟读数，结果不合理时返回false
+func hardwareReceiveTime(received time.Time, tx txTimestamps, rxHardware time.Time) (time.Time, bool) {
+	if tx.software.IsZero() || tx.hardware.IsZero() || rxHardware.IsZero() {
+		return time.Time{}, false
+	}
+	interval := rxHardware.Sub(tx.hardware)
+	if interval < 0 {
+		return time.Time{}, false
+	}
+	lag := received.Sub(tx.software.Add(interval))
+	if lag < 0 || lag > maxKernelTimestampLag {
+		return time.Time{}, false
+	}
+	return received.Add(-lag), true
+}
@@ -0,0 +1,183 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// SO_TIMESTAMPING的标志，参见内核文档Documentation/networking/timestamping.rst
+const (
+	sofTimestampingTxHardware  = 1 << 0
+	sofTimestampingTxSoftware  = 1 << 1
+	sofTimestampingRxHardware  = 1 << 2
+	sofTimestampingRxSoftware  = 1 << 3
+	sofTimestampingSoftware    = 1 << 4
+	sofTimestampingRawHardware = 1 << 6
+	sofTimestampingOptID       = 1 << 7
+	sofTimestampingOptTSOnly   = 1 << 11
+)
+
+// timestampingFlags 请求软件和硬件的收发时间戳，发送时间戳按发送顺序编号，且不附带数据包内容
+const timestampingFlags = sofTimestampingTxHardware | sofTimestampingTxSoftware |
+	sofTimestampingRxHardware | sofTimestampingRxSoftware |
+	sofTimestampingSoftware | sofTimestampingRawHardware |
+	sofTimestampingOptID | sofTimestampingOptTSOnly
+
+// 网卡硬件时间戳的ioctl和设置，参见linux/net_tstamp.h
+const (
+	siocSHWTStamp        = 0x89b0
+	siocGHWTStamp        = 0x89b1
+	hwtstampTxOn         = 1
+	hwtstampFilterAll    = 1
+	hwtstampFilterNTPAll = 15
+)
+
+// soEEOriginTimestamping 是错误队列中发送时间戳消息的来源
+const soEEOriginTimestamping = 4
+
+// hardwareTimestampSpace 是接收控制消息的缓冲区大小，
+// 足够容纳SCM_TIMESTAMPING的三个时间戳和发送时间戳附带的sock_extended_err
+var hardwareTimestampSpace = syscall.CmsgSpace(3*timespecSize) + syscall.CmsgSpace(16)
+
+// hwtstampConfig 对应struct hwtstamp_config
+type hwtstampConfig struct {
+	flags    int32
+	txType   int32
+	rxFilter int32
+}
+
+// ifreqData 对应ifr_data形式的struct ifreq
+type ifreqData struct {
+	name [syscall.IFNAMSIZ]byte
+	data uintptr
+	_    [24 - unsafe.Sizeof(uintptr(0))]byte
+}
+
+// enableHardwareTimestamps 通过SIOCSHWTSTAMP让网卡为发出的数据包和收到的所有数据包记录时间戳，
+// 网卡不支持为所有数据包记录时间戳时改为只为NTP数据包记录。需要CAP_NET_ADMIN权限。
+// 设置对整个网卡生效，返回的restore恢复启用前的设置；驱动不支持SIOCGHWTSTAMP读取原来的设置时restore不做任何事
+func enableHardwareTimestamps(iface string) (restore func(), err error) {
+	if len(iface) >= syscall.IFNAMSIZ {
+		return nil, fmt.Errorf("无效的网卡名称 %q", iface)
+	}
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("启用网卡 %s 的硬件时间戳失败: %v", iface, err)
+	}
+	defer syscall.Close(fd)
+
+	var old hwtstampConfig
+	saved := hwtstampIoctl(fd, iface, siocGHWTStamp, &old) == 0
+
+	for _, filter := range []int32{hwtstampFilterAll, hwtstampFilterNTPAll} {
+		cfg := hwtstampConfig{txType: hwtstampTxOn, rxFilter: filter}
+		errno := hwtstampIoctl(fd, iface, siocSHWTStamp, &cfg)
+		if errno == 0 {
+			if !saved || old == cfg {
+				return func() {}, nil
+			}
+			return func() { restoreHardwareTimestamps(iface, old) }, nil
+		}
+		err = errno
+		if errno != syscall.ERANGE && errno != syscall.EINVAL {
+			break
+		}
+	}
+	if errors.Is(err, syscall.EPERM) {
+		return nil, fmt.Errorf("启用网卡 %s 的硬件时间戳失败，需要CAP_NET_ADMIN权限: %v", iface, err)
+	}
+	return nil, fmt.Errorf("网卡 %s 不支持硬件时间戳: %v", iface, err)
+}
+
+// restoreHardwareTimestamps 把网卡的硬件时间戳设置恢复为cfg，失败时保持当前设置
+func restoreHardwareTimestamps(iface string, cfg hwtstampConfig) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return
+	}
+	defer syscall.Close(fd)
+
+	hwtstampIoctl(fd, iface, siocSHWTStamp, &cfg)
+}
+
+// hwtstampIoctl 对网卡iface执行SIOCSHWTSTAMP或SIOCGHWTSTAMP，
+// SIOCGHWTSTAMP把网卡当前的设置读入cfg
+func hwtstampIoctl(fd int, iface string, req uintptr, cfg *hwtstampConfig) syscall.Errno {
+	var ifr ifreqData
+	copy(ifr.name[:], iface)
+	ifr.data = uintptr(unsafe.Pointer(cfg))
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(&ifr)))
+	runtime.KeepAlive(cfg)
+	return errno
+}
+
+// setTimestamping 为套接字设置SO_TIMESTAMPING
+func setTimestamping(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TIMESTAMPING, timestampingFlags)
+}
+
+// parseHardwareTimestamp 从控制消息中解析SCM_TIMESTAMPING的网卡硬件时间戳，即第三个时间戳，没有时返回零值
+func parseHardwareTimestamp(oob []byte) time.Time {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}
+	}
+	for _, m := range msgs {
+		if m.Header.Level == syscall.SOL_SOCKET && m.Header.Type == syscall.SO_TIMESTAMPING {
+			ts, _ := decodeTimespec(m.Data, 2)
+			return ts
+		}
+	}
+	return time.Time{}
+}
+
+// readTxTimestamps 从套接字的错误队列中读取已经就绪的全部发送时间戳，
+// 对每个时间戳调用fn，id是内核按发送顺序分配的编号。
+// 软件和硬件发送时间戳是同一编号的两条消息，每次只有一个非零
+func readTxTimestamps(conn *net.UDPConn, fn func(id uint32, software, hardware time.Time)) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return
+	}
+	var buf [1]byte
+	oob := make([]byte, hardwareTimestampSpace)
+	_ = raw.Control(func(fd uintptr) {
+		for {
+			_, oobRead, _, _, err := syscall.Recvmsg(int(fd), buf[:], oob, syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+			if err != nil {
+				return
+			}
+			msgs, err := syscall.ParseSocketControlMessage(oob[:oobRead])
+			if err != nil {
+				continue
+			}
+			var software, hardware time.Time
+			var id uint32
+			var ok bool
+			for _, m := range msgs {
+				switch {
+				case m.Header.Level == syscall.SOL_SOCKET && m.Header.Type == syscall.SO_TIMESTAMPING:
+					software, _ = decodeTimespec(m.Data, 0)
+					hardware, _ = decodeTimespec(m.Data, 2)
+				case (m.Header.Level == syscall.SOL_IP && m.Header.Type == syscall.IP_RECVERR) ||
+					(m.Header.Level == syscall.SOL_IPV6 && m.Header.Type == syscall.IPV6_RECVERR):
+					// struct sock_extended_err的ee_origin在第4字节，ee_data在第12字节
+					if len(m.Data) >= 16 && m.Data[4] == soEEOriginTimestamping {
+						id, ok = binary.NativeEndian.Uint32(m.Data[12:]), true
+					}
+				}
+			}
+			if ok {
+				fn(id, software, hardware)
+			}
+		}
+	})
+}
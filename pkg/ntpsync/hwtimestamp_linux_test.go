@@ -0,0 +1,97 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestHardwareTimestampsOptions 测试硬件时间戳的设置检查
+func TestHardwareTimestampsOptions(t *testing.T) {
+	cases := []Options{
+		{Servers: []string{"127.0.0.1"}, HardwareTimestamps: true},
+		{Servers: []string{"127.0.0.1"}, HardwareTimestamps: true, Interface: "lo", Clock: newFakeClock()},
+		{Servers: []string{"127.0.0.1"}, HardwareTimestamps: true, Dialer: ntptest.NewNetwork()},
+		// 回环网卡没有硬件时间戳
+		{Servers: []string{"127.0.0.1"}, HardwareTimestamps: true, Interface: "lo"},
+	}
+	for i, opts := range cases {
+		if ntp, err := New(opts); err == nil {
+			ntp.Close()
+			t.Errorf("第%d个设置: 预期返回错误，实际得到nil", i+1)
+		}
+	}
+}
+
+// TestTimestampingSocket 测试启用SO_TIMESTAMPING的套接字读取内核的发送和接收时间戳，
+// 回环网卡上只有软件时间戳
+func TestTimestampingSocket(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+
+	ntp, err := New(Options{Servers: []string{srv.Addr()}, MinPollInterval: -1})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	ntp.socketConfig.hardwareTimestamps = true
+
+	ex, err := ntp.openExchange(ntp.context(), srv.Addr(), time.Second, time.Second)
+	if err != nil {
+		t.Fatalf("准备交换失败: %v", err)
+	}
+	defer ex.close()
+	if !ntp.socket.hardwareTimestamps || ntp.socket.kernelTimestamps {
+		t.Fatal("预期套接字启用了SO_TIMESTAMPING")
+	}
+
+	for i := 0; i < 3; i++ {
+		req, sent, err := ntp.newRequest(srv.Addr(), Version4, true, false, nil)
+		if err != nil {
+			t.Fatalf("创建请求失败: %v", err)
+		}
+		if err := ex.send(req); err != nil {
+			t.Fatalf("发送请求失败: %v", err)
+		}
+		putPacket(req)
+		resp, received, err := ex.receive()
+		if err != nil {
+			t.Fatalf("接收应答失败: %v", err)
+		}
+		putPacket(resp)
+
+		kernel, hardware := ex.timestamps()
+		if kernel.Before(sent.t1) || kernel.After(received) || hardware {
+			t.Errorf("第%d次交换: 预期内核发送时间在%v和%v之间且没有硬件时间戳，实际为%v, %v",
+				i+1, sent.t1, received, kernel, hardware)
+		}
+	}
+	if len(ntp.socket.txStamps) != 0 {
+		t.Errorf("预期发送时间戳都已取走，实际剩余%d个", len(ntp.socket.txStamps))
+	}
+}
+
+// TestHardwareReceiveTime 测试按硬件时间戳之差计算接收时间
+func TestHardwareReceiveTime(t *testing.T) {
+	sent := time.Now()
+	received := sent.Add(300 * time.Microsecond)
+	// 网卡时钟与系统时钟相差很大，只有两个硬件时间戳之差有意义
+	tx := txTimestamps{software: sent, hardware: time.Unix(1000, 0)}
+	got, ok := hardwareReceiveTime(received, tx, time.Unix(1000, 0).Add(120*time.Microsecond))
+	if !ok || !got.Equal(sent.Add(120*time.Microsecond)) {
+		t.Errorf("预期接收时间为发送后120µs，实际得到%v, %v", got.Sub(sent), ok)
+	}
+	if received.Sub(got) != 180*time.Microsecond {
+		t.Errorf("预期保留单调时钟读数，实际相差%v", received.Sub(got))
+	}
+
+	if _, ok := hardwareReceiveTime(received, txTimestamps{software: sent}, time.Unix(1000, 0)); ok {
+		t.Error("预期没有硬件发送时间戳时返回false")
+	}
+	if _, ok := hardwareReceiveTime(received, tx, time.Unix(1000, 0).Add(time.Millisecond)); ok {
+		t.Error("预期接收时间晚于读取时间时返回false")
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package ntpsync
+
+import (
+	"net"
+	"time"
+)
+
+// hardwareTimestampSpace 是接收控制消息的缓冲区大小，不支持硬件时间戳时不需要
+const hardwareTimestampSpace = 0
+
+// enableHardwareTimestamps 在不支持硬件时间戳的平台上总是返回ErrHardwareTimestampsUnsupported
+func enableHardwareTimestamps(iface string) (restore func(), err error) {
+	return nil, ErrHardwareTimestampsUnsupported
+}
+
+// setTimestamping 在不支持SO_TIMESTAMPING的平台上总是返回ErrHardwareTimestampsUnsupported
+func setTimestamping(fd uintptr) error {
+	return ErrHardwareTimestampsUnsupported
+}
+
+// parseHardwareTimestamp 在不支持硬件时间戳的平台上总是返回零值
+func parseHardwareTimestamp(oob []byte) time.Time {
+	return time.Time{}
+}
+
+// readTxTimestamps 在不支持发送时间戳的平台上不读取任何时间戳
+func readTxTimestamps(conn *net.UDPConn, fn func(id uint32, software, hardware time.Time)) {}
@@ -0,0 +1,70 @@
+package ntpsync
+
+import (
+	"errors"
+	"time"
+)
+
+// 快速初始同步的参数
+const (
+	// BurstCount 是快速初始同步发送的请求次数
+	BurstCount = 6
+
+	// BurstInterval 是快速初始同步中相邻请求的间隔
+	BurstInterval = 2 * time.Second
+)
+
+// initialBurst 执行快速初始同步
+// 以BurstInterval为间隔连续测量BurstCount次，每当得到往返时间更小的结果时立即应用，
+// 使本地时间尽快可用并收敛到最可靠的测量值。整个突发计为一次同步尝试。
+// 返回突发是否完成，以及没有任何成功结果时的最后一个错误，收到停止信号时返回false。
+func (n *NTPSync) initialBurst() (bool, error) {
+	var best *SyncResult
+	var lastErr error
+
+	stopped := false
+	for i := 0; i < BurstCount; i++ {
+		if i > 0 {
+			timer := n.clock.NewTimer(BurstInterval)
+			select {
+			case <-timer.C():
+			case <-n.stopChan:
+				stopTimer(timer)
+				stopped = true
+			}
+			if stopped {
+				break
+			}
+		}
+
+		servers, timeout, err := n.syncTargets()
+		var result *SyncResult
+		if err == nil {
+			result, err = n.measureServers(servers, timeout)
+		}
+		if err != nil {
+			lastErr = err
+			if errors.Is(err, ErrClosed) {
+				stopped = true
+				break
+			}
+			continue
+		}
+
+		if best == nil || result.RTT < best.RTT {
+			if err := n.applyResult(result); err == nil {
+				best = result
+			}
+		}
+	}
+
+	if best != nil {
+		lastErr = nil
+		n.recordSyncResult(nil)
+	} else if lastErr != nil {
+		n.syncFailed(lastErr)
+		n.recordSyncResult(lastErr)
+	}
+
+	return !stopped, lastErr
+}
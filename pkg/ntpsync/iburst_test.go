@@ -0,0 +1,76 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestInitialBurst 测试启动定时同步时的快速初始同步
+func TestInitialBurst(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(2 * time.Second)
+
+	ntp, err := New(Options{
+		Servers:      []string{srv.Addr()},
+		Timeout:      time.Second,
+		SyncInterval: time.Hour,
+		IBurst:       true,
+		Clock:        clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	events, cancel := ntp.Subscribe(BurstCount)
+	defer cancel()
+
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+
+	// 第一个请求立即发送，之后每隔BurstInterval发送一次
+	for i := 1; i < BurstCount; i++ {
+		clock.waitForTimers(t, 1)
+		if got := srv.RequestCount(); got != i {
+			t.Fatalf("预期已发送%d个请求，实际得到%d个", i, got)
+		}
+		clock.Advance(BurstInterval)
+	}
+
+	// 突发结束后只剩下同步间隔的定时器
+	clock.waitForTimers(t, 1)
+	if got := srv.RequestCount(); got != BurstCount {
+		t.Errorf("预期突发发送%d个请求，实际得到%d个", BurstCount, got)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != EventSyncSucceeded {
+			t.Errorf("预期同步成功事件，实际得到%s", event.Type)
+		}
+	default:
+		t.Error("预期突发期间应用了同步结果")
+	}
+
+	if diff := ntp.TimeOffsetDuration() - 2*time.Second; diff < -time.Millisecond || diff > time.Millisecond {
+		t.Errorf("预期时间偏移量约为2秒，实际得到%v", ntp.TimeOffsetDuration())
+	}
+
+	status := ntp.GetPeriodicSyncStatus()
+	if status.SuccessCount != 1 || status.ErrorCount != 0 {
+		t.Errorf("预期突发计为1次成功同步，实际成功%d次、失败%d次", status.SuccessCount, status.ErrorCount)
+	}
+
+	// 下一次同步按同步间隔执行
+	clock.Advance(BurstInterval)
+	if got := srv.RequestCount(); got != BurstCount {
+		t.Errorf("预期突发结束后不再快速发送请求，实际得到%d个", got)
+	}
+}
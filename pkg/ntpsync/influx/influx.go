@@ -0,0 +1,310 @@
+// Package influx 以InfluxDB行协议导出同步指标，供已经统一使用Influx或Telegraf的设备群使用。
+//
+// Exporter每个Interval和每次同步完成后写入一批数据：一行整体状态（偏移量、同步时效、
+// 保持模式和误差上限），以及每个服务器一行测量（偏移量、往返时间、抖动、可达性和层级）。
+// 数据可以写入io.Writer，也可以发送到InfluxDB的HTTP写入接口或Telegraf的UDP监听端口：
+//
+//	exp, err := influx.New(ntp, influx.Options{
+//	    URL:   "http://influxdb:8086/api/v2/write?org=iot&bucket=clock&precision=ns",
+//	    Token: "secret",
+//	    Tags:  map[string]string{"device": "gw-001"},
+//	})
+//	go exp.Run(ctx)
+package influx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// 默认配置
+const (
+	DefaultInterval    = time.Minute
+	DefaultTimeout     = 10 * time.Second
+	DefaultMeasurement = "ntpsync"
+)
+
+// Options 包含Exporter的配置选项，URL和Writer必须设置其中一个
+type Options struct {
+	// URL 是写入数据的地址：http://或https://表示InfluxDB的写入接口（v1的/write或v2的/api/v2/write，
+	// 查询参数中需要指定数据库或bucket，时间精度必须为纳秒），udp://表示Telegraf等的UDP监听端口
+	URL string
+
+	// Writer 是写入数据的目标，设置后忽略URL
+	Writer io.Writer
+
+	// Token 是InfluxDB v2的API令牌，以"Authorization: Token ..."发送
+	Token string
+
+	// Measurement 是整体状态的测量名称，服务器的测量名称为Measurement+"_server"，
+	// 为空时使用DefaultMeasurement
+	Measurement string
+
+	// Tags 是添加到每一行的标签，为空时添加host标签，值为主机名
+	Tags map[string]string
+
+	// Interval 是定时写入的间隔
+	Interval time.Duration
+
+	// MaxAge 是认为同步仍然有效的最长时间，零值表示使用两倍的同步间隔
+	MaxAge time.Duration
+
+	// Timeout 是一次写入的超时时间
+	Timeout time.Duration
+
+	// OnError 接收写入过程中的错误，可以为nil
+	OnError func(error)
+}
+
+// Exporter 以InfluxDB行协议导出同步指标
+type Exporter struct {
+	ntp    *ntpsync.NTPSync
+	opts   Options
+	tags   string
+	client *http.Client
+}
+
+// New 创建一个导出同步指标的Exporter，调用Run开始定时写入
+func New(n *ntpsync.NTPSync, opts Options) (*Exporter, error) {
+	if n == nil {
+		return nil, errors.New("必须提供NTPSync实例")
+	}
+	if opts.Writer == nil {
+		if opts.URL == "" {
+			return nil, errors.New("必须提供URL或Writer")
+		}
+		u, err := url.Parse(opts.URL)
+		if err != nil {
+			return nil, fmt.Errorf("无效的写入地址: %v", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "udp":
+		default:
+			return nil, fmt.Errorf("不支持的写入地址协议: %s", u.Scheme)
+		}
+	}
+
+	if opts.Measurement == "" {
+		opts.Measurement = DefaultMeasurement
+	}
+	if len(opts.Tags) == 0 {
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "unknown"
+		}
+		opts.Tags = map[string]string{"host": host}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	return &Exporter{
+		ntp:    n,
+		opts:   opts,
+		tags:   formatTags(opts.Tags),
+		client: &http.Client{Timeout: opts.Timeout},
+	}, nil
+}
+
+// Lines 以行协议返回当前的同步指标，每行以换行符结尾
+func (e *Exporter) Lines() []byte {
+	now := e.ntp.Now()
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+	holdover := e.ntp.GetHoldoverStatus()
+
+	var b bytes.Buffer
+
+	// 整体状态
+	b.WriteString(escapeName(e.opts.Measurement))
+	b.WriteString(e.tags)
+	fields := []string{
+		"offset_ms=" + formatMilliseconds(e.ntp.TimeOffsetDuration()),
+		"synchronized=" + strconv.FormatBool(e.ntp.IsSynchronized(e.opts.MaxAge)),
+		"holdover=" + strconv.FormatBool(holdover.Holdover),
+		"max_error_ms=" + formatMilliseconds(holdover.MaxError),
+	}
+	if age := e.ntp.LastSyncAge(); age != ntpsync.NeverSynced {
+		fields = append(fields, "last_sync_age_s="+strconv.FormatFloat(age.Seconds(), 'f', -1, 64))
+	}
+	b.WriteByte(' ')
+	b.WriteString(strings.Join(fields, ","))
+	b.WriteByte(' ')
+	b.WriteString(ts)
+	b.WriteByte('\n')
+
+	// 每个服务器的测量，尚未测量的服务器只写入可达性
+	for _, peer := range e.ntp.GetPeers() {
+		b.WriteString(escapeName(e.opts.Measurement + "_server"))
+		b.WriteString(e.tags)
+		b.WriteString(",server=")
+		b.WriteString(escapeTag(peer.Address))
+		fmt.Fprintf(&b, " reach=%di,selection=%s", peer.Reach, quoteField(string(peer.Selection)))
+		if peer.Stratum != 0 {
+			fmt.Fprintf(&b, ",stratum=%di,offset_ms=%s,rtt_ms=%s,jitter_ms=%s",
+				peer.Stratum, formatMilliseconds(peer.Offset), formatMilliseconds(peer.Delay), formatMilliseconds(peer.Jitter))
+		}
+		b.WriteByte(' ')
+		b.WriteString(ts)
+		b.WriteByte('\n')
+	}
+
+	return b.Bytes()
+}
+
+// Export 写入一次当前的同步指标
+func (e *Exporter) Export(ctx context.Context) error {
+	lines := e.Lines()
+	if e.opts.Writer != nil {
+		if _, err := e.opts.Writer.Write(lines); err != nil {
+			return fmt.Errorf("写入同步指标失败: %v", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.opts.Timeout)
+	defer cancel()
+
+	if strings.HasPrefix(e.opts.URL, "udp://") {
+		return e.sendUDP(ctx, lines)
+	}
+	return e.post(ctx, lines)
+}
+
+// post 将数据发送到InfluxDB的HTTP写入接口
+func (e *Exporter) post(ctx context.Context, lines []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.URL, bytes.NewReader(lines))
+	if err != nil {
+		return fmt.Errorf("创建写入请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+e.opts.Token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送同步指标失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("写入同步指标失败: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sendUDP 将每一行作为一个UDP数据报发送，避免超过数据报的长度限制
+func (e *Exporter) sendUDP(ctx context.Context, lines []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", strings.TrimPrefix(e.opts.URL, "udp://"))
+	if err != nil {
+		return fmt.Errorf("连接 %s 失败: %v", e.opts.URL, err)
+	}
+	defer conn.Close()
+
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if _, err := conn.Write(line); err != nil {
+			return fmt.Errorf("发送同步指标失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// Run 持续写入同步指标，直到ctx被取消
+// 每个Interval和每次同步完成后写入一次，错误交给OnError，返回ctx.Err()
+func (e *Exporter) Run(ctx context.Context) error {
+	events, unsubscribe := e.ntp.Subscribe(0)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		e.report(e.Export(ctx))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-events:
+			if ev.Type != ntpsync.EventSyncSucceeded && ev.Type != ntpsync.EventSyncFailed {
+				continue
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// report 将错误交给OnError
+func (e *Exporter) report(err error) {
+	if err != nil && e.opts.OnError != nil {
+		e.opts.OnError(err)
+	}
+}
+
+// formatTags 按键排序编码标签，InfluxDB推荐标签按键排序
+func formatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		if tags[k] == "" {
+			// 行协议不允许空的标签值
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(escapeTag(k))
+		b.WriteByte('=')
+		b.WriteString(escapeTag(tags[k]))
+	}
+	return b.String()
+}
+
+// formatMilliseconds 将时长格式化为以毫秒为单位的浮点数
+func formatMilliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+}
+
+var (
+	nameEscaper  = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper   = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	fieldEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// escapeName 转义测量名称中的逗号和空格
+func escapeName(s string) string {
+	return nameEscaper.Replace(s)
+}
+
+// escapeTag 转义标签键和值中的逗号、等号和空格
+func escapeTag(s string) string {
+	return tagEscaper.Replace(s)
+}
+
+// quoteField 将字符串编码为带引号的字段值
+func quoteField(s string) string {
+	return `"` + fieldEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,196 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntpsynctest"
+)
+
+// TestEscape 测试行协议的转义规则
+func TestEscape(t *testing.T) {
+	if got := escapeName("ntp sync,a=b"); got != `ntp\ sync\,a=b` {
+		t.Errorf("测量名称转义错误: %s", got)
+	}
+	if got := escapeTag("a b,c=d"); got != `a\ b\,c\=d` {
+		t.Errorf("标签转义错误: %s", got)
+	}
+	if got := quoteField(`say "hi" \`); got != `"say \"hi\" \\"` {
+		t.Errorf("字段值转义错误: %s", got)
+	}
+	if got := formatTags(map[string]string{"site": "north", "device": "gw 1", "empty": ""}); got != `,device=gw\ 1,site=north` {
+		t.Errorf("标签编码错误: %s", got)
+	}
+}
+
+// TestLines 测试整体状态和服务器测量的行
+func TestLines(t *testing.T) {
+	ntp, ntpSrv := ntpsynctest.NewSyncedClient(t)
+
+	var buf bytes.Buffer
+	exp, err := New(ntp, Options{Writer: &buf, Tags: map[string]string{"device": "gw-001"}})
+	if err != nil {
+		t.Fatalf("创建Exporter失败: %v", err)
+	}
+	if err := exp.Export(context.Background()); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("预期2行，实际得到%d行: %q", len(lines), buf.String())
+	}
+
+	system := strings.Fields(lines[0])
+	if len(system) != 3 || system[0] != "ntpsync,device=gw-001" {
+		t.Fatalf("整体状态行格式错误: %s", lines[0])
+	}
+	for _, field := range []string{"offset_ms=", "synchronized=true", "holdover=false", "max_error_ms=", "last_sync_age_s="} {
+		if !strings.Contains(system[1], field) {
+			t.Errorf("整体状态行缺少%s: %s", field, lines[0])
+		}
+	}
+
+	server := strings.Fields(lines[1])
+	if len(server) != 3 || server[0] != "ntpsync_server,device=gw-001,server="+ntpSrv.Addr() {
+		t.Fatalf("服务器行格式错误: %s", lines[1])
+	}
+	for _, field := range []string{"reach=", `selection="*"`, "stratum=", "offset_ms=", "rtt_ms=", "jitter_ms="} {
+		if !strings.Contains(server[1], field) {
+			t.Errorf("服务器行缺少%s: %s", field, lines[1])
+		}
+	}
+	if server[2] != system[2] {
+		t.Errorf("同一批数据的时间戳应该相同: %s, %s", system[2], server[2])
+	}
+}
+
+// TestExportHTTP 测试写入InfluxDB的HTTP接口
+func TestExportHTTP(t *testing.T) {
+	ntp, _ := ntpsynctest.NewSyncedClient(t)
+
+	bodies := make(chan string, 4)
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "clock" {
+			t.Errorf("请求错误: %s %s", r.Method, r.URL)
+		}
+		if got := r.Header.Get("Authorization"); got != "Token secret" {
+			t.Errorf("认证头错误: %s", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"message":"bucket not found"}`))
+	}))
+	defer srv.Close()
+
+	exp, err := New(ntp, Options{URL: srv.URL + "/api/v2/write?org=iot&bucket=clock", Token: "secret"})
+	if err != nil {
+		t.Fatalf("创建Exporter失败: %v", err)
+	}
+	if err := exp.Export(context.Background()); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if body := <-bodies; !strings.HasPrefix(body, "ntpsync,host=") {
+		t.Errorf("请求内容错误: %q", body)
+	}
+
+	status = http.StatusNotFound
+	err = exp.Export(context.Background())
+	<-bodies
+	if err == nil || !strings.Contains(err.Error(), "bucket not found") {
+		t.Errorf("预期包含服务器错误信息的错误，实际得到: %v", err)
+	}
+}
+
+// TestExportUDP 测试每行作为一个UDP数据报发送
+func TestExportUDP(t *testing.T) {
+	ntp, _ := ntpsynctest.NewSyncedClient(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听UDP端口失败: %v", err)
+	}
+	defer conn.Close()
+
+	exp, err := New(ntp, Options{URL: "udp://" + conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("创建Exporter失败: %v", err)
+	}
+	if err := exp.Export(context.Background()); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	for _, prefix := range []string{"ntpsync,", "ntpsync_server,"} {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("读取数据报失败: %v", err)
+		}
+		if line := string(buf[:n]); !strings.HasPrefix(line, prefix) || strings.Count(line, "\n") != 1 {
+			t.Errorf("数据报内容错误: %q", line)
+		}
+	}
+}
+
+// TestNewValidation 测试无效的配置
+func TestNewValidation(t *testing.T) {
+	ntp, _ := ntpsynctest.NewSyncedClient(t)
+
+	for _, opts := range []Options{{}, {URL: "ftp://example.com"}, {URL: "http://%zz"}} {
+		if _, err := New(ntp, opts); err == nil {
+			t.Errorf("预期配置%+v返回错误", opts)
+		}
+	}
+	if _, err := New(nil, Options{Writer: io.Discard}); err == nil {
+		t.Error("预期nil实例返回错误")
+	}
+}
+
+// TestRun 测试同步完成后写入
+func TestRun(t *testing.T) {
+	ntp, _ := ntpsynctest.NewSyncedClient(t)
+
+	lines := make(chan string, 16)
+	exp, err := New(ntp, Options{Writer: writerFunc(func(p []byte) { lines <- string(p) }), Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("创建Exporter失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- exp.Run(ctx) }()
+
+	<-lines
+	time.Sleep(10 * time.Millisecond)
+	if err := ntp.ForceSyncNow(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	select {
+	case <-lines:
+	case <-time.After(2 * time.Second):
+		t.Fatal("同步后没有写入数据")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("预期context.Canceled，实际得到: %v", err)
+	}
+}
+
+// writerFunc 将每次写入交给函数处理
+type writerFunc func([]byte)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	f(append([]byte(nil), p...))
+	return len(p), nil
+}
@@ -0,0 +1,78 @@
+package ntpsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// interleavedState 是与服务器上一次交换的时间戳，用于交错模式
+//
+// 交错模式下，客户端在请求中带上上一次应答的服务器接收时间戳（起始时间戳字段）
+// 和客户端接收时间戳（接收时间戳字段）。支持交错模式的服务器据此认出客户端，
+// 在应答中以起始时间戳字段回传客户端的接收时间戳，
+// 并以发送时间戳字段给出上一次应答实际发出的时间。
+// 这个时间在应答发出之后才获得，不含服务器发送路径的延迟，比普通模式更准确。
+type interleavedState struct {
+	// t1 是上一次请求的本地发送时间
+	t1 time.Time
+
+	// serverRx 是上一次应答中的服务器接收时间戳
+	serverRx uint64
+
+	// t4 是上一次应答的本地接收时间
+	t4 time.Time
+
+	// localRx 是t4的NTP时间戳格式
+	localRx uint64
+}
+
+// errOriginMismatch 表示应答的起始时间戳与请求不符，可能是伪造或过期的应答
+var errOriginMismatch = errors.New("应答的起始时间戳与请求不符")
+
+// interleavedRequest 在请求中写入交错模式所需的时间戳，返回写入的接收时间戳
+// 没有与该服务器的上一次交换时不写入，返回0
+func (n *NTPSync) interleavedRequest(server string, req []byte) uint64 {
+	n.mutex.RLock()
+	prev, ok := n.interleavedStates[server]
+	n.mutex.RUnlock()
+
+	if !ok {
+		return 0
+	}
+	binary.BigEndian.PutUint64(req[24:32], prev.serverRx)
+	binary.BigEndian.PutUint64(req[32:40], prev.localRx)
+	return prev.localRx
+}
+
+// interleavedResponse 识别应答的模式并保存本次交换的时间戳
+// 交错应答返回上一次交换的t1、t2和t4，与应答中的t3组成完整的测量；
+// 普通应答原样返回本次交换的时间戳
+func (n *NTPSync) interleavedResponse(server string, resp []byte, sentTx, sentRx uint64, t1, t2, t4 time.Time) (time.Time, time.Time, time.Time, bool, error) {
+	origin := binary.BigEndian.Uint64(resp[24:32])
+	current := interleavedState{
+		t1:       t1,
+		serverRx: binary.BigEndian.Uint64(resp[32:40]),
+		t4:       t4,
+	}
+	seconds, fraction := timeToNTPTime(t4)
+	current.localRx = uint64(seconds)<<32 | uint64(fraction)
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	prev, hasPrev := n.interleavedStates[server]
+	switch {
+	case sentRx != 0 && origin == sentRx && hasPrev:
+		n.interleavedStates[server] = current
+		return prev.t1, ntpTimeToTime(uint32(prev.serverRx>>32), uint32(prev.serverRx), prev.t1), prev.t4, true, nil
+	case origin == sentTx:
+		if n.interleavedStates == nil {
+			n.interleavedStates = make(map[string]interleavedState)
+		}
+		n.interleavedStates[server] = current
+		return t1, t2, t4, false, nil
+	default:
+		return t1, t2, t4, false, errOriginMismatch
+	}
+}
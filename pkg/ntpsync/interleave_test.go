@@ -0,0 +1,78 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestInterleaved 测试交错模式消除服务器发送路径延迟带来的偏差
+func TestInterleaved(t *testing.T) {
+	const latency = 40 * time.Millisecond
+
+	for _, supported := range []bool{false, true} {
+		srv := ntptest.NewServer()
+		defer srv.Close()
+		srv.SetOffset(time.Second)
+		srv.SetTransmitLatency(latency)
+		srv.SetInterleaved(supported)
+
+		ntp, err := New(Options{
+			Servers:          []string{srv.Addr()},
+			Timeout:          time.Second,
+			MinPollInterval:  -1,
+			OutlierThreshold: -1,
+			Interleaved:      true,
+		})
+		if err != nil {
+			t.Fatalf("创建NTPSync实例失败: %v", err)
+		}
+		defer ntp.Close()
+
+		for i := 0; i < 3; i++ {
+			if err := ntp.Sync(); err != nil {
+				t.Fatalf("支持交错模式=%v: 第%d次同步失败: %v", supported, i+1, err)
+			}
+		}
+
+		// 普通模式下发送时间戳早于实际发送latency，偏移量约偏小latency/2
+		result := ntp.GetHistory(1)[0]
+		want := time.Second
+		if !supported {
+			want -= latency / 2
+		}
+		if diff := result.Offset - want; diff < -10*time.Millisecond || diff > 10*time.Millisecond {
+			t.Errorf("支持交错模式=%v: 预期偏移量约为%v，实际得到%v", supported, want, result.Offset)
+		}
+		if result.Interleaved != supported {
+			t.Errorf("支持交错模式=%v: 结果的Interleaved为%v", supported, result.Interleaved)
+		}
+	}
+}
+
+// TestInterleavedDisabled 测试默认不在请求中带上时间戳
+func TestInterleavedDisabled(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetInterleaved(true)
+
+	ntp, err := New(Options{Servers: []string{srv.Addr()}, Timeout: time.Second, MinPollInterval: -1})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+	}
+	for _, req := range srv.Requests() {
+		for _, b := range req.Data[24:40] {
+			if b != 0 {
+				t.Fatalf("预期请求的起始和接收时间戳为零，实际得到%x", req.Data[24:40])
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ntpsync
+
+import (
+	"math"
+	"time"
+)
+
+// JitterWindow 是计算抖动时使用的最近样本数量
+const JitterWindow = 8
+
+// offsetWindow 按时间顺序保存最近JitterWindow个偏移量样本
+type offsetWindow struct {
+	samples [JitterWindow]time.Duration
+	count   int
+	next    int
+}
+
+// add 添加一个样本，窗口已满时覆盖最旧的样本
+func (w *offsetWindow) add(offset time.Duration) {
+	w.samples[w.next] = offset
+	w.next = (w.next + 1) % JitterWindow
+	if w.count < JitterWindow {
+		w.count++
+	}
+}
+
+// jitter 返回窗口内相邻样本之差的均方根，样本少于两个时返回0
+func (w *offsetWindow) jitter() time.Duration {
+	if w.count < 2 {
+		return 0
+	}
+
+	start := (w.next - w.count + JitterWindow) % JitterWindow
+	var sum float64
+	prev := w.samples[start]
+	for i := 1; i < w.count; i++ {
+		cur := w.samples[(start+i)%JitterWindow]
+		diff := float64(cur - prev)
+		sum += diff * diff
+		prev = cur
+	}
+
+	return time.Duration(math.Sqrt(sum / float64(w.count-1)))
+}
+
+// values 按时间顺序返回窗口内的样本
+func (w *offsetWindow) values() []time.Duration {
+	values := make([]time.Duration, w.count)
+	start := (w.next - w.count + JitterWindow) % JitterWindow
+	for i := range values {
+		values[i] = w.samples[(start+i)%JitterWindow]
+	}
+	return values
+}
+
+// serverJitter 返回服务器最近测量的抖动
+func (n *NTPSync) serverJitter(server string) time.Duration {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	if w, ok := n.serverOffsets[serverAddress(server)]; ok {
+		return w.jitter()
+	}
+	return 0
+}
+
+// Jitter 返回最近应用的偏移量的整体抖动
+func (n *NTPSync) Jitter() time.Duration {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	return n.systemOffsets.jitter()
+}
@@ -0,0 +1,77 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestOffsetWindowJitter 测试抖动的计算
+func TestOffsetWindowJitter(t *testing.T) {
+	var w offsetWindow
+
+	if got := w.jitter(); got != 0 {
+		t.Errorf("预期没有样本时抖动为0，实际得到%v", got)
+	}
+
+	w.add(10 * time.Millisecond)
+	if got := w.jitter(); got != 0 {
+		t.Errorf("预期只有一个样本时抖动为0，实际得到%v", got)
+	}
+
+	// 相邻差值为+3ms、-3ms、+3ms，均方根为3ms
+	w.add(13 * time.Millisecond)
+	w.add(10 * time.Millisecond)
+	w.add(13 * time.Millisecond)
+	if got := w.jitter(); got != 3*time.Millisecond {
+		t.Errorf("预期抖动为3ms，实际得到%v", got)
+	}
+
+	// 窗口满后旧样本被覆盖，恒定的偏移量没有抖动
+	for i := 0; i < JitterWindow; i++ {
+		w.add(50 * time.Millisecond)
+	}
+	if got := w.jitter(); got != 0 {
+		t.Errorf("预期恒定偏移量的抖动为0，实际得到%v", got)
+	}
+}
+
+// TestJitterExposed 测试抖动出现在服务器状态和定时同步状态中
+func TestJitterExposed(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: time.Second,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	for _, offset := range []time.Duration{0, 4 * time.Millisecond, 0, 4 * time.Millisecond} {
+		srv.SetOffset(offset)
+		clock.Advance(DefaultMinPollInterval)
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+	}
+
+	if got := ntp.GetPeriodicSyncStatus().Jitter; got < 3*time.Millisecond || got > 5*time.Millisecond {
+		t.Errorf("预期整体抖动约为4ms，实际得到%v", got)
+	}
+
+	clock.Advance(DefaultMinPollInterval)
+	statuses, err := ntp.GetStatus()
+	if err != nil {
+		t.Fatalf("获取服务器状态失败: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Jitter <= 0 {
+		t.Errorf("预期服务器状态包含抖动，实际得到%+v", statuses)
+	}
+}
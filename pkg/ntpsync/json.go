@@ -0,0 +1,712 @@
+package ntpsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// jsonDuration 以易读的字符串形式（如"12.5ms"）序列化time.Duration
+type jsonDuration time.Duration
+
+// MarshalJSON 将时长编码为time.Duration.String()的格式
+func (d jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON 解析字符串形式的时长，同时兼容纳秒整数
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var ns int64
+		if err := json.Unmarshal(data, &ns); err != nil {
+			return fmt.Errorf("无效的时长: %s", data)
+		}
+		*d = jsonDuration(ns)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("无效的时长 %q: %v", s, err)
+	}
+	*d = jsonDuration(parsed)
+	return nil
+}
+
+// jsonTime 以RFC 3339格式序列化time.Time，零值编码为null
+type jsonTime time.Time
+
+// MarshalJSON 将时间编码为RFC 3339字符串
+func (t jsonTime) MarshalJSON() ([]byte, error) {
+	tm := time.Time(t)
+	if tm.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(tm.Format(time.RFC3339Nano))
+}
+
+// UnmarshalJSON 解析RFC 3339字符串，null解析为零值
+func (t *jsonTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*t = jsonTime(time.Time{})
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("无效的时间: %s", data)
+	}
+
+	parsed, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return fmt.Errorf("无效的时间 %q: %v", s, err)
+	}
+	*t = jsonTime(parsed)
+	return nil
+}
+
+// errorString 返回错误的文本，nil返回空字符串
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// stringError 将文本还原为错误，空字符串返回nil
+func stringError(s string) error {
+	if s == "" {
+		return nil
+	}
+	return errors.New(s)
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串，错误编码为文本
+func (r SyncResult) MarshalJSON() ([]byte, error) {
+	type alias SyncResult
+	return json.Marshal(struct {
+		alias
+		Time           jsonTime     `json:"time"`
+		Offset         jsonDuration `json:"offset"`
+		RTT            jsonDuration `json:"rtt"`
+		Uncertainty    jsonDuration `json:"uncertainty,omitempty"`
+		RootDistance   jsonDuration `json:"root_distance,omitempty"`
+		RootDelay      jsonDuration `json:"root_delay,omitempty"`
+		RootDispersion jsonDuration `json:"root_dispersion,omitempty"`
+		Precision      jsonDuration `json:"precision,omitempty"`
+		Poll           jsonDuration `json:"poll,omitempty"`
+		HuffPuff       jsonDuration `json:"huff_puff,omitempty"`
+		Asymmetry      jsonDuration `json:"asymmetry,omitempty"`
+		Error          string       `json:"error,omitempty"`
+	}{
+		alias:          alias(r),
+		Time:           jsonTime(r.Time),
+		Offset:         jsonDuration(r.Offset),
+		RTT:            jsonDuration(r.RTT),
+		Uncertainty:    jsonDuration(r.Uncertainty),
+		RootDistance:   jsonDuration(r.RootDistance),
+		RootDelay:      jsonDuration(r.RootDelay),
+		RootDispersion: jsonDuration(r.RootDispersion),
+		Precision:      jsonDuration(r.Precision),
+		Poll:           jsonDuration(r.Poll),
+		HuffPuff:       jsonDuration(r.HuffPuff),
+		Asymmetry:      jsonDuration(r.Asymmetry),
+		Error:          errorString(r.Error),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (r *SyncResult) UnmarshalJSON(data []byte) error {
+	type alias SyncResult
+	aux := struct {
+		*alias
+		Time           jsonTime     `json:"time"`
+		Offset         jsonDuration `json:"offset"`
+		RTT            jsonDuration `json:"rtt"`
+		Uncertainty    jsonDuration `json:"uncertainty,omitempty"`
+		RootDistance   jsonDuration `json:"root_distance,omitempty"`
+		RootDelay      jsonDuration `json:"root_delay,omitempty"`
+		RootDispersion jsonDuration `json:"root_dispersion,omitempty"`
+		Precision      jsonDuration `json:"precision,omitempty"`
+		Poll           jsonDuration `json:"poll,omitempty"`
+		HuffPuff       jsonDuration `json:"huff_puff,omitempty"`
+		Asymmetry      jsonDuration `json:"asymmetry,omitempty"`
+		Error          string       `json:"error,omitempty"`
+	}{alias: (*alias)(r)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	r.Time = time.Time(aux.Time)
+	r.Offset = time.Duration(aux.Offset)
+	r.RTT = time.Duration(aux.RTT)
+	r.Uncertainty = time.Duration(aux.Uncertainty)
+	r.RootDistance = time.Duration(aux.RootDistance)
+	r.RootDelay = time.Duration(aux.RootDelay)
+	r.RootDispersion = time.Duration(aux.RootDispersion)
+	r.Precision = time.Duration(aux.Precision)
+	r.Poll = time.Duration(aux.Poll)
+	r.HuffPuff = time.Duration(aux.HuffPuff)
+	r.Asymmetry = time.Duration(aux.Asymmetry)
+	r.Error = stringError(aux.Error)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串
+func (s ServerStatus) MarshalJSON() ([]byte, error) {
+	type alias ServerStatus
+	return json.Marshal(struct {
+		alias
+		LastResponse   jsonTime     `json:"last_response"`
+		RTT            jsonDuration `json:"rtt"`
+		Offset         jsonDuration `json:"offset"`
+		Jitter         jsonDuration `json:"jitter"`
+		RootDistance   jsonDuration `json:"root_distance"`
+		RootDelay      jsonDuration `json:"root_delay,omitempty"`
+		RootDispersion jsonDuration `json:"root_dispersion,omitempty"`
+		Precision      jsonDuration `json:"precision,omitempty"`
+		Poll           jsonDuration `json:"poll,omitempty"`
+		HeldDownUntil  jsonTime     `json:"held_down_until"`
+	}{
+		alias:          alias(s),
+		LastResponse:   jsonTime(s.LastResponse),
+		RTT:            jsonDuration(s.RTT),
+		Offset:         jsonDuration(s.Offset),
+		Jitter:         jsonDuration(s.Jitter),
+		RootDistance:   jsonDuration(s.RootDistance),
+		RootDelay:      jsonDuration(s.RootDelay),
+		RootDispersion: jsonDuration(s.RootDispersion),
+		Precision:      jsonDuration(s.Precision),
+		Poll:           jsonDuration(s.Poll),
+		HeldDownUntil:  jsonTime(s.HeldDownUntil),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (s *ServerStatus) UnmarshalJSON(data []byte) error {
+	type alias ServerStatus
+	aux := struct {
+		*alias
+		LastResponse   jsonTime     `json:"last_response"`
+		RTT            jsonDuration `json:"rtt"`
+		Offset         jsonDuration `json:"offset"`
+		Jitter         jsonDuration `json:"jitter"`
+		RootDistance   jsonDuration `json:"root_distance"`
+		RootDelay      jsonDuration `json:"root_delay,omitempty"`
+		RootDispersion jsonDuration `json:"root_dispersion,omitempty"`
+		Precision      jsonDuration `json:"precision,omitempty"`
+		Poll           jsonDuration `json:"poll,omitempty"`
+		HeldDownUntil  jsonTime     `json:"held_down_until"`
+	}{alias: (*alias)(s)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	s.LastResponse = time.Time(aux.LastResponse)
+	s.RTT = time.Duration(aux.RTT)
+	s.Offset = time.Duration(aux.Offset)
+	s.Jitter = time.Duration(aux.Jitter)
+	s.RootDistance = time.Duration(aux.RootDistance)
+	s.RootDelay = time.Duration(aux.RootDelay)
+	s.RootDispersion = time.Duration(aux.RootDispersion)
+	s.Precision = time.Duration(aux.Precision)
+	s.Poll = time.Duration(aux.Poll)
+	s.HeldDownUntil = time.Time(aux.HeldDownUntil)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串，错误编码为文本
+func (s PeriodicSyncStatus) MarshalJSON() ([]byte, error) {
+	type alias PeriodicSyncStatus
+	return json.Marshal(struct {
+		alias
+		LastSync  jsonTime     `json:"last_sync"`
+		LastError string       `json:"last_error,omitempty"`
+		Interval  jsonDuration `json:"interval"`
+		Jitter    jsonDuration `json:"jitter"`
+		NextSync  jsonTime     `json:"next_sync"`
+	}{
+		alias:     alias(s),
+		LastSync:  jsonTime(s.LastSync),
+		LastError: errorString(s.LastError),
+		Interval:  jsonDuration(s.Interval),
+		Jitter:    jsonDuration(s.Jitter),
+		NextSync:  jsonTime(s.NextSync),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (s *PeriodicSyncStatus) UnmarshalJSON(data []byte) error {
+	type alias PeriodicSyncStatus
+	aux := struct {
+		*alias
+		LastSync  jsonTime     `json:"last_sync"`
+		LastError string       `json:"last_error,omitempty"`
+		Interval  jsonDuration `json:"interval"`
+		Jitter    jsonDuration `json:"jitter"`
+		NextSync  jsonTime     `json:"next_sync"`
+	}{alias: (*alias)(s)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	s.LastSync = time.Time(aux.LastSync)
+	s.LastError = stringError(aux.LastError)
+	s.Interval = time.Duration(aux.Interval)
+	s.Jitter = time.Duration(aux.Jitter)
+	s.NextSync = time.Time(aux.NextSync)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串，错误编码为文本
+func (e Event) MarshalJSON() ([]byte, error) {
+	type alias Event
+	return json.Marshal(struct {
+		alias
+		Time      jsonTime     `json:"time"`
+		Offset    jsonDuration `json:"offset"`
+		Interval  jsonDuration `json:"interval"`
+		Suspended jsonDuration `json:"suspended"`
+		Error     string       `json:"error,omitempty"`
+	}{
+		alias:     alias(e),
+		Time:      jsonTime(e.Time),
+		Offset:    jsonDuration(e.Offset),
+		Interval:  jsonDuration(e.Interval),
+		Suspended: jsonDuration(e.Suspended),
+		Error:     errorString(e.Error),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (e *Event) UnmarshalJSON(data []byte) error {
+	type alias Event
+	aux := struct {
+		*alias
+		Time      jsonTime     `json:"time"`
+		Offset    jsonDuration `json:"offset"`
+		Interval  jsonDuration `json:"interval"`
+		Suspended jsonDuration `json:"suspended"`
+		Error     string       `json:"error,omitempty"`
+	}{alias: (*alias)(e)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	e.Time = time.Time(aux.Time)
+	e.Offset = time.Duration(aux.Offset)
+	e.Interval = time.Duration(aux.Interval)
+	e.Suspended = time.Duration(aux.Suspended)
+	e.Error = stringError(aux.Error)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串
+func (s HistoryStats) MarshalJSON() ([]byte, error) {
+	type alias HistoryStats
+	return json.Marshal(struct {
+		alias
+		MinOffset    jsonDuration `json:"min_offset"`
+		MaxOffset    jsonDuration `json:"max_offset"`
+		MeanOffset   jsonDuration `json:"mean_offset"`
+		StdDevOffset jsonDuration `json:"stddev_offset"`
+		RTTP50       jsonDuration `json:"rtt_p50"`
+		RTTP90       jsonDuration `json:"rtt_p90"`
+		RTTP99       jsonDuration `json:"rtt_p99"`
+	}{
+		alias:        alias(s),
+		MinOffset:    jsonDuration(s.MinOffset),
+		MaxOffset:    jsonDuration(s.MaxOffset),
+		MeanOffset:   jsonDuration(s.MeanOffset),
+		StdDevOffset: jsonDuration(s.StdDevOffset),
+		RTTP50:       jsonDuration(s.RTTP50),
+		RTTP90:       jsonDuration(s.RTTP90),
+		RTTP99:       jsonDuration(s.RTTP99),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (s *HistoryStats) UnmarshalJSON(data []byte) error {
+	type alias HistoryStats
+	aux := struct {
+		*alias
+		MinOffset    jsonDuration `json:"min_offset"`
+		MaxOffset    jsonDuration `json:"max_offset"`
+		MeanOffset   jsonDuration `json:"mean_offset"`
+		StdDevOffset jsonDuration `json:"stddev_offset"`
+		RTTP50       jsonDuration `json:"rtt_p50"`
+		RTTP90       jsonDuration `json:"rtt_p90"`
+		RTTP99       jsonDuration `json:"rtt_p99"`
+	}{alias: (*alias)(s)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	s.MinOffset = time.Duration(aux.MinOffset)
+	s.MaxOffset = time.Duration(aux.MaxOffset)
+	s.MeanOffset = time.Duration(aux.MeanOffset)
+	s.StdDevOffset = time.Duration(aux.StdDevOffset)
+	s.RTTP50 = time.Duration(aux.RTTP50)
+	s.RTTP90 = time.Duration(aux.RTTP90)
+	s.RTTP99 = time.Duration(aux.RTTP99)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串
+func (s HoldoverStatus) MarshalJSON() ([]byte, error) {
+	type alias HoldoverStatus
+	return json.Marshal(struct {
+		alias
+		Since    jsonTime     `json:"since"`
+		MaxError jsonDuration `json:"max_error"`
+	}{
+		alias:    alias(s),
+		Since:    jsonTime(s.Since),
+		MaxError: jsonDuration(s.MaxError),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (s *HoldoverStatus) UnmarshalJSON(data []byte) error {
+	type alias HoldoverStatus
+	aux := struct {
+		*alias
+		Since    jsonTime     `json:"since"`
+		MaxError jsonDuration `json:"max_error"`
+	}{alias: (*alias)(s)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	s.Since = time.Time(aux.Since)
+	s.MaxError = time.Duration(aux.MaxError)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串
+func (p PeerReport) MarshalJSON() ([]byte, error) {
+	type alias PeerReport
+	return json.Marshal(struct {
+		alias
+		LastPoll     jsonTime     `json:"last_poll"`
+		Offset       jsonDuration `json:"offset"`
+		Delay        jsonDuration `json:"delay"`
+		Jitter       jsonDuration `json:"jitter"`
+		RootDistance jsonDuration `json:"root_distance"`
+	}{
+		alias:        alias(p),
+		LastPoll:     jsonTime(p.LastPoll),
+		Offset:       jsonDuration(p.Offset),
+		Delay:        jsonDuration(p.Delay),
+		Jitter:       jsonDuration(p.Jitter),
+		RootDistance: jsonDuration(p.RootDistance),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (p *PeerReport) UnmarshalJSON(data []byte) error {
+	type alias PeerReport
+	aux := struct {
+		*alias
+		LastPoll     jsonTime     `json:"last_poll"`
+		Offset       jsonDuration `json:"offset"`
+		Delay        jsonDuration `json:"delay"`
+		Jitter       jsonDuration `json:"jitter"`
+		RootDistance jsonDuration `json:"root_distance"`
+	}{alias: (*alias)(p)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	p.LastPoll = time.Time(aux.LastPoll)
+	p.Offset = time.Duration(aux.Offset)
+	p.Delay = time.Duration(aux.Delay)
+	p.Jitter = time.Duration(aux.Jitter)
+	p.RootDistance = time.Duration(aux.RootDistance)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，零值的时间戳编码为null
+func (ts Timestamps) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Originate   jsonTime `json:"originate"`
+		Receive     jsonTime `json:"receive"`
+		Transmit    jsonTime `json:"transmit"`
+		Destination jsonTime `json:"destination"`
+		Reference   jsonTime `json:"reference"`
+	}{
+		Originate:   jsonTime(ts.Originate),
+		Receive:     jsonTime(ts.Receive),
+		Transmit:    jsonTime(ts.Transmit),
+		Destination: jsonTime(ts.Destination),
+		Reference:   jsonTime(ts.Reference),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (ts *Timestamps) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Originate   jsonTime `json:"originate"`
+		Receive     jsonTime `json:"receive"`
+		Transmit    jsonTime `json:"transmit"`
+		Destination jsonTime `json:"destination"`
+		Reference   jsonTime `json:"reference"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	ts.Originate = time.Time(aux.Originate)
+	ts.Receive = time.Time(aux.Receive)
+	ts.Transmit = time.Time(aux.Transmit)
+	ts.Destination = time.Time(aux.Destination)
+	ts.Reference = time.Time(aux.Reference)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长样本编码为易读字符串
+func (s ServerState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Status   ServerStatus   `json:"status"`
+		HeldDown jsonDuration   `json:"held_down,omitempty"`
+		RTTs     []jsonDuration `json:"rtts,omitempty"`
+		Offsets  []jsonDuration `json:"offsets,omitempty"`
+	}{
+		Status:   s.Status,
+		HeldDown: jsonDuration(s.HeldDown),
+		RTTs:     jsonDurations(s.RTTs),
+		Offsets:  jsonDurations(s.Offsets),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (s *ServerState) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Status   ServerStatus   `json:"status"`
+		HeldDown jsonDuration   `json:"held_down"`
+		RTTs     []jsonDuration `json:"rtts"`
+		Offsets  []jsonDuration `json:"offsets"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	s.Status = aux.Status
+	s.HeldDown = time.Duration(aux.HeldDown)
+	s.RTTs = durations(aux.RTTs)
+	s.Offsets = durations(aux.Offsets)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串
+func (s LoopStats) MarshalJSON() ([]byte, error) {
+	type alias LoopStats
+	return json.Marshal(struct {
+		alias
+		Time   jsonTime     `json:"time"`
+		Offset jsonDuration `json:"offset"`
+		Jitter jsonDuration `json:"jitter"`
+	}{
+		alias:  alias(s),
+		Time:   jsonTime(s.Time),
+		Offset: jsonDuration(s.Offset),
+		Jitter: jsonDuration(s.Jitter),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (s *LoopStats) UnmarshalJSON(data []byte) error {
+	type alias LoopStats
+	aux := struct {
+		*alias
+		Time   jsonTime     `json:"time"`
+		Offset jsonDuration `json:"offset"`
+		Jitter jsonDuration `json:"jitter"`
+	}{alias: (*alias)(s)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	s.Time = time.Time(aux.Time)
+	s.Offset = time.Duration(aux.Offset)
+	s.Jitter = time.Duration(aux.Jitter)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串
+func (p AllanPoint) MarshalJSON() ([]byte, error) {
+	type alias AllanPoint
+	return json.Marshal(struct {
+		alias
+		Tau jsonDuration `json:"tau"`
+	}{
+		alias: alias(p),
+		Tau:   jsonDuration(p.Tau),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (p *AllanPoint) UnmarshalJSON(data []byte) error {
+	type alias AllanPoint
+	aux := struct {
+		*alias
+		Tau jsonDuration `json:"tau"`
+	}{alias: (*alias)(p)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	p.Tau = time.Duration(aux.Tau)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串
+func (t Tracking) MarshalJSON() ([]byte, error) {
+	type alias Tracking
+	return json.Marshal(struct {
+		alias
+		LastUpdate     jsonTime     `json:"last_update"`
+		Offset         jsonDuration `json:"offset"`
+		LastOffset     jsonDuration `json:"last_offset"`
+		RMSOffset      jsonDuration `json:"rms_offset"`
+		RootDelay      jsonDuration `json:"root_delay"`
+		RootDispersion jsonDuration `json:"root_dispersion"`
+		UpdateInterval jsonDuration `json:"update_interval"`
+	}{
+		alias:          alias(t),
+		LastUpdate:     jsonTime(t.LastUpdate),
+		Offset:         jsonDuration(t.Offset),
+		LastOffset:     jsonDuration(t.LastOffset),
+		RMSOffset:      jsonDuration(t.RMSOffset),
+		RootDelay:      jsonDuration(t.RootDelay),
+		RootDispersion: jsonDuration(t.RootDispersion),
+		UpdateInterval: jsonDuration(t.UpdateInterval),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (t *Tracking) UnmarshalJSON(data []byte) error {
+	type alias Tracking
+	aux := struct {
+		*alias
+		LastUpdate     jsonTime     `json:"last_update"`
+		Offset         jsonDuration `json:"offset"`
+		LastOffset     jsonDuration `json:"last_offset"`
+		RMSOffset      jsonDuration `json:"rms_offset"`
+		RootDelay      jsonDuration `json:"root_delay"`
+		RootDispersion jsonDuration `json:"root_dispersion"`
+		UpdateInterval jsonDuration `json:"update_interval"`
+	}{alias: (*alias)(t)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	t.LastUpdate = time.Time(aux.LastUpdate)
+	t.Offset = time.Duration(aux.Offset)
+	t.LastOffset = time.Duration(aux.LastOffset)
+	t.RMSOffset = time.Duration(aux.RMSOffset)
+	t.RootDelay = time.Duration(aux.RootDelay)
+	t.RootDispersion = time.Duration(aux.RootDispersion)
+	t.UpdateInterval = time.Duration(aux.UpdateInterval)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串
+func (s SourceStats) MarshalJSON() ([]byte, error) {
+	type alias SourceStats
+	return json.Marshal(struct {
+		alias
+		Span   jsonDuration `json:"span"`
+		StdDev jsonDuration `json:"stddev"`
+	}{
+		alias:  alias(s),
+		Span:   jsonDuration(s.Span),
+		StdDev: jsonDuration(s.StdDev),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (s *SourceStats) UnmarshalJSON(data []byte) error {
+	type alias SourceStats
+	aux := struct {
+		*alias
+		Span   jsonDuration `json:"span"`
+		StdDev jsonDuration `json:"stddev"`
+	}{alias: (*alias)(s)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	s.Span = time.Duration(aux.Span)
+	s.StdDev = time.Duration(aux.StdDev)
+	return nil
+}
+
+// MarshalJSON 实现json.Marshaler，零值的时间编码为null
+func (s Selection) MarshalJSON() ([]byte, error) {
+	type alias Selection
+	return json.Marshal(struct {
+		alias
+		Time jsonTime `json:"time"`
+	}{
+		alias: alias(s),
+		Time:  jsonTime(s.Time),
+	})
+}
+
+// UnmarshalJSON 实现json.Unmarshaler，与MarshalJSON的格式对应
+func (s *Selection) UnmarshalJSON(data []byte) error {
+	type alias Selection
+	aux := struct {
+		*alias
+		Time jsonTime `json:"time"`
+	}{alias: (*alias)(s)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	s.Time = time.Time(aux.Time)
+	return nil
+}
+
+// jsonDurations 把时长切片转换为以字符串编码的形式
+func jsonDurations(ds []time.Duration) []jsonDuration {
+	if ds == nil {
+		return nil
+	}
+	out := make([]jsonDuration, len(ds))
+	for i, d := range ds {
+		out[i] = jsonDuration(d)
+	}
+	return out
+}
+
+// durations 是jsonDurations的逆转换
+func durations(ds []jsonDuration) []time.Duration {
+	if ds == nil {
+		return nil
+	}
+	out := make([]time.Duration, len(ds))
+	for i, d := range ds {
+		out[i] = time.Duration(d)
+	}
+	return out
+}
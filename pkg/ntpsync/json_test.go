@@ -0,0 +1,226 @@
+package ntpsync
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSyncResultJSON 测试SyncResult的JSON编码和解码
+func TestSyncResultJSON(t *testing.T) {
+	result := SyncResult{
+		Server:  "pool.ntp.org:123",
+		Time:    time.Date(2024, 5, 1, 12, 0, 0, 500000000, time.UTC),
+		Offset:  1500 * time.Microsecond,
+		RTT:     25 * time.Millisecond,
+		Stratum: 2,
+		Error:   errors.New("测试错误"),
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("编码SyncResult失败: %v", err)
+	}
+
+	encoded := string(data)
+	for _, want := range []string{
+		`"server":"pool.ntp.org:123"`,
+		`"time":"2024-05-01T12:00:00.5Z"`,
+		`"offset":"1.5ms"`,
+		`"rtt":"25ms"`,
+		`"stratum":2`,
+		`"error":"测试错误"`,
+	} {
+		if !strings.Contains(encoded, want) {
+			t.Errorf("预期JSON包含 %s，实际得到 %s", want, encoded)
+		}
+	}
+
+	var decoded SyncResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("解码SyncResult失败: %v", err)
+	}
+
+	if decoded.Server != result.Server || !decoded.Time.Equal(result.Time) ||
+		decoded.Offset != result.Offset || decoded.RTT != result.RTT ||
+		decoded.Stratum != result.Stratum {
+		t.Errorf("解码结果与原始值不一致: %+v", decoded)
+	}
+
+	if decoded.Error == nil || decoded.Error.Error() != "测试错误" {
+		t.Errorf("预期错误文本被还原，实际得到 %v", decoded.Error)
+	}
+}
+
+// TestServerStatusJSON 测试ServerStatus的JSON编码
+func TestServerStatusJSON(t *testing.T) {
+	status := ServerStatus{
+		Address:   "time.google.com",
+		Reachable: false,
+		RTT:       -3 * time.Millisecond,
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("编码ServerStatus失败: %v", err)
+	}
+
+	encoded := string(data)
+	if !strings.Contains(encoded, `"last_response":null`) {
+		t.Errorf("预期零值时间编码为null，实际得到 %s", encoded)
+	}
+
+	if !strings.Contains(encoded, `"rtt":"-3ms"`) {
+		t.Errorf("预期RTT编码为易读字符串，实际得到 %s", encoded)
+	}
+
+	var decoded ServerStatus
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("解码ServerStatus失败: %v", err)
+	}
+
+	if decoded != status {
+		t.Errorf("预期 %+v，实际得到 %+v", status, decoded)
+	}
+}
+
+// TestPeriodicSyncStatusJSON 测试PeriodicSyncStatus的JSON编码
+func TestPeriodicSyncStatusJSON(t *testing.T) {
+	status := PeriodicSyncStatus{
+		Running:      true,
+		Interval:     time.Hour,
+		SuccessCount: 3,
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("编码PeriodicSyncStatus失败: %v", err)
+	}
+
+	encoded := string(data)
+	if !strings.Contains(encoded, `"interval":"1h0m0s"`) {
+		t.Errorf("预期间隔编码为易读字符串，实际得到 %s", encoded)
+	}
+
+	if strings.Contains(encoded, "last_error") {
+		t.Errorf("预期没有错误时省略last_error，实际得到 %s", encoded)
+	}
+
+	// 兼容以纳秒整数表示的时长
+	var decoded PeriodicSyncStatus
+	if err := json.Unmarshal([]byte(`{"running":true,"interval":1000000000}`), &decoded); err != nil {
+		t.Fatalf("解码PeriodicSyncStatus失败: %v", err)
+	}
+
+	if decoded.Interval != time.Second {
+		t.Errorf("预期间隔为1秒，实际得到 %v", decoded.Interval)
+	}
+}
+
+// TestTrackingJSON 测试Tracking的JSON编码
+func TestTrackingJSON(t *testing.T) {
+	tracking := Tracking{
+		Server:         "ntp.example.com:123",
+		Stratum:        2,
+		Offset:         -3 * time.Millisecond,
+		LastOffset:     2 * time.Millisecond,
+		RMSOffset:      time.Millisecond,
+		Frequency:      12.5,
+		RootDelay:      time.Millisecond,
+		RootDispersion: 500 * time.Microsecond,
+		UpdateInterval: 64 * time.Second,
+	}
+
+	data, err := json.Marshal(tracking)
+	if err != nil {
+		t.Fatalf("编码Tracking失败: %v", err)
+	}
+
+	encoded := string(data)
+	for _, want := range []string{`"offset":"-3ms"`, `"root_delay":"1ms"`, `"update_interval":"1m4s"`, `"last_update":null`} {
+		if !strings.Contains(encoded, want) {
+			t.Errorf("预期包含 %s，实际得到 %s", want, encoded)
+		}
+	}
+
+	var decoded Tracking
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("解码Tracking失败: %v", err)
+	}
+
+	if decoded != tracking {
+		t.Errorf("预期 %+v，实际得到 %+v", tracking, decoded)
+	}
+}
+
+// TestSourceStatsJSON 测试SourceStats的JSON编码
+func TestSourceStatsJSON(t *testing.T) {
+	stats := SourceStats{
+		Address:   "ntp.example.com:123",
+		Samples:   8,
+		Span:      10 * time.Minute,
+		Frequency: -1.5,
+		Skew:      0.2,
+		StdDev:    250 * time.Microsecond,
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("编码SourceStats失败: %v", err)
+	}
+
+	encoded := string(data)
+	for _, want := range []string{`"span":"10m0s"`, `"stddev":"250µs"`} {
+		if !strings.Contains(encoded, want) {
+			t.Errorf("预期包含 %s，实际得到 %s", want, encoded)
+		}
+	}
+
+	var decoded SourceStats
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("解码SourceStats失败: %v", err)
+	}
+
+	if decoded != stats {
+		t.Errorf("预期 %+v，实际得到 %+v", stats, decoded)
+	}
+}
+
+// TestSelectionJSON 测试Selection的JSON编码
+func TestSelectionJSON(t *testing.T) {
+	data, err := json.Marshal(Selection{Reason: "没有可用的服务器"})
+	if err != nil {
+		t.Fatalf("编码Selection失败: %v", err)
+	}
+	if encoded := string(data); !strings.Contains(encoded, `"time":null`) {
+		t.Errorf("预期零值的时间编码为null，实际得到 %s", encoded)
+	}
+
+	selection := Selection{
+		Time:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Server: "ntp.example.com:123",
+		Reason: "排名最高的服务器",
+		Candidates: []SelectionCandidate{
+			{Server: "ntp.example.com:123", Rank: 1, Outcome: SelectionSelected},
+		},
+	}
+
+	data, err = json.Marshal(selection)
+	if err != nil {
+		t.Fatalf("编码Selection失败: %v", err)
+	}
+
+	var decoded Selection
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("解码Selection失败: %v", err)
+	}
+
+	if !decoded.Time.Equal(selection.Time) || decoded.Server != selection.Server || decoded.Reason != selection.Reason {
+		t.Errorf("预期 %+v，实际得到 %+v", selection, decoded)
+	}
+	if len(decoded.Candidates) != 1 || decoded.Candidates[0] != selection.Candidates[0] {
+		t.Errorf("预期候选服务器 %+v，实际得到 %+v", selection.Candidates, decoded.Candidates)
+	}
+}
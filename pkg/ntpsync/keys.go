@@ -0,0 +1,211 @@
+package ntpsync
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrAuthentication 表示服务器的应答没有通过对称密钥认证，
+// 或服务器以crypto-NAK表示不认识请求使用的密钥
+var ErrAuthentication = errors.New("NTP应答认证失败")
+
+// KeyType 是对称密钥使用的摘要算法
+type KeyType string
+
+// 支持的摘要算法，MAC为4字节的密钥ID加上摘要
+const (
+	KeyMD5  KeyType = "MD5"  // 16字节摘要，ntp.keys中写作M或MD5
+	KeySHA1 KeyType = "SHA1" // 20字节摘要
+)
+
+// maxASCIIKeyLength 是ntp.keys中ASCII形式密钥的最大长度，更长的密钥按十六进制解析
+const maxASCIIKeyLength = 20
+
+// SymmetricKey 是用于NTP对称密钥认证的密钥，对应ntp.keys中的一行
+type SymmetricKey struct {
+	// ID 是密钥ID，1到65535
+	ID uint32
+
+	// Type 是摘要算法
+	Type KeyType
+
+	// Key 是密钥的原始字节
+	Key []byte
+}
+
+// Keys 是按密钥ID索引的对称密钥，参见ParseKeys
+type Keys map[uint32]SymmetricKey
+
+// LoadKeysFile 读取ntpd或chrony格式的密钥文件，例如/etc/ntp.keys，参见ParseKeys
+func LoadKeysFile(path string) (Keys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	defer f.Close()
+
+	keys, err := ParseKeys(f)
+	if err != nil {
+		return nil, fmt.Errorf("密钥文件 %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ParseKeys 解析ntpd格式的密钥文件，每行为"密钥ID 类型 密钥"，#之后是注释：
+//
+//	1 M     secret
+//	2 SHA1  2c6c1b7d7e1f09e4a5c8d2b7e0e6f3a1c9d4b8e2
+//
+// 类型为M、MD5或SHA1。不超过20个字符的密钥按ASCII解析，更长的按十六进制解析；
+// 也可以像chrony一样写成"HEX:..."或"ASCII:..."明确指定
+func ParseKeys(r io.Reader) (Keys, error) {
+	keys := make(Keys)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("第%d行: 格式应为\"密钥ID 类型 密钥\"", line)
+		}
+
+		key, err := parseKey(fields[0], fields[1], fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: %v", line, err)
+		}
+		if _, ok := keys[key.ID]; ok {
+			return nil, fmt.Errorf("第%d行: 密钥ID %d 重复", line, key.ID)
+		}
+		keys[key.ID] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// parseKey 解析密钥文件中一行的三个字段
+func parseKey(id, typ, key string) (SymmetricKey, error) {
+	n, err := strconv.ParseUint(id, 10, 16)
+	if err != nil || n == 0 {
+		return SymmetricKey{}, fmt.Errorf("无效的密钥ID %q", id)
+	}
+
+	k := SymmetricKey{ID: uint32(n)}
+	switch strings.ToUpper(typ) {
+	case "M", "MD5":
+		k.Type = KeyMD5
+	case "SHA1", "SHA-1":
+		k.Type = KeySHA1
+	default:
+		return SymmetricKey{}, fmt.Errorf("不支持的密钥类型 %q", typ)
+	}
+
+	switch {
+	case strings.HasPrefix(key, "ASCII:"):
+		k.Key = []byte(strings.TrimPrefix(key, "ASCII:"))
+	case strings.HasPrefix(key, "HEX:"):
+		k.Key, err = hex.DecodeString(strings.TrimPrefix(key, "HEX:"))
+	case len(key) > maxASCIIKeyLength:
+		k.Key, err = hex.DecodeString(key)
+	default:
+		k.Key = []byte(key)
+	}
+	if err != nil {
+		return SymmetricKey{}, fmt.Errorf("无效的十六进制密钥: %v", err)
+	}
+	if len(k.Key) == 0 {
+		return SymmetricKey{}, errors.New("密钥为空")
+	}
+	return k, nil
+}
+
+// copyKeys 复制密钥，防止外部修改
+func copyKeys(keys Keys) Keys {
+	if len(keys) == 0 {
+		return nil
+	}
+	copied := make(Keys, len(keys))
+	for id, k := range keys {
+		k.Key = append([]byte(nil), k.Key...)
+		copied[id] = k
+	}
+	return copied
+}
+
+// newHash 返回密钥类型对应的摘要算法
+func (k SymmetricKey) newHash() hash.Hash {
+	if k.Type == KeySHA1 {
+		return sha1.New()
+	}
+	return md5.New()
+}
+
+// macSize 返回使用该密钥的MAC长度
+func (k SymmetricKey) macSize() int {
+	return 4 + k.newHash().Size()
+}
+
+// digest 计算数据包的摘要，即摘要算法(密钥 || 数据包)
+func (k SymmetricKey) digest(packet []byte) []byte {
+	h := k.newHash()
+	h.Write(k.Key)
+	h.Write(packet)
+	return h.Sum(nil)
+}
+
+// appendMAC 在数据包末尾追加密钥ID和摘要
+func (k SymmetricKey) appendMAC(packet []byte) []byte {
+	digest := k.digest(packet)
+	packet = binary.BigEndian.AppendUint32(packet, k.ID)
+	return append(packet, digest...)
+}
+
+// verify 检查应答末尾的MAC，resp是包括MAC在内的整个应答
+func (k SymmetricKey) verify(server string, resp []byte) error {
+	// 只有4字节密钥ID的MAC是crypto-NAK，表示服务器不认识密钥或认证失败
+	if len(resp) == packetSize+4 {
+		return fmt.Errorf("%w: 服务器 %s 拒绝了密钥 %d", ErrAuthentication, server, k.ID)
+	}
+
+	size := k.macSize()
+	if len(resp) < packetSize+size {
+		return fmt.Errorf("%w: 服务器 %s 的应答没有MAC", ErrAuthentication, server)
+	}
+	mac := resp[len(resp)-size:]
+	if id := binary.BigEndian.Uint32(mac); id != k.ID {
+		return fmt.Errorf("%w: 服务器 %s 的应答使用了密钥 %d，预期 %d", ErrAuthentication, server, id, k.ID)
+	}
+	if subtle.ConstantTimeCompare(mac[4:], k.digest(resp[:len(resp)-size])) != 1 {
+		return fmt.Errorf("%w: 服务器 %s 的应答摘要不匹配", ErrAuthentication, server)
+	}
+	return nil
+}
+
+// serverKey 返回向服务器发送请求使用的密钥，不认证时返回nil，configured是配置中的服务器地址
+func (n *NTPSync) serverKey(configured string) *SymmetricKey {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	id := n.serverOptions[configured].KeyID
+	if id == 0 {
+		return nil
+	}
+	if k, ok := n.keys[id]; ok {
+		return &k
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package ntpsync
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestParseKeys 测试解析ntpd和chrony格式的密钥文件
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(strings.NewReader(`# ntp.keys
+1 M secret
+2 SHA1 0102030405060708090a0b0c0d0e0f1011121314 # 十六进制
+3 md5 HEX:abcd
+	4	SHA1	ASCII:0123456789abcdef0123456789
+`))
+	if err != nil {
+		t.Fatalf("解析密钥失败: %v", err)
+	}
+
+	want := map[uint32]SymmetricKey{
+		1: {ID: 1, Type: KeyMD5, Key: []byte("secret")},
+		2: {ID: 2, Type: KeySHA1, Key: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}},
+		3: {ID: 3, Type: KeyMD5, Key: []byte{0xab, 0xcd}},
+		4: {ID: 4, Type: KeySHA1, Key: []byte("0123456789abcdef0123456789")},
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("预期%d个密钥，实际得到%d个", len(want), len(keys))
+	}
+	for id, w := range want {
+		k := keys[id]
+		if k.ID != w.ID || k.Type != w.Type || !bytes.Equal(k.Key, w.Key) {
+			t.Errorf("密钥%d: 预期%+v，实际得到%+v", id, w, k)
+		}
+	}
+
+	for _, data := range []string{
+		"1 M",
+		"0 M secret",
+		"65536 M secret",
+		"1 SHA256 secret",
+		"1 M 0102030405060708090a0b0c0d0e0f10111213zz",
+		"1 M secret\n1 SHA1 other",
+	} {
+		if _, err := ParseKeys(strings.NewReader(data)); err == nil {
+			t.Errorf("预期%q无效", data)
+		}
+	}
+}
+
+// TestSymmetricKeyAuthentication 测试使用对称密钥认证请求和应答
+func TestSymmetricKeyAuthentication(t *testing.T) {
+	for _, typ := range []KeyType{KeyMD5, KeySHA1} {
+		t.Run(string(typ), func(t *testing.T) {
+			srv := ntptest.NewServer()
+			defer srv.Close()
+			srv.SetOffset(time.Second)
+			srv.SetKey(7, string(typ), []byte("secret"))
+
+			keys := Keys{7: {ID: 7, Type: typ, Key: []byte("secret")}}
+			ntp, err := New(Options{
+				Servers:         []string{srv.Addr()},
+				Timeout:         time.Second,
+				MinPollInterval: -1,
+				Keys:            keys,
+				ServerOptions:   map[string]ServerOptions{srv.Addr(): {KeyID: 7}},
+			})
+			if err != nil {
+				t.Fatalf("创建NTPSync实例失败: %v", err)
+			}
+			defer ntp.Close()
+
+			// 修改传入的密钥不影响实例
+			keys[7].Key[0] = 'x'
+
+			result, err := ntp.syncWithServerBinary(srv.Addr(), time.Second)
+			if err != nil {
+				t.Fatalf("认证的同步失败: %v", err)
+			}
+			if result.Offset < 900*time.Millisecond || result.Offset > 1100*time.Millisecond {
+				t.Errorf("预期偏移量约为1秒，实际得到%v", result.Offset)
+			}
+			req := srv.Requests()[0].Data
+			if want := packetSize + 4 + keys[7].newHash().Size(); len(req) != want {
+				t.Errorf("预期请求长度为%d字节，实际得到%d字节", want, len(req))
+			}
+
+			// 服务器使用不同的密钥时返回crypto-NAK
+			srv.SetKey(7, string(typ), []byte("other"))
+			if _, err := ntp.syncWithServerBinary(srv.Addr(), time.Second); !errors.Is(err, ErrAuthentication) {
+				t.Errorf("预期密钥不匹配时返回ErrAuthentication，实际得到%v", err)
+			}
+
+			// 服务器不认证时拒绝没有MAC的应答
+			srv.SetKey(0, "", nil)
+			if _, err := ntp.syncWithServerBinary(srv.Addr(), time.Second); !errors.Is(err, ErrAuthentication) {
+				t.Errorf("预期应答没有MAC时返回ErrAuthentication，实际得到%v", err)
+			}
+		})
+	}
+
+	if _, err := New(Options{
+		Servers:       []string{"127.0.0.1:1"},
+		ServerOptions: map[string]ServerOptions{"127.0.0.1:1": {KeyID: 1}},
+	}); err == nil {
+		t.Error("预期引用不存在的密钥时返回错误")
+	}
+}
+
+// TestConfigKeysFile 测试配置文件中的keys_file和服务器的key
+func TestConfigKeysFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ntp.keys")
+	if err := os.WriteFile(path, []byte("5 MD5 secret\n"), 0o600); err != nil {
+		t.Fatalf("写入密钥文件失败: %v", err)
+	}
+
+	cfg, err := ParseConfig([]byte(`{"servers": [{"address": "192.168.1.10", "key": 5}], "keys_file": "`+path+`"}`), "json")
+	if err != nil {
+		t.Fatalf("解析配置失败: %v", err)
+	}
+	opts := cfg.Options()
+	if opts.ServerOptions["192.168.1.10"].KeyID != 5 || string(opts.Keys[5].Key) != "secret" {
+		t.Errorf("密钥配置错误: %+v, %+v", opts.ServerOptions, opts.Keys)
+	}
+
+	if _, err := ParseConfig([]byte(`{"servers": ["a"], "keys_file": "`+path+`.missing"}`), "json"); err == nil {
+		t.Error("预期密钥文件不存在时返回错误")
+	}
+}
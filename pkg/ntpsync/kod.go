@@ -0,0 +1,99 @@
+package ntpsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultKissDenyDuration 是收到DENY或RSTR Kiss-o'-Death后停止向服务器发送请求的时长
+// RFC 5905要求客户端不再联系拒绝访问的服务器，这里在一段时间后重新尝试，
+// 以便服务器修改访问控制后能够恢复。以前的版本对这类应答只返回错误，下一次同步仍然发送请求
+const DefaultKissDenyDuration = 24 * time.Hour
+
+// ErrKissOfDeath 表示服务器以DENY或RSTR Kiss-o'-Death拒绝了请求，
+// 或服务器此前拒绝过请求，在拒绝期内不再向它发送请求
+var ErrKissOfDeath = errors.New("NTP服务器拒绝访问")
+
+// kissCode 返回0层级应答参考ID中的Kiss-o'-Death代码
+func kissCode(resp []byte) string {
+	return DecodeReferenceID(0, binary.BigEndian.Uint32(resp[12:16]))
+}
+
+// handleKiss 处理0层级的应答，DENY和RSTR使服务器进入拒绝期，
+// RATE使向服务器发送请求的最小间隔加倍
+func (n *NTPSync) handleKiss(server string, resp []byte) error {
+	code := kissCode(resp)
+	switch code {
+	case "DENY", "RSTR":
+		until := n.denyServer(server, n.clock.Now().Add(DefaultKissDenyDuration))
+		return fmt.Errorf("%w: 服务器 %s 返回了%s，%v之前不再发送请求", ErrKissOfDeath, server, code, until.Format(time.RFC3339))
+	case "RATE":
+		interval := n.raiseServerPoll(server)
+		return fmt.Errorf("%w: 服务器 %s 返回了RATE，向它发送请求的间隔提高到%v", ErrServerRateLimited, server, interval)
+	}
+	return fmt.Errorf("服务器返回无效的0层级响应（%s）", code)
+}
+
+// denyServer 记录服务器在until之前拒绝访问，返回until
+func (n *NTPSync) denyServer(server string, until time.Time) time.Time {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.denied == nil {
+		n.denied = make(map[string]time.Time)
+	}
+	n.denied[serverAddress(server)] = until
+	return until
+}
+
+// checkDenied 在服务器处于拒绝期时返回ErrKissOfDeath
+func (n *NTPSync) checkDenied(server string) error {
+	now := n.clock.Now()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	until, ok := n.denied[serverAddress(server)]
+	if !ok {
+		return nil
+	}
+	if !now.Before(until) {
+		delete(n.denied, serverAddress(server))
+		return nil
+	}
+	return fmt.Errorf("%w: 服务器 %s 在%v之前不接受请求", ErrKissOfDeath, server, until.Format(time.RFC3339))
+}
+
+// isDenied 返回服务器在now时是否处于拒绝期
+func (n *NTPSync) isDenied(server string, now time.Time) bool {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	return now.Before(n.denied[serverAddress(server)])
+}
+
+// DeniedServers 返回以DENY或RSTR拒绝访问、仍处于拒绝期的服务器及拒绝期的截止时间
+func (n *NTPSync) DeniedServers() map[string]time.Time {
+	now := n.clock.Now()
+
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	denied := make(map[string]time.Time)
+	for server, until := range n.denied {
+		if now.Before(until) {
+			denied[server] = until
+		}
+	}
+	return denied
+}
+
+// ClearDenied 清除所有服务器的拒绝期，用于服务器修改访问控制之后立即恢复请求
+func (n *NTPSync) ClearDenied() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.denied = nil
+}
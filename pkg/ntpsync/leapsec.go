@@ -0,0 +1,196 @@
+package ntpsync
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// builtinLeapSeconds 是编译进程序的闰秒表，格式与IERS的leap-seconds.list相同
+//
+//go:embed leap-seconds.list
+var builtinLeapSeconds string
+
+// LeapSecond 是闰秒表中的一项
+type LeapSecond struct {
+	// Time 是生效的UTC时刻
+	Time time.Time
+
+	// TAIOffset 是从Time开始TAI与UTC之差
+	TAIOffset time.Duration
+}
+
+// LeapSecondTable 是UTC与TAI之间的闰秒表。NTP传递的是UTC，工业日志和GNSS等
+// 需要连续时间尺度的场合可以用它换算成TAI。TAI以time.Time表示，其年月日时分秒即TAI的读数
+type LeapSecondTable struct {
+	// Entries 是按时间排列的闰秒
+	Entries []LeapSecond
+
+	// Updated 是闰秒表的最后更新时间，未知时为零值
+	Updated time.Time
+
+	// Expires 是闰秒表的失效时间，之后可能有表中没有的闰秒，未知时为零值
+	Expires time.Time
+}
+
+// leapSeconds 是UTCToTAI等函数使用的闰秒表
+var leapSeconds atomic.Pointer[LeapSecondTable]
+
+func init() {
+	table, err := ParseLeapSeconds(strings.NewReader(builtinLeapSeconds))
+	if err != nil {
+		panic("ntpsync: 内置的闰秒表无效: " + err.Error())
+	}
+	leapSeconds.Store(table)
+}
+
+// ParseLeapSeconds 解析IERS或NIST发布的leap-seconds.list。每行为生效时刻的NTP秒数
+// 和此后的TAI-UTC秒数，#之后是注释；"#$"和"#@"开头的行分别是最后更新时间和失效时间
+func ParseLeapSeconds(r io.Reader) (*LeapSecondTable, error) {
+	table := &LeapSecondTable{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if field, ok := strings.CutPrefix(text, "#$"); ok {
+			t, err := parseNTPSeconds(strings.TrimSpace(field))
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: 无效的更新时间: %v", line, err)
+			}
+			table.Updated = t
+			continue
+		}
+		if field, ok := strings.CutPrefix(text, "#@"); ok {
+			t, err := parseNTPSeconds(strings.TrimSpace(field))
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: 无效的失效时间: %v", line, err)
+			}
+			table.Expires = t
+			continue
+		}
+
+		text, _, _ = strings.Cut(text, "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("第%d行: 格式应为\"NTP秒数 TAI-UTC\"", line)
+		}
+		t, err := parseNTPSeconds(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: 无效的时刻: %v", line, err)
+		}
+		offset, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: 无效的TAI-UTC %q", line, fields[1])
+		}
+		if n := len(table.Entries); n > 0 && !t.After(table.Entries[n-1].Time) {
+			return nil, fmt.Errorf("第%d行: 闰秒没有按时间排列", line)
+		}
+		table.Entries = append(table.Entries, LeapSecond{Time: t, TAIOffset: time.Duration(offset) * time.Second})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(table.Entries) == 0 {
+		return nil, errors.New("闰秒表为空")
+	}
+	return table, nil
+}
+
+// parseNTPSeconds 把1900-01-01起的秒数转换为UTC时间
+func parseNTPSeconds(s string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds-ntpEpoch, 0).UTC(), nil
+}
+
+// LoadLeapSecondsFile 读取leap-seconds.list文件，例如/usr/share/zoneinfo/leap-seconds.list
+func LoadLeapSecondsFile(path string) (*LeapSecondTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取闰秒表失败: %w", err)
+	}
+	defer f.Close()
+
+	table, err := ParseLeapSeconds(f)
+	if err != nil {
+		return nil, fmt.Errorf("闰秒表 %s: %w", path, err)
+	}
+	return table, nil
+}
+
+// SetLeapSecondTable 替换UTCToTAI、TAIToUTC和NTPSync.TAI使用的闰秒表，
+// 用于内置的闰秒表失效之后加载新发布的文件；nil或没有任何项的表表示恢复内置的闰秒表
+func SetLeapSecondTable(table *LeapSecondTable) {
+	if table == nil || len(table.Entries) == 0 {
+		table, _ = ParseLeapSeconds(strings.NewReader(builtinLeapSeconds))
+	}
+	leapSeconds.Store(table)
+}
+
+// CurrentLeapSecondTable 返回当前使用的闰秒表，调用者不应修改
+func CurrentLeapSecondTable() *LeapSecondTable {
+	return leapSeconds.Load()
+}
+
+// Expired 判断闰秒表在now时是否已经失效，失效时间未知时返回false
+func (t *LeapSecondTable) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && now.After(t.Expires)
+}
+
+// Offset 返回UTC时刻utc的TAI-UTC，早于第一项时按第一项计算，表中没有任何项时返回0
+func (t *LeapSecondTable) Offset(utc time.Time) time.Duration {
+	if len(t.Entries) == 0 {
+		return 0
+	}
+	for i := len(t.Entries) - 1; i > 0; i-- {
+		if !utc.Before(t.Entries[i].Time) {
+			return t.Entries[i].TAIOffset
+		}
+	}
+	return t.Entries[0].TAIOffset
+}
+
+// UTCToTAI 把UTC时间换算为TAI
+func (t *LeapSecondTable) UTCToTAI(utc time.Time) time.Time {
+	return utc.Add(t.Offset(utc))
+}
+
+// TAIToUTC 把TAI换算为UTC。插入闰秒（UTC的23:59:60）期间的TAI换算为下一天的00:00:00，
+// 因为time.Time不能表示第60秒。表中没有任何项时原样返回
+func (t *LeapSecondTable) TAIToUTC(tai time.Time) time.Time {
+	if len(t.Entries) == 0 {
+		return tai
+	}
+	for i := len(t.Entries) - 1; i > 0; i-- {
+		if utc := tai.Add(-t.Entries[i].TAIOffset); !utc.Before(t.Entries[i].Time) {
+			return utc
+		}
+	}
+	return tai.Add(-t.Entries[0].TAIOffset)
+}
+
+// UTCToTAI 使用当前的闰秒表把UTC时间换算为TAI，参见SetLeapSecondTable
+func UTCToTAI(utc time.Time) time.Time {
+	return leapSeconds.Load().UTCToTAI(utc)
+}
+
+// TAIToUTC 使用当前的闰秒表把TAI换算为UTC，参见SetLeapSecondTable
+func TAIToUTC(tai time.Time) time.Time {
+	return leapSeconds.Load().TAIToUTC(tai)
+}
+
+// TAI 返回NTP校准后的当前时间对应的TAI
+func (n *NTPSync) TAI() time.Time {
+	return UTCToTAI(n.Now())
+}
@@ -0,0 +1,97 @@
+package ntpsync
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBuiltinLeapSeconds 测试内置闰秒表的换算
+func TestBuiltinLeapSeconds(t *testing.T) {
+	table := CurrentLeapSecondTable()
+	if got := len(table.Entries); got != 28 {
+		t.Errorf("预期内置28项，实际得到%d项", got)
+	}
+	if table.Expires.IsZero() || table.Updated.IsZero() {
+		t.Error("预期内置闰秒表有更新时间和失效时间")
+	}
+
+	tests := []struct {
+		utc    time.Time
+		offset time.Duration
+	}{
+		{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 10 * time.Second},
+		{time.Date(2016, 12, 31, 23, 59, 59, 0, time.UTC), 36 * time.Second},
+		{time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), 37 * time.Second},
+		{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), 37 * time.Second},
+	}
+	for _, tt := range tests {
+		tai := UTCToTAI(tt.utc)
+		if got := tai.Sub(tt.utc); got != tt.offset {
+			t.Errorf("%v: 预期TAI-UTC为%v，实际得到%v", tt.utc, tt.offset, got)
+		}
+		if got := TAIToUTC(tai); !got.Equal(tt.utc) {
+			t.Errorf("%v: 换算回UTC得到%v", tt.utc, got)
+		}
+	}
+
+	// 2016-12-31T23:59:60的TAI换算为下一天的零点
+	leap := time.Date(2017, 1, 1, 0, 0, 36, 0, time.UTC)
+	if got := TAIToUTC(leap); !got.Equal(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("预期闰秒换算为2017-01-01T00:00:00，实际得到%v", got)
+	}
+}
+
+// TestParseLeapSeconds 测试解析和替换闰秒表
+func TestParseLeapSeconds(t *testing.T) {
+	table, err := ParseLeapSeconds(strings.NewReader(`# 测试
+#$	3676924800
+#@	3993753600
+2272060800	10	# 1 Jan 1972
+3692217600	37	# 1 Jan 2017
+4000000000	38
+`))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(table.Entries) != 3 || table.Entries[2].TAIOffset != 38*time.Second {
+		t.Errorf("解析结果错误: %+v", table.Entries)
+	}
+	if !table.Expires.Equal(time.Date(2026, 7, 23, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("失效时间错误: %v", table.Expires)
+	}
+	if !table.Expired(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("预期失效时间之后已经失效")
+	}
+
+	SetLeapSecondTable(table)
+	defer SetLeapSecondTable(nil)
+	after := time.Unix(4000000000-ntpEpoch, 0)
+	if got := UTCToTAI(after).Sub(after); got != 38*time.Second {
+		t.Errorf("预期使用新的闰秒表，实际TAI-UTC为%v", got)
+	}
+
+	for _, bad := range []string{"", "# 只有注释\n", "2272060800\n", "2272060800 x\n", "3692217600 37\n2272060800 10\n"} {
+		if _, err := ParseLeapSeconds(strings.NewReader(bad)); err == nil {
+			t.Errorf("预期%q解析失败", bad)
+		}
+	}
+}
+
+// TestEmptyLeapSecondTable 测试没有任何项的闰秒表不会导致换算时panic
+func TestEmptyLeapSecondTable(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	empty := &LeapSecondTable{}
+	if got := empty.Offset(now); got != 0 {
+		t.Errorf("预期空表的TAI-UTC为0，实际得到%v", got)
+	}
+	if got := empty.TAIToUTC(now); !got.Equal(now) {
+		t.Errorf("预期空表原样返回，实际得到%v", got)
+	}
+
+	SetLeapSecondTable(empty)
+	defer SetLeapSecondTable(nil)
+	if got := UTCToTAI(now).Sub(now); got != 37*time.Second {
+		t.Errorf("预期设置空表时恢复内置的闰秒表，实际TAI-UTC为%v", got)
+	}
+}
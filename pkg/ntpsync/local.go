@@ -0,0 +1,69 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 本地时钟时间源的参数
+const (
+	// LocalClockName 是本地时钟时间源在同步结果和事件中的名称
+	LocalClockName = "LOCAL"
+
+	// LocalReferenceID 是本地时钟时间源的参考ID，与ntpd的127.127.1.0相同
+	LocalReferenceID = "LOCL"
+
+	// DefaultLocalStratum 是推荐的本地时钟层级，与ntpd常见的fudge 127.127.1.0 stratum 10相同，
+	// 足够高以免下游客户端在有其它可用服务器时选择本机
+	DefaultLocalStratum = 10
+)
+
+// validateLocalStratum 检查本地时钟的层级
+func validateLocalStratum(stratum int) error {
+	if stratum < 0 || stratum > 15 {
+		return fmt.Errorf("本地时钟的层级%d必须在[0, 15]范围内", stratum)
+	}
+	return nil
+}
+
+// errLocalClockSync 表示同步回退到了本地时钟，只在内部使用：
+// coalesce向调用者返回nil，recordSyncResult既不计为成功也不计为失败
+var errLocalClockSync = errors.New("回退到本地时钟")
+
+// shouldFallBackToLocal 判断同步失败后是否回退到本地时钟
+// 只有没有得到任何可用的测量时才回退，服务器应答被拒绝或请求被限速时不回退
+func shouldFallBackToLocal(err error) bool {
+	return !errors.Is(err, ErrClosed) && !errors.Is(err, ErrOutlierRejected) &&
+		!errors.Is(err, ErrOffsetTooLarge) && !errors.Is(err, ErrRateLimited)
+}
+
+// syncWithLocalClock 以本地时钟作为时间源同步，相当于ntpd的127.127.1.0
+// 结果保持Now的当前值不变（包括保持模式的调整），层级为LocalStratum，参考ID为LOCL，
+// 误差上限为当前的估计误差上限，表明时间没有受到任何外部时间源的约束。
+// 结果只记录到同步历史中，供Tracking等状态接口报告层级；本地时钟没有测量任何东西，
+// 不更新最后一次同步的时间，保持模式、误差上限和MaxStaleness照常随时间推进。
+// 返回errLocalClockSync，由coalesce转换为nil
+func (n *NTPSync) syncWithLocalClock(stratum int) error {
+	local := n.clock.Now()
+
+	n.mutex.Lock()
+	_, correction := n.holdoverLocked(local)
+	offset := n.timeOffset + correction
+	result := SyncResult{
+		Server:       LocalClockName,
+		Time:         local.Add(offset),
+		Offset:       offset,
+		Stratum:      uint8(stratum),
+		ReferenceID:  LocalReferenceID,
+		RootDistance: n.maxErrorLocked(local),
+	}
+	n.history.add(result)
+	n.mutex.Unlock()
+
+	n.emit(Event{
+		Type:   EventSyncSucceeded,
+		Server: result.Server,
+		Offset: result.Offset,
+	})
+	return errLocalClockSync
+}
@@ -0,0 +1,130 @@
+package ntpsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestLocalClockFallback 测试所有服务器都不可用时回退到本地时钟
+func TestLocalClockFallback(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{
+		Servers:         []string{"127.0.0.1:1"},
+		Timeout:         100 * time.Millisecond,
+		MinPollInterval: -1,
+		LocalStratum:    DefaultLocalStratum,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	src := &fakeSource{offset: 2 * time.Second, uncertainty: time.Millisecond}
+	if err := ntp.SyncWithSource(context.Background(), src); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	clock.Advance(time.Hour)
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("预期回退到本地时钟，实际得到错误: %v", err)
+	}
+
+	history := ntp.GetHistory(2)
+	if len(history) != 2 || history[0].Error == nil {
+		t.Fatalf("预期历史中先记录服务器同步失败，实际得到%+v", history)
+	}
+	local := history[1]
+	if local.Server != LocalClockName || local.Stratum != DefaultLocalStratum || local.ReferenceID != LocalReferenceID {
+		t.Errorf("预期结果标明来自本地时钟，实际得到%+v", local)
+	}
+	if local.Offset != 2*time.Second {
+		t.Errorf("预期保持当前的偏移量，实际得到%v", local.Offset)
+	}
+	if want := time.Millisecond + time.Duration(float64(time.Hour)*maxDrift); local.RootDistance != want {
+		t.Errorf("预期误差上限为%v，实际得到%v", want, local.RootDistance)
+	}
+	if tracking := ntp.Tracking(); tracking.Stratum != DefaultLocalStratum || tracking.ReferenceID != LocalReferenceID {
+		t.Errorf("预期Tracking报告本地时钟的层级，实际得到%+v", tracking)
+	}
+
+	// 本地时钟没有测量任何东西，最后一次同步的时效继续增长
+	if got := ntp.LastSyncAge(); got != time.Hour {
+		t.Errorf("预期时效仍然从最后一次服务器同步计算，实际得到%v", got)
+	}
+	clock.Advance(time.Hour)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("预期回退到本地时钟，实际得到错误: %v", err)
+	}
+	if got := ntp.LastSyncAge(); got != 2*time.Hour {
+		t.Errorf("预期时效增长到2小时，实际得到%v", got)
+	}
+	if ntp.IsSynchronized(time.Hour) {
+		t.Error("预期回退到本地时钟时不认为已同步")
+	}
+}
+
+// TestLocalClockFallbackPeriodic 测试定时同步回退到本地时钟时不计为一次成功的同步
+func TestLocalClockFallbackPeriodic(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{
+		Servers:         []string{"127.0.0.1:1"},
+		Timeout:         100 * time.Millisecond,
+		MinPollInterval: -1,
+		LocalStratum:    DefaultLocalStratum,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if delay := ntp.runCycle(); delay != DefaultSyncInterval {
+		t.Errorf("预期回退到本地时钟后按同步间隔等待，实际得到%v", delay)
+	}
+	if history := ntp.GetHistory(1); len(history) != 1 || history[0].Server != LocalClockName {
+		t.Fatalf("预期回退到本地时钟，实际得到%+v", history)
+	}
+	status := ntp.GetPeriodicSyncStatus()
+	if status.SuccessCount != 0 || status.ErrorCount != 0 || !status.LastSync.IsZero() {
+		t.Errorf("预期回退到本地时钟既不计为成功也不计为失败，实际得到%+v", status)
+	}
+
+	clock.Advance(time.Hour)
+	if err := ntp.coalesce(true); err != nil {
+		t.Fatalf("预期回退到本地时钟，实际得到错误: %v", err)
+	}
+	if got := ntp.LastSyncAge(); got != NeverSynced {
+		t.Errorf("预期从未同步，实际得到%v", got)
+	}
+	if ntp.IsSynchronized(time.Hour) {
+		t.Error("预期回退到本地时钟时不认为已同步")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := ntp.WaitForSync(ctx); err != context.DeadlineExceeded {
+		t.Errorf("预期WaitForSync继续等待，实际得到%v", err)
+	}
+}
+
+// TestLocalClockDisabled 测试没有设置LocalStratum时不回退到本地时钟
+func TestLocalClockDisabled(t *testing.T) {
+	ntp, err := New(Options{
+		Servers:         []string{"127.0.0.1:1"},
+		Timeout:         100 * time.Millisecond,
+		MinPollInterval: -1,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err == nil {
+		t.Error("预期所有服务器不可用时同步失败")
+	}
+
+	if _, err := New(Options{Servers: []string{"127.0.0.1:1"}, LocalStratum: 16}); err == nil {
+		t.Error("预期拒绝超过15的层级")
+	}
+}
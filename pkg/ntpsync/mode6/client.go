@@ -0,0 +1,273 @@
+// Package mode6 实现NTP控制消息（mode 6）协议的客户端，即ntpq使用的协议。
+//
+// 监控工具可以用它查询现有的ntpd及兼容的服务器（例如NTPsec）的系统变量和
+// 对等体列表，审计基础设施中的时间服务器：
+//
+//	c, _ := mode6.New(mode6.Options{Address: "10.0.0.1"})
+//	system, _ := c.ReadVariables(ctx, 0)
+//	peers, _ := c.Peers(ctx)
+//
+// chrony不支持mode 6，需要使用chronyc的命令协议查询。
+// 大多数ntpd的默认配置只允许本机查询（restrict ... noquery），远程查询前需要放开限制。
+package mode6
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// 客户端的默认参数
+const (
+	// DefaultTimeout 是一次查询的默认超时时间
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultVersion 是控制消息使用的默认版本，与ntpq相同
+	DefaultVersion = ntpsync.Version2
+
+	// defaultPort 是NTP的端口
+	defaultPort = "123"
+
+	// maxMessageSize 是接收分片的缓冲区大小
+	maxMessageSize = 2048
+)
+
+// Options 包含Client的配置选项
+type Options struct {
+	// Address 是服务器的"主机:端口"地址，省略端口时使用123
+	Address string
+
+	// Timeout 是一次查询（包括所有分片）的超时时间，零值表示使用DefaultTimeout
+	Timeout time.Duration
+
+	// Version 是请求使用的版本，零值表示使用DefaultVersion
+	Version ntpsync.NTPVersion
+
+	// Dialer 用于建立UDP连接，nil表示使用net.Dialer，参见ntpsync.Options.Dialer
+	Dialer ntpsync.Dialer
+}
+
+// Peer 是一个对等体的详细信息，由关联的状态和变量组成
+type Peer struct {
+	Association
+
+	// Address 是对等体的地址(srcadr)
+	Address string `json:"address"`
+
+	// ReferenceID 是对等体的参考ID(refid)
+	ReferenceID string `json:"reference_id"`
+
+	// Stratum 是对等体的层级
+	Stratum int `json:"stratum"`
+
+	// Reach 是对等体的可达性寄存器
+	Reach uint8 `json:"reach"`
+
+	// Poll 是主机的轮询间隔(hpoll)
+	Poll time.Duration `json:"poll"`
+
+	// Offset 是对等体的偏移量
+	Offset time.Duration `json:"offset"`
+
+	// Delay 是对等体的往返延迟
+	Delay time.Duration `json:"delay"`
+
+	// Jitter 是对等体的抖动
+	Jitter time.Duration `json:"jitter"`
+
+	// Variables 是对等体的全部变量
+	Variables Variables `json:"variables"`
+}
+
+// Client 是控制消息客户端，可以被多个goroutine同时使用
+type Client struct {
+	address string
+	timeout time.Duration
+	version ntpsync.NTPVersion
+	dialer  ntpsync.Dialer
+
+	mutex    sync.Mutex
+	sequence uint16
+}
+
+// New 创建一个控制消息客户端
+func New(opts Options) (*Client, error) {
+	if opts.Address == "" {
+		return nil, errors.New("必须提供服务器地址")
+	}
+	if opts.Version > ntpsync.Version4 {
+		return nil, fmt.Errorf("不支持的控制消息版本: %d", opts.Version)
+	}
+
+	c := &Client{
+		address:  opts.Address,
+		timeout:  opts.Timeout,
+		version:  opts.Version,
+		dialer:   opts.Dialer,
+		sequence: uint16(rand.Intn(1 << 16)),
+	}
+	if _, _, err := net.SplitHostPort(c.address); err != nil {
+		c.address = net.JoinHostPort(c.address, defaultPort)
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	if c.version == 0 {
+		c.version = DefaultVersion
+	}
+	if c.dialer == nil {
+		c.dialer = &net.Dialer{}
+	}
+	return c, nil
+}
+
+// nextSequence 返回下一个请求的序号
+func (c *Client) nextSequence() uint16 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.sequence++
+	return c.sequence
+}
+
+// Query 发送一个控制消息请求并返回重组后的应答数据
+func (c *Client) Query(ctx context.Context, opcode byte, associationID uint16, data []byte) ([]byte, error) {
+	if len(data) > maxDataSize {
+		return nil, fmt.Errorf("请求数据长度%d超过%d", len(data), maxDataSize)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	conn, err := c.dialer.DialContext(ctx, "udp", c.address)
+	if err != nil {
+		return nil, fmt.Errorf("连接服务器 %s 失败: %v", c.address, err)
+	}
+	defer conn.Close()
+
+	// 取消时立即中断读取
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	sequence := c.nextSequence()
+	if _, err := conn.Write(newRequest(c.version, opcode, sequence, associationID, data)); err != nil {
+		return nil, fmt.Errorf("发送控制消息失败: %v", err)
+	}
+
+	var r reassembly
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("等待服务器 %s 的应答超时: %w", c.address, ctx.Err())
+			}
+			return nil, fmt.Errorf("读取控制消息应答失败: %v", err)
+		}
+
+		h, payload, err := parseFragment(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		// 忽略其它请求的应答
+		if h.flags&flagResponse == 0 || h.sequence != sequence || h.opcode != opcode {
+			continue
+		}
+		if h.flags&flagError != 0 {
+			return nil, &ControlError{Code: uint8(h.status >> 8)}
+		}
+
+		done, err := r.add(h, payload)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return r.data(), nil
+		}
+	}
+}
+
+// ReadVariables 读取系统（associationID为0）或某个关联的变量，相当于ntpq的readvar
+// names为空时读取服务器默认返回的所有变量
+func (c *Client) ReadVariables(ctx context.Context, associationID uint16, names ...string) (Variables, error) {
+	data, err := c.Query(ctx, OpReadVariables, associationID, []byte(strings.Join(names, ",")))
+	if err != nil {
+		return nil, err
+	}
+	return parseVariables(data), nil
+}
+
+// Associations 返回服务器的所有关联及其状态字，相当于ntpq的associations
+func (c *Client) Associations(ctx context.Context) ([]Association, error) {
+	data, err := c.Query(ctx, OpReadStatus, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseAssociations(data)
+}
+
+// Peers 返回服务器的对等体列表，相当于ntpq -p
+// 先读取所有关联，再逐个读取关联的变量
+func (c *Client) Peers(ctx context.Context) ([]Peer, error) {
+	assocs, err := c.Associations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]Peer, 0, len(assocs))
+	for _, assoc := range assocs {
+		vars, err := c.ReadVariables(ctx, assoc.ID)
+		if err != nil {
+			return nil, fmt.Errorf("读取关联%d的变量失败: %w", assoc.ID, err)
+		}
+		peers = append(peers, newPeer(assoc, vars))
+	}
+	return peers, nil
+}
+
+// newPeer 根据关联的变量构造对等体信息，无法解析的变量保持零值
+func newPeer(assoc Association, vars Variables) Peer {
+	p := Peer{
+		Association: assoc,
+		Address:     vars["srcadr"],
+		ReferenceID: vars["refid"],
+		Offset:      milliseconds(vars["offset"]),
+		Delay:       milliseconds(vars["delay"]),
+		Jitter:      milliseconds(vars["jitter"]),
+		Variables:   vars,
+	}
+	if port := vars["srcport"]; p.Address != "" && port != "" && port != defaultPort {
+		p.Address = net.JoinHostPort(p.Address, port)
+	}
+	p.Stratum, _ = strconv.Atoi(vars["stratum"])
+
+	// ntpd以十六进制返回可达性寄存器，ntpq以八进制显示
+	if reach, err := strconv.ParseUint(vars["reach"], 0, 8); err == nil {
+		p.Reach = uint8(reach)
+	} else if reach, err := strconv.ParseUint(vars["reach"], 8, 8); err == nil {
+		p.Reach = uint8(reach)
+	}
+	if hpoll, err := strconv.Atoi(vars["hpoll"]); err == nil && hpoll >= 0 && hpoll < 32 {
+		p.Poll = time.Second << uint(hpoll)
+	}
+	return p
+}
+
+// milliseconds 将以毫秒为单位的小数转换为时长
+func milliseconds(s string) time.Duration {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(v * float64(time.Millisecond))
+}
@@ -0,0 +1,208 @@
+package mode6
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// testServer 是一个模拟ntpd控制消息应答的测试服务器
+type testServer struct {
+	conn net.PacketConn
+
+	// vars 是每个关联ID的变量文本
+	vars map[uint16]string
+
+	// assocs 是READSTAT应答中的关联列表
+	assocs []Association
+
+	// fragment 不为0时，应答按该长度分片并倒序发送
+	fragment int
+}
+
+// newTestServer 创建并启动测试服务器
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听UDP端口失败: %v", err)
+	}
+	s := &testServer{conn: conn, vars: make(map[uint16]string)}
+	t.Cleanup(func() { _ = conn.Close() })
+	return s
+}
+
+// start 开始处理请求，必须在设置好应答内容之后调用
+func (s *testServer) start() {
+	go s.serve()
+}
+
+// addr 返回服务器地址
+func (s *testServer) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// serve 处理请求直到连接关闭
+func (s *testServer) serve() {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		h, _, err := parseFragment(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		var data []byte
+		var status uint16
+		flags := byte(flagResponse)
+		switch {
+		case h.opcode == OpReadStatus:
+			for _, a := range s.assocs {
+				data = binary.BigEndian.AppendUint16(data, a.ID)
+				data = binary.BigEndian.AppendUint16(data, a.Status)
+			}
+		case h.opcode == OpReadVariables:
+			text, ok := s.vars[h.associationID]
+			if !ok {
+				flags |= flagError
+				status = 4 << 8
+			}
+			data = []byte(text)
+		default:
+			flags |= flagError
+			status = 3 << 8
+		}
+
+		size := s.fragment
+		if size == 0 || size > len(data) {
+			size = len(data)
+		}
+		var replies [][]byte
+		for offset := 0; offset < len(data) || offset == 0; offset += size {
+			end := min(offset+size, len(data))
+			f := flags
+			if end < len(data) {
+				f |= flagMore
+			}
+			reply := newRequest(h.version, h.opcode, h.sequence, h.associationID, data[offset:end])
+			reply[1] |= f
+			binary.BigEndian.PutUint16(reply[4:6], status)
+			binary.BigEndian.PutUint16(reply[8:10], uint16(offset))
+			replies = append(replies, reply)
+			if end == len(data) {
+				break
+			}
+		}
+		for i := len(replies) - 1; i >= 0; i-- {
+			_, _ = s.conn.WriteTo(replies[i], addr)
+		}
+	}
+}
+
+// newTestClient 创建连接到测试服务器的客户端
+func newTestClient(t *testing.T, s *testServer) *Client {
+	t.Helper()
+
+	c, err := New(Options{Address: s.addr(), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	return c
+}
+
+// TestReadVariables 测试读取系统变量，字符串值中可以包含逗号
+func TestReadVariables(t *testing.T) {
+	s := newTestServer(t)
+	s.vars[0] = "version=\"ntpd 4.2.8p15, Ubuntu\", processor=\"x86_64\",\r\nleap=00, stratum=2, refid=192.168.1.1"
+	s.start()
+
+	vars, err := newTestClient(t, s).ReadVariables(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("读取系统变量失败: %v", err)
+	}
+
+	want := Variables{
+		"version":   "ntpd 4.2.8p15, Ubuntu",
+		"processor": "x86_64",
+		"leap":      "00",
+		"stratum":   "2",
+		"refid":     "192.168.1.1",
+	}
+	if len(vars) != len(want) {
+		t.Fatalf("预期%d个变量，实际得到%v", len(want), vars)
+	}
+	for name, value := range want {
+		if vars[name] != value {
+			t.Errorf("预期%s=%q，实际得到%q", name, value, vars[name])
+		}
+	}
+}
+
+// TestPeers 测试读取对等体列表以及分片应答的重组
+func TestPeers(t *testing.T) {
+	s := newTestServer(t)
+	s.fragment = 24
+	s.assocs = []Association{{ID: 1, Status: 0x961a}, {ID: 2, Status: 0x9424}}
+	s.vars[1] = "srcadr=192.168.1.1, srcport=123, stratum=1, refid=GPS, reach=0xff, hpoll=6, offset=-0.512, delay=1.250, jitter=0.031"
+	s.vars[2] = "srcadr=10.0.0.2, srcport=1123, stratum=3, refid=10.0.0.9, reach=0x3, hpoll=10, offset=2.000, delay=20.000, jitter=0.500"
+	s.start()
+
+	peers, err := newTestClient(t, s).Peers(context.Background())
+	if err != nil {
+		t.Fatalf("读取对等体失败: %v", err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("预期2个对等体，实际得到%d个", len(peers))
+	}
+
+	p := peers[0]
+	if p.Tally() != '*' || p.Address != "192.168.1.1" || p.ReferenceID != "GPS" || p.Stratum != 1 {
+		t.Errorf("预期系统对等体192.168.1.1，实际得到%+v", p)
+	}
+	if p.Reach != 0xff || p.Poll != 64*time.Second {
+		t.Errorf("预期可达性为377、轮询间隔为64秒，实际得到%o和%v", p.Reach, p.Poll)
+	}
+	if p.Offset != -512*time.Microsecond || p.Delay != 1250*time.Microsecond || p.Jitter != 31*time.Microsecond {
+		t.Errorf("预期偏移量、延迟和抖动按毫秒解析，实际得到%v、%v、%v", p.Offset, p.Delay, p.Jitter)
+	}
+
+	if p := peers[1]; p.Tally() != '+' || p.Address != "10.0.0.2:1123" || p.Reach != 3 {
+		t.Errorf("预期候选对等体10.0.0.2:1123，实际得到%+v", p)
+	}
+}
+
+// TestControlError 测试服务器返回的错误
+func TestControlError(t *testing.T) {
+	s := newTestServer(t)
+	s.start()
+
+	_, err := newTestClient(t, s).ReadVariables(context.Background(), 99)
+	var ce *ControlError
+	if !errors.As(err, &ce) || ce.Code != 4 {
+		t.Errorf("预期未知关联ID的错误，实际得到%v", err)
+	}
+}
+
+// TestQueryTimeout 测试服务器不应答时超时
+func TestQueryTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听UDP端口失败: %v", err)
+	}
+	defer conn.Close()
+
+	c, err := New(Options{Address: conn.LocalAddr().String(), Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	if _, err := c.Associations(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("预期超时，实际得到%v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package mode6
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// 控制消息的操作码
+const (
+	// OpReadStatus 读取状态，关联ID为0时返回所有关联的ID和状态字
+	OpReadStatus = 1
+
+	// OpReadVariables 读取系统（关联ID为0）或某个关联的变量
+	OpReadVariables = 2
+)
+
+// 控制消息的格式参数
+const (
+	// headerSize 是控制消息头的长度
+	headerSize = 12
+
+	// maxDataSize 是一个分片中数据的最大长度
+	maxDataSize = 468
+
+	// maxFragments 是一次应答最多的分片数量，与ntpq相同
+	maxFragments = 32
+
+	// 第二个字节中的应答(R)、错误(E)和后续分片(M)标志
+	flagResponse = 0x80
+	flagError    = 0x40
+	flagMore     = 0x20
+	opcodeMask   = 0x1f
+)
+
+// ErrInvalidResponse 表示应答格式无效
+var ErrInvalidResponse = errors.New("无效的控制消息应答")
+
+// ControlError 是服务器在应答中报告的错误
+type ControlError struct {
+	// Code 是错误码
+	Code uint8
+}
+
+// Error 实现error接口
+func (e *ControlError) Error() string {
+	switch e.Code {
+	case 1:
+		return "服务器返回错误: 认证失败"
+	case 2:
+		return "服务器返回错误: 消息格式无效"
+	case 3:
+		return "服务器返回错误: 无效的操作码"
+	case 4:
+		return "服务器返回错误: 未知的关联ID"
+	case 5:
+		return "服务器返回错误: 未知的变量名"
+	case 6:
+		return "服务器返回错误: 无效的变量值"
+	case 7:
+		return "服务器返回错误: 管理策略禁止"
+	default:
+		return fmt.Sprintf("服务器返回错误: 错误码%d", e.Code)
+	}
+}
+
+// header 是控制消息头
+type header struct {
+	version       ntpsync.NTPVersion
+	flags         byte
+	opcode        byte
+	sequence      uint16
+	status        uint16
+	associationID uint16
+	offset        uint16
+	count         uint16
+}
+
+// newRequest 创建一个控制消息请求，数据填充到4字节的整数倍
+func newRequest(version ntpsync.NTPVersion, opcode byte, sequence, associationID uint16, data []byte) []byte {
+	b := make([]byte, headerSize, headerSize+len(data)+3)
+	b[0] = byte(version)<<3 | byte(ntpsync.ControlMessage)
+	b[1] = opcode & opcodeMask
+	binary.BigEndian.PutUint16(b[2:4], sequence)
+	binary.BigEndian.PutUint16(b[6:8], associationID)
+	binary.BigEndian.PutUint16(b[10:12], uint16(len(data)))
+	b = append(b, data...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// parseFragment 解析一个应答分片，返回消息头和数据
+func parseFragment(b []byte) (header, []byte, error) {
+	if len(b) < headerSize {
+		return header{}, nil, fmt.Errorf("%w: 长度%d小于消息头", ErrInvalidResponse, len(b))
+	}
+	if ntpsync.NTPMode(b[0]&0x07) != ntpsync.ControlMessage {
+		return header{}, nil, fmt.Errorf("%w: 模式%d不是控制消息", ErrInvalidResponse, b[0]&0x07)
+	}
+
+	h := header{
+		version:       ntpsync.NTPVersion(b[0] >> 3 & 0x07),
+		flags:         b[1] &^ opcodeMask,
+		opcode:        b[1] & opcodeMask,
+		sequence:      binary.BigEndian.Uint16(b[2:4]),
+		status:        binary.BigEndian.Uint16(b[4:6]),
+		associationID: binary.BigEndian.Uint16(b[6:8]),
+		offset:        binary.BigEndian.Uint16(b[8:10]),
+		count:         binary.BigEndian.Uint16(b[10:12]),
+	}
+	if int(h.count) > len(b)-headerSize {
+		return header{}, nil, fmt.Errorf("%w: 数据长度%d超过分片长度", ErrInvalidResponse, h.count)
+	}
+	return h, b[headerSize : headerSize+int(h.count)], nil
+}
+
+// fragment 是应答中的一段数据
+type fragment struct {
+	offset int
+	data   []byte
+}
+
+// reassembly 按偏移量重组分片的应答
+type reassembly struct {
+	fragments []fragment
+	end       int
+	last      bool
+}
+
+// add 添加一个分片，所有分片都到齐时返回true
+func (r *reassembly) add(h header, data []byte) (bool, error) {
+	for _, f := range r.fragments {
+		if f.offset == int(h.offset) {
+			// 重复的分片
+			return r.complete(), nil
+		}
+	}
+	if len(r.fragments) >= maxFragments {
+		return false, fmt.Errorf("%w: 分片超过%d个", ErrInvalidResponse, maxFragments)
+	}
+
+	r.fragments = append(r.fragments, fragment{offset: int(h.offset), data: append([]byte(nil), data...)})
+	if h.flags&flagMore == 0 {
+		r.last = true
+		r.end = int(h.offset) + len(data)
+	}
+	return r.complete(), nil
+}
+
+// complete 判断是否收到了最后一个分片，并且从0到结尾没有空缺
+func (r *reassembly) complete() bool {
+	if !r.last {
+		return false
+	}
+	sort.Slice(r.fragments, func(i, j int) bool { return r.fragments[i].offset < r.fragments[j].offset })
+	next := 0
+	for _, f := range r.fragments {
+		if f.offset != next {
+			return false
+		}
+		next += len(f.data)
+	}
+	return next == r.end
+}
+
+// data 返回重组后的数据
+func (r *reassembly) data() []byte {
+	var b []byte
+	for _, f := range r.fragments {
+		b = append(b, f.data...)
+	}
+	return b
+}
+
+// Variables 是READVAR应答中的变量，值为服务器返回的文本，字符串值去掉了引号
+type Variables map[string]string
+
+// parseVariables 解析"name=value, name="string", ..."格式的变量列表
+// 字符串值中可以包含逗号
+func parseVariables(data []byte) Variables {
+	vars := make(Variables)
+	s := string(data)
+	for len(s) > 0 {
+		// 找到不在引号中的下一个逗号
+		end, quoted := len(s), false
+		for i := 0; i < len(s); i++ {
+			if s[i] == '"' {
+				quoted = !quoted
+			} else if s[i] == ',' && !quoted {
+				end = i
+				break
+			}
+		}
+		item := strings.Trim(s[:end], " \t\r\n\x00")
+		if end < len(s) {
+			s = s[end+1:]
+		} else {
+			s = ""
+		}
+		if item == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(item, "=")
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		vars[strings.TrimSpace(name)] = value
+	}
+	return vars
+}
+
+// Association 是READSTAT应答中的一个关联
+type Association struct {
+	// ID 是关联ID
+	ID uint16 `json:"id"`
+
+	// Status 是关联的对等体状态字
+	Status uint16 `json:"status"`
+}
+
+// Selection 返回状态字中的选择状态，0到7依次表示拒绝、虚假、多余、离群、候选、备份、系统对等体和PPS对等体
+func (a Association) Selection() int {
+	return int(a.Status >> 8 & 0x07)
+}
+
+// Tally 返回与ntpq -p第一列相同的选择状态标记，例如系统对等体为'*'
+func (a Association) Tally() byte {
+	return " x.-+#*o"[a.Selection()]
+}
+
+// parseAssociations 解析READSTAT应答中的关联ID和状态字
+func parseAssociations(data []byte) ([]Association, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("%w: 关联列表长度%d不是4的整数倍", ErrInvalidResponse, len(data))
+	}
+	assocs := make([]Association, 0, len(data)/4)
+	for i := 0; i < len(data); i += 4 {
+		assocs = append(assocs, Association{
+			ID:     binary.BigEndian.Uint16(data[i : i+2]),
+			Status: binary.BigEndian.Uint16(data[i+2 : i+4]),
+		})
+	}
+	return assocs, nil
+}
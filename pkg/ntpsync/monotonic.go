@@ -0,0 +1,167 @@
+package ntpsync
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// slewRate 是逐渐调整偏移量的最大速率，与ntpd相同为500ppm
+const slewRate = 500e-6
+
+// monotonicNow 将NTP偏移量锚定在单调时钟上
+//
+// 同步时记录本地时间（包含单调时钟读数），之后的NTP时间为
+// 锚定时的本地时间加上经过的时长和当时的有效偏移量。
+// time.Time.Sub在两个时间都包含单调时钟读数时使用单调时钟计算，
+// 因此系统时间被其它进程修改不会影响结果。
+//
+// 有效偏移量从start开始以slewRate的速率趋近target，
+// 直接调整(step)时两者相同。
+//
+// 锚定的参数不可变，修改时整体替换，now只读取原子指针，不需要加锁
+type monotonicNow struct {
+	anchored atomic.Pointer[monotonicAnchor]
+}
+
+// monotonicAnchor 是一次锚定的参数
+type monotonicAnchor struct {
+	// local 是锚定时的本地时间
+	local time.Time
+
+	// base 是锚定时的本地时间，不包含单调时钟读数
+	base time.Time
+
+	// start 是锚定时的有效偏移量
+	start time.Duration
+
+	// target 是最新测得的偏移量，用于发现偏移量的变化
+	target time.Duration
+
+	// last 是最后一次返回的时间（Unix纳秒），用于保证结果严格递增
+	last atomic.Int64
+}
+
+// newAnchor 创建锚定，last是之前返回的最晚时间
+func newAnchor(local, base time.Time, start, target time.Duration, last int64) *monotonicAnchor {
+	a := &monotonicAnchor{local: local, base: base, start: start, target: target}
+	a.last.Store(last)
+	return a
+}
+
+// update 以next返回的锚定替换当前的锚定，与并发的重新锚定冲突时重试
+// next返回nil时不做修改。沿用之前锚定的last时，替换期间返回的更晚时间也会被保留
+func (m *monotonicNow) update(next func(old *monotonicAnchor) *monotonicAnchor) {
+	for {
+		old := m.anchored.Load()
+		a := next(old)
+		if a == nil {
+			return
+		}
+		if m.anchored.CompareAndSwap(old, a) {
+			if old != nil && a.last.Load() != math.MinInt64 {
+				a.raiseLast(old.last.Load())
+			}
+			return
+		}
+	}
+}
+
+// anchor 以本地时间local和偏移量offset重新锚定，立即采用新的偏移量
+// 新的偏移量可能比原来小，重新锚定后允许时间回退一次
+func (m *monotonicNow) anchor(local time.Time, offset time.Duration) {
+	m.anchored.Store(newAnchor(local, local.Round(0), offset, offset, math.MinInt64))
+}
+
+// slew 以本地时间local重新锚定，有效偏移量从当前值逐渐调整到offset，时间不会回退
+func (m *monotonicNow) slew(local time.Time, offset time.Duration) {
+	m.update(func(old *monotonicAnchor) *monotonicAnchor {
+		if old == nil {
+			return newAnchor(local, local.Round(0), offset, offset, math.MinInt64)
+		}
+		start := old.effective(local.Sub(old.local))
+		return newAnchor(local, local.Round(0), start, offset, old.last.Load())
+	})
+}
+
+// resume 将锚定时间提前gap，使锚定后经过的时长计入单调时钟没有计算的休眠时长
+func (m *monotonicNow) resume(gap time.Duration) {
+	m.update(func(old *monotonicAnchor) *monotonicAnchor {
+		if old == nil {
+			return nil
+		}
+		return newAnchor(old.local.Add(-gap), old.base, old.start, old.target, old.last.Load())
+	})
+}
+
+// effective 返回锚定后经过elapsed时的有效偏移量
+func (a *monotonicAnchor) effective(elapsed time.Duration) time.Duration {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	delta := a.target - a.start
+	limit := time.Duration(float64(elapsed) * slewRate)
+	switch {
+	case delta > limit:
+		return a.start + limit
+	case delta < -limit:
+		return a.start - limit
+	default:
+		return a.target
+	}
+}
+
+// raiseLast 将last提高到至少t
+func (a *monotonicAnchor) raiseLast(t int64) {
+	for {
+		last := a.last.Load()
+		if last >= t || a.last.CompareAndSwap(last, t) {
+			return
+		}
+	}
+}
+
+// now 返回本地时间为local时的NTP时间
+// 偏移量与锚定时不同时以当前时间重新锚定
+func (m *monotonicNow) now(local time.Time, offset time.Duration) time.Time {
+	a := m.anchored.Load()
+	for a == nil || offset != a.target {
+		next := newAnchor(local, local.Round(0), offset, offset, math.MinInt64)
+		if m.anchored.CompareAndSwap(a, next) {
+			a = next
+			break
+		}
+		a = m.anchored.Load()
+	}
+	return a.now(local)
+}
+
+// at 返回本地时间为local时以此锚定计算的NTP时间，不保证严格递增
+func (a *monotonicAnchor) at(local time.Time) time.Time {
+	elapsed := local.Sub(a.local)
+	return a.base.Add(elapsed + a.effective(elapsed))
+}
+
+// now 返回本地时间为local时以此锚定计算的NTP时间
+// 结果不大于上次返回的时间时（例如假时钟没有前进），返回上次的时间加1纳秒
+func (a *monotonicAnchor) now(local time.Time) time.Time {
+	t := a.at(local)
+	for {
+		last := a.last.Load()
+		if ns := t.UnixNano(); ns <= last {
+			t = t.Add(time.Duration(last + 1 - ns))
+		}
+		if a.last.CompareAndSwap(last, t.UnixNano()) {
+			return t
+		}
+	}
+}
+
+// pending 返回本地时间为local时尚未完成的逐渐调整量
+func (m *monotonicNow) pending(local time.Time) time.Duration {
+	a := m.anchored.Load()
+	if a == nil {
+		return 0
+	}
+	return absDuration(a.target - a.effective(local.Sub(a.local)))
+}
@@ -0,0 +1,176 @@
+package ntpsync
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestNowStrictlyIncreasing 测试本地时钟没有前进时Now仍然严格递增
+func TestNowStrictlyIncreasing(t *testing.T) {
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: newFakeClock()})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	prev := ntp.Now()
+	for i := 0; i < 100; i++ {
+		now := ntp.Now()
+		if !now.After(prev) {
+			t.Fatalf("预期%v晚于%v", now, prev)
+		}
+		prev = now
+	}
+}
+
+// TestNowAnchor 测试Now以同步时锚定的时间为基准，偏移量调小时允许回退
+func TestNowAnchor(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: clock})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: 2 * time.Second}); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	clock.Advance(10 * time.Second)
+	if got, want := ntp.Now(), clock.Now().Add(2*time.Second); got != want {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+
+	before := ntp.Now()
+	if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: time.Second}); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if got, want := ntp.Now(), clock.Now().Add(time.Second); got != want || !got.Before(before) {
+		t.Errorf("预期偏移量调小后回退到%v，实际得到%v", want, got)
+	}
+
+	// 直接修改偏移量时以修改后的值重新锚定
+	ntp.mutex.Lock()
+	ntp.timeOffset = 5 * time.Second
+	ntp.publishLocked()
+	ntp.mutex.Unlock()
+	if got, want := ntp.Now(), clock.Now().Add(5*time.Second); got != want {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+}
+
+// TestNowLockFree 测试同步之后Now不需要获取实例的锁
+func TestNowLockFree(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: clock})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: time.Second}); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 模拟同步goroutine长时间持有写锁
+	ntp.mutex.Lock()
+	done := make(chan time.Time, 1)
+	go func() { done <- ntp.Now() }()
+	select {
+	case got := <-done:
+		if want := clock.Now().Add(time.Second); got != want {
+			t.Errorf("预期%v，实际得到%v", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("持有写锁时Now被阻塞")
+	}
+	ntp.mutex.Unlock()
+}
+
+// TestNowConcurrentSync 测试同步期间并发调用Now的结果仍然严格递增
+func TestNowConcurrentSync(t *testing.T) {
+	ntp, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		StepThreshold:    time.Second,
+		OutlierThreshold: -1,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: time.Millisecond}); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			prev := ntp.Now()
+			for {
+				select {
+				case <-stop:
+					errs <- nil
+					return
+				default:
+				}
+				now := ntp.Now()
+				if !now.After(prev) {
+					errs <- fmt.Errorf("%v不晚于%v", now, prev)
+					return
+				}
+				prev = now
+			}
+		}()
+	}
+
+	// 逐渐调整的偏移量不会使时间回退
+	for i := 0; i < 100; i++ {
+		src := &fakeSource{offset: time.Duration(i%10) * time.Millisecond}
+		if err := ntp.SyncWithSource(context.Background(), src); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+	}
+	close(stop)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// BenchmarkNow 测量同步goroutine频繁持有写锁时并发调用Now的耗时
+func BenchmarkNow(b *testing.B) {
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}})
+	if err != nil {
+		b.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: time.Millisecond}); err != nil {
+		b.Fatalf("同步失败: %v", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			ntp.mutex.Lock()
+			ntp.publishLocked()
+			ntp.mutex.Unlock()
+		}
+	}()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ntp.Now()
+		}
+	})
+}
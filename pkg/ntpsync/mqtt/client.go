@@ -0,0 +1,277 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// errConnectionLost 表示与代理的连接已断开
+var errConnectionLost = errors.New("与MQTT代理的连接已断开")
+
+// dialOptions 是建立连接所需的参数
+type dialOptions struct {
+	broker    string
+	tlsConfig *tls.Config
+	connect   connectOptions
+	keepAlive time.Duration
+}
+
+// client 是一个只发布消息的MQTT 3.1.1连接
+type client struct {
+	conn net.Conn
+
+	writeMutex sync.Mutex
+
+	mutex   sync.Mutex
+	nextID  uint16
+	pending map[uint16]chan struct{}
+	err     error
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// brokerAddress 解析代理地址，返回TCP地址和是否使用TLS
+// 支持tcp://、mqtt://、tls://、ssl://和mqtts://，省略端口时使用1883或8883
+func brokerAddress(broker string) (string, bool, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("无效的MQTT代理地址 %q", broker)
+	}
+
+	var secure bool
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "tls", "ssl", "mqtts":
+		secure = true
+	default:
+		return "", false, fmt.Errorf("不支持的MQTT代理协议 %q", u.Scheme)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if secure {
+			port = "8883"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return host, secure, nil
+}
+
+// dial 连接代理并完成CONNECT握手
+func dial(ctx context.Context, opts dialOptions) (*client, error) {
+	addr, secure, err := brokerAddress(opts.broker)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if secure {
+		config := opts.tlsConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		dialer := &tls.Dialer{Config: config}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接MQTT代理失败: %v", err)
+	}
+
+	c := &client{
+		conn:    conn,
+		pending: make(map[uint16]chan struct{}),
+		done:    make(chan struct{}),
+	}
+	reader := bufio.NewReader(conn)
+	if err := c.handshake(ctx, reader, opts.connect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c.wg.Add(2)
+	go c.read(reader, opts.keepAlive)
+	go c.ping(opts.keepAlive)
+	return c, nil
+}
+
+// handshake 发送CONNECT并等待CONNACK
+func (c *client) handshake(ctx context.Context, reader *bufio.Reader, opts connectOptions) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	b, err := encodeConnect(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		return fmt.Errorf("发送CONNECT失败: %v", err)
+	}
+
+	p, err := readPacket(reader)
+	if err != nil {
+		return fmt.Errorf("读取CONNACK失败: %v", err)
+	}
+	if p.kind != packetConnAck || len(p.body) != 2 {
+		return fmt.Errorf("预期CONNACK，实际收到报文类型%d", p.kind)
+	}
+	if err := connAckError(p.body[1]); err != nil {
+		return fmt.Errorf("MQTT代理拒绝连接: %w", err)
+	}
+	return nil
+}
+
+// read 读取代理发来的报文，处理PUBACK，超过保活时间没有收到任何报文时断开连接
+func (c *client) read(reader *bufio.Reader, keepAlive time.Duration) {
+	defer c.wg.Done()
+
+	for {
+		if keepAlive > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		}
+		p, err := readPacket(reader)
+		if err != nil {
+			c.fail(fmt.Errorf("%w: %v", errConnectionLost, err))
+			return
+		}
+		if p.kind == packetPubAck && len(p.body) >= 2 {
+			id := uint16(p.body[0])<<8 | uint16(p.body[1])
+			c.mutex.Lock()
+			if ack, ok := c.pending[id]; ok {
+				close(ack)
+				delete(c.pending, id)
+			}
+			c.mutex.Unlock()
+		}
+	}
+}
+
+// ping 每半个保活周期发送一次PINGREQ
+func (c *client) ping(keepAlive time.Duration) {
+	defer c.wg.Done()
+
+	if keepAlive <= 0 {
+		<-c.done
+		return
+	}
+
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write([]byte{packetPingReq << 4, 0}); err != nil {
+				c.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// write 发送一个完整的报文
+func (c *client) write(b []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if _, err := c.conn.Write(b); err != nil {
+		return fmt.Errorf("%w: %v", errConnectionLost, err)
+	}
+	return nil
+}
+
+// fail 记录第一个连接错误并通知所有等待者
+func (c *client) fail(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	c.conn.Close()
+}
+
+// publish 发布一条消息，QoS为1时等待代理确认
+func (c *client) publish(ctx context.Context, topic string, payload []byte, qos byte, retain bool) error {
+	var id uint16
+	var ack chan struct{}
+	if qos > 0 {
+		c.mutex.Lock()
+		if c.err != nil {
+			err := c.err
+			c.mutex.Unlock()
+			return err
+		}
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+		id = c.nextID
+		ack = make(chan struct{})
+		c.pending[id] = ack
+		c.mutex.Unlock()
+
+		defer func() {
+			c.mutex.Lock()
+			delete(c.pending, id)
+			c.mutex.Unlock()
+		}()
+	}
+
+	b, err := encodePublish(topic, payload, qos, retain, id)
+	if err != nil {
+		return err
+	}
+	if err := c.write(b); err != nil {
+		c.fail(err)
+		return err
+	}
+	if ack == nil {
+		return nil
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-c.done:
+		return c.closeErr()
+	case <-ctx.Done():
+		return fmt.Errorf("等待PUBACK超时: %v", ctx.Err())
+	}
+}
+
+// closeErr 返回导致连接断开的错误
+func (c *client) closeErr() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.err
+}
+
+// lost 返回连接断开时关闭的通道
+func (c *client) lost() <-chan struct{} {
+	return c.done
+}
+
+// disconnect 发送DISCONNECT并关闭连接，代理不会发布遗嘱消息
+func (c *client) disconnect() {
+	_ = c.write([]byte{packetDisconnect << 4, 0})
+	c.fail(errConnectionLost)
+	c.wg.Wait()
+}
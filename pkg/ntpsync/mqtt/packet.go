@@ -0,0 +1,186 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1控制报文类型
+const (
+	packetConnect    = 1
+	packetConnAck    = 2
+	packetPublish    = 3
+	packetPubAck     = 4
+	packetPingReq    = 12
+	packetPingResp   = 13
+	packetDisconnect = 14
+)
+
+// CONNECT报文的连接标志
+const (
+	flagCleanSession = 0x02
+	flagWill         = 0x04
+	flagWillRetain   = 0x20
+	flagPassword     = 0x40
+	flagUsername     = 0x80
+)
+
+// maxRemainingLength 是剩余长度字段能表示的最大值
+const maxRemainingLength = 268435455
+
+// connectOptions 是编码CONNECT报文所需的参数
+type connectOptions struct {
+	clientID    string
+	username    string
+	password    string
+	keepAlive   uint16
+	willTopic   string
+	willPayload []byte
+	willQoS     byte
+	willRetain  bool
+}
+
+// packet 是读取到的一个控制报文
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// appendString 追加带两字节长度前缀的UTF-8字符串
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendBytes 追加带两字节长度前缀的二进制数据
+func appendBytes(b []byte, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// frame 为可变头和载荷加上固定头
+func frame(kind, flags byte, body []byte) ([]byte, error) {
+	if len(body) > maxRemainingLength {
+		return nil, fmt.Errorf("MQTT报文过长: %d字节", len(body))
+	}
+
+	b := make([]byte, 0, len(body)+5)
+	b = append(b, kind<<4|flags)
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...), nil
+}
+
+// encodeConnect 编码CONNECT报文
+func encodeConnect(opts connectOptions) ([]byte, error) {
+	b := appendString(nil, "MQTT")
+	b = append(b, 4) // 协议级别：3.1.1
+
+	flags := byte(flagCleanSession)
+	if opts.willTopic != "" {
+		flags |= flagWill | opts.willQoS<<3
+		if opts.willRetain {
+			flags |= flagWillRetain
+		}
+	}
+	if opts.username != "" {
+		flags |= flagUsername
+		if opts.password != "" {
+			flags |= flagPassword
+		}
+	}
+	b = append(b, flags)
+	b = binary.BigEndian.AppendUint16(b, opts.keepAlive)
+
+	b = appendString(b, opts.clientID)
+	if opts.willTopic != "" {
+		b = appendString(b, opts.willTopic)
+		b = appendBytes(b, opts.willPayload)
+	}
+	if opts.username != "" {
+		b = appendString(b, opts.username)
+		if opts.password != "" {
+			b = appendString(b, opts.password)
+		}
+	}
+	return frame(packetConnect, 0, b)
+}
+
+// encodePublish 编码PUBLISH报文，QoS为0时忽略packetID
+func encodePublish(topic string, payload []byte, qos byte, retain bool, packetID uint16) ([]byte, error) {
+	flags := qos << 1
+	if retain {
+		flags |= 0x01
+	}
+
+	b := appendString(make([]byte, 0, len(topic)+len(payload)+4), topic)
+	if qos > 0 {
+		b = binary.BigEndian.AppendUint16(b, packetID)
+	}
+	b = append(b, payload...)
+	return frame(packetPublish, flags, b)
+}
+
+// readPacket 读取一个控制报文
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	var length, multiplier int = 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return packet{}, errors.New("无效的MQTT剩余长度")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// connAckError 将CONNACK的返回码转换为错误
+func connAckError(code byte) error {
+	switch code {
+	case 0:
+		return nil
+	case 1:
+		return errors.New("代理不支持MQTT 3.1.1")
+	case 2:
+		return errors.New("代理拒绝了客户端标识")
+	case 3:
+		return errors.New("MQTT服务不可用")
+	case 4:
+		return errors.New("用户名或密码错误")
+	case 5:
+		return errors.New("客户端未被授权")
+	default:
+		return fmt.Errorf("未知的CONNACK返回码%d", code)
+	}
+}
@@ -0,0 +1,289 @@
+// Package mqtt 将同步状态发布到MQTT代理，与设备的其它遥测数据一起上报时钟健康状况。
+//
+// Publisher通过一个只发布消息的MQTT 3.1.1连接工作，支持TLS和遗嘱消息(LWT)：
+// 状态以JSON发布到Topic，每次同步完成和每个Interval各发布一次；
+// 在线状态以保留消息发布到AvailabilityTopic，连接时为"online"，
+// 连接异常断开时由代理发布遗嘱消息"offline"。
+//
+//	pub, err := mqtt.New(ntp, mqtt.Options{
+//	    Broker: "tls://broker.example.com:8883",
+//	    Topic:  "devices/gw-001/clock",
+//	})
+//	go pub.Run(ctx)
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// 默认配置
+const (
+	DefaultInterval      = time.Minute
+	DefaultKeepAlive     = 60 * time.Second
+	DefaultTimeout       = 10 * time.Second
+	DefaultRetryInterval = 10 * time.Second
+)
+
+// 在线状态消息的内容
+const (
+	PayloadOnline  = "online"
+	PayloadOffline = "offline"
+)
+
+// Options 包含Publisher的配置选项
+type Options struct {
+	// Broker 是MQTT代理的地址，例如"tcp://broker:1883"或"tls://broker:8883"
+	Broker string
+
+	// TLSConfig 是tls://等加密连接使用的TLS配置，nil表示使用系统根证书
+	TLSConfig *tls.Config
+
+	// ClientID 是MQTT客户端标识，为空时使用"ntpsync-"加主机名
+	ClientID string
+
+	// Username 和 Password 是连接代理的凭据
+	Username string
+	Password string
+
+	// Topic 是发布同步状态的主题
+	Topic string
+
+	// AvailabilityTopic 是发布在线状态和遗嘱消息的主题，为空时使用Topic+"/availability"
+	AvailabilityTopic string
+
+	// QoS 是发布消息的服务质量等级，支持0和1
+	QoS byte
+
+	// Retain 表示同步状态是否作为保留消息发布
+	Retain bool
+
+	// Interval 是定时发布状态的间隔
+	Interval time.Duration
+
+	// MaxAge 是认为同步仍然健康的最长时间，零值表示使用两倍的同步间隔
+	MaxAge time.Duration
+
+	// KeepAlive 是MQTT保活时间
+	KeepAlive time.Duration
+
+	// Timeout 是连接和等待确认的超时时间
+	Timeout time.Duration
+
+	// RetryInterval 是连接断开后重新连接的等待时间
+	RetryInterval time.Duration
+
+	// OnError 接收连接和发布过程中的错误，可以为nil
+	OnError func(error)
+}
+
+// Status 是发布到Topic的同步状态
+type Status struct {
+	// ClientID 是发布状态的客户端标识，用于区分设备
+	ClientID string `json:"client_id"`
+
+	// Time 是经NTP调整后的当前时间
+	Time time.Time `json:"time"`
+
+	// Offset 是当前的时间偏移量
+	Offset time.Duration `json:"offset"`
+
+	// LastSync 是最后一次成功同步的时间
+	LastSync time.Time `json:"last_sync"`
+
+	// Healthy 表示最后一次成功同步是否在MaxAge之内
+	Healthy bool `json:"healthy"`
+
+	// Servers 是多服务器模式下缓存的服务器状态，包含健康评分
+	Servers []ntpsync.ServerStatus `json:"servers,omitempty"`
+}
+
+// MarshalJSON 实现json.Marshaler，时长编码为易读字符串，零值时间编码为null
+func (s Status) MarshalJSON() ([]byte, error) {
+	type alias Status
+	var lastSync *time.Time
+	if !s.LastSync.IsZero() {
+		lastSync = &s.LastSync
+	}
+	return json.Marshal(struct {
+		alias
+		Offset   string     `json:"offset"`
+		LastSync *time.Time `json:"last_sync"`
+	}{
+		alias:    alias(s),
+		Offset:   s.Offset.String(),
+		LastSync: lastSync,
+	})
+}
+
+// Publisher 将同步状态发布到MQTT代理
+type Publisher struct {
+	ntp  *ntpsync.NTPSync
+	opts Options
+}
+
+// New 创建一个发布同步状态的Publisher，调用Run开始发布
+func New(n *ntpsync.NTPSync, opts Options) (*Publisher, error) {
+	if n == nil {
+		return nil, errors.New("必须提供NTPSync实例")
+	}
+	if _, _, err := brokerAddress(opts.Broker); err != nil {
+		return nil, err
+	}
+	if opts.Topic == "" {
+		return nil, errors.New("必须提供MQTT主题")
+	}
+	if opts.QoS > 1 {
+		return nil, fmt.Errorf("不支持的QoS等级%d", opts.QoS)
+	}
+
+	if opts.ClientID == "" {
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "unknown"
+		}
+		opts.ClientID = "ntpsync-" + host
+	}
+	if opts.AvailabilityTopic == "" {
+		opts.AvailabilityTopic = opts.Topic + "/availability"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+
+	return &Publisher{ntp: n, opts: opts}, nil
+}
+
+// Status 返回当前的同步状态
+func (p *Publisher) Status() Status {
+	status := Status{
+		ClientID: p.opts.ClientID,
+		Time:     p.ntp.Now(),
+		Offset:   p.ntp.TimeOffsetDuration(),
+		LastSync: p.ntp.LastSyncTime(),
+		Healthy:  p.ntp.IsSynchronized(p.opts.MaxAge),
+	}
+
+	// 仅使用已缓存的服务器状态，避免每次发布都探测服务器
+	if statuses, err := p.ntp.GetCachedServerStatuses(); err == nil {
+		status.Servers = statuses
+	}
+	return status
+}
+
+// Run 连接代理并持续发布同步状态，直到ctx被取消
+// 连接断开后等待RetryInterval重新连接，错误交给OnError
+// ctx被取消时发布"offline"并正常断开，返回ctx.Err()
+func (p *Publisher) Run(ctx context.Context) error {
+	events, unsubscribe := p.ntp.Subscribe(0)
+	defer unsubscribe()
+
+	for {
+		err := p.session(ctx, events)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p.report(err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.opts.RetryInterval):
+		}
+	}
+}
+
+// session 建立一次连接并发布状态，直到连接断开或ctx被取消
+func (p *Publisher) session(ctx context.Context, events <-chan ntpsync.Event) error {
+	dialCtx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	c, err := dial(dialCtx, dialOptions{
+		broker:    p.opts.Broker,
+		tlsConfig: p.opts.TLSConfig,
+		keepAlive: p.opts.KeepAlive,
+		connect: connectOptions{
+			clientID:    p.opts.ClientID,
+			username:    p.opts.Username,
+			password:    p.opts.Password,
+			keepAlive:   uint16(p.opts.KeepAlive / time.Second),
+			willTopic:   p.opts.AvailabilityTopic,
+			willPayload: []byte(PayloadOffline),
+			willQoS:     p.opts.QoS,
+			willRetain:  true,
+		},
+	})
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer c.disconnect()
+
+	if err := p.publish(c, p.opts.AvailabilityTopic, []byte(PayloadOnline), true); err != nil {
+		return err
+	}
+	if err := p.publishStatus(c); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// 正常断开时代理不发布遗嘱消息，需要主动发布离线状态
+			_ = p.publish(c, p.opts.AvailabilityTopic, []byte(PayloadOffline), true)
+			return ctx.Err()
+		case <-c.lost():
+			return c.closeErr()
+		case ev := <-events:
+			if ev.Type != ntpsync.EventSyncSucceeded && ev.Type != ntpsync.EventSyncFailed {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		if err := p.publishStatus(c); err != nil {
+			return err
+		}
+	}
+}
+
+// publishStatus 发布当前的同步状态
+func (p *Publisher) publishStatus(c *client) error {
+	payload, err := json.Marshal(p.Status())
+	if err != nil {
+		return fmt.Errorf("编码同步状态失败: %v", err)
+	}
+	return p.publish(c, p.opts.Topic, payload, p.opts.Retain)
+}
+
+// publish 以配置的QoS发布一条消息
+func (p *Publisher) publish(c *client, topic string, payload []byte, retain bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+	defer cancel()
+
+	return c.publish(ctx, topic, payload, p.opts.QoS, retain)
+}
+
+// report 将错误交给OnError
+func (p *Publisher) report(err error) {
+	if err != nil && p.opts.OnError != nil {
+		p.opts.OnError(err)
+	}
+}
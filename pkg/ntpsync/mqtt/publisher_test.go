@@ -0,0 +1,257 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntpsynctest"
+)
+
+// message 是测试代理收到的一条PUBLISH消息
+type message struct {
+	topic   string
+	payload string
+	qos     byte
+	retain  bool
+}
+
+// testBroker 是一个只接受发布消息的测试MQTT代理
+type testBroker struct {
+	listener net.Listener
+	connects chan []byte
+	messages chan message
+}
+
+// newTestBroker 创建测试代理，tlsConfig非nil时使用TLS
+func newTestBroker(t *testing.T, tlsConfig *tls.Config) *testBroker {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听TCP端口失败: %v", err)
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	b := &testBroker{
+		listener: l,
+		connects: make(chan []byte, 4),
+		messages: make(chan message, 64),
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+// serve 处理一个客户端连接
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		p, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+		switch p.kind {
+		case packetConnect:
+			b.connects <- p.body
+			_, _ = conn.Write([]byte{packetConnAck << 4, 2, 0, 0})
+		case packetPublish:
+			qos := p.flags >> 1 & 0x03
+			n := int(binary.BigEndian.Uint16(p.body))
+			m := message{topic: string(p.body[2 : 2+n]), qos: qos, retain: p.flags&0x01 != 0}
+			rest := p.body[2+n:]
+			if qos > 0 {
+				_, _ = conn.Write([]byte{packetPubAck << 4, 2, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+			m.payload = string(rest)
+			b.messages <- m
+		case packetPingReq:
+			_, _ = conn.Write([]byte{packetPingResp << 4, 0})
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+// next 返回下一条消息
+func (b *testBroker) next(t *testing.T) message {
+	t.Helper()
+
+	select {
+	case m := <-b.messages:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("等待MQTT消息超时")
+		return message{}
+	}
+}
+
+// staticSource 是总是返回固定偏移量的时间源
+type staticSource time.Duration
+
+func (s staticSource) Name() string { return "static" }
+
+func (s staticSource) Measure(ctx context.Context) (*ntpsync.SyncResult, error) {
+	return &ntpsync.SyncResult{Time: time.Now(), Offset: time.Duration(s)}, nil
+}
+
+// TestRemainingLength 测试剩余长度的变长编码
+func TestRemainingLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097152} {
+		b, err := frame(packetPublish, 0, make([]byte, n))
+		if err != nil {
+			t.Fatalf("编码%d字节的报文失败: %v", n, err)
+		}
+		p, err := readPacket(bufio.NewReader(bytes.NewReader(b)))
+		if err != nil {
+			t.Fatalf("解析%d字节的报文失败: %v", n, err)
+		}
+		if len(p.body) != n || p.kind != packetPublish {
+			t.Errorf("预期%d字节的PUBLISH，实际得到类型%d长度%d", n, p.kind, len(p.body))
+		}
+	}
+}
+
+// TestPublish 测试连接时的遗嘱消息、状态发布和正常断开时的离线状态
+func TestPublish(t *testing.T) {
+	broker := newTestBroker(t, nil)
+	ntp, _ := ntpsynctest.NewSyncedClient(t)
+
+	pub, err := New(ntp, Options{
+		Broker:   "tcp://" + broker.listener.Addr().String(),
+		ClientID: "gw-001",
+		Username: "user",
+		Password: "secret",
+		Topic:    "devices/gw-001/clock",
+		QoS:      1,
+		Retain:   true,
+		OnError:  func(err error) { t.Errorf("发布失败: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("创建Publisher失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- pub.Run(ctx) }()
+
+	connect := <-broker.connects
+	flags := connect[7]
+	if flags&(flagWill|flagWillRetain|flagUsername|flagPassword) != flagWill|flagWillRetain|flagUsername|flagPassword {
+		t.Errorf("CONNECT的连接标志错误: %#x", flags)
+	}
+
+	if m := broker.next(t); m.topic != "devices/gw-001/clock/availability" || m.payload != PayloadOnline || !m.retain {
+		t.Errorf("预期保留的在线状态，实际得到%+v", m)
+	}
+
+	m := broker.next(t)
+	if m.topic != "devices/gw-001/clock" || m.qos != 1 || !m.retain {
+		t.Errorf("状态消息的主题或标志错误: %+v", m)
+	}
+	var status struct {
+		ClientID string `json:"client_id"`
+		Offset   string `json:"offset"`
+		Healthy  bool   `json:"healthy"`
+	}
+	if err := json.Unmarshal([]byte(m.payload), &status); err != nil {
+		t.Fatalf("解析状态消息失败: %v", err)
+	}
+	offset, err := time.ParseDuration(status.Offset)
+	if err != nil || offset < 900*time.Millisecond || offset > 1100*time.Millisecond {
+		t.Errorf("预期偏移量约为1秒，实际得到%q", status.Offset)
+	}
+	if status.ClientID != "gw-001" || !status.Healthy {
+		t.Errorf("状态错误: %+v", status)
+	}
+
+	// 同步完成后立即发布新的状态
+	if err := ntp.SyncWithSource(context.Background(), staticSource(time.Second)); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if m := broker.next(t); m.topic != "devices/gw-001/clock" {
+		t.Errorf("预期同步后发布状态，实际得到%+v", m)
+	}
+
+	cancel()
+	if m := broker.next(t); m.topic != "devices/gw-001/clock/availability" || m.payload != PayloadOffline {
+		t.Errorf("预期离线状态，实际得到%+v", m)
+	}
+	if err := <-done; err != context.Canceled {
+		t.Errorf("预期返回context.Canceled，实际得到%v", err)
+	}
+}
+
+// TestPublishTLS 测试通过TLS连接代理
+func TestPublishTLS(t *testing.T) {
+	// 借用httptest生成的自签名证书
+	cert := httptest.NewUnstartedServer(http.NotFoundHandler())
+	cert.StartTLS()
+	defer cert.Close()
+
+	broker := newTestBroker(t, cert.TLS)
+	ntp, _ := ntpsynctest.NewSyncedClient(t)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Certificate())
+	pub, err := New(ntp, Options{
+		Broker:    "tls://" + broker.listener.Addr().String(),
+		TLSConfig: &tls.Config{RootCAs: roots},
+		Topic:     "clock",
+	})
+	if err != nil {
+		t.Fatalf("创建Publisher失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pub.Run(ctx)
+
+	if m := broker.next(t); m.topic != "clock/availability" || m.payload != PayloadOnline {
+		t.Errorf("预期在线状态，实际得到%+v", m)
+	}
+}
+
+// TestNewInvalid 测试无效的配置
+func TestNewInvalid(t *testing.T) {
+	ntp, err := ntpsync.New(ntpsync.Options{Servers: []string{"127.0.0.1:1"}})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	for _, opts := range []Options{
+		{Broker: "broker:1883", Topic: "clock"},
+		{Broker: "ws://broker", Topic: "clock"},
+		{Broker: "tcp://broker"},
+		{Broker: "tcp://broker", Topic: "clock", QoS: 2},
+	} {
+		if _, err := New(ntp, opts); err == nil {
+			t.Errorf("预期%+v无效", opts)
+		}
+	}
+}
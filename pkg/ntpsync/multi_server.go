@@ -4,51 +4,39 @@ import (
 	"errors"
 	"fmt"
 	"sync"
-	"time"
 )
 
 // SyncWithMultiServer 执行与多个NTP服务器的同步
 // 按照优先顺序尝试服务器，并使用第一个成功的服务器
 func (n *NTPSync) SyncWithMultiServer() error {
-	n.mutex.Lock()
-	servers := make([]string, len(n.Servers))
-	copy(servers, n.Servers)
-	timeout := n.Timeout
-	n.mutex.Unlock()
-
-	if len(servers) == 0 {
-		return errors.New("未配置NTP服务器")
+	servers, timeout, err := n.syncTargets()
+	if err != nil {
+		return err
 	}
 
 	// 按顺序尝试每个服务器
-	var lastErr error
-	for _, server := range servers {
-		result, err := n.syncWithServerBinary(server, timeout)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-
-		// 成功与此服务器同步
-		n.mutex.Lock()
-		n.TimeOffset = result.Offset
-		n.LastSync = time.Now()
-		n.mutex.Unlock()
-		
-		return nil
+	result, err := n.measureServers(servers, timeout)
+	if err != nil {
+		n.syncFailed(err)
+		return err
 	}
 
-	// 如果执行到这里，说明所有服务器都失败了
-	return fmt.Errorf("无法与任何NTP服务器同步: %v", lastErr)
+	// 成功与此服务器同步
+	return n.applyResult(result)
 }
 
 // SyncWithMultiServerParallel 并行执行与多个NTP服务器的同步
-// 同时尝试所有服务器，并使用响应最快的服务器的结果
+// 同时尝试所有服务器（不超过Options.MaxConcurrentProbes个请求同时进行），
+// 并使用响应最快的服务器的结果
 func (n *NTPSync) SyncWithMultiServerParallel() error {
 	n.mutex.Lock()
-	servers := make([]string, len(n.Servers))
-	copy(servers, n.Servers)
-	timeout := n.Timeout
+	if n.closed {
+		n.mutex.Unlock()
+		return ErrClosed
+	}
+	servers := make([]string, len(n.servers))
+	copy(servers, n.servers)
+	timeout := n.timeout
 	n.mutex.Unlock()
 
 	if len(servers) == 0 {
@@ -66,7 +54,7 @@ func (n *NTPSync) SyncWithMultiServerParallel() error {
 		go func(server string) {
 			defer wg.Done()
 			
-			result, err := n.syncWithServerBinary(server, timeout)
+			result, err := n.probeServer(server, timeout)
 			if err != nil {
 				errChan <- err
 				return
@@ -100,28 +88,30 @@ func (n *NTPSync) SyncWithMultiServerParallel() error {
 			lastErr = err
 		}
 		
+		err := errors.New("无法与任何NTP服务器同步")
 		if lastErr != nil {
-			return fmt.Errorf("无法与任何NTP服务器同步: %v", lastErr)
+			err = fmt.Errorf("无法与任何NTP服务器同步: %v", lastErr)
 		}
 		
-		return errors.New("无法与任何NTP服务器同步")
+		n.syncFailed(err)
+		return err
 	}
 	
 	// 成功同步
-	n.mutex.Lock()
-	n.TimeOffset = result.Offset
-	n.LastSync = time.Now()
-	n.mutex.Unlock()
-	
-	return nil
+	return n.applyResult(result)
 }
 
 // GetMultiServerStatus 返回所有已配置NTP服务器的状态
+// 并行探测所有服务器，同时进行的请求不超过Options.MaxConcurrentProbes个
 func (n *NTPSync) GetMultiServerStatus() ([]ServerStatus, error) {
 	n.mutex.RLock()
-	servers := make([]string, len(n.Servers))
-	copy(servers, n.Servers)
-	timeout := n.Timeout
+	if n.closed {
+		n.mutex.RUnlock()
+		return nil, ErrClosed
+	}
+	servers := make([]string, len(n.servers))
+	copy(servers, n.servers)
+	timeout := n.timeout
 	n.mutex.RUnlock()
 
 	if len(servers) == 0 {
@@ -142,15 +132,11 @@ func (n *NTPSync) GetMultiServerStatus() ([]ServerStatus, error) {
 				Address: server,
 			}
 			
-			result, err := n.syncWithServerBinary(server, timeout)
+			result, err := n.probeServer(server, timeout)
 			if err != nil {
 				status.Reachable = false
 			} else {
-				status.Reachable = true
-				status.LastResponse = time.Now()
-				status.RTT = result.RTT
-				status.Stratum = result.Stratum
-				status.Offset = result.Offset
+				status = n.measuredStatus(server, result)
 			}
 			
 			statusChan <- status
@@ -172,6 +158,16 @@ func (n *NTPSync) GetMultiServerStatus() ([]ServerStatus, error) {
 	return statuses, nil
 }
 
+// GetCachedServerStatuses 返回服务器管理器中缓存的服务器状态，不会探测服务器
+// 未启用多服务器支持时返回错误
+func (n *NTPSync) GetCachedServerStatuses() ([]ServerStatus, error) {
+	if n.serverManager == nil {
+		return nil, errors.New("未启用多服务器支持")
+	}
+	
+	return n.serverManager.GetAllServerStatuses(), nil
+}
+
 // UpdateNTPSyncWithMultiServer 更新NTPSync结构体以使用多服务器功能
 func (n *NTPSync) UpdateNTPSyncWithMultiServer() {
 	// 我们不能直接分配给方法，所以我们将使用一个包装函数
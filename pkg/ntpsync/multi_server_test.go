@@ -1,24 +1,30 @@
 package ntpsync
 
 import (
+	"slices"
 	"testing"
 	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
 )
 
 // TestSyncWithMultiServer 测试多服务器同步
-// 这是一个需要网络访问的集成测试
+// 第一个服务器不应答，应回退到第二个服务器
 func TestSyncWithMultiServer(t *testing.T) {
-	// 在短模式下跳过此测试
-	if testing.Short() {
-		t.Skip("在短模式下跳过多服务器同步测试")
-	}
+	down := ntptest.NewServer()
+	defer down.Close()
+	down.SetDrop(true)
+	
+	up := ntptest.NewServer()
+	defer up.Close()
+	up.SetOffset(2 * time.Second)
 	
 	ntp, err := New(Options{
 		Servers: []string{
-			"pool.ntp.org",
-			"time.google.com",
+			down.Addr(),
+			up.Addr(),
 		},
-		Timeout: 5 * time.Second,
+		Timeout: 200 * time.Millisecond,
 	})
 	
 	if err != nil {
@@ -26,38 +32,42 @@ func TestSyncWithMultiServer(t *testing.T) {
 	}
 	
 	// 与多个服务器同步
-	err = ntp.SyncWithMultiServer()
-	
-	// 如果网络不可靠，此测试可能会失败
-	// 我们只检查函数是否按预期工作
-	if err != nil {
-		t.Logf("多服务器同步失败: %v", err)
-		t.Skip("由于网络错误跳过")
+	if err := ntp.SyncWithMultiServer(); err != nil {
+		t.Fatalf("多服务器同步失败: %v", err)
 	}
 	
-	// 检查时间偏移量是否已设置
-	if ntp.TimeOffset == 0 {
-		t.Error("预期时间偏移量已设置，实际得到0")
+	// 检查时间偏移量是否来自可达的服务器
+	if diff := ntp.TimeOffsetDuration() - 2*time.Second; diff < -50*time.Millisecond || diff > 50*time.Millisecond {
+		t.Errorf("预期时间偏移量约为2秒，实际得到%v", ntp.TimeOffsetDuration())
 	}
 	
 	// 检查最后同步时间是否已设置
-	if ntp.LastSync.IsZero() {
+	if ntp.LastSyncTime().IsZero() {
 		t.Error("预期最后同步时间已设置，实际得到零时间")
 	}
+	
+	if down.RequestCount() == 0 {
+		t.Error("预期不可达的服务器也收到了请求")
+	}
 }
 
 // TestSyncWithMultiServerParallel 测试并行多服务器同步
-// 这是一个需要网络访问的集成测试
+// 应选择层级最低的服务器
 func TestSyncWithMultiServerParallel(t *testing.T) {
-	// 在短模式下跳过此测试
-	if testing.Short() {
-		t.Skip("在短模式下跳过并行多服务器同步测试")
-	}
+	low := ntptest.NewServer()
+	defer low.Close()
+	low.SetStratum(1)
+	low.SetOffset(1 * time.Second)
+	
+	high := ntptest.NewServer()
+	defer high.Close()
+	high.SetStratum(3)
+	high.SetOffset(-1 * time.Second)
 	
 	ntp, err := New(Options{
 		Servers: []string{
-			"pool.ntp.org",
-			"time.google.com",
+			high.Addr(),
+			low.Addr(),
 		},
 		Timeout: 5 * time.Second,
 	})
@@ -67,40 +77,37 @@ func TestSyncWithMultiServerParallel(t *testing.T) {
 	}
 	
 	// 并行与多个服务器同步
-	err = ntp.SyncWithMultiServerParallel()
-	
-	// 如果网络不可靠，此测试可能会失败
-	// 我们只检查函数是否按预期工作
-	if err != nil {
-		t.Logf("并行多服务器同步失败: %v", err)
-		t.Skip("由于网络错误跳过")
+	if err := ntp.SyncWithMultiServerParallel(); err != nil {
+		t.Fatalf("并行多服务器同步失败: %v", err)
 	}
 	
-	// 检查时间偏移量是否已设置
-	if ntp.TimeOffset == 0 {
-		t.Error("预期时间偏移量已设置，实际得到0")
+	// 检查时间偏移量是否来自层级最低的服务器
+	if diff := ntp.TimeOffsetDuration() - 1*time.Second; diff < -50*time.Millisecond || diff > 50*time.Millisecond {
+		t.Errorf("预期时间偏移量约为1秒，实际得到%v", ntp.TimeOffsetDuration())
 	}
 	
 	// 检查最后同步时间是否已设置
-	if ntp.LastSync.IsZero() {
+	if ntp.LastSyncTime().IsZero() {
 		t.Error("预期最后同步时间已设置，实际得到零时间")
 	}
 }
 
 // TestGetMultiServerStatus 测试获取多个服务器的状态
-// 这是一个需要网络访问的集成测试
 func TestGetMultiServerStatus(t *testing.T) {
-	// 在短模式下跳过此测试
-	if testing.Short() {
-		t.Skip("在短模式下跳过多服务器状态测试")
-	}
+	up := ntptest.NewServer()
+	defer up.Close()
+	up.SetStratum(2)
+	
+	down := ntptest.NewServer()
+	defer down.Close()
+	down.SetDrop(true)
 	
 	ntp, err := New(Options{
 		Servers: []string{
-			"pool.ntp.org",
-			"time.google.com",
+			up.Addr(),
+			down.Addr(),
 		},
-		Timeout: 5 * time.Second,
+		Timeout: 200 * time.Millisecond,
 	})
 	
 	if err != nil {
@@ -109,31 +116,31 @@ func TestGetMultiServerStatus(t *testing.T) {
 	
 	// 获取多个服务器的状态
 	statuses, err := ntp.GetMultiServerStatus()
-	
-	// 如果网络不可靠，此测试可能会失败
-	// 我们只检查函数是否按预期工作
 	if err != nil {
-		t.Logf("获取多服务器状态失败: %v", err)
-		t.Skip("由于网络错误跳过")
+		t.Fatalf("获取多服务器状态失败: %v", err)
 	}
 	
 	// 检查我们是否获得了状态
 	if len(statuses) != 2 {
-		t.Errorf("预期2个状态，实际得到%d个", len(statuses))
+		t.Fatalf("预期2个状态，实际得到%d个", len(statuses))
 	}
 	
 	// 检查状态是否包含正确的服务器
-	servers := make(map[string]bool)
+	servers := make(map[string]ServerStatus)
 	for _, status := range statuses {
-		servers[status.Address] = true
+		servers[status.Address] = status
 	}
 	
-	if !servers["pool.ntp.org:123"] && !servers["pool.ntp.org"] {
-		t.Error("预期有pool.ntp.org的状态，未找到")
+	if status, ok := servers[up.Addr()]; !ok {
+		t.Errorf("预期有%s的状态，未找到", up.Addr())
+	} else if !status.Reachable || status.Stratum != 2 {
+		t.Errorf("预期%s可达且层级为2，实际得到%+v", up.Addr(), status)
 	}
 	
-	if !servers["time.google.com:123"] && !servers["time.google.com"] {
-		t.Error("预期有time.google.com的状态，未找到")
+	if status, ok := servers[down.Addr()]; !ok {
+		t.Errorf("预期有%s的状态，未找到", down.Addr())
+	} else if status.Reachable {
+		t.Errorf("预期%s不可达，实际得到可达", down.Addr())
 	}
 }
 
@@ -158,9 +165,99 @@ func TestUpdateNTPSyncWithMultiServer(t *testing.T) {
 	// 这很难直接测试，所以我们只检查调用时是否不会崩溃
 	
 	// 我们设置一个短的超时时间以避免等待太长时间
-	ntp.Timeout = 100 * time.Millisecond
+	ntp.SetTimeout(100 * time.Millisecond)
 	
 	// 调用Sync，现在应该使用多服务器功能
 	// 我们不关心它是否成功或失败，只关心它不会崩溃
 	_ = ntp.Sync()
 }
+
+// TestAddRemoveServerMultiServer 测试运行时添加和移除的服务器同步到服务器管理器，
+// 重新添加的服务器恢复原来的状态
+func TestAddRemoveServerMultiServer(t *testing.T) {
+	ntp, err := New(Options{
+		Servers:           []string{"a.example.com"},
+		EnableMultiServer: true,
+		HolddownThreshold: 1,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	
+	ntp.AddServer("b.example.com")
+	if got := ntp.serverManager.GetServers(); len(got) != 2 || got[1] != "b.example.com" {
+		t.Fatalf("预期服务器管理器中有2个服务器，实际得到%v", got)
+	}
+	
+	now := time.Now()
+	_ = ntp.serverManager.RecordFailure("b.example.com", now)
+	if !ntp.serverManager.IsHeldDown("b.example.com", now) {
+		t.Fatal("预期失败后排除服务器")
+	}
+	
+	if !ntp.RemoveServer("b.example.com") {
+		t.Fatal("预期服务器被移除")
+	}
+	if got := ntp.serverManager.GetServers(); len(got) != 1 {
+		t.Errorf("预期服务器管理器中剩余1个服务器，实际得到%v", got)
+	}
+	
+	// 移除再添加不能绕过暂时排除
+	ntp.AddServer("b.example.com")
+	status, err := ntp.serverManager.GetServerStatus("b.example.com")
+	if err != nil {
+		t.Fatalf("预期服务器重新加入服务器管理器: %v", err)
+	}
+	if status.ConsecutiveFailures != 1 || !ntp.serverManager.IsHeldDown("b.example.com", now) {
+		t.Errorf("预期恢复原来的状态，实际得到%+v", status)
+	}
+	
+	// 应用配置时保留的服务器状态不变
+	if err := ntp.ApplyConfig(&Config{Servers: []ServerConfig{{Address: "b.example.com"}, {Address: "c.example.com"}}, EnableMultiServer: true}); err != nil {
+		t.Fatalf("应用配置失败: %v", err)
+	}
+	if got := ntp.serverManager.GetServers(); len(got) != 2 || !slices.Contains(got, "c.example.com") {
+		t.Errorf("预期服务器管理器与配置一致，实际得到%v", got)
+	}
+	if status, _ := ntp.serverManager.GetServerStatus("b.example.com"); status.ConsecutiveFailures != 1 {
+		t.Errorf("预期保留的服务器状态不变，实际得到%+v", status)
+	}
+}
+
+// TestSyncHonorsServerManagerOrder 测试多服务器模式下Sync按服务器管理器的排序尝试服务器
+func TestSyncHonorsServerManagerOrder(t *testing.T) {
+	first := ntptest.NewServer()
+	defer first.Close()
+	
+	preferred := ntptest.NewServer()
+	defer preferred.Close()
+	preferred.SetOffset(time.Second)
+	
+	ntp, err := New(Options{
+		Servers:           []string{first.Addr(), preferred.Addr()},
+		EnableMultiServer: true,
+		MinPollInterval:   -1,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	
+	if err := ntp.serverManager.SetPriority(preferred.Addr(), 0); err != nil {
+		t.Fatalf("设置优先级失败: %v", err)
+	}
+	if best, _ := ntp.serverManager.GetBestServer(); best != preferred.Addr() {
+		t.Fatalf("预期最佳服务器为%s，实际得到%s", preferred.Addr(), best)
+	}
+	
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if first.RequestCount() != 0 || preferred.RequestCount() == 0 {
+		t.Errorf("预期只请求排在最前的服务器，实际请求次数为%d和%d", first.RequestCount(), preferred.RequestCount())
+	}
+	if result := ntp.GetHistory(1); len(result) != 1 || result[0].Server != preferred.Addr() {
+		t.Errorf("预期与%s同步，实际得到%+v", preferred.Addr(), result)
+	}
+}
@@ -0,0 +1,89 @@
+package ntpsync
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// NetworkChangeDelay 是网络变化后等待网络稳定的时间，期间的多次变化只触发一次重新同步
+const NetworkChangeDelay = 2 * time.Second
+
+// NotifyNetworkChange 通知实例本地网络发生了变化，例如蜂窝网络重新连接
+// 实例会立即重新同步并重新探测所有服务器，而不是等待下一个同步间隔。
+// 应用自己能够感知网络变化时可以直接调用，不需要启用Options.ResyncOnNetworkChange
+func (n *NTPSync) NotifyNetworkChange() {
+	n.resync()
+}
+
+// startNetworkWatch 开始监听系统的网卡和路由变化
+func (n *NTPSync) startNetworkWatch() error {
+	events, err := networkChanges(n.context())
+	if err != nil {
+		return fmt.Errorf("监听网络变化失败: %v", err)
+	}
+	n.goAsync(func() {
+		n.watchNetwork(events, hasConnectivity)
+	})
+	return nil
+}
+
+// watchNetwork 在网络变化稳定NetworkChangeDelay后，如果网络可用则重新同步
+// events关闭或实例关闭时返回
+func (n *NTPSync) watchNetwork(events <-chan struct{}, connected func() bool) {
+	ctx := n.context()
+
+	var timer Timer
+	var timerC <-chan time.Time
+	defer func() {
+		if timer != nil {
+			stopTimer(timer)
+		}
+	}()
+
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+			// 每次变化都重新开始等待网络稳定
+			if timer != nil {
+				stopTimer(timer)
+			}
+			timer = n.clock.NewTimer(NetworkChangeDelay)
+			timerC = timer.C()
+		case <-timerC:
+			timer, timerC = nil, nil
+			if connected() {
+				n.resync()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// hasConnectivity 返回是否有已启用的非回环网卡配置了可路由的地址
+func hasConnectivity() bool {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		// 无法判断时按网络可用处理
+		return true
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.IsGlobalUnicast() {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// rtnetlink的多播组，syscall包没有定义这些常量
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6IfAddr = 0x100
+	rtmgrpIPv6Route  = 0x400
+)
+
+// networkChanges 通过netlink订阅网卡、地址和路由的变化
+// 每收到一批通知向返回的通道发送一次，ctx被取消或读取失败时关闭通道
+func networkChanges(ctx context.Context) (<-chan struct{}, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("创建netlink套接字失败: %v", err)
+	}
+	groups := uint32(rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv4Route | rtmgrpIPv6IfAddr | rtmgrpIPv6Route)
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("订阅netlink通知失败: %v", err)
+	}
+
+	// 非阻塞的文件描述符由运行时轮询，关闭文件可以中断读取
+	f := os.NewFile(uintptr(fd), "netlink")
+	stop := context.AfterFunc(ctx, func() {
+		f.Close()
+	})
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		defer stop()
+		defer f.Close()
+
+		buf := make([]byte, os.Getpagesize())
+		for {
+			if _, err := f.Read(buf); err != nil && !errors.Is(err, syscall.ENOBUFS) {
+				// ENOBUFS表示通知太多而丢失了一部分，仍然按发生了变化处理
+				return
+			}
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,62 @@
+//go:build !linux
+
+package ntpsync
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// networkPollInterval 是检查网卡地址变化的间隔
+const networkPollInterval = 5 * time.Second
+
+// networkChanges 定期检查网卡地址，发生变化时向返回的通道发送
+// ctx被取消时关闭通道
+func networkChanges(ctx context.Context) (<-chan struct{}, error) {
+	last, err := addressFingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(networkPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			current, err := addressFingerprint()
+			if err != nil || current == last {
+				continue
+			}
+			last = current
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
+
+// addressFingerprint 返回所有网卡地址排序后的组合，用于判断网络是否变化
+func addressFingerprint() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	list := make([]string, len(addrs))
+	for i, addr := range addrs {
+		list[i] = addr.String()
+	}
+	sort.Strings(list)
+	return strings.Join(list, ","), nil
+}
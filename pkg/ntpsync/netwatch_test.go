@@ -0,0 +1,191 @@
+package ntpsync
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// waitForRequests 等待直到服务器收到至少n个请求
+func waitForRequests(t *testing.T, server *ntptest.Server, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.RequestCount() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%d个请求超时，实际收到%d个", n, server.RequestCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestNotifyNetworkChange 测试网络变化后立即重新同步，而不是等待同步间隔
+func TestNotifyNetworkChange(t *testing.T) {
+	clock := newFakeClock()
+
+	server := ntptest.NewServer()
+	defer server.Close()
+	server.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:         []string{server.Addr()},
+		Timeout:         time.Second,
+		SyncInterval:    time.Hour,
+		MinPollInterval: -1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+	clock.waitForTimers(t, 1)
+	if got := server.RequestCount(); got != 1 {
+		t.Fatalf("预期初始同步发送1个请求，实际发送%d个", got)
+	}
+
+	ntp.NotifyNetworkChange()
+	waitForRequests(t, server, 2)
+
+	// 重新同步后仍然按同步间隔等待下一次同步
+	clock.waitForTimers(t, 1)
+	clock.Advance(time.Minute)
+	time.Sleep(50 * time.Millisecond)
+	if got := server.RequestCount(); got != 2 {
+		t.Errorf("预期重新同步后等待同步间隔，实际发送%d个请求", got)
+	}
+}
+
+// TestNotifyNetworkChangeClearsHolddown 测试网络变化后恢复被排除的服务器并重新探测
+func TestNotifyNetworkChangeClearsHolddown(t *testing.T) {
+	clock := newFakeClock()
+
+	server := ntptest.NewServer()
+	defer server.Close()
+	server.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:           []string{server.Addr()},
+		Timeout:           time.Second,
+		EnableMultiServer: true,
+		HolddownThreshold: 1,
+		HolddownInterval:  time.Hour,
+		MinPollInterval:   -1,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	sm := ntp.serverManager
+	_ = sm.RecordFailure(server.Addr(), clock.Now())
+	if !sm.IsHeldDown(server.Addr(), clock.Now()) {
+		t.Fatal("预期服务器被排除")
+	}
+
+	ntp.NotifyNetworkChange()
+	if sm.IsHeldDown(server.Addr(), clock.Now()) {
+		t.Error("预期网络变化后恢复被排除的服务器")
+	}
+
+	// 同步一次，再探测一次所有服务器
+	waitForRequests(t, server, 2)
+}
+
+// timerAt 返回假时钟上是否有在deadline触发的定时器
+func (c *fakeClock) timerAt(deadline time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, t := range c.timers {
+		if t.active && t.deadline.Equal(deadline) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestWatchNetworkDebounce 测试连续的网络变化只在稳定后触发一次重新同步
+func TestWatchNetworkDebounce(t *testing.T) {
+	clock := newFakeClock()
+
+	server := ntptest.NewServer()
+	defer server.Close()
+	server.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:         []string{server.Addr()},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	var online atomic.Bool
+	var checks atomic.Int32
+	connected := func() bool {
+		checks.Add(1)
+		return online.Load()
+	}
+
+	events := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ntp.watchNetwork(events, connected)
+		close(done)
+	}()
+
+	// change 发送一次网络变化并等待对应的定时器创建
+	change := func() {
+		t.Helper()
+		events <- struct{}{}
+		deadline := clock.Now().Add(NetworkChangeDelay)
+		for start := time.Now(); !clock.timerAt(deadline); {
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("等待网络变化的定时器超时")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// 网络仍在变化时不检查连接
+	change()
+	clock.Advance(NetworkChangeDelay / 2)
+	change()
+	clock.Advance(NetworkChangeDelay / 2)
+	time.Sleep(20 * time.Millisecond)
+	if got := checks.Load(); got != 0 {
+		t.Fatalf("预期网络稳定前不重新同步，实际检查了%d次", got)
+	}
+
+	// 网络稳定但没有连接时不发送请求
+	clock.Advance(NetworkChangeDelay / 2)
+	for checks.Load() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := server.RequestCount(); got != 0 {
+		t.Fatalf("预期没有网络连接时不发送请求，实际发送%d个", got)
+	}
+
+	// 网络恢复后重新同步
+	online.Store(true)
+	change()
+	clock.Advance(NetworkChangeDelay)
+	waitForRequests(t, server, 1)
+
+	close(events)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("预期通道关闭后停止监听")
+	}
+}
@@ -1,13 +1,53 @@
 package ntpsync
 
 import (
+	"errors"
+	"math"
 	"time"
 )
 
+// NeverSynced 是从未同步时LastSyncAge返回的时长，大于任何有效的maxAge
+const NeverSynced = time.Duration(math.MaxInt64)
+
 // Sync 执行一次与NTP服务器的同步
-// 这是对SyncWithBinary的包装，用于向后兼容
+// 配置了Options.PreferredSources时先尝试这些时间源，否则是对SyncWithBinary的包装
+// 启用多服务器支持时，服务器按服务器管理器的排序依次尝试（可达、优先级、健康评分、层级、往返时间），
+// 与GetBestServer的选择一致。
+// 多个goroutine同时调用Sync或ForceSyncNow时只进行一次同步，后来的调用等待并返回同一个结果
 func (n *NTPSync) Sync() error {
-	return n.SyncWithBinary()
+	return n.coalesce(false)
+}
+
+// syncOnce 执行一次同步，由coalesce调用
+func (n *NTPSync) syncOnce() error {
+	// 优先使用PTP、GPS等本地高精度时间源，都不可用时回退到NTP服务器
+	var err error
+	if sources := n.preferredSources(); len(sources) > 0 {
+		if err = n.syncWithPreferred(sources); err == nil || errors.Is(err, ErrOutlierRejected) || errors.Is(err, ErrClosed) {
+			return err
+		}
+	}
+	
+	if err != nil && len(n.GetServers()) == 0 {
+		// 只使用时间源时（例如浏览器中的HTTP时间源）报告时间源的错误
+		n.syncFailed(err)
+	} else if n.shouldCombineServers() {
+		err = n.SyncWithMultiServerCombined()
+	} else {
+		err = n.SyncWithBinary()
+	}
+	if err == nil || !shouldFallBackToLocal(err) {
+		return err
+	}
+	
+	// 所有时间源和服务器都不可用时回退到本地时钟
+	n.mutex.RLock()
+	stratum := n.localStratum
+	n.mutex.RUnlock()
+	if stratum == 0 {
+		return err
+	}
+	return n.syncWithLocalClock(stratum)
 }
 
 // GetStatus 返回所有已配置NTP服务器的状态
@@ -17,11 +57,43 @@ func (n *NTPSync) GetStatus() ([]ServerStatus, error) {
 }
 
 // Now 返回经NTP偏移量调整后的当前时间
+// 时间由同步时锚定的NTP时间加上单调时钟经过的时长得到，
+// 两次同步之间系统时间被其它进程修改也不受影响，且连续调用的结果严格递增；
+// 只有同步得到更小的偏移量时，时间才会随之回退。
+// 处于保持模式时，还会按估计的本地时钟频率偏差继续调整，参见GetHoldoverStatus。
+// 同步之后Now不获取实例的锁，可以在每条日志中调用而不与同步goroutine竞争。
+// 设置了SyncOnFirstUse时，从未同步过的实例第一次调用Now会触发同步；
+// 设置了MaxStaleness时，同步的时效超过该值后调用Now会在后台重新同步
 func (n *NTPSync) Now() time.Time {
+	if n.syncOnFirstUse && n.snapshot.Load() == nil {
+		n.syncOnFirstCall()
+	}
+	local := n.clock.Now()
+	
+	// 同步之后读取发布的快照，不需要加锁
+	if s := n.snapshot.Load(); s != nil {
+		if n.maxStaleness > 0 {
+			n.resyncIfStale(s, local)
+		}
+		return s.now(local)
+	}
+	
 	n.mutex.RLock()
-	defer n.mutex.RUnlock()
+	offset := n.timeOffset
+	_, correction := n.holdoverLocked(local)
+	n.mutex.RUnlock()
 	
-	return time.Now().Add(n.TimeOffset)
+	return n.monotonic.now(local, offset).Add(correction)
+}
+
+// correctedLocked 返回本地时间为local时校准后的时间，与Now相同但不参与Now的严格递增，
+// 用于计算定时同步的时间，调用者必须持有n.mutex的读锁或写锁
+func (n *NTPSync) correctedLocked(local time.Time) time.Time {
+	_, correction := n.holdoverLocked(local)
+	if a := n.monotonic.anchored.Load(); a != nil && a.target == n.timeOffset {
+		return a.at(local).Add(correction)
+	}
+	return local.Round(0).Add(n.timeOffset + correction)
 }
 
 // LastSyncTime 返回最后一次成功同步的时间
@@ -29,7 +101,34 @@ func (n *NTPSync) LastSyncTime() time.Time {
 	n.mutex.RLock()
 	defer n.mutex.RUnlock()
 	
-	return n.LastSync
+	return n.lastSync
+}
+
+// LastSyncAge 返回距离最后一次成功同步经过的时长，从未同步时返回NeverSynced
+// 时长按单调时钟计算，不受系统时间修改的影响；启用DetectSuspend时包含检测到的休眠时长
+func (n *NTPSync) LastSyncAge() time.Duration {
+	n.mutex.RLock()
+	lastSync := n.lastSync
+	suspended := n.suspendedSinceSync
+	n.mutex.RUnlock()
+	
+	if lastSync.IsZero() {
+		return NeverSynced
+	}
+	age := n.clock.Now().Sub(lastSync) + suspended
+	if age < 0 {
+		return 0
+	}
+	return age
+}
+
+// IsSynchronized 判断最后一次成功同步是否在maxAge之内，即Now是否可信
+// maxAge不大于0时使用两倍的定时同步间隔，从未同步时返回false
+func (n *NTPSync) IsSynchronized(maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		maxAge = 2 * n.GetPeriodicSyncInterval()
+	}
+	return n.LastSyncAge() <= maxAge
 }
 
 // TimeOffsetDuration 返回当前与NTP服务器的时间偏移量
@@ -37,38 +136,33 @@ func (n *NTPSync) TimeOffsetDuration() time.Duration {
 	n.mutex.RLock()
 	defer n.mutex.RUnlock()
 	
-	return n.TimeOffset
+	return n.timeOffset
 }
 
 // AddServer 向列表中添加新的NTP服务器
+// 多服务器模式下服务器同时加入服务器管理器，参与探测和故障转移
 func (n *NTPSync) AddServer(server string) {
 	n.mutex.Lock()
 	defer n.mutex.Unlock()
 	
-	// 检查服务器是否已存在
-	for _, s := range n.Servers {
-		if s == server {
-			return
-		}
+	if !n.addServerLocked(server) {
+		return
 	}
 	
-	n.Servers = append(n.Servers, server)
+	// 添加pool.ntp.org服务器时，同步间隔不能低于其使用规范
+	if n.clampSyncIntervalLocked() {
+		n.publishLocked()
+		n.emit(Event{Type: EventIntervalChanged, Interval: n.syncInterval})
+	}
 }
 
-// RemoveServer 从列表中移除NTP服务器
+// RemoveServer 从列表和服务器管理器中移除NTP服务器
+// 服务器管理器保留其状态，重新添加时恢复
 func (n *NTPSync) RemoveServer(server string) bool {
 	n.mutex.Lock()
 	defer n.mutex.Unlock()
 	
-	for i, s := range n.Servers {
-		if s == server {
-			// 通过切片移除服务器
-			n.Servers = append(n.Servers[:i], n.Servers[i+1:]...)
-			return true
-		}
-	}
-	
-	return false
+	return n.removeServerLocked(server)
 }
 
 // GetServers 返回已配置的NTP服务器列表
@@ -77,8 +171,8 @@ func (n *NTPSync) GetServers() []string {
 	defer n.mutex.RUnlock()
 	
 	// 返回副本以防止外部修改
-	servers := make([]string, len(n.Servers))
-	copy(servers, n.Servers)
+	servers := make([]string, len(n.servers))
+	copy(servers, n.servers)
 	
 	return servers
 }
@@ -89,9 +183,15 @@ func (n *NTPSync) SetSyncInterval(interval time.Duration) {
 		interval = DefaultSyncInterval
 	}
 	
+	// 不能低于当前服务器允许的最小同步间隔
 	n.mutex.Lock()
-	n.SyncInterval = interval
+	n.syncInterval = interval
+	n.clampSyncIntervalLocked()
+	interval = n.syncInterval
+	n.publishLocked()
 	n.mutex.Unlock()
+	
+	n.emit(Event{Type: EventIntervalChanged, Interval: interval})
 }
 
 // SetTimeout 设置NTP请求的超时时间
@@ -101,13 +201,21 @@ func (n *NTPSync) SetTimeout(timeout time.Duration) {
 	}
 	
 	n.mutex.Lock()
-	n.Timeout = timeout
+	n.timeout = timeout
 	n.mutex.Unlock()
 }
 
+// GetTimeout 返回NTP请求的超时时间
+func (n *NTPSync) GetTimeout() time.Duration {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	
+	return n.timeout
+}
+
 // SyncAsync 执行异步同步并立即返回
 func (n *NTPSync) SyncAsync() {
-	go func() {
+	n.goAsync(func() {
 		_ = n.Sync()
-	}()
+	})
 }
@@ -5,98 +5,302 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"time"
 )
 
 // SyncWithBinary 使用二进制操作执行一次与NTP服务器的同步
 // 此实现不依赖任何第三方包
 func (n *NTPSync) SyncWithBinary() error {
-	n.mutex.Lock()
-	servers := make([]string, len(n.Servers))
-	copy(servers, n.Servers)
-	timeout := n.Timeout
-	n.mutex.Unlock()
+	servers, timeout, err := n.syncTargets()
+	if err != nil {
+		return err
+	}
 
-	if len(servers) == 0 {
-		return errors.New("未配置NTP服务器")
+	result, err := n.measureServers(servers, timeout)
+	if err != nil {
+		n.syncFailed(err)
+		return err
+	}
+
+	// 成功与此服务器同步
+	return n.applyResult(result)
+}
+
+// syncTargets 返回依次尝试的服务器列表和超时时间
+// 启用多服务器支持时按服务器管理器的排序，否则按配置的顺序，再按故障切换策略调整
+func (n *NTPSync) syncTargets() ([]string, time.Duration, error) {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	if n.closed {
+		return nil, 0, ErrClosed
 	}
+	if len(n.servers) == 0 {
+		return nil, 0, errors.New("未配置NTP服务器")
+	}
+
+	servers := make([]string, len(n.servers))
+	copy(servers, n.servers)
+	if n.serverManager != nil {
+		n.serverManager.sortServers(servers)
+	}
+	n.applyFailoverLocked(servers)
+	return servers, n.timeout, nil
+}
+
+// measureServers 依次尝试服务器，返回第一个成功的测量结果但不应用它
+// 启用多服务器支持时，每个服务器的结果会记录到服务器管理器
+func (n *NTPSync) measureServers(servers []string, timeout time.Duration) (*SyncResult, error) {
+	// 跳过因连续失败被暂时排除或拒绝访问的服务器，每次选择的过程记录到选择历史
+	candidates := n.newSelection(servers, n.clock.Now())
 
 	var lastErr error
-	for _, server := range servers {
-		result, err := n.syncWithServerBinary(server, timeout)
+	for i := range candidates {
+		c := &candidates[i]
+		if c.Outcome != SelectionNotTried {
+			continue
+		}
+		result, err := n.syncWithServerBinary(c.Server, timeout)
+		n.recordServerResult(n.serverManager, c.Server, result, err)
 		if err != nil {
+			if errors.Is(err, ErrClosed) {
+				return nil, err
+			}
+			c.Outcome, c.Reason = SelectionFailed, err.Error()
 			lastErr = err
 			continue
 		}
+		c.Outcome, c.Reason = SelectionSelected, ""
+		n.recordSelection(candidates, result)
+		return result, nil
+	}
+	n.recordSelection(candidates, nil)
 
-		// 成功与此服务器同步
-		n.mutex.Lock()
-		n.TimeOffset = result.Offset
-		n.LastSync = time.Now()
+	if lastErr == nil {
+		return nil, errors.New("所有NTP服务器都因连续失败或拒绝访问被暂时排除")
+	}
+	// 如果执行到这里，说明所有服务器都失败了
+	return nil, fmt.Errorf("无法与任何NTP服务器同步: %w", lastErr)
+}
+
+// applyResult 应用一次成功的同步结果并发布同步成功事件
+// 偏移量的变化来自系统时钟被外部调整时，先修正已有的偏移量并发布EventClockStepped事件；
+// 偏移量超过MaxOffset时不应用结果，返回ErrOffsetTooLarge；
+// 偏移量被判定为异常值时不应用结果，返回ErrOutlierRejected
+func (n *NTPSync) applyResult(result *SyncResult) error {
+	n.mutex.Lock()
+	if step, ok := n.detectStepLocked(readClock(n.clock), result.Offset); ok {
 		n.mutex.Unlock()
-		
-		return nil
+		n.emit(Event{Type: EventClockStepped, Server: result.Server, Offset: step})
+		n.mutex.Lock()
 	}
+	if n.exceedsMaxOffsetLocked(result.Offset) {
+		return n.rejectLargeOffsetLocked(result)
+	}
+	if n.isOutlierLocked(result.Offset) {
+		if n.consecutiveRejects < outlierMaxRejects {
+			n.consecutiveRejects++
+			rejected := *result
+			rejected.Rejected = true
+			n.history.add(rejected)
+			err := fmt.Errorf("%w: 服务器 %s 的偏移量 %v", ErrOutlierRejected, result.Server, result.Offset)
+			n.rejectSelectionLocked(result, err)
+			n.mutex.Unlock()
 
-	// 如果执行到这里，说明所有服务器都失败了
-	return fmt.Errorf("无法与任何NTP服务器同步: %v", lastErr)
+			n.emit(Event{
+				Type:   EventSyncRejected,
+				Server: result.Server,
+				Offset: result.Offset,
+				Error:  err,
+			})
+			return err
+		}
+
+		// 连续多次被拒绝说明时间确实发生了变化，以新的偏移量重新建立样本分布
+		n.systemOffsets = offsetWindow{}
+	}
+	n.consecutiveRejects = 0
+	first := n.lastSync.IsZero()
+	previous := n.timeOffset
+	n.clockCheck = readClock(n.clock)
+	n.lastSync = n.clockCheck.local
+	n.timeOffset = n.estimateLocked(n.lastSync, previous, result, first)
+	n.systemOffsets.add(result.Offset)
+	n.suspendedSinceSync = 0
+	n.adjustLocked(n.lastSync, previous, n.timeOffset, first)
+	n.recordDriftLocked(n.lastSync, previous, result)
+	n.markSyncedLocked()
+	n.publishLocked()
+	n.history.add(*result)
+	n.currentServer = result.Server
+	var loop LoopStats
+	if n.statsLog != nil {
+		loop = n.loopStatsLocked(result)
+	}
+	n.mutex.Unlock()
+
+	n.emit(Event{
+		Type:   EventSyncSucceeded,
+		Server: result.Server,
+		Offset: result.Offset,
+	})
+	n.updateHardwareClock(result)
+	if n.statsLog != nil {
+		n.writeLoopStats(result.Server, loop)
+	}
+	return nil
+}
+
+// syncFailed 记录一次失败的同步并发布同步失败事件
+func (n *NTPSync) syncFailed(err error) {
+	n.mutex.Lock()
+	n.history.add(SyncResult{Time: n.clock.Now(), Error: err})
+	n.mutex.Unlock()
+
+	n.emit(Event{Type: EventSyncFailed, Error: err})
 }
 
 // syncWithServerBinary 使用直接二进制操作与特定的NTP服务器同步
 func (n *NTPSync) syncWithServerBinary(server string, timeout time.Duration) (*SyncResult, error) {
+	// 服务器单独配置的超时时间优先
+	dialTimeout, readTimeout := n.exchangeTimeouts(server, timeout)
+
 	// 确保服务器地址包含端口
-	if _, _, err := net.SplitHostPort(server); err != nil {
-		server = net.JoinHostPort(server, DefaultNTPPort)
+	configured := server
+	server = serverAddress(server)
+	
+	// 确定请求使用的协议版本，对称密钥认证只用于版本3和版本4
+	version, explicit := n.requestVersion(configured, server)
+	key := n.serverKey(configured)
+	if key != nil && version == Version5 {
+		version = Version4
+	}
+
+	// 不向拒绝访问的服务器发送请求，并遵守向同一服务器发送请求的最小间隔
+	if err := n.checkDenied(server); err != nil {
+		return nil, err
+	}
+	if err := n.reservePoll(server); err != nil {
+		return nil, err
 	}
 
-	// 创建UDP连接
-	conn, err := net.DialTimeout("udp", server, timeout)
+	// 创建UDP连接，实例关闭时取消
+	ctx := n.context()
+	ex, err := n.openExchange(ctx, server, dialTimeout, readTimeout)
 	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, ErrClosed) {
+			return nil, ErrClosed
+		}
 		return nil, fmt.Errorf("连接NTP服务器 %s 失败: %v", server, err)
 	}
-	defer conn.Close()
+	defer ex.close()
 
-	// 设置读写超时
-	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
-		return nil, fmt.Errorf("设置超时时间失败: %v", err)
+	// 发送请求并接收响应，丢包时按重试策略重新发送
+	interleaved := n.interleave && version != Version5
+	retryCount, backoff := n.retryPolicy()
+	var req sentRequest
+	var respBytes []byte
+	var t4 time.Time
+	for attempt := 0; ; attempt++ {
+		var reqBytes []byte
+		if reqBytes, req, err = n.newRequest(server, version, explicit, interleaved, key); err != nil {
+			return nil, err
+		}
+		err = ex.send(reqBytes)
+		if err == nil {
+			n.tracePacket(PacketSent, server, reqBytes)
+		}
+		putPacket(reqBytes)
+		if err != nil {
+			return nil, fmt.Errorf("发送NTP请求失败: %v", err)
+		}
+		
+		respBytes, t4, err = ex.receive()
+		if err == nil {
+			n.tracePacket(PacketReceived, server, respBytes)
+			n.serverResponded(server)
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ErrClosed
+		}
+		if attempt >= retryCount || !errors.Is(err, os.ErrDeadlineExceeded) {
+			if !explicit {
+				n.versionTimedOut(server, version, err)
+			}
+			n.serverTimedOut(server, err)
+			return nil, fmt.Errorf("读取NTP响应失败: %v", err)
+		}
+		
+		// 重新发送前等待，每次加倍
+		if !n.sleep(ctx, backoff<<attempt) {
+			return nil, ErrClosed
+		}
 	}
-
-	// 创建NTP请求数据包
-	reqBytes := make([]byte, 48)
+	defer putPacket(respBytes)
+	t1, cookie, sentTx, sentRx := req.t1, req.cookie, req.sentTx, req.sentRx
 	
-	// LI (0), VN (4), Mode (3)
-	reqBytes[0] = (0 << 6) | (4 << 3) | (3)
-	
-	// 设置发送时间戳为当前时间
-	t1 := time.Now() // 发送请求的时间
-	seconds, fraction := timeToNTPTime(t1)
-	
-	// 写入发送时间戳（秒和小数部分）
-	binary.BigEndian.PutUint32(reqBytes[40:], seconds)
-	binary.BigEndian.PutUint32(reqBytes[44:], fraction)
+	// 内核记录的发送时间比写入请求的时间更接近数据包实际发出的时刻
+	sent, hardware := ex.timestamps()
+	if !sent.Before(t1) && !sent.After(t4) {
+		t1 = sent
+	}
 	
-	// 发送请求
-	if _, err := conn.Write(reqBytes); err != nil {
-		return nil, fmt.Errorf("发送NTP请求失败: %v", err)
+	// t4是接收响应的时间
+	if len(respBytes) < packetSize || len(respBytes)%4 != 0 {
+		return nil, fmt.Errorf("无效的NTP响应大小: %d", len(respBytes))
 	}
 
-	// 接收响应
-	respBytes := make([]byte, 48)
-	bytesRead, err := conn.Read(respBytes)
-	if err != nil {
-		return nil, fmt.Errorf("读取NTP响应失败: %v", err)
+	// 认证应答之后才能相信其中的内容，包括Kiss-o'-Death代码
+	body := respBytes
+	if key != nil {
+		if err := key.verify(server, respBytes); err != nil {
+			return nil, err
+		}
+		body = respBytes[:len(respBytes)-key.macSize()]
 	}
-	
-	if bytesRead != 48 {
-		return nil, fmt.Errorf("无效的NTP响应大小: %d", bytesRead)
+
+	// 解析响应，版本3和版本4的数据包头格式相同，
+	// NTPv5的层级、接收时间戳和发送时间戳与版本4位置相同
+	respVersion := NTPVersion((respBytes[0] >> 3) & 0x7)
+	if version == Version5 && respVersion != Version5 {
+		if !explicit {
+			n.downgradeVersion(server)
+		}
+		return nil, fmt.Errorf("%w: 应答的版本为%d", ErrNTPv5Unsupported, respVersion)
+	}
+	if respVersion != Version3 && respVersion != Version4 && respVersion != Version5 {
+		return nil, fmt.Errorf("服务器返回不支持的NTP版本%d", respVersion)
+	}
+	if mode := NTPMode(respBytes[0] & 0x7); mode != Server {
+		return nil, fmt.Errorf("服务器返回无效的NTP模式%d", mode)
+	}
+	if respVersion == Version5 {
+		if version != Version5 {
+			return nil, errors.New("服务器以NTPv5应答了版本4的请求")
+		}
+		if err := checkNTPv5Response(respBytes, cookie); err != nil {
+			return nil, err
+		}
+	}
+	if !explicit {
+		if n.ntpv5 && respVersion == Version4 && isNTPv5Capable(respBytes) {
+			n.upgradeVersion(server)
+		} else {
+			n.recordVersion(server, respVersion)
+		}
 	}
 	
-	t4 := time.Now() // 接收响应的时间
-
-	// 解析响应
 	stratum := respBytes[1]
 	if stratum == 0 {
-		return nil, errors.New("服务器返回无效的0层级响应")
+		return nil, n.handleKiss(server, respBytes)
+	}
+	
+	// 扩展字段原样交给调用者，MAC由需要认证的功能自行校验
+	extensions, _, err := ParseExtensionFields(body[packetSize:])
+	if err != nil {
+		return nil, fmt.Errorf("解析NTP响应失败: %v", err)
 	}
 
 	// 提取时间戳
@@ -106,8 +310,18 @@ func (n *NTPSync) syncWithServerBinary(server string, timeout time.Duration) (*S
 	txFraction := binary.BigEndian.Uint32(respBytes[44:48])
 
 	// 转换为time.Time
-	t2 := ntpTimeToTime(rxSeconds, rxFraction)
-	t3 := ntpTimeToTime(txSeconds, txFraction)
+	t2 := ntpTimeToTime(rxSeconds, rxFraction, t1)
+	t3 := ntpTimeToTime(txSeconds, txFraction, t1)
+	
+	// 交错应答中的t3是上一次应答的实际发送时间，与上一次交换的其它时间戳一起计算
+	received := t4
+	var interleavedReply bool
+	if interleaved {
+		t1, t2, t4, interleavedReply, err = n.interleavedResponse(server, respBytes, sentTx, sentRx, t1, t2, t4)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// 计算偏移量和往返延迟
 	// 偏移量 = ((T2 - T1) + (T3 - T4)) / 2
@@ -120,23 +334,140 @@ func (n *NTPSync) syncWithServerBinary(server string, timeout time.Duration) (*S
 		return nil, errors.New("往返时间为负值，可能在同步过程中发生了时钟调整")
 	}
 
+	// 先减去配置的固定路径非对称造成的误差，网络拥塞时再按最小往返时间修正
+	asymmetry := n.asymmetryCorrection(configured)
+	offset += asymmetry
+	huffPuff := n.huffPuffCorrect(server, received, offset, rtt)
+	offset += huffPuff
+
+	// 根距离综合了服务器到主参考源的延迟和离散度，比层级更能反映时间的质量
+	rootDelay, rootDispersion := parseRootDelay(respBytes, respVersion)
+	precision := parsePrecision(respBytes[3])
+	distance := rootDistance(rootDelay, rootDispersion, rtt, precision, n.serverJitter(server))
+	if limit := n.maxDistanceLimit(); limit > 0 && distance > limit {
+		return nil, fmt.Errorf("%w: 服务器 %s 的根距离 %v 超过 %v", ErrRootDistanceExceeded, server, distance, limit)
+	}
+
+	n.recordServerOffset(server, received, offset)
+	n.serverSucceeded(server)
+
+	// NTPv5的参考ID位置被服务器Cookie取代
+	var referenceID string
+	if respVersion != Version5 {
+		referenceID = DecodeReferenceID(stratum, binary.BigEndian.Uint32(respBytes[12:16]))
+	}
+
 	result := &SyncResult{
-		Server:  server,
-		Time:    time.Now().Add(offset),
-		Offset:  offset,
-		RTT:     rtt,
-		Stratum: stratum,
+		Server:       server,
+		Time:         received.Add(offset),
+		Offset:       offset,
+		RTT:          rtt,
+		Stratum:      stratum,
+		Version:      respVersion,
+		RootDistance: distance,
+		ReferenceID:  referenceID,
+		Interleaved:  interleavedReply,
+		Extensions:   extensions,
+		HuffPuff:     huffPuff,
+		Asymmetry:    asymmetry,
+		
+		HardwareTimestamps: hardware,
+		
+		RootDelay:      rootDelay,
+		RootDispersion: rootDispersion,
+		Precision:      precision,
+		Poll:           parsePoll(respBytes[2]),
+		Timestamps: &Timestamps{
+			Originate:   t1,
+			Receive:     t2,
+			Transmit:    t3,
+			Destination: t4,
+			Reference:   parseReferenceTimestamp(respBytes, respVersion, t1),
+		},
 	}
+	n.writePeerStats(result, key != nil)
 
 	return result, nil
 }
 
+// sentRequest 是解析应答时需要的请求内容
+type sentRequest struct {
+	// t1 是发送请求的时间
+	t1 time.Time
+	
+	// cookie 是NTPv5请求的客户端Cookie
+	cookie []byte
+	
+	// sentTx 和 sentRx 是请求中的发送时间戳和交错模式的接收时间戳
+	sentTx uint64
+	sentRx uint64
+}
+
+// newRequest 创建发往服务器的请求数据包
+func (n *NTPSync) newRequest(server string, version NTPVersion, explicit, interleaved bool, key *SymmetricKey) ([]byte, sentRequest, error) {
+	reqBytes := getPacket(packetSize)
+	clear(reqBytes)
+	
+	// LI (0), VN (3、4或5), Mode (3)
+	reqBytes[0] = (0 << 6) | (uint8(version) << 3) | uint8(Client)
+	
+	req := sentRequest{t1: n.clock.Now()}
+	if version == Version5 {
+		// NTPv5以客户端Cookie代替发送时间戳
+		req.cookie = newClientCookie()
+		putNTPv5Request(reqBytes, req.cookie)
+		return reqBytes, req, nil
+	}
+	
+	// 设置发送时间戳为当前时间
+	seconds, fraction := timeToNTPTime(req.t1)
+	
+	// 写入发送时间戳（秒和小数部分）
+	binary.BigEndian.PutUint32(reqBytes[40:], seconds)
+	binary.BigEndian.PutUint32(reqBytes[44:], fraction)
+	req.sentTx = uint64(seconds)<<32 | uint64(fraction)
+	
+	// 交错模式带上上一次交换的时间戳
+	if interleaved {
+		req.sentRx = n.interleavedRequest(server, reqBytes)
+	}
+	
+	// 自动协商版本时询问服务器是否支持NTPv5，使用对称密钥认证时不升级
+	if n.ntpv5 && !explicit && key == nil {
+		copy(reqBytes[16:24], ntpv5Magic)
+	}
+	
+	// 版本3不支持扩展字段
+	if version == Version4 && len(n.extensions) > 0 {
+		var err error
+		if reqBytes, err = appendExtensions(reqBytes, n.extensions, key != nil); err != nil {
+			return nil, req, err
+		}
+	}
+	if key != nil {
+		reqBytes = key.appendMAC(reqBytes)
+	}
+	return reqBytes, req, nil
+}
+
+// serverAddress 返回包含端口的服务器地址，未指定端口时使用标准NTP端口
+func serverAddress(server string) string {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		return net.JoinHostPort(server, DefaultNTPPort)
+	}
+	return server
+}
+
 // GetStatusBinary 使用二进制操作返回所有已配置NTP服务器的状态
 func (n *NTPSync) GetStatusBinary() ([]ServerStatus, error) {
 	n.mutex.RLock()
-	servers := make([]string, len(n.Servers))
-	copy(servers, n.Servers)
-	timeout := n.Timeout
+	if n.closed {
+		n.mutex.RUnlock()
+		return nil, ErrClosed
+	}
+	servers := make([]string, len(n.servers))
+	copy(servers, n.servers)
+	timeout := n.timeout
 	n.mutex.RUnlock()
 
 	if len(servers) == 0 {
@@ -154,12 +485,12 @@ func (n *NTPSync) GetStatusBinary() ([]ServerStatus, error) {
 		if err != nil {
 			status.Reachable = false
 		} else {
-			status.Reachable = true
-			status.LastResponse = time.Now()
-			status.RTT = result.RTT
-			status.Stratum = result.Stratum
-			status.Offset = result.Offset
+			status = n.measuredStatus(server, result)
+		}
+		if n.serverManager == nil {
+			n.recordReach(server, err)
 		}
+		status.Reach = n.reachOf(server)
 		
 		statuses = append(statuses, status)
 	}
@@ -3,8 +3,10 @@
 package ntpsync
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,23 +24,23 @@ const (
 
 // NTPSync 表示一个NTP同步客户端
 type NTPSync struct {
-	// Servers 是NTP服务器地址列表
-	Servers []string
+	// servers 是NTP服务器地址列表，通过GetServers读取
+	servers []string
 	
-	// Timeout 是NTP请求的超时时间
-	Timeout time.Duration
+	// timeout 是NTP请求的超时时间，通过GetTimeout和SetTimeout访问
+	timeout time.Duration
 	
-	// SyncInterval 是自动同步的时间间隔
-	SyncInterval time.Duration
+	// syncInterval 是自动同步的时间间隔，通过GetPeriodicSyncInterval和SetPeriodicSyncInterval访问
+	syncInterval time.Duration
 	
-	// TimeOffset 是本地时间与NTP时间的计算偏移量
-	TimeOffset time.Duration
+	// timeOffset 是本地时间与NTP时间的计算偏移量，通过TimeOffsetDuration读取
+	timeOffset time.Duration
 	
-	// LastSync 是最后一次成功同步的时间
-	LastSync time.Time
+	// lastSync 是最后一次成功同步的时间，通过LastSyncTime读取
+	lastSync time.Time
 	
-	// AutoSync 表示是否启用自动同步
-	AutoSync bool
+	// autoSync 表示是否启用自动同步，通过IsPeriodicSyncRunning读取
+	autoSync bool
 	
 	// stopChan 用于停止自动同步
 	stopChan chan struct{}
@@ -60,6 +62,262 @@ type NTPSync struct {
 	
 	// errorCount 是失败同步的次数
 	errorCount int64
+	
+	// events 向订阅者分发同步事件
+	events eventBus
+	
+	// serverOptions 是按服务器地址设置的单独配置
+	serverOptions map[string]ServerOptions
+	
+	// configPath 是加载配置的文件路径，用于Reload
+	configPath string
+	
+	// ctx 在实例关闭时被取消，用于中断进行中的请求
+	ctx context.Context
+	
+	// cancel 取消ctx
+	cancel context.CancelFunc
+	
+	// closed 表示实例是否已关闭
+	closed bool
+	
+	// asyncWaitGroup 跟踪后台执行的同步goroutine
+	asyncWaitGroup sync.WaitGroup
+	
+	// clock 是本地时间来源
+	clock Clock
+	
+	// iburst 表示启动定时同步时是否执行快速初始同步
+	iburst bool
+	
+	// serverOffsets 是每个服务器最近的偏移量样本，用于计算抖动
+	serverOffsets map[string]*offsetWindow
+	
+	// systemOffsets 是最近应用的偏移量样本，用于计算整体抖动
+	systemOffsets offsetWindow
+	
+	// history 保存最近的同步结果
+	history historyBuffer
+	
+	// selections 保存最近的服务器选择过程，数量不超过history的容量
+	selections []selectionRecord
+	
+	// outlierThreshold 是判定异常偏移量的MAD倍数，负值表示不检测异常值
+	outlierThreshold float64
+	
+	// consecutiveRejects 是连续被判定为异常值的次数
+	consecutiveRejects int
+	
+	// rejectedCount 是被判定为异常值的同步次数
+	rejectedCount int64
+	
+	// backoffInitial 是第一次失败后的重试等待时间
+	backoffInitial time.Duration
+	
+	// backoffMax 是失败重试等待时间的上限
+	backoffMax time.Duration
+	
+	// consecutiveFailures 是定时同步连续失败的次数
+	consecutiveFailures int
+	
+	// minPollInterval 是向同一服务器发送请求的最小间隔，不大于0表示不限速
+	minPollInterval time.Duration
+	
+	// lastPoll 是向每个服务器最后一次发送请求的时间
+	lastPoll map[string]time.Time
+	
+	// serverPolls 是按服务器提高的最小请求间隔和连续超时的次数
+	serverPolls map[string]serverPoll
+	
+	// reach 是没有启用多服务器支持时每个服务器地址的可达性寄存器，
+	// 启用时由服务器管理器记录
+	reach map[string]uint8
+	
+	// minForceSyncInterval 是两次ForceSyncNow之间的最小间隔，不大于0表示不限制
+	minForceSyncInterval time.Duration
+	
+	// lastForceSync 是最后一次被接受的ForceSyncNow的时间
+	lastForceSync time.Time
+	
+	// keys 是对称密钥认证使用的密钥
+	keys Keys
+	
+	// flight 是正在进行的同步，没有时为nil，由n.mutex保护
+	flight *syncFlight
+	
+	// versions 是与每个服务器自动协商的协议版本
+	versions map[string]versionState
+	
+	// ntpv5 表示是否启用了实验性的NTPv5支持
+	ntpv5 bool
+	
+	// sources 是优先于NTP服务器使用的时间源
+	sources []Source
+	
+	// monotonic 将偏移量锚定在单调时钟上，供Now使用
+	monotonic monotonicNow
+	
+	// snapshot 是Now使用的同步状态，从未同步时为nil
+	snapshot atomic.Pointer[nowSnapshot]
+	
+	// thresholds 是偏移量的调整阈值
+	thresholds thresholds
+	
+	// synced 在第一次同步成功时关闭，供WaitForSync等待
+	synced chan struct{}
+	
+	// maxDistance 是允许的最大根距离，不大于0表示不限制
+	maxDistance time.Duration
+	
+	// interleave 表示是否尝试使用交错模式
+	interleave bool
+	
+	// interleavedStates 是与每个服务器上一次交换的时间戳
+	interleavedStates map[string]interleavedState
+	
+	// extensions 是附加到版本4请求的扩展字段
+	extensions []ExtensionField
+	
+	// dialer 是用户提供的Dialer，设置后每次请求建立单独的连接
+	dialer Dialer
+	
+	// resolver 是用户提供的Resolver，nil表示使用net.DefaultResolver
+	resolver Resolver
+	
+	// srvDomain 是通过SRV记录发现服务器的域名，dhcpServers 表示是否使用DHCP提供的服务器，
+	// discovered 是其中由发现加入的服务器
+	srvDomain   string
+	dhcpServers bool
+	discovered  map[string]bool
+	
+	// hardwareClock 是同步成功后写入的硬件时钟，hardwareClockSet 是上次写入成功的本地时间，
+	// hardwareClockBusy 表示正在写入
+	hardwareClock         HardwareClock
+	hardwareClockInterval time.Duration
+	hardwareClockSet      time.Time
+	hardwareClockBusy     bool
+	
+	// onTimeDaemonConflict 和 refuseOnTimeDaemonConflict 决定UpdateSystemTime发现其它时间同步守护进程时的处理
+	onTimeDaemonConflict       func(daemons []TimeDaemon)
+	refuseOnTimeDaemonConflict bool
+	
+	// beforeStep 和 afterStep 在UpdateSystemTime调整系统时间之前和之后被调用，systemTime 设置系统时间
+	beforeStep func(step SystemTimeStep) error
+	afterStep  func(step SystemTimeStep, err error)
+	systemTime systemTimeSetter
+	
+	// socketConfig 是NTP套接字的源地址、网卡和DSCP设置
+	socketConfig socketConfig
+	
+	// restoreHardwareTimestamps 在关闭时恢复网卡原来的硬件时间戳设置，未启用硬件时间戳时为nil
+	restoreHardwareTimestamps func()
+	
+	// socket 是所有请求共用的UDP套接字，第一次请求时创建
+	socket *udpSocket
+	
+	// socketMutex 保护socket的创建和关闭
+	socketMutex sync.Mutex
+	
+	// probeSlots 限制同时进行的请求数量，nil表示不限制
+	probeSlots chan struct{}
+	
+	// dialTimeout 和 readTimeout 是解析地址和等待应答的超时时间，不大于0表示使用Timeout
+	dialTimeout time.Duration
+	readTimeout time.Duration
+	
+	// retryCount 和 retryBackoff 是等待应答超时后重新发送请求的次数和等待时间
+	retryCount   int
+	retryBackoff time.Duration
+	
+	// intervalJitter 是定时同步间隔随机调整的比例
+	intervalJitter float64
+	
+	// schedule 是定时同步的计划，nil表示按SyncInterval同步
+	schedule Schedule
+	
+	// resyncChan 唤醒定时同步循环立即重新同步
+	resyncChan chan struct{}
+	
+	// suspendedSinceSync 是最后一次同步后检测到的休眠时长，单调时钟没有计算这段时间
+	suspendedSinceSync time.Duration
+	
+	// drift 根据最近的偏移量估计本地时钟的频率偏差，供保持模式使用
+	drift driftEstimator
+	
+	// syncErrorBound 是最后一次应用的同步结果的误差上限
+	syncErrorBound time.Duration
+	
+	// holdoverAfter 是进入保持模式前允许的最长同步间隔，不大于0表示两倍的同步间隔
+	holdoverAfter time.Duration
+	
+	// localStratum 是本地时钟时间源的层级，0表示不回退到本地时钟
+	localStratum int
+	
+	// nextSync 是同步循环计划下一次同步的时间，用于判断同步循环是否仍然存活
+	nextSync time.Time
+	
+	// onPacket 是跟踪数据包的钩子，nil表示不跟踪
+	onPacket PacketHook
+	
+	// divergenceThreshold 是自动交叉检查的阈值，0表示不检查
+	divergenceThreshold time.Duration
+	
+	// denied 是以DENY或RSTR拒绝访问的服务器地址到拒绝期截止时间的映射
+	denied map[string]time.Time
+	
+	// store 在重启之间保存服务器状态，nil表示不保存
+	store Store
+	
+	// onStateLoadFailed 在从store加载状态失败时被调用
+	onStateLoadFailed func(err error)
+	
+	// clockCheck 是上次比较系统时间和单调时钟的时钟读数，用于发现系统时钟被外部调整
+	clockCheck clockReading
+	
+	// scheduler 是执行定时同步的共享调度器，nil表示使用单独的goroutine
+	scheduler *Scheduler
+	
+	// syncOnFirstUse 表示第一次调用Now时是否触发同步
+	syncOnFirstUse bool
+	
+	// firstUseWait 是第一次调用Now时等待同步完成的时长
+	firstUseWait time.Duration
+	
+	// firstUse 表示是否已经触发了第一次使用时的同步
+	firstUse atomic.Bool
+	
+	// maxStaleness 是最后一次成功同步允许的最长时效，不大于0表示不检查
+	maxStaleness time.Duration
+	
+	// staleResync 是最后一次因时效过长触发重新同步的本地时间（Unix纳秒）
+	staleResync atomic.Int64
+	
+	// failoverPolicy 是依次尝试服务器的故障切换策略
+	failoverPolicy FailoverPolicy
+	
+	// currentServer 是最近一次采用的服务器，FailoverSticky优先尝试它
+	currentServer string
+	
+	// rotation 是FailoverRoundRobin已经轮换的次数
+	rotation atomic.Uint64
+	
+	// combineServers 表示同步时是否测量所有服务器并合并它们的偏移量
+	combineServers bool
+	
+	// estimator 估计应用到Now的偏移量，nil表示直接使用测量的偏移量
+	estimator Estimator
+	
+	// huffPuff 是huff-n'-puff记录最小往返时间的窗口长度，不大于0表示不启用
+	huffPuff time.Duration
+	
+	// huffPuffFilters 按服务器记录窗口内的最小往返时间
+	huffPuffFilters map[string]*huffPuffFilter
+	
+	// sourceSamples 是每个服务器最近的偏移量样本，用于SourceStats
+	sourceSamples map[string]*sourceSamples
+	
+	// statsLog 把测量写入Options.StatsDir中的日志文件，nil表示不写入
+	statsLog *statsLog
 }
 
 // Options 包含NTPSync的配置选项
@@ -67,58 +325,565 @@ type Options struct {
 	// Servers 是NTP服务器地址列表
 	Servers []string
 	
-	// Timeout 是NTP请求的超时时间
+	// Timeout 是NTP请求的超时时间，也是DialTimeout和ReadTimeout的默认值
 	Timeout time.Duration
 	
+	// DialTimeout 是解析服务器地址和建立连接的超时时间，零值表示使用Timeout
+	// DNS解析可能比一次数据包交换需要更长的时间
+	DialTimeout time.Duration
+	
+	// ReadTimeout 是发送请求后等待应答的超时时间，零值表示使用Timeout
+	// 服务器单独配置的超时时间（ServerOptions.Timeout）优先
+	ReadTimeout time.Duration
+	
+	// RetryCount 是等待应答超时后重新发送请求的次数，零值表示不重新发送
+	// 设置后一个UDP数据包丢失不会使整个服务器的同步失败。
+	// 同一次同步中的重新发送不受MinPollInterval限制
+	RetryCount int
+	
+	// RetryBackoff 是第一次重新发送请求前的等待时间，之后每次加倍，
+	// 零值表示使用DefaultRetryBackoff
+	RetryBackoff time.Duration
+	
 	// SyncInterval 是自动同步的时间间隔
 	SyncInterval time.Duration
 	
+	// SyncIntervalJitter 将每次定时同步的等待时间随机调整±SyncIntervalJitter的比例，
+	// 例如0.1表示±10%，避免大量配置相同的设备在批量重启后同时向同一组服务器发送请求。
+	// 启动定时同步后的初始同步也随机推迟0到同步间隔的相应比例。取值范围为[0, 1)，零值表示不调整
+	SyncIntervalJitter float64
+	
+	// Schedule 是定时同步的计划，设置后成功同步之后在计划的时间再次同步，代替SyncInterval，
+	// 例如ParseSchedule("0,30 * * * *")在每个:00和:30同步。失败后仍然按退避时间重试，
+	// 不使用SyncIntervalJitter。nil表示按SyncInterval同步
+	Schedule Schedule
+	
 	// AutoSync 表示是否启用自动同步
 	AutoSync bool
 	
+	// SyncOnFirstUse 表示从未同步时第一次调用Now或NowWithBounds即在后台开始同步，
+	// 适合不启动定时同步、运行时间很短的命令行程序。只触发一次，失败后不自动重试
+	SyncOnFirstUse bool
+	
+	// FirstUseWait 是SyncOnFirstUse触发同步后，第一次调用Now最多等待同步完成的时长，
+	// 超时后返回未校准的时间，同步继续在后台进行。零值表示不等待
+	FirstUseWait time.Duration
+	
+	// MaxStaleness 是最后一次成功同步允许的最长时效，调用Now时超过此值即在后台重新同步，
+	// 保护长时间空闲、定时同步已经停止的进程。失败后至少间隔BackoffInitial再次尝试。
+	// 零值表示不检查，参见NowWithStaleness
+	MaxStaleness time.Duration
+	
+	// ResyncOnNetworkChange 表示是否监听网卡和路由的变化（Linux上使用netlink，
+	// 其它平台定期检查网卡地址），网络恢复后立即重新同步并重新探测所有服务器，
+	// 使蜂窝网络等不稳定链路上的设备尽快重新获得时间
+	ResyncOnNetworkChange bool
+	
+	// DetectSuspend 表示是否检测系统休眠和虚拟机暂停。单调时钟在休眠期间停止，
+	// 发现启动时钟（Linux的CLOCK_BOOTTIME，其它平台为系统时间）比单调时钟多走了SuspendThreshold以上时，
+	// 认为系统刚从休眠中恢复，按休眠时长修正Now并立即重新同步，因为休眠数小时后原来的偏移量已经不可信
+	DetectSuspend bool
+	
+	// DetectClockStep 表示是否定期检查系统时钟是否被其它程序直接调整。系统时间与单调时钟的
+	// 差异超过ClockStepThreshold时，按调整量修正偏移量（Now保持不变）并立即重新测量，
+	// 而不是在下一次同步之前一直报告过时的偏移量。未启用时也会在同步时检查：
+	// 偏移量恰好变化了调整量时修正已有的偏移量，新的结果不会被判定为异常值
+	DetectClockStep bool
+	
+	// HoldoverAfter 是所有同步都失败多久之后进入保持模式，默认为两倍的同步间隔。
+	// 保持模式下Now按根据最近同步估计的本地时钟频率偏差继续调整，
+	// 并通过GetHoldoverStatus提供估计的误差上限，而不是不加提示地提供越来越不准的时间
+	HoldoverAfter time.Duration
+	
+	// LocalStratum 不为0时，所有时间源和NTP服务器都同步失败后回退到本地时钟，
+	// 相当于ntpd的127.127.1.0：同步结果保持当前时间不变，层级为LocalStratum，参考ID为LOCL，
+	// 结果只记录到同步历史中，不更新最后一次同步的时间，保持模式和MaxStaleness照常生效。
+	// 取值范围为1到15，推荐DefaultLocalStratum
+	LocalStratum int
+	
 	// EnableMultiServer 表示是否启用多服务器支持
 	EnableMultiServer bool
+	
+	// FailoverPolicy 决定每次同步依次尝试服务器的顺序：FailoverBest（默认）总是从排名最高的服务器开始，
+	// FailoverSticky继续使用当前的服务器直到它失败，FailoverRoundRobin每次从下一个服务器开始。
+	// 只影响依次尝试服务器的同步，并行同步总是采用往返时间最短的服务器
+	FailoverPolicy FailoverPolicy
+	
+	// CombineServers 表示同步时像ntpd一样测量所有服务器，排除伪值服务器和离群的服务器后
+	// 合并留下的偏移量，而不是采用第一个成功的服务器，参见SyncWithMultiServerCombined。
+	// 每次同步向所有服务器各发送一个请求
+	CombineServers bool
+	
+	// Estimator 根据一系列测量估计应用到Now的偏移量，例如NewKalmanEstimator创建的Kalman滤波器。
+	// nil表示直接使用每次测量的偏移量。同步历史和事件中仍然是测量的偏移量
+	Estimator Estimator
+	
+	// HuffPuff 大于0时启用huff-n'-puff滤波器：记录每个服务器在这段时间内的最小往返时间，
+	// 往返时间超过最小值时认为多出的延迟来自单向的拥塞，按偏移量的符号修正多出延迟的一半。
+	// 适用于上行链路经常饱和的DSL或LTE设备，前提是本地时钟已经基本准确。推荐DefaultHuffPuff
+	HuffPuff time.Duration
+	
+	// ServerOptions 是按服务器地址设置的单独配置
+	ServerOptions map[string]ServerOptions
+	
+	// Clock 是本地时间来源，nil表示使用系统时间
+	Clock Clock
+	
+	// HistorySize 是保存的最近同步结果数量，零值表示使用DefaultHistorySize
+	HistorySize int
+	
+	// OutlierThreshold 是判定异常偏移量的阈值，以中位数绝对偏差(MAD)的倍数表示，
+	// 零值表示使用DefaultOutlierThreshold，负值表示不检测异常值
+	OutlierThreshold float64
+	
+	// BackoffInitial 是定时同步第一次失败后的重试等待时间，之后每次失败加倍，
+	// 零值表示使用DefaultBackoffInitial
+	BackoffInitial time.Duration
+	
+	// BackoffMax 是定时同步失败重试等待时间的上限，零值表示使用DefaultBackoffMax
+	BackoffMax time.Duration
+	
+	// HolddownThreshold 是启用多服务器支持时暂时排除服务器前允许的连续失败次数，
+	// 零值表示使用DefaultHolddownThreshold，负值表示不排除服务器
+	HolddownThreshold int
+	
+	// HolddownInterval 是服务器第一次被排除的时长，零值表示使用DefaultHolddownInterval
+	HolddownInterval time.Duration
+	
+	// MinPollInterval 是向同一服务器发送请求的最小间隔，零值表示使用DefaultMinPollInterval，
+	// 负值表示不限速。小于此值的同步间隔被提高到此值，使用pool.ntp.org服务器时被提高到PoolMinSyncInterval。
+	// 服务器回复RATE Kiss-o'-Death或连续超时后，单独提高向它发送请求的最小间隔，参见RaisedPollIntervals
+	MinPollInterval time.Duration
+	
+	// MinForceSyncInterval 是两次ForceSyncNow之间的最小间隔，间隔内的调用直接返回ErrRateLimited，
+	// 防止程序错误或频繁点击的同步按钮向服务器发送大量请求。零值或负值表示不限制，
+	// 此时仍然受MinPollInterval限制。网络变化和从休眠中恢复触发的重新同步不受此限制
+	MinForceSyncInterval time.Duration
+	
+	// IBurst 表示启动定时同步时是否先执行快速初始同步，
+	// 以BurstInterval为间隔连续发送BurstCount次请求，尽快获得可靠的时间
+	IBurst bool
+	
+	// ExperimentalNTPv5 启用实验性的NTPv5草案支持：自动协商版本的服务器
+	// 在版本4的应答中表示支持NTPv5后改用版本5，也可以为服务器指定Version5。
+	// 草案仍在变化，不建议在生产环境中启用
+	ExperimentalNTPv5 bool
+	
+	// PreferredSources 是优先于NTP服务器使用的时间源，例如ptp子包中的PTP客户端。
+	// 每次同步按顺序尝试这些时间源，都不可用时回退到NTP服务器。
+	// 在浏览器中（js/wasm）为空时使用页面所在网站的HTTPSource，Servers可以为空
+	PreferredSources []Source
+	
+	// MaxOffset 是允许应用的最大偏移量，相当于ntpd的panic阈值。
+	// 与当前偏移量的差超过此值时不应用同步结果，返回ErrOffsetTooLarge并发布EventOffsetTooLarge事件。
+	// 零值表示不限制，推荐值为DefaultMaxOffset
+	MaxOffset time.Duration
+	
+	// StepThreshold 是Now直接调整偏移量的阈值：偏移量的变化小于此值时
+	// 以500ppm的速率逐渐调整，Now不会回退；不小于此值时直接调整。
+	// 首次同步总是直接调整。零值表示总是直接调整，推荐值为DefaultStepThreshold
+	StepThreshold time.Duration
+	
+	// AllowLargeFirstOffset 表示首次同步不受MaxOffset限制，
+	// 用于RTC时间严重错误的设备首次启动，相当于ntpd的-g参数
+	AllowLargeFirstOffset bool
+	
+	// MaxDistance 是允许的最大根距离，根距离超过此值的服务器应答被拒绝，
+	// 同步改用下一个服务器。零值表示使用DefaultMaxDistance，负值表示不限制
+	MaxDistance time.Duration
+	
+	// Interleaved 启用交错模式（与chrony相同）：支持的服务器在下一次应答中给出
+	// 上一次应答实际发出的时间，消除服务器发送路径延迟带来的误差，不支持的服务器
+	// 照常以普通模式应答。请求中会带上上一次交换的时间戳，不符合RFC 9109
+	// 对客户端数据最小化的建议，因此默认不启用
+	Interleaved bool
+	
+	// Extensions 是附加到版本4请求的扩展字段，用于试验服务器支持的扩展功能，
+	// 应答中的扩展字段见SyncResult.Extensions
+	Extensions []ExtensionField
+	
+	// Dialer 用于建立到NTP服务器的UDP连接。设置后每次请求建立单独的连接；
+	// nil表示所有请求共用一个UDP套接字，按服务器地址和起始时间戳匹配应答
+	Dialer Dialer
+	
+	// Resolver 用于解析服务器的主机名，例如使用本地DNS服务器的*net.Resolver，
+	// 或者NewCachingResolver创建的带缓存的Resolver。设置了Dialer时先解析主机名，再以IP地址建立连接。
+	// nil表示使用net.DefaultResolver
+	Resolver Resolver
+	
+	// SRVDomain 非空时在创建实例时查询_ntp._udp.<SRVDomain>的SRV记录发现服务器，
+	// 例如"example.com"。发现的服务器按优先级和权重排在Servers之前，Servers作为后备；
+	// Servers为空时查询失败会使New返回错误。本地网络变化后重新同步时重新查询，参见Rediscover
+	SRVDomain string
+	
+	// DHCPServers 为true时在创建实例时读取DHCP服务器通过option 42提供的NTP服务器，
+	// 使设备接入任何网络都使用当地指定的时间源，参见LookupDHCPServers。DHCP提供的服务器排在
+	// SRV记录发现的服务器和Servers之前；Servers为空时读取失败会使New返回错误。
+	// 本地网络变化后重新同步时重新读取。目前只支持Linux
+	DHCPServers bool
+	
+	// HardwareClock 非nil时在同步成功后把校准后的时间写入硬件时钟，使电池供电的RTC
+	// 在断电重启后也能提供准确的时间，例如RTCDevice("/dev/rtc0")。nil表示不写入
+	HardwareClock HardwareClock
+	
+	// HardwareClockInterval 是两次写入硬件时钟之间的最短间隔，零值表示使用DefaultHardwareClockInterval
+	HardwareClockInterval time.Duration
+	
+	// OnTimeDaemonConflict 在UpdateSystemTime发现其它时间同步守护进程（ntpd、chronyd、
+	// systemd-timesyncd、w32time等）正在运行时被调用，参见DetectTimeDaemons。
+	// 两个程序同时调整系统时钟会使时间来回振荡。nil表示不通知
+	OnTimeDaemonConflict func(daemons []TimeDaemon)
+	
+	// RefuseOnTimeDaemonConflict 为true时，发现其它时间同步守护进程后UpdateSystemTime不设置系统时间，
+	// 返回包装ErrTimeDaemonConflict的错误
+	RefuseOnTimeDaemonConflict bool
+	
+	// BeforeStep 在UpdateSystemTime调整系统时间之前被调用，参数是即将进行的调整，使数据库、
+	// 任务调度器等对时间敏感的程序先暂停写入或调度。返回错误时不调整，UpdateSystemTime返回
+	// 包装ErrStepVetoed的错误，也不调用AfterStep。nil表示不通知
+	BeforeStep func(step SystemTimeStep) error
+	
+	// AfterStep 在调整系统时间之后被调用，err为nil表示调整成功并通过了检查，否则系统时间已经
+	// 尽量恢复为调整前的时间线。用于恢复BeforeStep暂停的程序，或在失败时报警。nil表示不通知
+	AfterStep func(step SystemTimeStep, err error)
+	
+	// LocalAddr 是发送NTP请求使用的源IP地址，用于多网卡网关上的策略路由和防火墙规则
+	LocalAddr string
+	
+	// Interface 是发送NTP请求使用的网卡名称，例如"eth1"。目前只支持Linux
+	// （SO_BINDTODEVICE）。不能与Dialer同时使用
+	Interface string
+	
+	// HardwareTimestamps 为true时使用Interface网卡的硬件时间戳计算往返时间，在支持PTP的网卡上
+	// 可以达到10微秒以内的精度。New通过SIOCSHWTSTAMP让网卡为收发的数据包记录时间戳，Close时恢复原来的设置，
+	// 需要CAP_NET_ADMIN权限，网卡不支持时返回错误；没有取得硬件时间戳的交换仍使用软件时间戳。
+	// 目前只支持Linux，不能与Dialer或Clock同时使用
+	HardwareTimestamps bool
+	
+	// MaxConcurrentProbes 是同时向服务器发出的请求数量上限，用于限制并行同步、
+	// GetMultiServerStatus和ProbeAllServers在服务器很多时占用的资源。
+	// 零值表示使用DefaultMaxConcurrentProbes，负值表示不限制
+	MaxConcurrentProbes int
+	
+	// Keys 是对称密钥认证使用的密钥，通常由LoadKeysFile从ntpd的ntp.keys读取，
+	// 由ServerOptions.KeyID指定每个服务器使用的密钥。nil表示不认证
+	Keys Keys
+	
+	// ProbeInterval 是在后台探测所有服务器的间隔，与SyncInterval无关。每个间隔内依次探测
+	// 每个服务器一次，各服务器的探测均匀错开，使GetBestServer和同步时的服务器顺序基于最近的
+	// 可达性和往返时间；被抑制或拒绝的服务器不探测。探测结果只记录到服务器管理器，不调整时钟。
+	// 需要启用EnableMultiServer，不能小于服务器允许的最小请求间隔。零值表示不在后台探测
+	ProbeInterval time.Duration
+	
+	// DSCP 是NTP请求的差分服务代码点（0到63），例如DSCPExpeditedForwarding，
+	// 便于在工业网络中优先转发时间同步流量。零值表示不设置。目前只支持Linux，
+	// 不能与Dialer同时使用
+	DSCP int
+	
+	// DivergenceThreshold 是服务器之间偏移量之差的上限，设置后每次定时同步之后测量所有服务器并两两比较，
+	// 超过时发布EventServersDiverged事件，用于发现被入侵或配置错误的内部时间服务器。
+	// 每次检查都会向所有服务器发送请求；零值表示不自动检查，参见CheckServerDivergence
+	DivergenceThreshold time.Duration
+	
+	// OnPacket 在每个NTP数据包发送后和收到后被调用，参数为方向、服务器地址、
+	// 原始数据和解析后的数据包，用于转储交换过程或交给外部工具分析。nil表示不跟踪
+	OnPacket PacketHook
+	
+	// Scheduler 是执行定时同步的共享调度器，参见NewScheduler。多个实例设置同一个调度器时
+	// 共用一个goroutine和一个定时器，而不是每个实例各占一个。nil表示使用单独的goroutine
+	Scheduler *Scheduler
+	
+	// Store 在重启之间保存服务器评分、故障抑制、KoD拒绝名单和最近的测量结果，
+	// 例如NewFileStore。创建实例时加载，每次定时同步之后和关闭时保存。nil表示不保存
+	Store Store
+	
+	// OnStateLoadFailed 在创建实例时从Store加载状态失败（例如状态文件损坏）时被调用。
+	// 加载失败的状态被丢弃，实例像从未保存过状态一样启动。nil表示不通知
+	OnStateLoadFailed func(err error)
+	
+	// StatsDir 非空时把每次测量和时钟调整写入该目录下按UTC日期轮换的文件：peerstats.YYYYMMDD记录
+	// 每个服务器的每次成功测量，loopstats.YYYYMMDD记录每次应用同步结果之后的偏移量和频率偏差，
+	// 与ntpd的statsdir相同，目录不存在时创建。写入失败时发布EventStatsWriteFailed事件
+	StatsDir string
+	
+	// StatsFormat 是测量日志的格式，零值表示StatsFormatNTPD
+	StatsFormat StatsFormat
+	
+	// StatsKeep 是测量日志保留的天数（包括当天），换到新的文件时删除更早的文件；零值表示全部保留
+	StatsKeep int
+}
+
+// ServerOptions 包含单个NTP服务器的配置选项
+type ServerOptions struct {
+	// Timeout 是该服务器请求的超时时间，零值表示使用全局超时时间
+	Timeout time.Duration
+	
+	// Version 是向该服务器发送请求使用的NTP版本（Version3、Version4，
+	// 或启用ExperimentalNTPv5后的Version5）。
+	// 零值表示自动协商：先使用DefaultVersion，服务器以版本3应答后改用版本3，
+	// 服务器从未应答时在版本4和版本3之间交替尝试
+	Version NTPVersion
+	
+	// KeyID 非零时使用Options.Keys中的该密钥认证请求和应答，对应ntp.conf中的"server ... key N"。
+	// 认证失败的应答返回包装ErrAuthentication的错误。不能与NTPv5同时使用
+	KeyID uint32
+	
+	// Asymmetry 是已知的固定路径非对称，即请求方向的单程延迟减去应答方向的单程延迟，
+	// 例如上下行经过不同卫星链路时。它使测得的偏移量偏大一半，测量后从偏移量中减去，
+	// 修正量记录在SyncResult.Asymmetry中
+	Asymmetry time.Duration
 }
 
 // New 创建一个新的NTPSync实例
 func New(opts Options) (*NTPSync, error) {
-	if len(opts.Servers) == 0 {
-		return nil, errors.New("必须提供至少一个NTP服务器")
-	}
-	
 	timeout := opts.Timeout
 	if timeout <= 0 {
 		timeout = DefaultTimeout
 	}
 	
+	// 通过DHCP和SRV记录发现的服务器排在配置的服务器之前
+	var discovered []DiscoveredServer
+	var discoveredSet map[string]bool
+	if opts.SRVDomain != "" || opts.DHCPServers {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		var err error
+		discovered, err = discover(ctx, opts.Resolver, opts.SRVDomain, opts.DHCPServers)
+		cancel()
+		if err != nil && len(discovered) == 0 && len(opts.Servers) == 0 {
+			return nil, err
+		}
+		opts.Servers, discoveredSet = mergeDiscovered(opts.Servers, nil, discovered)
+	}
+	
+	// 浏览器中不能发送UDP数据包，没有配置时间源时使用页面所在网站的HTTP(S)时间源，此时不需要NTP服务器
+	if !udpAvailable && len(opts.PreferredSources) == 0 {
+		opts.PreferredSources = []Source{NewHTTPSource(HTTPSourceOptions{URL: defaultHTTPSourceURL(), Clock: opts.Clock})}
+	}
+	
+	if len(opts.Servers) == 0 && udpAvailable {
+		return nil, errors.New("必须提供至少一个NTP服务器")
+	}
+	
 	syncInterval := opts.SyncInterval
 	if syncInterval <= 0 {
 		syncInterval = DefaultSyncInterval
 	}
 	
+	minPoll := opts.MinPollInterval
+	if minPoll == 0 {
+		minPoll = DefaultMinPollInterval
+	}
+	// 与SetPeriodicSyncInterval和AddServer一致，同步间隔被提高到服务器允许的最小值
+	syncInterval = max(syncInterval, minSyncInterval(opts.Servers, minPoll))
+	if err := validateServerOptions(opts.ServerOptions, opts.ExperimentalNTPv5, opts.Keys); err != nil {
+		return nil, err
+	}
+	
+	if err := validateIntervalJitter(opts.SyncIntervalJitter); err != nil {
+		return nil, err
+	}
+	if err := validateProbeInterval(opts.Servers, opts.ProbeInterval, minPoll, opts.EnableMultiServer); err != nil {
+		return nil, err
+	}
+	if err := validateLocalStratum(opts.LocalStratum); err != nil {
+		return nil, err
+	}
+	if err := validateFailoverPolicy(opts.FailoverPolicy); err != nil {
+		return nil, err
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	if err := validateSchedule(opts.Schedule, clock.Now()); err != nil {
+		return nil, err
+	}
+	if opts.Dialer != nil && (opts.LocalAddr != "" || opts.Interface != "" || opts.DSCP != 0 || opts.HardwareTimestamps) {
+		return nil, errors.New("不能同时设置Dialer和LocalAddr、Interface、DSCP或HardwareTimestamps")
+	}
+	socketConfig, err := newSocketConfig(opts.LocalAddr, opts.Interface, opts.DSCP)
+	if err != nil {
+		return nil, err
+	}
+	var stats *statsLog
+	if opts.StatsDir != "" {
+		if stats, err = newStatsLog(opts.StatsDir, opts.StatsFormat, opts.StatsKeep); err != nil {
+			return nil, err
+		}
+	} else if err := validateStatsFormat(opts.StatsFormat); err != nil {
+		return nil, err
+	}
+	var restoreHardwareTimestamps func()
+	if opts.HardwareTimestamps {
+		if restoreHardwareTimestamps, err = checkHardwareTimestamps(opts); err != nil {
+			if stats != nil {
+				stats.close()
+			}
+			return nil, err
+		}
+		socketConfig.hardwareTimestamps = true
+	}
+	
 	ntp := &NTPSync{
-		Servers:      opts.Servers,
-		Timeout:      timeout,
-		SyncInterval: syncInterval,
-		AutoSync:     opts.AutoSync,
-		stopChan:     make(chan struct{}),
+		servers:         opts.Servers,
+		timeout:         timeout,
+		syncInterval:    syncInterval,
+		stopChan:        make(chan struct{}),
+		resyncChan:      make(chan struct{}, 1),
+		holdoverAfter:   opts.HoldoverAfter,
+		localStratum:    opts.LocalStratum,
+		onPacket:        opts.OnPacket,
+		iburst:          opts.IBurst,
+		minPollInterval: minPoll,
+		ntpv5:           opts.ExperimentalNTPv5,
+		interleave:      opts.Interleaved,
+		extensions:      copyExtensions(opts.Extensions),
+		dialer:          opts.Dialer,
+		socketConfig:    socketConfig,
+		dialTimeout:     opts.DialTimeout,
+		readTimeout:     opts.ReadTimeout,
+		retryCount:      opts.RetryCount,
+		retryBackoff:    opts.RetryBackoff,
+		intervalJitter:  opts.SyncIntervalJitter,
+		schedule:        opts.Schedule,
+		sources:         append([]Source(nil), opts.PreferredSources...),
+		thresholds: thresholds{
+			maxOffset:             opts.MaxOffset,
+			stepThreshold:         opts.StepThreshold,
+			allowLargeFirstOffset: opts.AllowLargeFirstOffset,
+		},
+	}
+	ntp.serverOptions = copyServerOptions(opts.ServerOptions)
+	ntp.keys = copyKeys(opts.Keys)
+	ntp.divergenceThreshold = opts.DivergenceThreshold
+	ntp.minForceSyncInterval = opts.MinForceSyncInterval
+	ntp.syncOnFirstUse = opts.SyncOnFirstUse
+	ntp.firstUseWait = opts.FirstUseWait
+	ntp.maxStaleness = opts.MaxStaleness
+	ntp.failoverPolicy = opts.FailoverPolicy
+	ntp.combineServers = opts.CombineServers
+	ntp.estimator = opts.Estimator
+	ntp.huffPuff = opts.HuffPuff
+	ntp.statsLog = stats
+	ntp.store = opts.Store
+	ntp.onStateLoadFailed = opts.OnStateLoadFailed
+	ntp.scheduler = opts.Scheduler
+	ntp.resolver = opts.Resolver
+	ntp.srvDomain = opts.SRVDomain
+	ntp.dhcpServers = opts.DHCPServers
+	ntp.hardwareClock = opts.HardwareClock
+	ntp.onTimeDaemonConflict = opts.OnTimeDaemonConflict
+	ntp.refuseOnTimeDaemonConflict = opts.RefuseOnTimeDaemonConflict
+	ntp.beforeStep = opts.BeforeStep
+	ntp.afterStep = opts.AfterStep
+	ntp.systemTime = osSystemTime{}
+	ntp.hardwareClockInterval = opts.HardwareClockInterval
+	if ntp.hardwareClockInterval <= 0 {
+		ntp.hardwareClockInterval = DefaultHardwareClockInterval
+	}
+	ntp.discovered = discoveredSet
+	ntp.history = newHistoryBuffer(opts.HistorySize)
+	
+	if limit := opts.MaxConcurrentProbes; limit >= 0 {
+		if limit == 0 {
+			limit = DefaultMaxConcurrentProbes
+		}
+		ntp.probeSlots = make(chan struct{}, limit)
 	}
 	
+	ntp.maxDistance = opts.MaxDistance
+	if ntp.maxDistance == 0 {
+		ntp.maxDistance = DefaultMaxDistance
+	}
+	
+	ntp.backoffInitial = opts.BackoffInitial
+	if ntp.backoffInitial <= 0 {
+		ntp.backoffInitial = DefaultBackoffInitial
+	}
+	ntp.backoffMax = opts.BackoffMax
+	if ntp.backoffMax <= 0 {
+		ntp.backoffMax = DefaultBackoffMax
+	}
+	
+	ntp.outlierThreshold = opts.OutlierThreshold
+	if ntp.outlierThreshold == 0 {
+		ntp.outlierThreshold = DefaultOutlierThreshold
+	}
+	ntp.ctx, ntp.cancel = context.WithCancel(context.Background())
+	
+	ntp.clock = clock
+	ntp.restoreHardwareTimestamps = restoreHardwareTimestamps
+	
 	// 如果启用了多服务器支持，则初始化服务器管理器
 	if opts.EnableMultiServer {
 		var err error
 		ntp.serverManager, err = NewServerManager(opts.Servers, timeout)
 		if err != nil {
+			ntp.Close()
+			return nil, err
+		}
+		
+		threshold := opts.HolddownThreshold
+		if threshold == 0 {
+			threshold = DefaultHolddownThreshold
+		}
+		ntp.serverManager.SetHolddown(threshold, opts.HolddownInterval)
+		setPriorities(ntp.serverManager, discovered)
+	}
+	
+	// 恢复上次保存的服务器状态
+	ntp.loadState()
+	
+	if opts.ResyncOnNetworkChange {
+		if err := ntp.startNetworkWatch(); err != nil {
+			ntp.Close()
 			return nil, err
 		}
 	}
 	
+	if opts.DetectSuspend || opts.DetectClockStep {
+		ntp.goAsync(func() { ntp.watchClock(opts.DetectSuspend, opts.DetectClockStep) })
+	}
+	
+	if ntp.serverManager != nil && opts.ProbeInterval > 0 {
+		ntp.goAsync(func() { ntp.probeLoop(opts.ProbeInterval) })
+	}
+	
 	// 如果启用了自动同步，则启动定时同步
 	if opts.AutoSync {
 		if err := ntp.StartPeriodicSync(); err != nil {
+			ntp.Close()
 			return nil, err
 		}
 	}
 	
 	return ntp, nil
 }
+
+// copyServerOptions 复制按服务器设置的配置，防止外部修改
+func copyServerOptions(opts map[string]ServerOptions) map[string]ServerOptions {
+	copied := make(map[string]ServerOptions, len(opts))
+	for server, o := range opts {
+		copied[server] = o
+	}
+	return copied
+}
+
+// exchangeTimeouts 返回特定服务器解析地址和建立连接的超时时间，以及等待应答的超时时间
+// 等待应答时，服务器单独配置的超时时间优先于ReadTimeout；未设置的超时时间使用fallback
+func (n *NTPSync) exchangeTimeouts(server string, fallback time.Duration) (time.Duration, time.Duration) {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	
+	dialTimeout, readTimeout := fallback, fallback
+	if n.dialTimeout > 0 {
+		dialTimeout = n.dialTimeout
+	}
+	if n.readTimeout > 0 {
+		readTimeout = n.readTimeout
+	}
+	if o, ok := n.serverOptions[server]; ok && o.Timeout > 0 {
+		readTimeout = o.Timeout
+	}
+	return dialTimeout, readTimeout
+}
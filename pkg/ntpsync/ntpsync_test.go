@@ -1,8 +1,11 @@
 package ntpsync
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
 )
 
 // TestNew 测试创建新的NTPSync实例
@@ -22,12 +25,12 @@ func TestNew(t *testing.T) {
 		t.Fatal("NTPSync实例为nil")
 	}
 	
-	if len(ntp.Servers) != 1 {
-		t.Errorf("预期1个服务器，实际得到%d个", len(ntp.Servers))
+	if len(ntp.GetServers()) != 1 {
+		t.Errorf("预期1个服务器，实际得到%d个", len(ntp.GetServers()))
 	}
 	
-	if ntp.Timeout != 5*time.Second {
-		t.Errorf("预期超时时间为5秒，实际得到%v", ntp.Timeout)
+	if ntp.GetTimeout() != 5*time.Second {
+		t.Errorf("预期超时时间为5秒，实际得到%v", ntp.GetTimeout())
 	}
 	
 	// 测试没有服务器的情况
@@ -50,12 +53,12 @@ func TestNew(t *testing.T) {
 		t.Fatalf("创建NTPSync实例失败: %v", err)
 	}
 	
-	if ntp.Timeout != DefaultTimeout {
-		t.Errorf("预期默认超时时间，实际得到%v", ntp.Timeout)
+	if ntp.GetTimeout() != DefaultTimeout {
+		t.Errorf("预期默认超时时间，实际得到%v", ntp.GetTimeout())
 	}
 	
-	if ntp.SyncInterval != DefaultSyncInterval {
-		t.Errorf("预期默认同步间隔，实际得到%v", ntp.SyncInterval)
+	if ntp.GetPeriodicSyncInterval() != DefaultSyncInterval {
+		t.Errorf("预期默认同步间隔，实际得到%v", ntp.GetPeriodicSyncInterval())
 	}
 }
 
@@ -116,15 +119,15 @@ func TestSetInterval(t *testing.T) {
 	// 测试设置有效的间隔
 	ntp.SetSyncInterval(10 * time.Minute)
 	
-	if ntp.SyncInterval != 10*time.Minute {
-		t.Errorf("预期间隔为10分钟，实际得到%v", ntp.SyncInterval)
+	if ntp.GetPeriodicSyncInterval() != 10*time.Minute {
+		t.Errorf("预期间隔为10分钟，实际得到%v", ntp.GetPeriodicSyncInterval())
 	}
 	
 	// 测试设置无效的间隔
 	ntp.SetSyncInterval(-5 * time.Second)
 	
-	if ntp.SyncInterval != DefaultSyncInterval {
-		t.Errorf("预期无效值时使用默认间隔，实际得到%v", ntp.SyncInterval)
+	if ntp.GetPeriodicSyncInterval() != DefaultSyncInterval {
+		t.Errorf("预期无效值时使用默认间隔，实际得到%v", ntp.GetPeriodicSyncInterval())
 	}
 }
 
@@ -141,15 +144,15 @@ func TestSetTimeout(t *testing.T) {
 	// 测试设置有效的超时时间
 	ntp.SetTimeout(10 * time.Second)
 	
-	if ntp.Timeout != 10*time.Second {
-		t.Errorf("预期超时时间为10秒，实际得到%v", ntp.Timeout)
+	if ntp.GetTimeout() != 10*time.Second {
+		t.Errorf("预期超时时间为10秒，实际得到%v", ntp.GetTimeout())
 	}
 	
 	// 测试设置无效的超时时间
 	ntp.SetTimeout(-5 * time.Second)
 	
-	if ntp.Timeout != DefaultTimeout {
-		t.Errorf("预期无效值时使用默认超时时间，实际得到%v", ntp.Timeout)
+	if ntp.GetTimeout() != DefaultTimeout {
+		t.Errorf("预期无效值时使用默认超时时间，实际得到%v", ntp.GetTimeout())
 	}
 }
 
@@ -165,7 +168,7 @@ func TestNow(t *testing.T) {
 	
 	// 设置已知的偏移量
 	offset := 5 * time.Second
-	ntp.TimeOffset = offset
+	ntp.timeOffset = offset
 	
 	// 获取时间
 	ntpTime := ntp.Now()
@@ -207,26 +210,28 @@ func TestMultiServerSupport(t *testing.T) {
 }
 
 // TestPeriodicSync 测试定时同步功能
+// 使用假时钟驱动定时器，不需要真实等待同步间隔
 func TestPeriodicSync(t *testing.T) {
-	// 在短模式下跳过此测试
-	if testing.Short() {
-		t.Skip("在短模式下跳过定时同步测试")
-	}
+	clock := newFakeClock()
+	
+	// 使用与客户端共用假时钟的本地测试服务器
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
 	
 	// 创建一个没有自动同步的NTP客户端
 	ntp, err := New(Options{
-		Servers: []string{"pool.ntp.org"},
-		SyncInterval: 1 * time.Second, // 用于测试的短间隔
+		Servers: []string{srv.Addr()},
+		Timeout: 1 * time.Second,
+		SyncInterval: 2 * time.Second, // 用于测试的短间隔
 		AutoSync: false, // 确保不自动启动同步
+		Clock: clock,
 	})
 	
 	if err != nil {
 		t.Fatalf("创建NTPSync实例失败: %v", err)
 	}
 	
-	// 确保stopChan处于关闭状态
-	ntp.StopPeriodicSync()
-	
 	// 启动定时同步
 	err = ntp.StartPeriodicSync()
 	if err != nil {
@@ -238,8 +243,12 @@ func TestPeriodicSync(t *testing.T) {
 		t.Error("预期定时同步正在运行，实际得到false")
 	}
 	
-	// 等待几个同步周期
-	time.Sleep(3 * time.Second)
+	// 推进几个同步周期，每次都等待同步循环创建下一个定时器
+	for i := 0; i < 3; i++ {
+		clock.waitForTimers(t, 1)
+		clock.Advance(2 * time.Second)
+	}
+	clock.waitForTimers(t, 1)
 	
 	// 停止定时同步
 	ntp.StopPeriodicSync()
@@ -252,9 +261,73 @@ func TestPeriodicSync(t *testing.T) {
 	// 检查同步状态
 	status := ntp.GetPeriodicSyncStatus()
 	
-	// 应该至少有一次同步尝试
-	totalCount := status.SuccessCount + status.ErrorCount
-	if totalCount < 1 {
-		t.Errorf("预期至少有1次同步尝试，实际得到%d次", totalCount)
+	// 初始同步加上每个周期都应该有一次成功的同步
+	if status.SuccessCount != 4 || status.ErrorCount != 0 {
+		t.Errorf("预期4次成功同步，实际成功%d次、失败%d次", status.SuccessCount, status.ErrorCount)
+	}
+}
+
+// TestNewWithAutoSync 测试创建时启用自动同步
+func TestNewWithAutoSync(t *testing.T) {
+	ntp, err := New(Options{
+		Servers:  []string{"127.0.0.1:1"},
+		Timeout:  100 * time.Millisecond,
+		AutoSync: true,
+	})
+	if err != nil {
+		t.Fatalf("创建启用自动同步的实例失败: %v", err)
+	}
+	
+	if !ntp.IsPeriodicSyncRunning() {
+		t.Error("预期定时同步正在运行，实际得到false")
+	}
+	
+	// 重复启动应返回错误
+	if err := ntp.StartPeriodicSync(); err == nil {
+		t.Error("预期重复启动时返回错误，实际得到nil")
+	}
+	
+	ntp.StopPeriodicSync()
+	
+	if ntp.IsPeriodicSyncRunning() {
+		t.Error("预期定时同步已停止，实际得到true")
+	}
+}
+
+// TestLastSyncAge 测试距离最后一次同步的时长和同步状态
+func TestLastSyncAge(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: clock})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	
+	if age := ntp.LastSyncAge(); age != NeverSynced {
+		t.Errorf("预期从未同步时返回NeverSynced，实际得到%v", age)
+	}
+	if ntp.IsSynchronized(time.Hour) {
+		t.Error("预期从未同步时返回false")
+	}
+	
+	if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: time.Second}); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	clock.Advance(30 * time.Minute)
+	
+	if age := ntp.LastSyncAge(); age != 30*time.Minute {
+		t.Errorf("预期经过30分钟，实际得到%v", age)
+	}
+	if !ntp.IsSynchronized(time.Hour) {
+		t.Error("预期1小时内同步过时返回true")
+	}
+	if ntp.IsSynchronized(10 * time.Minute) {
+		t.Error("预期超过10分钟时返回false")
+	}
+	
+	// 默认使用两倍的同步间隔（2小时）
+	clock.Advance(2 * time.Hour)
+	if ntp.IsSynchronized(0) {
+		t.Error("预期超过两倍同步间隔时返回false")
 	}
 }
@@ -0,0 +1,46 @@
+// Package ntpsynctest 提供在测试中创建NTPSync实例的辅助函数。
+//
+// 它与ntptest分开，是因为ntpsync自身的测试依赖ntptest，ntptest不能反过来
+// 依赖ntpsync。dbus、mqtt、influx和statsd等导出器的测试使用这里的函数，
+// 不必各自重复启动测试服务器、创建实例和注册清理的代码。
+//
+//	ntp, srv := ntpsynctest.NewSyncedClient(t)
+//	srv.SetDrop(true)
+package ntpsynctest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// NewClient 创建一个只使用srv的NTPSync实例，测试结束时自动关闭。
+// 实例不限制向服务器发送请求的间隔，可以在测试中连续同步
+func NewClient(tb testing.TB, srv *ntptest.Server) *ntpsync.NTPSync {
+	tb.Helper()
+
+	ntp, err := ntpsync.New(ntpsync.Options{Servers: []string{srv.Addr()}, Timeout: 200 * time.Millisecond, MinPollInterval: -1})
+	if err != nil {
+		tb.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	tb.Cleanup(func() { ntp.Close() })
+	return ntp
+}
+
+// NewSyncedClient 启动一个偏移1秒的测试服务器，创建已经同步过一次的NTPSync实例，
+// 测试结束时自动关闭两者
+func NewSyncedClient(tb testing.TB) (*ntpsync.NTPSync, *ntptest.Server) {
+	tb.Helper()
+
+	srv := ntptest.NewServer()
+	tb.Cleanup(srv.Close)
+	srv.SetOffset(time.Second)
+
+	ntp := NewClient(tb, srv)
+	if err := ntp.Sync(); err != nil {
+		tb.Fatalf("同步失败: %v", err)
+	}
+	return ntp, srv
+}
@@ -0,0 +1,26 @@
+package ntpsynctest
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNewSyncedClient 测试返回的实例已经按测试服务器同步
+func TestNewSyncedClient(t *testing.T) {
+	ntp, srv := NewSyncedClient(t)
+
+	if !ntp.IsSynchronized(time.Minute) {
+		t.Fatal("预期实例已经同步")
+	}
+	if offset := ntp.TimeOffsetDuration(); offset < 900*time.Millisecond || offset > 1100*time.Millisecond {
+		t.Errorf("预期偏移量接近1秒，实际得到 %v", offset)
+	}
+
+	// 不受MinPollInterval限制，可以立即再次同步
+	if err := ntp.ForceSyncNow(); err != nil {
+		t.Fatalf("再次同步失败: %v", err)
+	}
+	if n := srv.RequestCount(); n < 2 {
+		t.Errorf("预期服务器至少收到2个请求，实际收到%d个", n)
+	}
+}
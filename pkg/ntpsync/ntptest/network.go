@@ -0,0 +1,215 @@
+package ntptest
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Network 是内存中的虚拟网络，实现ntpsync.Dialer，使测试完全不经过真实的网络。
+//
+// 请求在Write中同步交给目标服务器处理，应答立即放入连接等待读取；没有应答时
+// Read立即返回os.ErrDeadlineExceeded，而不是等待读取超时。网络延迟通过SetClock
+// 设置的advance推进测试时钟，与假时钟配合时，偏移量、往返时间、丢包和故障切换的结果
+// 都是确定的：
+//
+//	network := ntptest.NewNetwork()
+//	network.SetClock(clock.Now, clock.Advance)
+//	srv := network.NewServer("10.0.0.1:123")
+//	srv.SetDelay(20 * time.Millisecond)
+//	srv.Script(ntptest.Step{Drop: true}, ntptest.Step{KissCode: "RATE"})
+//
+//	ntp, _ := ntpsync.New(ntpsync.Options{Servers: []string{srv.Addr()}, Dialer: network, Clock: clock})
+type Network struct {
+	mutex     sync.Mutex
+	servers   map[string]*Server
+	now       func() time.Time
+	advance   func(time.Duration)
+	nextLocal uint16
+}
+
+// NewNetwork 创建一个没有服务器、使用真实时间的虚拟网络
+func NewNetwork() *Network {
+	return &Network{servers: make(map[string]*Server)}
+}
+
+// SetClock 设置网络使用的时钟：now是服务器的时间来源，advance在模拟网络延迟时
+// 推进时钟，例如假时钟的Advance方法。nil表示使用time.Now和time.Sleep
+func (nw *Network) SetClock(now func() time.Time, advance func(time.Duration)) {
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+
+	nw.now = now
+	nw.advance = advance
+}
+
+// NewServer 在虚拟网络的addr（"主机:端口"）上创建一个测试服务器，
+// 服务器的时间来源默认为网络的时钟，可以用SetNow单独设置
+func (nw *Network) NewServer(addr string) *Server {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		panic("ntptest: 无效的服务器地址: " + err.Error())
+	}
+
+	s := &Server{
+		addr:        addr,
+		stratum:     1,
+		referenceID: binary.BigEndian.Uint32([]byte("TEST")),
+		rootDelay:   defaultRoot,
+		rootDisp:    defaultRoot,
+		now:         nw.clockNow,
+	}
+
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+
+	if _, ok := nw.servers[addr]; ok {
+		panic("ntptest: 虚拟网络中已经有服务器 " + addr)
+	}
+	nw.servers[addr] = s
+	return s
+}
+
+// RemoveServer 从虚拟网络中移除服务器，之后发往该地址的请求都会丢失
+func (nw *Network) RemoveServer(addr string) {
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+
+	delete(nw.servers, addr)
+}
+
+// DialContext 创建到虚拟网络中address的数据报连接，只支持udp、udp4和udp6
+// 地址上没有服务器时连接仍然创建成功，与真实的UDP一样，发出的请求都会丢失
+func (nw *Network) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, fmt.Errorf("ntptest: 虚拟网络不支持%s", network)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, err
+	}
+
+	nw.mutex.Lock()
+	nw.nextLocal++
+	local := virtualAddr(fmt.Sprintf("10.255.0.1:%d", 1024+int(nw.nextLocal)))
+	nw.mutex.Unlock()
+
+	return &virtualConn{network: nw, local: local, remote: virtualAddr(address)}, nil
+}
+
+// clockNow 返回网络时钟的当前时间
+func (nw *Network) clockNow() time.Time {
+	nw.mutex.Lock()
+	now := nw.now
+	nw.mutex.Unlock()
+
+	if now == nil {
+		return time.Now()
+	}
+	return now()
+}
+
+// sleep 按网络时钟模拟一段延迟
+func (nw *Network) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	nw.mutex.Lock()
+	advance := nw.advance
+	nw.mutex.Unlock()
+
+	if advance == nil {
+		time.Sleep(d)
+		return
+	}
+	advance(d)
+}
+
+// server 返回地址上的服务器，没有时返回nil
+func (nw *Network) server(addr string) *Server {
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+
+	return nw.servers[addr]
+}
+
+// virtualAddr 是虚拟网络中的UDP地址
+type virtualAddr string
+
+func (a virtualAddr) Network() string { return "udp" }
+func (a virtualAddr) String() string  { return string(a) }
+
+// virtualConn 是虚拟网络中的数据报连接
+type virtualConn struct {
+	network *Network
+	local   virtualAddr
+	remote  virtualAddr
+
+	mutex   sync.Mutex
+	pending [][]byte
+	closed  bool
+}
+
+// Write 把请求交给目标服务器处理，服务器的应答放入连接等待读取
+func (c *virtualConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	closed := c.closed
+	c.mutex.Unlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+
+	s := c.network.server(string(c.remote))
+	if s == nil {
+		return len(b), nil
+	}
+	data := append([]byte(nil), b...)
+	resp := s.reply(c.local, c.network.clockNow(), data, c.network.sleep)
+	if resp != nil {
+		c.mutex.Lock()
+		c.pending = append(c.pending, resp)
+		c.mutex.Unlock()
+	}
+	return len(b), nil
+}
+
+// Read 读取下一个应答，没有应答时立即返回os.ErrDeadlineExceeded
+func (c *virtualConn) Read(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if len(c.pending) == 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+	resp := c.pending[0]
+	c.pending = c.pending[1:]
+	return copy(b, resp), nil
+}
+
+func (c *virtualConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	c.pending = nil
+	return nil
+}
+
+func (c *virtualConn) LocalAddr() net.Addr  { return c.local }
+func (c *virtualConn) RemoteAddr() net.Addr { return c.remote }
+
+// 虚拟连接上的读取从不阻塞，超时时间没有作用
+func (c *virtualConn) SetDeadline(t time.Time) error      { return nil }
+func (c *virtualConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *virtualConn) SetWriteDeadline(t time.Time) error { return nil }
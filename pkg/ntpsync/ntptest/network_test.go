@@ -0,0 +1,113 @@
+package ntptest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stepClock 是只有advance时才前进的测试时钟
+type stepClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *stepClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *stepClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// exchange 通过虚拟网络向addr发送一个请求，返回应答或读取的错误
+func exchange(t *testing.T, network *Network, addr string) ([]byte, error) {
+	t.Helper()
+
+	conn, err := network.DialContext(context.Background(), "udp", addr)
+	if err != nil {
+		t.Fatalf("连接虚拟服务器失败: %v", err)
+	}
+	defer conn.Close()
+
+	req := make([]byte, headerSize)
+	req[0] = 4<<3 | 3
+	if _, err := conn.Write(req); err != nil {
+		t.Fatalf("发送请求失败: %v", err)
+	}
+	resp := make([]byte, 128)
+	n, err := conn.Read(resp)
+	return resp[:n], err
+}
+
+// timestamp 解析64位NTP时间戳
+func timestamp(b []byte) time.Time {
+	v := binary.BigEndian.Uint64(b)
+	seconds := int64(v>>32) - ntpEpoch
+	nanos := (v & 0xFFFFFFFF) * 1e9 >> 32
+	return time.Unix(seconds, int64(nanos))
+}
+
+// TestNetworkDelay 测试虚拟网络按测试时钟模拟延迟，时间戳是确定的
+func TestNetworkDelay(t *testing.T) {
+	clock := &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	network := NewNetwork()
+	network.SetClock(clock.Now, clock.Advance)
+
+	srv := network.NewServer("10.0.0.1:123")
+	srv.SetDelay(100 * time.Millisecond)
+	srv.SetOffset(time.Second)
+
+	start := clock.Now()
+	resp, err := exchange(t, network, srv.Addr())
+	if err != nil {
+		t.Fatalf("读取应答失败: %v", err)
+	}
+	if got := clock.Now().Sub(start); got != 100*time.Millisecond {
+		t.Errorf("预期时钟前进100ms，实际前进了%v", got)
+	}
+	// NTP时间戳的精度约为0.2ns，比较时舍入到微秒
+	if got := timestamp(resp[32:40]).Sub(start).Round(time.Microsecond); got != time.Second+50*time.Millisecond {
+		t.Errorf("预期接收时间戳为请求发出50ms后加上偏移量，实际相差%v", got)
+	}
+	if got := srv.RequestCount(); got != 1 {
+		t.Errorf("预期服务器收到1个请求，实际得到%d个", got)
+	}
+}
+
+// TestNetworkScript 测试脚本依次作用于请求，用完后恢复按设置应答
+func TestNetworkScript(t *testing.T) {
+	network := NewNetwork()
+	srv := network.NewServer("10.0.0.1:123")
+	srv.Script(Step{Drop: true}, Step{KissCode: "RATE"})
+
+	if _, err := exchange(t, network, srv.Addr()); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("预期第一个请求丢失，实际得到%v", err)
+	}
+	resp, err := exchange(t, network, srv.Addr())
+	if err != nil || resp[1] != 0 || string(resp[12:16]) != "RATE" {
+		t.Errorf("预期第二个请求得到RATE，实际得到%v, %v", resp, err)
+	}
+	if resp, err := exchange(t, network, srv.Addr()); err != nil || resp[1] != 1 {
+		t.Errorf("预期脚本用完后正常应答，实际得到%v, %v", resp, err)
+	}
+
+	// 没有服务器的地址上请求都会丢失
+	network.RemoveServer(srv.Addr())
+	if _, err := exchange(t, network, srv.Addr()); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("预期移除服务器后请求丢失，实际得到%v", err)
+	}
+	if _, err := network.DialContext(context.Background(), "tcp", srv.Addr()); err == nil {
+		t.Error("预期不支持tcp")
+	}
+}
@@ -0,0 +1,553 @@
+// Package ntptest 提供用于测试的本地NTP服务器。
+//
+// Server在本地UDP端口上监听，按照可配置的层级、偏移量、延迟和
+// Kiss-o'-Death代码应答NTP请求，并记录收到的所有数据包，
+// 使集成测试不再依赖pool.ntp.org等公共服务器的可达性。
+//
+//	srv := ntptest.NewServer()
+//	defer srv.Close()
+//	srv.SetOffset(2 * time.Second)
+//
+//	ntp, _ := ntpsync.New(ntpsync.Options{Servers: []string{srv.Addr()}})
+//
+// Network是内存中的虚拟网络，其中的服务器不占用UDP端口，配合假时钟可以
+// 确定性地测试故障切换、退避和过滤算法，参见NewNetwork。
+package ntptest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"hash"
+	"net"
+	"sync"
+	"time"
+)
+
+// ntpEpoch 是1900-01-01到1970-01-01之间的秒数
+const ntpEpoch = 2208988800
+
+// headerSize 是NTP数据包头的长度
+const headerSize = 48
+
+// defaultRoot 是默认的根延迟和根离散度，即16.16定点数的0x100
+const defaultRoot = time.Second >> 8
+
+// Request 表示服务器收到的一个数据包
+type Request struct {
+	// From 是发送方的地址
+	From net.Addr
+
+	// Received 是服务器收到数据包的本地时间
+	Received time.Time
+
+	// Data 是数据包的原始内容
+	Data []byte
+
+	// Version 是数据包中的NTP版本号
+	Version uint8
+
+	// Mode 是数据包中的NTP模式
+	Mode uint8
+
+	// Transmit 是数据包中的发送时间戳（64位NTP格式）
+	Transmit uint64
+}
+
+// clientState 是交错模式下服务器为每个客户端保存的上一次交换
+type clientState struct {
+	// rx 是上一次请求的接收时间戳
+	rx uint64
+
+	// tx 是上一次应答实际发出的时间
+	tx time.Time
+}
+
+// Server 是一个用于测试的NTP服务器
+type Server struct {
+	// conn 是监听的UDP连接，虚拟网络中的服务器为nil，地址为addr
+	conn net.PacketConn
+	addr string
+
+	mutex       sync.Mutex
+	stratum     uint8
+	offset      time.Duration
+	delay       time.Duration
+	kissCode    string
+	referenceID uint32
+	leap        uint8
+	drop        bool
+	dropNext    int
+	maxVersion  uint8
+	ntpv5       bool
+	rootDelay   time.Duration
+	rootDisp    time.Duration
+	poll        int8
+	interleaved bool
+	txLatency   time.Duration
+	clients     map[string]clientState
+	extensions  []byte
+	keyID       uint32
+	keyType     string
+	key         []byte
+	now         func() time.Time
+	script      []Step
+	requests    []Request
+
+	wg sync.WaitGroup
+}
+
+// NewServer 创建并启动一个监听在127.0.0.1随机端口的测试服务器
+// 默认以层级1、参考ID "TEST"、零偏移、约4ms的根延迟和根离散度应答
+func NewServer() *Server {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		panic("ntptest: 监听UDP端口失败: " + err.Error())
+	}
+
+	s := &Server{
+		conn:        conn,
+		stratum:     1,
+		referenceID: binary.BigEndian.Uint32([]byte("TEST")),
+		rootDelay:   defaultRoot,
+		rootDisp:    defaultRoot,
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+// Addr 返回服务器的"主机:端口"地址
+func (s *Server) Addr() string {
+	if s.conn == nil {
+		return s.addr
+	}
+	return s.conn.LocalAddr().String()
+}
+
+// Close 停止服务器并等待处理中的请求完成
+func (s *Server) Close() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+	s.wg.Wait()
+}
+
+// SetStratum 设置应答中的层级
+func (s *Server) SetStratum(stratum uint8) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stratum = stratum
+}
+
+// SetOffset 设置服务器时钟相对本地时钟的偏移量
+func (s *Server) SetOffset(offset time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.offset = offset
+}
+
+// SetRootDelay 设置应答中的根延迟，即服务器到主参考源的往返延迟
+func (s *Server) SetRootDelay(delay time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.rootDelay = delay
+}
+
+// SetRootDispersion 设置应答中的根离散度，即服务器相对主参考源的最大误差
+func (s *Server) SetRootDispersion(dispersion time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.rootDisp = dispersion
+}
+
+// SetPoll 设置应答中的轮询间隔（以2为底的对数秒），零值表示原样返回请求中的值
+func (s *Server) SetPoll(poll int8) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.poll = poll
+}
+
+// SetInterleaved 设置是否支持交错模式：请求的起始时间戳与该客户端上一次请求的
+// 接收时间戳相同时，以上一次应答实际发出的时间作为发送时间戳应答
+func (s *Server) SetInterleaved(enabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.interleaved = enabled
+}
+
+// SetExtensions 设置附加在应答数据包头之后的原始字节，例如编码好的扩展字段
+// 只附加到版本4的应答，nil表示不附加
+func (s *Server) SetExtensions(data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.extensions = append([]byte(nil), data...)
+}
+
+// SetTransmitLatency 设置写入发送时间戳到应答实际发出之间的延迟，
+// 模拟服务器发送路径的延迟，普通模式的应答会因此产生偏差
+func (s *Server) SetTransmitLatency(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.txLatency = latency
+}
+
+// SetDelay 设置模拟的往返网络延迟，延迟在请求和应答方向上对称分布
+func (s *Server) SetDelay(delay time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.delay = delay
+}
+
+// SetKissCode 设置Kiss-o'-Death代码（如"RATE"、"DENY"）
+// 设置后服务器以层级0和该代码作为参考ID应答，空字符串表示正常应答
+func (s *Server) SetKissCode(code string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.kissCode = code
+}
+
+// SetReferenceID 设置应答中的参考ID
+func (s *Server) SetReferenceID(id uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.referenceID = id
+}
+
+// SetLeap 设置应答中的闰秒指示器
+func (s *Server) SetLeap(leap uint8) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.leap = leap & 0x3
+}
+
+// SetDrop 设置是否丢弃所有请求而不应答，用于模拟丢包或服务器不可达
+func (s *Server) SetDrop(drop bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.drop = drop
+}
+
+// SetDropNext 设置丢弃接下来的n个请求而不应答，用于模拟偶尔的丢包
+func (s *Server) SetDropNext(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.dropNext = n
+}
+
+// SetMaxVersion 设置服务器支持的最高NTP版本，版本号更高的请求会被丢弃而不应答，
+// 用于模拟只支持NTPv3的旧服务器；0表示不限制
+func (s *Server) SetMaxVersion(version uint8) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.maxVersion = version
+}
+
+// SetNTPv5 设置服务器是否支持NTPv5草案
+// 支持时，服务器在应答携带"NTP5NTP5"参考时间戳的版本4请求时原样返回该值，
+// 并按草案的数据包格式应答版本5的请求；不支持时丢弃版本5的请求
+func (s *Server) SetNTPv5(enabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.ntpv5 = enabled
+}
+
+// SetNow 设置服务器的时间来源，nil表示使用time.Now
+// 与客户端共用假时钟时，可以得到与真实时间无关的确定性应答
+func (s *Server) SetNow(now func() time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.now = now
+}
+
+// SetKey 设置对称密钥认证使用的密钥，keyType为"MD5"或"SHA1"，key为nil表示不认证
+// 设置后，以该密钥认证的请求得到带MAC的应答，摘要不匹配的请求得到crypto-NAK，
+// 没有使用该密钥的请求得到不带MAC的应答
+func (s *Server) SetKey(id uint32, keyType string, key []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.keyID = id
+	s.keyType = keyType
+	s.key = append([]byte(nil), key...)
+}
+
+// Step 是脚本中对一个请求的应答方式，在服务器当前设置的基础上生效，零值表示按设置应答
+type Step struct {
+	// Drop 表示丢弃该请求而不应答
+	Drop bool
+
+	// Delay 是在SetDelay之外增加的往返网络延迟
+	Delay time.Duration
+
+	// Offset 是在SetOffset之外增加的偏移量
+	Offset time.Duration
+
+	// KissCode 非空时以该Kiss-o'-Death代码应答
+	KissCode string
+}
+
+// Script 设置接下来的请求依次按steps应答，用完之后恢复按服务器的设置应答，
+// 用于编排故障切换、退避和过滤算法的测试场景。再次调用时替换尚未用完的脚本
+func (s *Server) Script(steps ...Step) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.script = append([]Step(nil), steps...)
+}
+
+// Requests 返回服务器收到的所有数据包的副本
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// RequestCount 返回服务器收到的数据包数量
+func (s *Server) RequestCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.requests)
+}
+
+// serve 接收并应答请求，直到连接关闭
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		received := time.Now()
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(addr, received, data)
+		}()
+	}
+}
+
+// handle 记录请求并按当前配置发送应答
+func (s *Server) handle(addr net.Addr, received time.Time, data []byte) {
+	if resp := s.reply(addr, received, data, time.Sleep); resp != nil {
+		_, _ = s.conn.WriteTo(resp, addr)
+	}
+}
+
+// reply 记录请求并按当前配置和脚本生成应答，不应答时返回nil
+// 网络延迟和发送路径的延迟通过sleep模拟
+func (s *Server) reply(addr net.Addr, received time.Time, data []byte, sleep func(time.Duration)) []byte {
+	req := Request{
+		From:     addr,
+		Received: received,
+		Data:     data,
+	}
+	if len(data) >= headerSize {
+		req.Version = (data[0] >> 3) & 0x7
+		req.Mode = data[0] & 0x7
+		req.Transmit = binary.BigEndian.Uint64(data[40:48])
+	}
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, req)
+	stratum := s.stratum
+	offset := s.offset
+	delay := s.delay
+	kissCode := s.kissCode
+	referenceID := s.referenceID
+	leap := s.leap
+	drop := s.drop
+	if s.dropNext > 0 {
+		s.dropNext--
+		drop = true
+	}
+	maxVersion := s.maxVersion
+	ntpv5 := s.ntpv5
+	rootDelay := s.rootDelay
+	rootDisp := s.rootDisp
+	poll := s.poll
+	interleaved := s.interleaved
+	txLatency := s.txLatency
+	extensions := s.extensions
+	keyID, keyType, key := s.keyID, s.keyType, s.key
+	now := s.now
+	if len(s.script) > 0 {
+		step := s.script[0]
+		s.script = s.script[1:]
+		drop = drop || step.Drop
+		delay += step.Delay
+		offset += step.Offset
+		if step.KissCode != "" {
+			kissCode = step.KissCode
+		}
+	}
+	s.mutex.Unlock()
+
+	if now == nil {
+		now = time.Now
+	}
+
+	// 只应答客户端模式的请求
+	if drop || len(data) < headerSize || req.Mode != 3 {
+		return nil
+	}
+	if maxVersion != 0 && req.Version > maxVersion {
+		return nil
+	}
+	if req.Version == 5 && !ntpv5 {
+		return nil
+	}
+
+	// 请求方向的延迟
+	sleep(delay / 2)
+	rxTime := now().Add(offset)
+
+	resp := make([]byte, headerSize)
+	resp[0] = leap<<6 | req.Version<<3 | 4
+	resp[1] = stratum
+	resp[2] = data[2]
+	if poll != 0 {
+		resp[2] = byte(poll)
+	}
+	resp[3] = 0xEC // 精度约为2^-20秒
+	binary.BigEndian.PutUint32(resp[4:8], fixedPoint(rootDelay, 16))
+	binary.BigEndian.PutUint32(resp[8:12], fixedPoint(rootDisp, 16))
+	binary.BigEndian.PutUint32(resp[12:16], referenceID)
+	putTimestamp(resp[16:24], rxTime.Add(-time.Second))
+	copy(resp[24:32], data[40:48])
+	putTimestamp(resp[32:40], rxTime)
+
+	if req.Version == 5 {
+		// NTPv5：时间尺度、纪元和标志为零，参考ID被服务器Cookie取代，
+		// 原样返回客户端Cookie
+		// 根延迟和根离散度使用4.28定点数
+		copy(resp[4:16], make([]byte, 12))
+		binary.BigEndian.PutUint32(resp[8:12], fixedPoint(rootDelay, 28))
+		binary.BigEndian.PutUint32(resp[12:16], fixedPoint(rootDisp, 28))
+		binary.BigEndian.PutUint64(resp[16:24], 0x5345525645524B59)
+		copy(resp[24:32], data[24:32])
+	} else if ntpv5 && string(data[16:24]) == "NTP5NTP5" {
+		copy(resp[16:24], data[16:24])
+	}
+
+	if kissCode != "" {
+		resp[0] = 3<<6 | req.Version<<3 | 4
+		resp[1] = 0
+		code := []byte(kissCode + "    ")
+		copy(resp[12:16], code[:4])
+	}
+
+	putTimestamp(resp[40:48], now().Add(offset))
+
+	// 交错模式：起始时间戳回传客户端的接收时间戳，发送时间戳为上一次应答实际发出的时间
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if interleaved && req.Version != 5 {
+		s.mutex.Lock()
+		prev, ok := s.clients[host]
+		s.mutex.Unlock()
+		if origin := binary.BigEndian.Uint64(data[24:32]); ok && origin != 0 && origin == prev.rx {
+			copy(resp[24:32], data[32:40])
+			putTimestamp(resp[40:48], prev.tx)
+		}
+	}
+
+	// 发送路径的延迟和应答方向的网络延迟
+	sleep(txLatency)
+	if interleaved {
+		s.mutex.Lock()
+		if s.clients == nil {
+			s.clients = make(map[string]clientState)
+		}
+		s.clients[host] = clientState{rx: binary.BigEndian.Uint64(resp[32:40]), tx: now().Add(offset)}
+		s.mutex.Unlock()
+	}
+	sleep(delay / 2)
+
+	if req.Version == 4 {
+		resp = append(resp, extensions...)
+	}
+	if key != nil && req.Version != 5 {
+		resp = authenticate(resp, data, keyID, keyType, key)
+	}
+	return resp
+}
+
+// authenticate 检查请求末尾的MAC，请求使用该密钥且摘要匹配时在应答末尾追加MAC，
+// 摘要不匹配时追加crypto-NAK（只有4字节的零密钥ID）
+func authenticate(resp, req []byte, keyID uint32, keyType string, key []byte) []byte {
+	size := 4 + newHash(keyType).Size()
+	if len(req) < headerSize+size {
+		return resp
+	}
+	mac := req[len(req)-size:]
+	if binary.BigEndian.Uint32(mac) != keyID {
+		return resp
+	}
+	if subtle.ConstantTimeCompare(mac[4:], digest(keyType, key, req[:len(req)-size])) != 1 {
+		return append(resp, 0, 0, 0, 0)
+	}
+	sum := digest(keyType, key, resp)
+	resp = binary.BigEndian.AppendUint32(resp, keyID)
+	return append(resp, sum...)
+}
+
+// newHash 返回keyType对应的摘要算法，未知的类型按MD5处理
+func newHash(keyType string) hash.Hash {
+	if keyType == "SHA1" {
+		return sha1.New()
+	}
+	return md5.New()
+}
+
+// digest 计算ntpd使用的摘要，即摘要算法(密钥 || 数据包)
+func digest(keyType string, key, packet []byte) []byte {
+	h := newHash(keyType)
+	h.Write(key)
+	h.Write(packet)
+	return h.Sum(nil)
+}
+
+// fixedPoint 将时长编码为小数部分为frac位的32位定点秒数
+func fixedPoint(d time.Duration, frac uint) uint32 {
+	return uint32(uint64(d) << frac / uint64(time.Second))
+}
+
+// putTimestamp 将时间以64位NTP时间戳格式写入b
+func putTimestamp(b []byte, t time.Time) {
+	seconds := uint64(t.Unix() + ntpEpoch)
+	fraction := uint64(t.Nanosecond()) << 32 / 1e9
+	binary.BigEndian.PutUint64(b, seconds<<32|fraction)
+}
@@ -0,0 +1,121 @@
+package ntptest
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// query 向服务器发送一个客户端请求并返回应答
+func query(t *testing.T, addr string) []byte {
+	t.Helper()
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("连接服务器失败: %v", err)
+	}
+	defer conn.Close()
+
+	req := make([]byte, headerSize)
+	req[0] = 4<<3 | 3
+	binary.BigEndian.PutUint64(req[40:48], 0x0123456789ABCDEF)
+	if _, err := conn.Write(req); err != nil {
+		t.Fatalf("发送请求失败: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp := make([]byte, 128)
+	n, err := conn.Read(resp)
+	if err != nil {
+		t.Fatalf("读取应答失败: %v", err)
+	}
+	return resp[:n]
+}
+
+// TestServerResponse 测试服务器按配置应答并记录请求
+func TestServerResponse(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.SetStratum(3)
+	srv.SetOffset(time.Hour)
+
+	before := time.Now()
+	resp := query(t, srv.Addr())
+
+	if len(resp) != headerSize {
+		t.Fatalf("预期应答长度为%d，实际得到%d", headerSize, len(resp))
+	}
+	if mode := resp[0] & 0x7; mode != 4 {
+		t.Errorf("预期服务器模式，实际得到%d", mode)
+	}
+	if version := (resp[0] >> 3) & 0x7; version != 4 {
+		t.Errorf("预期版本号为4，实际得到%d", version)
+	}
+	if resp[1] != 3 {
+		t.Errorf("预期层级为3，实际得到%d", resp[1])
+	}
+	if origin := binary.BigEndian.Uint64(resp[24:32]); origin != 0x0123456789ABCDEF {
+		t.Errorf("预期原始时间戳为请求的发送时间戳，实际得到%#x", origin)
+	}
+
+	tx := binary.BigEndian.Uint64(resp[40:48])
+	txTime := time.Unix(int64(tx>>32)-ntpEpoch, 0)
+	if diff := txTime.Sub(before); diff < time.Hour-2*time.Second || diff > time.Hour+2*time.Second {
+		t.Errorf("预期发送时间戳偏移约1小时，实际偏移%v", diff)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("预期收到1个请求，实际得到%d个", len(requests))
+	}
+	if requests[0].Mode != 3 || requests[0].Version != 4 || requests[0].Transmit != 0x0123456789ABCDEF {
+		t.Errorf("记录的请求与发送的不一致: %+v", requests[0])
+	}
+}
+
+// TestServerKissCode 测试Kiss-o'-Death应答
+func TestServerKissCode(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.SetKissCode("RATE")
+	resp := query(t, srv.Addr())
+
+	if resp[1] != 0 {
+		t.Errorf("预期层级为0，实际得到%d", resp[1])
+	}
+	if code := string(resp[12:16]); code != "RATE" {
+		t.Errorf("预期KoD代码为RATE，实际得到%q", code)
+	}
+}
+
+// TestServerDrop 测试丢弃请求
+func TestServerDrop(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.SetDrop(true)
+
+	conn, err := net.Dial("udp", srv.Addr())
+	if err != nil {
+		t.Fatalf("连接服务器失败: %v", err)
+	}
+	defer conn.Close()
+
+	req := make([]byte, headerSize)
+	req[0] = 4<<3 | 3
+	if _, err := conn.Write(req); err != nil {
+		t.Fatalf("发送请求失败: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 128)); err == nil {
+		t.Error("预期没有应答，实际收到了应答")
+	}
+
+	if srv.RequestCount() != 1 {
+		t.Errorf("预期记录1个请求，实际得到%d个", srv.RequestCount())
+	}
+}
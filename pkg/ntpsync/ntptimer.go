@@ -0,0 +1,99 @@
+package ntpsync
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 定时器的状态
+const (
+	timerPending int32 = iota
+	timerFired
+	timerStopped
+)
+
+// NTPTimer 是在NTP校准后的时间到达指定时刻时触发的定时器，用于让多台设备在
+// 同一个时刻执行任务。定时器按Now计算剩余的时长，同步、从休眠中恢复或系统时钟被调整后
+// 重新计算，本地时钟与NTP时间的偏差不会让它提前或推迟触发。实例关闭后定时器不再触发
+type NTPTimer struct {
+	// C 在定时器触发时收到当时的NTP时间，RunAt创建的定时器为nil
+	C <-chan time.Time
+
+	n     *NTPSync
+	at    time.Time
+	c     chan time.Time
+	fn    func()
+	state atomic.Int32
+	stop  chan struct{}
+}
+
+// NewNTPTimer 创建在NTP时间到达at时向C发送一次时间的定时器
+func (n *NTPSync) NewNTPTimer(at time.Time) *NTPTimer {
+	c := make(chan time.Time, 1)
+	t := &NTPTimer{C: c, n: n, at: at, c: c, stop: make(chan struct{})}
+	n.goAsync(t.run)
+	return t
+}
+
+// AfterNTP 返回NTP时间经过d之后收到时间的通道，相当于NewNTPTimer(Now().Add(d)).C
+func (n *NTPSync) AfterNTP(d time.Duration) <-chan time.Time {
+	return n.NewNTPTimer(n.Now().Add(d)).C
+}
+
+// RunAt 在NTP时间到达at时在单独的goroutine中调用fn，返回的定时器可以用Stop取消。
+// at已经过去时立即调用
+func (n *NTPSync) RunAt(at time.Time, fn func()) *NTPTimer {
+	t := &NTPTimer{n: n, at: at, fn: fn, stop: make(chan struct{})}
+	n.goAsync(t.run)
+	return t
+}
+
+// Stop 取消定时器，定时器已经触发或已经取消时返回false
+func (t *NTPTimer) Stop() bool {
+	if !t.state.CompareAndSwap(timerPending, timerStopped) {
+		return false
+	}
+	close(t.stop)
+	return true
+}
+
+// run 等待NTP时间到达触发时刻，每次收到同步等事件时重新计算剩余的时长
+func (t *NTPTimer) run() {
+	events, cancel := t.n.Subscribe(1)
+	defer cancel()
+
+	for {
+		remaining := t.at.Sub(t.n.Now())
+		if remaining <= 0 {
+			t.fire()
+			return
+		}
+
+		// 逐渐调整偏移量和保持模式的频率修正使NTP时间比本地时钟走得快，
+		// 少等待一点再重新计算，避免推迟触发
+		timer := t.n.clock.NewTimer(remaining - time.Duration(float64(remaining)*2*slewRate))
+		select {
+		case <-timer.C():
+		case <-events:
+			stopTimer(timer)
+		case <-t.stop:
+			stopTimer(timer)
+			return
+		case <-t.n.context().Done():
+			stopTimer(timer)
+			return
+		}
+	}
+}
+
+// fire 触发定时器，已经取消时什么也不做
+func (t *NTPTimer) fire() {
+	if !t.state.CompareAndSwap(timerPending, timerFired) {
+		return
+	}
+	if t.fn != nil {
+		go t.fn()
+		return
+	}
+	t.c <- t.n.Now()
+}
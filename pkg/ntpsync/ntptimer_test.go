@@ -0,0 +1,100 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestAfterNTP 测试NTP时间经过指定时长后触发
+func TestAfterNTP(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: clock})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	ch := ntp.AfterNTP(10 * time.Second)
+	clock.waitForTimers(t, 1)
+	clock.Advance(5 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("预期定时器没有提前触发")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Advance(5 * time.Second)
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待定时器触发超时")
+	}
+}
+
+// TestRunAtOffsetChange 测试同步改变偏移量之后按新的NTP时间触发
+func TestRunAtOffsetChange(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(5 * time.Second)
+
+	ntp, err := New(Options{Servers: []string{srv.Addr()}, Timeout: time.Second, Clock: clock})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	fired := make(chan struct{})
+	ntp.RunAt(ntp.Now().Add(10*time.Second), func() { close(fired) })
+	clock.waitForTimers(t, 1)
+
+	// 同步之后NTP时间前进了5秒，只需再等待5秒
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	clock.Advance(5 * time.Second)
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("预期偏移量改变之后按新的NTP时间触发")
+	}
+}
+
+// TestNTPTimerStop 测试取消定时器
+func TestNTPTimerStop(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: clock})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	fired := make(chan struct{})
+	timer := ntp.RunAt(clock.Now().Add(time.Second), func() { close(fired) })
+	clock.waitForTimers(t, 1)
+	if !timer.Stop() {
+		t.Error("预期取消尚未触发的定时器返回true")
+	}
+	if timer.Stop() {
+		t.Error("预期再次取消返回false")
+	}
+
+	clock.Advance(2 * time.Second)
+	select {
+	case <-fired:
+		t.Error("预期取消的定时器不再触发")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// 已经过去的时刻立即触发
+	ch := ntp.NewNTPTimer(clock.Now().Add(-time.Second)).C
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("预期已经过去的时刻立即触发")
+	}
+}
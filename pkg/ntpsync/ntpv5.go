@@ -0,0 +1,89 @@
+package ntpsync
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Version5 是NTPv5草案(draft-ietf-ntp-ntpv5)的版本号
+// 只有启用Options.ExperimentalNTPv5后才能使用，数据包格式可能随草案变化
+const Version5 NTPVersion = 5
+
+// NTPv5数据包中的时间尺度
+const (
+	TimescaleUTC        uint8 = 0 // 协调世界时
+	TimescaleTAI        uint8 = 1 // 国际原子时
+	TimescaleUT1        uint8 = 2 // 世界时
+	TimescaleSmearedUTC uint8 = 3 // 闰秒平滑的协调世界时
+)
+
+// ntpv5Magic 是NTPv4请求和应答中表示支持NTPv5的参考时间戳("NTP5NTP5")
+// 客户端在版本4的请求中携带该值，支持NTPv5的服务器在应答中原样返回，
+// 之后客户端改用版本5
+var ntpv5Magic = []byte("NTP5NTP5")
+
+// ErrNTPv5Unsupported 表示服务器没有以NTPv5应答版本5的请求
+var ErrNTPv5Unsupported = errors.New("服务器不支持NTPv5")
+
+// newClientCookie 生成NTPv5请求的客户端Cookie
+// 服务器在应答中原样返回该值，用于将应答与请求对应起来，取代NTPv4的原始时间戳
+func newClientCookie() []byte {
+	cookie := make([]byte, 8)
+	_, _ = rand.Read(cookie)
+	return cookie
+}
+
+// putNTPv5Request 填写NTPv5请求中版本4没有的字段
+// 请求不携带本地时间，发送时间戳保持为零
+func putNTPv5Request(req, cookie []byte) {
+	// 时间尺度(4)、纪元(5)和标志(6-7)为零，请求UTC时间
+	copy(req[24:32], cookie)
+}
+
+// checkNTPv5Response 检查NTPv5应答的客户端Cookie和时间尺度
+func checkNTPv5Response(resp, cookie []byte) error {
+	if !bytes.Equal(resp[24:32], cookie) {
+		return errors.New("NTPv5应答的客户端Cookie与请求不符")
+	}
+	if timescale := resp[4]; timescale != TimescaleUTC {
+		return fmt.Errorf("服务器返回不支持的时间尺度%d", timescale)
+	}
+	if flags := binary.BigEndian.Uint16(resp[6:8]); flags&0x4 != 0 {
+		return errors.New("服务器拒绝了NTPv5请求的认证")
+	}
+	return nil
+}
+
+// isNTPv5Capable 判断版本4的应答是否表示服务器支持NTPv5
+func isNTPv5Capable(resp []byte) bool {
+	return bytes.Equal(resp[16:24], ntpv5Magic)
+}
+
+// upgradeVersion 在服务器表示支持NTPv5后，之后的请求改用版本5
+// NTPv5请求曾经失败而降级过的服务器不再升级，避免在两个版本之间反复切换
+func (n *NTPSync) upgradeVersion(address string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.versions[address].downgraded {
+		return
+	}
+	if n.versions == nil {
+		n.versions = make(map[string]versionState)
+	}
+	n.versions[address] = versionState{version: Version5}
+}
+
+// downgradeVersion 在自动协商的NTPv5请求失败后改用版本4
+func (n *NTPSync) downgradeVersion(address string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.versions == nil {
+		n.versions = make(map[string]versionState)
+	}
+	n.versions[address] = versionState{version: Version4, downgraded: true}
+}
@@ -0,0 +1,146 @@
+package ntpsync
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// requestVersions 返回服务器收到的请求的版本号
+func requestVersions(srv *ntptest.Server) []uint8 {
+	var versions []uint8
+	for _, r := range srv.Requests() {
+		versions = append(versions, r.Version)
+	}
+	return versions
+}
+
+// TestNTPv5Negotiation 测试通过版本4的应答协商改用NTPv5
+func TestNTPv5Negotiation(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetNTPv5(true)
+	srv.SetOffset(2 * time.Second)
+
+	ntp, err := New(Options{
+		Servers:           []string{srv.Addr()},
+		Timeout:           time.Second,
+		Clock:             clock,
+		ExperimentalNTPv5: true,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("第%d次同步失败: %v", i+1, err)
+		}
+		clock.Advance(DefaultMinPollInterval)
+	}
+
+	if got := requestVersions(srv); !bytes.Equal(got, []byte{4, 5}) {
+		t.Fatalf("预期请求版本为[4 5]，实际得到%v", got)
+	}
+	if !bytes.Equal(srv.Requests()[0].Data[16:24], []byte("NTP5NTP5")) {
+		t.Error("预期版本4的请求携带NTPv5协商标记")
+	}
+
+	history := ntp.GetHistory(1)
+	if len(history) != 1 || history[0].Version != Version5 {
+		t.Fatalf("预期同步结果的版本为5，实际得到%+v", history)
+	}
+	if history[0].Offset != 2*time.Second {
+		t.Errorf("预期NTPv5偏移量为2秒，实际得到%v", history[0].Offset)
+	}
+}
+
+// TestNTPv5Downgrade 测试NTPv5请求失败后降级到版本4且不再升级
+func TestNTPv5Downgrade(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetNTPv5(true)
+
+	ntp, err := New(Options{
+		Servers:           []string{srv.Addr()},
+		Timeout:           100 * time.Millisecond,
+		Clock:             clock,
+		ExperimentalNTPv5: true,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 服务器表示支持NTPv5，但丢弃版本5的请求
+	srv.SetNTPv5(false)
+	clock.Advance(DefaultMinPollInterval)
+	if err := ntp.Sync(); err == nil {
+		t.Fatal("预期版本5的请求超时，实际得到nil")
+	}
+
+	srv.SetNTPv5(true)
+	for i := 0; i < 2; i++ {
+		clock.Advance(DefaultMinPollInterval)
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("降级后第%d次同步失败: %v", i+1, err)
+		}
+	}
+
+	if got := requestVersions(srv); !bytes.Equal(got, []byte{4, 5, 4, 4}) {
+		t.Errorf("预期请求版本为[4 5 4 4]，实际得到%v", got)
+	}
+}
+
+// TestNTPv5Disabled 测试没有启用NTPv5时不协商也不允许指定版本5
+func TestNTPv5Disabled(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetNTPv5(true)
+
+	_, err := New(Options{
+		Servers: []string{srv.Addr()},
+		ServerOptions: map[string]ServerOptions{
+			srv.Addr(): {Version: Version5},
+		},
+	})
+	if err == nil {
+		t.Error("预期没有启用NTPv5时指定版本5返回错误，实际得到nil")
+	}
+
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: time.Second,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("第%d次同步失败: %v", i+1, err)
+		}
+		clock.Advance(DefaultMinPollInterval)
+	}
+
+	if got := requestVersions(srv); !bytes.Equal(got, []byte{4, 4}) {
+		t.Errorf("预期请求版本为[4 4]，实际得到%v", got)
+	}
+	if bytes.Equal(srv.Requests()[0].Data[16:24], []byte("NTP5NTP5")) {
+		t.Error("预期没有启用NTPv5时请求不携带协商标记")
+	}
+}
@@ -0,0 +1,73 @@
+package ntpsync
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrOutlierRejected 表示测量的偏移量被判定为异常值而没有应用
+var ErrOutlierRejected = errors.New("偏移量被判定为异常值")
+
+// DefaultOutlierThreshold 是判定异常偏移量的默认MAD倍数
+const DefaultOutlierThreshold = 3.0
+
+// 异常值检测的参数
+const (
+	// outlierMinSamples 是开始检测异常值所需的最少样本数量
+	outlierMinSamples = 4
+
+	// outlierMaxRejects 是连续拒绝的最大次数，超过后接受新的偏移量
+	outlierMaxRejects = 3
+
+	// outlierMinDeviation 是MAD的下限，避免样本完全一致时拒绝微小的变化
+	outlierMinDeviation = time.Millisecond
+
+	// madScale 将MAD换算为正态分布下的标准差估计
+	madScale = 1.4826
+)
+
+// isOutlierLocked 判断偏移量是否偏离最近应用的偏移量分布过远
+// 调用者必须持有n.mutex
+func (n *NTPSync) isOutlierLocked(offset time.Duration) bool {
+	if n.outlierThreshold < 0 {
+		return false
+	}
+
+	samples := n.systemOffsets.values()
+	if len(samples) < outlierMinSamples {
+		return false
+	}
+
+	median := medianDuration(samples)
+	deviations := make([]time.Duration, len(samples))
+	for i, sample := range samples {
+		deviations[i] = absDuration(sample - median)
+	}
+
+	mad := time.Duration(float64(medianDuration(deviations)) * madScale)
+	if mad < outlierMinDeviation {
+		mad = outlierMinDeviation
+	}
+
+	return float64(absDuration(offset-median)) > n.outlierThreshold*float64(mad)
+}
+
+// medianDuration 返回样本的中位数，会对values排序
+func medianDuration(values []time.Duration) time.Duration {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// absDuration 返回时长的绝对值
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,99 @@
+package ntpsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestOutlierRejection 测试异常偏移量被拒绝，连续多次后被接受
+func TestOutlierRejection(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: time.Second,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	// 建立稳定的样本分布
+	for _, offset := range []time.Duration{10, 12, 11, 13, 12} {
+		srv.SetOffset(offset * time.Millisecond)
+		clock.Advance(DefaultMinPollInterval)
+		if err := ntp.ForceSyncNow(); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+	}
+
+	// 单次尖峰被拒绝，偏移量保持不变
+	srv.SetOffset(500 * time.Millisecond)
+	clock.Advance(DefaultMinPollInterval)
+	if err := ntp.ForceSyncNow(); !errors.Is(err, ErrOutlierRejected) {
+		t.Fatalf("预期返回ErrOutlierRejected，实际得到%v", err)
+	}
+	if got := ntp.TimeOffsetDuration(); got > 20*time.Millisecond {
+		t.Errorf("预期异常值没有被应用，实际偏移量为%v", got)
+	}
+
+	status := ntp.GetPeriodicSyncStatus()
+	if status.RejectedCount != 1 || status.ErrorCount != 0 {
+		t.Errorf("预期1次拒绝、0次失败，实际得到%d次拒绝、%d次失败", status.RejectedCount, status.ErrorCount)
+	}
+
+	history := ntp.GetHistory(1)
+	if len(history) != 1 || !history[0].Rejected {
+		t.Errorf("预期历史中标记了被拒绝的结果，实际得到%+v", history)
+	}
+
+	// 正常的样本仍然被接受
+	srv.SetOffset(11 * time.Millisecond)
+	clock.Advance(DefaultMinPollInterval)
+	if err := ntp.ForceSyncNow(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 持续的偏移量变化在连续拒绝outlierMaxRejects次后被接受
+	srv.SetOffset(500 * time.Millisecond)
+	for i := 0; i < outlierMaxRejects; i++ {
+		clock.Advance(DefaultMinPollInterval)
+		if err := ntp.ForceSyncNow(); !errors.Is(err, ErrOutlierRejected) {
+			t.Fatalf("预期第%d次返回ErrOutlierRejected，实际得到%v", i+1, err)
+		}
+	}
+	clock.Advance(DefaultMinPollInterval)
+	if err := ntp.ForceSyncNow(); err != nil {
+		t.Fatalf("预期连续拒绝后接受新的偏移量，实际得到%v", err)
+	}
+	if got := ntp.TimeOffsetDuration(); got < 499*time.Millisecond || got > 501*time.Millisecond {
+		t.Errorf("预期偏移量约为500ms，实际得到%v", got)
+	}
+}
+
+// TestOutlierDisabled 测试负阈值关闭异常值检测
+func TestOutlierDisabled(t *testing.T) {
+	ntp, err := New(Options{
+		Servers:          []string{"pool.ntp.org"},
+		OutlierThreshold: -1,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	for i := 0; i < outlierMinSamples; i++ {
+		if err := ntp.applyResult(&SyncResult{Offset: time.Millisecond}); err != nil {
+			t.Fatalf("应用结果失败: %v", err)
+		}
+	}
+	if err := ntp.applyResult(&SyncResult{Offset: time.Hour}); err != nil {
+		t.Errorf("预期关闭检测时接受任何偏移量，实际得到%v", err)
+	}
+}
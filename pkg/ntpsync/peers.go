@@ -0,0 +1,156 @@
+package ntpsync
+
+import (
+	"time"
+)
+
+// PeerSelection 表示服务器在选择中的状态，取值与chronyc sources的状态列相近
+type PeerSelection string
+
+// 服务器的选择状态
+const (
+	PeerSelected    PeerSelection = "*" // 最近一次应用的同步结果来自该服务器
+	PeerCandidate   PeerSelection = "+" // 可用的候选服务器
+	PeerRejected    PeerSelection = "x" // 最近的测量被判定为异常值或超过MaxOffset
+	PeerHeldDown    PeerSelection = "-" // 因连续失败被暂时排除
+	PeerUnreachable PeerSelection = "?" // 不可达或尚未测量
+)
+
+// PeerReport 汇总一个服务器的状态，类似chronyc sources的一行
+type PeerReport struct {
+	// Address 是配置的服务器地址
+	Address string `json:"address"`
+
+	// Selection 是服务器的选择状态
+	Selection PeerSelection `json:"selection"`
+
+	// Stratum 是服务器最后应答的层级
+	Stratum uint8 `json:"stratum"`
+
+	// ReferenceID 是服务器最后应答的参考ID
+	ReferenceID string `json:"reference_id,omitempty"`
+
+	// Reach 是可达性寄存器，参见ServerStatus.Reach
+	Reach uint8 `json:"reach"`
+
+	// LastPoll 是最后一次向服务器发送请求的时间，从未发送时为零值
+	LastPoll time.Time `json:"last_poll"`
+
+	// MinPoll 是因RATE Kiss-o'-Death或连续超时而提高的最小请求间隔，未提高时为零值
+	MinPoll time.Duration `json:"min_poll,omitempty"`
+
+	// Offset 是最后测量的偏移量
+	Offset time.Duration `json:"offset"`
+
+	// Delay 是最后测量的往返时间
+	Delay time.Duration `json:"delay"`
+
+	// Jitter 是最近样本中相邻偏移量之差的均方根
+	Jitter time.Duration `json:"jitter"`
+
+	// RootDistance 是最后测量的根距离
+	RootDistance time.Duration `json:"root_distance"`
+
+	// Score 是服务器的健康评分，只在启用多服务器支持时计算
+	Score float64 `json:"score"`
+}
+
+// GetPeers 按配置的顺序返回所有服务器的汇总状态，适合显示类似chronyc sources的表格
+// 只使用已有的测量结果，不会向服务器发送请求
+func (n *NTPSync) GetPeers() []PeerReport {
+	n.mutex.RLock()
+	servers := append([]string(nil), n.servers...)
+	history := n.history.last(0)
+	lastPoll := make(map[string]time.Time, len(servers))
+	minPoll := make(map[string]time.Duration, len(servers))
+	jitter := make(map[string]time.Duration, len(servers))
+	reach := make(map[string]uint8, len(servers))
+	for _, server := range servers {
+		address := serverAddress(server)
+		reach[server] = n.reach[address]
+		lastPoll[server] = n.lastPoll[address]
+		minPoll[server] = n.serverPolls[address].minPoll
+		if w, ok := n.serverOffsets[address]; ok {
+			jitter[server] = w.jitter()
+		}
+	}
+	n.mutex.RUnlock()
+
+	var statuses map[string]ServerStatus
+	if n.serverManager != nil {
+		statuses = make(map[string]ServerStatus)
+		for _, status := range n.serverManager.GetAllServerStatuses() {
+			statuses[status.Address] = status
+		}
+	}
+	now := n.clock.Now()
+
+	// 最近一次应用的结果来自哪个服务器
+	var selected string
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Error == nil && !history[i].Rejected {
+			selected = history[i].Server
+			break
+		}
+	}
+
+	peers := make([]PeerReport, 0, len(servers))
+	for _, server := range servers {
+		address := serverAddress(server)
+		peer := PeerReport{
+			Address:   server,
+			Selection: PeerUnreachable,
+			Reach:     reach[server],
+			LastPoll:  lastPoll[server],
+			MinPoll:   minPoll[server],
+			Jitter:    jitter[server],
+		}
+
+		// 该服务器最近的测量
+		var latest *SyncResult
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].Server == address {
+				latest = &history[i]
+				break
+			}
+		}
+		if latest != nil {
+			peer.Stratum = latest.Stratum
+			peer.ReferenceID = latest.ReferenceID
+			peer.Offset = latest.Offset
+			peer.Delay = latest.RTT
+			peer.RootDistance = latest.RootDistance
+			peer.Selection = PeerCandidate
+			if latest.Rejected {
+				peer.Selection = PeerRejected
+			}
+		}
+
+		// 服务器管理器记录了每次请求的结果，比历史更新
+		if status, ok := statuses[server]; ok {
+			peer.Reach = status.Reach
+			peer.Score = status.Score
+			if status.Reachable {
+				peer.Stratum = status.Stratum
+				peer.ReferenceID = status.ReferenceID
+				peer.Offset = status.Offset
+				peer.Delay = status.RTT
+				peer.RootDistance = status.RootDistance
+				if latest == nil || !latest.Rejected {
+					peer.Selection = PeerCandidate
+				}
+			} else {
+				peer.Selection = PeerUnreachable
+			}
+			if now.Before(status.HeldDownUntil) {
+				peer.Selection = PeerHeldDown
+			}
+		}
+
+		if address == selected && peer.Selection == PeerCandidate {
+			peer.Selection = PeerSelected
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
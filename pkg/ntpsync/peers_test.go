@@ -0,0 +1,64 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestGetPeers 测试汇总每个服务器的状态和选择状态
+func TestGetPeers(t *testing.T) {
+	first := ntptest.NewServer()
+	defer first.Close()
+	first.SetOffset(time.Second)
+
+	second := ntptest.NewServer()
+	defer second.Close()
+	second.SetStratum(3)
+
+	ntp, err := New(Options{
+		Servers:           []string{first.Addr(), second.Addr()},
+		Timeout:           time.Second,
+		EnableMultiServer: true,
+		MinPollInterval:   -1,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	for _, peer := range ntp.GetPeers() {
+		if peer.Selection != PeerUnreachable || !peer.LastPoll.IsZero() {
+			t.Errorf("预期尚未测量的服务器为%q，实际得到%+v", PeerUnreachable, peer)
+		}
+	}
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	peers := ntp.GetPeers()
+	if len(peers) != 2 {
+		t.Fatalf("预期2个服务器，实际得到%d个", len(peers))
+	}
+	if p := peers[0]; p.Address != first.Addr() || p.Selection != PeerSelected || p.Reach != 1 || p.LastPoll.IsZero() {
+		t.Errorf("预期第一个服务器为当前同步的服务器，实际得到%+v", p)
+	}
+	if p := peers[0]; p.Offset < 900*time.Millisecond || p.Offset > 1100*time.Millisecond || p.Delay <= 0 {
+		t.Errorf("预期记录了偏移量和往返时间，实际得到%+v", p)
+	}
+	if p := peers[1]; p.Selection != PeerUnreachable {
+		t.Errorf("预期第二个服务器尚未测量，实际得到%+v", p)
+	}
+
+	if err := ntp.serverManager.ProbeAllServers(ntp); err != nil {
+		t.Fatalf("探测服务器失败: %v", err)
+	}
+	peers = ntp.GetPeers()
+	if p := peers[0]; p.Selection != PeerSelected || p.Reach != 0b11 {
+		t.Errorf("预期第一个服务器仍为当前同步的服务器，实际得到%+v", p)
+	}
+	if p := peers[1]; p.Selection != PeerCandidate || p.Stratum != 3 || p.Reach != 1 {
+		t.Errorf("预期第二个服务器为候选服务器，实际得到%+v", p)
+	}
+}
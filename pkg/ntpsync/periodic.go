@@ -9,22 +9,35 @@ import (
 // PeriodicSyncStatus 表示定时同步的状态
 type PeriodicSyncStatus struct {
 	// Running 表示定时同步是否正在运行
-	Running bool
+	Running bool `json:"running"`
 	
 	// LastSync 是最后一次成功同步的时间
-	LastSync time.Time
+	LastSync time.Time `json:"last_sync"`
 	
 	// LastError 是同步过程中发生的最后一个错误
-	LastError error
+	LastError error `json:"-"`
 	
 	// Interval 是当前定时同步的时间间隔
-	Interval time.Duration
+	Interval time.Duration `json:"interval"`
 	
 	// SuccessCount 是成功同步的次数
-	SuccessCount int64
+	SuccessCount int64 `json:"success_count"`
 	
 	// ErrorCount 是失败同步的次数
-	ErrorCount int64
+	ErrorCount int64 `json:"error_count"`
+	
+	// ConsecutiveFailures 是连续失败的次数，大于0时定时同步处于退避状态
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	
+	// RejectedCount 是偏移量被判定为异常值而没有应用的次数
+	RejectedCount int64 `json:"rejected_count"`
+	
+	// Jitter 是最近应用的偏移量中相邻偏移量之差的均方根
+	Jitter time.Duration `json:"jitter"`
+	
+	// NextSync 是同步循环计划下一次同步的时间，同步进行中时为本次同步开始的时间
+	// 当前时间远超过NextSync说明同步循环已经卡住；定时同步没有运行时为零值
+	NextSync time.Time `json:"next_sync"`
 }
 
 // StartPeriodicSync 开始定时同步过程
@@ -32,37 +45,37 @@ func (n *NTPSync) StartPeriodicSync() error {
 	n.mutex.Lock()
 	defer n.mutex.Unlock()
 	
+	if n.closed {
+		return ErrClosed
+	}
+	
 	// 检查是否已经在运行
 	select {
 	case <-n.stopChan:
 		// 通道已关闭，需要重新创建
 		n.stopChan = make(chan struct{})
 	default:
-		// 通道是开放的，这意味着同步已经在运行
-		return errors.New("同步已经在运行中")
-	}
-	
-	// 执行初始同步
-	go func() {
-		err := n.Sync()
-		if err != nil {
-			atomic.AddInt64(&n.errorCount, 1)
-			n.mutex.Lock()
-			n.lastError = err
-			n.mutex.Unlock()
-		} else {
-			atomic.AddInt64(&n.successCount, 1)
-			n.mutex.Lock()
-			n.LastSync = time.Now()
-			n.mutex.Unlock()
+		// 通道是开放的。New创建的通道也是开放的，此时同步还没有启动，
+		// 因此只有已启用自动同步时才说明同步已经在运行
+		if n.autoSync {
+			return errors.New("同步已经在运行中")
 		}
-	}()
+	}
 	
-	// 启动同步goroutine
+	// 启动同步goroutine或加入共享调度器，初始同步由同步循环执行
+	delay := n.initialDelayLocked()
+	n.nextSync = n.clock.Now().Add(delay)
 	n.syncWaitGroup.Add(1)
-	go n.periodicSyncLoop()
+	if n.scheduler != nil {
+		if err := n.scheduler.add(n, delay); err != nil {
+			n.syncWaitGroup.Done()
+			return err
+		}
+	} else {
+		go n.periodicSyncLoop(delay)
+	}
 	
-	n.AutoSync = true
+	n.autoSync = true
 	return nil
 }
 
@@ -81,56 +94,136 @@ func (n *NTPSync) StopPeriodicSync() {
 		close(n.stopChan)
 	}
 	
-	n.AutoSync = false
+	n.autoSync = false
 	n.mutex.Unlock()
 	
 	// 等待同步循环退出
+	if n.scheduler != nil {
+		n.scheduler.remove(n)
+	}
 	n.syncWaitGroup.Wait()
 }
 
-// periodicSyncLoop 是定时同步的主循环
-func (n *NTPSync) periodicSyncLoop() {
+// periodicSyncLoop 是定时同步的主循环，初始同步在initial之后执行
+func (n *NTPSync) periodicSyncLoop(initial time.Duration) {
 	defer n.syncWaitGroup.Done()
 	
+	if initial > 0 {
+		timer := n.clock.NewTimer(initial)
+		select {
+		case <-timer.C():
+		case <-n.resyncChan:
+			// 网络或时钟发生变化，立即进行初始同步
+			stopTimer(timer)
+			n.scheduleNext(0)
+		case <-n.stopChan:
+			stopTimer(timer)
+			return
+		}
+	}
+	
+	delay, ok := n.firstCycle()
+	if !ok {
+		return
+	}
+	
 	for {
-		// 获取当前同步间隔
-		n.mutex.RLock()
-		interval := n.SyncInterval
-		n.mutex.RUnlock()
-		
 		// 为下一次同步创建定时器
-		timer := time.NewTimer(interval)
+		n.scheduleNext(delay)
+		timer := n.clock.NewTimer(delay)
 		
-		// 等待定时器或停止信号
+		// 等待定时器、重新同步或停止信号
 		select {
-		case <-timer.C:
+		case <-timer.C():
 			// 同步时间到
-			err := n.Sync()
-			if err != nil {
-				atomic.AddInt64(&n.errorCount, 1)
-				n.mutex.Lock()
-				n.lastError = err
-				n.mutex.Unlock()
-			} else {
-				atomic.AddInt64(&n.successCount, 1)
-				n.mutex.Lock()
-				n.LastSync = time.Now()
-				n.mutex.Unlock()
-			}
+			delay = n.runCycle()
+		case <-n.resyncChan:
+			// 网络或时钟发生变化，立即同步并重新探测服务器
+			stopTimer(timer)
+			n.scheduleNext(0)
+			delay = n.runCycle()
+			n.reprobe()
 		case <-n.stopChan:
 			// 请求停止
-			if !timer.Stop() {
-				// 如果定时器已经触发，则排空定时器通道
-				select {
-				case <-timer.C:
-				default:
-				}
-			}
+			stopTimer(timer)
 			return
 		}
 	}
 }
 
+// firstCycle 执行初始同步，返回到下一次同步的等待时间
+// 快速初始同步完成后再按同步间隔执行，快速初始同步被停止时ok为false
+func (n *NTPSync) firstCycle() (delay time.Duration, ok bool) {
+	n.mutex.RLock()
+	iburst := n.iburst
+	n.mutex.RUnlock()
+	
+	if !iburst {
+		return n.runCycle(), true
+	}
+	completed, err := n.initialBurst()
+	if !completed {
+		return 0, false
+	}
+	return n.nextDelay(err), true
+}
+
+// scheduleNext 记录同步循环将在delay之后执行下一次同步，delay为0表示同步立即开始
+func (n *NTPSync) scheduleNext(delay time.Duration) {
+	n.mutex.Lock()
+	n.nextSync = n.clock.Now().Add(delay)
+	n.mutex.Unlock()
+}
+
+// runCycle 执行一次定时同步，返回到下一次同步的等待时间
+func (n *NTPSync) runCycle() time.Duration {
+	err := n.coalesce(true)
+	n.checkDivergence()
+	_ = n.SaveState()
+	return n.nextDelay(err)
+}
+
+// nextDelay 根据本次同步的结果计算到下一次同步的等待时间
+// 同步成功时等待随机调整后的同步间隔，连续失败时按指数退避等待
+func (n *NTPSync) nextDelay(err error) time.Duration {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	
+	if err == nil || errors.Is(err, ErrOutlierRejected) {
+		n.consecutiveFailures = 0
+		
+		// 随机调整后仍然遵守服务器允许的最小同步间隔
+		minimum := minSyncInterval(n.servers, n.minPollInterval)
+		if n.schedule != nil {
+			return n.scheduledDelayLocked(minimum)
+		}
+		delay := jitterInterval(n.syncInterval, n.intervalJitter)
+		if delay < minimum {
+			delay = minimum
+		}
+		return delay
+	}
+	
+	n.consecutiveFailures++
+	return backoffDelay(n.backoffInitial, n.backoffMax, n.consecutiveFailures)
+}
+
+// scheduledDelayLocked 返回到同步计划中下一次同步的等待时间，跳过距离现在不足minimum的计划时间
+// 计划按校准后的时间计算，计划没有下一次同步时按同步间隔等待，调用者必须持有n.mutex
+func (n *NTPSync) scheduledDelayLocked(minimum time.Duration) time.Duration {
+	now := n.correctedLocked(n.clock.Now())
+	after := now
+	if minimum > 0 {
+		after = now.Add(minimum - time.Nanosecond)
+	}
+	
+	next := n.schedule.Next(after)
+	if next.IsZero() {
+		return n.syncInterval
+	}
+	return next.Sub(now)
+}
+
 // IsPeriodicSyncRunning 返回定时同步是否正在运行
 func (n *NTPSync) IsPeriodicSyncRunning() bool {
 	n.mutex.RLock()
@@ -140,7 +233,7 @@ func (n *NTPSync) IsPeriodicSyncRunning() bool {
 	case <-n.stopChan:
 		return false
 	default:
-		return n.AutoSync
+		return n.autoSync
 	}
 }
 
@@ -149,23 +242,57 @@ func (n *NTPSync) GetPeriodicSyncStatus() PeriodicSyncStatus {
 	n.mutex.RLock()
 	defer n.mutex.RUnlock()
 	
+	running := n.autoSync
+	select {
+	case <-n.stopChan:
+		running = false
+	default:
+	}
+	
 	status := PeriodicSyncStatus{
-		Running:      n.IsPeriodicSyncRunning(),
-		LastSync:     n.LastSync,
-		LastError:    n.lastError,
-		Interval:     n.SyncInterval,
-		SuccessCount: atomic.LoadInt64(&n.successCount),
-		ErrorCount:   atomic.LoadInt64(&n.errorCount),
+		Running:             running,
+		LastSync:            n.lastSync,
+		LastError:           n.lastError,
+		Interval:            n.syncInterval,
+		SuccessCount:        atomic.LoadInt64(&n.successCount),
+		ErrorCount:          atomic.LoadInt64(&n.errorCount),
+		RejectedCount:       atomic.LoadInt64(&n.rejectedCount),
+		ConsecutiveFailures: n.consecutiveFailures,
+		Jitter:              n.systemOffsets.jitter(),
+	}
+	if running {
+		status.NextSync = n.nextSync
 	}
 	
 	return status
 }
 
 // ForceSyncNow 强制立即同步
+// 已经有同步正在进行时不再发送请求，等待它完成并返回同一个结果；
+// 距离上次调用不足MinForceSyncInterval时返回ErrRateLimited
 func (n *NTPSync) ForceSyncNow() error {
-	err := n.Sync()
+	if n.isClosed() {
+		return ErrClosed
+	}
+	if err := n.reserveForceSync(); err != nil {
+		return err
+	}
 	
-	if err != nil {
+	return n.coalesce(true)
+}
+
+// recordSyncResult 更新同步的成功/失败计数和最后一个错误
+// 回退到本地时钟没有测量任何东西，既不计为成功也不计为失败
+func (n *NTPSync) recordSyncResult(err error) {
+	if errors.Is(err, errLocalClockSync) {
+		return
+	}
+	if errors.Is(err, ErrOutlierRejected) {
+		atomic.AddInt64(&n.rejectedCount, 1)
+		n.mutex.Lock()
+		n.lastError = err
+		n.mutex.Unlock()
+	} else if err != nil {
 		atomic.AddInt64(&n.errorCount, 1)
 		n.mutex.Lock()
 		n.lastError = err
@@ -173,11 +300,11 @@ func (n *NTPSync) ForceSyncNow() error {
 	} else {
 		atomic.AddInt64(&n.successCount, 1)
 		n.mutex.Lock()
-		n.LastSync = time.Now()
+		n.lastSync = n.clock.Now()
+		n.suspendedSinceSync = 0
+		n.publishLocked()
 		n.mutex.Unlock()
 	}
-	
-	return err
 }
 
 // SetPeriodicSyncInterval 设置定时同步的时间间隔
@@ -186,9 +313,15 @@ func (n *NTPSync) SetPeriodicSyncInterval(interval time.Duration) {
 		interval = DefaultSyncInterval
 	}
 	
+	// 不能低于当前服务器允许的最小同步间隔
 	n.mutex.Lock()
-	n.SyncInterval = interval
+	n.syncInterval = interval
+	n.clampSyncIntervalLocked()
+	interval = n.syncInterval
+	n.publishLocked()
 	n.mutex.Unlock()
+	
+	n.emit(Event{Type: EventIntervalChanged, Interval: interval})
 }
 
 // GetPeriodicSyncInterval 返回当前定时同步的时间间隔
@@ -196,5 +329,5 @@ func (n *NTPSync) GetPeriodicSyncInterval() time.Duration {
 	n.mutex.RLock()
 	defer n.mutex.RUnlock()
 	
-	return n.SyncInterval
+	return n.syncInterval
 }
@@ -0,0 +1,54 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// capSysTime 是CAP_SYS_TIME在能力位图中的位置
+const capSysTime = 25
+
+// canSetSystemTime 检查进程的有效能力集中是否有CAP_SYS_TIME
+// 没有挂载/proc时只能检查有效用户ID
+func canSetSystemTime() error {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		if euid := os.Geteuid(); euid != 0 {
+			return fmt.Errorf("%w: 有效用户ID为%d，不是root", ErrTimePermission, euid)
+		}
+		return nil
+	}
+	return checkCapSysTime(status, os.Geteuid())
+}
+
+// checkCapSysTime 根据/proc/self/status的内容判断进程能否设置系统时间
+func checkCapSysTime(status []byte, euid int) error {
+	caps, ok := effectiveCaps(status)
+	if !ok {
+		return fmt.Errorf("%w: 无法读取进程的能力集", ErrTimePermission)
+	}
+	if caps&(1<<capSysTime) != 0 {
+		return nil
+	}
+	if euid == 0 {
+		return fmt.Errorf("%w: 以root运行但缺少CAP_SYS_TIME能力，容器需要添加该能力（例如--cap-add SYS_TIME）", ErrTimePermission)
+	}
+	return fmt.Errorf("%w: 有效用户ID为%d，不是root，也没有CAP_SYS_TIME能力（可以用setcap cap_sys_time+ep授予）", ErrTimePermission, euid)
+}
+
+// effectiveCaps 解析/proc/self/status中的CapEff行
+func effectiveCaps(status []byte) (uint64, bool) {
+	for _, line := range bytes.Split(status, []byte("\n")) {
+		value, found := bytes.CutPrefix(line, []byte("CapEff:"))
+		if !found {
+			continue
+		}
+		caps, err := strconv.ParseUint(string(bytes.TrimSpace(value)), 16, 64)
+		return caps, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,39 @@
+package ntpsync
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestCheckCapSysTime 测试根据有效能力集中的CAP_SYS_TIME判断能否设置系统时间并说明原因
+func TestCheckCapSysTime(t *testing.T) {
+	const status = "Name:\tntpsync\nCapInh:\t0000000000000000\nCapPrm:\t%s\nCapEff:\t%s\n"
+
+	tests := []struct {
+		name   string
+		status string
+		euid   int
+		reason string
+	}{
+		{"root", strings.ReplaceAll(status, "%s", "000001ffffffffff"), 0, ""},
+		{"setcap授予的普通用户", strings.ReplaceAll(status, "%s", "0000000002000000"), 1000, ""},
+		{"去掉了能力的容器", strings.ReplaceAll(status, "%s", "00000000a80425fb"), 0, "--cap-add SYS_TIME"},
+		{"普通用户", strings.ReplaceAll(status, "%s", "0000000000000000"), 1000, "setcap"},
+		{"无法解析", "Name:\tntpsync\n", 0, "能力集"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCapSysTime([]byte(tt.status), tt.euid)
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("预期可以设置系统时间，实际得到%v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrTimePermission) || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("预期包含%q的ErrTimePermission，实际得到%v", tt.reason, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package ntpsync
+
+// canSetSystemTime 在不支持设置系统时间的平台上返回ErrSystemTimeUnsupported
+func canSetSystemTime() error {
+	return ErrSystemTimeUnsupported
+}
@@ -0,0 +1,16 @@
+//go:build unix && !linux
+
+package ntpsync
+
+import (
+	"fmt"
+	"os"
+)
+
+// canSetSystemTime 检查有效用户ID是否为root
+func canSetSystemTime() error {
+	if euid := os.Geteuid(); euid != 0 {
+		return fmt.Errorf("%w: 有效用户ID为%d，不是root", ErrTimePermission, euid)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package ntpsync
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// tokenElevation 是GetTokenInformation的TokenElevation信息类
+const tokenElevation = 20
+
+// canSetSystemTime 检查进程令牌是否已提升为管理员
+// 管理员在UAC下默认以未提升的令牌运行，没有SeSystemtimePrivilege
+func canSetSystemTime() error {
+	token, err := syscall.OpenCurrentProcessToken()
+	if err != nil {
+		return fmt.Errorf("%w: 无法打开进程令牌: %v", ErrTimePermission, err)
+	}
+	defer token.Close()
+
+	var elevated, size uint32
+	if err := syscall.GetTokenInformation(token, tokenElevation, (*byte)(unsafe.Pointer(&elevated)), uint32(unsafe.Sizeof(elevated)), &size); err != nil {
+		return fmt.Errorf("%w: 无法查询进程令牌: %v", ErrTimePermission, err)
+	}
+	if elevated == 0 {
+		return fmt.Errorf("%w: 进程没有以管理员身份运行（令牌未提升）", ErrTimePermission)
+	}
+	return nil
+}
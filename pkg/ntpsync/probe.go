@@ -0,0 +1,81 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxConcurrentProbes 是同时向服务器发出的请求数量的默认上限
+const DefaultMaxConcurrentProbes = 8
+
+// probeServer 在请求数量上限以内与服务器交换一次数据包，
+// 超过上限时等待其它请求完成，实例关闭时返回ErrClosed
+func (n *NTPSync) probeServer(server string, timeout time.Duration) (*SyncResult, error) {
+	if n.probeSlots != nil {
+		select {
+		case n.probeSlots <- struct{}{}:
+			defer func() { <-n.probeSlots }()
+		case <-n.context().Done():
+			return nil, ErrClosed
+		}
+	}
+	return n.syncWithServerBinary(server, timeout)
+}
+
+// validateProbeInterval 检查后台探测的间隔，零值表示不探测
+func validateProbeInterval(servers []string, interval, minPoll time.Duration, multiServer bool) error {
+	switch {
+	case interval == 0:
+		return nil
+	case interval < 0:
+		return fmt.Errorf("探测间隔%v不能为负数", interval)
+	case !multiServer:
+		return errors.New("后台探测需要启用多服务器支持")
+	}
+	if minimum := minSyncInterval(servers, minPoll); interval < minimum {
+		return fmt.Errorf("探测间隔%v小于允许的最小间隔%v", interval, minimum)
+	}
+	return nil
+}
+
+// probeLoop 每个interval依次探测每个服务器一次，探测之间间隔interval/服务器数量，
+// 使请求均匀分布而不是同时发出；加入pool.ntp.org服务器后间隔提高到其允许的最小值。
+// 实例关闭时返回
+func (n *NTPSync) probeLoop(interval time.Duration) {
+	ctx := n.context()
+	next := 0
+
+	for {
+		n.mutex.RLock()
+		count := len(n.servers)
+		round := max(interval, minSyncInterval(n.servers, n.minPollInterval))
+		n.mutex.RUnlock()
+
+		timer := n.clock.NewTimer(round / time.Duration(max(count, 1)))
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			stopTimer(timer)
+			return
+		}
+
+		// 服务器列表可能已经变化，按当前列表轮流探测
+		servers := n.GetServers()
+		if len(servers) == 0 {
+			continue
+		}
+		next %= len(servers)
+		n.probeScheduled(servers[next])
+		next++
+	}
+}
+
+// probeScheduled 探测一个服务器并把结果记录到服务器管理器，被抑制或拒绝的服务器不探测
+func (n *NTPSync) probeScheduled(server string) {
+	if len(n.availableServers([]string{server})) == 0 {
+		return
+	}
+	result, err := n.probeServer(server, n.serverManager.timeout)
+	n.recordServerResult(n.serverManager, server, result, err)
+}
@@ -0,0 +1,173 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// countingDialer 记录同时打开的连接数量的最大值
+type countingDialer struct {
+	mutex sync.Mutex
+	open  int
+	max   int
+}
+
+func (d *countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	d.open++
+	if d.open > d.max {
+		d.max = d.open
+	}
+	d.mutex.Unlock()
+	return &countedConn{Conn: conn, dialer: d}, nil
+}
+
+// countedConn 在关闭时减少打开的连接数量
+type countedConn struct {
+	net.Conn
+	dialer *countingDialer
+	once   sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		c.dialer.mutex.Lock()
+		c.dialer.open--
+		c.dialer.mutex.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// TestMaxConcurrentProbes 测试并行探测时同时进行的请求不超过上限
+func TestMaxConcurrentProbes(t *testing.T) {
+	var servers []string
+	for i := 0; i < 6; i++ {
+		srv := ntptest.NewServer()
+		defer srv.Close()
+		srv.SetDelay(40 * time.Millisecond)
+		servers = append(servers, srv.Addr())
+	}
+
+	dialer := &countingDialer{}
+	ntp, err := New(Options{
+		Servers:             servers,
+		Timeout:             time.Second,
+		MinPollInterval:     -1,
+		Dialer:              dialer,
+		MaxConcurrentProbes: 2,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	statuses, err := ntp.GetMultiServerStatus()
+	if err != nil {
+		t.Fatalf("获取服务器状态失败: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Reachable {
+			t.Errorf("预期服务器%s可达", status.Address)
+		}
+	}
+	if dialer.max != 2 {
+		t.Errorf("预期最多同时进行2个请求，实际为%d个", dialer.max)
+	}
+
+	// 等待请求数量上限时关闭实例立即返回
+	ntp.probeSlots <- struct{}{}
+	ntp.probeSlots <- struct{}{}
+	done := make(chan error, 1)
+	go func() {
+		_, err := ntp.probeServer(servers[0], time.Second)
+		done <- err
+	}()
+	ntp.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("预期返回ErrClosed，实际得到%v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("关闭实例后请求仍在等待")
+	}
+}
+
+// TestProbeInterval 测试后台探测在间隔内依次错开探测每个服务器，并据此更新最佳服务器
+func TestProbeInterval(t *testing.T) {
+	clock := newFakeClock()
+
+	a := ntptest.NewServer()
+	defer a.Close()
+	a.SetNow(clock.Now)
+	b := ntptest.NewServer()
+	defer b.Close()
+	b.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:           []string{a.Addr(), b.Addr()},
+		Timeout:           200 * time.Millisecond,
+		MinPollInterval:   -1,
+		EnableMultiServer: true,
+		ProbeInterval:     10 * time.Second,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	// 两个服务器的探测相隔半个间隔
+	clock.waitForTimers(t, 1)
+	clock.Advance(5 * time.Second)
+	waitForRequests(t, a, 1)
+	clock.waitForTimers(t, 1)
+	if got := b.RequestCount(); got != 0 {
+		t.Errorf("预期第一次只探测第一个服务器，实际第二个服务器收到%d个请求", got)
+	}
+	if status, err := ntp.serverManager.GetServerStatus(a.Addr()); err != nil || !status.Reachable {
+		t.Errorf("预期探测结果被记录，实际得到%+v, %v", status, err)
+	}
+
+	clock.Advance(5 * time.Second)
+	waitForRequests(t, b, 1)
+	clock.waitForTimers(t, 1)
+
+	// 下一轮第一个服务器不可达，最佳服务器随之改变
+	a.SetDrop(true)
+	clock.Advance(5 * time.Second)
+	waitForRequests(t, a, 2)
+	clock.waitForTimers(t, 1)
+	if best, err := ntp.serverManager.GetBestServer(); err != nil || best != b.Addr() {
+		t.Errorf("预期最佳服务器为%s，实际得到%s, %v", b.Addr(), best, err)
+	}
+	if got := b.RequestCount(); got != 1 {
+		t.Errorf("预期第二个服务器只被探测一次，实际收到%d个请求", got)
+	}
+}
+
+// TestProbeIntervalInvalid 测试无效的后台探测间隔
+func TestProbeIntervalInvalid(t *testing.T) {
+	for _, opts := range []Options{
+		{Servers: []string{"127.0.0.1:1"}, ProbeInterval: time.Minute},
+		{Servers: []string{"127.0.0.1:1"}, EnableMultiServer: true, ProbeInterval: -time.Minute},
+		{Servers: []string{"pool.ntp.org"}, EnableMultiServer: true, ProbeInterval: 10 * time.Second},
+	} {
+		if ntp, err := New(opts); err == nil {
+			ntp.Close()
+			t.Errorf("预期%+v返回错误", opts)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// Package ptp 实现IEEE 1588-2008 (PTPv2)普通时钟从端的时间测量，
+// 作为局域网中有PTP主时钟时的高精度时间源。
+//
+// Client使用软件时间戳：接收和发送时间在读写套接字前后由本地时钟记录，
+// 精度受操作系统调度影响，通常在数十微秒量级，仍明显优于经过路由的NTP。
+// Client实现了ntpsync.Source，通过ntpsync.Options.PreferredSources使用时，
+// 同步优先使用PTP，PTP域中没有主时钟时自动回退到NTP服务器：
+//
+//	src, err := ptp.New(ptp.Options{Interface: "eth0"})
+//	ntp, err := ntpsync.New(ntpsync.Options{
+//		Servers:          []string{"pool.ntp.org"},
+//		PreferredSources: []ntpsync.Source{src},
+//	})
+//
+// 监听标准的319和320端口需要相应的权限。
+package ptp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// PTP相关常量
+const (
+	// DefaultGroup 是PTP主要的IPv4组播地址
+	DefaultGroup = "224.0.1.129"
+
+	// EventPort 是事件消息(Sync、Delay_Req)的端口
+	EventPort = 319
+
+	// GeneralPort 是普通消息(Follow_Up、Delay_Resp、Announce)的端口
+	GeneralPort = 320
+
+	// DefaultTimeout 是上下文没有截止时间时一次测量的超时时间
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultUTCOffset 是主时钟没有在Announce中给出有效值时使用的TAI与UTC之差
+	DefaultUTCOffset = 37 * time.Second
+)
+
+// ErrTimeout 表示在超时时间内没有完成与主时钟的交换，通常说明域中没有主时钟
+var ErrTimeout = errors.New("没有收到PTP主时钟的消息")
+
+// Options 包含Client的配置选项
+type Options struct {
+	// Domain 是PTP域号
+	Domain uint8
+
+	// Interface 是接收组播消息的网络接口名，空字符串表示由系统选择
+	Interface string
+
+	// Group 是组播地址，空字符串表示使用DefaultGroup
+	Group string
+
+	// EventAddr 和 GeneralAddr 是本地监听的地址，空字符串表示使用标准端口
+	EventAddr   string
+	GeneralAddr string
+
+	// Master 是主时钟事件端口的单播地址。非空时不加入组播组，
+	// Delay_Req以单播发送给该地址，用于单播PTP和测试
+	Master string
+
+	// UTCOffset 是主时钟没有给出有效的TAI与UTC之差时使用的值，零值表示使用DefaultUTCOffset
+	UTCOffset time.Duration
+
+	// Now 是本地时间来源，nil表示使用time.Now
+	Now func() time.Time
+}
+
+// Client 是PTP从端
+type Client struct {
+	event     *net.UDPConn
+	general   *net.UDPConn
+	delayDest *net.UDPAddr
+	domain    uint8
+	identity  portIdentity
+	now       func() time.Time
+
+	// events 和 generals 接收两个端口上本域的消息
+	events   chan packet
+	generals chan packet
+	wg       sync.WaitGroup
+
+	// mutex 保证同一时间只进行一次测量
+	mutex    sync.Mutex
+	sequence uint16
+
+	// utcOffset 是TAI与UTC之差，单位为纳秒，由接收goroutine根据Announce更新
+	utcOffset atomic.Int64
+}
+
+// packet 是收到的一个PTP消息
+type packet struct {
+	header   header
+	data     []byte
+	received time.Time
+}
+
+// packetBuffer 是每个端口缓存的消息数量
+const packetBuffer = 16
+
+// New 创建PTP客户端并开始监听事件端口和普通端口
+func New(opts Options) (*Client, error) {
+	eventAddr, err := listenAddr(opts.EventAddr, EventPort)
+	if err != nil {
+		return nil, err
+	}
+	generalAddr, err := listenAddr(opts.GeneralAddr, GeneralPort)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		domain:   opts.Domain,
+		now:      opts.Now,
+		events:   make(chan packet, packetBuffer),
+		generals: make(chan packet, packetBuffer),
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+	utcOffset := opts.UTCOffset
+	if utcOffset == 0 {
+		utcOffset = DefaultUTCOffset
+	}
+	c.utcOffset.Store(int64(utcOffset))
+
+	// 时钟标识随机生成，端口号为1
+	if _, err := rand.Read(c.identity[:8]); err != nil {
+		return nil, fmt.Errorf("生成时钟标识失败: %v", err)
+	}
+	c.identity[9] = 1
+
+	if opts.Master != "" {
+		c.delayDest, err = net.ResolveUDPAddr("udp", opts.Master)
+		if err != nil {
+			return nil, fmt.Errorf("无效的PTP主时钟地址 %q: %v", opts.Master, err)
+		}
+		if c.event, err = net.ListenUDP("udp", eventAddr); err != nil {
+			return nil, fmt.Errorf("监听PTP事件端口失败: %v", err)
+		}
+		if c.general, err = net.ListenUDP("udp", generalAddr); err != nil {
+			c.event.Close()
+			return nil, fmt.Errorf("监听PTP普通端口失败: %v", err)
+		}
+		c.start()
+		return c, nil
+	}
+
+	group := opts.Group
+	if group == "" {
+		group = DefaultGroup
+	}
+	groupIP := net.ParseIP(group)
+	if groupIP == nil || !groupIP.IsMulticast() {
+		return nil, fmt.Errorf("无效的PTP组播地址 %q", group)
+	}
+
+	var ifi *net.Interface
+	if opts.Interface != "" {
+		if ifi, err = net.InterfaceByName(opts.Interface); err != nil {
+			return nil, fmt.Errorf("查找网络接口 %s 失败: %v", opts.Interface, err)
+		}
+	}
+
+	c.delayDest = &net.UDPAddr{IP: groupIP, Port: eventAddr.Port}
+	if c.event, err = net.ListenMulticastUDP("udp4", ifi, &net.UDPAddr{IP: groupIP, Port: eventAddr.Port}); err != nil {
+		return nil, fmt.Errorf("加入PTP组播组失败: %v", err)
+	}
+	if c.general, err = net.ListenMulticastUDP("udp4", ifi, &net.UDPAddr{IP: groupIP, Port: generalAddr.Port}); err != nil {
+		c.event.Close()
+		return nil, fmt.Errorf("加入PTP组播组失败: %v", err)
+	}
+	c.start()
+	return c, nil
+}
+
+// start 启动两个端口的接收goroutine
+func (c *Client) start() {
+	c.wg.Add(2)
+	go c.receive(c.event, c.events)
+	go c.receive(c.general, c.generals)
+}
+
+// receive 接收消息并在收到时记录本地时间，直到套接字关闭
+// 软件时间戳的精度取决于此处与数据包到达之间的间隔
+func (c *Client) receive(conn *net.UDPConn, ch chan<- packet) {
+	defer c.wg.Done()
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		received := c.now()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return
+		}
+
+		h, err := parseHeader(buf[:n])
+		if err != nil || h.domain != c.domain {
+			continue
+		}
+		if h.messageType == msgAnnounce && n >= announceSize && h.flags&flagUTCOffsetValid != 0 {
+			c.utcOffset.Store(int64(time.Duration(int16(binary.BigEndian.Uint16(buf[44:46]))) * time.Second))
+			continue
+		}
+
+		p := packet{header: h, data: append([]byte(nil), buf[:n]...), received: received}
+		select {
+		case ch <- p:
+		default:
+			// 没有进行测量时丢弃
+		}
+	}
+}
+
+// listenAddr 解析本地监听地址，空字符串表示在所有地址上监听标准端口
+func listenAddr(addr string, port int) (*net.UDPAddr, error) {
+	if addr == "" {
+		return &net.UDPAddr{Port: port}, nil
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的PTP监听地址 %q: %v", addr, err)
+	}
+	return udpAddr, nil
+}
+
+// Close 关闭客户端的套接字并等待接收goroutine退出
+func (c *Client) Close() error {
+	err := c.event.Close()
+	if gerr := c.general.Close(); err == nil {
+		err = gerr
+	}
+	c.wg.Wait()
+	return err
+}
+
+// Name 返回时间源的名称
+func (c *Client) Name() string {
+	return fmt.Sprintf("PTP域%d", c.domain)
+}
+
+// Measure 实现ntpsync.Source，与主时钟完成一次Sync/Delay_Req交换并计算偏移量
+func (c *Client) Measure(ctx context.Context) (*ntpsync.SyncResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	// 丢弃上次测量之后缓存的消息，只使用新的Sync
+	drain(c.events)
+	drain(c.generals)
+
+	// 主时钟发送Sync的时间t1和本地接收时间t2
+	syncMsg, err := c.wait(ctx, c.events, func(p packet) bool {
+		return p.header.messageType == msgSync && len(p.data) >= syncSize
+	})
+	if err != nil {
+		return nil, err
+	}
+	t1 := parseTimestamp(syncMsg.data[34:44]).Add(syncMsg.header.correction)
+	t2 := syncMsg.received
+
+	// 两步时钟的精确发送时间在Follow_Up中
+	if syncMsg.header.flags&flagTwoStep != 0 {
+		followUp, err := c.wait(ctx, c.generals, func(p packet) bool {
+			return p.header.messageType == msgFollowUp && len(p.data) >= syncSize &&
+				p.header.source == syncMsg.header.source && p.header.sequence == syncMsg.header.sequence
+		})
+		if err != nil {
+			return nil, err
+		}
+		t1 = parseTimestamp(followUp.data[34:44]).Add(syncMsg.header.correction + followUp.header.correction)
+	}
+
+	// 本地发送Delay_Req的时间t3和主时钟接收时间t4
+	c.sequence++
+	sequence := c.sequence
+	req := make([]byte, syncSize)
+	putHeader(req, msgDelayReq, syncSize, c.domain, c.identity, sequence)
+	t3 := c.now()
+	putTimestamp(req[34:44], t3)
+	if _, err := c.event.WriteToUDP(req, c.delayDest); err != nil {
+		return nil, fmt.Errorf("发送Delay_Req失败: %v", err)
+	}
+
+	resp, err := c.wait(ctx, c.generals, func(p packet) bool {
+		return p.header.messageType == msgDelayResp && len(p.data) >= delayRespSize &&
+			p.header.sequence == sequence && portIdentity(p.data[44:54]) == c.identity
+	})
+	if err != nil {
+		return nil, err
+	}
+	t4 := parseTimestamp(resp.data[34:44]).Add(-resp.header.correction)
+
+	// 主时钟使用TAI时间尺度，换算为UTC后计算
+	// 从端相对主时钟的偏移量 = ((t2 - t1) - (t4 - t3)) / 2
+	// 平均路径延迟 = ((t2 - t1) + (t4 - t3)) / 2
+	utcOffset := time.Duration(c.utcOffset.Load())
+	t1 = t1.Add(-utcOffset)
+	t4 = t4.Add(-utcOffset)
+	masterToSlave := t2.Sub(t1)
+	slaveToMaster := t4.Sub(t3)
+	offsetFromMaster := (masterToSlave - slaveToMaster) / 2
+	pathDelay := (masterToSlave + slaveToMaster) / 2
+	if pathDelay < 0 {
+		return nil, errors.New("PTP路径延迟为负值，可能在测量过程中发生了时钟调整")
+	}
+
+	return &ntpsync.SyncResult{
+		Server: c.Name(),
+		Time:   t2.Add(-offsetFromMaster),
+		Offset: -offsetFromMaster,
+		RTT:    2 * pathDelay,
+	}, nil
+}
+
+// wait 等待want返回true的消息
+func (c *Client) wait(ctx context.Context, ch <-chan packet, want func(packet) bool) (packet, error) {
+	for {
+		select {
+		case p := <-ch:
+			if want(p) {
+				return p, nil
+			}
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return packet{}, ErrTimeout
+			}
+			return packet{}, ctx.Err()
+		}
+	}
+}
+
+// drain 丢弃通道中缓存的消息
+func drain(ch <-chan packet) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package ptp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// testMaster 是一个用于测试的单播PTP主时钟
+type testMaster struct {
+	event    *net.UDPConn
+	general  *net.UDPConn
+	identity portIdentity
+	offset   time.Duration
+	twoStep  bool
+	done     chan struct{}
+}
+
+// newTestMaster 创建主时钟，offset是主时钟UTC时间相对本地时钟的偏移量
+func newTestMaster(t *testing.T, offset time.Duration, twoStep bool) *testMaster {
+	t.Helper()
+
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("监听UDP端口失败: %v", err)
+		}
+		return conn
+	}
+
+	m := &testMaster{
+		event:   listen(),
+		general: listen(),
+		offset:  offset,
+		twoStep: twoStep,
+		done:    make(chan struct{}),
+	}
+	copy(m.identity[:], "MASTER\x00\x00\x00\x01")
+	t.Cleanup(func() {
+		close(m.done)
+		m.event.Close()
+		m.general.Close()
+	})
+	return m
+}
+
+// taiNow 返回主时钟的TAI时间
+func (m *testMaster) taiNow() time.Time {
+	return time.Now().Add(m.offset + DefaultUTCOffset)
+}
+
+// run 向客户端周期性地发送Announce和Sync，并应答Delay_Req
+func (m *testMaster) run(c *Client) {
+	eventDest := c.event.LocalAddr().(*net.UDPAddr)
+	generalDest := c.general.LocalAddr().(*net.UDPAddr)
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := m.event.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			received := m.taiNow()
+			h, err := parseHeader(buf[:n])
+			if err != nil || h.messageType != msgDelayReq {
+				continue
+			}
+			resp := make([]byte, delayRespSize)
+			putHeader(resp, msgDelayResp, delayRespSize, h.domain, m.identity, h.sequence)
+			putTimestamp(resp[34:44], received)
+			copy(resp[44:54], h.source[:])
+			_, _ = m.general.WriteToUDP(resp, generalDest)
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+
+		var sequence uint16
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+			}
+			sequence++
+
+			announce := make([]byte, announceSize)
+			putHeader(announce, msgAnnounce, announceSize, 0, m.identity, sequence)
+			binary.BigEndian.PutUint16(announce[6:8], flagUTCOffsetValid)
+			binary.BigEndian.PutUint16(announce[44:46], uint16(DefaultUTCOffset/time.Second))
+			_, _ = m.general.WriteToUDP(announce, generalDest)
+
+			sync := make([]byte, syncSize)
+			putHeader(sync, msgSync, syncSize, 0, m.identity, sequence)
+			if m.twoStep {
+				binary.BigEndian.PutUint16(sync[6:8], flagTwoStep)
+			}
+			sent := m.taiNow()
+			putTimestamp(sync[34:44], sent)
+			_, _ = m.event.WriteToUDP(sync, eventDest)
+
+			if m.twoStep {
+				followUp := make([]byte, syncSize)
+				putHeader(followUp, msgFollowUp, syncSize, 0, m.identity, sequence)
+				putTimestamp(followUp[34:44], sent)
+				_, _ = m.general.WriteToUDP(followUp, generalDest)
+			}
+		}
+	}()
+}
+
+// newTestClient 创建以单播方式连接主时钟的客户端
+func newTestClient(t *testing.T, m *testMaster) *Client {
+	t.Helper()
+
+	c, err := New(Options{
+		EventAddr:   "127.0.0.1:0",
+		GeneralAddr: "127.0.0.1:0",
+		Master:      m.event.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatalf("创建PTP客户端失败: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// TestTimestamp 测试PTP时间戳的编码和解析
+func TestTimestamp(t *testing.T) {
+	want := time.Unix(1700000000, 123456789)
+	b := make([]byte, 10)
+	putTimestamp(b, want)
+	if got := parseTimestamp(b); !got.Equal(want) {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+}
+
+// TestMeasure 测试一步和两步主时钟的偏移量测量
+func TestMeasure(t *testing.T) {
+	for _, twoStep := range []bool{false, true} {
+		m := newTestMaster(t, 1500*time.Millisecond, twoStep)
+		c := newTestClient(t, m)
+		m.run(c)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		result, err := c.Measure(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("两步=%v: 测量失败: %v", twoStep, err)
+		}
+		if diff := result.Offset - 1500*time.Millisecond; diff < -20*time.Millisecond || diff > 20*time.Millisecond {
+			t.Errorf("两步=%v: 预期偏移量约为1.5秒，实际得到%v", twoStep, result.Offset)
+		}
+		if result.RTT < 0 {
+			t.Errorf("两步=%v: 往返时间为负值%v", twoStep, result.RTT)
+		}
+	}
+}
+
+// TestMeasureTimeout 测试域中没有主时钟时超时
+func TestMeasureTimeout(t *testing.T) {
+	m := newTestMaster(t, 0, false)
+	c := newTestClient(t, m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.Measure(ctx); !errors.Is(err, ErrTimeout) {
+		t.Errorf("预期返回ErrTimeout，实际得到%v", err)
+	}
+}
+
+// TestPreferredSource 测试PTP作为优先时间源，主时钟不可用时回退到NTP
+func TestPreferredSource(t *testing.T) {
+	m := newTestMaster(t, 2*time.Second, true)
+	c := newTestClient(t, m)
+	m.run(c)
+
+	ntp, err := ntpsync.New(ntpsync.Options{
+		Servers:          []string{"127.0.0.1:1"},
+		Timeout:          500 * time.Millisecond,
+		PreferredSources: []ntpsync.Source{c},
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if offset := ntp.TimeOffsetDuration(); offset < 1900*time.Millisecond || offset > 2100*time.Millisecond {
+		t.Errorf("预期偏移量约为2秒，实际得到%v", offset)
+	}
+	if history := ntp.GetHistory(1); len(history) != 1 || history[0].Server != c.Name() {
+		t.Errorf("预期使用PTP时间源同步，实际得到%+v", history)
+	}
+}
@@ -0,0 +1,110 @@
+package ptp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PTPv2消息类型
+const (
+	msgSync      = 0x0
+	msgDelayReq  = 0x1
+	msgFollowUp  = 0x8
+	msgDelayResp = 0x9
+	msgAnnounce  = 0xB
+)
+
+// 消息长度
+const (
+	headerSize    = 34
+	syncSize      = 44 // Sync、Delay_Req和Follow_Up
+	delayRespSize = 54
+	announceSize  = 64
+)
+
+// flagField中的标志位
+const (
+	flagTwoStep        = 0x0200 // 两步时钟，精确的发送时间在Follow_Up中
+	flagUTCOffsetValid = 0x0004 // Announce中的currentUtcOffset有效
+)
+
+// portIdentity 是PTP端口的标识：时钟标识和端口号
+type portIdentity [10]byte
+
+// header 是PTPv2消息头中用到的字段
+type header struct {
+	messageType uint8
+	length      uint16
+	domain      uint8
+	flags       uint16
+	correction  time.Duration
+	source      portIdentity
+	sequence    uint16
+}
+
+// parseHeader 解析消息头
+func parseHeader(b []byte) (header, error) {
+	if len(b) < headerSize {
+		return header{}, errors.New("PTP消息过短")
+	}
+	if version := b[1] & 0x0f; version != 2 {
+		return header{}, fmt.Errorf("不支持的PTP版本%d", version)
+	}
+
+	h := header{
+		messageType: b[0] & 0x0f,
+		length:      binary.BigEndian.Uint16(b[2:4]),
+		domain:      b[4],
+		flags:       binary.BigEndian.Uint16(b[6:8]),
+		// correctionField以2^-16纳秒为单位
+		correction: time.Duration(int64(binary.BigEndian.Uint64(b[8:16])) >> 16),
+		sequence:   binary.BigEndian.Uint16(b[30:32]),
+	}
+	copy(h.source[:], b[20:30])
+	if int(h.length) > len(b) {
+		return header{}, errors.New("PTP消息不完整")
+	}
+	return h, nil
+}
+
+// putHeader 写入消息头
+func putHeader(b []byte, messageType uint8, length uint16, domain uint8, source portIdentity, sequence uint16) {
+	b[0] = messageType
+	b[1] = 2
+	binary.BigEndian.PutUint16(b[2:4], length)
+	b[4] = domain
+	copy(b[20:30], source[:])
+	binary.BigEndian.PutUint16(b[30:32], sequence)
+
+	// controlField只为兼容PTPv1保留
+	switch messageType {
+	case msgSync:
+		b[32] = 0
+	case msgDelayReq:
+		b[32] = 1
+	case msgFollowUp:
+		b[32] = 2
+	case msgDelayResp:
+		b[32] = 3
+	default:
+		b[32] = 5
+	}
+	b[33] = 0x7f
+}
+
+// parseTimestamp 解析10字节的PTP时间戳：48位秒和32位纳秒
+func parseTimestamp(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint16(b[0:2]))<<32 | int64(binary.BigEndian.Uint32(b[2:6]))
+	nanos := int64(binary.BigEndian.Uint32(b[6:10]))
+	return time.Unix(seconds, nanos)
+}
+
+// putTimestamp 以10字节的PTP格式写入时间戳
+func putTimestamp(b []byte, t time.Time) {
+	seconds := uint64(t.Unix())
+	binary.BigEndian.PutUint16(b[0:2], uint16(seconds>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(seconds))
+	binary.BigEndian.PutUint32(b[6:10], uint32(t.Nanosecond()))
+}
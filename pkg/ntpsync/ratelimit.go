@@ -0,0 +1,224 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrRateLimited 表示为遵守最小请求间隔而没有向服务器发送请求
+var ErrRateLimited = errors.New("向NTP服务器发送请求过于频繁")
+
+// ErrServerRateLimited 表示服务器以RATE Kiss-o'-Death要求降低请求频率，
+// 此后向该服务器发送请求的最小间隔被提高
+var ErrServerRateLimited = errors.New("NTP服务器要求降低请求频率")
+
+// 客户端限速的参数
+const (
+	// DefaultMinPollInterval 是向同一服务器发送请求的默认最小间隔
+	// 与快速初始同步的间隔一致，ntpd默认会对间隔更短的请求回复RATE KoD
+	DefaultMinPollInterval = 2 * time.Second
+
+	// PoolMinSyncInterval 是使用pool.ntp.org服务器时允许的最小同步间隔，
+	// 对应ntpd默认的最小轮询间隔(2^6秒)，为公共服务器池的使用规范留出余量
+	PoolMinSyncInterval = 64 * time.Second
+
+	// ServerPollTimeoutThreshold 是服务器连续超时多少次后提高向它发送请求的最小间隔
+	ServerPollTimeoutThreshold = 3
+
+	// MaxServerPollInterval 是按服务器提高的最小请求间隔的上限，对应ntpd默认的最大轮询间隔(2^10秒)
+	MaxServerPollInterval = 1024 * time.Second
+
+	// ServerPollRecoveryCount 是服务器连续成功应答多少次后把提高的最小请求间隔减半，
+	// 减到PoolMinSyncInterval以下时恢复原来的间隔
+	ServerPollRecoveryCount = 4
+)
+
+// serverPoll 是单个服务器提高后的最小请求间隔、连续超时的次数和提高后连续成功的次数
+type serverPoll struct {
+	minPoll   time.Duration
+	timeouts  int
+	successes int
+}
+
+// isPoolServer 判断服务器是否属于pool.ntp.org
+func isPoolServer(server string) bool {
+	host := server
+	if h, _, err := net.SplitHostPort(server); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return host == "pool.ntp.org" || strings.HasSuffix(host, ".pool.ntp.org")
+}
+
+// minSyncInterval 返回给定服务器和最小请求间隔下允许的最小同步间隔
+func minSyncInterval(servers []string, minPoll time.Duration) time.Duration {
+	minimum := minPoll
+	for _, server := range servers {
+		if isPoolServer(server) && minimum < PoolMinSyncInterval {
+			minimum = PoolMinSyncInterval
+		}
+	}
+	return minimum
+}
+
+// validateIntervalJitter 检查同步间隔随机调整的比例
+func validateIntervalJitter(jitter float64) error {
+	if !(jitter >= 0 && jitter < 1) {
+		return fmt.Errorf("同步间隔的随机调整比例%v必须在[0, 1)范围内", jitter)
+	}
+	return nil
+}
+
+// clampSyncIntervalLocked 将同步间隔提高到当前服务器允许的最小值，返回是否进行了调整
+// 调用者必须持有n.mutex
+func (n *NTPSync) clampSyncIntervalLocked() bool {
+	if minimum := minSyncInterval(n.servers, n.minPollInterval); n.syncInterval < minimum {
+		n.syncInterval = minimum
+		return true
+	}
+	return false
+}
+
+// reservePoll 检查距离上次向服务器发送请求是否已经超过最小请求间隔，
+// 满足时记录本次请求的时间，否则返回ErrRateLimited；不限速时也记录请求的时间，供GetPeers使用
+func (n *NTPSync) reservePoll(server string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	now := n.clock.Now()
+	interval := max(n.minPollInterval, n.serverPolls[server].minPoll)
+	if last, ok := n.lastPoll[server]; ok && interval > 0 && now.Sub(last) < interval {
+		return fmt.Errorf("%w: 距离上次向服务器 %s 发送请求不足%v", ErrRateLimited, server, interval)
+	}
+
+	if n.lastPoll == nil {
+		n.lastPoll = make(map[string]time.Time)
+	}
+	n.lastPoll[server] = now
+	return nil
+}
+
+// reserveForceSync 检查距离上次ForceSyncNow是否已经超过MinForceSyncInterval，
+// 满足时记录本次调用的时间，否则返回ErrRateLimited
+func (n *NTPSync) reserveForceSync() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.minForceSyncInterval <= 0 {
+		return nil
+	}
+	now := n.clock.Now()
+	if !n.lastForceSync.IsZero() && now.Sub(n.lastForceSync) < n.minForceSyncInterval {
+		return fmt.Errorf("%w: 距离上次强制同步不足%v", ErrRateLimited, n.minForceSyncInterval)
+	}
+	n.lastForceSync = now
+	return nil
+}
+
+// raiseServerPoll 加倍向服务器发送请求的最小间隔，至少为PoolMinSyncInterval，
+// 不超过MaxServerPollInterval，返回提高后的间隔
+func (n *NTPSync) raiseServerPoll(server string) time.Duration {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.raiseServerPollLocked(server)
+}
+
+// raiseServerPollLocked 与raiseServerPoll相同，调用者必须持有n.mutex
+func (n *NTPSync) raiseServerPollLocked(server string) time.Duration {
+	if n.serverPolls == nil {
+		n.serverPolls = make(map[string]serverPoll)
+	}
+	p := n.serverPolls[server]
+	p.minPoll = min(max(2*p.minPoll, PoolMinSyncInterval), MaxServerPollInterval)
+	p.timeouts = 0
+	p.successes = 0
+	n.serverPolls[server] = p
+	return p.minPoll
+}
+
+// serverTimedOut 在向服务器发送的请求超时后调用，连续超时ServerPollTimeoutThreshold次后
+// 提高向它发送请求的最小间隔；不限速时不提高
+func (n *NTPSync) serverTimedOut(server string, err error) {
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.minPollInterval <= 0 {
+		return
+	}
+	if n.serverPolls == nil {
+		n.serverPolls = make(map[string]serverPoll)
+	}
+	p := n.serverPolls[server]
+	p.timeouts++
+	p.successes = 0
+	n.serverPolls[server] = p
+	if p.timeouts >= ServerPollTimeoutThreshold {
+		n.raiseServerPollLocked(server)
+	}
+}
+
+// serverResponded 在收到服务器的应答后调用，清零连续超时的次数。
+// 应答可能是RATE Kiss-o'-Death，已经提高的最小请求间隔在这里保持不变
+func (n *NTPSync) serverResponded(server string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if p, ok := n.serverPolls[server]; ok && p.timeouts > 0 {
+		p.timeouts = 0
+		n.serverPolls[server] = p
+	}
+}
+
+// serverSucceeded 在服务器返回有效的测量结果后调用，连续成功ServerPollRecoveryCount次后
+// 把提高的最小请求间隔减半，减到PoolMinSyncInterval以下时清除，使偶发的超时或RATE不会永久降低请求频率
+func (n *NTPSync) serverSucceeded(server string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	p, ok := n.serverPolls[server]
+	if !ok || p.minPoll <= 0 {
+		return
+	}
+	p.successes++
+	if p.successes >= ServerPollRecoveryCount {
+		p.minPoll /= 2
+		p.successes = 0
+	}
+	if p.minPoll < PoolMinSyncInterval {
+		delete(n.serverPolls, server)
+		return
+	}
+	n.serverPolls[server] = p
+}
+
+// RaisedPollIntervals 返回因RATE Kiss-o'-Death或连续超时而提高了最小请求间隔的服务器地址及提高后的间隔
+// 这些服务器的请求间隔不会低于该值，与同步间隔无关；服务器恢复正常应答后间隔逐渐降低
+func (n *NTPSync) RaisedPollIntervals() map[string]time.Duration {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	raised := make(map[string]time.Duration)
+	for server, p := range n.serverPolls {
+		if p.minPoll > 0 {
+			raised[server] = p.minPoll
+		}
+	}
+	return raised
+}
+
+// ClearRaisedPollIntervals 清除所有服务器提高的最小请求间隔，用于服务器恢复正常之后立即按原来的间隔请求
+func (n *NTPSync) ClearRaisedPollIntervals() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.serverPolls = nil
+}
@@ -0,0 +1,297 @@
+package ntpsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestRateLimit 测试向同一服务器发送请求的最小间隔
+func TestRateLimit(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: time.Second,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	clock.Advance(DefaultMinPollInterval / 2)
+	if err := ntp.Sync(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("预期返回ErrRateLimited，实际得到%v", err)
+	}
+	if got := srv.RequestCount(); got != 1 {
+		t.Errorf("预期被限速的请求没有发送，实际服务器收到%d个请求", got)
+	}
+
+	clock.Advance(DefaultMinPollInterval / 2)
+	if err := ntp.Sync(); err != nil {
+		t.Errorf("预期超过最小间隔后同步成功，实际得到%v", err)
+	}
+
+	// 负值关闭限速
+	unlimited, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := unlimited.Sync(); err != nil {
+			t.Errorf("预期关闭限速后同步成功，实际得到%v", err)
+		}
+	}
+}
+
+// TestPoolSyncInterval 测试违反pool.ntp.org使用规范的同步间隔被提高到允许的最小值
+func TestPoolSyncInterval(t *testing.T) {
+	pool, err := New(Options{
+		Servers:      []string{"0.pool.ntp.org"},
+		SyncInterval: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	if got := pool.GetPeriodicSyncInterval(); got != PoolMinSyncInterval {
+		t.Errorf("预期pool.ntp.org服务器的同步间隔被提高到%v，实际得到%v", PoolMinSyncInterval, got)
+	}
+
+	short, err := New(Options{
+		Servers:      []string{"192.168.1.1"},
+		SyncInterval: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	if got := short.GetPeriodicSyncInterval(); got != DefaultMinPollInterval {
+		t.Errorf("预期同步间隔被提高到最小请求间隔%v，实际得到%v", DefaultMinPollInterval, got)
+	}
+
+	ntp, err := New(Options{
+		Servers:      []string{"192.168.1.1"},
+		SyncInterval: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	// 添加pool.ntp.org服务器后，同步间隔被提高到允许的最小值
+	ntp.AddServer("pool.ntp.org")
+	if got := ntp.GetPeriodicSyncInterval(); got != PoolMinSyncInterval {
+		t.Errorf("预期同步间隔被提高到%v，实际得到%v", PoolMinSyncInterval, got)
+	}
+
+	ntp.SetPeriodicSyncInterval(time.Second)
+	if got := ntp.GetPeriodicSyncInterval(); got != PoolMinSyncInterval {
+		t.Errorf("预期同步间隔不低于%v，实际得到%v", PoolMinSyncInterval, got)
+	}
+}
+
+// TestRateKissRaisesServerPoll 测试RATE Kiss-o'-Death使该服务器的最小请求间隔加倍，与同步间隔无关
+func TestRateKissRaisesServerPoll(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetKissCode("RATE")
+
+	ntp, err := New(Options{
+		Servers:      []string{srv.Addr()},
+		Timeout:      time.Second,
+		SyncInterval: 10 * time.Second,
+		Clock:        clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); !errors.Is(err, ErrServerRateLimited) {
+		t.Fatalf("预期RATE应答返回ErrServerRateLimited，实际得到%v", err)
+	}
+	if got := ntp.RaisedPollIntervals()[srv.Addr()]; got != PoolMinSyncInterval {
+		t.Errorf("预期最小请求间隔提高到%v，实际得到%v", PoolMinSyncInterval, got)
+	}
+
+	srv.SetKissCode("")
+	clock.Advance(10 * time.Second)
+	if err := ntp.Sync(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("预期在提高的间隔内返回ErrRateLimited，实际得到%v", err)
+	}
+	if got := srv.RequestCount(); got != 1 {
+		t.Errorf("预期被限速的请求没有发送，实际服务器收到%d个请求", got)
+	}
+
+	clock.Advance(PoolMinSyncInterval)
+	srv.SetKissCode("RATE")
+	_ = ntp.Sync()
+	if got := ntp.RaisedPollIntervals()[srv.Addr()]; got != 2*PoolMinSyncInterval {
+		t.Errorf("预期再次收到RATE后间隔加倍，实际得到%v", got)
+	}
+	if peers := ntp.GetPeers(); peers[0].MinPoll != 2*PoolMinSyncInterval {
+		t.Errorf("预期GetPeers报告提高的间隔，实际得到%v", peers[0].MinPoll)
+	}
+	if got := ntp.State().MinPoll[srv.Addr()]; got != 2*PoolMinSyncInterval {
+		t.Errorf("预期保存的状态包含提高的间隔，实际得到%v", got)
+	}
+
+	ntp.ClearRaisedPollIntervals()
+	if got := ntp.RaisedPollIntervals(); len(got) != 0 {
+		t.Errorf("预期清除后没有提高的间隔，实际得到%v", got)
+	}
+}
+
+// TestTimeoutsRaiseServerPoll 测试连续超时后提高该服务器的最小请求间隔，应答会清零超时次数
+func TestTimeoutsRaiseServerPoll(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: 50 * time.Millisecond,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	syncAfter := func(d time.Duration) error {
+		clock.Advance(d)
+		return ntp.Sync()
+	}
+
+	srv.SetDrop(true)
+	for i := 0; i < ServerPollTimeoutThreshold-1; i++ {
+		_ = syncAfter(DefaultMinPollInterval)
+	}
+	srv.SetDrop(false)
+	if err := syncAfter(DefaultMinPollInterval); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	srv.SetDrop(true)
+	for i := 0; i < ServerPollTimeoutThreshold-1; i++ {
+		_ = syncAfter(DefaultMinPollInterval)
+	}
+	if got := ntp.RaisedPollIntervals(); len(got) != 0 {
+		t.Fatalf("预期应答之后重新计算连续超时的次数，实际得到%v", got)
+	}
+	_ = syncAfter(DefaultMinPollInterval)
+	if got := ntp.RaisedPollIntervals()[srv.Addr()]; got != PoolMinSyncInterval {
+		t.Errorf("预期连续超时%d次后最小请求间隔提高到%v，实际得到%v", ServerPollTimeoutThreshold, PoolMinSyncInterval, got)
+	}
+	if err := syncAfter(DefaultMinPollInterval); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("预期在提高的间隔内返回ErrRateLimited，实际得到%v", err)
+	}
+}
+
+// TestServerPollRecovers 测试服务器恢复正常应答后提高的最小请求间隔逐渐降低直到清除
+func TestServerPollRecovers(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: time.Second,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	ntp.raiseServerPoll(srv.Addr())
+	ntp.raiseServerPoll(srv.Addr())
+
+	syncTimes := func(count int, interval time.Duration) {
+		t.Helper()
+		for i := 0; i < count; i++ {
+			clock.Advance(interval)
+			if err := ntp.Sync(); err != nil {
+				t.Fatalf("同步失败: %v", err)
+			}
+		}
+	}
+
+	syncTimes(ServerPollRecoveryCount-1, 2*PoolMinSyncInterval)
+	if got := ntp.RaisedPollIntervals()[srv.Addr()]; got != 2*PoolMinSyncInterval {
+		t.Errorf("预期连续成功%d次之前间隔不变，实际得到%v", ServerPollRecoveryCount, got)
+	}
+	syncTimes(1, 2*PoolMinSyncInterval)
+	if got := ntp.RaisedPollIntervals()[srv.Addr()]; got != PoolMinSyncInterval {
+		t.Errorf("预期间隔减半到%v，实际得到%v", PoolMinSyncInterval, got)
+	}
+	syncTimes(ServerPollRecoveryCount, PoolMinSyncInterval)
+	if got := ntp.RaisedPollIntervals(); len(got) != 0 {
+		t.Errorf("预期间隔恢复原来的值，实际得到%v", got)
+	}
+}
+
+// TestMinForceSyncInterval 测试两次强制同步之间的最小间隔
+func TestMinForceSyncInterval(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:              []string{srv.Addr()},
+		Timeout:              time.Second,
+		Clock:                clock,
+		MinPollInterval:      -1,
+		MinForceSyncInterval: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.ForceSyncNow(); err != nil {
+		t.Fatalf("强制同步失败: %v", err)
+	}
+	clock.Advance(30 * time.Second)
+	if err := ntp.ForceSyncNow(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("预期返回ErrRateLimited，实际得到%v", err)
+	}
+	if got := srv.RequestCount(); got != 1 {
+		t.Errorf("预期被限制的强制同步没有发送请求，实际服务器收到%d个请求", got)
+	}
+
+	// Sync不受强制同步间隔的限制
+	if err := ntp.Sync(); err != nil {
+		t.Errorf("预期Sync不受限制，实际得到%v", err)
+	}
+
+	clock.Advance(30 * time.Second)
+	if err := ntp.ForceSyncNow(); err != nil {
+		t.Errorf("预期超过最小间隔后强制同步成功，实际得到%v", err)
+	}
+	if got := srv.RequestCount(); got != 3 {
+		t.Errorf("预期服务器收到3个请求，实际得到%d", got)
+	}
+}
@@ -0,0 +1,72 @@
+// Package refclock 将ntpsync测得的偏移量发布给chrony或ntpd的参考时钟驱动，
+// 由系统守护进程调整内核时钟，ntpsync只作为测量前端。
+//
+// SOCK对应chrony的SOCK参考时钟（refclock SOCK /var/run/ntpsync.sock），
+// SHM对应chrony和ntpd共同支持的共享内存驱动（chrony: refclock SHM 0；
+// ntpd: server 127.127.28.0）。Attach订阅同步事件，每次同步成功后发布一个样本：
+//
+//	sock, err := refclock.NewSOCK(refclock.SOCKOptions{Path: "/var/run/ntpsync.sock"})
+//	stop := refclock.Attach(ntp, sock, nil)
+//	defer stop()
+package refclock
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// ErrUnsupported 表示当前平台不支持该驱动
+var ErrUnsupported = errors.New("当前平台不支持该参考时钟驱动")
+
+// Sample 是发布给系统守护进程的一个测量样本
+type Sample struct {
+	// Local 是测量时的本地系统时间
+	Local time.Time
+
+	// Offset 是参考时间相对本地系统时间的偏移量
+	Offset time.Duration
+
+	// Leap 是闰秒指示器，Attach发布的样本总是NoWarning
+	Leap ntpsync.NTPLeap
+}
+
+// Publisher 将样本发布给系统守护进程
+type Publisher interface {
+	// Publish 发布一个样本
+	Publish(sample Sample) error
+
+	// Close 释放驱动占用的资源
+	Close() error
+}
+
+// Attach 订阅同步事件，每次同步成功后将偏移量发布到p
+// 返回的函数取消订阅并等待发布goroutine退出，不会关闭p
+// 发布失败不影响同步，onError非nil时会收到发布错误
+func Attach(n *ntpsync.NTPSync, p Publisher, onError func(error)) (stop func()) {
+	events, unsubscribe := n.Subscribe(0)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for ev := range events {
+			if ev.Type != ntpsync.EventSyncSucceeded {
+				continue
+			}
+			local := ev.Time
+			if local.IsZero() {
+				local = time.Now()
+			}
+			err := p.Publish(Sample{Local: local, Offset: ev.Offset})
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	return func() {
+		unsubscribe()
+		<-done
+	}
+}
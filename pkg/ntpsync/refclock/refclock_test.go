@@ -0,0 +1,123 @@
+package refclock
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// listenSOCK 在临时目录中创建模拟chrony的SOCK套接字
+func listenSOCK(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "refclock.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("当前平台不支持Unix数据报套接字: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+// readSample 读取并解析一个sock_sample
+func readSample(t *testing.T, conn *net.UnixConn) (sec, usec int64, offset float64, leap, magic uint32) {
+	t.Helper()
+
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("读取SOCK样本失败: %v", err)
+	}
+
+	long := strconv.IntSize / 8
+	if want := 2*long + 24; n != want {
+		t.Fatalf("预期样本长度为%d，实际得到%d", want, n)
+	}
+	if long == 8 {
+		sec = int64(binary.NativeEndian.Uint64(buf[0:]))
+		usec = int64(binary.NativeEndian.Uint64(buf[8:]))
+	} else {
+		sec = int64(int32(binary.NativeEndian.Uint32(buf[0:])))
+		usec = int64(int32(binary.NativeEndian.Uint32(buf[4:])))
+	}
+	p := 2 * long
+	offset = math.Float64frombits(binary.NativeEndian.Uint64(buf[p:]))
+	leap = binary.NativeEndian.Uint32(buf[p+12:])
+	magic = binary.NativeEndian.Uint32(buf[p+20:])
+	return
+}
+
+// TestSOCKPublish 测试SOCK样本的编码
+func TestSOCKPublish(t *testing.T) {
+	conn, path := listenSOCK(t)
+
+	sock, err := NewSOCK(SOCKOptions{Path: path})
+	if err != nil {
+		t.Fatalf("创建SOCK失败: %v", err)
+	}
+	defer sock.Close()
+
+	local := time.Unix(1700000000, 250000000)
+	err = sock.Publish(Sample{Local: local, Offset: -1500 * time.Millisecond, Leap: ntpsync.LastMinute61})
+	if err != nil {
+		t.Fatalf("发布样本失败: %v", err)
+	}
+
+	sec, usec, offset, leap, magic := readSample(t, conn)
+	if sec != 1700000000 || usec != 250000 {
+		t.Errorf("预期本地时间为1700000000.250000，实际得到%d.%06d", sec, usec)
+	}
+	if offset != -1.5 {
+		t.Errorf("预期偏移量为-1.5秒，实际得到%v", offset)
+	}
+	if leap != uint32(ntpsync.LastMinute61) {
+		t.Errorf("预期闰秒指示器为1，实际得到%d", leap)
+	}
+	if magic != sockMagic {
+		t.Errorf("预期魔数为%#x，实际得到%#x", sockMagic, magic)
+	}
+}
+
+// TestAttach 测试同步成功后发布偏移量
+func TestAttach(t *testing.T) {
+	conn, path := listenSOCK(t)
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetOffset(2 * time.Second)
+
+	ntp, err := ntpsync.New(ntpsync.Options{Servers: []string{srv.Addr()}})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	sock, err := NewSOCK(SOCKOptions{Path: path})
+	if err != nil {
+		t.Fatalf("创建SOCK失败: %v", err)
+	}
+	defer sock.Close()
+
+	stop := Attach(ntp, sock, func(err error) { t.Errorf("发布样本失败: %v", err) })
+	defer stop()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	_, _, offset, _, magic := readSample(t, conn)
+	if magic != sockMagic {
+		t.Errorf("预期魔数为%#x，实际得到%#x", sockMagic, magic)
+	}
+	if offset < 1.9 || offset > 2.1 {
+		t.Errorf("预期偏移量约为2秒，实际得到%v", offset)
+	}
+}
@@ -0,0 +1,17 @@
+package refclock
+
+// shmKeyBase 是ntpd SHM驱动的共享内存键基数("NTP0")，单元号加在其上
+const shmKeyBase = 0x4e545030
+
+// SHMOptions 包含SHM的配置选项
+type SHMOptions struct {
+	// Unit 是SHM单元号，对应chrony的refclock SHM <unit>或ntpd的127.127.28.<unit>
+	Unit int
+
+	// Perm 是新建共享内存段的权限，零值表示0600
+	// 单元0和1只能由root访问，其它单元通常需要0666才能由非root进程写入
+	Perm uint32
+
+	// Precision 是样本精度的以2为底的对数，零值表示-20（约1微秒）
+	Precision int32
+}
@@ -0,0 +1,119 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || riscv64)
+
+package refclock
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// ipcCreat 是SysV IPC的IPC_CREAT标志
+const ipcCreat = 0o1000
+
+// shmTime 与ntpd和chrony的struct shmTime在64位平台上的布局一致
+type shmTime struct {
+	mode                 int32 // 1表示使用count协议
+	count                int32
+	clockTimeStampSec    int64 // time_t，与long等宽
+	clockTimeStampUSec   int32
+	receiveTimeStampSec  int64
+	receiveTimeStampUSec int32
+	leap                 int32
+	precision            int32
+	nsamples             int32
+	valid                int32
+	clockTimeStampNSec   uint32
+	receiveTimeStampNSec uint32
+	dummy                [8]int32
+}
+
+// SHM 通过SysV共享内存向chrony或ntpd的SHM参考时钟发布样本
+type SHM struct {
+	mutex     sync.Mutex
+	seg       *shmTime
+	addr      uintptr
+	precision int32
+}
+
+// NewSHM 连接或创建SHM单元对应的共享内存段
+func NewSHM(opts SHMOptions) (*SHM, error) {
+	if opts.Unit < 0 {
+		return nil, fmt.Errorf("无效的SHM单元号 %d", opts.Unit)
+	}
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0o600
+	}
+	precision := opts.Precision
+	if precision == 0 {
+		precision = -20
+	}
+
+	size := unsafe.Sizeof(shmTime{})
+	id, _, errno := syscall.Syscall(syscall.SYS_SHMGET, uintptr(shmKeyBase+opts.Unit), size, uintptr(ipcCreat|perm&0o777))
+	if errno != 0 {
+		return nil, fmt.Errorf("获取SHM共享内存段失败: %v", errno)
+	}
+	addr, _, errno := syscall.Syscall(syscall.SYS_SHMAT, id, 0, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("映射SHM共享内存段失败: %v", errno)
+	}
+
+	return &SHM{
+		// 共享内存不由Go分配，经unsafe.Pointer中转避免vet误报
+		seg:       (*shmTime)(*(*unsafe.Pointer)(unsafe.Pointer(&addr))),
+		addr:      addr,
+		precision: precision,
+	}, nil
+}
+
+// Publish 写入一个样本
+// 使用count协议：写入前后各递增count，读取方发现count变化时丢弃样本
+func (s *SHM) Publish(sample Sample) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.seg == nil {
+		return errors.New("SHM已关闭")
+	}
+
+	clock := sample.Local.Add(sample.Offset)
+	receive := sample.Local
+	seg := s.seg
+
+	atomic.StoreInt32(&seg.valid, 0)
+	atomic.StoreInt32(&seg.mode, 1)
+	atomic.AddInt32(&seg.count, 1)
+
+	seg.clockTimeStampSec = clock.Unix()
+	seg.clockTimeStampUSec = int32(clock.Nanosecond() / 1000)
+	seg.clockTimeStampNSec = uint32(clock.Nanosecond())
+	seg.receiveTimeStampSec = receive.Unix()
+	seg.receiveTimeStampUSec = int32(receive.Nanosecond() / 1000)
+	seg.receiveTimeStampNSec = uint32(receive.Nanosecond())
+	seg.leap = int32(sample.Leap)
+	seg.precision = s.precision
+
+	atomic.AddInt32(&seg.count, 1)
+	atomic.StoreInt32(&seg.valid, 1)
+	return nil
+}
+
+// Close 解除共享内存映射，共享内存段保留给读取方继续使用
+func (s *SHM) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.seg == nil {
+		return nil
+	}
+	s.seg = nil
+	if _, _, errno := syscall.Syscall(syscall.SYS_SHMDT, s.addr, 0, 0); errno != 0 {
+		return fmt.Errorf("解除SHM共享内存映射失败: %v", errno)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || riscv64)
+
+package refclock
+
+import (
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// TestSHMPublish 测试按count协议写入SHM共享内存段
+func TestSHMPublish(t *testing.T) {
+	// 使用不太可能与chrony或ntpd冲突的单元号
+	const unit = 77
+
+	shm, err := NewSHM(SHMOptions{Unit: unit})
+	if err != nil {
+		t.Skipf("当前环境不支持SysV共享内存: %v", err)
+	}
+	defer func() {
+		id, _, errno := syscall.Syscall(syscall.SYS_SHMGET, shmKeyBase+unit, 0, 0)
+		if errno == 0 {
+			const ipcRmid = 0
+			_, _, _ = syscall.Syscall(syscall.SYS_SHMCTL, id, ipcRmid, 0)
+		}
+	}()
+	defer shm.Close()
+
+	if size := unsafe.Sizeof(shmTime{}); size != 96 {
+		t.Fatalf("预期shmTime大小为96字节，实际得到%d", size)
+	}
+
+	local := time.Unix(1700000000, 100000000)
+	if err := shm.Publish(Sample{Local: local, Offset: 1500 * time.Millisecond}); err != nil {
+		t.Fatalf("发布样本失败: %v", err)
+	}
+
+	seg := shm.seg
+	if seg.mode != 1 || seg.valid != 1 || seg.count%2 != 0 {
+		t.Errorf("预期mode=1、valid=1且count为偶数，实际得到mode=%d valid=%d count=%d", seg.mode, seg.valid, seg.count)
+	}
+	if seg.clockTimeStampSec != 1700000001 || seg.clockTimeStampNSec != 600000000 || seg.clockTimeStampUSec != 600000 {
+		t.Errorf("参考时间错误: %d.%09d", seg.clockTimeStampSec, seg.clockTimeStampNSec)
+	}
+	if seg.receiveTimeStampSec != 1700000000 || seg.receiveTimeStampNSec != 100000000 {
+		t.Errorf("本地时间错误: %d.%09d", seg.receiveTimeStampSec, seg.receiveTimeStampNSec)
+	}
+	if seg.precision != -20 {
+		t.Errorf("预期精度为-20，实际得到%d", seg.precision)
+	}
+
+	if err := shm.Close(); err != nil {
+		t.Fatalf("关闭SHM失败: %v", err)
+	}
+	if err := shm.Publish(Sample{Local: local}); err == nil {
+		t.Error("关闭后发布样本应该失败")
+	}
+}
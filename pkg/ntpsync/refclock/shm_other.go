@@ -0,0 +1,21 @@
+//go:build !linux || !(amd64 || arm64 || loong64 || mips64 || mips64le || riscv64)
+
+package refclock
+
+// SHM 通过SysV共享内存向chrony或ntpd的SHM参考时钟发布样本，仅支持64位Linux
+type SHM struct{}
+
+// NewSHM 在当前平台上总是返回ErrUnsupported
+func NewSHM(opts SHMOptions) (*SHM, error) {
+	return nil, ErrUnsupported
+}
+
+// Publish 在当前平台上总是返回ErrUnsupported
+func (s *SHM) Publish(sample Sample) error {
+	return ErrUnsupported
+}
+
+// Close 在当前平台上不做任何事
+func (s *SHM) Close() error {
+	return nil
+}
@@ -0,0 +1,88 @@
+package refclock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// sockMagic 是chrony SOCK样本的魔数("SOCK")
+const sockMagic = 0x534f434b
+
+// SOCKOptions 包含SOCK的配置选项
+type SOCKOptions struct {
+	// Path 是chrony配置中refclock SOCK指定的Unix套接字路径
+	Path string
+}
+
+// SOCK 通过Unix数据报套接字向chrony的SOCK参考时钟发布样本
+type SOCK struct {
+	mutex sync.Mutex
+	conn  *net.UnixConn
+}
+
+// NewSOCK 连接chrony的SOCK参考时钟套接字
+// chrony必须先启动并创建该套接字
+func NewSOCK(opts SOCKOptions) (*SOCK, error) {
+	if opts.Path == "" {
+		return nil, errors.New("必须提供SOCK套接字路径")
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: opts.Path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("连接chrony SOCK套接字失败: %v", err)
+	}
+	return &SOCK{conn: conn}, nil
+}
+
+// Publish 发送一个样本
+func (s *SOCK) Publish(sample Sample) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.conn.Write(encodeSockSample(sample)); err != nil {
+		return fmt.Errorf("发送SOCK样本失败: %v", err)
+	}
+	return nil
+}
+
+// Close 关闭套接字
+func (s *SOCK) Close() error {
+	return s.conn.Close()
+}
+
+// encodeSockSample 按本机的C语言布局编码chrony的struct sock_sample：
+//
+//	struct sock_sample {
+//	    struct timeval tv;  // 本地时间，time_t和long与指针等宽
+//	    double offset;      // 参考时间减本地时间，单位为秒
+//	    int pulse;          // 0表示不是秒脉冲
+//	    int leap;           // 闰秒指示器
+//	    int _pad;
+//	    int magic;          // 0x534f434b
+//	};
+func encodeSockSample(sample Sample) []byte {
+	long := strconv.IntSize / 8
+	b := make([]byte, 2*long+8+16)
+
+	sec := sample.Local.Unix()
+	usec := int64(sample.Local.Nanosecond() / 1000)
+	if long == 8 {
+		binary.NativeEndian.PutUint64(b[0:], uint64(sec))
+		binary.NativeEndian.PutUint64(b[8:], uint64(usec))
+	} else {
+		binary.NativeEndian.PutUint32(b[0:], uint32(sec))
+		binary.NativeEndian.PutUint32(b[4:], uint32(usec))
+	}
+
+	p := 2 * long
+	binary.NativeEndian.PutUint64(b[p:], math.Float64bits(sample.Offset.Seconds()))
+	binary.NativeEndian.PutUint32(b[p+8:], 0)
+	binary.NativeEndian.PutUint32(b[p+12:], uint32(sample.Leap))
+	binary.NativeEndian.PutUint32(b[p+20:], sockMagic)
+	return b
+}
@@ -0,0 +1,30 @@
+package ntpsync
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DecodeReferenceID 将NTP应答中的参考ID转换为易读的形式
+//
+// 层级0（Kiss-o'-Death）、层级1（主服务器）和层级16（未同步）的参考ID
+// 是四个ASCII字符，例如"GPS"、"PPS"、"RATE"，去掉末尾的空字符和空格；
+// 层级2到15的参考ID是上游服务器的IPv4地址，以点分十进制表示
+// （上游为IPv6服务器时是其地址MD5摘要的前四个字节，无法还原）。
+// 无法作为ASCII解释的参考ID以十六进制表示
+func DecodeReferenceID(stratum uint8, id uint32) string {
+	b := []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+
+	if stratum >= 2 && stratum < 16 {
+		return net.IP(b).String()
+	}
+
+	s := strings.TrimRight(string(b), "\x00 ")
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return fmt.Sprintf("%08X", id)
+		}
+	}
+	return s
+}
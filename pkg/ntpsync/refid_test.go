@@ -0,0 +1,55 @@
+package ntpsync
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestDecodeReferenceID 测试按层级解析参考ID
+func TestDecodeReferenceID(t *testing.T) {
+	id := func(s string) uint32 { return binary.BigEndian.Uint32([]byte(s)) }
+
+	cases := []struct {
+		stratum uint8
+		id      uint32
+		want    string
+	}{
+		{1, id("GPS\x00"), "GPS"},
+		{1, id("PPS "), "PPS"},
+		{0, id("RATE"), "RATE"},
+		{2, 0xC0A8010A, "192.168.1.10"},
+		{15, 0x0A000001, "10.0.0.1"},
+		{1, 0x01020304, "01020304"},
+		{16, id("INIT"), "INIT"},
+	}
+	for _, c := range cases {
+		if got := DecodeReferenceID(c.stratum, c.id); got != c.want {
+			t.Errorf("层级%d的参考ID %08X: 预期%q，实际得到%q", c.stratum, c.id, c.want, got)
+		}
+	}
+}
+
+// TestSyncReferenceID 测试同步结果和服务器状态中包含参考ID
+func TestSyncReferenceID(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetStratum(2)
+	srv.SetReferenceID(0xC0A8010A)
+
+	ntp, err := New(Options{Servers: []string{srv.Addr()}, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	statuses, err := ntp.GetStatus()
+	if err != nil {
+		t.Fatalf("获取服务器状态失败: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].ReferenceID != "192.168.1.10" {
+		t.Errorf("预期参考ID为192.168.1.10，实际得到%+v", statuses)
+	}
+}
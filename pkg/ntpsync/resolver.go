@@ -0,0 +1,152 @@
+package ntpsync
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DNS缓存的默认时长
+const (
+	// DefaultDNSCacheTTL 是CachingResolver缓存解析结果的默认时长
+	DefaultDNSCacheTTL = 5 * time.Minute
+
+	// DefaultDNSNegativeTTL 是CachingResolver缓存解析失败的默认时长
+	DefaultDNSNegativeTTL = 30 * time.Second
+)
+
+// Resolver 将NTP服务器的主机名解析为IP地址
+// *net.Resolver实现了此接口，例如设置了Dial的*net.Resolver可以使用指定的DNS服务器；
+// 自定义实现可以使用DoT、DoH或者在测试中返回固定的地址。NewCachingResolver为任意Resolver增加缓存
+type Resolver interface {
+	// LookupNetIP 解析host，network为"ip"、"ip4"或"ip6"
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// CachingResolverOptions 包含创建CachingResolver的选项
+type CachingResolverOptions struct {
+	// Resolver 是实际执行解析的Resolver，nil表示使用net.DefaultResolver
+	Resolver Resolver
+
+	// TTL 是缓存解析结果的时长，零值表示使用DefaultDNSCacheTTL
+	TTL time.Duration
+
+	// NegativeTTL 是缓存解析失败的时长，期间同一主机名直接返回上次的错误，
+	// 避免每次同步都等待无法解析的主机名超时。零值表示使用DefaultDNSNegativeTTL，负值表示不缓存失败
+	NegativeTTL time.Duration
+
+	// Clock 是判断缓存过期使用的时间来源，nil表示使用系统时钟
+	Clock Clock
+}
+
+// CachingResolver 缓存主机名的解析结果和解析失败
+// 同步间隔很短或服务器很多时，不需要每次请求都查询DNS；本地网络变化后重新同步时清空缓存
+type CachingResolver struct {
+	resolver    Resolver
+	ttl         time.Duration
+	negativeTTL time.Duration
+	clock       Clock
+
+	mutex   sync.Mutex
+	entries map[dnsKey]dnsEntry
+}
+
+// dnsKey 标识一次解析
+type dnsKey struct {
+	network string
+	host    string
+}
+
+// dnsEntry 是缓存的解析结果或错误
+type dnsEntry struct {
+	addrs   []netip.Addr
+	err     error
+	expires time.Time
+}
+
+// NewCachingResolver 创建带缓存的Resolver
+func NewCachingResolver(opts CachingResolverOptions) *CachingResolver {
+	r := &CachingResolver{
+		resolver:    opts.Resolver,
+		ttl:         opts.TTL,
+		negativeTTL: opts.NegativeTTL,
+		clock:       opts.Clock,
+		entries:     make(map[dnsKey]dnsEntry),
+	}
+	if r.resolver == nil {
+		r.resolver = net.DefaultResolver
+	}
+	if r.ttl <= 0 {
+		r.ttl = DefaultDNSCacheTTL
+	}
+	if r.negativeTTL == 0 {
+		r.negativeTTL = DefaultDNSNegativeTTL
+	}
+	if r.clock == nil {
+		r.clock = SystemClock{}
+	}
+	return r
+}
+
+// LookupNetIP 返回缓存的解析结果，没有缓存或已过期时重新解析
+// ctx被取消或超时导致的失败不会被缓存
+func (r *CachingResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	key := dnsKey{network: network, host: host}
+
+	r.mutex.Lock()
+	entry, ok := r.entries[key]
+	r.mutex.Unlock()
+	if ok && r.clock.Now().Before(entry.expires) {
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		return slices.Clone(entry.addrs), nil
+	}
+
+	addrs, err := r.resolver.LookupNetIP(ctx, network, host)
+	if err != nil {
+		if ctx.Err() != nil || r.negativeTTL < 0 {
+			return nil, err
+		}
+		entry = dnsEntry{err: err, expires: r.clock.Now().Add(r.negativeTTL)}
+	} else {
+		entry = dnsEntry{addrs: slices.Clone(addrs), expires: r.clock.Now().Add(r.ttl)}
+	}
+
+	r.mutex.Lock()
+	r.entries[key] = entry
+	r.mutex.Unlock()
+	return addrs, err
+}
+
+// Flush 清空缓存，之后的解析都重新查询
+func (r *CachingResolver) Flush() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	clear(r.entries)
+}
+
+// resolveServer 使用resolver将服务器地址中的主机名解析为第一个IP地址
+// 地址已经是IP地址时原样返回
+func resolveServer(ctx context.Context, resolver Resolver, server string) (string, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return "", err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return server, nil
+	}
+
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", &net.DNSError{Err: "没有找到地址", Name: host, IsNotFound: true}
+	}
+	return net.JoinHostPort(addrs[0].Unmap().String(), port), nil
+}
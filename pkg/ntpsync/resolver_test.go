@@ -0,0 +1,120 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// fakeResolver 返回固定的地址并记录查询次数
+type fakeResolver struct {
+	mutex   sync.Mutex
+	hosts   map[string]netip.Addr
+	lookups int
+}
+
+func (r *fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lookups++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	addr, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return []netip.Addr{addr}, nil
+}
+
+func (r *fakeResolver) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.lookups
+}
+
+// TestCachingResolver 测试解析结果和解析失败在各自的缓存时长内不再重新查询
+func TestCachingResolver(t *testing.T) {
+	clock := newFakeClock()
+	upstream := &fakeResolver{hosts: map[string]netip.Addr{"ntp.test": netip.MustParseAddr("192.0.2.1")}}
+	r := NewCachingResolver(CachingResolverOptions{
+		Resolver:    upstream,
+		TTL:         time.Minute,
+		NegativeTTL: 10 * time.Second,
+		Clock:       clock,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		addrs, err := r.LookupNetIP(ctx, "ip", "ntp.test")
+		if err != nil || len(addrs) != 1 || addrs[0] != netip.MustParseAddr("192.0.2.1") {
+			t.Fatalf("解析失败: %v %v", addrs, err)
+		}
+		if _, err := r.LookupNetIP(ctx, "ip", "missing.test"); err == nil {
+			t.Fatal("预期无法解析的主机名返回错误")
+		}
+	}
+	if got := upstream.count(); got != 2 {
+		t.Errorf("预期缓存期内只查询2次，实际查询%d次", got)
+	}
+
+	// 解析失败的缓存先过期
+	clock.Advance(10 * time.Second)
+	r.LookupNetIP(ctx, "ip", "ntp.test")
+	r.LookupNetIP(ctx, "ip", "missing.test")
+	if got := upstream.count(); got != 3 {
+		t.Errorf("预期只重新查询解析失败的主机名，实际共查询%d次", got)
+	}
+
+	// 取消导致的失败不缓存
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	r.Flush()
+	for i := 0; i < 2; i++ {
+		if _, err := r.LookupNetIP(cancelled, "ip", "ntp.test"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("预期返回context.Canceled，实际得到%v", err)
+		}
+	}
+	if got := upstream.count(); got != 5 {
+		t.Errorf("预期取消的查询不被缓存，实际共查询%d次", got)
+	}
+}
+
+// TestResolverOption 测试共用套接字和Dialer都使用设置的Resolver解析服务器的主机名
+func TestResolverOption(t *testing.T) {
+	server := ntptest.NewServer()
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Addr())
+
+	for _, dialer := range []Dialer{nil, &net.Dialer{}} {
+		resolver := &fakeResolver{hosts: map[string]netip.Addr{"ntp.test": netip.MustParseAddr("127.0.0.1")}}
+		ntp, err := New(Options{
+			Servers:         []string{net.JoinHostPort("ntp.test", port)},
+			Timeout:         time.Second,
+			MinPollInterval: -1,
+			Dialer:          dialer,
+			Resolver:        NewCachingResolver(CachingResolverOptions{Resolver: resolver}),
+		})
+		if err != nil {
+			t.Fatalf("创建NTPSync实例失败: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := ntp.Sync(); err != nil {
+				t.Fatalf("同步失败: %v", err)
+			}
+		}
+		if got := resolver.count(); got != 1 {
+			t.Errorf("预期只解析1次，实际解析%d次", got)
+		}
+		ntp.Close()
+	}
+}
@@ -0,0 +1,48 @@
+package ntpsync
+
+// resync 在本地网络或时钟发生变化后立即重新同步
+// 恢复被暂时排除的服务器，重新创建套接字，清空DNS缓存，重新发现服务器并清零失败退避，同步后重新探测所有服务器。
+// 定时同步正在运行时由同步循环执行，下一次同步的时间按本次结果重新计算；
+// 否则在后台执行
+func (n *NTPSync) resync() {
+	if n.isClosed() {
+		return
+	}
+	if n.serverManager != nil {
+		n.serverManager.ClearHolddown()
+	}
+	n.closeSocket()
+	if cache, ok := n.resolver.(*CachingResolver); ok {
+		cache.Flush()
+	}
+	if n.srvDomain != "" || n.dhcpServers {
+		n.goAsync(n.rediscover)
+	}
+
+	n.mutex.Lock()
+	n.consecutiveFailures = 0
+	n.mutex.Unlock()
+
+	if n.IsPeriodicSyncRunning() {
+		if n.scheduler != nil && n.scheduler.trigger(n) {
+			return
+		}
+		select {
+		case n.resyncChan <- struct{}{}:
+		default:
+			// 已经有一次等待执行的重新同步
+		}
+		return
+	}
+	n.goAsync(func() {
+		_ = n.coalesce(true)
+		n.reprobe()
+	})
+}
+
+// reprobe 重新探测所有服务器，更新服务器管理器中的状态
+func (n *NTPSync) reprobe() {
+	if n.serverManager != nil {
+		_ = n.serverManager.ProbeAllServers(n)
+	}
+}
@@ -0,0 +1,33 @@
+package ntpsync
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultRetryBackoff 是第一次重新发送请求前的默认等待时间
+const DefaultRetryBackoff = 200 * time.Millisecond
+
+// retryPolicy 返回等待应答超时后重新发送请求的次数和第一次重新发送前的等待时间
+func (n *NTPSync) retryPolicy() (int, time.Duration) {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	backoff := n.retryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	return n.retryCount, backoff
+}
+
+// sleep 等待d的时长，ctx被取消时提前返回false
+func (n *NTPSync) sleep(ctx context.Context, d time.Duration) bool {
+	timer := n.clock.NewTimer(d)
+	select {
+	case <-timer.C():
+		return true
+	case <-ctx.Done():
+		stopTimer(timer)
+		return false
+	}
+}
@@ -0,0 +1,49 @@
+package ntpsync
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestRetry 测试等待应答超时后在同一次同步中重新发送请求，
+// 分别使用共用的套接字和单独的连接
+func TestRetry(t *testing.T) {
+	for _, dialer := range []Dialer{nil, &net.Dialer{}} {
+		srv := ntptest.NewServer()
+		defer srv.Close()
+
+		ntp, err := New(Options{
+			Servers:         []string{srv.Addr()},
+			Timeout:         100 * time.Millisecond,
+			MinPollInterval: -1,
+			RetryCount:      2,
+			RetryBackoff:    10 * time.Millisecond,
+			Dialer:          dialer,
+		})
+		if err != nil {
+			t.Fatalf("创建NTPSync实例失败: %v", err)
+		}
+		defer ntp.Close()
+
+		// 丢失两个数据包后第三次发送成功
+		srv.SetDropNext(2)
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("重新发送后同步失败: %v", err)
+		}
+		if got := srv.RequestCount(); got != 3 {
+			t.Errorf("预期发送3个请求，实际发送了%d个", got)
+		}
+
+		// 丢失的数据包超过重新发送的次数
+		srv.SetDropNext(3)
+		if err := ntp.Sync(); err == nil {
+			t.Error("预期超过重新发送次数后同步失败，实际成功")
+		}
+		if got := srv.RequestCount(); got != 6 {
+			t.Errorf("预期共发送6个请求，实际发送了%d个", got)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+// Package roughtime 实现Roughtime协议的客户端，作为带有密码学证明的粗略时间源。
+//
+// Roughtime服务器用长期公钥签名的临时密钥对每个应答签名，应答中的时间
+// 和误差半径因此可以被验证，适合在设备启动时引导时间，或者核对NTP的结果。
+// Client实现了ntpsync.Source，可以直接用于NTPSync.SyncWithSource和CrossCheck：
+//
+//	key, _ := roughtime.DecodePublicKey("...")
+//	rt, _ := roughtime.New(roughtime.Options{
+//		Server: roughtime.Server{Name: "example", Address: "roughtime.example.com:2002", PublicKey: key},
+//	})
+//	err := ntp.SyncWithSource(ctx, rt)
+//
+// 目前实现的是Google最初发布的Roughtime协议，Cloudflare和Google的服务器都支持该协议。
+package roughtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// 协议相关常量
+const (
+	// DefaultTimeout 是请求的默认超时时间
+	DefaultTimeout = 5 * time.Second
+
+	// requestSize 是请求的最小长度，填充请求以避免放大攻击
+	requestSize = 1024
+
+	// nonceSize 是随机数的长度
+	nonceSize = 64
+
+	// maxResponseSize 是接收应答的缓冲区大小
+	maxResponseSize = 4096
+)
+
+// 签名的上下文前缀
+var (
+	delegationContext = []byte("RoughTime v1 delegation signature--\x00")
+	responseContext   = []byte("RoughTime v1 response signature\x00")
+)
+
+// ErrInvalidResponse 表示应答格式无效或没有通过验证
+var ErrInvalidResponse = errors.New("无效的Roughtime应答")
+
+// Server 描述一个Roughtime服务器
+type Server struct {
+	// Name 是服务器的名称
+	Name string
+
+	// Address 是服务器的"主机:端口"地址
+	Address string
+
+	// PublicKey 是服务器的长期Ed25519公钥
+	PublicKey ed25519.PublicKey
+}
+
+// Options 包含Client的配置选项
+type Options struct {
+	// Server 是要查询的服务器
+	Server Server
+
+	// Timeout 是请求的超时时间，零值表示使用DefaultTimeout
+	Timeout time.Duration
+
+	// Now 是本地时间来源，nil表示使用time.Now
+	// 与NTPSync共用时应传入与ntpsync.Options.Clock相同的时间来源
+	Now func() time.Time
+}
+
+// Response 是一次经过验证的查询结果
+type Response struct {
+	// Midpoint 是服务器给出的时间
+	Midpoint time.Time
+
+	// Radius 是服务器保证的时间误差半径
+	Radius time.Duration
+
+	// Sent 是发送请求的本地时间
+	Sent time.Time
+
+	// RTT 是请求的往返时间
+	RTT time.Duration
+
+	// Nonce 是请求中的随机数，与Raw一起构成服务器签名的证明
+	Nonce []byte
+
+	// Raw 是服务器应答的原始内容
+	Raw []byte
+}
+
+// Offset 返回服务器时间相对本地时钟的偏移量，假设服务器在往返时间的中点应答
+func (r *Response) Offset() time.Duration {
+	return r.Midpoint.Sub(r.Sent.Add(r.RTT / 2))
+}
+
+// Uncertainty 返回偏移量的误差上限，即误差半径加上往返时间的一半
+func (r *Response) Uncertainty() time.Duration {
+	return r.Radius + r.RTT/2
+}
+
+// Client 是Roughtime客户端
+type Client struct {
+	server  Server
+	timeout time.Duration
+	now     func() time.Time
+}
+
+// New 创建一个Roughtime客户端
+func New(opts Options) (*Client, error) {
+	if opts.Server.Address == "" {
+		return nil, errors.New("必须提供Roughtime服务器地址")
+	}
+	if len(opts.Server.PublicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("无效的Roughtime公钥长度: %d", len(opts.Server.PublicKey))
+	}
+
+	c := &Client{
+		server:  opts.Server,
+		timeout: opts.Timeout,
+		now:     opts.Now,
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+	return c, nil
+}
+
+// DecodePublicKey 解析Base64编码的服务器公钥
+func DecodePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("无效的Roughtime公钥: %v", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("无效的Roughtime公钥长度: %d", len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Name 返回服务器的名称，没有名称时返回地址
+func (c *Client) Name() string {
+	if c.server.Name != "" {
+		return c.server.Name
+	}
+	return c.server.Address
+}
+
+// Query 向服务器发送一次请求并验证应答
+func (c *Client) Query(ctx context.Context) (*Response, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("生成随机数失败: %v", err)
+	}
+
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "udp", c.server.Address)
+	if err != nil {
+		return nil, fmt.Errorf("连接Roughtime服务器 %s 失败: %v", c.server.Address, err)
+	}
+	defer conn.Close()
+
+	// 取消时立即中断读写
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, fmt.Errorf("设置超时时间失败: %v", err)
+	}
+
+	sent := c.now()
+	if _, err := conn.Write(newRequest(nonce)); err != nil {
+		return nil, fmt.Errorf("发送Roughtime请求失败: %v", err)
+	}
+
+	buf := make([]byte, maxResponseSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("读取Roughtime应答失败: %v", err)
+	}
+	rtt := c.now().Sub(sent)
+
+	midpoint, radius, err := verifyResponse(buf[:n], nonce, c.server.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Midpoint: midpoint,
+		Radius:   radius,
+		Sent:     sent,
+		RTT:      rtt,
+		Nonce:    nonce,
+		Raw:      buf[:n],
+	}, nil
+}
+
+// Measure 实现ntpsync.Source，查询服务器并返回偏移量及其误差上限
+func (c *Client) Measure(ctx context.Context) (*ntpsync.SyncResult, error) {
+	resp, err := c.Query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ntpsync.SyncResult{
+		Server:      c.Name(),
+		Time:        resp.Midpoint,
+		Offset:      resp.Offset(),
+		RTT:         resp.RTT,
+		Uncertainty: resp.Uncertainty(),
+	}, nil
+}
+
+// newRequest 创建携带随机数并填充到requestSize的请求
+func newRequest(nonce []byte) []byte {
+	// 两个标签的消息头长度为16字节
+	padding := requestSize - 16 - len(nonce)
+	return message{
+		tagNONC: nonce,
+		tagPAD:  bytes.Repeat([]byte{0}, padding),
+	}.encode()
+}
+
+// verifyResponse 验证应答的签名链和默克尔树路径，返回服务器的时间和误差半径
+func verifyResponse(data, nonce []byte, rootKey ed25519.PublicKey) (time.Time, time.Duration, error) {
+	fail := func(format string, args ...interface{}) (time.Time, time.Duration, error) {
+		return time.Time{}, 0, fmt.Errorf("%w: %s", ErrInvalidResponse, fmt.Sprintf(format, args...))
+	}
+
+	msg, err := decodeMessage(data)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	// 长期密钥签名的临时密钥
+	certBytes, err := msg.get(tagCERT, -1)
+	if err != nil {
+		return fail("%v", err)
+	}
+	cert, err := decodeMessage(certBytes)
+	if err != nil {
+		return fail("CERT: %v", err)
+	}
+	deleBytes, err := cert.get(tagDELE, -1)
+	if err != nil {
+		return fail("CERT: %v", err)
+	}
+	certSig, err := cert.get(tagSIG, ed25519.SignatureSize)
+	if err != nil {
+		return fail("CERT: %v", err)
+	}
+	if !ed25519.Verify(rootKey, append(append([]byte{}, delegationContext...), deleBytes...), certSig) {
+		return fail("临时密钥的签名无效")
+	}
+
+	dele, err := decodeMessage(deleBytes)
+	if err != nil {
+		return fail("DELE: %v", err)
+	}
+	pubk, err := dele.get(tagPUBK, ed25519.PublicKeySize)
+	if err != nil {
+		return fail("DELE: %v", err)
+	}
+	mint, err := dele.get(tagMINT, 8)
+	if err != nil {
+		return fail("DELE: %v", err)
+	}
+	maxt, err := dele.get(tagMAXT, 8)
+	if err != nil {
+		return fail("DELE: %v", err)
+	}
+
+	// 临时密钥签名的时间
+	srepBytes, err := msg.get(tagSREP, -1)
+	if err != nil {
+		return fail("%v", err)
+	}
+	sig, err := msg.get(tagSIG, ed25519.SignatureSize)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pubk), append(append([]byte{}, responseContext...), srepBytes...), sig) {
+		return fail("应答的签名无效")
+	}
+
+	srep, err := decodeMessage(srepBytes)
+	if err != nil {
+		return fail("SREP: %v", err)
+	}
+	root, err := srep.get(tagROOT, sha512.Size)
+	if err != nil {
+		return fail("SREP: %v", err)
+	}
+	midp, err := srep.get(tagMIDP, 8)
+	if err != nil {
+		return fail("SREP: %v", err)
+	}
+	radi, err := srep.get(tagRADI, 4)
+	if err != nil {
+		return fail("SREP: %v", err)
+	}
+
+	// 随机数必须包含在签名的默克尔树中
+	path, err := msg.get(tagPATH, -1)
+	if err != nil {
+		return fail("%v", err)
+	}
+	indx, err := msg.get(tagINDX, 4)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if !bytes.Equal(merkleRoot(nonce, path, binary.LittleEndian.Uint32(indx)), root) {
+		return fail("随机数不在签名的默克尔树中")
+	}
+
+	// 时间必须在临时密钥的有效期内
+	midpoint := binary.LittleEndian.Uint64(midp)
+	if midpoint < binary.LittleEndian.Uint64(mint) || midpoint > binary.LittleEndian.Uint64(maxt) {
+		return fail("时间不在临时密钥的有效期内")
+	}
+
+	return time.UnixMicro(int64(midpoint)), time.Duration(binary.LittleEndian.Uint32(radi)) * time.Microsecond, nil
+}
+
+// merkleRoot 根据随机数、路径和叶子序号计算默克尔树的根
+func merkleRoot(nonce, path []byte, index uint32) []byte {
+	h := sha512.New()
+	h.Write([]byte{0})
+	h.Write(nonce)
+	hash := h.Sum(nil)
+
+	for len(path) >= sha512.Size {
+		h.Reset()
+		h.Write([]byte{1})
+		if index&1 == 0 {
+			h.Write(hash)
+			h.Write(path[:sha512.Size])
+		} else {
+			h.Write(path[:sha512.Size])
+			h.Write(hash)
+		}
+		hash = h.Sum(hash[:0])
+		path = path[sha512.Size:]
+		index >>= 1
+	}
+	return hash
+}
@@ -0,0 +1,261 @@
+package roughtime
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// testServer 是一个用于测试的Roughtime服务器
+type testServer struct {
+	conn    net.PacketConn
+	rootKey ed25519.PrivateKey
+
+	mutex  sync.Mutex
+	now    func() time.Time
+	radius time.Duration
+
+	// sibling 非空时，请求作为默克尔树中序号为1的叶子，sibling是序号为0的叶子的哈希
+	sibling []byte
+
+	// corrupt 修改应答中的时间而不重新签名
+	corrupt bool
+}
+
+// newTestServer 创建并启动测试服务器
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听UDP端口失败: %v", err)
+	}
+	_, rootKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+
+	s := &testServer{conn: conn, rootKey: rootKey, now: time.Now, radius: time.Second}
+	go s.serve()
+	t.Cleanup(func() { _ = conn.Close() })
+	return s
+}
+
+// server 返回客户端使用的服务器描述
+func (s *testServer) server() Server {
+	return Server{
+		Name:      "test",
+		Address:   s.conn.LocalAddr().String(),
+		PublicKey: s.rootKey.Public().(ed25519.PublicKey),
+	}
+}
+
+// set 在持有锁时修改服务器的配置
+func (s *testServer) set(f func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f()
+}
+
+func (s *testServer) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.respond(buf[:n]); resp != nil {
+			_, _ = s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *testServer) respond(req []byte) []byte {
+	msg, err := decodeMessage(req)
+	if err != nil || len(req) < requestSize {
+		return nil
+	}
+	nonce, err := msg.get(tagNONC, nonceSize)
+	if err != nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	now := s.now()
+	radius := s.radius
+	sibling := s.sibling
+	corrupt := s.corrupt
+	s.mutex.Unlock()
+
+	h := sha512.New()
+	h.Write([]byte{0})
+	h.Write(nonce)
+	root := h.Sum(nil)
+	var path []byte
+	index := uint32(0)
+	if sibling != nil {
+		h.Reset()
+		h.Write([]byte{1})
+		h.Write(sibling)
+		h.Write(root)
+		root = h.Sum(nil)
+		path = sibling
+		index = 1
+	}
+
+	deleKey, deleSecret, _ := ed25519.GenerateKey(nil)
+	dele := message{
+		tagMINT: binary.LittleEndian.AppendUint64(nil, uint64(now.Add(-time.Hour).UnixMicro())),
+		tagMAXT: binary.LittleEndian.AppendUint64(nil, uint64(now.Add(time.Hour).UnixMicro())),
+		tagPUBK: deleKey,
+	}.encode()
+	cert := message{
+		tagDELE: dele,
+		tagSIG:  ed25519.Sign(s.rootKey, append(append([]byte{}, delegationContext...), dele...)),
+	}.encode()
+
+	srep := message{
+		tagRADI: binary.LittleEndian.AppendUint32(nil, uint32(radius/time.Microsecond)),
+		tagMIDP: binary.LittleEndian.AppendUint64(nil, uint64(now.UnixMicro())),
+		tagROOT: root,
+	}.encode()
+	sig := ed25519.Sign(deleSecret, append(append([]byte{}, responseContext...), srep...))
+	if corrupt {
+		srep = message{
+			tagRADI: binary.LittleEndian.AppendUint32(nil, uint32(radius/time.Microsecond)),
+			tagMIDP: binary.LittleEndian.AppendUint64(nil, uint64(now.Add(time.Minute).UnixMicro())),
+			tagROOT: root,
+		}.encode()
+	}
+
+	return message{
+		tagSIG:  sig,
+		tagPATH: path,
+		tagSREP: srep,
+		tagCERT: cert,
+		tagINDX: binary.LittleEndian.AppendUint32(nil, index),
+	}.encode()
+}
+
+// TestMessageRoundTrip 测试消息的编码和解析
+func TestMessageRoundTrip(t *testing.T) {
+	msg := message{
+		tagNONC: make([]byte, 64),
+		tagPAD:  make([]byte, 8),
+		tagRADI: {1, 2, 3, 4},
+	}
+	decoded, err := decodeMessage(msg.encode())
+	if err != nil {
+		t.Fatalf("解析消息失败: %v", err)
+	}
+	if len(decoded) != len(msg) {
+		t.Fatalf("预期%d个标签，实际得到%d个", len(msg), len(decoded))
+	}
+	if radi, err := decoded.get(tagRADI, 4); err != nil || radi[3] != 4 {
+		t.Errorf("预期RADI为[1 2 3 4]，实际得到%v（%v）", radi, err)
+	}
+
+	if len(newRequest(make([]byte, nonceSize))) != requestSize {
+		t.Errorf("预期请求长度为%d", requestSize)
+	}
+
+	if _, err := decodeMessage([]byte{2, 0, 0, 0, 0, 0}); err == nil {
+		t.Error("预期截断的消息返回错误，实际得到nil")
+	}
+}
+
+// TestQuery 测试查询并验证应答
+func TestQuery(t *testing.T) {
+	srv := newTestServer(t)
+	srv.set(func() {
+		srv.now = func() time.Time { return time.Now().Add(time.Hour) }
+		srv.radius = 500 * time.Millisecond
+	})
+
+	client, err := New(Options{Server: srv.server(), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+
+	resp, err := client.Query(context.Background())
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if resp.Radius != 500*time.Millisecond {
+		t.Errorf("预期误差半径为500ms，实际得到%v", resp.Radius)
+	}
+	if offset := resp.Offset(); offset < time.Hour-time.Second || offset > time.Hour+time.Second {
+		t.Errorf("预期偏移量约为1小时，实际得到%v", offset)
+	}
+
+	// 默克尔树中有两个叶子
+	srv.set(func() { srv.sibling = make([]byte, sha512.Size) })
+	if _, err := client.Query(context.Background()); err != nil {
+		t.Errorf("预期带路径的应答通过验证，实际得到%v", err)
+	}
+}
+
+// TestQueryInvalid 测试没有通过验证的应答
+func TestQueryInvalid(t *testing.T) {
+	srv := newTestServer(t)
+
+	// 公钥与服务器不符
+	other, _, _ := ed25519.GenerateKey(nil)
+	server := srv.server()
+	server.PublicKey = other
+	client, err := New(Options{Server: server, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	if _, err := client.Query(context.Background()); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("预期公钥不符时返回ErrInvalidResponse，实际得到%v", err)
+	}
+
+	// 时间被篡改
+	srv.set(func() { srv.corrupt = true })
+	client, _ = New(Options{Server: srv.server(), Timeout: time.Second})
+	if _, err := client.Query(context.Background()); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("预期时间被篡改时返回ErrInvalidResponse，实际得到%v", err)
+	}
+
+	if _, err := New(Options{Server: Server{Address: "127.0.0.1:2002"}}); err == nil {
+		t.Error("预期缺少公钥时返回错误，实际得到nil")
+	}
+}
+
+// TestSyncWithSource 测试将Roughtime作为NTPSync的时间源
+func TestSyncWithSource(t *testing.T) {
+	srv := newTestServer(t)
+	srv.set(func() { srv.now = func() time.Time { return time.Now().Add(-30 * time.Second) } })
+
+	client, err := New(Options{Server: srv.server(), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+
+	ntp, err := ntpsync.New(ntpsync.Options{Servers: []string{"127.0.0.1:1"}})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.SyncWithSource(context.Background(), client); err != nil {
+		t.Fatalf("使用Roughtime同步失败: %v", err)
+	}
+	if offset := ntp.TimeOffsetDuration(); offset < -31*time.Second || offset > -29*time.Second {
+		t.Errorf("预期偏移量约为-30秒，实际得到%v", offset)
+	}
+
+	if _, err := ntp.CrossCheck(context.Background(), client); err != nil {
+		t.Errorf("预期核对通过，实际得到%v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package roughtime
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// 消息中使用的标签
+var (
+	tagSIG  = makeTag("SIG\x00")
+	tagNONC = makeTag("NONC")
+	tagPAD  = makeTag("PAD\xff")
+	tagPATH = makeTag("PATH")
+	tagSREP = makeTag("SREP")
+	tagCERT = makeTag("CERT")
+	tagINDX = makeTag("INDX")
+	tagRADI = makeTag("RADI")
+	tagMIDP = makeTag("MIDP")
+	tagROOT = makeTag("ROOT")
+	tagDELE = makeTag("DELE")
+	tagMINT = makeTag("MINT")
+	tagMAXT = makeTag("MAXT")
+	tagPUBK = makeTag("PUBK")
+)
+
+// makeTag 将4个字节的标签名转换为消息中的小端序标签值
+func makeTag(name string) uint32 {
+	return binary.LittleEndian.Uint32([]byte(name))
+}
+
+// message 是Roughtime消息，标签到值的映射
+type message map[uint32][]byte
+
+// encode 将消息编码为线路格式：标签数量、值的偏移量、按升序排列的标签，之后是各个值
+// 所有值的长度都必须是4的倍数
+func (m message) encode() []byte {
+	tags := make([]uint32, 0, len(m))
+	size := 4
+	for tag, value := range m {
+		tags = append(tags, tag)
+		size += 8 + len(value)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	out := make([]byte, 0, size)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(tags)))
+
+	offset := 0
+	for i, tag := range tags {
+		if i > 0 {
+			out = binary.LittleEndian.AppendUint32(out, uint32(offset))
+		}
+		offset += len(m[tag])
+	}
+	for _, tag := range tags {
+		out = binary.LittleEndian.AppendUint32(out, tag)
+	}
+	for _, tag := range tags {
+		out = append(out, m[tag]...)
+	}
+	return out
+}
+
+// decodeMessage 解析线路格式的消息
+func decodeMessage(data []byte) (message, error) {
+	if len(data) < 4 {
+		return nil, errors.New("消息过短")
+	}
+
+	count := int(binary.LittleEndian.Uint32(data))
+	if count == 0 {
+		return message{}, nil
+	}
+	if count > len(data)/8 {
+		return nil, fmt.Errorf("消息的标签数量%d无效", count)
+	}
+
+	header := 4 + 4*(count-1) + 4*count
+	if len(data) < header {
+		return nil, errors.New("消息头不完整")
+	}
+	values := data[header:]
+
+	offsets := make([]int, count+1)
+	for i := 1; i < count; i++ {
+		offsets[i] = int(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	offsets[count] = len(values)
+
+	m := make(message, count)
+	var previous uint32
+	for i := 0; i < count; i++ {
+		tag := binary.LittleEndian.Uint32(data[4+4*(count-1)+4*i:])
+		if i > 0 && tag <= previous {
+			return nil, errors.New("消息的标签没有按升序排列")
+		}
+		previous = tag
+
+		start, end := offsets[i], offsets[i+1]
+		if start%4 != 0 || start > end || end > len(values) {
+			return nil, fmt.Errorf("消息的值偏移量%d无效", start)
+		}
+		m[tag] = values[start:end]
+	}
+	return m, nil
+}
+
+// get 返回标签对应的值，值不存在或长度不符时返回错误，size为负表示不检查长度
+func (m message) get(tag uint32, size int) ([]byte, error) {
+	value, ok := m[tag]
+	if !ok {
+		return nil, fmt.Errorf("消息缺少标签 %q", tagName(tag))
+	}
+	if size >= 0 && len(value) != size {
+		return nil, fmt.Errorf("标签 %q 的长度%d无效", tagName(tag), len(value))
+	}
+	return value, nil
+}
+
+// tagName 返回标签的名称
+func tagName(tag uint32) string {
+	b := binary.LittleEndian.AppendUint32(nil, tag)
+	for i := len(b); i > 0; i-- {
+		if b[i-1] != 0 && b[i-1] != 0xff {
+			return string(b[:i])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package ntpsync
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultHardwareClockInterval 是两次写入硬件时钟之间的默认最短间隔，与Linux内核的11分钟模式相同
+const DefaultHardwareClockInterval = 11 * time.Minute
+
+// ErrRTCUnsupported 表示当前平台不支持设置RTC设备
+var ErrRTCUnsupported = errors.New("当前平台不支持设置RTC设备")
+
+// HardwareClock 是电池供电的硬件时钟（RTC），设备断电重启后系统时间从它恢复
+type HardwareClock interface {
+	// SetTime 将硬件时钟设置为t，t是调用时校准后的时间
+	SetTime(t time.Time) error
+}
+
+// RTCDevice 是Linux的RTC设备文件，例如"/dev/rtc0"，通过RTC_SET_TIME ioctl以UTC设置时间，
+// 需要CAP_SYS_TIME权限。其它平台返回ErrRTCUnsupported
+type RTCDevice string
+
+// SetTime 等到t的下一个整秒再写入RTC设备
+// RTC只能精确到秒，并且从写入时开始计算下一秒，直接写入截断的时间会慢最多1秒
+func (d RTCDevice) SetTime(t time.Time) error {
+	wait := t.Truncate(time.Second).Add(time.Second).Sub(t)
+	time.Sleep(wait)
+	return setRTCTime(string(d), t.Add(wait))
+}
+
+// updateHardwareClock 在同步成功后把校准后的时间写入硬件时钟
+// 距离上次写入不足间隔或上一次写入还没有完成时跳过，
+// 写入失败时发布EventHardwareClockFailed事件，下一次同步成功后重试
+func (n *NTPSync) updateHardwareClock(result *SyncResult) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.hardwareClock == nil || n.hardwareClockBusy {
+		return
+	}
+	if !n.hardwareClockSet.IsZero() && n.clock.Now().Sub(n.hardwareClockSet) < n.hardwareClockInterval {
+		return
+	}
+	n.hardwareClockBusy = true
+	n.goAsyncLocked(func() {
+		err := n.hardwareClock.SetTime(n.Now())
+
+		n.mutex.Lock()
+		n.hardwareClockBusy = false
+		if err == nil {
+			n.hardwareClockSet = n.clock.Now()
+		}
+		n.mutex.Unlock()
+
+		if err != nil {
+			n.emit(Event{Type: EventHardwareClockFailed, Server: result.Server, Error: err})
+		}
+	})
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// rtcTime 对应Linux的struct rtc_time
+type rtcTime struct {
+	Sec   int32
+	Min   int32
+	Hour  int32
+	Mday  int32
+	Mon   int32
+	Year  int32
+	Wday  int32
+	Yday  int32
+	Isdst int32
+}
+
+// rtcSetTimeRequest 返回RTC_SET_TIME的ioctl请求码，即_IOW('p', 0x0a, struct rtc_time)
+// MIPS和PowerPC的写方向位与其它架构不同
+func rtcSetTimeRequest() uintptr {
+	write, dirShift := uintptr(1), 30
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le", "ppc64", "ppc64le":
+		write, dirShift = 4, 29
+	}
+	return write<<dirShift | unsafe.Sizeof(rtcTime{})<<16 | 'p'<<8 | 0x0a
+}
+
+// setRTCTime 通过RTC_SET_TIME ioctl将RTC设备设置为t（UTC）
+func setRTCTime(device string, t time.Time) error {
+	f, err := os.Open(device)
+	if err != nil {
+		return fmt.Errorf("打开RTC设备失败: %w", err)
+	}
+	defer f.Close()
+
+	t = t.UTC()
+	tm := rtcTime{
+		Sec:  int32(t.Second()),
+		Min:  int32(t.Minute()),
+		Hour: int32(t.Hour()),
+		Mday: int32(t.Day()),
+		Mon:  int32(t.Month()) - 1,
+		Year: int32(t.Year()) - 1900,
+		Wday: int32(t.Weekday()),
+		Yday: int32(t.YearDay()) - 1,
+	}
+
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, rtcSetTimeRequest(), uintptr(unsafe.Pointer(&tm)))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return fmt.Errorf("设置RTC设备 %s 失败: %w", device, errno)
+	}
+	return nil
+}
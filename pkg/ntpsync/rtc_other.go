@@ -0,0 +1,10 @@
+//go:build !linux
+
+package ntpsync
+
+import "time"
+
+// setRTCTime 在不支持的平台上返回ErrRTCUnsupported
+func setRTCTime(device string, t time.Time) error {
+	return ErrRTCUnsupported
+}
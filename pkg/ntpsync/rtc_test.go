@@ -0,0 +1,137 @@
+package ntpsync
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHardwareClock 记录写入的时间，err非nil时写入失败
+type fakeHardwareClock struct {
+	mutex sync.Mutex
+	times []time.Time
+	err   error
+}
+
+func (c *fakeHardwareClock) SetTime(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	c.times = append(c.times, t)
+	return nil
+}
+
+func (c *fakeHardwareClock) writes() []time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]time.Time(nil), c.times...)
+}
+
+// waitForWrites 等待硬件时钟被写入count次
+func waitForWrites(t *testing.T, rtc *fakeHardwareClock, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rtc.writes()) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待第%d次写入硬件时钟超时", count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestHardwareClock 测试同步成功后写入校准后的时间，并且两次写入之间至少间隔HardwareClockInterval
+func TestHardwareClock(t *testing.T) {
+	clock := newFakeClock()
+	rtc := &fakeHardwareClock{}
+	ntp, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		PreferredSources: []Source{&fakeSource{offset: time.Hour}},
+		MinPollInterval:  -1,
+		Clock:            clock,
+		HardwareClock:    rtc,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	waitForWrites(t, rtc, 1)
+	if got := rtc.writes()[0]; got.Sub(clock.Now()) != time.Hour {
+		t.Errorf("预期写入校准后的时间%v，实际得到%v", clock.Now().Add(time.Hour), got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ntp.mutex.RLock()
+		done := !ntp.hardwareClockBusy
+		ntp.mutex.RUnlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("等待写入完成超时")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 不足间隔时不再写入
+	clock.Advance(time.Minute)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if got := len(rtc.writes()); got != 1 {
+		t.Errorf("预期间隔内只写入1次，实际写入%d次", got)
+	}
+
+	clock.Advance(DefaultHardwareClockInterval)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	waitForWrites(t, rtc, 2)
+}
+
+// TestHardwareClockFailed 测试写入失败时发布事件，下一次同步成功后重试
+func TestHardwareClockFailed(t *testing.T) {
+	rtc := &fakeHardwareClock{err: errors.New("permission denied")}
+	ntp, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		PreferredSources: []Source{&fakeSource{offset: time.Millisecond}},
+		MinPollInterval:  -1,
+		HardwareClock:    rtc,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	events, cancel := ntp.Subscribe(0)
+	defer cancel()
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	timeout := time.After(5 * time.Second)
+	for failed := false; !failed; {
+		select {
+		case ev := <-events:
+			failed = ev.Type == EventHardwareClockFailed && ev.Error == rtc.err
+		case <-timeout:
+			t.Fatal("等待EventHardwareClockFailed事件超时")
+		}
+	}
+
+	rtc.mutex.Lock()
+	rtc.err = nil
+	rtc.mutex.Unlock()
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	waitForWrites(t, rtc, 1)
+}
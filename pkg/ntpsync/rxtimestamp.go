@@ -0,0 +1,47 @@
+package ntpsync
+
+import (
+	"net"
+	"time"
+)
+
+// maxKernelTimestampLag 是内核接收时间戳早于读取时间的最大合理间隔，
+// 超过时认为系统时钟在两者之间被调整过，改用读取时间
+const maxKernelTimestampLag = time.Second
+
+// kernelTimestamps 表示是否使用内核记录的接收时间戳，
+// 只有本地时间来自系统时钟时内核时间戳才与之可比
+func (n *NTPSync) kernelTimestamps() bool {
+	_, ok := n.clock.(SystemClock)
+	return ok && kernelTimestampsSupported
+}
+
+// setSocketOption 对UDP连接的套接字调用set，例如setKernelTimestamps，失败或不支持时返回false
+func setSocketOption(conn *net.UDPConn, set func(fd uintptr) error) bool {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = set(fd)
+	}); err != nil || sockErr != nil {
+		return false
+	}
+	return true
+}
+
+// receiveTime 按控制消息中的内核接收时间戳修正读取数据包后的本地时间now。
+// 内核在数据包到达时记录时间戳，不包括数据包在套接字缓冲区中等待和读取goroutine被调度的延迟。
+// 返回值保留now的单调时钟读数，没有时间戳或时间戳不合理时返回now
+func receiveTime(now time.Time, oob []byte) time.Time {
+	kernel, ok := parseKernelTimestamp(oob)
+	if !ok {
+		return now
+	}
+	lag := now.Sub(kernel)
+	if lag < 0 || lag > maxKernelTimestampLag {
+		return now
+	}
+	return now.Add(-lag)
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"encoding/binary"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// kernelTimestampsSupported 表示当前平台是否支持内核接收时间戳
+const kernelTimestampsSupported = true
+
+// kernelTimestampSpace 是接收控制消息的缓冲区大小，足够容纳一个SCM_TIMESTAMPNS消息
+var kernelTimestampSpace = syscall.CmsgSpace(timespecSize)
+
+// timespecSize 是struct timespec的大小，两个字段在64位平台上各占8字节，在32位平台上各占4字节
+const timespecSize = int(unsafe.Sizeof(syscall.Timespec{}))
+
+// setKernelTimestamps 设置SO_TIMESTAMPNS，内核在每个数据包的控制消息中附带纳秒精度的接收时间
+func setKernelTimestamps(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TIMESTAMPNS, 1)
+}
+
+// parseKernelTimestamp 从控制消息中解析内核的软件接收时间戳，
+// 即SCM_TIMESTAMPNS或SCM_TIMESTAMPING中的第一个时间戳
+func parseKernelTimestamp(oob []byte) (time.Time, bool) {
+	if len(oob) == 0 {
+		return time.Time{}, false
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, m := range msgs {
+		if m.Header.Level != syscall.SOL_SOCKET {
+			continue
+		}
+		if m.Header.Type == syscall.SCM_TIMESTAMPNS || m.Header.Type == syscall.SO_TIMESTAMPING {
+			if ts, ok := decodeTimespec(m.Data, 0); ok {
+				return ts, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// decodeTimespec 解析data中第i个struct timespec，全零或长度不足时返回false
+func decodeTimespec(data []byte, i int) (time.Time, bool) {
+	b := data[min(i*timespecSize, len(data)):]
+	if len(b) < timespecSize {
+		return time.Time{}, false
+	}
+	var sec, nsec int64
+	if timespecSize == 16 {
+		sec = int64(binary.NativeEndian.Uint64(b[0:]))
+		nsec = int64(binary.NativeEndian.Uint64(b[8:]))
+	} else {
+		sec = int64(int32(binary.NativeEndian.Uint32(b[0:])))
+		nsec = int64(int32(binary.NativeEndian.Uint32(b[4:])))
+	}
+	if sec == 0 && nsec == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, nsec), true
+}
@@ -0,0 +1,99 @@
+//go:build linux
+
+package ntpsync
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestKernelTimestamps 测试从控制消息中读取内核接收时间戳
+func TestKernelTimestamps(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("创建UDP套接字失败: %v", err)
+	}
+	defer conn.Close()
+	if !setSocketOption(conn, setKernelTimestamps) {
+		t.Fatal("启用内核接收时间戳失败")
+	}
+
+	sender, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer sender.Close()
+	// 没有其它套接字请求时间戳时，内核通过工作队列异步开始在数据包到达时记录时间戳，
+	// 生效前到达的数据包在读取时才记录，因此先等待它生效
+	time.Sleep(20 * time.Millisecond)
+
+	before := time.Now()
+	if _, err := sender.Write([]byte("ping")); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	// 数据包在缓冲区中等待的时间不计入接收时间
+	time.Sleep(20 * time.Millisecond)
+
+	buf := make([]byte, 16)
+	oob := make([]byte, kernelTimestampSpace)
+	_, oobRead, _, _, err := conn.ReadMsgUDP(buf, oob)
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	now := time.Now()
+	kernel, ok := parseKernelTimestamp(oob[:oobRead])
+	if !ok {
+		t.Fatal("预期控制消息中有内核接收时间戳")
+	}
+	if kernel.Before(before.Add(-time.Millisecond)) || now.Sub(kernel) < 20*time.Millisecond {
+		t.Errorf("预期内核时间戳在发送之后且早于读取至少20ms，实际为%v，读取时间为%v", kernel, now)
+	}
+
+	// 修正后的接收时间保留单调时钟读数
+	received := receiveTime(now, oob[:oobRead])
+	if !received.Equal(kernel) || now.Sub(received) != now.Sub(kernel) {
+		t.Errorf("预期接收时间为内核时间戳%v，实际得到%v", kernel, received)
+	}
+	// 没有时间戳或时间戳不合理时使用读取时间
+	if got := receiveTime(now, nil); got != now {
+		t.Errorf("预期没有时间戳时返回读取时间，实际得到%v", got)
+	}
+	if got := receiveTime(kernel.Add(-time.Millisecond), oob[:oobRead]); !got.Equal(kernel.Add(-time.Millisecond)) {
+		t.Errorf("预期时间戳晚于读取时间时返回读取时间，实际得到%v", got)
+	}
+}
+
+// TestSyncKernelTimestamps 测试使用系统时钟同步时共用套接字启用了内核接收时间戳
+func TestSyncKernelTimestamps(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+
+	ntp, err := New(Options{Servers: []string{srv.Addr()}, MinPollInterval: -1})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if !ntp.socket.kernelTimestamps {
+		t.Error("预期共用套接字启用了内核接收时间戳")
+	}
+	if ts := ntp.GetHistory(1)[0].Timestamps; ts == nil || ts.Delay() < 0 {
+		t.Errorf("预期往返时间不为负，实际得到%+v", ts)
+	}
+
+	// 使用假时钟时不启用
+	fake, err := New(Options{Servers: []string{srv.Addr()}, MinPollInterval: -1, Clock: newFakeClock()})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer fake.Close()
+	if fake.kernelTimestamps() {
+		t.Error("预期使用假时钟时不启用内核接收时间戳")
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package ntpsync
+
+import "time"
+
+// kernelTimestampsSupported 表示当前平台是否支持内核接收时间戳
+const kernelTimestampsSupported = false
+
+// kernelTimestampSpace 是接收控制消息的缓冲区大小，不支持内核时间戳时不需要
+const kernelTimestampSpace = 0
+
+// setKernelTimestamps 在不支持内核接收时间戳的平台上总是返回errSocketOptionsUnsupported
+func setKernelTimestamps(fd uintptr) error {
+	return errSocketOptionsUnsupported
+}
+
+// parseKernelTimestamp 在不支持内核接收时间戳的平台上总是返回false
+func parseKernelTimestamp(oob []byte) (time.Time, bool) {
+	return time.Time{}, false
+}
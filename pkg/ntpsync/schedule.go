@@ -0,0 +1,270 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 决定定时同步的时间，用于代替固定的同步间隔，
+// 例如只在维护窗口内同步，或者与设备的唤醒时间对齐
+type Schedule interface {
+	// Next 返回after之后的下一次同步时间，没有下一次时返回零值
+	Next(after time.Time) time.Time
+}
+
+// maxScheduleSearch 是查找cron表达式下一次触发时间的范围，
+// 闰年的2月29日最多四年出现一次，因此查找略多于四年
+const maxScheduleSearch = 5 * 366 * 24 * time.Hour
+
+// ParseSchedule 解析同步计划，支持以下格式：
+//
+//	"0,30 * * * *"   5个字段的cron表达式：分 时 日 月 星期，支持*、列表、范围和步长
+//	"@hourly"        每小时整点，另有@daily（@midnight）、@weekly和@monthly
+//	"@every 30m"     按墙上时钟对齐的固定间隔，从当地午夜开始计算，例如每个:00和:30
+//
+// 时间按本地时钟的时区计算
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		return parseCron(spec, "0 * * * *")
+	case "@daily", "@midnight":
+		return parseCron(spec, "0 0 * * *")
+	case "@weekly":
+		return parseCron(spec, "0 0 * * 0")
+	case "@monthly":
+		return parseCron(spec, "0 0 1 * *")
+	}
+
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("无效的同步计划 %q: %v", spec, err)
+		}
+		if interval < time.Second || interval > 24*time.Hour {
+			return nil, fmt.Errorf("无效的同步计划 %q: 间隔必须在1秒到24小时之间", spec)
+		}
+		return AlignedSchedule{Interval: interval}, nil
+	}
+	if strings.HasPrefix(spec, "@") {
+		return nil, fmt.Errorf("无效的同步计划 %q: 未知的描述符", spec)
+	}
+	return parseCron(spec, spec)
+}
+
+// AlignedSchedule 是按墙上时钟对齐的固定间隔：从当地午夜开始，每隔Interval同步一次，
+// 例如Interval为30分钟时在每个:00和:30同步。间隔不能整除一天时，最后一段在午夜截断
+type AlignedSchedule struct {
+	Interval time.Duration
+}
+
+// Next 实现Schedule
+func (s AlignedSchedule) Next(after time.Time) time.Time {
+	if s.Interval <= 0 {
+		return time.Time{}
+	}
+
+	y, m, d := after.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, after.Location())
+	next := midnight.Add((after.Sub(midnight)/s.Interval + 1) * s.Interval)
+	if tomorrow := time.Date(y, m, d+1, 0, 0, 0, 0, after.Location()); !next.Before(tomorrow) {
+		return tomorrow
+	}
+	return next
+}
+
+// String 返回与ParseSchedule对应的格式
+func (s AlignedSchedule) String() string {
+	return "@every " + s.Interval.String()
+}
+
+// cronSchedule 是解析后的cron表达式，每个字段以位集合表示允许的值
+type cronSchedule struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+}
+
+// cronField 描述cron表达式一个字段的取值范围
+type cronField struct {
+	name     string
+	min, max int
+}
+
+// cron表达式的字段，星期的7与0都表示星期日
+var cronFields = [5]cronField{
+	{"分", 0, 59},
+	{"时", 0, 23},
+	{"日", 1, 31},
+	{"月", 1, 12},
+	{"星期", 0, 7},
+}
+
+// parseCron 解析5个字段的cron表达式，spec是用于显示的原始写法
+func parseCron(spec, expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("无效的同步计划 %q: cron表达式需要5个字段，实际为%d个", spec, len(fields))
+	}
+
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("无效的同步计划 %q: %v", spec, err)
+		}
+		bits[i] = b
+	}
+
+	// 星期日可以写成0或7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+
+	s := &cronSchedule{
+		spec:          spec,
+		minute:        bits[0],
+		hour:          bits[1],
+		dom:           bits[2],
+		month:         bits[3],
+		dow:           bits[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}
+	if s.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("无效的同步计划 %q: 永远不会触发", spec)
+	}
+	return s, nil
+}
+
+// parseCronField 解析cron表达式的一个字段，返回允许的值的位集合
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s字段的步长%q无效", f.name, stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = cronValue(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s字段的范围%q无效", f.name, rangePart)
+			}
+		default:
+			v, err := cronValue(rangePart, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// cronValue 解析cron字段中的一个数值并检查范围
+func cronValue(s string, f cronField) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s字段的值%q无效", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s字段的值%d超出范围%d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next 实现Schedule，返回after之后第一个满足表达式的整分钟
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(maxScheduleSearch)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			// 按绝对时间前进，夏令时结束时重复的一小时不会回退
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches 判断日期是否满足日和星期字段
+// 与传统cron相同，两个字段都有限制时满足其中之一即可
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// String 返回解析前的同步计划
+func (s *cronSchedule) String() string {
+	return s.spec
+}
+
+// validateSchedule 检查同步计划是否还有下一次同步
+func validateSchedule(s Schedule, now time.Time) error {
+	if s == nil {
+		return nil
+	}
+	if s.Next(now).IsZero() {
+		return errors.New("同步计划没有下一次同步时间")
+	}
+	return nil
+}
+
+// SetSchedule 设置定时同步的计划，nil表示恢复按同步间隔同步
+// 正在等待的下一次同步不受影响，之后的同步按新的计划进行
+func (n *NTPSync) SetSchedule(s Schedule) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if err := validateSchedule(s, n.correctedLocked(n.clock.Now())); err != nil {
+		return err
+	}
+	n.schedule = s
+	return nil
+}
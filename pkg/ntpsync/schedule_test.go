@@ -0,0 +1,163 @@
+package ntpsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestParseSchedule 测试cron表达式、描述符和对齐间隔的下一次同步时间
+func TestParseSchedule(t *testing.T) {
+	// 2024-01-01是星期一
+	base := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"0,30 * * * *", time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"5-10 * * * *", time.Date(2024, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"0 2-4 * * *", time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC)},
+		{"0 3 * * 6,7", time.Date(2024, 1, 6, 3, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)}, // 日和星期满足其一即可
+		{"@hourly", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"@every 30m", time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"@every 7h", time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("%s: 解析失败: %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%s: 预期下一次同步在%v，实际得到%v", tt.spec, tt.want, got)
+		}
+		// String的结果可以重新解析为相同的计划
+		again, err := ParseSchedule(s.(interface{ String() string }).String())
+		if err != nil || !again.Next(base).Equal(tt.want) {
+			t.Errorf("%s: 重新解析String的结果失败: %v", tt.spec, err)
+		}
+	}
+
+	// 不能整除一天的间隔在午夜截断
+	s, _ := ParseSchedule("@every 7h")
+	if got := s.Next(time.Date(2024, 1, 1, 21, 0, 0, 0, time.UTC)); !got.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("预期在午夜截断，实际得到%v", got)
+	}
+
+	// 按本地时区对齐
+	loc := time.FixedZone("IST", 5*3600+1800)
+	s, _ = ParseSchedule("0 * * * *")
+	if got := s.Next(time.Date(2024, 1, 1, 10, 7, 0, 0, loc)); !got.Equal(time.Date(2024, 1, 1, 11, 0, 0, 0, loc)) {
+		t.Errorf("预期按本地时区的整点同步，实际得到%v", got)
+	}
+
+	for _, spec := range []string{
+		"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *",
+		"5-1 * * * *", "a * * * *", "0 0 30 2 *", "@yearly", "@every 0s", "@every 48h",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("预期%q解析失败，实际成功", spec)
+		}
+	}
+}
+
+// TestScheduledSync 测试定时同步按计划对齐，并跳过距离过近的计划时间
+func TestScheduledSync(t *testing.T) {
+	clock := newFakeClock()
+	clock.Advance(7 * time.Minute)
+
+	server := ntptest.NewServer()
+	defer server.Close()
+	server.SetNow(clock.Now)
+
+	schedule, err := ParseSchedule("@every 30m")
+	if err != nil {
+		t.Fatalf("解析同步计划失败: %v", err)
+	}
+	ntp, err := New(Options{
+		Servers:         []string{server.Addr()},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+		Schedule:        schedule,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+	clock.waitForTimers(t, 1)
+	if want := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC); !clock.timerAt(want) {
+		t.Errorf("预期下一次同步在%v", want)
+	}
+	ntp.StopPeriodicSync()
+
+	// 距离下一个计划时间不足最小请求间隔时顺延到再下一个
+	ntp.mutex.Lock()
+	delay := ntp.scheduledDelayLocked(25 * time.Minute)
+	ntp.mutex.Unlock()
+	if delay != 53*time.Minute {
+		t.Errorf("预期等待53分钟，实际得到%v", delay)
+	}
+
+	if err := ntp.SetSchedule(AlignedSchedule{}); err == nil {
+		t.Error("预期没有下一次同步的计划返回错误")
+	}
+}
+
+// endingSchedule 是在end之前每小时同步一次、之后没有下一次同步的计划
+type endingSchedule struct {
+	end time.Time
+}
+
+func (s endingSchedule) Next(after time.Time) time.Time {
+	if !after.Before(s.end) {
+		return time.Time{}
+	}
+	return after.Truncate(time.Hour).Add(time.Hour)
+}
+
+// TestScheduleUsesClock 测试同步计划按注入的时钟检查，按校准后的时间计算下一次同步
+func TestScheduleUsesClock(t *testing.T) {
+	clock := newFakeClock()
+	clock.Advance(7 * time.Minute)
+
+	schedule := endingSchedule{end: clock.Now().Add(24 * time.Hour)}
+	ntp, err := New(Options{
+		Servers:  []string{"127.0.0.1:1"},
+		Schedule: schedule,
+		Clock:    clock,
+	})
+	if err != nil {
+		t.Fatalf("预期按注入的时钟检查同步计划，实际创建失败: %v", err)
+	}
+	defer ntp.Close()
+
+	// 校准后的时间比本地时钟快5分钟，距离下一个整点还有48分钟
+	if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: 5 * time.Minute}); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	ntp.mutex.Lock()
+	delay := ntp.scheduledDelayLocked(0)
+	ntp.mutex.Unlock()
+	if delay != 48*time.Minute {
+		t.Errorf("预期等待48分钟，实际得到%v", delay)
+	}
+
+	clock.Advance(25 * time.Hour)
+	if err := ntp.SetSchedule(schedule); err == nil {
+		t.Error("预期计划结束之后设置计划返回错误")
+	}
+}
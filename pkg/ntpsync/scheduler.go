@@ -0,0 +1,281 @@
+package ntpsync
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultSchedulerConcurrency 是共享调度器同时执行的同步数量上限的默认值
+const DefaultSchedulerConcurrency = 16
+
+// ErrSchedulerClosed 表示共享调度器已经关闭
+var ErrSchedulerClosed = errors.New("调度器已关闭")
+
+// SchedulerOptions 包含创建共享调度器的选项
+type SchedulerOptions struct {
+	// MaxConcurrent 是同时执行的同步数量上限，到期的同步超过上限时排队等待。
+	// 零值表示使用DefaultSchedulerConcurrency
+	MaxConcurrent int
+
+	// Clock 是调度器使用的时间来源，nil表示使用系统时钟
+	Clock Clock
+}
+
+// Scheduler 让多个NTPSync实例共用一个goroutine和一个定时器执行定时同步
+//
+// 默认情况下每个实例的定时同步占用一个常驻goroutine和一个定时器。多租户网关上有数百个实例时，
+// 可以把同一个Scheduler设置到每个实例的Options.Scheduler：调度器按下一次同步的时间
+// 维护一个最小堆，只为最早到期的实例设置一个定时器，到期的同步在临时goroutine中执行，
+// 同时执行的数量不超过MaxConcurrent。空闲的实例不占用任何goroutine和定时器
+type Scheduler struct {
+	clock Clock
+	slots chan struct{}
+
+	mutex  sync.Mutex
+	jobs   jobQueue
+	byInst map[*NTPSync]*scheduledJob
+	closed bool
+
+	// wake 在最早到期的时间变化时唤醒调度循环
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// scheduledJob 是一个实例在调度器中的定时同步
+type scheduledJob struct {
+	n   *NTPSync
+	due time.Time
+
+	// index 是在堆中的位置，不在堆中（正在执行）时为-1
+	index int
+
+	// first 表示下一次执行的是初始同步
+	first bool
+
+	// resync 表示下一次执行是网络或时钟变化后的重新同步
+	resync bool
+
+	// stopped 表示实例已经停止定时同步，正在执行的同步结束后不再排队
+	stopped bool
+}
+
+// NewScheduler 创建共享调度器并启动调度goroutine
+func NewScheduler(opts SchedulerOptions) *Scheduler {
+	limit := opts.MaxConcurrent
+	if limit <= 0 {
+		limit = DefaultSchedulerConcurrency
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = SystemClock{}
+	}
+
+	s := &Scheduler{
+		clock:  clock,
+		slots:  make(chan struct{}, limit),
+		byInst: make(map[*NTPSync]*scheduledJob),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// Close 停止调度goroutine，已经开始的同步会继续执行完
+// 之后仍在使用该调度器的实例不再定时同步，StartPeriodicSync返回ErrSchedulerClosed
+func (s *Scheduler) Close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	s.mutex.Unlock()
+
+	<-s.done
+}
+
+// Len 返回在调度器中定时同步的实例数量
+func (s *Scheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.byInst)
+}
+
+// add 开始调度实例n的定时同步，初始同步在delay之后执行
+// 调用者已经为n.syncWaitGroup加1，实例停止且正在执行的同步结束后减1
+func (s *Scheduler) add(n *NTPSync, delay time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrSchedulerClosed
+	}
+	if _, exists := s.byInst[n]; exists {
+		return errors.New("同步已经在运行中")
+	}
+	job := &scheduledJob{n: n, due: s.clock.Now().Add(delay), first: true}
+	s.byInst[n] = job
+	heap.Push(&s.jobs, job)
+	s.wakeLocked()
+	return nil
+}
+
+// remove 停止调度实例n，正在执行的同步结束后才减少n.syncWaitGroup
+func (s *Scheduler) remove(n *NTPSync) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, exists := s.byInst[n]
+	if !exists || job.stopped {
+		return
+	}
+	job.stopped = true
+	if job.index >= 0 {
+		heap.Remove(&s.jobs, job.index)
+		delete(s.byInst, n)
+		n.syncWaitGroup.Done()
+	}
+}
+
+// trigger 让实例n立即重新同步，返回n是否在调度器中
+func (s *Scheduler) trigger(n *NTPSync) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, exists := s.byInst[n]
+	if !exists || job.stopped {
+		return false
+	}
+	job.resync = true
+	if job.index >= 0 {
+		job.due = s.clock.Now()
+		heap.Fix(&s.jobs, job.index)
+		s.wakeLocked()
+	}
+	return true
+}
+
+// wakeLocked 唤醒调度循环重新计算等待时间，调用者必须持有s.mutex
+func (s *Scheduler) wakeLocked() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop 是调度goroutine：取出所有到期的同步交给临时goroutine执行，然后等待最早到期的时间
+func (s *Scheduler) loop() {
+	defer close(s.done)
+
+	for {
+		s.mutex.Lock()
+		now := s.clock.Now()
+		for len(s.jobs) > 0 && !s.jobs[0].due.After(now) {
+			job := heap.Pop(&s.jobs).(*scheduledJob)
+			go s.run(job)
+		}
+		wait := time.Duration(-1)
+		if len(s.jobs) > 0 {
+			wait = s.jobs[0].due.Sub(now)
+		}
+		s.mutex.Unlock()
+
+		var timer Timer
+		var fired <-chan time.Time
+		if wait >= 0 {
+			timer = s.clock.NewTimer(wait)
+			fired = timer.C()
+		}
+		select {
+		case <-fired:
+		case <-s.wake:
+		case <-s.stop:
+		}
+		if timer != nil {
+			stopTimer(timer)
+		}
+
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+// run 在同步数量上限之内执行一次同步，然后按结果重新排队
+func (s *Scheduler) run(job *scheduledJob) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	n := job.n
+	s.mutex.Lock()
+	first, resync := job.first, job.resync
+	job.first, job.resync = false, false
+	s.mutex.Unlock()
+
+	delay, ok := time.Duration(0), true
+	switch {
+	case first:
+		delay, ok = n.firstCycle()
+	case resync:
+		n.scheduleNext(0)
+		delay = n.runCycle()
+		n.reprobe()
+	default:
+		delay = n.runCycle()
+	}
+
+	s.mutex.Lock()
+	if job.stopped || !ok {
+		delete(s.byInst, n)
+		s.mutex.Unlock()
+		n.syncWaitGroup.Done()
+		return
+	}
+	if job.resync {
+		// 执行期间收到了重新同步的请求
+		delay = 0
+	}
+	job.due = s.clock.Now().Add(delay)
+	heap.Push(&s.jobs, job)
+	s.wakeLocked()
+	s.mutex.Unlock()
+
+	n.scheduleNext(delay)
+}
+
+// jobQueue 是按到期时间排序的最小堆
+type jobQueue []*scheduledJob
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x interface{}) {
+	job := x.(*scheduledJob)
+	job.index = len(*q)
+	*q = append(*q, job)
+}
+
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	job := old[len(old)-1]
+	old[len(old)-1] = nil
+	job.index = -1
+	*q = old[:len(old)-1]
+	return job
+}
@@ -0,0 +1,196 @@
+package ntpsync
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitForSyncs 等待实例完成count次成功同步
+func waitForSyncs(tb testing.TB, n *NTPSync, count int64) {
+	tb.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for n.GetPeriodicSyncStatus().SuccessCount < count {
+		if time.Now().After(deadline) {
+			tb.Fatalf("等待第%d次同步超时", count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newScheduledInstance 创建使用调度器和假时间源的实例
+func newScheduledInstance(tb testing.TB, clock *fakeClock, scheduler *Scheduler, interval time.Duration) *NTPSync {
+	tb.Helper()
+
+	ntp, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		SyncInterval:     interval,
+		PreferredSources: []Source{&fakeSource{offset: time.Millisecond}},
+		MinPollInterval:  -1,
+		Clock:            clock,
+		Scheduler:        scheduler,
+	})
+	if err != nil {
+		tb.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	return ntp
+}
+
+// TestSchedulerSharesTimer 测试多个实例共用调度器的一个定时器并各自按同步间隔同步
+func TestSchedulerSharesTimer(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(SchedulerOptions{Clock: clock})
+	defer scheduler.Close()
+
+	fast := newScheduledInstance(t, clock, scheduler, time.Minute)
+	defer fast.Close()
+	slow := newScheduledInstance(t, clock, scheduler, 2*time.Minute)
+	defer slow.Close()
+
+	for _, ntp := range []*NTPSync{fast, slow} {
+		if err := ntp.StartPeriodicSync(); err != nil {
+			t.Fatalf("启动定时同步失败: %v", err)
+		}
+		waitForSyncs(t, ntp, 1)
+	}
+	if scheduler.Len() != 2 {
+		t.Errorf("预期调度器中有2个实例，实际得到%d个", scheduler.Len())
+	}
+
+	// 两个实例只占用调度器的一个定时器
+	clock.waitForTimers(t, 1)
+	if got := clock.activeTimers(); got != 1 {
+		t.Errorf("预期只有1个定时器，实际得到%d个", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !fast.GetPeriodicSyncStatus().NextSync.Equal(clock.Now().Add(time.Minute)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("预期下一次同步在1分钟后，实际得到%v", fast.GetPeriodicSyncStatus().NextSync)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(time.Minute)
+	waitForSyncs(t, fast, 2)
+	clock.waitForTimers(t, 1)
+	if got := slow.GetPeriodicSyncStatus().SuccessCount; got != 1 {
+		t.Errorf("预期同步间隔为2分钟的实例还没有再次同步，实际同步了%d次", got)
+	}
+
+	clock.Advance(time.Minute)
+	waitForSyncs(t, fast, 3)
+	waitForSyncs(t, slow, 2)
+
+	// 停止后从调度器中移除
+	slow.StopPeriodicSync()
+	if scheduler.Len() != 1 || slow.IsPeriodicSyncRunning() {
+		t.Errorf("预期停止的实例从调度器中移除，实际还有%d个实例", scheduler.Len())
+	}
+}
+
+// TestSchedulerResync 测试网络或时钟变化后由调度器立即重新同步
+func TestSchedulerResync(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(SchedulerOptions{Clock: clock})
+	defer scheduler.Close()
+
+	ntp := newScheduledInstance(t, clock, scheduler, time.Hour)
+	defer ntp.Close()
+	if err := ntp.StartPeriodicSync(); err != nil {
+		t.Fatalf("启动定时同步失败: %v", err)
+	}
+	waitForSyncs(t, ntp, 1)
+
+	ntp.resync()
+	waitForSyncs(t, ntp, 2)
+
+	if err := ntp.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if scheduler.Len() != 0 {
+		t.Errorf("预期关闭的实例从调度器中移除，实际还有%d个实例", scheduler.Len())
+	}
+}
+
+// TestSchedulerClosed 测试调度器关闭后不能再启动定时同步
+func TestSchedulerClosed(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(SchedulerOptions{Clock: clock})
+	scheduler.Close()
+
+	ntp := newScheduledInstance(t, clock, scheduler, time.Hour)
+	defer ntp.Close()
+	if err := ntp.StartPeriodicSync(); err != ErrSchedulerClosed {
+		t.Errorf("预期返回ErrSchedulerClosed，实际得到%v", err)
+	}
+	if ntp.IsPeriodicSyncRunning() {
+		t.Error("预期定时同步没有运行")
+	}
+
+	// New启动定时同步失败时关闭已经启动的后台goroutine
+	before := runtime.NumGoroutine()
+	if _, err := New(Options{
+		Servers:       []string{"127.0.0.1:1"},
+		DetectSuspend: true,
+		AutoSync:      true,
+		Scheduler:     scheduler,
+		Clock:         clock,
+	}); err != ErrSchedulerClosed {
+		t.Fatalf("预期返回ErrSchedulerClosed，实际得到%v", err)
+	}
+	if got := runtime.NumGoroutine(); got > before {
+		t.Errorf("预期没有遗留的goroutine，实际从%d个增加到%d个", before, got)
+	}
+}
+
+// BenchmarkPeriodicSync 比较每个实例单独的同步goroutine和共享调度器占用的goroutine和定时器
+func BenchmarkPeriodicSync(b *testing.B) {
+	const instances = 200
+
+	for _, shared := range []bool{false, true} {
+		name := "PerInstance"
+		if shared {
+			name = "Scheduler"
+		}
+		b.Run(fmt.Sprintf("%s/%d", name, instances), func(b *testing.B) {
+			var goroutines, timers int
+			for i := 0; i < b.N; i++ {
+				before := runtime.NumGoroutine()
+				clock := newFakeClock()
+				var scheduler *Scheduler
+				if shared {
+					scheduler = NewScheduler(SchedulerOptions{Clock: clock})
+				}
+
+				all := make([]*NTPSync, instances)
+				for j := range all {
+					all[j] = newScheduledInstance(b, clock, scheduler, time.Hour)
+					if err := all[j].StartPeriodicSync(); err != nil {
+						b.Fatalf("启动定时同步失败: %v", err)
+					}
+				}
+				for _, ntp := range all {
+					waitForSyncs(b, ntp, 1)
+				}
+				expected := instances
+				if shared {
+					expected = 1
+				}
+				clock.waitForTimers(b, expected)
+				goroutines = runtime.NumGoroutine() - before
+				timers = clock.activeTimers()
+
+				for _, ntp := range all {
+					ntp.Close()
+				}
+				if scheduler != nil {
+					scheduler.Close()
+				}
+			}
+			b.ReportMetric(float64(goroutines), "goroutines")
+			b.ReportMetric(float64(timers), "timers")
+		})
+	}
+}
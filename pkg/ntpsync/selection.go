@@ -0,0 +1,176 @@
+package ntpsync
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SelectionOutcome 是一次选择中候选服务器的结果
+type SelectionOutcome string
+
+// 候选服务器的结果
+const (
+	SelectionSelected SelectionOutcome = "selected"  // 被选中，测量结果已应用
+	SelectionRejected SelectionOutcome = "rejected"  // 被选中，但测量结果被判定为异常值或超过MaxOffset
+	SelectionFailed   SelectionOutcome = "failed"    // 测量失败
+	SelectionHeldDown SelectionOutcome = "held_down" // 因连续失败被暂时排除，没有尝试
+	SelectionDenied   SelectionOutcome = "denied"    // 以DENY或RSTR拒绝访问，没有尝试
+	SelectionNotTried SelectionOutcome = "not_tried" // 排在前面的服务器已经成功，没有尝试
+
+	// 以下结果只出现在SyncWithMultiServerCombined的选择中
+	SelectionCombined    SelectionOutcome = "combined"    // 偏移量参与了合并，但不是系统对等体
+	SelectionFalseticker SelectionOutcome = "falseticker" // 被交集算法判定为伪值服务器
+	SelectionClustered   SelectionOutcome = "clustered"   // 被聚类算法作为离群的幸存者去掉
+)
+
+// SelectionCandidate 是一次选择中的一个候选服务器
+type SelectionCandidate struct {
+	// Server 是服务器地址
+	Server string `json:"server"`
+
+	// Rank 是服务器按排名和故障切换策略排列后尝试的顺序，从1开始
+	Rank int `json:"rank"`
+
+	// Score 是服务器在选择时的健康评分，只在启用多服务器支持时计算
+	Score float64 `json:"score"`
+
+	// Outcome 是服务器在这次选择中的结果
+	Outcome SelectionOutcome `json:"outcome"`
+
+	// Reason 说明服务器没有被采用的原因，被选中时为空
+	Reason string `json:"reason,omitempty"`
+}
+
+// Selection 记录一次同步中选择服务器的过程，用于解释为什么跟随了某个服务器
+type Selection struct {
+	// Time 是选择完成的时间
+	Time time.Time `json:"time"`
+
+	// Server 是测量结果被应用的服务器，没有服务器被采用时为空
+	Server string `json:"server,omitempty"`
+
+	// Reason 说明选择这个服务器的原因，或没有服务器被采用的原因
+	Reason string `json:"reason"`
+
+	// Candidates 是按排名排列的全部候选服务器
+	Candidates []SelectionCandidate `json:"candidates"`
+}
+
+// selectionRecord 是选择历史中的一条记录，result是被选中服务器的测量结果，
+// 用于在结果被拒绝时找到对应的记录
+type selectionRecord struct {
+	selection Selection
+	result    *SyncResult
+}
+
+// newSelection 按servers的顺序创建候选服务器，并标记拒绝访问和被暂时排除、不会尝试的服务器
+func (n *NTPSync) newSelection(servers []string, now time.Time) []SelectionCandidate {
+	candidates := make([]SelectionCandidate, len(servers))
+	for i, server := range servers {
+		c := SelectionCandidate{Server: server, Rank: i + 1, Outcome: SelectionNotTried, Reason: "排在前面的服务器已经成功"}
+		if n.serverManager != nil {
+			if status, err := n.serverManager.GetServerStatus(server); err == nil {
+				c.Score = status.Score
+			}
+		}
+		switch {
+		case n.isDenied(server, now):
+			c.Outcome, c.Reason = SelectionDenied, "服务器以DENY或RSTR拒绝访问"
+		case n.serverManager != nil && n.serverManager.IsHeldDown(server, now):
+			c.Outcome, c.Reason = SelectionHeldDown, "连续失败后被暂时排除"
+		}
+		candidates[i] = c
+	}
+	return candidates
+}
+
+// recordSelection 把一次选择加入选择历史，result为nil表示没有服务器测量成功
+func (n *NTPSync) recordSelection(candidates []SelectionCandidate, result *SyncResult) {
+	s := Selection{Time: n.clock.Now(), Candidates: candidates}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if result != nil {
+		s.Server = result.Server
+		switch {
+		case n.failoverPolicy == FailoverSticky && result.Server == n.currentServer:
+			s.Reason = "继续使用当前的服务器"
+		case n.failoverPolicy == FailoverRoundRobin:
+			s.Reason = "轮换到的服务器"
+		default:
+			s.Reason = "排名最高的可用服务器"
+		}
+		for _, c := range candidates {
+			if c.Server == result.Server && c.Rank > 1 {
+				s.Reason = fmt.Sprintf("排在前面的%d个服务器被排除或测量失败", c.Rank-1)
+			}
+		}
+	} else {
+		outcome := func(o SelectionOutcome) func(SelectionCandidate) bool {
+			return func(c SelectionCandidate) bool { return c.Outcome == o }
+		}
+		switch {
+		case slices.ContainsFunc(candidates, outcome(SelectionFalseticker)):
+			s.Reason = ErrNoMajority.Error()
+		case slices.ContainsFunc(candidates, outcome(SelectionFailed)):
+			s.Reason = "所有可用的服务器都测量失败"
+		default:
+			s.Reason = "没有可用的服务器"
+		}
+	}
+	n.storeSelectionLocked(s, result)
+}
+
+// storeSelection 把已经说明了原因的选择加入选择历史
+func (n *NTPSync) storeSelection(s Selection, result *SyncResult) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.storeSelectionLocked(s, result)
+}
+
+// storeSelectionLocked 把选择加入选择历史，超过容量时丢弃最早的选择，调用者必须持有n.mutex
+func (n *NTPSync) storeSelectionLocked(s Selection, result *SyncResult) {
+	n.selections = append(n.selections, selectionRecord{selection: s, result: result})
+	if len(n.selections) > n.history.capacity() {
+		n.selections = n.selections[len(n.selections)-n.history.capacity():]
+	}
+}
+
+// rejectSelectionLocked 把测量结果为result的选择标记为被拒绝，调用者必须持有n.mutex
+func (n *NTPSync) rejectSelectionLocked(result *SyncResult, err error) {
+	for i := len(n.selections) - 1; i >= 0; i-- {
+		r := &n.selections[i]
+		if r.result != result {
+			continue
+		}
+		r.selection.Server = ""
+		r.selection.Reason = err.Error()
+		for j := range r.selection.Candidates {
+			if c := &r.selection.Candidates[j]; c.Server == result.Server && c.Outcome == SelectionSelected {
+				c.Outcome, c.Reason = SelectionRejected, err.Error()
+			}
+		}
+		return
+	}
+}
+
+// GetSelectionHistory 按时间顺序返回最近的count次服务器选择，count不大于0时返回全部，
+// 保存的数量与同步历史相同，参见Options.HistorySize
+func (n *NTPSync) GetSelectionHistory(count int) []Selection {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	records := n.selections
+	if count > 0 && count < len(records) {
+		records = records[len(records)-count:]
+	}
+	selections := make([]Selection, len(records))
+	for i, r := range records {
+		selections[i] = r.selection
+		selections[i].Candidates = append([]SelectionCandidate(nil), r.selection.Candidates...)
+	}
+	return selections
+}
@@ -0,0 +1,91 @@
+package ntpsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestSelectionHistory 测试选择历史记录被选中的服务器和其它服务器没有被采用的原因
+func TestSelectionHistory(t *testing.T) {
+	clock := newFakeClock()
+
+	down := ntptest.NewServer()
+	defer down.Close()
+	down.SetDrop(true)
+	down.SetNow(clock.Now)
+
+	up := ntptest.NewServer()
+	defer up.Close()
+	up.SetNow(clock.Now)
+
+	spare := ntptest.NewServer()
+	defer spare.Close()
+	spare.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:           []string{down.Addr(), up.Addr(), spare.Addr()},
+		Timeout:           100 * time.Millisecond,
+		EnableMultiServer: true,
+		HolddownThreshold: 1,
+		HolddownInterval:  time.Hour,
+		MaxOffset:         DefaultMaxOffset,
+		MinPollInterval:   -1,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	selections := ntp.GetSelectionHistory(0)
+	if len(selections) != 1 {
+		t.Fatalf("预期1次选择，实际得到%d次", len(selections))
+	}
+	s := selections[0]
+	if s.Server != up.Addr() || len(s.Candidates) != 3 {
+		t.Fatalf("预期选择%s，实际得到%+v", up.Addr(), s)
+	}
+	if c := s.Candidates[0]; c.Server != down.Addr() || c.Outcome != SelectionFailed || c.Reason == "" {
+		t.Errorf("预期不可达的服务器测量失败，实际得到%+v", c)
+	}
+	if c := s.Candidates[1]; c.Outcome != SelectionSelected || c.Rank != 2 {
+		t.Errorf("预期排名第2的服务器被选中，实际得到%+v", c)
+	}
+	if c := s.Candidates[2]; c.Outcome != SelectionNotTried {
+		t.Errorf("预期排名更低的服务器没有尝试，实际得到%+v", c)
+	}
+
+	// 不可达的服务器被排除，偏移量过大的结果被拒绝
+	up.SetOffset(2 * time.Hour)
+	err = ntp.Sync()
+	if !errors.Is(err, ErrOffsetTooLarge) {
+		t.Fatalf("预期返回ErrOffsetTooLarge，实际得到%v", err)
+	}
+	selections = ntp.GetSelectionHistory(1)
+	if len(selections) != 1 {
+		t.Fatalf("预期返回最近1次选择，实际得到%d次", len(selections))
+	}
+	s = selections[0]
+	if s.Server != "" || s.Reason != err.Error() {
+		t.Errorf("预期没有服务器被采用且原因为拒绝结果的错误，实际得到%+v", s)
+	}
+	outcomes := make(map[string]SelectionOutcome)
+	for _, c := range s.Candidates {
+		outcomes[c.Server] = c.Outcome
+	}
+	if outcomes[down.Addr()] != SelectionHeldDown || outcomes[up.Addr()] != SelectionRejected {
+		t.Errorf("预期不可达的服务器被排除、被选中的结果被拒绝，实际得到%+v", s.Candidates)
+	}
+
+	// 返回的是副本
+	selections[0].Candidates[0].Server = "changed"
+	if got := ntp.GetSelectionHistory(1)[0].Candidates[0].Server; got == "changed" {
+		t.Error("预期修改返回的选择历史不影响实例")
+	}
+}
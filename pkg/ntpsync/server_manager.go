@@ -21,6 +21,22 @@ type ServerManager struct {
 	
 	// timeout 用于服务器请求的超时时间
 	timeout time.Duration
+	
+	// holddownThreshold 是暂时排除服务器前允许的连续失败次数
+	holddownThreshold int
+	
+	// holddownInterval 是服务器第一次被排除的时长
+	holddownInterval time.Duration
+	
+	// health 是每个服务器用于计算健康评分的滚动状态
+	health map[string]*serverHealth
+	
+	// priority 是通过SetPriority设置的服务器优先级，数值小的优先
+	priority map[string]int
+	
+	// retired 是已移除服务器的状态，retiredOrder按移除的先后排列
+	retired      map[string]retiredServer
+	retiredOrder []string
 }
 
 // NewServerManager 创建一个新的服务器管理器，使用给定的服务器
@@ -37,6 +53,9 @@ func NewServerManager(servers []string, timeout time.Duration) (*ServerManager,
 		servers:     make(map[string]*ServerStatus),
 		serverOrder: make([]string, 0, len(servers)),
 		timeout:     timeout,
+		
+		holddownThreshold: DefaultHolddownThreshold,
+		holddownInterval:  DefaultHolddownInterval,
 	}
 	
 	// 初始化服务器状态
@@ -51,6 +70,7 @@ func NewServerManager(servers []string, timeout time.Duration) (*ServerManager,
 }
 
 // AddServer 向管理器添加新服务器
+// 之前移除过的服务器会恢复原来的状态和健康记录，不能通过移除再添加绕过暂时排除
 func (sm *ServerManager) AddServer(server string) error {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
@@ -61,9 +81,7 @@ func (sm *ServerManager) AddServer(server string) error {
 	}
 	
 	// 添加服务器
-	sm.servers[server] = &ServerStatus{
-		Address: server,
-	}
+	sm.servers[server] = sm.restoreLocked(server)
 	sm.serverOrder = append(sm.serverOrder, server)
 	
 	return nil
@@ -79,8 +97,11 @@ func (sm *ServerManager) RemoveServer(server string) error {
 		return fmt.Errorf("服务器 %s 不存在", server)
 	}
 	
-	// 从映射中移除
+	// 从映射中移除，保留状态供重新加入时恢复
+	sm.retireLocked(server)
 	delete(sm.servers, server)
+	delete(sm.health, server)
+	delete(sm.priority, server)
 	
 	// 从顺序列表中移除
 	for i, s := range sm.serverOrder {
@@ -155,14 +176,16 @@ func (sm *ServerManager) UpdateServerStatus(server string, status ServerStatus)
 // reorderServers 根据服务器状态重新排序服务器
 // 服务器按以下顺序排序：
 // 1. 可达性（可达服务器优先）
-// 2. 层级（较低层级优先）
-// 3. RTT（较低RTT优先）
+// 2. 优先级（数值较小优先，设置了优先级的服务器排在没有设置的之前）
+// 3. 健康评分（较高评分优先）
+// 4. 层级（较低层级优先）
+// 5. RTT（较低RTT优先）
 func (sm *ServerManager) reorderServers() {
-	// 创建服务器地址的切片
-	servers := make([]string, 0, len(sm.servers))
-	for server := range sm.servers {
-		servers = append(servers, server)
-	}
+	sm.updateScores()
+	
+	// 从当前顺序开始稳定排序，条件相同的服务器保持原来的相对顺序
+	servers := make([]string, len(sm.serverOrder))
+	copy(servers, sm.serverOrder)
 	
 	// 排序服务器
 	sort.SliceStable(servers, func(i, j int) bool {
@@ -174,6 +197,21 @@ func (sm *ServerManager) reorderServers() {
 			return si.Reachable
 		}
 		
+		// 设置了优先级的服务器优先，数值较小优先
+		pi, iok := sm.priority[servers[i]]
+		pj, jok := sm.priority[servers[j]]
+		if iok != jok {
+			return iok
+		}
+		if pi != pj {
+			return pi < pj
+		}
+		
+		// 较高健康评分优先
+		if si.Score != sj.Score {
+			return si.Score > sj.Score
+		}
+		
 		// 较低层级优先
 		if si.Stratum != sj.Stratum {
 			return si.Stratum < sj.Stratum
@@ -209,7 +247,12 @@ func (sm *ServerManager) GetBestServer() (string, error) {
 }
 
 // ProbeAllServers 探测所有服务器并更新它们的状态
+// 同时进行的请求不超过ntpClient的Options.MaxConcurrentProbes个
 func (sm *ServerManager) ProbeAllServers(ntpClient *NTPSync) error {
+	if ntpClient.isClosed() {
+		return ErrClosed
+	}
+	
 	sm.mutex.RLock()
 	servers := make([]string, len(sm.serverOrder))
 	copy(servers, sm.serverOrder)
@@ -228,27 +271,14 @@ func (sm *ServerManager) ProbeAllServers(ntpClient *NTPSync) error {
 		go func(server string) {
 			defer wg.Done()
 			
-			result, err := ntpClient.syncWithServerBinary(server, sm.timeout)
-			
-			status := ServerStatus{
-				Address: server,
-			}
+			result, err := ntpClient.probeServer(server, sm.timeout)
+			ntpClient.recordServerResult(sm, server, result, err)
 			
 			if err != nil {
-				status.Reachable = false
-				
 				mu.Lock()
 				lastErr = err
 				mu.Unlock()
-			} else {
-				status.Reachable = true
-				status.LastResponse = time.Now()
-				status.RTT = result.RTT
-				status.Stratum = result.Stratum
-				status.Offset = result.Offset
 			}
-			
-			_ = sm.UpdateServerStatus(server, status)
 		}(server)
 	}
 	
@@ -0,0 +1,135 @@
+package ntpsync
+
+import "slices"
+
+// maxRetiredServers 是服务器管理器为已移除的服务器保留状态的数量上限
+const maxRetiredServers = 32
+
+// retiredServer 是已移除服务器的状态和健康记录，重新加入时恢复
+type retiredServer struct {
+	status   ServerStatus
+	health   *serverHealth
+	priority *int
+}
+
+// retireLocked 保留已移除服务器的状态，超过上限时丢弃最早移除的，调用者必须持有sm.mutex
+func (sm *ServerManager) retireLocked(server string) {
+	r := retiredServer{status: *sm.servers[server], health: sm.health[server]}
+	if p, ok := sm.priority[server]; ok {
+		r.priority = &p
+	}
+
+	if sm.retired == nil {
+		sm.retired = make(map[string]retiredServer)
+	}
+	sm.retiredOrder = slices.DeleteFunc(sm.retiredOrder, func(s string) bool { return s == server })
+	sm.retired[server] = r
+	sm.retiredOrder = append(sm.retiredOrder, server)
+	if len(sm.retiredOrder) > maxRetiredServers {
+		delete(sm.retired, sm.retiredOrder[0])
+		sm.retiredOrder = sm.retiredOrder[1:]
+	}
+}
+
+// restoreLocked 恢复重新加入的服务器之前的状态，没有保留时返回新的状态，调用者必须持有sm.mutex
+func (sm *ServerManager) restoreLocked(server string) *ServerStatus {
+	r, ok := sm.retired[server]
+	if !ok {
+		return &ServerStatus{Address: server}
+	}
+	delete(sm.retired, server)
+	sm.retiredOrder = slices.DeleteFunc(sm.retiredOrder, func(s string) bool { return s == server })
+
+	if r.health != nil {
+		if sm.health == nil {
+			sm.health = make(map[string]*serverHealth)
+		}
+		sm.health[server] = r.health
+	}
+	if r.priority != nil {
+		if sm.priority == nil {
+			sm.priority = make(map[string]int)
+		}
+		sm.priority[server] = *r.priority
+	}
+	return &r.status
+}
+
+// addServerLocked 把服务器加入列表和服务器管理器，已存在时返回false，调用者必须持有n.mutex
+func (n *NTPSync) addServerLocked(server string) bool {
+	if slices.Contains(n.servers, server) {
+		return false
+	}
+	n.servers = append(n.servers, server)
+	if n.serverManager != nil {
+		_ = n.serverManager.AddServer(server)
+	}
+	n.emit(Event{Type: EventServerAdded, Server: server})
+	return true
+}
+
+// removeServerLocked 从列表和服务器管理器中移除服务器，不存在时返回false，调用者必须持有n.mutex
+func (n *NTPSync) removeServerLocked(server string) bool {
+	i := slices.Index(n.servers, server)
+	if i < 0 {
+		return false
+	}
+	n.servers = slices.Delete(slices.Clone(n.servers), i, i+1)
+	delete(n.discovered, server)
+	address := serverAddress(server)
+	delete(n.huffPuffFilters, address)
+	delete(n.serverOffsets, address)
+	delete(n.sourceSamples, address)
+	delete(n.serverPolls, address)
+	delete(n.reach, address)
+	if n.serverManager != nil {
+		_ = n.serverManager.RemoveServer(server)
+	}
+	n.emit(Event{Type: EventServerRemoved, Server: server})
+	return true
+}
+
+// setServersLocked 以servers替换服务器列表，只增删有变化的服务器，
+// 保留的服务器在服务器管理器中的状态不受影响，调用者必须持有n.mutex
+func (n *NTPSync) setServersLocked(servers []string) {
+	for _, server := range slices.Clone(n.servers) {
+		if !slices.Contains(servers, server) {
+			n.removeServerLocked(server)
+		}
+	}
+	for _, server := range servers {
+		n.addServerLocked(server)
+	}
+	n.servers = slices.Clone(servers)
+
+	// 加入pool.ntp.org服务器时，同步间隔不能低于其使用规范
+	if n.clampSyncIntervalLocked() {
+		n.publishLocked()
+		n.emit(Event{Type: EventIntervalChanged, Interval: n.syncInterval})
+	}
+}
+
+// sortServers 将servers按服务器管理器的当前排序原地排列，第一个即为GetBestServer的选择，
+// 不在管理器中的服务器保持原来的相对顺序排在最后
+func (sm *ServerManager) sortServers(servers []string) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	rank := make(map[string]int, len(sm.serverOrder))
+	for i, server := range sm.serverOrder {
+		rank[server] = i
+	}
+	slices.SortStableFunc(servers, func(a, b string) int {
+		ra, aok := rank[a]
+		rb, bok := rank[b]
+		switch {
+		case aok && bok:
+			return ra - rb
+		case aok:
+			return -1
+		case bok:
+			return 1
+		}
+		return 0
+	})
+}
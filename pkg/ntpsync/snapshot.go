@@ -0,0 +1,62 @@
+package ntpsync
+
+import "time"
+
+// nowSnapshot 是Now需要的同步状态：偏移量的锚定和保持模式的参数
+// 修改偏移量、同步时间、频率偏差或同步间隔后，持有n.mutex的写锁发布新的快照；
+// Now只读取原子指针，不会与持有写锁的同步goroutine竞争。
+// 锚定和其它参数在同一个快照中发布，Now不会看到新的偏移量和旧的同步时间的组合
+type nowSnapshot struct {
+	// anchor 是发布时偏移量的锚定
+	anchor *monotonicAnchor
+
+	// lastSync 和 suspended 是最后一次成功同步的时间和之后检测到的休眠时长
+	lastSync  time.Time
+	suspended time.Duration
+
+	// holdoverAfter 是进入保持模式前允许的最长同步间隔
+	holdoverAfter time.Duration
+
+	// frequency 是估计的频率偏差，尚未估计出时为0
+	frequency float64
+}
+
+// publishLocked 发布Now使用的同步状态，调用者必须持有n.mutex的写锁
+// 从未同步时不发布，Now加锁读取timeOffset。timeOffset与锚定的偏移量不同时以timeOffset重新锚定
+func (n *NTPSync) publishLocked() {
+	anchor := n.monotonic.anchored.Load()
+	if n.lastSync.IsZero() || anchor == nil {
+		n.snapshot.Store(nil)
+		return
+	}
+	if anchor.target != n.timeOffset {
+		n.monotonic.anchor(n.clock.Now(), n.timeOffset)
+		anchor = n.monotonic.anchored.Load()
+	}
+	freq, _ := n.drift.frequency()
+	n.snapshot.Store(&nowSnapshot{
+		anchor:        anchor,
+		lastSync:      n.lastSync,
+		suspended:     n.suspendedSinceSync,
+		holdoverAfter: n.holdoverAfterLocked(),
+		frequency:     freq,
+	})
+}
+
+// now 返回本地时间为local时的NTP时间
+func (s *nowSnapshot) now(local time.Time) time.Time {
+	return s.anchor.now(local).Add(s.correction(local))
+}
+
+// correction 返回本地时间为local时保持模式需要额外调整的偏移量
+func (s *nowSnapshot) correction(local time.Time) time.Duration {
+	return holdoverCorrection(local.Sub(s.lastSync)+s.suspended, s.holdoverAfter, s.frequency)
+}
+
+// holdoverCorrection 返回距离同步age、超过after之后按频率偏差freq推算的偏移量
+func holdoverCorrection(age, after time.Duration, freq float64) time.Duration {
+	if age <= after {
+		return 0
+	}
+	return time.Duration(float64(age-after) * freq)
+}
@@ -0,0 +1,339 @@
+package ntpsync
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// udpSocket 是实例共用的UDP套接字
+// 所有服务器的请求都从同一个套接字发出，避免每次请求创建套接字和占用临时端口。
+// 读取goroutine按服务器地址和应答的起始时间戳把应答交给等待中的请求，
+// 不匹配任何请求的数据包（迟到或伪造的应答）被丢弃
+type udpSocket struct {
+	conn     *net.UDPConn
+	now      func() time.Time
+	resolver Resolver
+
+	// kernelTimestamps 表示套接字启用了内核接收时间戳
+	kernelTimestamps bool
+
+	// hardwareTimestamps 表示套接字启用了SO_TIMESTAMPING，记录软件和网卡硬件的收发时间戳。
+	// txMutex 保证请求的编号txNext与内核为发送时间戳分配的编号一致
+	hardwareTimestamps bool
+	txMutex            sync.Mutex
+	txNext             uint32
+
+	mutex    sync.Mutex
+	pending  map[pendingKey]*socketExchange
+	txStamps map[uint32]txTimestamps
+	err      error
+
+	done chan struct{}
+}
+
+// pendingKey 标识一个等待中的请求：服务器地址和应答中应有的起始时间戳
+type pendingKey struct {
+	addr   netip.AddrPort
+	origin uint64
+}
+
+// socketResponse 是读取goroutine交给请求的应答，hardware是网卡的硬件接收时间戳
+type socketResponse struct {
+	data     []byte
+	received time.Time
+	hardware time.Time
+}
+
+// sharedSocket 返回实例共用的套接字，套接字不存在或已失效时重新创建
+func (n *NTPSync) sharedSocket() (*udpSocket, error) {
+	n.socketMutex.Lock()
+	defer n.socketMutex.Unlock()
+
+	if n.isClosed() {
+		return nil, ErrClosed
+	}
+	if n.socket != nil && n.socket.usable() {
+		return n.socket, nil
+	}
+
+	address := ":0"
+	if n.socketConfig.localAddr != nil {
+		address = net.JoinHostPort(n.socketConfig.localAddr.String(), "0")
+	}
+	lc := net.ListenConfig{Control: n.socketConfig.control}
+	conn, err := lc.ListenPacket(context.Background(), "udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("创建UDP套接字失败: %v", err)
+	}
+
+	if n.socket != nil {
+		n.socket.close()
+	}
+	n.socket = &udpSocket{
+		conn:     conn.(*net.UDPConn),
+		now:      n.clock.Now,
+		resolver: n.resolver,
+		pending:  make(map[pendingKey]*socketExchange),
+		done:     make(chan struct{}),
+	}
+	if n.socketConfig.hardwareTimestamps {
+		n.socket.hardwareTimestamps = setSocketOption(n.socket.conn, setTimestamping)
+	}
+	if n.kernelTimestamps() && !n.socket.hardwareTimestamps {
+		n.socket.kernelTimestamps = setSocketOption(n.socket.conn, setKernelTimestamps)
+	}
+	if n.socket.resolver == nil {
+		n.socket.resolver = net.DefaultResolver
+	}
+	go n.socket.read()
+	return n.socket, nil
+}
+
+// closeSocket 关闭共用的套接字
+func (n *NTPSync) closeSocket() {
+	n.socketMutex.Lock()
+	defer n.socketMutex.Unlock()
+
+	if n.socket != nil {
+		n.socket.close()
+		n.socket = nil
+	}
+}
+
+// usable 返回套接字是否仍然可用
+func (s *udpSocket) usable() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.err == nil
+}
+
+// close 关闭套接字并等待读取goroutine退出
+func (s *udpSocket) close() {
+	s.conn.Close()
+	<-s.done
+}
+
+// read 接收应答并交给匹配的请求，直到套接字关闭或出错
+func (s *udpSocket) read() {
+	defer close(s.done)
+
+	buf := make([]byte, maxPacketSize)
+	var oob []byte
+	switch {
+	case s.hardwareTimestamps:
+		oob = make([]byte, hardwareTimestampSpace)
+	case s.kernelTimestamps:
+		oob = make([]byte, kernelTimestampSpace)
+	}
+	for {
+		bytesRead, oobRead, _, addr, err := s.conn.ReadMsgUDPAddrPort(buf, oob)
+		if err != nil {
+			// 套接字失效，等待中的请求各自超时，之后的请求会重新创建套接字
+			s.mutex.Lock()
+			s.err = err
+			s.mutex.Unlock()
+			return
+		}
+		received := receiveTime(s.now(), oob[:oobRead])
+		if bytesRead < packetSize {
+			continue
+		}
+		var hardware time.Time
+		if s.hardwareTimestamps {
+			hardware = parseHardwareTimestamp(oob[:oobRead])
+		}
+
+		key := pendingKey{
+			addr:   netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port()),
+			origin: binary.BigEndian.Uint64(buf[24:32]),
+		}
+		// 持有锁交付应答，请求重新发送后不会再收到之前请求的应答
+		s.mutex.Lock()
+		if e := s.pending[key]; e != nil {
+			data := getPacket(bytesRead)
+			copy(data, buf)
+			select {
+			case e.responses <- socketResponse{data: data, received: received, hardware: hardware}:
+			default:
+				// 请求已经收到应答，丢弃重复的应答
+				putPacket(data)
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// open 解析服务器地址并准备一次交换
+// 解析地址不超过dialTimeout，之后等待应答不超过readTimeout
+func (s *udpSocket) open(ctx context.Context, server string, dialTimeout, readTimeout time.Duration) (*socketExchange, error) {
+	addr, err := s.resolve(ctx, server, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &socketExchange{
+		socket:      s,
+		addr:        addr,
+		parent:      ctx,
+		readTimeout: readTimeout,
+		responses:   make(chan socketResponse, 1),
+	}, nil
+}
+
+// resolve 将服务器地址解析为与套接字协议族一致的IP地址和端口，查询不超过timeout
+func (s *udpSocket) resolve(ctx context.Context, server string, timeout time.Duration) (netip.AddrPort, error) {
+	host, portName, err := net.SplitHostPort(server)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+
+	var addrs []netip.Addr
+	var port uint16
+	if literal, err := netip.ParseAddrPort(server); err == nil {
+		// IP地址和数字端口不需要查询
+		addrs, port = []netip.Addr{literal.Addr()}, literal.Port()
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		number, err := net.DefaultResolver.LookupPort(ctx, "udp", portName)
+		if err != nil {
+			return netip.AddrPort{}, err
+		}
+		if addrs, err = s.resolver.LookupNetIP(ctx, "ip", host); err != nil {
+			return netip.AddrPort{}, err
+		}
+		port = uint16(number)
+	}
+
+	// 绑定了IPv4源地址的套接字只能发往IPv4地址
+	local := s.conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr()
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if local.Is4() && !addr.Is4() {
+			continue
+		}
+		if local.Is6() && !local.IsUnspecified() && addr.Is4() {
+			continue
+		}
+		return netip.AddrPortFrom(addr, port), nil
+	}
+	return netip.AddrPort{}, fmt.Errorf("%s 没有与源地址 %v 协议族一致的地址", host, local)
+}
+
+// socketExchange 是使用共用套接字的交换
+type socketExchange struct {
+	socket      *udpSocket
+	addr        netip.AddrPort
+	parent      context.Context
+	readTimeout time.Duration
+	responses   chan socketResponse
+
+	// ctx 在等待当前请求的应答超时后结束
+	ctx    context.Context
+	cancel context.CancelFunc
+	keys   []pendingKey
+
+	// txID 是当前请求发送时间戳的编号，txSent 表示请求已经发出并分配了编号；
+	// sent 和 hardware 是上一次应答的timestamps
+	txID     uint32
+	txSent   bool
+	sent     time.Time
+	hardware bool
+}
+
+// send 登记应答的匹配条件后发送请求，之前请求的匹配条件被移除
+func (e *socketExchange) send(req []byte) error {
+	e.close()
+	select {
+	case resp := <-e.responses:
+		putPacket(resp.data)
+	default:
+	}
+	e.ctx, e.cancel = context.WithTimeout(e.parent, e.readTimeout)
+
+	s := e.socket
+	s.mutex.Lock()
+	var origins [3]uint64
+	for _, origin := range appendOrigins(origins[:0], req) {
+		key := pendingKey{addr: e.addr, origin: origin}
+		if _, ok := s.pending[key]; ok {
+			s.mutex.Unlock()
+			return errors.New("存在起始时间戳相同的请求")
+		}
+		s.pending[key] = e
+		e.keys = append(e.keys, key)
+	}
+	s.mutex.Unlock()
+
+	e.txSent = false
+	if !s.hardwareTimestamps {
+		_, err := s.conn.WriteToUDPAddrPort(req, e.addr)
+		return err
+	}
+
+	// 按发送顺序为请求编号，与内核为发送时间戳分配的编号一致
+	s.txMutex.Lock()
+	defer s.txMutex.Unlock()
+	_, err := s.conn.WriteToUDPAddrPort(req, e.addr)
+	if err == nil {
+		e.txID, e.txSent = s.txNext, true
+		s.txNext++
+	}
+	return err
+}
+
+// receive 等待读取goroutine转交的应答，请求有发送时间戳时按网卡硬件时间戳修正接收时间
+func (e *socketExchange) receive() ([]byte, time.Time, error) {
+	select {
+	case resp := <-e.responses:
+		e.sent, e.hardware = time.Time{}, false
+		if !e.txSent {
+			return resp.data, resp.received, nil
+		}
+		tx, ok := e.socket.txTimestamp(e.txID)
+		if !ok {
+			return resp.data, resp.received, nil
+		}
+		e.sent = tx.software
+		if received, ok := hardwareReceiveTime(resp.received, tx, resp.hardware); ok {
+			e.hardware = true
+			return resp.data, received, nil
+		}
+		return resp.data, resp.received, nil
+	case <-e.ctx.Done():
+		if errors.Is(e.ctx.Err(), context.DeadlineExceeded) {
+			// 与连接读取超时的错误一致
+			return nil, time.Time{}, os.ErrDeadlineExceeded
+		}
+		return nil, time.Time{}, e.ctx.Err()
+	}
+}
+
+// timestamps 返回receive时取得的内核发送时间和接收时间是否由硬件时间戳得出
+func (e *socketExchange) timestamps() (time.Time, bool) {
+	return e.sent, e.hardware
+}
+
+// close 取消等待并移除应答的匹配条件，共用的套接字保持打开
+func (e *socketExchange) close() {
+	if e.cancel != nil {
+		e.cancel()
+	}
+
+	s := e.socket
+	s.mutex.Lock()
+	for _, key := range e.keys {
+		delete(s.pending, key)
+	}
+	s.mutex.Unlock()
+	e.keys = e.keys[:0]
+}
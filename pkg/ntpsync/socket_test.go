@@ -0,0 +1,94 @@
+package ntpsync
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestSharedSocket 测试所有服务器的请求从同一个套接字发出
+func TestSharedSocket(t *testing.T) {
+	srv1 := ntptest.NewServer()
+	defer srv1.Close()
+	srv2 := ntptest.NewServer()
+	defer srv2.Close()
+
+	ntp, err := New(Options{
+		Servers:         []string{srv1.Addr(), srv2.Addr()},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	for _, server := range []string{srv1.Addr(), srv2.Addr(), srv1.Addr()} {
+		if _, err := ntp.syncWithServerBinary(server, time.Second); err != nil {
+			t.Fatalf("与%s同步失败: %v", server, err)
+		}
+	}
+
+	var from []string
+	for _, r := range append(srv1.Requests(), srv2.Requests()...) {
+		from = append(from, r.From.String())
+	}
+	if len(from) != 3 || from[0] != from[1] || from[1] != from[2] {
+		t.Errorf("预期所有请求来自同一个地址，实际得到%v", from)
+	}
+
+	ntp.Close()
+	if ntp.socket != nil {
+		t.Error("预期关闭实例后关闭套接字")
+	}
+}
+
+// TestSharedSocketDemux 测试丢弃起始时间戳不匹配的应答
+func TestSharedSocketDemux(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("监听UDP端口失败: %v", err)
+	}
+	defer conn.Close()
+
+	// 先发送一个起始时间戳错误、偏移量为1小时的应答，再发送正确的应答
+	go func() {
+		buf := make([]byte, maxPacketSize)
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil || n < packetSize {
+			return
+		}
+		reply := func(origin uint64, serverTime time.Time) {
+			seconds, fraction := timeToNTPTime(serverTime)
+			resp := make([]byte, packetSize)
+			resp[0] = 4<<3 | 4
+			resp[1] = 2
+			binary.BigEndian.PutUint64(resp[24:32], origin)
+			binary.BigEndian.PutUint32(resp[32:36], seconds)
+			binary.BigEndian.PutUint32(resp[36:40], fraction)
+			binary.BigEndian.PutUint32(resp[40:44], seconds)
+			binary.BigEndian.PutUint32(resp[44:48], fraction)
+			_, _ = conn.WriteToUDP(resp, addr)
+		}
+		origin := binary.BigEndian.Uint64(buf[40:48])
+		reply(origin+1, time.Now().Add(time.Hour))
+		reply(origin, time.Now())
+	}()
+
+	server := conn.LocalAddr().String()
+	ntp, err := New(Options{Servers: []string{server}, Timeout: time.Second, MinPollInterval: -1})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	result, err := ntp.syncWithServerBinary(server, time.Second)
+	if err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if result.Offset > time.Second || result.Offset < -time.Second {
+		t.Errorf("预期使用起始时间戳匹配的应答，实际偏移量为%v", result.Offset)
+	}
+}
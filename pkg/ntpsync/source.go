@@ -0,0 +1,117 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSourceMismatch 表示其它时间源测得的偏移量与当前偏移量不一致
+var ErrSourceMismatch = errors.New("时间源之间的偏移量不一致")
+
+// Source 是NTP之外的时间源，例如roughtime子包中的Roughtime客户端
+//
+// Measure返回的SyncResult中，Offset是时间源相对本地时钟的偏移量，
+// Uncertainty是时间源保证的误差上限，Server是时间源的名称
+type Source interface {
+	// Name 返回时间源的名称
+	Name() string
+
+	// Measure 测量本地时钟相对时间源的偏移量
+	Measure(ctx context.Context) (*SyncResult, error)
+}
+
+// SyncWithSource 使用其它时间源同步，例如在NTP服务器不可用时用Roughtime引导时间
+// 结果与NTP同步一样经过异常值检测，应用后影响Now、历史记录和同步事件
+func (n *NTPSync) SyncWithSource(ctx context.Context, src Source) error {
+	if n.isClosed() {
+		return ErrClosed
+	}
+
+	result, err := n.measureSource(ctx, src)
+	if err != nil {
+		n.syncFailed(err)
+		return err
+	}
+
+	return n.applyResult(result)
+}
+
+// CrossCheck 使用其它时间源核对当前的偏移量，不修改偏移量
+// 两者之差超过时间源的误差上限时返回ErrSourceMismatch，
+// 可以用Roughtime等带有密码学证明的时间源发现被篡改的NTP应答
+func (n *NTPSync) CrossCheck(ctx context.Context, src Source) (*SyncResult, error) {
+	if n.isClosed() {
+		return nil, ErrClosed
+	}
+
+	result, err := n.measureSource(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	current := n.TimeOffsetDuration()
+	if diff := absDuration(current - result.Offset); diff > result.Uncertainty {
+		return result, fmt.Errorf("%w: %s 的偏移量 %v 与当前偏移量 %v 相差 %v，超过误差上限 %v",
+			ErrSourceMismatch, src.Name(), result.Offset, current, diff, result.Uncertainty)
+	}
+	return result, nil
+}
+
+// measureSource 使用时间源测量偏移量，实例关闭时取消测量
+func (n *NTPSync) measureSource(ctx context.Context, src Source) (*SyncResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(n.context(), cancel)
+	defer stop()
+
+	result, err := src.Measure(ctx)
+	if err != nil {
+		if n.context().Err() != nil {
+			return nil, ErrClosed
+		}
+		return nil, fmt.Errorf("使用时间源 %s 同步失败: %v", src.Name(), err)
+	}
+	if result.Server == "" {
+		result.Server = src.Name()
+	}
+	return result, nil
+}
+
+// preferredSources 返回优先于NTP服务器使用的时间源
+func (n *NTPSync) preferredSources() []Source {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	return n.sources
+}
+
+// syncWithPreferred 依次尝试优先的时间源，应用第一个成功的测量结果
+// 所有时间源都失败时返回错误，由调用者回退到NTP服务器
+func (n *NTPSync) syncWithPreferred(sources []Source) error {
+	n.mutex.RLock()
+	timeout := n.timeout
+	closed := n.closed
+	n.mutex.RUnlock()
+
+	if closed {
+		return ErrClosed
+	}
+
+	var errs []string
+	for _, src := range sources {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		result, err := n.measureSource(ctx, src)
+		cancel()
+		if err != nil {
+			if errors.Is(err, ErrClosed) {
+				return err
+			}
+			errs = append(errs, err.Error())
+			continue
+		}
+		return n.applyResult(result)
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
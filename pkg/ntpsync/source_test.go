@@ -0,0 +1,111 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// fakeSource 是返回固定偏移量的时间源
+type fakeSource struct {
+	offset      time.Duration
+	uncertainty time.Duration
+	err         error
+}
+
+func (s *fakeSource) Name() string { return "fake" }
+
+func (s *fakeSource) Measure(ctx context.Context) (*SyncResult, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &SyncResult{Offset: s.offset, Uncertainty: s.uncertainty}, nil
+}
+
+// TestSyncWithSource 测试使用其它时间源同步和核对偏移量
+func TestSyncWithSource(t *testing.T) {
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: newFakeClock()})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	src := &fakeSource{offset: 3 * time.Second, uncertainty: 100 * time.Millisecond}
+	if err := ntp.SyncWithSource(context.Background(), src); err != nil {
+		t.Fatalf("使用时间源同步失败: %v", err)
+	}
+	if offset := ntp.TimeOffsetDuration(); offset != 3*time.Second {
+		t.Errorf("预期偏移量为3秒，实际得到%v", offset)
+	}
+	if history := ntp.GetHistory(1); len(history) != 1 || history[0].Server != "fake" {
+		t.Errorf("预期历史记录中的服务器为时间源的名称，实际得到%+v", history)
+	}
+
+	// 误差上限以内的差异
+	src.offset = 3*time.Second + 50*time.Millisecond
+	if _, err := ntp.CrossCheck(context.Background(), src); err != nil {
+		t.Errorf("预期核对通过，实际得到%v", err)
+	}
+
+	// 超过误差上限的差异，偏移量保持不变
+	src.offset = 5 * time.Second
+	if _, err := ntp.CrossCheck(context.Background(), src); !errors.Is(err, ErrSourceMismatch) {
+		t.Errorf("预期返回ErrSourceMismatch，实际得到%v", err)
+	}
+	if offset := ntp.TimeOffsetDuration(); offset != 3*time.Second {
+		t.Errorf("预期核对不修改偏移量，实际得到%v", offset)
+	}
+
+	src.err = errors.New("不可达")
+	if err := ntp.SyncWithSource(context.Background(), src); err == nil {
+		t.Error("预期时间源失败时返回错误，实际得到nil")
+	}
+
+	ntp.Close()
+	if err := ntp.SyncWithSource(context.Background(), src); !errors.Is(err, ErrClosed) {
+		t.Errorf("预期关闭后返回ErrClosed，实际得到%v", err)
+	}
+}
+
+// TestPreferredSources 测试优先使用其它时间源，失败时回退到NTP服务器
+func TestPreferredSources(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(time.Second)
+
+	src := &fakeSource{offset: 2 * time.Second}
+	ntp, err := New(Options{
+		Servers:          []string{srv.Addr()},
+		Timeout:          time.Second,
+		Clock:            clock,
+		PreferredSources: []Source{src},
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if offset := ntp.TimeOffsetDuration(); offset != 2*time.Second {
+		t.Errorf("预期使用优先的时间源，偏移量为2秒，实际得到%v", offset)
+	}
+	if got := srv.RequestCount(); got != 0 {
+		t.Errorf("预期没有向NTP服务器发送请求，实际发送了%d个", got)
+	}
+
+	// 优先的时间源不可用时回退到NTP服务器
+	src.err = errors.New("不可用")
+	src.offset = time.Second
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("回退到NTP服务器后同步失败: %v", err)
+	}
+	if got := srv.RequestCount(); got != 1 {
+		t.Errorf("预期回退到NTP服务器，实际发送了%d个请求", got)
+	}
+}
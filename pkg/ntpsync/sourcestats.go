@@ -0,0 +1,140 @@
+package ntpsync
+
+import (
+	"math"
+	"time"
+)
+
+// SourceStatsWindow 是每个服务器保存用于SourceStats的最近样本数量，与chrony相同
+const SourceStatsWindow = 64
+
+// SourceStats 是一个服务器最近测量的统计，类似chronyc sourcestats的一行
+type SourceStats struct {
+	// Address 是配置的服务器地址
+	Address string `json:"address"`
+
+	// Samples 是参与统计的样本数量，偏移量发生跳变后之前的样本被丢弃
+	Samples int `json:"samples"`
+
+	// Span 是第一个和最后一个样本之间的时长
+	Span time.Duration `json:"span"`
+
+	// Frequency 是按该服务器的测量估计的本地时钟频率偏差，单位为ppm，
+	// 样本覆盖的时长不足MinDriftSpan时为0
+	Frequency float64 `json:"frequency_ppm"`
+
+	// Skew 是Frequency的估计误差，单位为ppm
+	Skew float64 `json:"skew_ppm"`
+
+	// StdDev 是偏移量去掉频率偏差造成的线性变化之后的标准差，反映该服务器测量的噪声
+	StdDev time.Duration `json:"stddev"`
+}
+
+// sourceSamples 按时间顺序保存一个服务器最近SourceStatsWindow个样本
+type sourceSamples struct {
+	samples []driftSample
+}
+
+// add 添加一个样本，偏移量的变化不小于jump时认为时间发生了跳变，丢弃之前的样本
+func (s *sourceSamples) add(local time.Time, offset, jump time.Duration) {
+	if n := len(s.samples); n > 0 && absDuration(offset-s.samples[n-1].offset) >= jump {
+		s.samples = s.samples[:0]
+	}
+	if len(s.samples) == SourceStatsWindow {
+		copy(s.samples, s.samples[1:])
+		s.samples = s.samples[:SourceStatsWindow-1]
+	}
+	s.samples = append(s.samples, driftSample{local: local, offset: offset})
+}
+
+// shift 把所有样本的偏移量加上d
+func (s *sourceSamples) shift(d time.Duration) {
+	for i := range s.samples {
+		s.samples[i].offset += d
+	}
+}
+
+// last 返回最近至多count个样本
+func (s *sourceSamples) last(count int) []driftSample {
+	return s.samples[max(len(s.samples)-count, 0):]
+}
+
+// stats 计算样本的统计
+func (s *sourceSamples) stats(address string) SourceStats {
+	stats := SourceStats{Address: address, Samples: len(s.samples)}
+	if len(s.samples) == 0 {
+		return stats
+	}
+	first := s.samples[0].local
+	stats.Span = s.samples[len(s.samples)-1].local.Sub(first)
+
+	freq, skew, ok := fitDrift(s.samples)
+	if ok {
+		stats.Frequency = freq * 1e6
+		stats.Skew = skew * 1e6
+	}
+
+	// 去掉线性变化后的残差，无法估计频率偏差时freq为0，即偏移量本身的标准差
+	var sum float64
+	residuals := make([]float64, len(s.samples))
+	for i, sample := range s.samples {
+		residuals[i] = sample.offset.Seconds() - freq*sample.local.Sub(first).Seconds()
+		sum += residuals[i]
+	}
+	mean := sum / float64(len(residuals))
+	var variance float64
+	for _, r := range residuals {
+		variance += (r - mean) * (r - mean)
+	}
+	stats.StdDev = time.Duration(math.Sqrt(variance/float64(len(residuals))) * float64(time.Second))
+	return stats
+}
+
+// recordServerOffset 记录服务器在本地时间为local时测得的偏移量，用于计算抖动和SourceStats
+func (n *NTPSync) recordServerOffset(server string, local time.Time, offset time.Duration) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.serverOffsets == nil {
+		n.serverOffsets = make(map[string]*offsetWindow)
+	}
+	w, ok := n.serverOffsets[server]
+	if !ok {
+		w = &offsetWindow{}
+		n.serverOffsets[server] = w
+	}
+	w.add(offset)
+
+	jump := n.thresholds.stepThreshold
+	if jump <= 0 {
+		jump = DefaultStepThreshold
+	}
+	if n.sourceSamples == nil {
+		n.sourceSamples = make(map[string]*sourceSamples)
+	}
+	s, ok := n.sourceSamples[server]
+	if !ok {
+		s = &sourceSamples{}
+		n.sourceSamples[server] = s
+	}
+	s.add(local, offset, jump)
+}
+
+// SourceStats 按配置的顺序返回每个服务器最近测量的统计，适合显示类似chronyc sourcestats的表格，
+// 便于找出噪声大或频率与其它服务器不一致、不值得保留的服务器。
+// 同步、探测和多服务器状态查询的每次成功测量都计入统计，从未成功测量的服务器Samples为0
+func (n *NTPSync) SourceStats() []SourceStats {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	stats := make([]SourceStats, 0, len(n.servers))
+	for _, server := range n.servers {
+		s, ok := n.sourceSamples[serverAddress(server)]
+		if !ok {
+			stats = append(stats, SourceStats{Address: server})
+			continue
+		}
+		stats = append(stats, s.stats(server))
+	}
+	return stats
+}
@@ -0,0 +1,72 @@
+package ntpsync
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestSourceStats 测试按服务器统计样本数量、时长、频率偏差和噪声
+func TestSourceStats(t *testing.T) {
+	clock := newFakeClock()
+	stable, noisy := ntptest.NewServer(), ntptest.NewServer()
+	defer stable.Close()
+	defer noisy.Close()
+	stable.SetNow(clock.Now)
+	noisy.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:         []string{stable.Addr(), noisy.Addr(), "192.0.2.1"},
+		MinPollInterval: -1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	// 稳定的服务器偏移量每分钟增大1ms，有噪声的服务器在±5ms之间交替
+	for i := 0; i < 10; i++ {
+		stable.SetOffset(time.Duration(i) * time.Millisecond)
+		noisy.SetOffset(time.Duration(1-2*(i%2)) * 5 * time.Millisecond)
+		for _, addr := range []string{stable.Addr(), noisy.Addr()} {
+			if _, err := ntp.syncWithServerBinary(addr, time.Second); err != nil {
+				t.Fatalf("测量失败: %v", err)
+			}
+		}
+		clock.Advance(time.Minute)
+	}
+
+	stats := ntp.SourceStats()
+	if len(stats) != 3 || stats[0].Address != stable.Addr() || stats[2].Samples != 0 {
+		t.Fatalf("预期按配置的顺序返回3个服务器，未测量的服务器没有样本，实际得到%+v", stats)
+	}
+	s := stats[0]
+	if s.Samples != 10 || s.Span != 9*time.Minute {
+		t.Errorf("预期10个样本覆盖9分钟，实际得到%d个样本覆盖%v", s.Samples, s.Span)
+	}
+	if math.Abs(s.Frequency-1e3/60) > 0.1 || s.StdDev > 10*time.Microsecond {
+		t.Errorf("预期频率偏差约为16.7ppm且噪声很小，实际得到%+v", s)
+	}
+	if n := stats[1]; n.StdDev < 4*time.Millisecond || n.Skew < s.Skew {
+		t.Errorf("预期有噪声的服务器标准差约为5ms，实际得到%+v", n)
+	}
+
+	// 偏移量跳变后丢弃之前的样本
+	stable.SetOffset(time.Second)
+	if _, err := ntp.syncWithServerBinary(stable.Addr(), time.Second); err != nil {
+		t.Fatalf("测量失败: %v", err)
+	}
+	if s := ntp.SourceStats()[0]; s.Samples != 1 || s.Span != 0 || s.Frequency != 0 {
+		t.Errorf("预期跳变后只有1个样本，实际得到%+v", s)
+	}
+
+	// 移除的服务器不再保留样本，重新加入后从头统计
+	ntp.RemoveServer(noisy.Addr())
+	ntp.AddServer(noisy.Addr())
+	if s := ntp.SourceStats()[2]; s.Address != noisy.Addr() || s.Samples != 0 {
+		t.Errorf("预期重新加入的服务器没有样本，实际得到%+v", s)
+	}
+}
@@ -0,0 +1,261 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SRVService 是发现NTP服务器使用的SRV服务名，查询的记录为_ntp._udp.<域名>
+const SRVService = "ntp"
+
+// SRVResolver 查询SRV记录，*net.Resolver和CachingResolver实现了此接口
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DiscoveredServer 是通过SRV记录或DHCP发现的NTP服务器
+type DiscoveredServer struct {
+	// Address 是服务器地址，格式为"主机名:端口"
+	Address string `json:"address"`
+
+	// Priority 是SRV记录的优先级，数值小的优先。DHCP提供的服务器为0
+	Priority uint16 `json:"priority"`
+
+	// Weight 是SRV记录的权重，同一优先级的服务器按权重随机排列
+	Weight uint16 `json:"weight"`
+}
+
+// DiscoverServers 查询domain的_ntp._udp SRV记录，返回按RFC 2782排列的服务器：
+// 优先级低的在前，同一优先级按权重随机排列，因此大量设备会按权重分散到各个服务器。
+// resolver为nil时使用net.DefaultResolver
+func DiscoverServers(ctx context.Context, resolver SRVResolver, domain string) ([]DiscoveredServer, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	_, records, err := resolver.LookupSRV(ctx, SRVService, "udp", domain)
+	if err != nil {
+		return nil, fmt.Errorf("查询 %s 的SRV记录失败: %w", domain, err)
+	}
+
+	servers := make([]DiscoveredServer, 0, len(records))
+	for _, record := range records {
+		// 目标为"."表示该域名不提供此服务
+		target := strings.TrimSuffix(record.Target, ".")
+		if target == "" {
+			continue
+		}
+		servers = append(servers, DiscoveredServer{
+			Address:  net.JoinHostPort(target, strconv.Itoa(int(record.Port))),
+			Priority: record.Priority,
+			Weight:   record.Weight,
+		})
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("%s 没有提供NTP服务器的SRV记录", domain)
+	}
+	sortSRV(servers)
+	return servers, nil
+}
+
+// sortSRV 按优先级排序，同一优先级的服务器按权重随机排列（RFC 2782）
+func sortSRV(servers []DiscoveredServer) {
+	sort.SliceStable(servers, func(i, j int) bool {
+		return servers[i].Priority < servers[j].Priority
+	})
+	for i := 0; i < len(servers); {
+		j := i + 1
+		for j < len(servers) && servers[j].Priority == servers[i].Priority {
+			j++
+		}
+		shuffleByWeight(servers[i:j])
+		i = j
+	}
+}
+
+// shuffleByWeight 依次按权重随机选出下一个服务器，权重为0的服务器只在最后被选中
+func shuffleByWeight(servers []DiscoveredServer) {
+	sum := 0
+	for _, s := range servers {
+		sum += int(s.Weight)
+	}
+	for sum > 0 && len(servers) > 1 {
+		pick := rand.IntN(sum)
+		running := 0
+		for i := range servers {
+			running += int(servers[i].Weight)
+			if running > pick {
+				servers[0], servers[i] = servers[i], servers[0]
+				break
+			}
+		}
+		sum -= int(servers[0].Weight)
+		servers = servers[1:]
+	}
+}
+
+// srvResolver 返回查询SRV记录使用的Resolver：r实现了SRVResolver时使用r，否则使用net.DefaultResolver
+func srvResolver(r Resolver) SRVResolver {
+	if s, ok := r.(SRVResolver); ok {
+		return s
+	}
+	return net.DefaultResolver
+}
+
+// LookupSRV 查询SRV记录，结果不缓存
+// 底层的Resolver实现了SRVResolver时交给它查询，否则使用net.DefaultResolver
+func (r *CachingResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return srvResolver(r.resolver).LookupSRV(ctx, service, proto, name)
+}
+
+// SetPriority 设置服务器的优先级，数值小的优先
+// 可达的服务器中，设置了优先级的排在没有设置的之前，同一优先级再按健康评分等排序
+func (sm *ServerManager) SetPriority(server string, priority int) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if _, exists := sm.servers[server]; !exists {
+		return fmt.Errorf("服务器 %s 不存在", server)
+	}
+	if sm.priority == nil {
+		sm.priority = make(map[string]int)
+	}
+	sm.priority[server] = priority
+	sm.reorderServers()
+	return nil
+}
+
+// mergeDiscovered 将发现的服务器合并到服务器列表servers：发现的服务器按顺序排在前面，
+// previous中上次发现而这次没有发现的服务器被移除，其它服务器保持原来的顺序。
+// 返回新的服务器列表和其中由发现加入的服务器
+func mergeDiscovered(servers []string, previous map[string]bool, discovered []DiscoveredServer) ([]string, map[string]bool) {
+	configured := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		if !previous[server] {
+			configured[server] = true
+		}
+	}
+
+	merged := make([]string, 0, len(discovered)+len(configured))
+	added := make(map[string]bool, len(discovered))
+	seen := make(map[string]bool, len(discovered))
+	for _, d := range discovered {
+		if seen[d.Address] {
+			continue
+		}
+		seen[d.Address] = true
+		merged = append(merged, d.Address)
+		if !configured[d.Address] {
+			added[d.Address] = true
+		}
+	}
+	for _, server := range servers {
+		if configured[server] && !seen[server] {
+			merged = append(merged, server)
+		}
+	}
+	return merged, added
+}
+
+// Rediscover 重新读取DHCP租约（Options.DHCPServers）、查询Options.SRVDomain的SRV记录并更新服务器列表
+// 新发现的服务器被加入，不再提供的服务器被移除，配置的服务器作为后备排在最后。
+// 任一来源失败或者没有剩下任何服务器时保留原来的服务器。本地网络变化后重新同步时会自动调用
+func (n *NTPSync) Rediscover(ctx context.Context) error {
+	if n.srvDomain == "" && !n.dhcpServers {
+		return errors.New("未设置SRVDomain或DHCPServers")
+	}
+	discovered, err := discover(ctx, n.resolver, n.srvDomain, n.dhcpServers)
+	if err != nil {
+		return err
+	}
+	return n.setDiscovered(discovered)
+}
+
+// discover 读取DHCP租约并查询domain的SRV记录，DHCP提供的服务器排在前面
+// 某个来源失败时仍返回其它来源发现的服务器，以及失败的错误
+func discover(ctx context.Context, resolver Resolver, domain string, dhcp bool) ([]DiscoveredServer, error) {
+	var discovered []DiscoveredServer
+	var errs []error
+	if dhcp {
+		servers, err := LookupDHCPServers()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, server := range servers {
+			discovered = append(discovered, DiscoveredServer{Address: server})
+		}
+	}
+	if domain != "" {
+		servers, err := DiscoverServers(ctx, srvResolver(resolver), domain)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		discovered = append(discovered, servers...)
+	}
+	return discovered, errors.Join(errs...)
+}
+
+// rediscover 在网络变化后重新发现服务器，不超过同步的超时时间
+func (n *NTPSync) rediscover() {
+	n.mutex.RLock()
+	timeout := n.timeout
+	n.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(n.context(), timeout)
+	defer cancel()
+	_ = n.Rediscover(ctx)
+}
+
+// withDiscovered 返回由发现加入的服务器（保持当前顺序）和configured组成的服务器列表
+func (n *NTPSync) withDiscovered(configured []string) []string {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	servers := make([]string, 0, len(n.discovered)+len(configured))
+	for _, server := range n.servers {
+		if n.discovered[server] {
+			servers = append(servers, server)
+		}
+	}
+	for _, server := range configured {
+		if !n.discovered[server] {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// setDiscovered 以discovered替换上次发现的服务器，并把SRV记录的优先级设置到服务器管理器
+func (n *NTPSync) setDiscovered(discovered []DiscoveredServer) error {
+	n.mutex.Lock()
+	old := n.servers
+	merged, found := mergeDiscovered(old, n.discovered, discovered)
+	if len(merged) == 0 {
+		n.mutex.Unlock()
+		return errors.New("没有发现任何NTP服务器")
+	}
+	n.discovered = found
+	n.setServersLocked(merged)
+	n.mutex.Unlock()
+
+	if n.serverManager != nil {
+		setPriorities(n.serverManager, discovered)
+	}
+	return nil
+}
+
+// setPriorities 把SRV记录的优先级设置到服务器管理器，同一地址以排在前面的记录为准
+func setPriorities(sm *ServerManager, discovered []DiscoveredServer) {
+	seen := make(map[string]bool, len(discovered))
+	for _, d := range discovered {
+		if !seen[d.Address] {
+			seen[d.Address] = true
+			_ = sm.SetPriority(d.Address, int(d.Priority))
+		}
+	}
+}
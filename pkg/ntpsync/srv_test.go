@@ -0,0 +1,164 @@
+package ntpsync
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// fakeSRVResolver 返回固定的SRV记录，主机名都解析为127.0.0.1
+type fakeSRVResolver struct {
+	mutex   sync.Mutex
+	records []*net.SRV
+}
+
+func (r *fakeSRVResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if service != SRVService || proto != "udp" || name != "example.test" {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	records := make([]*net.SRV, len(r.records))
+	for i, record := range r.records {
+		copied := *record
+		records[i] = &copied
+	}
+	return "", records, nil
+}
+
+func (r *fakeSRVResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	return []netip.Addr{netip.MustParseAddr("127.0.0.1")}, nil
+}
+
+func (r *fakeSRVResolver) setRecords(records ...*net.SRV) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.records = records
+}
+
+// srvRecord 返回指向测试服务器端口的SRV记录
+func srvRecord(target string, server *ntptest.Server, priority, weight uint16) *net.SRV {
+	_, port, _ := net.SplitHostPort(server.Addr())
+	number, _ := strconv.Atoi(port)
+	return &net.SRV{Target: target + ".", Port: uint16(number), Priority: priority, Weight: weight}
+}
+
+// TestDiscoverServers 测试按优先级排序、同一优先级按权重随机排列，并忽略目标为"."的记录
+func TestDiscoverServers(t *testing.T) {
+	resolver := &fakeSRVResolver{}
+	resolver.setRecords(
+		&net.SRV{Target: "backup.example.test.", Port: 123, Priority: 20, Weight: 0},
+		&net.SRV{Target: "light.example.test.", Port: 123, Priority: 10, Weight: 0},
+		&net.SRV{Target: "heavy.example.test.", Port: 123, Priority: 10, Weight: 100},
+		&net.SRV{Target: ".", Port: 0, Priority: 0, Weight: 0},
+	)
+
+	for i := 0; i < 20; i++ {
+		servers, err := DiscoverServers(context.Background(), resolver, "example.test")
+		if err != nil {
+			t.Fatalf("发现服务器失败: %v", err)
+		}
+		var addresses []string
+		for _, s := range servers {
+			addresses = append(addresses, s.Address)
+		}
+		// 权重为0的服务器只在同一优先级的其它服务器之后被选中
+		want := []string{"heavy.example.test:123", "light.example.test:123", "backup.example.test:123"}
+		if !slices.Equal(addresses, want) {
+			t.Fatalf("预期%v，实际得到%v", want, addresses)
+		}
+	}
+
+	if _, err := DiscoverServers(context.Background(), resolver, "missing.test"); err == nil {
+		t.Error("预期没有SRV记录时返回错误")
+	}
+}
+
+// TestShuffleByWeight 测试同一优先级的服务器按权重比例排在第一位
+func TestShuffleByWeight(t *testing.T) {
+	first := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		servers := []DiscoveredServer{{Address: "a", Weight: 10}, {Address: "b", Weight: 30}}
+		shuffleByWeight(servers)
+		first[servers[0].Address]++
+	}
+	if ratio := float64(first["b"]) / 4000; ratio < 0.7 || ratio > 0.8 {
+		t.Errorf("预期权重为30的服务器约75%%排在第一位，实际为%.2f", ratio)
+	}
+}
+
+// TestSRVDomain 测试发现的服务器按SRV优先级排在配置的服务器之前，重新发现后更新服务器列表
+func TestSRVDomain(t *testing.T) {
+	primary := ntptest.NewServer()
+	defer primary.Close()
+	secondary := ntptest.NewServer()
+	defer secondary.Close()
+	fallback := ntptest.NewServer()
+	defer fallback.Close()
+
+	resolver := &fakeSRVResolver{}
+	resolver.setRecords(
+		srvRecord("secondary.example.test", secondary, 20, 0),
+		srvRecord("primary.example.test", primary, 10, 0),
+	)
+	ntp, err := New(Options{
+		Servers:           []string{fallback.Addr()},
+		SRVDomain:         "example.test",
+		Resolver:          resolver,
+		Timeout:           time.Second,
+		MinPollInterval:   -1,
+		EnableMultiServer: true,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	primaryAddr := net.JoinHostPort("primary.example.test", strconv.Itoa(int(resolver.records[1].Port)))
+	secondaryAddr := net.JoinHostPort("secondary.example.test", strconv.Itoa(int(resolver.records[0].Port)))
+	want := []string{primaryAddr, secondaryAddr, fallback.Addr()}
+	if got := ntp.GetServers(); !slices.Equal(got, want) {
+		t.Fatalf("预期服务器列表为%v，实际得到%v", want, got)
+	}
+
+	// 所有服务器都可达时按SRV优先级排序，配置的服务器排在最后
+	if err := ntp.serverManager.ProbeAllServers(ntp); err != nil {
+		t.Fatalf("探测服务器失败: %v", err)
+	}
+	if got := ntp.serverManager.GetServers(); !slices.Equal(got, want) {
+		t.Errorf("预期服务器管理器的顺序为%v，实际得到%v", want, got)
+	}
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 重新发现后移除不再出现的服务器，保留配置的服务器
+	resolver.setRecords(srvRecord("secondary.example.test", secondary, 10, 0))
+	if err := ntp.Rediscover(context.Background()); err != nil {
+		t.Fatalf("重新发现服务器失败: %v", err)
+	}
+	want = []string{secondaryAddr, fallback.Addr()}
+	if got := ntp.GetServers(); !slices.Equal(got, want) {
+		t.Errorf("预期服务器列表为%v，实际得到%v", want, got)
+	}
+	if got := ntp.serverManager.GetServers(); len(got) != 2 {
+		t.Errorf("预期服务器管理器中有2个服务器，实际得到%v", got)
+	}
+}
+
+// TestSRVDomainRequired 测试没有配置服务器时SRV查询失败会使New返回错误
+func TestSRVDomainRequired(t *testing.T) {
+	_, err := New(Options{SRVDomain: "missing.test", Resolver: &fakeSRVResolver{}})
+	if err == nil {
+		t.Error("预期没有可用的服务器时返回错误")
+	}
+}
@@ -0,0 +1,33 @@
+package ntpsync
+
+import "time"
+
+// resyncIfStale 在最后一次同步的时效超过MaxStaleness时在后台重新同步，
+// 距离上次因此触发的同步不足BackoffInitial时不再触发
+func (n *NTPSync) resyncIfStale(s *nowSnapshot, local time.Time) {
+	if local.Sub(s.lastSync)+s.suspended <= n.maxStaleness {
+		return
+	}
+
+	last := n.staleResync.Load()
+	now := local.UnixNano()
+	if last != 0 && now-last < int64(n.backoffInitial) {
+		return
+	}
+	if !n.staleResync.CompareAndSwap(last, now) {
+		return
+	}
+	n.goAsync(func() { _ = n.Sync() })
+}
+
+// NowWithStaleness 返回与Now相同的时间，以及最后一次成功同步的时效是否超过MaxStaleness，
+// 从未同步时总是认为已经过时。未设置MaxStaleness时只在从未同步时返回true
+func (n *NTPSync) NowWithStaleness() (time.Time, bool) {
+	now := n.Now()
+
+	age := n.LastSyncAge()
+	if age == NeverSynced {
+		return now, true
+	}
+	return now, n.maxStaleness > 0 && age > n.maxStaleness
+}
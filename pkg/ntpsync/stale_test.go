@@ -0,0 +1,60 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestMaxStaleness 测试同步过时后调用Now触发重新同步
+func TestMaxStaleness(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		Timeout:         time.Second,
+		Clock:           clock,
+		MinPollInterval: -1,
+		MaxStaleness:    time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if _, stale := ntp.NowWithStaleness(); !stale {
+		t.Error("预期从未同步时认为已经过时")
+	}
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	clock.Advance(30 * time.Second)
+	if _, stale := ntp.NowWithStaleness(); stale {
+		t.Error("预期时效未超过MaxStaleness时没有过时")
+	}
+
+	clock.Advance(time.Minute)
+	if _, stale := ntp.NowWithStaleness(); !stale {
+		t.Error("预期时效超过MaxStaleness时已经过时")
+	}
+	waitForRequests(t, srv, 2)
+
+	// 重新同步完成之前的调用不再触发同步
+	ntp.Now()
+	deadline := time.Now().Add(5 * time.Second)
+	for ntp.LastSyncAge() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, stale := ntp.NowWithStaleness(); stale {
+		t.Error("预期重新同步之后不再过时")
+	}
+	if got := srv.RequestCount(); got != 2 {
+		t.Errorf("预期只重新同步一次，实际服务器收到%d个请求", got)
+	}
+}
@@ -0,0 +1,228 @@
+// Package statsd 以StatsD或DogStatsD协议通过UDP发送同步指标，供没有Prometheus的团队监控同步状况。
+//
+// Sink发送以下指标（名称前加Prefix）：
+//
+//	sync.success  计数器，每次同步成功加一
+//	sync.error    计数器，每次同步失败加一
+//	offset_ms     仪表，当前的时间偏移量
+//	rtt_ms        仪表，每个服务器最近一次测量的往返时间
+//	offset_ms     仪表，每个服务器最近一次测量的偏移量
+//
+// 服务器的指标在DogStatsD中以server标签区分，在普通StatsD中服务器地址会作为名称的一部分，
+// 例如ntpsync.server.pool_example_com_123.rtt_ms。
+//
+//	sink, err := statsd.New(ntp, statsd.Options{Address: "127.0.0.1:8125", DogStatsD: true})
+//	go sink.Run(ctx)
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync"
+)
+
+// 默认配置
+const (
+	DefaultAddress  = "127.0.0.1:8125"
+	DefaultPrefix   = "ntpsync."
+	DefaultInterval = time.Minute
+)
+
+// maxPacketSize 是一个数据报的最大长度，超过时拆分为多个数据报，避免在常见的MTU下分片
+const maxPacketSize = 1432
+
+// Options 包含Sink的配置选项
+type Options struct {
+	// Address 是StatsD服务的UDP地址，为空时使用DefaultAddress
+	Address string
+
+	// Prefix 是所有指标名称的前缀，为空时使用DefaultPrefix
+	Prefix string
+
+	// DogStatsD 表示使用DogStatsD的标签扩展，服务器地址以server标签发送
+	DogStatsD bool
+
+	// Tags 是DogStatsD中添加到每个指标的标签，例如"device:gw-001"，普通StatsD中忽略
+	Tags []string
+
+	// Interval 是定时发送仪表的间隔，每次同步完成后也会发送
+	Interval time.Duration
+
+	// OnError 接收发送过程中的错误，可以为nil
+	OnError func(error)
+}
+
+// Sink 将同步指标发送到StatsD服务
+type Sink struct {
+	ntp  *ntpsync.NTPSync
+	opts Options
+	conn net.Conn
+}
+
+// New 创建一个发送同步指标的Sink，调用Run开始发送
+func New(n *ntpsync.NTPSync, opts Options) (*Sink, error) {
+	if n == nil {
+		return nil, errors.New("必须提供NTPSync实例")
+	}
+	if opts.Address == "" {
+		opts.Address = DefaultAddress
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	for _, tag := range opts.Tags {
+		if tag == "" || strings.ContainsAny(tag, ",|#\n") {
+			return nil, fmt.Errorf("无效的标签: %q", tag)
+		}
+	}
+
+	conn, err := net.Dial("udp", opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("连接StatsD服务 %s 失败: %v", opts.Address, err)
+	}
+
+	return &Sink{ntp: n, opts: opts, conn: conn}, nil
+}
+
+// Close 关闭到StatsD服务的连接
+func (s *Sink) Close() error {
+	return s.conn.Close()
+}
+
+// Run 持续发送同步指标，直到ctx被取消
+// 同步成功或失败时发送计数器，之后与每个Interval一起发送仪表；错误交给OnError，返回ctx.Err()
+func (s *Sink) Run(ctx context.Context) error {
+	events, unsubscribe := s.ntp.Subscribe(0)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	s.report(s.SendGauges())
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-events:
+			switch ev.Type {
+			case ntpsync.EventSyncSucceeded:
+				s.report(s.send([]string{s.counter("sync.success")}))
+				s.report(s.SendGauges())
+			case ntpsync.EventSyncFailed:
+				s.report(s.send([]string{s.counter("sync.error")}))
+			}
+		case <-ticker.C:
+			s.report(s.SendGauges())
+		}
+	}
+}
+
+// SendGauges 发送一次当前的偏移量和每个服务器的测量
+func (s *Sink) SendGauges() error {
+	var metrics []string
+	if s.ntp.LastSyncAge() != ntpsync.NeverSynced {
+		metrics = append(metrics, s.gauge("offset_ms", "", s.ntp.TimeOffsetDuration())...)
+	}
+	for _, peer := range s.ntp.GetPeers() {
+		if peer.Stratum == 0 {
+			// 尚未测量过的服务器没有数据
+			continue
+		}
+		metrics = append(metrics, s.gauge("offset_ms", peer.Address, peer.Offset)...)
+		metrics = append(metrics, s.gauge("rtt_ms", peer.Address, peer.Delay)...)
+	}
+	return s.send(metrics)
+}
+
+// counter 编码一次计数器加一
+func (s *Sink) counter(name string) string {
+	return s.opts.Prefix + name + ":1|c" + s.tags("")
+}
+
+// gauge 编码以毫秒为单位的仪表，server非空时表示服务器的指标
+// 普通StatsD把带符号的仪表值当作增量，因此负值前先将仪表置零
+func (s *Sink) gauge(name, server string, d time.Duration) []string {
+	if server != "" && !s.opts.DogStatsD {
+		name = "server." + sanitize(server) + "." + name
+	}
+	name = s.opts.Prefix + name
+	value := strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+	tags := s.tags(server)
+
+	if d < 0 && !s.opts.DogStatsD {
+		return []string{name + ":0|g" + tags, name + ":" + value + "|g" + tags}
+	}
+	return []string{name + ":" + value + "|g" + tags}
+}
+
+// tags 返回DogStatsD的标签后缀，普通StatsD时返回空字符串
+func (s *Sink) tags(server string) string {
+	if !s.opts.DogStatsD {
+		return ""
+	}
+	tags := s.opts.Tags
+	if server != "" {
+		tags = append(tags[:len(tags):len(tags)], "server:"+server)
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// send 将指标以换行分隔合并为尽量少的数据报发送
+func (s *Sink) send(metrics []string) error {
+	var packet []byte
+	for _, m := range metrics {
+		if len(packet) > 0 && len(packet)+1+len(m) > maxPacketSize {
+			if err := s.write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, m...)
+	}
+	if len(packet) == 0 {
+		return nil
+	}
+	return s.write(packet)
+}
+
+// write 发送一个数据报
+func (s *Sink) write(packet []byte) error {
+	if _, err := s.conn.Write(packet); err != nil {
+		return fmt.Errorf("发送StatsD指标失败: %v", err)
+	}
+	return nil
+}
+
+// report 将错误交给OnError
+func (s *Sink) report(err error) {
+	if err != nil && s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
+
+// sanitize 将服务器地址转换为可以用作指标名称一部分的形式
+func sanitize(server string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, server)
+}
@@ -0,0 +1,174 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntpsynctest"
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// listen 创建接收StatsD数据报的UDP端口
+func listen(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听UDP端口失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// receive 读取数据报直到收到以prefix开头的指标，返回该指标
+func receive(t *testing.T, conn net.PacketConn, prefix string) string {
+	t.Helper()
+
+	buf := make([]byte, 2048)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_ = conn.SetReadDeadline(deadline)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("等待指标%s超时: %v", prefix, err)
+		}
+		for _, m := range strings.Split(string(buf[:n]), "\n") {
+			if strings.HasPrefix(m, prefix) {
+				return m
+			}
+		}
+	}
+}
+
+// TestGauge 测试仪表的编码，普通StatsD的负值先置零
+func TestGauge(t *testing.T) {
+	s := &Sink{opts: Options{Prefix: "ntpsync."}}
+	got := s.gauge("rtt_ms", "pool.example.com:123", -1500*time.Microsecond)
+	want := []string{"ntpsync.server.pool_example_com_123.rtt_ms:0|g", "ntpsync.server.pool_example_com_123.rtt_ms:-1.5|g"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("预期%v，实际得到%v", want, got)
+	}
+
+	s.opts.DogStatsD = true
+	s.opts.Tags = []string{"device:gw-001"}
+	got = s.gauge("offset_ms", "pool.example.com:123", -2*time.Millisecond)
+	if len(got) != 1 || got[0] != "ntpsync.offset_ms:-2|g|#device:gw-001,server:pool.example.com:123" {
+		t.Errorf("DogStatsD仪表编码错误: %v", got)
+	}
+	if got := s.counter("sync.success"); got != "ntpsync.sync.success:1|c|#device:gw-001" {
+		t.Errorf("计数器编码错误: %s", got)
+	}
+}
+
+// TestSendSplitsPackets 测试超过数据报长度的指标被拆分发送
+func TestSendSplitsPackets(t *testing.T) {
+	conn := listen(t)
+	srv := ntptest.NewServer()
+	defer srv.Close()
+
+	sink, err := New(ntpsynctest.NewClient(t, srv), Options{Address: conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("创建Sink失败: %v", err)
+	}
+	defer sink.Close()
+
+	metrics := make([]string, 100)
+	for i := range metrics {
+		metrics[i] = "ntpsync.test.metric.with.a.fairly.long.name:1|c"
+	}
+	if err := sink.send(metrics); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	total := 0
+	for total < len(metrics) {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("读取数据报失败: %v", err)
+		}
+		if n > maxPacketSize {
+			t.Errorf("数据报长度%d超过%d", n, maxPacketSize)
+		}
+		total += strings.Count(string(buf[:n]), "\n") + 1
+	}
+	if total != len(metrics) {
+		t.Errorf("预期%d个指标，实际收到%d个", len(metrics), total)
+	}
+}
+
+// TestRun 测试同步成功和失败时发送的计数器和仪表
+func TestRun(t *testing.T) {
+	conn := listen(t)
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetOffset(time.Second)
+	ntp := ntpsynctest.NewClient(t, srv)
+
+	errs := make(chan error, 4)
+	sink, err := New(ntp, Options{
+		Address:   conn.LocalAddr().String(),
+		DogStatsD: true,
+		Tags:      []string{"device:gw-001"},
+		Interval:  time.Hour,
+		OnError:   func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatalf("创建Sink失败: %v", err)
+	}
+	defer sink.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- sink.Run(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if m := receive(t, conn, "ntpsync.sync.success:"); m != "ntpsync.sync.success:1|c|#device:gw-001" {
+		t.Errorf("成功计数器错误: %s", m)
+	}
+	if m := receive(t, conn, "ntpsync.rtt_ms:"); !strings.HasSuffix(m, "|g|#device:gw-001,server:"+srv.Addr()) {
+		t.Errorf("往返时间仪表错误: %s", m)
+	}
+
+	srv.SetDrop(true)
+	if err := ntp.ForceSyncNow(); err == nil {
+		t.Fatal("预期同步失败")
+	}
+	if m := receive(t, conn, "ntpsync.sync.error:"); m != "ntpsync.sync.error:1|c|#device:gw-001" {
+		t.Errorf("失败计数器错误: %s", m)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("预期context.Canceled，实际得到: %v", err)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("发送失败: %v", err)
+	default:
+	}
+}
+
+// TestNewValidation 测试无效的配置
+func TestNewValidation(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	ntp := ntpsynctest.NewClient(t, srv)
+
+	if _, err := New(nil, Options{}); err == nil {
+		t.Error("预期nil实例返回错误")
+	}
+	if _, err := New(ntp, Options{Tags: []string{"a|b"}}); err == nil {
+		t.Error("预期无效的标签返回错误")
+	}
+	if _, err := New(ntp, Options{Address: "no-port"}); err == nil {
+		t.Error("预期无效的地址返回错误")
+	}
+}
@@ -0,0 +1,294 @@
+package ntpsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsFormat 是测量日志文件的格式，参见Options.StatsDir
+type StatsFormat string
+
+// 支持的测量日志格式
+const (
+	// StatsFormatNTPD 是ntpd的peerstats和loopstats格式，每行是以空格分隔的字段，
+	// 分析ntpd统计文件的脚本和绘图工具可以直接使用，是默认的格式
+	StatsFormatNTPD StatsFormat = "ntpd"
+
+	// StatsFormatJSONL 每行是一个JSON对象，peerstats为SyncResult，loopstats为LoopStats
+	StatsFormatJSONL StatsFormat = "jsonl"
+)
+
+// 测量日志文件名称的前缀，与ntpd相同，后面是UTC日期，例如peerstats.20240101
+const (
+	PeerStatsName = "peerstats"
+	LoopStatsName = "loopstats"
+)
+
+// mjdUnixEpoch 是1970年1月1日的修正儒略日
+const mjdUnixEpoch = 40587
+
+// peerStatusCandidate 是peerstats中的对等体状态字：配置的、可达的候选服务器，
+// peerStatusAuthentic 是认证通过时加上的位
+const (
+	peerStatusCandidate = 0x9400
+	peerStatusAuthentic = 0x6000
+)
+
+// LoopStats 是一次应用同步结果之后时钟调整的状态，对应ntpd的loopstats的一行
+type LoopStats struct {
+	// Time 是同步结果的时间
+	Time time.Time `json:"time"`
+
+	// Offset 是应用到Now的偏移量
+	Offset time.Duration `json:"offset"`
+
+	// Frequency 是估计的本地时钟频率偏差，单位为ppm，还没有估计出时为0
+	Frequency float64 `json:"frequency_ppm"`
+
+	// Jitter 是最近测得的偏移量的抖动，参见Jitter
+	Jitter time.Duration `json:"jitter"`
+
+	// Wander 是Frequency的估计误差，单位为ppm，对应ntpd的频率稳定度
+	Wander float64 `json:"wander_ppm"`
+
+	// TimeConstant 是同步间隔以2为底的对数，对应ntpd的轮询间隔指数
+	TimeConstant int `json:"time_constant"`
+}
+
+// validateStatsFormat 检查测量日志格式，空字符串表示StatsFormatNTPD
+func validateStatsFormat(format StatsFormat) error {
+	switch format {
+	case "", StatsFormatNTPD, StatsFormatJSONL:
+		return nil
+	}
+	return fmt.Errorf("未知的测量日志格式%q，可选%q或%q", format, StatsFormatNTPD, StatsFormatJSONL)
+}
+
+// modifiedJulianDay 返回t的UTC修正儒略日和当天经过的秒数，即ntpd统计文件每行的前两个字段
+func modifiedJulianDay(t time.Time) (int64, float64) {
+	seconds := t.Unix()
+	day := seconds / 86400
+	if seconds%86400 < 0 {
+		day--
+	}
+	return day + mjdUnixEpoch, float64(seconds-day*86400) + float64(t.Nanosecond())/1e9
+}
+
+// statsLog 把测量写入按UTC日期轮换的文件，每种统计同时只打开当天的一个文件
+type statsLog struct {
+	dir    string
+	format StatsFormat
+	keep   int
+
+	mutex  sync.Mutex
+	files  map[string]*statsFile
+	failed bool
+	closed bool
+}
+
+// statsFile 是一种统计当前写入的文件
+type statsFile struct {
+	day  string
+	file *os.File
+}
+
+// newStatsLog 创建写入dir的测量日志，dir不存在时创建
+func newStatsLog(dir string, format StatsFormat, keep int) (*statsLog, error) {
+	if err := validateStatsFormat(format); err != nil {
+		return nil, err
+	}
+	if keep < 0 {
+		return nil, fmt.Errorf("测量日志保留天数不能为负值: %d", keep)
+	}
+	if format == "" {
+		format = StatsFormatNTPD
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建测量日志目录失败: %v", err)
+	}
+	return &statsLog{dir: dir, format: format, keep: keep, files: make(map[string]*statsFile)}, nil
+}
+
+// write 把一行追加到name在t的UTC日期的文件，日期变化时换到新的文件并删除过期的文件。
+// 连续失败时只在第一次返回错误，恢复之前不再重复报告
+func (l *statsLog) write(name string, t time.Time, line []byte) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	err := l.writeLocked(name, t, line)
+	failed := l.failed
+	l.failed = err != nil
+	if failed {
+		return nil
+	}
+	return err
+}
+
+// writeLocked 执行写入，调用者必须持有l.mutex
+func (l *statsLog) writeLocked(name string, t time.Time, line []byte) error {
+	day := t.UTC().Format("20060102")
+	f := l.files[name]
+	if f == nil || f.day != day {
+		if f != nil {
+			f.file.Close()
+			delete(l.files, name)
+		}
+		file, err := os.OpenFile(l.path(name, day), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("打开测量日志失败: %v", err)
+		}
+		f = &statsFile{day: day, file: file}
+		l.files[name] = f
+		l.prune(name, t)
+	}
+	if _, err := f.file.Write(line); err != nil {
+		// 关闭出错的文件，下一次写入时重新打开
+		f.file.Close()
+		delete(l.files, name)
+		return fmt.Errorf("写入测量日志失败: %v", err)
+	}
+	return nil
+}
+
+// path 返回name在day的文件路径
+func (l *statsLog) path(name, day string) string {
+	file := name + "." + day
+	if l.format == StatsFormatJSONL {
+		file += ".jsonl"
+	}
+	return filepath.Join(l.dir, file)
+}
+
+// prune 删除name在t之前已经超过保留天数的文件，keep为0时全部保留
+func (l *statsLog) prune(name string, t time.Time) {
+	if l.keep <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return
+	}
+	today := t.UTC().Truncate(24 * time.Hour)
+	cutoff := today.AddDate(0, 0, 1-l.keep)
+	for _, e := range entries {
+		rest, ok := strings.CutPrefix(e.Name(), name+".")
+		if !ok || e.IsDir() {
+			continue
+		}
+		day, err := time.Parse("20060102", strings.TrimSuffix(rest, ".jsonl"))
+		if err == nil && day.Before(cutoff) {
+			os.Remove(filepath.Join(l.dir, e.Name()))
+		}
+	}
+}
+
+// close 关闭所有打开的文件，之后的写入被忽略
+func (l *statsLog) close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.closed = true
+	var firstErr error
+	for name, f := range l.files {
+		if err := f.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(l.files, name)
+	}
+	return firstErr
+}
+
+// peerLine 按格式编码一次测量，ntpd格式的字段依次为修正儒略日、当天的秒数、服务器地址、
+// 状态字、偏移量、往返时间、离散度和抖动，时长的单位为秒
+func (l *statsLog) peerLine(result *SyncResult, authentic bool, jitter time.Duration) ([]byte, error) {
+	if l.format == StatsFormatJSONL {
+		return jsonLine(result)
+	}
+	host := result.Server
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	status := peerStatusCandidate
+	if authentic {
+		status |= peerStatusAuthentic
+	}
+	dispersion := result.Precision + time.Duration(float64(result.RTT)*frequencyTolerance)
+	day, seconds := modifiedJulianDay(result.Time)
+	return fmt.Appendf(nil, "%d %.3f %s %04x %.9f %.9f %.9f %.9f\n", day, seconds, host, status,
+		result.Offset.Seconds(), result.RTT.Seconds(), dispersion.Seconds(), jitter.Seconds()), nil
+}
+
+// loopLine 按格式编码时钟调整的状态，ntpd格式的字段依次为修正儒略日、当天的秒数、偏移量（秒）、
+// 频率偏差（ppm）、抖动（秒）、频率稳定度（ppm）和时间常数
+func (l *statsLog) loopLine(stats LoopStats) ([]byte, error) {
+	if l.format == StatsFormatJSONL {
+		return jsonLine(stats)
+	}
+	day, seconds := modifiedJulianDay(stats.Time)
+	return fmt.Appendf(nil, "%d %.3f %.9f %.3f %.9f %.6f %d\n", day, seconds, stats.Offset.Seconds(),
+		stats.Frequency, stats.Jitter.Seconds(), stats.Wander, stats.TimeConstant), nil
+}
+
+// jsonLine 把v编码为一行JSON
+func jsonLine(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writePeerStats 把服务器的一次成功测量写入peerstats，authentic表示应答通过了对称密钥认证
+func (n *NTPSync) writePeerStats(result *SyncResult, authentic bool) {
+	if n.statsLog == nil {
+		return
+	}
+	line, err := n.statsLog.peerLine(result, authentic, n.serverJitter(result.Server))
+	if err == nil {
+		err = n.statsLog.write(PeerStatsName, result.Time, line)
+	}
+	n.statsWritten(result.Server, err)
+}
+
+// loopStatsLocked 返回应用result之后时钟调整的状态，调用者必须持有n.mutex
+func (n *NTPSync) loopStatsLocked(result *SyncResult) LoopStats {
+	stats := LoopStats{
+		Time:   result.Time,
+		Offset: n.timeOffset,
+		Jitter: n.systemOffsets.jitter(),
+	}
+	if freq, wander, ok := n.drift.fit(); ok {
+		stats.Frequency = freq * 1e6
+		stats.Wander = wander * 1e6
+	}
+	if seconds := n.syncInterval.Seconds(); seconds >= 1 {
+		stats.TimeConstant = int(math.Round(math.Log2(seconds)))
+	}
+	return stats
+}
+
+// writeLoopStats 把时钟调整的状态写入loopstats
+func (n *NTPSync) writeLoopStats(server string, stats LoopStats) {
+	line, err := n.statsLog.loopLine(stats)
+	if err == nil {
+		err = n.statsLog.write(LoopStatsName, stats.Time, line)
+	}
+	n.statsWritten(server, err)
+}
+
+// statsWritten 在写入测量日志开始失败时发布EventStatsWriteFailed事件
+func (n *NTPSync) statsWritten(server string, err error) {
+	if err != nil {
+		n.emit(Event{Type: EventStatsWriteFailed, Server: server, Error: err})
+	}
+}
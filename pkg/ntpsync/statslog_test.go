@@ -0,0 +1,145 @@
+package ntpsync
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// readStatsLines 读取测量日志文件的所有行
+func readStatsLines(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("打开测量日志失败: %v", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// TestModifiedJulianDay 测试修正儒略日和当天秒数的计算
+func TestModifiedJulianDay(t *testing.T) {
+	day, seconds := modifiedJulianDay(time.Date(2024, 1, 1, 12, 30, 0, 500e6, time.UTC))
+	if day != 60310 || seconds != 45000.5 {
+		t.Errorf("预期60310和45000.5，实际得到%d和%v", day, seconds)
+	}
+	if day, _ := modifiedJulianDay(time.Date(1969, 12, 31, 23, 0, 0, 0, time.UTC)); day != mjdUnixEpoch-1 {
+		t.Errorf("预期1970年之前的日期向下取整，实际得到%d", day)
+	}
+}
+
+// TestStatsLog 测试以ntpd格式写入peerstats和loopstats，以及按日期轮换和删除过期文件
+func TestStatsLog(t *testing.T) {
+	clock := newFakeClock()
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(10 * time.Millisecond)
+
+	dir := t.TempDir()
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		MinPollInterval: -1,
+		StatsDir:        dir,
+		StatsKeep:       1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+		clock.Advance(time.Minute)
+	}
+
+	peers := readStatsLines(t, filepath.Join(dir, "peerstats.20240101"))
+	if len(peers) != 2 {
+		t.Fatalf("预期peerstats有2行，实际得到%q", peers)
+	}
+	fields := strings.Fields(peers[0])
+	host := strings.Split(srv.Addr(), ":")[0]
+	if len(fields) != 8 || fields[0] != "60310" || fields[2] != host || fields[3] != "9400" {
+		t.Errorf("预期ntpd格式的peerstats，实际得到%q", peers[0])
+	}
+	if offset, err := strconv.ParseFloat(fields[4], 64); err != nil || offset < 0.0099 || offset > 0.0101 {
+		t.Errorf("预期偏移量约为0.01秒，实际得到%q", fields[4])
+	}
+
+	loops := readStatsLines(t, filepath.Join(dir, "loopstats.20240101"))
+	if len(loops) != 2 {
+		t.Fatalf("预期loopstats有2行，实际得到%q", loops)
+	}
+	if fields := strings.Fields(loops[1]); len(fields) != 7 || fields[0] != "60310" || fields[6] != "12" {
+		t.Errorf("预期ntpd格式的loopstats，时间常数为12，实际得到%q", loops[1])
+	}
+
+	// 换到第二天的文件后只保留当天
+	clock.Advance(24 * time.Hour)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "peerstats.20240101")); !os.IsNotExist(err) {
+		t.Errorf("预期前一天的文件被删除，实际得到%v", err)
+	}
+	if lines := readStatsLines(t, filepath.Join(dir, "peerstats.20240102")); len(lines) != 1 {
+		t.Errorf("预期新文件有1行，实际得到%q", lines)
+	}
+}
+
+// TestStatsLogJSONL 测试以JSONL格式写入测量日志
+func TestStatsLogJSONL(t *testing.T) {
+	clock := newFakeClock()
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(10 * time.Millisecond)
+
+	dir := t.TempDir()
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		MinPollInterval: -1,
+		StatsDir:        dir,
+		StatsFormat:     StatsFormatJSONL,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	var result SyncResult
+	peers := readStatsLines(t, filepath.Join(dir, "peerstats.20240101.jsonl"))
+	if len(peers) != 1 || json.Unmarshal([]byte(peers[0]), &result) != nil || result.Server != srv.Addr() {
+		t.Errorf("预期一行SyncResult，实际得到%q", peers)
+	}
+	var loop LoopStats
+	loops := readStatsLines(t, filepath.Join(dir, "loopstats.20240101.jsonl"))
+	if len(loops) != 1 || json.Unmarshal([]byte(loops[0]), &loop) != nil || loop.Offset != ntp.TimeOffsetDuration() {
+		t.Errorf("预期一行LoopStats，实际得到%q", loops)
+	}
+
+	if _, err := New(Options{Servers: []string{srv.Addr()}, StatsDir: dir, StatsFormat: "csv"}); err == nil {
+		t.Error("预期未知的格式返回错误")
+	}
+}
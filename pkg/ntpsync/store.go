@@ -0,0 +1,281 @@
+package ntpsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Store 在重启之间保存实例的状态，使每天重启的设备仍然记得哪些服务器不可靠
+// 可以基于文件（FileStore）、嵌入式数据库（如bbolt）或其它存储实现
+type Store interface {
+	// Load 返回上次保存的状态，从未保存过时返回nil和nil
+	Load() (*State, error)
+
+	// Save 保存状态，替换上次保存的内容
+	Save(state *State) error
+}
+
+// State 是在重启之间保存的状态
+// 时间偏移量和最后同步时间不保存，因为重启后本地时钟可能已经改变。
+// 同样的原因，拒绝期和故障抑制期保存为剩余时长而不是截止时间，
+// 重启后从当时的本地时钟重新计算，关机期间不计入
+type State struct {
+	// Saved 是保存状态的时间
+	Saved time.Time `json:"saved"`
+
+	// Servers 是每个已配置服务器的状态
+	Servers []ServerState `json:"servers,omitempty"`
+
+	// Denied 是以DENY或RSTR拒绝访问的服务器地址到拒绝期剩余时长的映射
+	Denied map[string]time.Duration `json:"denied_remaining,omitempty"`
+
+	// MinPoll 是因RATE Kiss-o'-Death或连续超时提高了最小请求间隔的服务器地址到提高后间隔的映射
+	MinPoll map[string]time.Duration `json:"min_poll,omitempty"`
+
+	// History 是最近的同步结果，按时间顺序排列
+	History []SyncResult `json:"history,omitempty"`
+}
+
+// ServerState 是单个服务器保存的状态
+type ServerState struct {
+	// Status 是服务器的状态，包括可达性寄存器、评分和连续失败次数，只在启用多服务器支持时保存。
+	// 其中的HeldDownUntil在恢复时被忽略，由HeldDown代替
+	Status ServerStatus `json:"status"`
+
+	// HeldDown 是保存时故障抑制期的剩余时长，零值表示没有被排除
+	HeldDown time.Duration `json:"held_down,omitempty"`
+
+	// RTTs 是最近的往返时间样本，用于计算评分中的稳定性
+	RTTs []time.Duration `json:"rtts,omitempty"`
+
+	// Offsets 是最近的偏移量样本，用于计算抖动
+	Offsets []time.Duration `json:"offsets,omitempty"`
+}
+
+// State 返回实例当前需要保存的状态
+func (n *NTPSync) State() *State {
+	now := n.clock.Now()
+
+	n.mutex.RLock()
+	servers := make([]string, len(n.servers))
+	copy(servers, n.servers)
+	state := &State{
+		Saved:   now,
+		History: n.history.last(0),
+	}
+	for server, until := range n.denied {
+		if !now.Before(until) {
+			continue
+		}
+		if state.Denied == nil {
+			state.Denied = make(map[string]time.Duration)
+		}
+		state.Denied[server] = until.Sub(now)
+	}
+	for server, p := range n.serverPolls {
+		if p.minPoll <= 0 {
+			continue
+		}
+		if state.MinPoll == nil {
+			state.MinPoll = make(map[string]time.Duration)
+		}
+		state.MinPoll[server] = p.minPoll
+	}
+	offsets := make(map[string][]time.Duration, len(servers))
+	for _, server := range servers {
+		if w, ok := n.serverOffsets[serverAddress(server)]; ok {
+			offsets[server] = w.values()
+		}
+	}
+	n.mutex.RUnlock()
+
+	for _, server := range servers {
+		ss := ServerState{
+			Status:  ServerStatus{Address: server},
+			Offsets: offsets[server],
+		}
+		if n.serverManager != nil {
+			ss.Status, ss.RTTs = n.serverManager.serverState(server)
+			if now.Before(ss.Status.HeldDownUntil) {
+				ss.HeldDown = ss.Status.HeldDownUntil.Sub(now)
+			}
+		}
+		state.Servers = append(state.Servers, ss)
+	}
+	return state
+}
+
+// SaveState 立即把实例的状态保存到Options.Store，未设置Store时什么也不做
+func (n *NTPSync) SaveState() error {
+	if n.store == nil {
+		return nil
+	}
+	if err := n.store.Save(n.State()); err != nil {
+		return fmt.Errorf("保存状态失败: %w", err)
+	}
+	return nil
+}
+
+// loadState 从Options.Store恢复上次保存的状态，只恢复仍然配置的服务器的状态和提高的最小请求间隔，以及拒绝期。
+// 加载失败时丢弃保存的状态，像从未保存过一样启动，设置了Options.OnStateLoadFailed时通知
+func (n *NTPSync) loadState() {
+	if n.store == nil {
+		return
+	}
+	state, err := n.store.Load()
+	if err != nil {
+		if n.onStateLoadFailed != nil {
+			n.onStateLoadFailed(fmt.Errorf("加载保存的状态失败: %w", err))
+		}
+		return
+	}
+	if state == nil {
+		return
+	}
+
+	now := n.clock.Now()
+	n.mutex.Lock()
+	configured := make(map[string]bool, 2*len(n.servers))
+	for _, server := range n.servers {
+		configured[server] = true
+		configured[serverAddress(server)] = true
+	}
+	for server, remaining := range state.Denied {
+		if remaining > 0 {
+			if n.denied == nil {
+				n.denied = make(map[string]time.Time)
+			}
+			n.denied[server] = now.Add(min(remaining, DefaultKissDenyDuration))
+		}
+	}
+	for server, interval := range state.MinPoll {
+		if configured[server] && interval > 0 {
+			if n.serverPolls == nil {
+				n.serverPolls = make(map[string]serverPoll)
+			}
+			n.serverPolls[server] = serverPoll{minPoll: min(interval, MaxServerPollInterval)}
+		}
+	}
+	for _, ss := range state.Servers {
+		if !configured[ss.Status.Address] || len(ss.Offsets) == 0 {
+			continue
+		}
+		if n.serverOffsets == nil {
+			n.serverOffsets = make(map[string]*offsetWindow)
+		}
+		w := &offsetWindow{}
+		for _, offset := range ss.Offsets {
+			w.add(offset)
+		}
+		n.serverOffsets[serverAddress(ss.Status.Address)] = w
+	}
+	for _, result := range state.History {
+		n.history.add(result)
+	}
+	n.mutex.Unlock()
+
+	if n.serverManager != nil {
+		n.serverManager.restoreState(state.Servers, now)
+	}
+}
+
+// serverState 返回服务器的状态和最近的往返时间样本
+func (sm *ServerManager) serverState(server string) (ServerStatus, []time.Duration) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	status, exists := sm.servers[server]
+	if !exists {
+		return ServerStatus{Address: server}, nil
+	}
+	var rtts []time.Duration
+	if h, ok := sm.health[server]; ok {
+		rtts = h.rtts.values()
+	}
+	return *status, rtts
+}
+
+// restoreState 恢复保存的服务器状态，忽略已不存在的服务器，故障抑制期从now开始计算剩余时长，
+// 然后重新计算评分和排序
+func (sm *ServerManager) restoreState(states []ServerState, now time.Time) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	for _, ss := range states {
+		status, exists := sm.servers[ss.Status.Address]
+		if !exists {
+			continue
+		}
+		*status = ss.Status
+		status.HeldDownUntil = time.Time{}
+		if ss.HeldDown > 0 {
+			status.HeldDownUntil = now.Add(ss.HeldDown)
+		}
+
+		h := sm.healthFor(ss.Status.Address)
+		h.reach = ss.Status.Reach
+		h.rtts = offsetWindow{}
+		for _, rtt := range ss.RTTs {
+			h.rtts.add(rtt)
+		}
+	}
+	sm.reorderServers()
+}
+
+// FileStore 把状态以JSON格式保存在文件中
+// 写入时先写入同一目录下的临时文件再重命名，断电时不会留下不完整的文件
+type FileStore struct {
+	path string
+}
+
+// NewFileStore 创建保存在path的FileStore
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load 实现Store，文件不存在时返回nil和nil
+func (s *FileStore) Load() (*State, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("解析状态文件 %s 失败: %w", s.path, err)
+	}
+	return &state, nil
+}
+
+// Save 实现Store
+func (s *FileStore) Save(state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
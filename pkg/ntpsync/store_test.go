@@ -0,0 +1,264 @@
+package ntpsync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestKissOfDeathDeny 测试收到DENY后在拒绝期内不再向服务器发送请求
+func TestKissOfDeathDeny(t *testing.T) {
+	clock := newFakeClock()
+
+	denied := ntptest.NewServer()
+	defer denied.Close()
+	denied.SetKissCode("DENY")
+	denied.SetNow(clock.Now)
+
+	up := ntptest.NewServer()
+	defer up.Close()
+	up.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers: []string{denied.Addr(), up.Addr()},
+		Timeout: time.Second,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if _, err := ntp.syncWithServerBinary(denied.Addr(), time.Second); !errors.Is(err, ErrKissOfDeath) {
+		t.Fatalf("预期返回ErrKissOfDeath，实际得到%v", err)
+	}
+	until, ok := ntp.DeniedServers()[denied.Addr()]
+	if !ok || !until.Equal(clock.Now().Add(DefaultKissDenyDuration)) {
+		t.Fatalf("预期服务器进入拒绝期，实际得到%v", ntp.DeniedServers())
+	}
+
+	// 拒绝期内同步跳过该服务器
+	clock.Advance(DefaultMinPollInterval)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if got := denied.RequestCount(); got != 1 {
+		t.Errorf("预期拒绝访问的服务器只收到1个请求，实际得到%d个", got)
+	}
+
+	// 拒绝期过后重新尝试
+	denied.SetKissCode("")
+	clock.Advance(DefaultKissDenyDuration)
+	if _, err := ntp.syncWithServerBinary(denied.Addr(), time.Second); err != nil {
+		t.Fatalf("预期拒绝期过后同步成功，实际得到%v", err)
+	}
+	if len(ntp.DeniedServers()) != 0 {
+		t.Errorf("预期拒绝期已过，实际得到%v", ntp.DeniedServers())
+	}
+}
+
+// TestStoreRestoresState 测试重启后从FileStore恢复服务器状态、拒绝名单和同步历史
+func TestStoreRestoresState(t *testing.T) {
+	clock := newFakeClock()
+
+	down := ntptest.NewServer()
+	defer down.Close()
+	down.SetDrop(true)
+
+	denied := ntptest.NewServer()
+	defer denied.Close()
+	denied.SetKissCode("RSTR")
+	denied.SetNow(clock.Now)
+
+	up := ntptest.NewServer()
+	defer up.Close()
+	up.SetNow(clock.Now)
+
+	opts := Options{
+		Servers:           []string{down.Addr(), denied.Addr(), up.Addr()},
+		Timeout:           100 * time.Millisecond,
+		EnableMultiServer: true,
+		HolddownThreshold: 2,
+		HolddownInterval:  time.Hour,
+		Clock:             clock,
+		Store:             NewFileStore(filepath.Join(t.TempDir(), "state.json")),
+	}
+	ntp, err := New(opts)
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	// 第2次同步时可达的服务器也失败，不可达的服务器连续失败2次
+	for i, drop := range []bool{false, true, false} {
+		up.SetDrop(drop)
+		clock.Advance(DefaultMinPollInterval)
+		if err := ntp.Sync(); err != nil && !drop {
+			t.Fatalf("第%d次同步失败: %v", i+1, err)
+		}
+	}
+	if err := ntp.Close(); err != nil {
+		t.Fatalf("关闭时保存状态失败: %v", err)
+	}
+
+	// 重启后不可达的服务器仍然被排除，拒绝访问的服务器仍在拒绝期内
+	restarted, err := New(opts)
+	if err != nil {
+		t.Fatalf("重新创建NTPSync实例失败: %v", err)
+	}
+	defer restarted.Close()
+
+	if !restarted.serverManager.IsHeldDown(down.Addr(), clock.Now()) {
+		t.Error("预期恢复服务器的故障抑制状态")
+	}
+	if _, ok := restarted.DeniedServers()[denied.Addr()]; !ok {
+		t.Error("预期恢复拒绝名单")
+	}
+	status, err := restarted.serverManager.GetServerStatus(up.Addr())
+	if err != nil || status.Reach != 0b101 || status.Score <= 0 {
+		t.Errorf("预期恢复可达性寄存器和评分，实际得到%+v", status)
+	}
+	if got, want := len(restarted.GetHistory(0)), len(ntp.GetHistory(0)); got != want || got == 0 {
+		t.Errorf("预期恢复%d条同步历史，实际得到%d条", want, got)
+	}
+	if restarted.serverJitter(up.Addr()) != ntp.serverJitter(up.Addr()) {
+		t.Error("预期恢复偏移量样本")
+	}
+
+	clock.Advance(DefaultMinPollInterval)
+	if err := restarted.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if down.RequestCount() != 2 || denied.RequestCount() != 1 {
+		t.Errorf("预期重启后不再向被排除的服务器发送请求，实际收到%d和%d个请求",
+			down.RequestCount(), denied.RequestCount())
+	}
+}
+
+// TestFileStoreMissing 测试状态文件不存在时Load返回nil
+func TestFileStoreMissing(t *testing.T) {
+	state, err := NewFileStore(filepath.Join(t.TempDir(), "missing.json")).Load()
+	if err != nil || state != nil {
+		t.Errorf("预期返回nil和nil，实际得到%v和%v", state, err)
+	}
+}
+
+// memStore 是保存在内存中的Store，err非nil时Load返回它
+type memStore struct {
+	state *State
+	err   error
+}
+
+func (s *memStore) Load() (*State, error) { return s.state, s.err }
+
+func (s *memStore) Save(state *State) error {
+	s.state = state
+	return nil
+}
+
+// TestStoreRemainingDurations 测试拒绝期和故障抑制期按剩余时长恢复，
+// 重启后本地时钟还没有同步、比保存时早很多年也不影响
+func TestStoreRemainingDurations(t *testing.T) {
+	const denied, down = "192.0.2.1:123", "192.0.2.2:123"
+
+	clock := newFakeClock()
+	store := &memStore{}
+	opts := Options{
+		Servers:           []string{denied, down},
+		EnableMultiServer: true,
+		HolddownThreshold: 1,
+		HolddownInterval:  time.Hour,
+		Clock:             clock,
+		Store:             store,
+	}
+	ntp, err := New(opts)
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	ntp.denyServer(denied, clock.Now().Add(DefaultKissDenyDuration))
+	if err := ntp.serverManager.RecordFailure(down, clock.Now()); err != nil {
+		t.Fatalf("记录失败: %v", err)
+	}
+	clock.Advance(time.Minute)
+	if err := ntp.Close(); err != nil {
+		t.Fatalf("关闭时保存状态失败: %v", err)
+	}
+
+	if got, want := store.state.Denied[denied], DefaultKissDenyDuration-time.Minute; got != want {
+		t.Errorf("预期保存剩余拒绝期%v，实际得到%v", want, got)
+	}
+	var heldDown time.Duration
+	for _, ss := range store.state.Servers {
+		if ss.Status.Address == down {
+			heldDown = ss.HeldDown
+		}
+	}
+	if heldDown <= 0 || heldDown >= time.Hour {
+		t.Fatalf("预期保存剩余故障抑制期，实际得到%v", heldDown)
+	}
+
+	// 重启后本地时钟回到了2000年
+	rebooted := &fakeClock{now: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	opts.Clock = rebooted
+	restarted, err := New(opts)
+	if err != nil {
+		t.Fatalf("重新创建NTPSync实例失败: %v", err)
+	}
+	defer restarted.Close()
+
+	until, ok := restarted.DeniedServers()[denied]
+	if want := rebooted.Now().Add(DefaultKissDenyDuration - time.Minute); !ok || !until.Equal(want) {
+		t.Errorf("预期拒绝期到%v，实际得到%v", want, until)
+	}
+	now := rebooted.Now()
+	if !restarted.serverManager.IsHeldDown(down, now) || restarted.serverManager.IsHeldDown(down, now.Add(heldDown)) {
+		t.Errorf("预期故障抑制期从重启时开始再持续%v", heldDown)
+	}
+}
+
+// TestStoreSkipsUnknownServers 测试不恢复已不在服务器列表中的服务器提高的最小请求间隔
+func TestStoreSkipsUnknownServers(t *testing.T) {
+	const kept, removed = "192.0.2.1:123", "192.0.2.2:123"
+
+	ntp, err := New(Options{
+		Servers: []string{kept},
+		Store: &memStore{state: &State{
+			MinPoll: map[string]time.Duration{kept: PoolMinSyncInterval, removed: PoolMinSyncInterval},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if got := ntp.RaisedPollIntervals(); len(got) != 1 || got[kept] != PoolMinSyncInterval {
+		t.Errorf("预期只恢复%s的间隔，实际得到%v", kept, got)
+	}
+}
+
+// TestStoreLoadFailed 测试状态文件损坏时丢弃保存的状态，实例照常创建
+func TestStoreLoadFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"saved": "garbage"`), 0o644); err != nil {
+		t.Fatalf("写入状态文件失败: %v", err)
+	}
+
+	var loadErr error
+	ntp, err := New(Options{
+		Servers:           []string{"192.0.2.1:123"},
+		Store:             NewFileStore(path),
+		OnStateLoadFailed: func(err error) { loadErr = err },
+	})
+	if err != nil {
+		t.Fatalf("预期丢弃损坏的状态文件，实际创建失败: %v", err)
+	}
+	defer ntp.Close()
+
+	var syntaxErr *json.SyntaxError
+	if !errors.As(loadErr, &syntaxErr) {
+		t.Errorf("预期通知解析错误，实际得到%v", loadErr)
+	}
+}
@@ -0,0 +1,79 @@
+package ntpsync
+
+import (
+	"time"
+)
+
+// 休眠检测的参数
+const (
+	// SuspendCheckInterval 是比较系统时间和单调时钟的间隔
+	SuspendCheckInterval = 10 * time.Second
+
+	// SuspendThreshold 是判定发生了休眠的时长，两次检查之间启动时钟比单调时钟
+	// 多走的时长超过该值时，认为系统经历了休眠或虚拟机暂停
+	SuspendThreshold = 5 * time.Second
+)
+
+// watchClock 定期比较系统时间、单调时钟和启动时钟，按clockChanges分别判断休眠和系统时钟被调整。
+// suspend为true时发现休眠后立即重新同步，step为true时发现系统时钟被外部调整后
+// 修正偏移量并立即重新同步；实例关闭时返回。
+// 比较的基准是n.clockCheck，同步、休眠恢复和UpdateSystemTime处理过的变化都会更新它，不会被重复计入
+func (n *NTPSync) watchClock(suspend, step bool) {
+	ctx := n.context()
+	n.mutex.Lock()
+	if n.clockCheck.local.IsZero() {
+		n.clockCheck = readClock(n.clock)
+	}
+	n.mutex.Unlock()
+
+	for {
+		timer := n.clock.NewTimer(SuspendCheckInterval)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			stopTimer(timer)
+			return
+		}
+
+		// 不检测调整时保留基准，休眠时长从上一次同步开始累计
+		now := readClock(n.clock)
+		n.mutex.Lock()
+		prev := n.clockCheck
+		if step {
+			n.clockCheck = now
+		}
+		n.mutex.Unlock()
+
+		suspended, stepped := clockChanges(prev, now)
+		if suspend && suspended > SuspendThreshold {
+			n.resume(suspended)
+		}
+		if step && absDuration(stepped) > ClockStepThreshold {
+			n.clockStepped(now, stepped)
+		}
+	}
+}
+
+// resume 处理一次持续gap的休眠
+// 锚定在单调时钟上的Now和LastSyncAge都少算了休眠的时长，先按系统时间修正，
+// 在重新同步成功之前IsSynchronized会把休眠时长计入同步的时效
+func (n *NTPSync) resume(gap time.Duration) {
+	n.mutex.Lock()
+	if !n.lastSync.IsZero() {
+		n.suspendedSinceSync += gap
+	}
+	// 休眠期间单调时钟停止，已有样本的时间间隔不再可比
+	n.drift.reset()
+	n.resetEstimatorLocked()
+	n.clockCheck = readClock(n.clock)
+	n.monotonic.resume(gap)
+	n.publishLocked()
+	n.mutex.Unlock()
+
+	n.emit(Event{
+		Type:      EventResumed,
+		Suspended: gap,
+	})
+
+	n.resync()
+}
@@ -0,0 +1,117 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestClockChanges 测试分别计算休眠时长和系统时钟的调整量，以及没有启动时钟时的判断
+func TestClockChanges(t *testing.T) {
+	now := time.Now()
+	prev := clockReading{local: now, wall: now.Round(0), boot: time.Hour, hasBoot: true}
+	tests := []struct {
+		name               string
+		wall, mono, boot   time.Duration
+		suspended, stepped time.Duration
+	}{
+		{"没有变化", time.Minute, time.Minute, time.Minute, 0, 0},
+		{"休眠", 3 * time.Hour, time.Minute, 3 * time.Hour, 3*time.Hour - time.Minute, 0},
+		{"向前大幅调整", time.Minute + time.Hour, time.Minute, time.Minute, 0, time.Hour},
+		{"向后调整", time.Minute - 2*time.Second, time.Minute, time.Minute, 0, -2 * time.Second},
+		{"休眠期间被调整", 2 * time.Hour, time.Minute, time.Hour, time.Hour - time.Minute, time.Hour},
+	}
+	for _, tt := range tests {
+		next := clockReading{local: now.Add(tt.mono), wall: prev.wall.Add(tt.wall), boot: prev.boot + tt.boot, hasBoot: true}
+		if suspended, stepped := clockChanges(prev, next); suspended != tt.suspended || stepped != tt.stepped {
+			t.Errorf("%s: 预期休眠%v、调整%v，实际得到%v和%v", tt.name, tt.suspended, tt.stepped, suspended, stepped)
+		}
+	}
+
+	// 没有启动时钟时只能按SuspendThreshold判断
+	next := clockReading{local: now.Add(time.Minute), wall: prev.wall.Add(time.Hour)}
+	if suspended, stepped := clockChanges(prev, next); suspended != time.Hour-time.Minute || stepped != 0 {
+		t.Errorf("预期没有启动时钟时大幅前进被当作休眠，实际得到%v和%v", suspended, stepped)
+	}
+	next.wall = prev.wall.Add(time.Minute + time.Second)
+	if suspended, stepped := clockChanges(prev, next); suspended != 0 || stepped != time.Second {
+		t.Errorf("预期没有启动时钟时小幅前进被当作调整，实际得到%v和%v", suspended, stepped)
+	}
+}
+
+// TestResume 测试从休眠中恢复后修正Now和同步时效，并立即重新同步
+func TestResume(t *testing.T) {
+	clock := newFakeClock()
+
+	server := ntptest.NewServer()
+	defer server.Close()
+	server.SetNow(clock.Now)
+	server.SetOffset(2 * time.Second)
+
+	ntp, err := New(Options{
+		Servers:         []string{server.Addr()},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	events, cancel := ntp.Subscribe(0)
+	defer cancel()
+
+	// 假时钟没有单调时钟读数，模拟单调时钟少算了3小时
+	before := ntp.Now()
+	server.SetDrop(true)
+	ntp.resume(3 * time.Hour)
+
+	if got := ntp.Now().Sub(before); got < 3*time.Hour {
+		t.Errorf("预期Now计入休眠时长，实际前进了%v", got)
+	}
+	if got := ntp.LastSyncAge(); got < 3*time.Hour {
+		t.Errorf("预期同步时效计入休眠时长，实际得到%v", got)
+	}
+	if ntp.IsSynchronized(time.Hour) {
+		t.Error("预期休眠后偏移量不再可信")
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != EventResumed || event.Suspended != 3*time.Hour {
+			t.Errorf("预期发布休眠恢复事件，实际得到%+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待休眠恢复事件超时")
+	}
+
+	// 后台的重新同步因丢包失败，之后的同步不再与它合并
+	waitForRequests(t, server, 2)
+	select {
+	case event := <-events:
+		if event.Type != EventSyncFailed {
+			t.Errorf("预期重新同步失败，实际得到%+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待重新同步失败超时")
+	}
+
+	// 重新同步成功后以新的测量为准
+	server.SetDrop(false)
+	clock.Advance(time.Second)
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if got := ntp.LastSyncAge(); got > time.Minute {
+		t.Errorf("预期重新同步后清除休眠时长，实际得到%v", got)
+	}
+	if got, want := ntp.Now(), clock.Now().Add(2*time.Second); got.Sub(want).Abs() > 10*time.Millisecond {
+		t.Errorf("预期重新同步后Now为%v，实际得到%v", want, got)
+	}
+}
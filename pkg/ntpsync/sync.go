@@ -1,7 +1,7 @@
 package ntpsync
 
 import (
-	"encoding/binary"
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -16,7 +16,7 @@ func (n *NTPSync) syncWithServer(server string, timeout time.Duration) (*SyncRes
 	}
 
 	// 创建UDP连接
-	conn, err := net.DialTimeout("udp", server, timeout)
+	conn, err := n.dial(context.Background(), server, timeout)
 	if err != nil {
 		return nil, fmt.Errorf("连接NTP服务器 %s 失败: %v", server, err)
 	}
@@ -31,15 +31,24 @@ func (n *NTPSync) syncWithServer(server string, timeout time.Duration) (*SyncRes
 	req := createNTPPacket()
 	t1 := time.Now() // 发送请求的时间
 	
-	if err := binary.Write(conn, binary.BigEndian, req); err != nil {
+	reqBytes, err := req.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(reqBytes); err != nil {
 		return nil, fmt.Errorf("发送NTP请求失败: %v", err)
 	}
 
 	// 接收响应
-	resp := &NTPPacket{}
-	if err := binary.Read(conn, binary.BigEndian, resp); err != nil {
+	buf := make([]byte, maxPacketSize)
+	bytesRead, err := conn.Read(buf)
+	if err != nil {
 		return nil, fmt.Errorf("读取NTP响应失败: %v", err)
 	}
+	resp := &NTPPacket{}
+	if err := resp.UnmarshalBinary(buf[:bytesRead]); err != nil {
+		return nil, err
+	}
 	
 	t4 := time.Now() // 接收响应的时间
 
@@ -49,8 +58,8 @@ func (n *NTPSync) syncWithServer(server string, timeout time.Duration) (*SyncRes
 	}
 
 	// 计算时间
-	t2 := ntpTimeToTime(resp.RxTimeSec, resp.RxTimeFrac)
-	t3 := ntpTimeToTime(resp.TxTimeSec, resp.TxTimeFrac)
+	t2 := ntpTimeToTime(resp.RxTimeSec, resp.RxTimeFrac, t1)
+	t3 := ntpTimeToTime(resp.TxTimeSec, resp.TxTimeFrac, t1)
 
 	// 计算偏移量和往返延迟
 	// 偏移量 = ((T2 - T1) + (T3 - T4)) / 2
@@ -64,11 +73,22 @@ func (n *NTPSync) syncWithServer(server string, timeout time.Duration) (*SyncRes
 	}
 
 	result := &SyncResult{
-		Server:  server,
-		Time:    time.Now().Add(offset),
-		Offset:  offset,
-		RTT:     rtt,
-		Stratum: resp.Stratum,
+		Server:         server,
+		Time:           time.Now().Add(offset),
+		Offset:         offset,
+		RTT:            rtt,
+		Stratum:        resp.Stratum,
+		RootDelay:      fixedPoint(resp.RootDelay, 16),
+		RootDispersion: fixedPoint(resp.RootDispersion, 16),
+		Precision:      parsePrecision(byte(resp.Precision)),
+		Poll:           parsePoll(byte(resp.Poll)),
+		Timestamps: &Timestamps{
+			Originate:   t1,
+			Receive:     t2,
+			Transmit:    t3,
+			Destination: t4,
+			Reference:   referenceTimestamp(resp.RefTimeSec, resp.RefTimeFrac, t1),
+		},
 	}
 
 	return result, nil
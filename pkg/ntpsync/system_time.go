@@ -4,84 +4,163 @@ package ntpsync
 import (
 	"errors"
 	"fmt"
-	"os/exec"
-	"runtime"
+	"time"
 )
 
+// 设置系统时间的错误
+var (
+	// ErrTimePermission 表示进程没有设置系统时间的权限，CanSetSystemTime返回的错误包含具体原因
+	ErrTimePermission = errors.New("没有设置系统时间的权限")
+
+	// ErrSystemTimeUnsupported 表示当前平台或构建方式不支持设置系统时间
+	ErrSystemTimeUnsupported = errors.New("不支持的操作系统")
+
+	// ErrStepVetoed 表示Options.BeforeStep拒绝了调整，系统时间没有改变
+	ErrStepVetoed = errors.New("调整系统时间被BeforeStep拒绝")
+
+	// ErrStepVerification 表示设置之后的系统时间与预期不符，系统时间已经恢复为调整前的时间线
+	ErrStepVerification = errors.New("调整后的系统时间与预期不符")
+)
+
+// SystemTimeStep 是UpdateSystemTime对系统时间的一次调整
+type SystemTimeStep struct {
+	// From 是调整前的系统时间
+	From time.Time
+
+	// To 是要设置的校准后的时间
+	To time.Time
+
+	// Offset 是调整量，即To减去From，正值表示向前调整
+	Offset time.Duration
+}
+
+// systemTimeSetter 检查权限并设置系统时间，测试中替换为不改变系统时钟的实现
+type systemTimeSetter interface {
+	check() error
+	set(t time.Time) error
+}
+
+// osSystemTime 通过操作系统设置系统时间
+type osSystemTime struct{}
+
+// check 调用CanSetSystemTime
+func (osSystemTime) check() error {
+	return CanSetSystemTime()
+}
+
+// set 调用setSystemTime
+func (osSystemTime) set(t time.Time) error {
+	return setSystemTime(t)
+}
+
 // UpdateSystemTime 使用NTP同步的时间更新系统时间
-// 注意：此操作通常需要root/管理员权限
+// 注意：此操作通常需要root/管理员权限。Linux、macOS和illumos默认通过date命令设置，Windows通过PowerShell，
+// FreeBSD、OpenBSD、NetBSD和DragonFly通过settimeofday系统调用；使用TinyGo编译或者指定ntpsync_noexec构建标签时
+// 不运行外部命令，Linux和macOS也改用settimeofday，其它平台返回错误。
+// 设置之前先调用CanSetSystemTime，没有权限时返回包装ErrTimePermission的错误；
+// 设置了Options.OnTimeDaemonConflict或RefuseOnTimeDaemonConflict时还会检测其它时间同步守护进程。
+//
+// 调整分为两个阶段：先调用Options.BeforeStep，使对时间敏感的程序暂停，它返回错误时不调整；
+// 然后设置系统时间并按单调时钟检查系统时间确实调整了预期的量，不符时恢复为调整前的时间线，
+// 返回包装ErrStepVerification的错误。最后调用Options.AfterStep，并发布EventSystemTimeSet事件，
+// 失败时发布EventSystemTimeFailed事件。调整之后偏移量减去实际的调整量，Now保持连续
 func (n *NTPSync) UpdateSystemTime() error {
+	if err := n.systemTime.check(); err != nil {
+		return fmt.Errorf("无法更新系统时间: %w", err)
+	}
+	if err := n.checkTimeDaemons(); err != nil {
+		return fmt.Errorf("无法更新系统时间: %w", err)
+	}
+
 	n.mutex.RLock()
-	defer n.mutex.RUnlock()
+	synced := !n.lastSync.IsZero()
+	beforeStep, afterStep := n.beforeStep, n.afterStep
+	n.mutex.RUnlock()
 
 	// 首先确保我们有有效的时间偏移量
-	if n.LastSync.IsZero() {
-		// 尝试同步
+	if !synced {
 		if err := n.Sync(); err != nil {
 			return fmt.Errorf("无法同步NTP时间: %w", err)
 		}
 	}
 
-	// 获取当前NTP调整后的时间
-	ntpTime := n.Now()
-
-	// 根据操作系统设置系统时间
-	switch runtime.GOOS {
-	case "linux", "darwin":
-		// 使用date命令设置时间 (需要root权限)
-		// 格式: MMDDhhmm[[CC]YY][.ss]
-		timeStr := ntpTime.Format("010215042006.05")
-		cmd := exec.Command("date", timeStr)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("设置系统时间失败: %w, 输出: %s", err, output)
+	if beforeStep != nil {
+		if err := beforeStep(n.pendingStep(readClock(n.clock))); err != nil {
+			return fmt.Errorf("%w: %v", ErrStepVetoed, err)
 		}
-
-	case "windows":
-		// 使用PowerShell设置时间 (需要管理员权限)
-		dateStr := ntpTime.Format("01/02/2006")
-		timeStr := ntpTime.Format("15:04:05")
-		cmd := exec.Command("powershell", "-Command",
-			fmt.Sprintf("Set-Date -Date '%s %s'", dateStr, timeStr))
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("设置系统时间失败: %w, 输出: %s", err, output)
-		}
-
-	default:
-		return errors.New("不支持的操作系统")
 	}
 
+	// BeforeStep可能花费一些时间，重新计算要设置的时间
+	step, err := n.stepSystemTime()
+	if afterStep != nil {
+		afterStep(step, err)
+	}
+	if err != nil {
+		n.emit(Event{Type: EventSystemTimeFailed, Offset: step.Offset, Error: err})
+		return err
+	}
+	n.emit(Event{Type: EventSystemTimeSet, Offset: step.Offset})
 	return nil
 }
 
-// IsRootUser 检查当前进程是否具有root/管理员权限
-// 这个函数可以用来在尝试更新系统时间前检查权限
-func IsRootUser() bool {
-	switch runtime.GOOS {
-	case "linux", "darwin":
-		// 在Unix系统上，尝试运行一个需要root权限的简单命令
-		cmd := exec.Command("id", "-u")
-		output, err := cmd.Output()
-		if err != nil {
-			return false
-		}
+// pendingStep 返回在时钟读数为before时把系统时间设置为校准后的时间需要的调整
+func (n *NTPSync) pendingStep(before clockReading) SystemTimeStep {
+	to := n.Now().Round(0)
+	return SystemTimeStep{From: before.wall, To: to, Offset: to.Sub(before.wall)}
+}
 
-		// root用户的ID是0
-		return string(output) == "0\n"
+// stepSystemTime 把系统时间设置为校准后的时间并检查结果。设置前后系统时间的变化减去单调时钟经过的时长
+// 就是实际的调整量，与预期的调整量之差超过设置的精度加上ClockStepThreshold时，
+// 认为设置没有正确生效或被其它程序干扰，把系统时间恢复为调整前的时间线。
+// 无论成功与否，都按最终实际的调整量修正偏移量
+func (n *NTPSync) stepSystemTime() (SystemTimeStep, error) {
+	before := readClock(n.clock)
+	step := n.pendingStep(before)
+	if err := n.systemTime.set(step.To); err != nil {
+		return step, err
+	}
 
-	case "windows":
-		// 在Windows上检查是否有管理员权限
-		cmd := exec.Command("powershell", "-Command",
-			"[bool](([System.Security.Principal.WindowsIdentity]::GetCurrent()).groups -match 'S-1-5-32-544')")
-		output, err := cmd.Output()
-		if err != nil {
-			return false
-		}
+	after, jump := n.absorbSystemStep(before)
+	if absDuration(jump-step.Offset) <= systemTimeResolution+ClockStepThreshold {
+		return step, nil
+	}
 
-		return string(output) == "True\n"
+	err := fmt.Errorf("%w: 系统时间调整了%v，预期%v", ErrStepVerification, jump, step.Offset)
+	now := readClock(n.clock)
+	if rollbackErr := n.systemTime.set(step.From.Add(now.local.Sub(before.local))); rollbackErr != nil {
+		return step, fmt.Errorf("%w，恢复调整前的时间失败: %v", err, rollbackErr)
+	}
+	n.absorbSystemStep(after)
+	return step, err
+}
 
-	default:
-		return false
+// absorbSystemStep 返回此刻的时钟读数和系统时间自before以来被调整的量，并修正偏移量和已有的样本，
+// 使Now保持连续。调整发生在这段很短的时间内，不按clockChanges判断是否休眠
+func (n *NTPSync) absorbSystemStep(before clockReading) (clockReading, time.Duration) {
+	now := readClock(n.clock)
+	jump := now.wall.Sub(before.wall) - now.local.Sub(before.local)
+
+	n.mutex.Lock()
+	n.absorbStepLocked(now, jump)
+	n.mutex.Unlock()
+	return now, jump
+}
+
+// CanSetSystemTime 检查当前进程能否设置系统时间，不能时返回原因
+// Linux检查进程是否有CAP_SYS_TIME能力，因此以root运行但被去掉了该能力的容器会被发现，
+// 通过setcap授予了该能力的普通用户也可以设置；其它Unix系统检查有效用户ID是否为root；
+// Windows检查进程令牌是否已提升为管理员。都不需要运行外部命令。
+// 没有权限时返回包装ErrTimePermission的错误，当前平台不支持时返回ErrSystemTimeUnsupported
+func CanSetSystemTime() error {
+	if !systemTimeSupported {
+		return ErrSystemTimeUnsupported
 	}
+	return canSetSystemTime()
+}
+
+// IsRootUser 检查当前进程是否具有设置系统时间所需的root/管理员权限
+//
+// Deprecated: 使用CanSetSystemTime，它同时说明了不能设置的原因
+func IsRootUser() bool {
+	return CanSetSystemTime() == nil
 }
@@ -0,0 +1,28 @@
+//go:build !tinygo && !ntpsync_noexec && (linux || darwin || solaris)
+
+package ntpsync
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// systemTimeSupported 表示当前平台能否设置系统时间
+const systemTimeSupported = true
+
+// systemTimeResolution 是设置系统时间的精度，date命令只能精确到秒
+const systemTimeResolution = time.Second
+
+// setSystemTime 使用date命令将系统时间设置为ntpTime (需要root权限)
+// Linux、macOS和illumos的date都接受这种格式
+func setSystemTime(ntpTime time.Time) error {
+	// 格式: MMDDhhmm[[CC]YY][.ss]
+	timeStr := ntpTime.Format("010215042006.05")
+	cmd := exec.Command("date", timeStr)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("设置系统时间失败: %w, 输出: %s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd) && (tinygo || ntpsync_noexec || !(solaris || windows))
+
+package ntpsync
+
+import "time"
+
+// systemTimeSupported 表示当前平台能否设置系统时间，
+// 不运行外部命令的构建中的Windows和illumos也不支持
+const systemTimeSupported = false
+
+// systemTimeResolution 是设置系统时间的精度，不支持设置时没有意义
+const systemTimeResolution = 0
+
+// setSystemTime 在不支持设置系统时间的平台上返回ErrSystemTimeUnsupported
+func setSystemTime(ntpTime time.Time) error {
+	return ErrSystemTimeUnsupported
+}
@@ -0,0 +1,25 @@
+//go:build dragonfly || freebsd || netbsd || openbsd || ((tinygo || ntpsync_noexec) && (linux || darwin))
+
+package ntpsync
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// systemTimeSupported 表示当前平台能否设置系统时间
+const systemTimeSupported = true
+
+// systemTimeResolution 是设置系统时间的精度，settimeofday精确到微秒
+const systemTimeResolution = time.Microsecond
+
+// setSystemTime 通过settimeofday系统调用将系统时间设置为ntpTime，不依赖外部命令
+// BSD总是使用这种方式；Linux和macOS只在不运行外部命令的构建中使用
+func setSystemTime(ntpTime time.Time) error {
+	tv := syscall.NsecToTimeval(ntpTime.UnixNano())
+	if err := syscall.Settimeofday(&tv); err != nil {
+		return fmt.Errorf("设置系统时间失败: %w", err)
+	}
+	return nil
+}
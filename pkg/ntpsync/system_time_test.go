@@ -1,8 +1,11 @@
 package ntpsync
 
 import (
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
 )
 
 // TestIsRootUser 测试权限检查功能
@@ -15,6 +18,18 @@ func TestIsRootUser(t *testing.T) {
 	t.Logf("当前进程是否有root/管理员权限: %v", isRoot)
 }
 
+// TestCanSetSystemTime 测试权限检查与IsRootUser一致，不能设置时说明原因
+func TestCanSetSystemTime(t *testing.T) {
+	err := CanSetSystemTime()
+	if (err == nil) != IsRootUser() {
+		t.Errorf("预期IsRootUser与CanSetSystemTime一致，CanSetSystemTime返回%v", err)
+	}
+	if err != nil && !errors.Is(err, ErrTimePermission) && !errors.Is(err, ErrSystemTimeUnsupported) {
+		t.Errorf("预期返回ErrTimePermission或ErrSystemTimeUnsupported，实际得到%v", err)
+	}
+	t.Logf("能否设置系统时间: %v", err)
+}
+
 // TestUpdateSystemTime 测试更新系统时间功能
 // 注意：这个测试不会实际更新系统时间，只检查函数逻辑
 func TestUpdateSystemTime(t *testing.T) {
@@ -33,8 +48,8 @@ func TestUpdateSystemTime(t *testing.T) {
 	}
 
 	// 设置一个已知的偏移量
-	ntp.TimeOffset = 5 * time.Second
-	ntp.LastSync = time.Now()
+	ntp.timeOffset = 5 * time.Second
+	ntp.lastSync = time.Now()
 
 	// 检查是否有root权限
 	isRoot := IsRootUser()
@@ -51,3 +66,181 @@ func TestUpdateSystemTime(t *testing.T) {
 		t.Log("没有root/管理员权限，无法更新系统时间")
 	}
 }
+
+// fakeSystemTime 调整假时钟的系统时间，单调时钟不变，skew模拟设置之后系统时间与预期不符
+type fakeSystemTime struct {
+	clock *fakeClock
+	skew  time.Duration
+	err   error
+	sets  []time.Time
+}
+
+// check 总是有权限
+func (f *fakeSystemTime) check() error {
+	return nil
+}
+
+// set 把假时钟的系统时间调整到t加上skew
+func (f *fakeSystemTime) set(t time.Time) error {
+	f.sets = append(f.sets, t)
+	if f.err != nil {
+		return f.err
+	}
+	f.clock.Step(t.Add(f.skew).Sub(f.clock.Wall()))
+	f.skew = 0
+	return nil
+}
+
+// TestUpdateSystemTimeSteps 测试调整系统时间的两个阶段：BeforeStep可以拒绝调整，
+// 调整后检查实际的调整量，不符时恢复原来的时间线，成功时修正偏移量使Now保持连续
+func TestUpdateSystemTimeSteps(t *testing.T) {
+	clock := newFakeClock()
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(3 * time.Second)
+
+	var veto error
+	var before []SystemTimeStep
+	var afterErrs []error
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		MinPollInterval: -1,
+		Clock:           clock,
+		BeforeStep: func(step SystemTimeStep) error {
+			before = append(before, step)
+			return veto
+		},
+		AfterStep: func(step SystemTimeStep, err error) {
+			afterErrs = append(afterErrs, err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	system := &fakeSystemTime{clock: clock}
+	ntp.systemTime = system
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	events, cancel := ntp.Subscribe(0)
+	defer cancel()
+
+	// BeforeStep拒绝时不调整
+	veto = errors.New("数据库正在写入")
+	if err := ntp.UpdateSystemTime(); !errors.Is(err, ErrStepVetoed) {
+		t.Fatalf("预期返回ErrStepVetoed，实际得到%v", err)
+	}
+	if len(before) != 1 || absDuration(before[0].Offset-3*time.Second) > time.Millisecond {
+		t.Errorf("预期BeforeStep收到约3秒的调整，实际得到%+v", before)
+	}
+	if len(system.sets) != 0 || len(afterErrs) != 0 {
+		t.Errorf("预期拒绝后不设置系统时间也不调用AfterStep，实际设置%v", system.sets)
+	}
+	veto = nil
+
+	// 设置之后系统时间多走了5秒，检查不通过，恢复原来的时间线
+	system.skew = 5 * time.Second
+	now := ntp.Now()
+	wall := clock.Wall()
+	if err := ntp.UpdateSystemTime(); !errors.Is(err, ErrStepVerification) {
+		t.Fatalf("预期返回ErrStepVerification，实际得到%v", err)
+	}
+	if len(system.sets) != 2 || !clock.Wall().Equal(wall) {
+		t.Errorf("预期恢复为调整前的系统时间%v，实际为%v", wall, clock.Wall())
+	}
+	if len(afterErrs) != 1 || !errors.Is(afterErrs[0], ErrStepVerification) {
+		t.Errorf("预期AfterStep收到检查失败的错误，实际得到%v", afterErrs)
+	}
+	if ev := <-events; ev.Type != EventSystemTimeFailed || ev.Error == nil {
+		t.Errorf("预期EventSystemTimeFailed事件，实际得到%+v", ev)
+	}
+	if d := ntp.Now().Sub(now); absDuration(d) > time.Millisecond {
+		t.Errorf("预期Now保持不变，实际变化了%v", d)
+	}
+
+	// 调整成功后偏移量约为0，Now保持连续
+	if err := ntp.UpdateSystemTime(); err != nil {
+		t.Fatalf("调整系统时间失败: %v", err)
+	}
+	if d := clock.Wall().Sub(wall); absDuration(d-3*time.Second) > time.Millisecond {
+		t.Errorf("预期系统时间向前调整3秒，实际调整了%v", d)
+	}
+	if offset := ntp.TimeOffsetDuration(); absDuration(offset) > time.Millisecond {
+		t.Errorf("预期调整后偏移量约为0，实际得到%v", offset)
+	}
+	if d := ntp.Now().Sub(now); absDuration(d) > time.Millisecond {
+		t.Errorf("预期Now保持不变，实际变化了%v", d)
+	}
+	if len(afterErrs) != 2 || afterErrs[1] != nil {
+		t.Errorf("预期AfterStep收到nil，实际得到%v", afterErrs)
+	}
+	if ev := <-events; ev.Type != EventSystemTimeSet || absDuration(ev.Offset-3*time.Second) > time.Millisecond {
+		t.Errorf("预期EventSystemTimeSet事件，实际得到%+v", ev)
+	}
+
+	// 设置失败时也调用AfterStep并发布事件
+	system.err = errors.New("权限不足")
+	if err := ntp.UpdateSystemTime(); err != system.err {
+		t.Fatalf("预期返回设置的错误，实际得到%v", err)
+	}
+	if len(afterErrs) != 3 || afterErrs[2] != system.err {
+		t.Errorf("预期AfterStep收到设置的错误，实际得到%v", afterErrs)
+	}
+	if ev := <-events; ev.Type != EventSystemTimeFailed {
+		t.Errorf("预期EventSystemTimeFailed事件，实际得到%+v", ev)
+	}
+}
+
+// TestUpdateSystemTimeDetectSuspend 测试UpdateSystemTime的调整不会在之后的检查中被当作休眠
+func TestUpdateSystemTimeDetectSuspend(t *testing.T) {
+	clock := newFakeClock()
+	// 没有启动时钟时，系统时间比单调时钟多走SuspendThreshold以上就会被当作休眠
+	clock.noBoot = true
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(time.Hour)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		MinPollInterval: -1,
+		DetectSuspend:   true,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+	ntp.systemTime = &fakeSystemTime{clock: clock}
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	events, cancel := ntp.Subscribe(0)
+	defer cancel()
+
+	now := ntp.Now()
+	if err := ntp.UpdateSystemTime(); err != nil {
+		t.Fatalf("调整系统时间失败: %v", err)
+	}
+	<-events
+
+	// 等检查的定时器触发并重新创建，检查已经完成
+	clock.waitForTimers(t, 1)
+	clock.Advance(SuspendCheckInterval)
+	clock.waitForTimers(t, 1)
+	select {
+	case ev := <-events:
+		t.Errorf("预期系统时间的调整不被当作休眠，实际得到%+v", ev)
+	default:
+	}
+	if d := ntp.Now().Sub(now); absDuration(d-SuspendCheckInterval) > time.Millisecond {
+		t.Errorf("预期Now前进%v，实际前进了%v", SuspendCheckInterval, d)
+	}
+	if age := ntp.LastSyncAge(); age != SuspendCheckInterval {
+		t.Errorf("预期同步时效为%v，实际得到%v", SuspendCheckInterval, age)
+	}
+}
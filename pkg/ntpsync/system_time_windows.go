@@ -0,0 +1,28 @@
+//go:build windows && !tinygo && !ntpsync_noexec
+
+package ntpsync
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// systemTimeSupported 表示当前平台能否设置系统时间
+const systemTimeSupported = true
+
+// systemTimeResolution 是设置系统时间的精度，Set-Date只精确到秒
+const systemTimeResolution = time.Second
+
+// setSystemTime 使用PowerShell将系统时间设置为ntpTime (需要管理员权限)
+func setSystemTime(ntpTime time.Time) error {
+	dateStr := ntpTime.Format("01/02/2006")
+	timeStr := ntpTime.Format("15:04:05")
+	cmd := exec.Command("powershell", "-Command",
+		fmt.Sprintf("Set-Date -Date '%s %s'", dateStr, timeStr))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("设置系统时间失败: %w, 输出: %s", err, output)
+	}
+	return nil
+}
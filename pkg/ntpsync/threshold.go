@@ -0,0 +1,73 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 偏移量阈值的推荐值，与ntpd的默认值相同
+// 零值的Options不启用这两个阈值，以保持原有的行为
+const (
+	// DefaultMaxOffset 是推荐的MaxOffset，相当于ntpd的panic阈值
+	DefaultMaxOffset = 1000 * time.Second
+
+	// DefaultStepThreshold 是推荐的StepThreshold，相当于ntpd的step阈值
+	DefaultStepThreshold = 128 * time.Millisecond
+)
+
+// ErrOffsetTooLarge 表示偏移量超过了MaxOffset，同步结果没有被应用
+var ErrOffsetTooLarge = errors.New("偏移量超过允许的最大值")
+
+// thresholds 是偏移量的调整阈值
+type thresholds struct {
+	// maxOffset 是允许应用的最大偏移量，不大于0表示不限制
+	maxOffset time.Duration
+
+	// stepThreshold 是直接调整的阈值，变化小于此值时逐渐调整，不大于0表示总是直接调整
+	stepThreshold time.Duration
+
+	// allowLargeFirstOffset 表示首次同步不受maxOffset限制
+	allowLargeFirstOffset bool
+}
+
+// exceedsMaxOffsetLocked 判断偏移量相对当前偏移量的变化是否超过了允许的最大值，调用者必须持有n.mutex。
+// 本库不调整系统时钟，RTC误差较大的设备每次测得的偏移量都很大，只能比较与已应用偏移量的差
+func (n *NTPSync) exceedsMaxOffsetLocked(offset time.Duration) bool {
+	if n.thresholds.maxOffset <= 0 {
+		return false
+	}
+	if n.thresholds.allowLargeFirstOffset && n.lastSync.IsZero() {
+		return false
+	}
+	return absDuration(offset-n.timeOffset) > n.thresholds.maxOffset
+}
+
+// rejectLargeOffsetLocked 记录一次超过最大值的偏移量，释放n.mutex并发布事件
+func (n *NTPSync) rejectLargeOffsetLocked(result *SyncResult) error {
+	err := fmt.Errorf("%w: 服务器 %s 的偏移量 %v 超过 %v", ErrOffsetTooLarge, result.Server, result.Offset, n.thresholds.maxOffset)
+	rejected := *result
+	rejected.Rejected = true
+	n.history.add(rejected)
+	n.rejectSelectionLocked(result, err)
+	n.mutex.Unlock()
+
+	n.emit(Event{
+		Type:   EventOffsetTooLarge,
+		Server: result.Server,
+		Offset: result.Offset,
+		Error:  err,
+	})
+	return err
+}
+
+// adjustLocked 将新的偏移量应用到Now，调用者必须持有n.mutex
+// 首次同步和变化不小于stepThreshold时直接调整，否则逐渐调整
+func (n *NTPSync) adjustLocked(local time.Time, previous, offset time.Duration, first bool) {
+	step := n.thresholds.stepThreshold
+	if first || step <= 0 || absDuration(offset-previous) >= step {
+		n.monotonic.anchor(local, offset)
+		return
+	}
+	n.monotonic.slew(local, offset)
+}
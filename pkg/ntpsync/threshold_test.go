@@ -0,0 +1,153 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestMaxOffset 测试超过MaxOffset的偏移量被拒绝，以及首次同步的例外
+func TestMaxOffset(t *testing.T) {
+	ntp, err := New(Options{
+		Servers:   []string{"127.0.0.1:1"},
+		Clock:     newFakeClock(),
+		MaxOffset: DefaultMaxOffset,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	events, unsubscribe := ntp.Subscribe(0)
+	defer unsubscribe()
+
+	err = ntp.SyncWithSource(context.Background(), &fakeSource{offset: -2 * time.Hour})
+	if !errors.Is(err, ErrOffsetTooLarge) {
+		t.Fatalf("预期返回ErrOffsetTooLarge，实际得到%v", err)
+	}
+	if offset := ntp.TimeOffsetDuration(); offset != 0 {
+		t.Errorf("预期偏移量没有被应用，实际得到%v", offset)
+	}
+	if ev := <-events; ev.Type != EventOffsetTooLarge || ev.Offset != -2*time.Hour {
+		t.Errorf("预期EventOffsetTooLarge事件，实际得到%+v", ev)
+	}
+	if stats := ntp.GetHistoryStats(); stats.Rejected != 1 {
+		t.Errorf("预期历史中有1次被拒绝的同步，实际得到%+v", stats)
+	}
+
+	// 首次同步不受限制，之后仍然受限
+	ntp, err = New(Options{
+		Servers:               []string{"127.0.0.1:1"},
+		Clock:                 newFakeClock(),
+		MaxOffset:             DefaultMaxOffset,
+		AllowLargeFirstOffset: true,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: -2 * time.Hour}); err != nil {
+		t.Fatalf("预期首次同步不受MaxOffset限制，实际得到%v", err)
+	}
+	err = ntp.SyncWithSource(context.Background(), &fakeSource{offset: 2 * time.Hour})
+	if !errors.Is(err, ErrOffsetTooLarge) {
+		t.Errorf("预期第二次同步返回ErrOffsetTooLarge，实际得到%v", err)
+	}
+}
+
+// TestMaxOffsetPersistent 测试RTC误差超过MaxOffset时，首次同步之后比较的是与当前偏移量的差
+func TestMaxOffsetPersistent(t *testing.T) {
+	clock := newFakeClock()
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetOffset(-2 * time.Hour)
+
+	ntp, err := New(Options{
+		Servers:               []string{srv.Addr()},
+		MinPollInterval:       -1,
+		Clock:                 clock,
+		MaxOffset:             DefaultMaxOffset,
+		AllowLargeFirstOffset: true,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("第%d次同步失败: %v", i+1, err)
+		}
+		clock.Advance(time.Minute)
+	}
+	if offset := ntp.TimeOffsetDuration(); absDuration(offset+2*time.Hour) > time.Second {
+		t.Errorf("预期偏移量约为-2小时，实际得到%v", offset)
+	}
+}
+
+// TestStepThreshold 测试小于StepThreshold的变化逐渐调整，不小于时直接调整
+func TestStepThreshold(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{
+		Servers:          []string{"127.0.0.1:1"},
+		Clock:            clock,
+		StepThreshold:    DefaultStepThreshold,
+		OutlierThreshold: -1,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	apply := func(offset time.Duration) {
+		t.Helper()
+		if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: offset}); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+	}
+
+	// 首次同步直接调整
+	apply(10 * time.Second)
+	if got := ntp.Now().Sub(clock.Now()); got != 10*time.Second {
+		t.Errorf("预期首次同步直接调整到10秒，实际得到%v", got)
+	}
+
+	// 变化100ms小于阈值，以500ppm的速率调整：前进100秒调整50ms，200秒后完成
+	apply(10*time.Second - 100*time.Millisecond)
+	before := ntp.Now()
+	clock.Advance(100 * time.Second)
+	if got := ntp.Now().Sub(clock.Now()); got != 10*time.Second-50*time.Millisecond {
+		t.Errorf("预期逐渐调整到9.95秒，实际得到%v", got)
+	}
+	if !ntp.Now().After(before) {
+		t.Error("逐渐调整时Now不应回退")
+	}
+	clock.Advance(200 * time.Second)
+	if got := ntp.Now().Sub(clock.Now()); got != 10*time.Second-100*time.Millisecond {
+		t.Errorf("预期调整完成后为9.9秒，实际得到%v", got)
+	}
+
+	// 变化1秒超过阈值，直接调整
+	apply(9 * time.Second)
+	if got := ntp.Now().Sub(clock.Now()); got != 9*time.Second {
+		t.Errorf("预期直接调整到9秒，实际得到%v", got)
+	}
+}
+
+// TestParseThresholds 测试从配置文件解析偏移量阈值
+func TestParseThresholds(t *testing.T) {
+	cfg, err := ParseConfig([]byte("servers:\n  - a\nmax_offset: 1000s\nstep_threshold: 128ms\nallow_large_first_offset: true\n"), "yaml")
+	if err != nil {
+		t.Fatalf("解析配置失败: %v", err)
+	}
+
+	opts := cfg.Options()
+	if opts.MaxOffset != DefaultMaxOffset || opts.StepThreshold != DefaultStepThreshold || !opts.AllowLargeFirstOffset {
+		t.Errorf("偏移量阈值解析错误: %+v", opts)
+	}
+}
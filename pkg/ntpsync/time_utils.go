@@ -8,15 +8,38 @@ import (
 const ntpEpoch = 2208988800
 
 // timeToNTPTime 将time.Time转换为NTP秒和小数部分
+// 32位的秒数只保留所在纪元内的部分，纪元参见NTPEra
 func timeToNTPTime(t time.Time) (uint32, uint32) {
 	seconds := uint32(t.Unix() + ntpEpoch)
-	fraction := uint32(t.Nanosecond() * 0x100000000 / 1000000000)
+	fraction := uint32(uint64(t.Nanosecond()) << 32 / 1000000000)
 	return seconds, fraction
 }
 
-// ntpTimeToTime 将NTP秒和小数部分转换为time.Time
-func ntpTimeToTime(seconds, fraction uint32) time.Time {
-	secs := int64(seconds - ntpEpoch)
+// ntpTimeToTime 将NTP秒和小数部分转换为最接近ref的time.Time
+// 32位的秒数每2^32秒（约136年）回绕一次，不包含纪元，因此取与ref相差不超过半个纪元的时间，
+// 2036年2月纪元0结束之后以及已经使用纪元1的服务器都能得到正确的结果。ref通常为发送请求的时间
+func ntpTimeToTime(seconds, fraction uint32, ref time.Time) time.Time {
+	refSeconds := ref.Unix() + ntpEpoch
+	secs := refSeconds + int64(int32(seconds-uint32(refSeconds))) - ntpEpoch
 	nanos := int64(fraction) * 1000000000 / 0x100000000
 	return time.Unix(secs, nanos)
 }
+
+// NTPEra 返回t所在的NTP纪元。纪元0从1900-01-01开始，纪元1从2036-02-07T06:28:16Z开始，
+// 1900年之前为负数
+func NTPEra(t time.Time) int {
+	return int((t.Unix() + ntpEpoch) >> 32)
+}
+
+// NTPTimestamp 将t转换为64位的NTP时间戳，高32位为纪元内的秒数，低32位为秒的小数部分，
+// 同时返回t所在的纪元
+func NTPTimestamp(t time.Time) (uint64, int) {
+	seconds, fraction := timeToNTPTime(t)
+	return uint64(seconds)<<32 | uint64(fraction), NTPEra(t)
+}
+
+// NTPTimestampTime 将64位的NTP时间戳转换为与ref相差不超过半个纪元（约68年）的时间，
+// ref通常为当前时间
+func NTPTimestampTime(ts uint64, ref time.Time) time.Time {
+	return ntpTimeToTime(uint32(ts>>32), uint32(ts), ref)
+}
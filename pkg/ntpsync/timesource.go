@@ -0,0 +1,76 @@
+package ntpsync
+
+import "time"
+
+// TimeSource 是只提供当前时间的最小接口，供需要"一个时钟"的库接受依赖注入：
+// 库的参数类型为TimeSource，调用者传入NTPSync即可换用NTP校准后的时间，
+// 测试中传入假时钟。benbjohnson/clock、jonboulle/clockwork和k8s.io/utils/clock
+// 的时钟都有Now方法，可以直接作为TimeSource使用
+type TimeSource interface {
+	Now() time.Time
+}
+
+var (
+	_ TimeSource = (*NTPSync)(nil)
+	_ TimeSource = SystemTimeSource{}
+	_ TimeSource = TimeSourceFunc(nil)
+)
+
+// SystemTimeSource 是返回系统时间的TimeSource，用作不需要NTP校准时的默认值
+type SystemTimeSource struct{}
+
+// Now 返回time.Now()
+func (SystemTimeSource) Now() time.Time {
+	return time.Now()
+}
+
+// Since 返回time.Since(t)
+func (SystemTimeSource) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+// Until 返回time.Until(t)
+func (SystemTimeSource) Until(t time.Time) time.Duration {
+	return time.Until(t)
+}
+
+// TimeSourceFunc 把func() time.Time适配为TimeSource
+type TimeSourceFunc func() time.Time
+
+// Now 调用f
+func (f TimeSourceFunc) Now() time.Time {
+	return f()
+}
+
+// Since 返回NTP时间距离t经过的时长，与time.Since相同但使用Now
+// 与Now一起实现k8s.io/utils/clock的PassiveClock
+func (n *NTPSync) Since(t time.Time) time.Duration {
+	return n.Now().Sub(t)
+}
+
+// Until 返回NTP时间到达t还需要的时长，与time.Until相同但使用Now
+func (n *NTPSync) Until(t time.Time) time.Duration {
+	return t.Sub(n.Now())
+}
+
+// ZapClock 把TimeSource适配为go.uber.org/zap/zapcore.Clock，
+// 使日志的时间戳使用NTP校准后的时间：
+//
+//	logger := zap.New(core, zap.WithClock(ntpsync.ZapClock{Source: ntp}))
+type ZapClock struct {
+	// Source 是时间来源，nil表示使用系统时间
+	Source TimeSource
+}
+
+// Now 返回Source的当前时间
+func (c ZapClock) Now() time.Time {
+	if c.Source == nil {
+		return time.Now()
+	}
+	return c.Source.Now()
+}
+
+// NewTicker 返回time.NewTicker(d)。定时器按本地时钟计时，只有时间戳使用Source
+func (c ZapClock) NewTicker(d time.Duration) *time.Ticker {
+	return time.NewTicker(d)
+}
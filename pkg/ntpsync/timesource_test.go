@@ -0,0 +1,35 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTimeSource 测试NTPSync和适配器作为TimeSource使用
+func TestTimeSource(t *testing.T) {
+	clock := newFakeClock()
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: clock})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	start := clock.Now()
+	for _, src := range []TimeSource{ntp, TimeSourceFunc(clock.Now), ZapClock{Source: ntp}} {
+		if diff := src.Now().Sub(start); diff < 0 || diff > time.Microsecond {
+			t.Errorf("%T: 预期返回假时钟的时间，实际相差%v", src, diff)
+		}
+	}
+
+	clock.Advance(time.Minute)
+	if got := ntp.Since(start); got < time.Minute || got > time.Minute+time.Microsecond {
+		t.Errorf("预期Since约为1分钟，实际得到%v", got)
+	}
+	if got := ntp.Until(start.Add(2 * time.Minute)); got > time.Minute || got < time.Minute-time.Microsecond {
+		t.Errorf("预期Until约为1分钟，实际得到%v", got)
+	}
+
+	if diff := time.Since(ZapClock{}.Now()); diff < 0 || diff > time.Second {
+		t.Errorf("预期没有Source时使用系统时间，实际相差%v", diff)
+	}
+}
@@ -0,0 +1,51 @@
+package ntpsync
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Timestamps 是一次NTP交换的原始时间戳，用于排查非对称路径或时钟跳变等问题
+// 交错模式的结果中，Originate、Receive和Destination来自上一次交换，与实际参与计算的时间戳一致
+type Timestamps struct {
+	// Originate (T1) 是客户端发送请求的本地时间
+	Originate time.Time `json:"originate"`
+
+	// Receive (T2) 是服务器收到请求的时间
+	Receive time.Time `json:"receive"`
+
+	// Transmit (T3) 是服务器发送应答的时间
+	Transmit time.Time `json:"transmit"`
+
+	// Destination (T4) 是客户端收到应答的本地时间
+	Destination time.Time `json:"destination"`
+
+	// Reference 是服务器时钟最后一次被校准的时间，服务器未同步或NTPv5应答时为零值
+	Reference time.Time `json:"reference"`
+}
+
+// Offset 根据时间戳计算偏移量 ((T2 - T1) + (T3 - T4)) / 2
+func (ts Timestamps) Offset() time.Duration {
+	return (ts.Receive.Sub(ts.Originate) + ts.Transmit.Sub(ts.Destination)) / 2
+}
+
+// Delay 根据时间戳计算往返延迟 (T4 - T1) - (T3 - T2)
+func (ts Timestamps) Delay() time.Duration {
+	return ts.Destination.Sub(ts.Originate) - ts.Transmit.Sub(ts.Receive)
+}
+
+// referenceTimestamp 解析应答中的参考时间戳，取最接近ref的纪元，全零表示服务器从未同步
+func referenceTimestamp(seconds, fraction uint32, ref time.Time) time.Time {
+	if seconds == 0 && fraction == 0 {
+		return time.Time{}
+	}
+	return ntpTimeToTime(seconds, fraction, ref)
+}
+
+// parseReferenceTimestamp 从应答数据包中解析参考时间戳，NTPv5的应答没有参考时间戳
+func parseReferenceTimestamp(respBytes []byte, version NTPVersion, ref time.Time) time.Time {
+	if version == Version5 {
+		return time.Time{}
+	}
+	return referenceTimestamp(binary.BigEndian.Uint32(respBytes[16:20]), binary.BigEndian.Uint32(respBytes[20:24]), ref)
+}
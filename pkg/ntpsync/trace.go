@@ -0,0 +1,29 @@
+package ntpsync
+
+// PacketDirection 表示数据包的方向
+type PacketDirection string
+
+// 数据包方向
+const (
+	PacketSent     PacketDirection = "sent"     // 发送给服务器的请求
+	PacketReceived PacketDirection = "received" // 从服务器收到的应答
+)
+
+// PacketHook 在每个NTP数据包发送后或收到后被调用，用于协议调试或外部分析
+// raw是数据包的副本，可以保留；decoded是解析后的数据包，数据包头不完整时为零值，
+// 数据包无效时只包含数据包头。钩子在同步过程中被同步调用，应尽快返回
+type PacketHook func(dir PacketDirection, server string, raw []byte, decoded NTPPacket)
+
+// tracePacket 将数据包交给OnPacket钩子，没有设置钩子时不做任何事
+func (n *NTPSync) tracePacket(dir PacketDirection, server string, data []byte) {
+	if n.onPacket == nil {
+		return
+	}
+
+	raw := append([]byte(nil), data...)
+	var decoded NTPPacket
+	if err := decoded.UnmarshalBinary(raw); err != nil && len(raw) >= packetSize {
+		decoded.decodeHeader(raw)
+	}
+	n.onPacket(dir, server, raw, decoded)
+}
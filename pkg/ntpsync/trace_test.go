@@ -0,0 +1,89 @@
+package ntpsync
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// tracedPacket 是OnPacket钩子收到的一个数据包
+type tracedPacket struct {
+	dir     PacketDirection
+	server  string
+	raw     []byte
+	decoded NTPPacket
+}
+
+// TestOnPacket 测试每次交换的请求和应答都交给OnPacket钩子
+func TestOnPacket(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetStratum(2)
+
+	var mutex sync.Mutex
+	var packets []tracedPacket
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: time.Second,
+		OnPacket: func(dir PacketDirection, server string, raw []byte, decoded NTPPacket) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			packets = append(packets, tracedPacket{dir, server, raw, decoded})
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(packets) != 2 {
+		t.Fatalf("预期跟踪到2个数据包，实际得到%d个", len(packets))
+	}
+	sent, received := packets[0], packets[1]
+	if sent.dir != PacketSent || received.dir != PacketReceived {
+		t.Fatalf("数据包方向错误: %s, %s", sent.dir, received.dir)
+	}
+	if sent.server != srv.Addr() || received.server != srv.Addr() {
+		t.Errorf("服务器地址错误: %s, %s", sent.server, received.server)
+	}
+	if NTPMode(sent.decoded.Settings&0x7) != Client || NTPMode(received.decoded.Settings&0x7) != Server {
+		t.Errorf("数据包模式错误: %#x, %#x", sent.decoded.Settings, received.decoded.Settings)
+	}
+	if received.decoded.Stratum != 2 || len(received.raw) != packetSize {
+		t.Errorf("应答解析错误: 层级%d，长度%d", received.decoded.Stratum, len(received.raw))
+	}
+	if received.decoded.OrigTimeSec != sent.decoded.TxTimeSec || received.decoded.OrigTimeFrac != sent.decoded.TxTimeFrac {
+		t.Error("应答的起始时间戳与请求的发送时间戳不一致")
+	}
+}
+
+// TestTracePacketMalformed 测试扩展字段无法解析的数据包仍然解析数据包头
+func TestTracePacketMalformed(t *testing.T) {
+	var got NTPPacket
+	var raw []byte
+	ntp := &NTPSync{onPacket: func(dir PacketDirection, server string, r []byte, decoded NTPPacket) {
+		raw, got = r, decoded
+	}}
+
+	data := make([]byte, packetSize+8)
+	data[0] = 4<<3 | 4
+	data[1] = 3
+	data[packetSize+3] = 0xFF // 扩展字段长度超过数据包
+	ntp.tracePacket(PacketReceived, "example.com:123", data)
+
+	if got.Stratum != 3 || got.Settings != data[0] || got.Extensions != nil {
+		t.Errorf("预期只解析数据包头，实际得到%+v", got)
+	}
+	data[1] = 0
+	if raw[1] != 3 {
+		t.Error("预期钩子收到数据包的副本")
+	}
+}
@@ -0,0 +1,134 @@
+package ntpsync
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"math"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// Tracking 是与chronyc tracking类似的同步状态汇总，由Tracking返回
+type Tracking struct {
+	// Server 是最近一次采用的服务器，从未同步时为空
+	Server string `json:"server,omitempty"`
+
+	// ReferenceID 是以Server为上游时本实例的参考ID：IPv4服务器为其地址，其它服务器为地址MD5摘要的
+	// 前四个字节，与DecodeReferenceID的格式相同；采用本地时钟时为LOCL
+	ReferenceID string `json:"reference_id,omitempty"`
+
+	// Stratum 是本实例的层级，即服务器的层级加1，采用本地时钟时为LocalStratum；从未同步时为0
+	Stratum uint8 `json:"stratum"`
+
+	// LastUpdate 是最后一次成功同步的本地时间
+	LastUpdate time.Time `json:"last_update"`
+
+	// Offset 是当前应用到Now的偏移量，与TimeOffsetDuration相同
+	Offset time.Duration `json:"offset"`
+
+	// LastOffset 是最近一次测得的偏移量，设置了Estimator时可能与Offset不同
+	LastOffset time.Duration `json:"last_offset"`
+
+	// RMSOffset 是同步历史中测得的偏移量的均方根，反映偏移量长期的大小
+	RMSOffset time.Duration `json:"rms_offset"`
+
+	// Frequency 是估计的本地时钟频率偏差，单位为ppm，与GetHoldoverStatus相同，
+	// 正值表示偏移量随时间增大，即本地时钟走得慢；还没有估计出时为0
+	Frequency float64 `json:"frequency_ppm"`
+
+	// ResidualFrequency 是Server最近的测量表明的频率偏差与Frequency之差，单位为ppm，
+	// 持续偏大表示频率偏差的估计没有跟上变化；样本不足时为0
+	ResidualFrequency float64 `json:"residual_frequency_ppm"`
+
+	// Skew 是Frequency的估计误差，单位为ppm
+	Skew float64 `json:"skew_ppm"`
+
+	// RootDelay 是到主参考源的总往返延迟，即服务器的根延迟加上往返时间
+	RootDelay time.Duration `json:"root_delay"`
+
+	// RootDispersion 是到主参考源的总离散度，包括服务器的根离散度、精度、往返期间
+	// 和同步之后本地时钟可能的频率误差造成的误差
+	RootDispersion time.Duration `json:"root_dispersion"`
+
+	// UpdateInterval 是最近两次成功同步的间隔，只同步过一次时为0
+	UpdateInterval time.Duration `json:"update_interval"`
+}
+
+// Tracking 返回与chronyc tracking类似的同步状态汇总，根据最近一次采用的同步结果、
+// 同步历史和估计频率偏差的内部估计器计算。从未同步时只有Offset有效
+func (n *NTPSync) Tracking() Tracking {
+	local := n.clock.Now()
+
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	tracking := Tracking{Offset: n.timeOffset}
+	results := n.history.last(0)
+	applied := make([]SyncResult, 0, len(results))
+	for _, r := range results {
+		if r.Error == nil && !r.Rejected {
+			applied = append(applied, r)
+		}
+	}
+	if len(applied) == 0 || n.lastSync.IsZero() {
+		return tracking
+	}
+
+	last := applied[len(applied)-1]
+	tracking.Server = last.Server
+	tracking.LastUpdate = n.lastSync
+	tracking.LastOffset = last.Offset
+	if len(applied) > 1 {
+		tracking.UpdateInterval = last.Time.Sub(applied[len(applied)-2].Time)
+	}
+
+	var sum float64
+	for _, r := range applied {
+		sum += float64(r.Offset) * float64(r.Offset)
+	}
+	tracking.RMSOffset = time.Duration(math.Sqrt(sum / float64(len(applied))))
+
+	if last.Server == LocalClockName {
+		tracking.ReferenceID = "LOCL"
+		tracking.Stratum = last.Stratum
+	} else {
+		tracking.ReferenceID = referenceIDFor(last.Server)
+		tracking.Stratum = min(last.Stratum+1, 16)
+	}
+
+	freq, skew, ok := n.drift.fit()
+	if ok {
+		tracking.Frequency = freq * 1e6
+		tracking.Skew = skew * 1e6
+	}
+	if s, found := n.sourceSamples[last.Server]; found {
+		if serverFreq, _, ok := fitDrift(s.last(DriftWindow)); ok {
+			tracking.ResidualFrequency = (serverFreq - freq) * 1e6
+		}
+	}
+
+	tracking.RootDelay = last.RootDelay + last.RTT
+	age := max(local.Sub(n.lastSync)+n.suspendedSinceSync, 0)
+	tracking.RootDispersion = last.RootDispersion + last.Precision +
+		time.Duration(float64(last.RTT+age)*frequencyTolerance)
+	return tracking
+}
+
+// referenceIDFor 返回以server为上游时本实例的参考ID（RFC 5905）：
+// IPv4地址本身，IPv6地址为其MD5摘要的前四个字节，主机名等无法得知地址时为名称的MD5摘要的前四个字节
+func referenceIDFor(server string) string {
+	host := server
+	if h, _, err := net.SplitHostPort(server); err == nil {
+		host = h
+	}
+	key := []byte(host)
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr = addr.Unmap(); addr.Is4() {
+			return addr.String()
+		}
+		key = addr.AsSlice()
+	}
+	sum := md5.Sum(key)
+	return DecodeReferenceID(2, binary.BigEndian.Uint32(sum[:4]))
+}
@@ -0,0 +1,76 @@
+package ntpsync
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestTracking 测试同步状态汇总中的层级、偏移量统计和频率偏差
+func TestTracking(t *testing.T) {
+	clock := newFakeClock()
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetStratum(2)
+	srv.SetRootDelay(10 * time.Millisecond)
+	srv.SetRootDispersion(5 * time.Millisecond)
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		MinPollInterval: -1,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if tr := ntp.Tracking(); tr.Server != "" || tr.Stratum != 0 {
+		t.Errorf("预期从未同步时没有服务器，实际得到%+v", tr)
+	}
+
+	// 偏移量每分钟增大1ms，即本地时钟慢约16.7ppm
+	for i := 0; i < 8; i++ {
+		srv.SetOffset(time.Duration(i+1) * time.Millisecond)
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("同步失败: %v", err)
+		}
+		clock.Advance(time.Minute)
+	}
+
+	tr := ntp.Tracking()
+	if tr.Server != srv.Addr() || tr.ReferenceID != "127.0.0.1" || tr.Stratum != 3 {
+		t.Errorf("预期服务器为%s、参考ID为127.0.0.1、层级为3，实际得到%+v", srv.Addr(), tr)
+	}
+	if absDuration(tr.LastOffset-8*time.Millisecond) > time.Microsecond || tr.Offset != ntp.TimeOffsetDuration() {
+		t.Errorf("预期最近的偏移量约为8ms，实际得到%v", tr.LastOffset)
+	}
+	// 1到8ms的均方根约为5.05ms
+	if want := 5050 * time.Microsecond; absDuration(tr.RMSOffset-want) > 10*time.Microsecond {
+		t.Errorf("预期偏移量的均方根约为%v，实际得到%v", want, tr.RMSOffset)
+	}
+	if math.Abs(tr.Frequency-1e3/60) > 0.1 || math.Abs(tr.ResidualFrequency) > 0.1 || tr.Skew > 0.1 {
+		t.Errorf("预期频率偏差约为16.7ppm且残差和误差很小，实际得到%+v", tr)
+	}
+	if absDuration(tr.UpdateInterval-time.Minute) > time.Millisecond {
+		t.Errorf("预期同步间隔约为1分钟，实际得到%v", tr.UpdateInterval)
+	}
+	// 根延迟以16位小数的定点数传输，略小于10ms
+	if tr.RootDelay < 9*time.Millisecond || tr.RootDispersion < 5*time.Millisecond {
+		t.Errorf("预期根延迟和根离散度包括服务器的值，实际得到%v和%v", tr.RootDelay, tr.RootDispersion)
+	}
+}
+
+// TestReferenceIDFor 测试按上游服务器的地址计算参考ID
+func TestReferenceIDFor(t *testing.T) {
+	if got := referenceIDFor("192.168.1.10:123"); got != "192.168.1.10" {
+		t.Errorf("预期IPv4服务器的参考ID为其地址，实际得到%q", got)
+	}
+	v6 := referenceIDFor("[2001:db8::1]:123")
+	if v6 == "" || v6 != referenceIDFor("2001:db8::1") || v6 == referenceIDFor("[2001:db8::2]:123") {
+		t.Errorf("预期IPv6服务器的参考ID由地址决定，实际得到%q", v6)
+	}
+}
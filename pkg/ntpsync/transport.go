@@ -0,0 +1,239 @@
+package ntpsync
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// Dialer 建立到NTP服务器的UDP连接
+// *net.Dialer实现了此接口。自定义实现可以绑定网卡、使用VRF、设置SO_MARK，
+// 或者在测试中提供内存中的传输。返回的连接必须保留数据报边界并支持SetDeadline
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// errSocketOptionsUnsupported 表示当前平台不支持绑定网卡和设置DSCP
+var errSocketOptionsUnsupported = errors.New("当前平台不支持绑定网卡和设置DSCP")
+
+// DSCPExpeditedForwarding 是加速转发（EF）的DSCP值，常用于时间同步等低延迟流量
+const DSCPExpeditedForwarding = 46
+
+// socketConfig 是NTP套接字的源地址、网卡和DSCP设置
+type socketConfig struct {
+	// localAddr 是源IP地址，nil表示由系统选择
+	localAddr net.IP
+
+	// control 在套接字创建后绑定网卡和设置DSCP，nil表示不需要
+	control func(network, address string, c syscall.RawConn) error
+
+	// hardwareTimestamps 表示使用网卡硬件时间戳，参见Options.HardwareTimestamps
+	hardwareTimestamps bool
+}
+
+// newSocketConfig 检查并创建套接字设置
+func newSocketConfig(localAddr, iface string, dscp int) (socketConfig, error) {
+	var cfg socketConfig
+	if localAddr != "" {
+		if cfg.localAddr = net.ParseIP(localAddr); cfg.localAddr == nil {
+			return cfg, fmt.Errorf("无效的源地址 %q", localAddr)
+		}
+	}
+	if iface != "" {
+		if _, err := net.InterfaceByName(iface); err != nil {
+			return cfg, fmt.Errorf("网卡 %s 不可用: %v", iface, err)
+		}
+	}
+	if dscp < 0 || dscp > 63 {
+		return cfg, fmt.Errorf("无效的DSCP值%d，必须在0到63之间", dscp)
+	}
+	if iface == "" && dscp == 0 {
+		return cfg, nil
+	}
+	if !socketOptionsSupported {
+		return cfg, errSocketOptionsUnsupported
+	}
+
+	cfg.control = func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if iface != "" {
+				if sockErr = bindToDevice(fd, iface); sockErr != nil {
+					return
+				}
+			}
+			if dscp != 0 {
+				sockErr = setDSCP(fd, network, dscp)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+	return cfg, nil
+}
+
+// dialer 返回按套接字设置建立连接的net.Dialer
+func (c socketConfig) dialer() *net.Dialer {
+	dialer := &net.Dialer{Control: c.control}
+	if c.localAddr != nil {
+		dialer.LocalAddr = &net.UDPAddr{IP: c.localAddr}
+	}
+	return dialer
+}
+
+// dial 使用配置的Dialer连接服务器，连接过程不超过timeout
+func (n *NTPSync) dial(ctx context.Context, server string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if n.dialer != nil {
+		if n.resolver != nil {
+			address, err := resolveServer(ctx, n.resolver, server)
+			if err != nil {
+				return nil, err
+			}
+			server = address
+		}
+		return n.dialer.DialContext(ctx, "udp", server)
+	}
+	return n.socketConfig.dialer().DialContext(ctx, "udp", server)
+}
+
+// exchange 是与服务器的一次请求和应答，丢包时可以重新发送请求
+type exchange interface {
+	// send 发送请求并重新开始计算等待应答的超时时间
+	// 之后只接受起始时间戳与这个请求匹配的应答
+	send(req []byte) error
+
+	// receive 等待应答，返回应答内容和收到应答的本地时间，超时时返回os.ErrDeadlineExceeded
+	// 应答的缓冲区取自缓冲池，调用者用完后通过putPacket放回
+	receive() ([]byte, time.Time, error)
+
+	// timestamps 返回内核记录的上一个请求的发送时间，未知时返回零值，
+	// 以及上一个应答的接收时间是否由网卡硬件时间戳得出
+	timestamps() (sent time.Time, hardware bool)
+
+	// close 释放这次交换占用的资源
+	close()
+}
+
+// openExchange 准备与服务器交换一次数据包，ctx被取消时中止
+// 解析地址和建立连接不超过dialTimeout，之后的发送和等待应答不超过readTimeout
+// 设置了Dialer时每次交换建立单独的连接，否则使用实例共用的套接字
+func (n *NTPSync) openExchange(ctx context.Context, server string, dialTimeout, readTimeout time.Duration) (exchange, error) {
+	if n.dialer == nil {
+		socket, err := n.sharedSocket()
+		if err != nil {
+			return nil, err
+		}
+		e, err := socket.open(ctx, server, dialTimeout, readTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	conn, err := n.dial(ctx, server, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// 实例关闭时立即中断读写
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+
+	e := &connExchange{conn: conn, ctx: ctx, stop: stop, now: n.clock.Now, readTimeout: readTimeout}
+	// 自定义Dialer返回的连接是UDP套接字时同样使用内核接收时间戳
+	if udp, ok := conn.(*net.UDPConn); ok && n.kernelTimestamps() && setSocketOption(udp, setKernelTimestamps) {
+		e.udp = udp
+	}
+	return e, nil
+}
+
+// connExchange 是使用单独连接的交换
+type connExchange struct {
+	conn        net.Conn
+	ctx         context.Context
+	stop        func() bool
+	now         func() time.Time
+	readTimeout time.Duration
+	origins     []uint64
+
+	// udp 非nil时从中读取应答和内核接收时间戳
+	udp *net.UDPConn
+}
+
+// send 设置读写超时后发送请求，并记录应答的起始时间戳可能的值
+func (e *connExchange) send(req []byte) error {
+	if e.ctx.Err() != nil {
+		return e.ctx.Err()
+	}
+	if err := e.conn.SetDeadline(time.Now().Add(e.readTimeout)); err != nil {
+		return fmt.Errorf("设置超时时间失败: %v", err)
+	}
+	e.origins = appendOrigins(e.origins[:0], req)
+	_, err := e.conn.Write(req)
+	return err
+}
+
+// receive 读取应答，跳过起始时间戳不匹配的数据包，例如之前请求迟到的应答
+func (e *connExchange) receive() ([]byte, time.Time, error) {
+	buf := getPacket(maxPacketSize)
+	var oob []byte
+	if e.udp != nil {
+		oob = make([]byte, kernelTimestampSpace)
+	}
+	for {
+		bytesRead, oobRead, err := e.read(buf, oob)
+		if err != nil {
+			putPacket(buf)
+			return nil, time.Time{}, err
+		}
+		received := receiveTime(e.now(), oob[:oobRead])
+		if bytesRead >= packetSize && !slices.Contains(e.origins, binary.BigEndian.Uint64(buf[24:32])) {
+			continue
+		}
+		return buf[:bytesRead], received, nil
+	}
+}
+
+// read 读取一个数据包，启用了内核接收时间戳时同时读取控制消息
+func (e *connExchange) read(buf, oob []byte) (int, int, error) {
+	if e.udp == nil {
+		n, err := e.conn.Read(buf)
+		return n, 0, err
+	}
+	n, oobn, _, _, err := e.udp.ReadMsgUDP(buf, oob)
+	return n, oobn, err
+}
+
+// timestamps 单独的连接不记录发送时间戳
+func (e *connExchange) timestamps() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// close 停止监听实例关闭并关闭连接
+func (e *connExchange) close() {
+	e.stop()
+	e.conn.Close()
+}
+
+// appendOrigins 将应答的起始时间戳字段可能携带的值追加到origins：
+// 版本3和版本4回显请求的发送时间戳，交错模式回显请求的接收时间戳，
+// NTPv5回显请求中的客户端Cookie
+func appendOrigins(origins []uint64, req []byte) []uint64 {
+	for offset := 24; offset < packetSize; offset += 8 {
+		if origin := binary.BigEndian.Uint64(req[offset:]); origin != 0 {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
@@ -0,0 +1,204 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// redirectDialer 将所有连接重定向到测试服务器，并记录请求的地址
+type redirectDialer struct {
+	target string
+	err    error
+
+	mutex     sync.Mutex
+	addresses []string
+}
+
+func (d *redirectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mutex.Lock()
+	d.addresses = append(d.addresses, address)
+	d.mutex.Unlock()
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, d.target)
+}
+
+// TestCustomDialer 测试使用自定义的Dialer建立连接
+func TestCustomDialer(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetOffset(time.Second)
+
+	dialer := &redirectDialer{target: srv.Addr()}
+	ntp, err := New(Options{
+		Servers:         []string{"ntp.invalid"},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+		Dialer:          dialer,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if offset := ntp.TimeOffsetDuration(); offset < 900*time.Millisecond || offset > 1100*time.Millisecond {
+		t.Errorf("预期偏移量约为1秒，实际得到%v", offset)
+	}
+	if len(dialer.addresses) != 1 || dialer.addresses[0] != "ntp.invalid:123" {
+		t.Errorf("预期通过Dialer连接ntp.invalid:123，实际得到%v", dialer.addresses)
+	}
+
+	dialer.err = errors.New("网络不可达")
+	if err := ntp.Sync(); err == nil {
+		t.Error("预期Dialer失败时同步失败，实际成功")
+	}
+}
+
+// TestLocalAddr 测试绑定源地址，以及无效的绑定配置
+func TestLocalAddr(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+		LocalAddr:       "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	requests := srv.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("预期1个请求，实际得到%d个", len(requests))
+	}
+	if addr, ok := requests[0].From.(*net.UDPAddr); !ok || !addr.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("预期请求来自127.0.0.1，实际来自%v", requests[0].From)
+	}
+
+	invalid := []Options{
+		{Servers: []string{srv.Addr()}, LocalAddr: "not-an-ip"},
+		{Servers: []string{srv.Addr()}, Interface: "no-such-nic0"},
+		{Servers: []string{srv.Addr()}, LocalAddr: "127.0.0.1", Dialer: &net.Dialer{}},
+		{Servers: []string{srv.Addr()}, DSCP: 64},
+	}
+	for _, opts := range invalid {
+		if _, err := New(opts); err == nil {
+			t.Errorf("预期选项%+v返回错误，实际得到nil", opts)
+		}
+	}
+}
+
+// slowDialer 在建立连接前等待一段时间，模拟缓慢的DNS解析
+type slowDialer struct {
+	delay time.Duration
+}
+
+func (d slowDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	select {
+	case <-time.After(d.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+// TestSplitTimeouts 测试分别设置建立连接和等待应答的超时时间
+func TestSplitTimeouts(t *testing.T) {
+	srv := ntptest.NewServer()
+	defer srv.Close()
+
+	ntp, err := New(Options{
+		Servers:         []string{srv.Addr()},
+		Timeout:         5 * time.Second,
+		DialTimeout:     time.Second,
+		ReadTimeout:     100 * time.Millisecond,
+		MinPollInterval: -1,
+		Dialer:          slowDialer{delay: 200 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	// 建立连接比等待应答的超时时间更长
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 服务器不应答时按ReadTimeout而不是Timeout超时
+	srv.SetDrop(true)
+	start := time.Now()
+	if err := ntp.Sync(); err == nil {
+		t.Fatal("预期服务器不应答时同步失败，实际成功")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("预期约300毫秒后超时，实际用了%v", elapsed)
+	}
+}
+
+// TestVirtualNetwork 测试在虚拟网络中确定性地模拟丢包、延迟和故障切换
+func TestVirtualNetwork(t *testing.T) {
+	clock := newFakeClock()
+	network := ntptest.NewNetwork()
+	network.SetClock(clock.Now, clock.Advance)
+
+	primary := network.NewServer("10.0.0.1:123")
+	primary.Script(ntptest.Step{Drop: true})
+	backup := network.NewServer("10.0.0.2:123")
+	backup.SetDelay(40 * time.Millisecond)
+	backup.SetOffset(2 * time.Second)
+
+	ntp, err := New(Options{
+		Servers:         []string{primary.Addr(), backup.Addr()},
+		Timeout:         time.Second,
+		MinPollInterval: -1,
+		Dialer:          network,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	// 第一个服务器丢包，切换到第二个服务器，偏移量和往返时间与设置完全一致
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	result := ntp.GetHistory(1)[0]
+	if result.Server != backup.Addr() {
+		t.Errorf("预期切换到%s，实际使用%s", backup.Addr(), result.Server)
+	}
+	if got := result.Offset.Round(time.Microsecond); got != 2*time.Second {
+		t.Errorf("预期偏移量为2s，实际得到%v", result.Offset)
+	}
+	if got := result.RTT.Round(time.Microsecond); got != 40*time.Millisecond {
+		t.Errorf("预期往返时间为40ms，实际得到%v", result.RTT)
+	}
+
+	// 脚本用完后第一个服务器恢复应答
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if result := ntp.GetHistory(1)[0]; result.Server != primary.Addr() || result.RTT != 0 {
+		t.Errorf("预期使用恢复的%s且没有延迟，实际得到%+v", primary.Addr(), result)
+	}
+}
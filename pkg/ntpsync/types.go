@@ -5,6 +5,7 @@ import (
 )
 
 // NTPPacket 表示符合RFC 5905的NTP数据包结构
+// 使用MarshalBinary和UnmarshalBinary与网络字节序相互转换
 type NTPPacket struct {
 	// 闰秒指示器(2位)，版本号(3位)和模式(3位)
 	Settings       uint8
@@ -22,6 +23,12 @@ type NTPPacket struct {
 	RxTimeFrac     uint32
 	TxTimeSec      uint32
 	TxTimeFrac     uint32
+	
+	// Extensions 是数据包头之后的扩展字段
+	Extensions []ExtensionField
+	
+	// MAC 是末尾的旧式消息认证码（密钥ID加摘要），没有时为nil
+	MAC []byte
 }
 
 // NTPMode 表示NTP数据包的模式
@@ -64,41 +71,123 @@ const (
 // SyncResult 表示NTP同步的结果
 type SyncResult struct {
 	// Server 是用于同步的NTP服务器
-	Server string
+	Server string `json:"server"`
 	
 	// Time 是同步后的时间
-	Time time.Time
+	Time time.Time `json:"time"`
 	
 	// Offset 是本地时间与NTP时间之间的计算偏移量
-	Offset time.Duration
+	Offset time.Duration `json:"offset"`
 	
 	// RTT (往返时间) 是从服务器获取响应所需的时间
-	RTT time.Duration
+	RTT time.Duration `json:"rtt"`
 	
 	// Stratum 是NTP服务器的层级
-	Stratum uint8
+	Stratum uint8 `json:"stratum"`
+	
+	// Version 是服务器应答使用的NTP版本
+	Version NTPVersion `json:"version,omitempty"`
+	
+	// Interleaved 表示结果来自交错模式的应答，测量的是上一次交换
+	Interleaved bool `json:"interleaved,omitempty"`
+	
+	// ReferenceID 是服务器的参考ID，例如"GPS"或上游服务器的IP地址，
+	// 参见DecodeReferenceID。NTPv5应答没有参考ID，此时为空
+	ReferenceID string `json:"reference_id,omitempty"`
+	
+	// Extensions 是应答中的扩展字段，包括无法识别的字段
+	Extensions []ExtensionField `json:"extensions,omitempty"`
+	
+	// Uncertainty 是时间源保证的偏移量误差上限，NTP服务器的结果为零
+	Uncertainty time.Duration `json:"uncertainty,omitempty"`
+	
+	// RootDistance 是NTP服务器时间相对主参考源的最大误差，
+	// 由根延迟、根离散度、往返时间和抖动计算，其它时间源的结果为零
+	RootDistance time.Duration `json:"root_distance,omitempty"`
+	
+	// RootDelay 是应答中服务器到主参考源的往返延迟
+	RootDelay time.Duration `json:"root_delay,omitempty"`
+	
+	// RootDispersion 是应答中服务器相对主参考源累积的误差
+	RootDispersion time.Duration `json:"root_dispersion,omitempty"`
+	
+	// Precision 是应答中服务器时钟的精度，即读取时钟的分辨率
+	Precision time.Duration `json:"precision,omitempty"`
+	
+	// Poll 是应答中服务器建议的轮询间隔，服务器没有设置时为零值
+	Poll time.Duration `json:"poll,omitempty"`
+	
+	// HuffPuff 是huff-n'-puff滤波器对偏移量的修正，已经计入Offset，参见Options.HuffPuff
+	HuffPuff time.Duration `json:"huff_puff,omitempty"`
+	
+	// Asymmetry 是按ServerOptions.Asymmetry对偏移量的修正，即配置的非对称的一半取反，已经计入Offset
+	Asymmetry time.Duration `json:"asymmetry,omitempty"`
+	
+	// HardwareTimestamps 表示往返时间由网卡硬件时间戳计算，参见Options.HardwareTimestamps
+	HardwareTimestamps bool `json:"hardware_timestamps,omitempty"`
+	
+	// Timestamps 是计算偏移量和往返时间使用的原始时间戳，其它时间源的结果为nil
+	Timestamps *Timestamps `json:"timestamps,omitempty"`
 	
 	// Error 是同步过程中发生的任何错误
-	Error error
+	Error error `json:"-"`
+	
+	// Rejected 表示结果的偏移量被判定为异常值或超过MaxOffset而没有应用
+	Rejected bool `json:"rejected,omitempty"`
 }
 
 // ServerStatus 表示NTP服务器的状态
 type ServerStatus struct {
 	// Address 是NTP服务器的地址
-	Address string
+	Address string `json:"address"`
 	
 	// Reachable 表示服务器是否可达
-	Reachable bool
+	Reachable bool `json:"reachable"`
+	
+	// Reach 是8位的可达性寄存器，与ntpq -p的reach列相同：每次请求左移一位，
+	// 收到应答时最低位置1。以八进制显示时377表示最近8次请求都收到了应答
+	Reach uint8 `json:"reach"`
 	
 	// LastResponse 是最后一次成功响应的时间
-	LastResponse time.Time
+	LastResponse time.Time `json:"last_response"`
 	
 	// RTT 是最后测量的往返时间
-	RTT time.Duration
+	RTT time.Duration `json:"rtt"`
 	
 	// Stratum 是NTP服务器的层级
-	Stratum uint8
+	Stratum uint8 `json:"stratum"`
+	
+	// ReferenceID 是服务器最后应答的参考ID，显示服务器从哪里获得时间
+	ReferenceID string `json:"reference_id,omitempty"`
 	
 	// Offset 是最后测量的时间偏移量
-	Offset time.Duration
+	Offset time.Duration `json:"offset"`
+	
+	// Jitter 是最近样本中相邻偏移量之差的均方根
+	Jitter time.Duration `json:"jitter"`
+	
+	// RootDistance 是最后测量的根距离
+	RootDistance time.Duration `json:"root_distance"`
+	
+	// RootDelay 是服务器最后应答的根延迟
+	RootDelay time.Duration `json:"root_delay,omitempty"`
+	
+	// RootDispersion 是服务器最后应答的根离散度
+	RootDispersion time.Duration `json:"root_dispersion,omitempty"`
+	
+	// Precision 是服务器最后应答的时钟精度
+	Precision time.Duration `json:"precision,omitempty"`
+	
+	// Poll 是服务器最后应答的轮询间隔，没有设置时为零值
+	Poll time.Duration `json:"poll,omitempty"`
+	
+	// ConsecutiveFailures 是服务器连续失败的次数
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	
+	// HeldDownUntil 是服务器因连续失败被暂时排除的截止时间，零值表示未被排除
+	HeldDownUntil time.Time `json:"held_down_until"`
+	
+	// Score 是服务器的健康评分（0到100），综合了可达性、
+	// 与其它服务器偏移量的一致性和往返时间的稳定性，用于服务器排序
+	Score float64 `json:"score"`
 }
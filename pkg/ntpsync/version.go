@@ -0,0 +1,113 @@
+package ntpsync
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// DefaultVersion 是没有为服务器单独指定协议版本时首先使用的NTP版本
+const DefaultVersion = Version4
+
+// validateVersion 检查配置的协议版本是否受支持，零值表示自动协商
+func validateVersion(version NTPVersion) error {
+	switch version {
+	case 0, Version3, Version4, Version5:
+		return nil
+	default:
+		return fmt.Errorf("不支持的NTP版本%d，只支持版本3、版本4和实验性的版本5", version)
+	}
+}
+
+// validateServerOptions 检查按服务器设置的配置，ntpv5表示是否启用了实验性的NTPv5支持
+func validateServerOptions(opts map[string]ServerOptions, ntpv5 bool, keys Keys) error {
+	for server, o := range opts {
+		if err := validateVersion(o.Version); err != nil {
+			return fmt.Errorf("服务器 %s: %v", server, err)
+		}
+		if o.Version == Version5 && !ntpv5 {
+			return fmt.Errorf("服务器 %s: 使用NTPv5需要启用ExperimentalNTPv5", server)
+		}
+		if o.KeyID == 0 {
+			continue
+		}
+		if _, ok := keys[o.KeyID]; !ok {
+			return fmt.Errorf("服务器 %s: 密钥 %d 不存在", server, o.KeyID)
+		}
+		if o.Version == Version5 {
+			return fmt.Errorf("服务器 %s: NTPv5不支持对称密钥认证", server)
+		}
+	}
+	return nil
+}
+
+// versionState 记录与一个服务器协商协议版本的进展
+type versionState struct {
+	// version 是下一次请求使用的版本
+	version NTPVersion
+
+	// confirmed 表示服务器已经以该版本应答过
+	confirmed bool
+
+	// downgraded 表示NTPv5请求失败后已经降级到版本4
+	downgraded bool
+}
+
+// requestVersion 返回向服务器发送请求时使用的协议版本，以及该版本是否由配置指定
+// configured是配置中的服务器地址，address是包含端口的服务器地址
+func (n *NTPSync) requestVersion(configured, address string) (NTPVersion, bool) {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	if o, ok := n.serverOptions[configured]; ok && o.Version != 0 {
+		return o.Version, true
+	}
+	if state, ok := n.versions[address]; ok {
+		return state.version, false
+	}
+	return DefaultVersion, false
+}
+
+// recordVersion 记录服务器应答使用的协议版本，之后的请求使用该版本
+// 只支持NTPv3的旧服务器会以版本3应答版本4的请求
+func (n *NTPSync) recordVersion(address string, version NTPVersion) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.versions == nil {
+		n.versions = make(map[string]versionState)
+	}
+	downgraded := n.versions[address].downgraded
+	n.versions[address] = versionState{version: version, confirmed: true, downgraded: downgraded}
+}
+
+// versionTimedOut 在自动协商的请求超时后调用
+// 服务器从未应答过时，下一次请求改用另一个版本，
+// 以兼容丢弃版本4请求的旧服务器
+func (n *NTPSync) versionTimedOut(address string, requested NTPVersion, err error) {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return
+	}
+
+	if requested == Version5 {
+		n.downgradeVersion(address)
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if state, ok := n.versions[address]; ok && state.confirmed {
+		return
+	}
+
+	next := Version3
+	if requested == Version3 {
+		next = Version4
+	}
+	if n.versions == nil {
+		n.versions = make(map[string]versionState)
+	}
+	n.versions[address] = versionState{version: next, downgraded: n.versions[address].downgraded}
+}
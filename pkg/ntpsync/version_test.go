@@ -0,0 +1,124 @@
+package ntpsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hy-iot/ntpsync/v2/pkg/ntpsync/ntptest"
+)
+
+// TestServerVersion 测试按服务器指定NTP版本
+func TestServerVersion(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetMaxVersion(3)
+
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: time.Second,
+		Clock:   clock,
+		ServerOptions: map[string]ServerOptions{
+			srv.Addr(): {Version: Version3},
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 1 || requests[0].Version != 3 {
+		t.Fatalf("预期服务器收到1个版本3的请求，实际得到%+v", requests)
+	}
+	if history := ntp.GetHistory(1); len(history) != 1 || history[0].Version != Version3 {
+		t.Errorf("预期同步结果的版本为3，实际得到%+v", history)
+	}
+
+	// 不支持的版本
+	_, err = New(Options{
+		Servers: []string{srv.Addr()},
+		ServerOptions: map[string]ServerOptions{
+			srv.Addr(): {Version: Version2},
+		},
+	})
+	if err == nil {
+		t.Error("预期版本2返回错误，实际得到nil")
+	}
+}
+
+// TestVersionNegotiation 测试与只支持NTPv3的服务器自动协商版本
+func TestVersionNegotiation(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+	srv.SetMaxVersion(3)
+
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: 100 * time.Millisecond,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	// 版本4的请求被丢弃
+	if err := ntp.Sync(); err == nil {
+		t.Fatal("预期版本4的请求超时，实际得到nil")
+	}
+
+	// 之后改用版本3，并在服务器应答后保持使用版本3
+	for i := 0; i < 3; i++ {
+		clock.Advance(DefaultMinPollInterval)
+		if err := ntp.Sync(); err != nil {
+			t.Fatalf("第%d次版本3同步失败: %v", i+1, err)
+		}
+	}
+
+	var versions []uint8
+	for _, r := range srv.Requests() {
+		versions = append(versions, r.Version)
+	}
+	want := []uint8{4, 3, 3, 3}
+	if len(versions) != len(want) {
+		t.Fatalf("预期请求版本为%v，实际得到%v", want, versions)
+	}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Fatalf("预期请求版本为%v，实际得到%v", want, versions)
+		}
+	}
+}
+
+// TestVersionResponse 测试支持版本4的服务器以请求的版本应答
+func TestVersionResponse(t *testing.T) {
+	clock := newFakeClock()
+
+	srv := ntptest.NewServer()
+	defer srv.Close()
+	srv.SetNow(clock.Now)
+
+	ntp, err := New(Options{
+		Servers: []string{srv.Addr()},
+		Timeout: time.Second,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	if err := ntp.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if history := ntp.GetHistory(1); len(history) != 1 || history[0].Version != Version4 {
+		t.Errorf("预期同步结果的版本为4，实际得到%+v", history)
+	}
+}
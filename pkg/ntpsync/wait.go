@@ -0,0 +1,47 @@
+package ntpsync
+
+import (
+	"context"
+)
+
+// WaitForSync 阻塞直到第一次同步成功，ctx到期时返回ctx.Err()，实例关闭时返回ErrClosed
+// 已经同步过时立即返回nil。不能在同步之前产生时间戳的应用（例如校验TLS证书、
+// 为遥测数据签名）可以在启动时等待，WaitForSync本身不会触发同步
+func (n *NTPSync) WaitForSync(ctx context.Context) error {
+	n.mutex.Lock()
+	synced := n.syncedLocked()
+	n.mutex.Unlock()
+
+	select {
+	case <-synced:
+		return nil
+	default:
+	}
+
+	select {
+	case <-synced:
+		return nil
+	case <-n.context().Done():
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// syncedLocked 返回第一次同步成功时关闭的通道，调用者必须持有n.mutex
+func (n *NTPSync) syncedLocked() chan struct{} {
+	if n.synced == nil {
+		n.synced = make(chan struct{})
+	}
+	return n.synced
+}
+
+// markSyncedLocked 通知等待第一次同步的调用者，调用者必须持有n.mutex
+func (n *NTPSync) markSyncedLocked() {
+	synced := n.syncedLocked()
+	select {
+	case <-synced:
+	default:
+		close(synced)
+	}
+}
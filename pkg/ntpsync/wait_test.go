@@ -0,0 +1,64 @@
+package ntpsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestWaitForSync 测试等待第一次同步成功
+func TestWaitForSync(t *testing.T) {
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: newFakeClock()})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+	defer ntp.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := ntp.WaitForSync(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("预期同步之前等待超时，实际得到%v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- ntp.WaitForSync(context.Background()) }()
+
+	if err := ntp.SyncWithSource(context.Background(), &fakeSource{offset: time.Second}); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("预期同步后返回nil，实际得到%v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("同步后WaitForSync没有返回")
+	}
+
+	// 已经同步过时立即返回
+	if err := ntp.WaitForSync(ctx); err != nil {
+		t.Errorf("预期已同步时返回nil，实际得到%v", err)
+	}
+}
+
+// TestWaitForSyncClosed 测试实例关闭时停止等待
+func TestWaitForSyncClosed(t *testing.T) {
+	ntp, err := New(Options{Servers: []string{"127.0.0.1:1"}, Clock: newFakeClock()})
+	if err != nil {
+		t.Fatalf("创建NTPSync实例失败: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- ntp.WaitForSync(context.Background()) }()
+
+	ntp.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("预期返回ErrClosed，实际得到%v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("关闭后WaitForSync没有返回")
+	}
+}